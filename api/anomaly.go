@@ -85,6 +85,8 @@ type AnomalyDatabaseSchemaDriftPayload struct {
 	Expect string `json:"expect,omitempty"`
 	// The actual schema dumped from the database
 	Actual string `json:"actual,omitempty"`
+	// The issue tracking the remediation of the drift, created if the drift action of the repository is DriftActionCreateIssue
+	IssueID int `json:"issueId,omitempty"`
 }
 
 // Anomaly is the API message for an anomaly.
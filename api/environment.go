@@ -3,8 +3,36 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 )
 
+// EnvironmentTier is the tier of an environment, deciding the default policies of the environment.
+type EnvironmentTier string
+
+const (
+	// EnvironmentTierUnspecified is the environment without tier defaults.
+	EnvironmentTierUnspecified EnvironmentTier = "UNSPECIFIED"
+	// EnvironmentTierProd is the production environment tier.
+	EnvironmentTierProd EnvironmentTier = "PROD"
+	// EnvironmentTierStaging is the staging environment tier.
+	EnvironmentTierStaging EnvironmentTier = "STAGING"
+	// EnvironmentTierDev is the development environment tier.
+	EnvironmentTierDev EnvironmentTier = "DEV"
+)
+
+func (t EnvironmentTier) String() string {
+	return string(t)
+}
+
+// ValidateEnvironmentTier validates the environment tier.
+func ValidateEnvironmentTier(tier EnvironmentTier) error {
+	switch tier {
+	case EnvironmentTierUnspecified, EnvironmentTierProd, EnvironmentTierStaging, EnvironmentTierDev:
+		return nil
+	}
+	return fmt.Errorf("invalid environment tier %q, must be one of 'UNSPECIFIED', 'PROD', 'STAGING' or 'DEV'", tier)
+}
+
 // Environment is the API message for an environment.
 type Environment struct {
 	ID int `jsonapi:"primary,environment"`
@@ -19,8 +47,9 @@ type Environment struct {
 	UpdatedTs int64      `jsonapi:"attr,updatedTs"`
 
 	// Domain specific fields
-	Name  string `jsonapi:"attr,name"`
-	Order int    `jsonapi:"attr,order"`
+	Name  string          `jsonapi:"attr,name"`
+	Order int             `jsonapi:"attr,order"`
+	Tier  EnvironmentTier `jsonapi:"attr,tier"`
 }
 
 // EnvironmentCreate is the API message for creating an environment.
@@ -28,9 +57,14 @@ type EnvironmentCreate struct {
 	// Standard fields
 	// Value is assigned from the jwt subject field passed by the client.
 	CreatorID int
+	// Plan is the plan of the subscription, limiting the number of environments.
+	// Value is assigned by the server from the current subscription.
+	Plan PlanType
 
 	// Domain specific fields
 	Name string `jsonapi:"attr,name"`
+	// Tier is UNSPECIFIED if omitted.
+	Tier EnvironmentTier `jsonapi:"attr,tier"`
 }
 
 // EnvironmentFind is the API message for finding environments.
@@ -59,8 +93,9 @@ type EnvironmentPatch struct {
 	UpdaterID int
 
 	// Domain specific fields
-	Name  *string `jsonapi:"attr,name"`
-	Order *int    `jsonapi:"attr,order"`
+	Name  *string          `jsonapi:"attr,name"`
+	Order *int             `jsonapi:"attr,order"`
+	Tier  *EnvironmentTier `jsonapi:"attr,tier"`
 }
 
 // EnvironmentDelete is the API message for deleting an environment.
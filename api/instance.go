@@ -36,6 +36,8 @@ type Instance struct {
 	Username      string  `jsonapi:"attr,username"`
 	// Password is not returned to the client
 	Password string
+	// QuotaWarning is only set in the create response, when the instance count is approaching the quota of the plan.
+	QuotaWarning string `jsonapi:"attr,quotaWarning,omitempty"`
 }
 
 // InstanceCreate is the API message for creating an instance.
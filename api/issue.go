@@ -148,6 +148,10 @@ type UpdateSchemaDetail struct {
 	RollbackStatement string `json:"rollbackStatement"`
 	// EarliestAllowedTs the earliest execution time of the change at system local Unix timestamp in nanoseconds.
 	EarliestAllowedTs int64 `jsonapi:"attr,earliestAllowedTs"`
+	// MigrationType and VCSPushEvent override those of the context for the detail, so that the migration files
+	// pushed together are applied by a single issue, each by its own tasks.
+	MigrationType db.MigrationType `json:"migrationType,omitempty"`
+	VCSPushEvent  *vcs.PushEvent   `json:"pushEvent,omitempty"`
 }
 
 // UpdateSchemaContext is the issue create context for updating database schema.
@@ -159,6 +163,9 @@ type UpdateSchemaContext struct {
 	UpdateSchemaDetailList []*UpdateSchemaDetail `json:"updateSchemaDetailList"`
 	// VCSPushEvent is the event information for VCS push.
 	VCSPushEvent *vcs.PushEvent
+	// DeploymentConfigID is the deployment config staging the pipeline of a tenant mode project.
+	// If nil, the deployment config of the project is used.
+	DeploymentConfigID *int `json:"deploymentConfigId,omitempty"`
 }
 
 // IssueFind is the API message for finding issues.
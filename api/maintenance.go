@@ -0,0 +1,12 @@
+package api
+
+// Maintenance is the API message for the maintenance mode.
+type Maintenance struct {
+	IsMaintenance      bool `jsonapi:"attr,isMaintenance"`
+	DeferredEventCount int  `jsonapi:"attr,deferredEventCount"`
+}
+
+// MaintenancePatch is the API message for patching the maintenance mode.
+type MaintenancePatch struct {
+	IsMaintenance bool `jsonapi:"attr,isMaintenance"`
+}
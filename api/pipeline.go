@@ -50,6 +50,9 @@ type Pipeline struct {
 	// Domain specific fields
 	Name   string         `jsonapi:"attr,name"`
 	Status PipelineStatus `jsonapi:"attr,status"`
+	// Queued is true if the pipeline is waiting to run because the number of running pipelines has reached
+	// the limit of the current plan. It's computed by the task scheduler and isn't persisted.
+	Queued bool `jsonapi:"attr,queued"`
 }
 
 // PipelineCreate is the API message for creating a pipeline.
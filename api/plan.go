@@ -27,6 +27,104 @@ func (p PlanType) String() string {
 	return ""
 }
 
+// MaxConcurrentPipelines returns the maximum number of pipelines allowed to run concurrently for the plan.
+// -1 means unlimited.
+func (p PlanType) MaxConcurrentPipelines() int {
+	switch p {
+	case FREE:
+		return 1
+	case TEAM:
+		return 5
+	}
+	return -1
+}
+
+// MaxConcurrentQuerySessions returns the maximum number of query sessions allowed to run concurrently in the SQL console for the plan.
+// -1 means unlimited.
+func (p PlanType) MaxConcurrentQuerySessions() int {
+	switch p {
+	case FREE:
+		return 1
+	case TEAM:
+		return 10
+	}
+	return -1
+}
+
+// EnvironmentQuota returns the maximum number of environments allowed for the plan.
+// -1 means unlimited.
+func (p PlanType) EnvironmentQuota() int {
+	switch p {
+	case FREE:
+		return 2
+	case TEAM:
+		return 10
+	}
+	return -1
+}
+
+// MaxReviewRules returns the maximum number of SQL review rules allowed to be active for the plan.
+// -1 means unlimited.
+func (p PlanType) MaxReviewRules() int {
+	switch p {
+	case FREE:
+		return 5
+	case TEAM:
+		return 20
+	}
+	return -1
+}
+
+// QuotaStatusType is the status of the usage of a quota.
+type QuotaStatusType string
+
+const (
+	// QuotaOK means the usage is well below the quota.
+	QuotaOK QuotaStatusType = "OK"
+	// QuotaWarn means the usage is approaching the quota, the creation is allowed with a warning.
+	QuotaWarn QuotaStatusType = "WARN"
+	// QuotaExceeded means the usage has reached the quota, the creation is blocked.
+	QuotaExceeded QuotaStatusType = "EXCEEDED"
+
+	// QuotaWarnPercent is the percentage of the quota used from which the usage is warned.
+	QuotaWarnPercent = 80
+)
+
+// QuotaStatus is the usage of a quota, e.g. the instance count.
+type QuotaStatus struct {
+	Status QuotaStatusType `jsonapi:"attr,status"`
+	// Percent is the percentage of the quota used, rounded down. It's 0 if the quota is unlimited.
+	Percent int `jsonapi:"attr,percent"`
+	Current int `jsonapi:"attr,current"`
+	// Quota is -1 if unlimited.
+	Quota int `jsonapi:"attr,quota"`
+}
+
+// QuotaUsage returns the usage of the quota of the plan with the current count.
+// quota returns the quota of a plan, -1 means unlimited.
+func (p PlanType) QuotaUsage(current int, quota func(PlanType) int) QuotaStatus {
+	status := QuotaStatus{
+		Status:  QuotaOK,
+		Current: current,
+		Quota:   quota(p),
+	}
+	if status.Quota < 0 {
+		return status
+	}
+	if status.Quota == 0 {
+		status.Status = QuotaExceeded
+		return status
+	}
+	status.Percent = current * 100 / status.Quota
+	switch {
+	case current >= status.Quota:
+		status.Status = QuotaExceeded
+	case status.Percent >= QuotaWarnPercent:
+		status.Status = QuotaWarn
+	}
+	return status
+}
+
 // FeatureType is the type of a feature.
 type FeatureType string
 
@@ -81,6 +179,11 @@ const (
 	// e.g. One can configure to NOT require backup for dev environment while require
 	//      weekly backup for staging and daily backup for production.
 	FeatureBackupPolicy FeatureType = "bb.feature.backup-policy"
+	// FeatureCustomApprovalChain allows user to specify the multi-step approval chain for the environment
+	//
+	// e.g. One can configure the changes to production to be approved by the team lead, then the DBA,
+	//      then the security team in order. Without it, the single approval of the approval policy applies.
+	FeatureCustomApprovalChain FeatureType = "bb.feature.custom-approval-chain"
 
 	// Admin & Security
 
@@ -94,6 +197,14 @@ const (
 	//
 	// Currently, we only support GitLab EE/CE OAuth login.
 	Feature3rdPartyLogin FeatureType = "bb.feature.3rd-party-login"
+
+	// SQL Editor
+
+	// FeatureQueryConsole allows user to run the read-only queries in the SQL console.
+	//
+	// It's available to all plans, while the number of the concurrent query sessions is limited by
+	// PlanType.MaxConcurrentQuerySessions.
+	FeatureQueryConsole FeatureType = "bb.feature.query-console"
 )
 
 func (e FeatureType) String() string {
@@ -114,10 +225,14 @@ func (e FeatureType) String() string {
 		return "bb.feature.approval-policy"
 	case FeatureBackupPolicy:
 		return "bb.feature.backup-policy"
+	case FeatureCustomApprovalChain:
+		return "bb.feature.custom-approval-chain"
 	case FeatureRBAC:
 		return "bb.feature.rbac"
 	case Feature3rdPartyLogin:
 		return "bb.feature.3rd-party-login"
+	case FeatureQueryConsole:
+		return "bb.feature.query-console"
 	}
 	return ""
 }
@@ -141,14 +256,39 @@ func (e FeatureType) Name() string {
 		return "Approval policy"
 	case FeatureBackupPolicy:
 		return "Backup policy"
+	case FeatureCustomApprovalChain:
+		return "Custom approval chain"
 	case FeatureRBAC:
 		return "RBAC"
 	case Feature3rdPartyLogin:
 		return "3rd party login"
+	case FeatureQueryConsole:
+		return "Query console"
 	}
 	return ""
 }
 
+// FeatureGate is the feature-gating decision of a feature for a plan.
+type FeatureGate struct {
+	Enabled bool `jsonapi:"attr,enabled"`
+	// MinimumPlan is the minimum plan supporting the feature.
+	MinimumPlan PlanType `jsonapi:"attr,minimumPlan"`
+	// Message tells which plan to upgrade to if the feature is disabled. It's empty if the feature is enabled.
+	Message string `jsonapi:"attr,message"`
+}
+
+// GateInfo returns the feature-gating decision of the feature for the current plan.
+func (e FeatureType) GateInfo(current PlanType) FeatureGate {
+	gate := FeatureGate{
+		Enabled:     FeatureMatrix[e][current],
+		MinimumPlan: e.minimumSupportedPlan(),
+	}
+	if !gate.Enabled {
+		gate.Message = e.AccessErrorMessage()
+	}
+	return gate
+}
+
 // AccessErrorMessage returns a error message with feature name and minimum supported plan.
 func (e FeatureType) AccessErrorMessage() string {
 	plan := e.minimumSupportedPlan()
@@ -176,13 +316,48 @@ var FeatureMatrix = map[FeatureType][3]bool{
 	"bb.feature.data-source":            {false, false, false},
 	"bb.feature.approval-policy":        {false, true, true},
 	"bb.feature.backup-policy":          {false, true, true},
+	"bb.feature.custom-approval-chain":  {false, false, true},
 	"bb.feature.rbac":                   {false, true, true},
 	"bb.feature.3rd-party-login":        {false, true, true},
+	"bb.feature.query-console":          {true, true, true},
 }
 
 // Plan is the API message for a plan.
 type Plan struct {
 	Type PlanType `jsonapi:"attr,type"`
+	// FeatureOverrides enables or disables the feature regardless of the plan type.
+	// They are granted by the license, e.g. enabling an ENTERPRISE feature for a TEAM plan.
+	FeatureOverrides map[FeatureType]bool
+}
+
+// GateInfo returns the feature-gating decision of the feature for the plan, taking the feature overrides into account.
+func (p Plan) GateInfo(feature FeatureType) FeatureGate {
+	gate := feature.GateInfo(p.Type)
+	if enabled, ok := p.FeatureOverrides[feature]; ok {
+		gate.Enabled = enabled
+		gate.Message = ""
+		if !enabled {
+			gate.Message = fmt.Sprintf("%s is disabled by the license.", feature.Name())
+		}
+	}
+	return gate
+}
+
+// FeatureUsage is the API message for the adoption of a feature.
+type FeatureUsage struct {
+	Feature FeatureType `jsonapi:"attr,feature"`
+	// Available is true if the plan permits the feature.
+	Available bool `jsonapi:"attr,available"`
+	// Configured is true if the feature is actually set up, regardless of whether it's available,
+	// e.g. it's configured before downgrading the plan.
+	Configured bool `jsonapi:"attr,configured"`
+}
+
+// FeatureUsageReport is the API message for the adoption of the features on the plan.
+type FeatureUsageReport struct {
+	Plan PlanType `jsonapi:"attr,plan"`
+	// FeatureList is ordered by the feature type.
+	FeatureList []*FeatureUsage `jsonapi:"attr,featureList"`
 }
 
 // PlanPatch is the API message for patching a plan.
@@ -0,0 +1,200 @@
+package api
+
+import "testing"
+
+func TestFeatureGateInfo(t *testing.T) {
+	tests := []struct {
+		name            string
+		feature         FeatureType
+		current         PlanType
+		wantEnabled     bool
+		wantMinimumPlan PlanType
+		wantMessage     string
+	}{
+		{
+			name:            "enabled feature",
+			feature:         FeatureMultiTenancy,
+			current:         TEAM,
+			wantEnabled:     true,
+			wantMinimumPlan: TEAM,
+			wantMessage:     "",
+		},
+		{
+			name:            "disabled TEAM feature",
+			feature:         FeatureMultiTenancy,
+			current:         FREE,
+			wantEnabled:     false,
+			wantMinimumPlan: TEAM,
+			wantMessage:     "Multi-tenancy is a TEAM feature, please upgrade to access it.",
+		},
+		{
+			name:            "disabled ENTERPRISE feature",
+			feature:         FeatureDBAWorkflow,
+			current:         TEAM,
+			wantEnabled:     false,
+			wantMinimumPlan: ENTERPRISE,
+			wantMessage:     "DBA workflow is a ENTERPRISE feature, please upgrade to access it.",
+		},
+		{
+			name:            "custom approval chain on TEAM",
+			feature:         FeatureCustomApprovalChain,
+			current:         TEAM,
+			wantEnabled:     false,
+			wantMinimumPlan: ENTERPRISE,
+			wantMessage:     "Custom approval chain is a ENTERPRISE feature, please upgrade to access it.",
+		},
+		{
+			name:            "custom approval chain on ENTERPRISE",
+			feature:         FeatureCustomApprovalChain,
+			current:         ENTERPRISE,
+			wantEnabled:     true,
+			wantMinimumPlan: ENTERPRISE,
+			wantMessage:     "",
+		},
+	}
+
+	for _, test := range tests {
+		gate := test.feature.GateInfo(test.current)
+		if gate.Enabled != test.wantEnabled {
+			t.Errorf("%q: GateInfo() got enabled %v, want %v.", test.name, gate.Enabled, test.wantEnabled)
+		}
+		if gate.MinimumPlan != test.wantMinimumPlan {
+			t.Errorf("%q: GateInfo() got minimum plan %s, want %s.", test.name, gate.MinimumPlan, test.wantMinimumPlan)
+		}
+		if gate.Message != test.wantMessage {
+			t.Errorf("%q: GateInfo() got message %q, want %q.", test.name, gate.Message, test.wantMessage)
+		}
+	}
+}
+
+func TestPlanGateInfo(t *testing.T) {
+	plan := Plan{
+		Type: TEAM,
+		FeatureOverrides: map[FeatureType]bool{
+			FeatureDBAWorkflow: true,
+			FeatureSchemaDrift: false,
+		},
+	}
+
+	tests := []struct {
+		name        string
+		feature     FeatureType
+		wantEnabled bool
+		wantMessage string
+	}{
+		{
+			name:        "enabled by the override",
+			feature:     FeatureDBAWorkflow,
+			wantEnabled: true,
+			wantMessage: "",
+		},
+		{
+			name:        "disabled by the override",
+			feature:     FeatureSchemaDrift,
+			wantEnabled: false,
+			wantMessage: "Schema drift is disabled by the license.",
+		},
+		{
+			name:        "no override",
+			feature:     FeatureMultiTenancy,
+			wantEnabled: true,
+			wantMessage: "",
+		},
+	}
+
+	for _, test := range tests {
+		gate := plan.GateInfo(test.feature)
+		if gate.Enabled != test.wantEnabled {
+			t.Errorf("%q: GateInfo() got enabled %v, want %v.", test.name, gate.Enabled, test.wantEnabled)
+		}
+		if gate.Message != test.wantMessage {
+			t.Errorf("%q: GateInfo() got message %q, want %q.", test.name, gate.Message, test.wantMessage)
+		}
+	}
+}
+
+func TestQuotaUsage(t *testing.T) {
+	quota := func(p PlanType) int {
+		switch p {
+		case FREE:
+			return 5
+		case TEAM:
+			return 10
+		}
+		return -1
+	}
+
+	tests := []struct {
+		name        string
+		plan        PlanType
+		current     int
+		wantStatus  QuotaStatusType
+		wantPercent int
+	}{
+		{
+			name:        "below the warning",
+			plan:        TEAM,
+			current:     7,
+			wantStatus:  QuotaOK,
+			wantPercent: 70,
+		},
+		{
+			name:        "at the warning boundary",
+			plan:        TEAM,
+			current:     8,
+			wantStatus:  QuotaWarn,
+			wantPercent: 80,
+		},
+		{
+			name:        "approaching the quota",
+			plan:        FREE,
+			current:     4,
+			wantStatus:  QuotaWarn,
+			wantPercent: 80,
+		},
+		{
+			name:        "at the quota",
+			plan:        FREE,
+			current:     5,
+			wantStatus:  QuotaExceeded,
+			wantPercent: 100,
+		},
+		{
+			name:        "unlimited",
+			plan:        ENTERPRISE,
+			current:     1000,
+			wantStatus:  QuotaOK,
+			wantPercent: 0,
+		},
+	}
+
+	for _, test := range tests {
+		status := test.plan.QuotaUsage(test.current, quota)
+		if status.Status != test.wantStatus {
+			t.Errorf("%q: QuotaUsage() got status %s, want %s.", test.name, status.Status, test.wantStatus)
+		}
+		if status.Percent != test.wantPercent {
+			t.Errorf("%q: QuotaUsage() got percent %d, want %d.", test.name, status.Percent, test.wantPercent)
+		}
+	}
+}
+
+func TestMaxReviewRules(t *testing.T) {
+	tests := []struct {
+		plan       PlanType
+		current    int
+		wantStatus QuotaStatusType
+	}{
+		{FREE, 4, QuotaWarn},
+		{FREE, 5, QuotaExceeded},
+		{TEAM, 5, QuotaOK},
+		{TEAM, 20, QuotaExceeded},
+		{ENTERPRISE, 100, QuotaOK},
+	}
+
+	for _, test := range tests {
+		if status := test.plan.QuotaUsage(test.current, PlanType.MaxReviewRules); status.Status != test.wantStatus {
+			t.Errorf("QuotaUsage() of %d review rules on %s got status %s, want %s.", test.current, test.plan, status.Status, test.wantStatus)
+		}
+	}
+}
@@ -102,6 +102,54 @@ type PolicyService interface {
 // PipelineApprovalPolicy is the policy configuration for pipeline approval
 type PipelineApprovalPolicy struct {
 	Value PipelineApprovalValue `json:"value"`
+	// MinHoldDuration is the minimum number of seconds between the approval of a task and its execution, giving the
+	// last-minute chance to abort the approved change. 0 means the approved task runs right away.
+	MinHoldDuration int64 `json:"minHoldDuration,omitempty"`
+	// ApprovalChain is the multi-step approval of the tasks, which requires FeatureCustomApprovalChain.
+	// If nil, the single approval applies.
+	ApprovalChain *ApprovalChain `json:"approvalChain,omitempty"`
+}
+
+// ApprovalChain is the ordered steps approving a task, e.g. the team lead, then the DBA, then the security team.
+// The task is approved once every step is approved in order, each by a different principal.
+type ApprovalChain struct {
+	StepList []*ApprovalStep `json:"stepList"`
+}
+
+// ApprovalStep is a step of the approval chain, approved by a principal having the role.
+type ApprovalStep struct {
+	// Name is the label of the step, e.g. "Security".
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+}
+
+// Approval is the approval of a task by a principal in the role the principal has at the time.
+type Approval struct {
+	PrincipalID int   `json:"principalId"`
+	Role        Role  `json:"role"`
+	ApprovedTs  int64 `json:"approvedTs"`
+}
+
+// NextApprover returns the next outstanding step of the approval chain given the approvals in order, or true if every step
+// is approved. An approval only approves the outstanding step if the principal has the role of the step and hasn't approved
+// an earlier step, so the approvals out of the order of the chain don't count.
+func NextApprover(chain ApprovalChain, approvals []Approval) (*ApprovalStep, bool) {
+	next := 0
+	approverIDs := make(map[int]bool)
+	for _, approval := range approvals {
+		if next == len(chain.StepList) {
+			break
+		}
+		if approval.Role != chain.StepList[next].Role || approverIDs[approval.PrincipalID] {
+			continue
+		}
+		approverIDs[approval.PrincipalID] = true
+		next++
+	}
+	if next == len(chain.StepList) {
+		return nil, true
+	}
+	return chain.StepList[next], false
 }
 
 func (pa PipelineApprovalPolicy) String() (string, error) {
@@ -143,6 +191,19 @@ func UnmarshalBackupPlanPolicy(payload string) (*BackupPlanPolicy, error) {
 	return &bp, nil
 }
 
+// DefaultBackupPolicy returns the backup plan policy of the environment tier, which applies to the environment
+// without an explicit backup plan policy.
+// The production environments are backed up daily, the staging environments weekly and the others aren't backed up.
+func DefaultBackupPolicy(tier EnvironmentTier) BackupPlanPolicy {
+	switch tier {
+	case EnvironmentTierProd:
+		return BackupPlanPolicy{Schedule: BackupPlanPolicyScheduleDaily}
+	case EnvironmentTierStaging:
+		return BackupPlanPolicy{Schedule: BackupPlanPolicyScheduleWeekly}
+	}
+	return BackupPlanPolicy{Schedule: BackupPlanPolicyScheduleUnset}
+}
+
 // ValidatePolicy will validate the policy type and payload values.
 func ValidatePolicy(pType PolicyType, payload string) error {
 	if !PolicyTypes[pType] {
@@ -161,6 +222,25 @@ func ValidatePolicy(pType PolicyType, payload string) error {
 		if pa.Value != PipelineApprovalValueManualNever && pa.Value != PipelineApprovalValueManualAlways {
 			return fmt.Errorf("invalid approval policy value: %q", payload)
 		}
+		if pa.MinHoldDuration < 0 {
+			return fmt.Errorf("invalid approval policy minimum hold duration: %d", pa.MinHoldDuration)
+		}
+		if pa.MinHoldDuration > 0 && pa.Value != PipelineApprovalValueManualAlways {
+			return fmt.Errorf("approval policy minimum hold duration requires the manual approval")
+		}
+		if chain := pa.ApprovalChain; chain != nil {
+			if pa.Value != PipelineApprovalValueManualAlways {
+				return fmt.Errorf("approval chain requires the manual approval")
+			}
+			if len(chain.StepList) == 0 {
+				return fmt.Errorf("approval chain must have at least one step")
+			}
+			for i, step := range chain.StepList {
+				if step.Role != Owner && step.Role != DBA && step.Role != Developer {
+					return fmt.Errorf("invalid role %q of approval chain step %d", step.Role, i+1)
+				}
+			}
+		}
 	case PolicyTypeBackupPlan:
 		bp, err := UnmarshalBackupPlanPolicy(payload)
 		if err != nil {
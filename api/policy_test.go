@@ -0,0 +1,93 @@
+package api
+
+import "testing"
+
+func TestDefaultBackupPolicy(t *testing.T) {
+	tests := []struct {
+		tier EnvironmentTier
+		want BackupPlanPolicySchedule
+	}{
+		{
+			tier: EnvironmentTierProd,
+			want: BackupPlanPolicyScheduleDaily,
+		},
+		{
+			tier: EnvironmentTierStaging,
+			want: BackupPlanPolicyScheduleWeekly,
+		},
+		{
+			tier: EnvironmentTierDev,
+			want: BackupPlanPolicyScheduleUnset,
+		},
+		{
+			tier: EnvironmentTierUnspecified,
+			want: BackupPlanPolicyScheduleUnset,
+		},
+	}
+
+	for _, test := range tests {
+		policy := DefaultBackupPolicy(test.tier)
+		if policy.Schedule != test.want {
+			t.Errorf("DefaultBackupPolicy(%s) got schedule %s, want %s.", test.tier, policy.Schedule, test.want)
+		}
+	}
+}
+
+func TestNextApprover(t *testing.T) {
+	chain := ApprovalChain{
+		StepList: []*ApprovalStep{
+			{Name: "Team lead", Role: Developer},
+			{Name: "DBA", Role: DBA},
+			{Name: "Security", Role: Owner},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		approvals []Approval
+		wantStep  string
+		wantDone  bool
+	}{
+		{
+			name:     "no approval",
+			wantStep: "Team lead",
+		},
+		{
+			name:      "first step approved",
+			approvals: []Approval{{PrincipalID: 101, Role: Developer}},
+			wantStep:  "DBA",
+		},
+		{
+			name:      "approval out of order doesn't count",
+			approvals: []Approval{{PrincipalID: 102, Role: DBA}, {PrincipalID: 101, Role: Developer}},
+			wantStep:  "DBA",
+		},
+		{
+			name:      "same principal can't approve two steps",
+			approvals: []Approval{{PrincipalID: 101, Role: Developer}, {PrincipalID: 101, Role: DBA}},
+			wantStep:  "DBA",
+		},
+		{
+			name:      "chain satisfied",
+			approvals: []Approval{{PrincipalID: 101, Role: Developer}, {PrincipalID: 102, Role: DBA}, {PrincipalID: 103, Role: Owner}},
+			wantDone:  true,
+		},
+	}
+
+	for _, test := range tests {
+		step, done := NextApprover(chain, test.approvals)
+		if done != test.wantDone {
+			t.Errorf("%q: NextApprover() got done %v, want %v.", test.name, done, test.wantDone)
+			continue
+		}
+		if test.wantDone {
+			if step != nil {
+				t.Errorf("%q: NextApprover() got step %+v, want nil.", test.name, step)
+			}
+			continue
+		}
+		if step == nil || step.Name != test.wantStep {
+			t.Errorf("%q: NextApprover() got step %+v, want %q.", test.name, step, test.wantStep)
+		}
+	}
+}
@@ -5,10 +5,14 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"net/mail"
+	"net/url"
+	"path"
 	"regexp"
 	"strings"
 
 	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
 )
 
 // DefaultProjectID is the ID for the default project.
@@ -22,6 +26,10 @@ const (
 	UIWorkflow ProjectWorkflowType = "UI"
 	// VCSWorkflow is the VCS workflow.
 	VCSWorkflow ProjectWorkflowType = "VCS"
+	// VCSPendingCleanupWorkflow is the workflow of the project whose repository is unlinked with the deferred cleanup.
+	// The project works as the UI workflow, e.g. the issues are created in Bytebase, while re-linking the same repository within the grace window restores the VCS workflow
+	// with the repository settings. The project flips to the UI workflow once the grace window ends.
+	VCSPendingCleanupWorkflow ProjectWorkflowType = "VCS_PENDING_CLEANUP"
 )
 
 func (e ProjectWorkflowType) String() string {
@@ -30,6 +38,8 @@ func (e ProjectWorkflowType) String() string {
 		return "UI"
 	case VCSWorkflow:
 		return "VCS"
+	case VCSPendingCleanupWorkflow:
+		return "VCS_PENDING_CLEANUP"
 	}
 	return ""
 }
@@ -230,6 +240,182 @@ func ValidateRepositorySchemaPathTemplate(schemaPathTemplate string, tenantMode
 	return nil
 }
 
+// ValidateRepositoryIgnorePathPatterns validates the repository ignore path glob patterns.
+func ValidateRepositoryIgnorePathPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return fmt.Errorf("empty ignore path pattern")
+		}
+		if strings.Contains(pattern, ",") {
+			return fmt.Errorf("ignore path pattern %q must not contain comma", pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid ignore path pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// ValidateRepositoryCommitAuthorEmail validates the email of the commit author. Empty email is allowed.
+func ValidateRepositoryCommitAuthorEmail(email string) error {
+	if email == "" {
+		return nil
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return fmt.Errorf("invalid commit author email %q", email)
+	}
+	return nil
+}
+
+// ValidateRepositoryCommitStatusContext validates the context of the commit status reported to the VCS provider.
+func ValidateRepositoryCommitStatusContext(statusContext string) error {
+	if strings.TrimSpace(statusContext) == "" {
+		return fmt.Errorf("commit status context must not be empty")
+	}
+	if len(statusContext) > vcs.MaxCommitStatusContextLength {
+		return fmt.Errorf("commit status context %q exceeds the maximum length %d", statusContext, vcs.MaxCommitStatusContextLength)
+	}
+	return nil
+}
+
+// ValidateRepositorySkipDirective validates the keyword in the head commit message skipping the push event. Empty directive is allowed.
+func ValidateRepositorySkipDirective(directive string) error {
+	if directive == "" {
+		return nil
+	}
+	if strings.TrimSpace(directive) != directive {
+		return fmt.Errorf("skip directive %q must not contain leading or trailing whitespace", directive)
+	}
+	if strings.ContainsAny(directive, "\r\n") {
+		return fmt.Errorf("skip directive %q must be a single line", directive)
+	}
+	if len(directive) > MaxRepositorySkipDirectiveLength {
+		return fmt.Errorf("skip directive %q exceeds the maximum length %d", directive, MaxRepositorySkipDirectiveLength)
+	}
+	return nil
+}
+
+// ValidateRepositorySchemaRef validates the branch, tag or commit SHA the schema baseline is read from. Empty ref is allowed.
+// The ref may be fully qualified by "refs/heads/" or "refs/tags/".
+func ValidateRepositorySchemaRef(ref string) error {
+	if ref == "" {
+		return nil
+	}
+	if strings.ContainsAny(ref, " \t\r\n") {
+		return fmt.Errorf("schema ref %q must not contain whitespace", ref)
+	}
+	if strings.Contains(ref, "..") {
+		return fmt.Errorf("schema ref %q must not contain \"..\"", ref)
+	}
+	if strings.HasPrefix(ref, "refs/") && !strings.HasPrefix(ref, "refs/heads/") && !strings.HasPrefix(ref, "refs/tags/") {
+		return fmt.Errorf("schema ref %q must be a branch, a tag or a commit SHA", ref)
+	}
+	if len(ref) > MaxRepositorySchemaRefLength {
+		return fmt.Errorf("schema ref %q exceeds the maximum length %d", ref, MaxRepositorySchemaRefLength)
+	}
+	return nil
+}
+
+// ValidateRepositoryTargetBranchFilter validates the glob pattern of the merge request target branches. Empty filter is allowed.
+func ValidateRepositoryTargetBranchFilter(filter string) error {
+	if filter == "" {
+		return nil
+	}
+	if strings.HasPrefix(filter, "refs/tags/") {
+		return fmt.Errorf("target branch filter %q must not match tags", filter)
+	}
+	if _, err := path.Match(filter, ""); err != nil {
+		return fmt.Errorf("invalid target branch filter %q: %v", filter, err)
+	}
+	return nil
+}
+
+// ValidateRepositorySchemaSourceType validates the repository schema source type.
+// The directory schema source requires the schema path template to locate the directory.
+func ValidateRepositorySchemaSourceType(sourceType SchemaSourceType, schemaPathTemplate string) error {
+	switch sourceType {
+	case SchemaSourceSingleFile:
+		return nil
+	case SchemaSourceDirectory:
+		if schemaPathTemplate == "" {
+			return fmt.Errorf("schema path template is required for the %s schema source", sourceType)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid schema source type %q", sourceType)
+}
+
+// ValidateRepositorySchemaSnapshotOnApply validates the schema snapshot on apply can be written to the schema path.
+// The schema dump can't be split back into the schema files, so the DIRECTORY schema source isn't supported.
+func ValidateRepositorySchemaSnapshotOnApply(enabled bool, sourceType SchemaSourceType, schemaPathTemplate string) error {
+	if !enabled {
+		return nil
+	}
+	if schemaPathTemplate == "" {
+		return fmt.Errorf("schema path template is required for the schema snapshot on apply")
+	}
+	if sourceType == SchemaSourceDirectory {
+		return fmt.Errorf("schema snapshot on apply isn't supported for the %s schema source", sourceType)
+	}
+	return nil
+}
+
+// ValidateRepositoryDuplicateVersionPolicy validates the duplicate version policy of the repository.
+func ValidateRepositoryDuplicateVersionPolicy(policy DuplicateVersionPolicy) error {
+	switch policy {
+	case DuplicateVersionError, DuplicateVersionLatestWins, DuplicateVersionBranchScoped:
+		return nil
+	}
+	return fmt.Errorf("invalid duplicate version policy %q", policy)
+}
+
+// ValidateRepositoryEmptyMigrationPolicy validates the empty migration policy of the repository.
+func ValidateRepositoryEmptyMigrationPolicy(policy EmptyMigrationPolicy) error {
+	switch policy {
+	case EmptyMigrationError, EmptyMigrationSkip, EmptyMigrationAllow:
+		return nil
+	}
+	return fmt.Errorf("invalid empty migration policy %q", policy)
+}
+
+// ValidateRepositoryMigrationStatementTimeout validates the migration statement timeout in seconds of the repository.
+func ValidateRepositoryMigrationStatementTimeout(timeout int) error {
+	if timeout < 0 || timeout > MaxMigrationStatementTimeout {
+		return fmt.Errorf("invalid migration statement timeout %d, must be between 0 and %d seconds", timeout, MaxMigrationStatementTimeout)
+	}
+	return nil
+}
+
+// ValidateRepositoryDriftAction validates the schema drift action of the repository.
+func ValidateRepositoryDriftAction(action DriftAction) error {
+	switch action {
+	case DriftActionAnomalyOnly, DriftActionCreateIssue:
+		return nil
+	}
+	return fmt.Errorf("invalid drift action %q", action)
+}
+
+// ValidateRepositoryNotificationWebhookURLList validates the URLs notified of the outcome of the migrations synced from the repository.
+func ValidateRepositoryNotificationWebhookURLList(urlList []string) error {
+	for _, webhookURL := range urlList {
+		if strings.Contains(webhookURL, ",") {
+			return fmt.Errorf("notification webhook URL %q must not contain comma", webhookURL)
+		}
+		u, err := url.Parse(webhookURL)
+		if err != nil {
+			return fmt.Errorf("invalid notification webhook URL %q: %v", webhookURL, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("notification webhook URL %q must use http or https", webhookURL)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("notification webhook URL %q must contain the host", webhookURL)
+		}
+	}
+	return nil
+}
+
 // ValidateProjectDBNameTemplate validates the project database name template.
 func ValidateProjectDBNameTemplate(template string) error {
 	if template == "" {
@@ -298,3 +298,113 @@ func TestGetBaseDatabaseName(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateRepositoryCommitStatusContext(t *testing.T) {
+	tests := []struct {
+		statusContext string
+		wantErr       bool
+	}{
+		{"bytebase/schema", false},
+		{"ci/bytebase", false},
+		{"", true},
+		{"   ", true},
+		{strings.Repeat("x", 255), false},
+		{strings.Repeat("x", 256), true},
+	}
+
+	for _, test := range tests {
+		err := ValidateRepositoryCommitStatusContext(test.statusContext)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ValidateRepositoryCommitStatusContext(%q) got error %v, want error %v.", test.statusContext, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidateRepositorySkipDirective(t *testing.T) {
+	tests := []struct {
+		directive string
+		wantErr   bool
+	}{
+		{"", false},
+		{"[skip bytebase]", false},
+		{"[no migrate]", false},
+		{" [skip bytebase]", true},
+		{"[skip\nbytebase]", true},
+		{strings.Repeat("x", 64), false},
+		{strings.Repeat("x", 65), true},
+	}
+
+	for _, test := range tests {
+		err := ValidateRepositorySkipDirective(test.directive)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ValidateRepositorySkipDirective(%q) got error %v, want error %v.", test.directive, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidateRepositorySchemaRef(t *testing.T) {
+	tests := []struct {
+		ref     string
+		wantErr bool
+	}{
+		{"", false},
+		{"v1.2.0", false},
+		{"release/1.2", false},
+		{"refs/tags/v1.2.0", false},
+		{"refs/heads/main", false},
+		{"9f3c1b2a", false},
+		{"refs/merge-requests/1/head", true},
+		{"v1 .2", true},
+		{"main..v1.2.0", true},
+		{strings.Repeat("x", 256), true},
+	}
+
+	for _, test := range tests {
+		err := ValidateRepositorySchemaRef(test.ref)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ValidateRepositorySchemaRef(%q) got error %v, want error %v.", test.ref, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidateRepositoryTargetBranchFilter(t *testing.T) {
+	tests := []struct {
+		filter  string
+		wantErr bool
+	}{
+		{"", false},
+		{"main", false},
+		{"release/*", false},
+		{"refs/tags/v*", true},
+		{"release/[", true},
+	}
+
+	for _, test := range tests {
+		err := ValidateRepositoryTargetBranchFilter(test.filter)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ValidateRepositoryTargetBranchFilter(%q) got error %v, want error %v.", test.filter, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidateRepositoryNotificationWebhookURLList(t *testing.T) {
+	tests := []struct {
+		urlList []string
+		wantErr bool
+	}{
+		{nil, false},
+		{[]string{"https://hooks.slack.com/services/T0/B0/X0"}, false},
+		{[]string{"http://ci.example.com/bytebase", "https://ci.example.com/bytebase?team=db"}, false},
+		{[]string{"ftp://ci.example.com/bytebase"}, true},
+		{[]string{"ci.example.com/bytebase"}, true},
+		{[]string{"https://"}, true},
+		{[]string{"https://ci.example.com/a,b"}, true},
+	}
+
+	for _, test := range tests {
+		err := ValidateRepositoryNotificationWebhookURLList(test.urlList)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ValidateRepositoryNotificationWebhookURLList(%q) got error %v, want error %v.", test.urlList, err, test.wantErr)
+		}
+	}
+}
@@ -2,9 +2,218 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/db"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"go.uber.org/zap/zapcore"
+)
+
+// RepositoryWebhookStatus is the status of the webhook of a repository.
+type RepositoryWebhookStatus string
+
+const (
+	// WebhookPending means the webhook creation failed when linking the repository and is being retried in the background.
+	WebhookPending RepositoryWebhookStatus = "WEBHOOK_PENDING"
+	// WebhookActive means the webhook is created.
+	WebhookActive RepositoryWebhookStatus = "WEBHOOK_ACTIVE"
+)
+
+func (e RepositoryWebhookStatus) String() string {
+	switch e {
+	case WebhookPending:
+		return "WEBHOOK_PENDING"
+	case WebhookActive:
+		return "WEBHOOK_ACTIVE"
+	}
+	return ""
+}
+
+// RepositoryTokenStatus is the status of the access token of a repository.
+type RepositoryTokenStatus string
+
+const (
+	// TokenValid means the access token is usable, or can be refreshed when it expires.
+	TokenValid RepositoryTokenStatus = "TOKEN_VALID"
+	// TokenInvalid means refreshing the access token failed unrecoverably, e.g. the refresh token is revoked,
+	// and the repository needs to be linked again.
+	TokenInvalid RepositoryTokenStatus = "TOKEN_INVALID"
+)
+
+func (e RepositoryTokenStatus) String() string {
+	switch e {
+	case TokenValid:
+		return "TOKEN_VALID"
+	case TokenInvalid:
+		return "TOKEN_INVALID"
+	}
+	return ""
+}
+
+// RepositoryProviderStatus is the status of the repository at the VCS provider.
+type RepositoryProviderStatus string
+
+const (
+	// ProviderFound means the repository is found at the VCS provider.
+	ProviderFound RepositoryProviderStatus = "PROVIDER_FOUND"
+	// ProviderMissing means the VCS provider definitively reports the repository not found, e.g. it's deleted
+	// or made private, while the project is still linked to it.
+	ProviderMissing RepositoryProviderStatus = "PROVIDER_MISSING"
+)
+
+func (e RepositoryProviderStatus) String() string {
+	switch e {
+	case ProviderFound:
+		return "PROVIDER_FOUND"
+	case ProviderMissing:
+		return "PROVIDER_MISSING"
+	}
+	return ""
+}
+
+// RepositorySyncStatus is the status of syncing the pushes to a repository.
+type RepositorySyncStatus string
+
+const (
+	// SyncActive means the pushes to the repository are synced.
+	SyncActive RepositorySyncStatus = "ACTIVE"
+	// SyncQuarantined means the repository is quarantined after RepositoryQuarantineThreshold consecutive sync failures,
+	// e.g. by the bad config, and its pushes are ignored until it's un-quarantined manually after fixing the config.
+	SyncQuarantined RepositorySyncStatus = "QUARANTINED"
+)
+
+func (e RepositorySyncStatus) String() string {
+	switch e {
+	case SyncActive:
+		return "ACTIVE"
+	case SyncQuarantined:
+		return "QUARANTINED"
+	}
+	return ""
+}
+
+// RepositoryQuarantineThreshold is the number of the consecutive sync failures quarantining the repository.
+const RepositoryQuarantineThreshold = 5
+
+// MaxMigrationStatementTimeout is the maximum migration statement timeout in seconds of a repository.
+const MaxMigrationStatementTimeout = 24 * 60 * 60
+
+// SchemaSourceType is the type of the schema source of a repository.
+type SchemaSourceType string
+
+const (
+	// SchemaSourceSingleFile means the schema path template resolves to a single schema file.
+	SchemaSourceSingleFile SchemaSourceType = "SINGLE_FILE"
+	// SchemaSourceDirectory means the schema path template resolves to a directory of schema files,
+	// e.g. one file for tables, one for views and one for functions.
+	// The files are concatenated to form the database baseline, in the order listed by the
+	// SchemaDirectoryIndexFile if present, otherwise in alphabetical order.
+	SchemaSourceDirectory SchemaSourceType = "DIRECTORY"
+
+	// SchemaDirectoryIndexFile is the file in the schema directory listing the schema files in the order of concatenation, one per line.
+	SchemaDirectoryIndexFile = "index.txt"
+)
+
+func (e SchemaSourceType) String() string {
+	switch e {
+	case SchemaSourceSingleFile:
+		return "SINGLE_FILE"
+	case SchemaSourceDirectory:
+		return "DIRECTORY"
+	}
+	return ""
+}
+
+const (
+	// DefaultRepositorySkipDirective is the default keyword in the head commit message skipping the push event,
+	// analogous to "[skip ci]".
+	DefaultRepositorySkipDirective = "[skip bytebase]"
+	// MaxRepositorySkipDirectiveLength is the maximum length of the skip directive.
+	MaxRepositorySkipDirectiveLength = 64
+	// MaxRepositorySchemaRefLength is the maximum length of the schema ref.
+	MaxRepositorySchemaRefLength = 255
 )
 
+// DuplicateVersionPolicy is the policy resolving the migration version pushed again with different content, e.g. the same
+// version committed on two branches.
+type DuplicateVersionPolicy string
+
+const (
+	// DuplicateVersionError rejects the migration file duplicating the version.
+	DuplicateVersionError DuplicateVersionPolicy = "ERROR"
+	// DuplicateVersionLatestWins applies the migration file of the most recent commit, and skips the older ones.
+	DuplicateVersionLatestWins DuplicateVersionPolicy = "LATEST_WINS"
+	// DuplicateVersionBranchScoped namespaces the versions per branch, so the same version on another branch is
+	// applied as the version qualified by the branch.
+	DuplicateVersionBranchScoped DuplicateVersionPolicy = "BRANCH_SCOPED"
+)
+
+func (e DuplicateVersionPolicy) String() string {
+	switch e {
+	case DuplicateVersionError:
+		return "ERROR"
+	case DuplicateVersionLatestWins:
+		return "LATEST_WINS"
+	case DuplicateVersionBranchScoped:
+		return "BRANCH_SCOPED"
+	}
+	return ""
+}
+
+// EmptyMigrationPolicy is the policy handling the pushed migration file which is empty or only has comments.
+type EmptyMigrationPolicy string
+
+const (
+	// EmptyMigrationError rejects the empty migration file with a warning.
+	EmptyMigrationError EmptyMigrationPolicy = "ERROR"
+	// EmptyMigrationSkip skips the empty migration file with a logged note.
+	EmptyMigrationSkip EmptyMigrationPolicy = "SKIP"
+	// EmptyMigrationAllow applies the empty migration file as a no-op, which records the version in the migration history.
+	EmptyMigrationAllow EmptyMigrationPolicy = "ALLOW"
+)
+
+func (e EmptyMigrationPolicy) String() string {
+	switch e {
+	case EmptyMigrationError:
+		return "ERROR"
+	case EmptyMigrationSkip:
+		return "SKIP"
+	case EmptyMigrationAllow:
+		return "ALLOW"
+	}
+	return ""
+}
+
+// DriftAction is the response to the schema drift detected on the databases of the project.
+type DriftAction string
+
+const (
+	// DriftActionAnomalyOnly only reports the schema drift as an anomaly.
+	DriftActionAnomalyOnly DriftAction = "ANOMALY_ONLY"
+	// DriftActionCreateIssue also creates an issue describing the drifted objects to track the remediation.
+	DriftActionCreateIssue DriftAction = "CREATE_ISSUE"
+)
+
+func (e DriftAction) String() string {
+	switch e {
+	case DriftActionAnomalyOnly:
+		return "ANOMALY_ONLY"
+	case DriftActionCreateIssue:
+		return "CREATE_ISSUE"
+	}
+	return ""
+}
+
 // Repository is the API message for a repository.
 type Repository struct {
 	ID int `jsonapi:"primary,repository"`
@@ -22,29 +231,156 @@ type Repository struct {
 	VCS       *VCS `jsonapi:"relation,vcs"`
 	ProjectID int
 	Project   *Project `jsonapi:"relation,project"`
+	// DeploymentConfigID is the deployment config governing the rollout of the migrations pushed to the repository
+	// of a tenant mode project. If nil, the deployment config of the project is used.
+	DeploymentConfigID *int `jsonapi:"attr,deploymentConfigId"`
+	// DefaultAssigneeID is the principal assigned the issues created by the pushes whose commit author isn't a member
+	// of the project. If nil, the project owners are assigned in turn.
+	DefaultAssigneeID *int `jsonapi:"attr,defaultAssigneeId"`
 
 	// Domain specific fields
-	Name          string `jsonapi:"attr,name"`
-	FullPath      string `jsonapi:"attr,fullPath"`
-	WebURL        string `jsonapi:"attr,webUrl"`
-	BranchFilter  string `jsonapi:"attr,branchFilter"`
-	BaseDirectory string `jsonapi:"attr,baseDirectory"`
+	Name         string `jsonapi:"attr,name"`
+	FullPath     string `jsonapi:"attr,fullPath"`
+	WebURL       string `jsonapi:"attr,webUrl"`
+	BranchFilter string `jsonapi:"attr,branchFilter"`
+	// TargetBranchFilter is the glob pattern of the target branches of the merge requests to act on, independent of the
+	// BranchFilter for the push events. Empty matches all branches.
+	TargetBranchFilter string `jsonapi:"attr,targetBranchFilter"`
+	BaseDirectory      string `jsonapi:"attr,baseDirectory"`
 	// The file path template for matching the committed migration script.
 	FilePathTemplate string `jsonapi:"attr,filePathTemplate"`
 	// The file path template for storing the latest schema auto-generated by Bytebase after migration.
 	// If empty, then Bytebase won't auto generate it.
 	SchemaPathTemplate string `jsonapi:"attr,schemaPathTemplate"`
-	ExternalID         string `jsonapi:"attr,externalId"`
-	ExternalWebhookID  string
-	WebhookURLHost     string
-	WebhookEndpointID  string
-	WebhookSecretToken string
+	// Whether the schema path template resolves to a single schema file or a directory of schema files.
+	SchemaSourceType SchemaSourceType `jsonapi:"attr,schemaSourceType"`
+	// How the migration version pushed again with different content is resolved.
+	DuplicateVersionPolicy DuplicateVersionPolicy `jsonapi:"attr,duplicateVersionPolicy"`
+	// How the pushed migration file which is empty or only has comments is handled.
+	EmptyMigrationPolicy EmptyMigrationPolicy `jsonapi:"attr,emptyMigrationPolicy"`
+	// The timeout in seconds of each statement of the pushed migrations. 0 means the instance default.
+	MigrationStatementTimeout int `jsonapi:"attr,migrationStatementTimeout"`
+	// How the schema drift detected on the databases of the project is responded.
+	DriftAction DriftAction `jsonapi:"attr,driftAction"`
+	// ProviderUserID and ProviderUsername are the VCS provider user the token linking the repository belongs to,
+	// attributing the automated actions on the repository, e.g. the commits and the comments, to the person.
+	ProviderUserID   string `jsonapi:"attr,providerUserId"`
+	ProviderUsername string `jsonapi:"attr,providerUsername"`
+	// RequireSignedCommits only processes the migration files from the commits whose signature is verified by the VCS provider.
+	RequireSignedCommits bool `jsonapi:"attr,requireSignedCommits"`
+	// SkipDirective is the keyword in the head commit message skipping the push event, e.g. "[skip bytebase]".
+	// Empty means the push events are never skipped.
+	SkipDirective string `jsonapi:"attr,skipDirective"`
+	// SchemaRef is the branch, tag or commit SHA the schema baseline is read from, e.g. the release tag "v1.2.0".
+	// Empty means the schema is read at the pushed commit.
+	SchemaRef string `jsonapi:"attr,schemaRef"`
+	// SchemaSnapshotOnApply commits the schema dump back to the schema path after a migration issued from the UI applies,
+	// so the repository stays the source of truth of the schema.
+	SchemaSnapshotOnApply bool `jsonapi:"attr,schemaSnapshotOnApply"`
+	// The glob patterns for the committed files to ignore even if they match the file path template.
+	IgnorePathPatterns []string `jsonapi:"attr,ignorePathPatterns"`
+	// The URLs notified of the outcome of the migrations synced from the repository.
+	NotificationWebhookURLList []string `jsonapi:"attr,notificationWebhookUrlList"`
+	// The author of the commits Bytebase writes back to the repository.
+	// If empty, the VCS provider uses the user linking the project to the repository.
+	CommitAuthorName  string `jsonapi:"attr,commitAuthorName"`
+	CommitAuthorEmail string `jsonapi:"attr,commitAuthorEmail"`
+	// The context of the commit status Bytebase reports to the VCS provider, e.g. "bytebase/schema".
+	CommitStatusContext string `jsonapi:"attr,commitStatusContext"`
+	// Labels are the key-value labels for organizing the repositories, e.g. "team": "payments".
+	Labels map[string]string `jsonapi:"attr,labels"`
+	// BranchEnvironmentMapping resolves the environment of the databases the migration applies to from the pushed branch.
+	BranchEnvironmentMapping BranchEnvironmentMapping `jsonapi:"attr,branchEnvironmentMapping"`
+	ExternalID               string                   `jsonapi:"attr,externalId"`
+	ExternalWebhookID        string
+	WebhookURLHost           string
+	WebhookEndpointID        string
+	WebhookSecretToken       string
+	WebhookStatus            RepositoryWebhookStatus  `jsonapi:"attr,webhookStatus"`
+	TokenStatus              RepositoryTokenStatus    `jsonapi:"attr,tokenStatus"`
+	ProviderStatus           RepositoryProviderStatus `jsonapi:"attr,providerStatus"`
+	SyncStatus               RepositorySyncStatus     `jsonapi:"attr,syncStatus"`
+	// SyncFailureCount is the number of the consecutive sync failures, reset by a successful sync.
+	SyncFailureCount int `jsonapi:"attr,syncFailureCount"`
 	// These will be exclusively used on the server side and we don't return it to the client.
-	AccessToken  string
-	ExpiresTs    int64
+	AccessToken string
+	// ExpiresTs is nil if the access token never expires.
+	ExpiresTs    *int64
 	RefreshToken string
 }
 
+// TokenNeverExpires returns true if the access token never expires.
+func (r *Repository) TokenNeverExpires() bool {
+	return r.ExpiresTs == nil
+}
+
+// TokenExpired returns true if the access token has expired at now, which is the Unix timestamp in seconds.
+// A never-expiring access token is never expired.
+func (r *Repository) TokenExpired(now int64) bool {
+	return r.ExpiresTs != nil && *r.ExpiresTs <= now
+}
+
+// redactedSecret replaces the secret in the logs. An empty secret stays empty, so a missing token is still visible.
+const redactedSecret = "***"
+
+func redactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redactedSecret
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler, so logging the repository with zap.Object or zap.Any never emits the tokens.
+func (r *Repository) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt("id", r.ID)
+	enc.AddInt("vcsId", r.VCSID)
+	enc.AddInt("projectId", r.ProjectID)
+	if r.DeploymentConfigID != nil {
+		enc.AddInt("deploymentConfigId", *r.DeploymentConfigID)
+	}
+	if r.DefaultAssigneeID != nil {
+		enc.AddInt("defaultAssigneeId", *r.DefaultAssigneeID)
+	}
+	enc.AddString("name", r.Name)
+	enc.AddString("fullPath", r.FullPath)
+	enc.AddString("webUrl", r.WebURL)
+	enc.AddString("branchFilter", r.BranchFilter)
+	enc.AddString("targetBranchFilter", r.TargetBranchFilter)
+	enc.AddString("baseDirectory", r.BaseDirectory)
+	enc.AddString("filePathTemplate", r.FilePathTemplate)
+	enc.AddString("schemaPathTemplate", r.SchemaPathTemplate)
+	enc.AddString("skipDirective", r.SkipDirective)
+	enc.AddString("schemaRef", r.SchemaRef)
+	enc.AddBool("schemaSnapshotOnApply", r.SchemaSnapshotOnApply)
+	enc.AddString("externalId", r.ExternalID)
+	enc.AddString("externalWebhookId", r.ExternalWebhookID)
+	enc.AddString("webhookEndpointId", r.WebhookEndpointID)
+	enc.AddString("webhookStatus", string(r.WebhookStatus))
+	enc.AddString("tokenStatus", string(r.TokenStatus))
+	enc.AddString("providerStatus", string(r.ProviderStatus))
+	enc.AddString("syncStatus", string(r.SyncStatus))
+	enc.AddString("webhookSecretToken", redactSecret(r.WebhookSecretToken))
+	enc.AddString("accessToken", redactSecret(r.AccessToken))
+	enc.AddString("refreshToken", redactSecret(r.RefreshToken))
+	if r.ExpiresTs != nil {
+		enc.AddInt64("expiresTs", *r.ExpiresTs)
+	}
+	return nil
+}
+
+// String returns the same redacted fields as MarshalLogObject, so formatting the repository with %v or %s never emits the tokens.
+func (r *Repository) String() string {
+	enc := zapcore.NewMapObjectEncoder()
+	if err := r.MarshalLogObject(enc); err != nil {
+		return err.Error()
+	}
+	str, err := json.Marshal(enc.Fields)
+	if err != nil {
+		return err.Error()
+	}
+	return string(str)
+}
+
 // RepositoryCreate is the API message for creating a repository.
 type RepositoryCreate struct {
 	// Standard fields
@@ -54,31 +390,79 @@ type RepositoryCreate struct {
 	// Related fields
 	VCSID     int `jsonapi:"attr,vcsId"`
 	ProjectID int
+	// If nil, the deployment config of the project is used.
+	DeploymentConfigID *int `jsonapi:"attr,deploymentConfigId"`
+	// If nil, the project owners are assigned in turn when the commit author isn't a member of the project.
+	DefaultAssigneeID *int `jsonapi:"attr,defaultAssigneeId"`
 
 	// Domain specific fields
-	Name               string `jsonapi:"attr,name"`
-	FullPath           string `jsonapi:"attr,fullPath"`
-	WebURL             string `jsonapi:"attr,webUrl"`
-	BranchFilter       string `jsonapi:"attr,branchFilter"`
-	BaseDirectory      string `jsonapi:"attr,baseDirectory"`
-	FilePathTemplate   string `jsonapi:"attr,filePathTemplate"`
-	SchemaPathTemplate string `jsonapi:"attr,schemaPathTemplate"`
-	ExternalID         string `jsonapi:"attr,externalId"`
+	Name                       string   `jsonapi:"attr,name"`
+	FullPath                   string   `jsonapi:"attr,fullPath"`
+	WebURL                     string   `jsonapi:"attr,webUrl"`
+	BranchFilter               string   `jsonapi:"attr,branchFilter"`
+	TargetBranchFilter         string   `jsonapi:"attr,targetBranchFilter"`
+	BaseDirectory              string   `jsonapi:"attr,baseDirectory"`
+	FilePathTemplate           string   `jsonapi:"attr,filePathTemplate"`
+	SchemaPathTemplate         string   `jsonapi:"attr,schemaPathTemplate"`
+	IgnorePathPatterns         []string `jsonapi:"attr,ignorePathPatterns"`
+	NotificationWebhookURLList []string `jsonapi:"attr,notificationWebhookUrlList"`
+	CommitAuthorName           string   `jsonapi:"attr,commitAuthorName"`
+	CommitAuthorEmail          string   `jsonapi:"attr,commitAuthorEmail"`
+	// If empty, SchemaSourceSingleFile is used.
+	SchemaSourceType SchemaSourceType `jsonapi:"attr,schemaSourceType"`
+	// If empty, DuplicateVersionError is used.
+	DuplicateVersionPolicy DuplicateVersionPolicy `jsonapi:"attr,duplicateVersionPolicy"`
+	// If empty, EmptyMigrationSkip is used.
+	EmptyMigrationPolicy EmptyMigrationPolicy `jsonapi:"attr,emptyMigrationPolicy"`
+	// 0 means the instance default.
+	MigrationStatementTimeout int `jsonapi:"attr,migrationStatementTimeout"`
+	// If empty, DriftActionAnomalyOnly is used.
+	DriftAction          DriftAction `jsonapi:"attr,driftAction"`
+	RequireSignedCommits bool        `jsonapi:"attr,requireSignedCommits"`
+	// If empty, DefaultRepositorySkipDirective is used.
+	SkipDirective string `jsonapi:"attr,skipDirective"`
+	// If empty, the schema is read at the pushed commit.
+	SchemaRef             string `jsonapi:"attr,schemaRef"`
+	SchemaSnapshotOnApply bool   `jsonapi:"attr,schemaSnapshotOnApply"`
+	// If empty, vcs.DefaultCommitStatusContext is used.
+	CommitStatusContext string `jsonapi:"attr,commitStatusContext"`
+	ExternalID          string `jsonapi:"attr,externalId"`
+	// AllowPendingWebhook creates the repository with the WebhookPending status if the webhook creation fails,
+	// and the webhook creation is retried in the background, instead of failing the whole creation.
+	AllowPendingWebhook bool `jsonapi:"attr,allowPendingWebhook"`
+	// PreserveMigrationHistory re-associates the re-linked repository with the migration history of the project's databases,
+	// so the migration files whose version is already applied are treated as done while the others are caught up.
+	PreserveMigrationHistory bool `jsonapi:"attr,preserveMigrationHistory"`
+	// WebhookHostKey is the logical host key resolving the host of the webhook callback URL, e.g. the region routing the webhook.
+	// Empty means the host of the server.
+	WebhookHostKey string `jsonapi:"attr,webhookHostKey"`
+	// OAuthTicket is the ticket issued by the verified OAuth token exchange of the VCS, redeemed for the token below.
+	OAuthTicket string `jsonapi:"attr,oauthTicket"`
 	// Token belonged by the user linking the project to the VCS repository. We store this token together
 	// with the refresh token in the new repository record so we can use it to call VCS API on
 	// behalf of that user to perform tasks like webhook CRUD later.
-	AccessToken        string `jsonapi:"attr,accessToken"`
-	ExpiresTs          int64  `jsonapi:"attr,expiresTs"`
-	RefreshToken       string `jsonapi:"attr,refreshToken"`
-	ExternalWebhookID  string
+	// The token is redeemed by OAuthTicket rather than submitted by the client.
+	AccessToken string
+	// 0 means the access token never expires.
+	ExpiresTs         int64
+	RefreshToken      string
+	ExternalWebhookID string
+	// ProviderUserID and ProviderUsername are verified from the access token at link time.
+	ProviderUserID   string
+	ProviderUsername string
+	// WebhookURLHost is either the literal host of the server or the logical WebhookHostKey.
 	WebhookURLHost     string
 	WebhookEndpointID  string
 	WebhookSecretToken string
+	// Empty means WebhookActive.
+	WebhookStatus RepositoryWebhookStatus
 }
 
 // RepositoryFind is the API message for finding repositories.
 type RepositoryFind struct {
 	ID *int
+	// IDList finds the repositories in a batch. It can't be used together with ID.
+	IDList []int
 
 	// Related fields
 	VCSID     *int
@@ -86,6 +470,28 @@ type RepositoryFind struct {
 
 	// Domain specific fields
 	WebhookEndpointID *string
+	// VCSType filters by the type of the VCS the repository belongs to.
+	VCSType *vcs.Type
+	// LabelSelector finds the repositories containing all the labels.
+	LabelSelector map[string]string
+	// WithoutWebhook finds the repositories whose external webhook ID is empty. Such repositories will never receive the push events.
+	WithoutWebhook bool
+	// WithoutVCS finds the repositories whose VCS no longer exists, e.g. the VCS row was removed bypassing the deletion guard.
+	WithoutVCS bool
+	// ExpiresBefore finds the repositories whose access token expires before the Unix timestamp in seconds.
+	// The never-expiring access tokens are excluded.
+	ExpiresBefore *int64
+	TokenStatus   *RepositoryTokenStatus
+	// SearchTerm finds the repositories whose name, full path or web URL contains the term, case-insensitively.
+	// The term is matched literally, e.g. "%" and "_" aren't wildcards.
+	SearchTerm *string
+	// WebURL finds the repository of the web URL, or any URL of the same repository such as the git remote URL.
+	// Both the URL and the web URL of the repositories are compared after normalized by NormalizeRepositoryWebURL.
+	WebURL *string
+
+	// IncludeSecrets selects the webhook secret token, the access token and the refresh token as well.
+	// They are left empty otherwise, so the paths not talking to the VCS don't handle the secrets unnecessarily.
+	IncludeSecrets bool
 }
 
 func (find *RepositoryFind) String() string {
@@ -104,14 +510,85 @@ type RepositoryPatch struct {
 	// Value is assigned from the jwt subject field passed by the client.
 	UpdaterID int
 
+	// Related fields
+	// 0 means the deployment config of the project is used.
+	DeploymentConfigID *int `jsonapi:"attr,deploymentConfigId"`
+	// 0 means no default assignee.
+	DefaultAssigneeID *int `jsonapi:"attr,defaultAssigneeId"`
+
+	// Domain specific fields
+	BranchFilter       *string           `jsonapi:"attr,branchFilter"`
+	TargetBranchFilter *string           `jsonapi:"attr,targetBranchFilter"`
+	BaseDirectory      *string           `jsonapi:"attr,baseDirectory"`
+	FilePathTemplate   *string           `jsonapi:"attr,filePathTemplate"`
+	SchemaPathTemplate *string           `jsonapi:"attr,schemaPathTemplate"`
+	SchemaSourceType   *SchemaSourceType `jsonapi:"attr,schemaSourceType"`
+	// DuplicateVersionPolicy is how the migration version pushed again with different content is resolved.
+	DuplicateVersionPolicy *DuplicateVersionPolicy `jsonapi:"attr,duplicateVersionPolicy"`
+	// EmptyMigrationPolicy is how the pushed migration file which is empty or only has comments is handled.
+	EmptyMigrationPolicy *EmptyMigrationPolicy `jsonapi:"attr,emptyMigrationPolicy"`
+	// MigrationStatementTimeout is the timeout in seconds of each statement of the pushed migrations. 0 means the instance default.
+	MigrationStatementTimeout *int `jsonapi:"attr,migrationStatementTimeout"`
+	// DriftAction is how the schema drift detected on the databases of the project is responded.
+	DriftAction          *DriftAction `jsonapi:"attr,driftAction"`
+	RequireSignedCommits *bool        `jsonapi:"attr,requireSignedCommits"`
+	// Empty means the push events are never skipped.
+	SkipDirective *string `jsonapi:"attr,skipDirective"`
+	// Empty means the schema is read at the pushed commit.
+	SchemaRef             *string `jsonapi:"attr,schemaRef"`
+	SchemaSnapshotOnApply *bool   `jsonapi:"attr,schemaSnapshotOnApply"`
+	// IgnorePathPatterns is parsed from the payload by ParseRepositoryPatchIgnorePathPatterns,
+	// because jsonapi doesn't unmarshal an attribute to a pointer to slice.
+	IgnorePathPatterns *[]string
+	// Comma separated URLs.
+	NotificationWebhookURLList *string `jsonapi:"attr,notificationWebhookUrlList"`
+	CommitAuthorName           *string `jsonapi:"attr,commitAuthorName"`
+	CommitAuthorEmail          *string `jsonapi:"attr,commitAuthorEmail"`
+	CommitStatusContext        *string `jsonapi:"attr,commitStatusContext"`
+	// WebhookSecretToken is only patched when rotating the webhook secret token.
+	WebhookSecretToken *string
+	// ExternalWebhookID and WebhookStatus are patched when the pending webhook is created.
+	ExternalWebhookID *string
+	WebhookStatus     *RepositoryWebhookStatus
+	// TokenStatus is patched when refreshing the access token fails unrecoverably.
+	TokenStatus *RepositoryTokenStatus
+	// ProviderStatus is patched when verifying the repository still exists at the VCS provider.
+	ProviderStatus *RepositoryProviderStatus
+	// SyncStatus is patched to ACTIVE to un-quarantine the repository, which resets the consecutive sync failures.
+	SyncStatus *RepositorySyncStatus `jsonapi:"attr,syncStatus"`
+	// Labels is a json-encoded string from a map of the repository labels.
+	Labels *string `jsonapi:"attr,labels"`
+	// BranchEnvironmentMapping is a json-encoded string from the BranchEnvironmentMapping.
+	BranchEnvironmentMapping *string `jsonapi:"attr,branchEnvironmentMapping"`
+	AccessToken              *string
+	// 0 means the access token never expires.
+	ExpiresTs    *int64
+	RefreshToken *string
+}
+
+// RepositoryTokenSwap is the API message for storing the refreshed access token of a repository.
+// It's only stored if the refresh token of the repository is still OldRefreshToken, i.e. it hasn't been refreshed concurrently.
+type RepositoryTokenSwap struct {
+	ID int
+
+	// Standard fields
+	UpdaterID int
+
 	// Domain specific fields
-	BranchFilter       *string `jsonapi:"attr,branchFilter"`
-	BaseDirectory      *string `jsonapi:"attr,baseDirectory"`
-	FilePathTemplate   *string `jsonapi:"attr,filePathTemplate"`
-	SchemaPathTemplate *string `jsonapi:"attr,schemaPathTemplate"`
-	AccessToken        *string
-	ExpiresTs          *int64
-	RefreshToken       *string
+	OldRefreshToken string
+	AccessToken     string
+	// 0 means the access token never expires.
+	ExpiresTs    int64
+	RefreshToken string
+}
+
+// WebhookEndpointRef is the minimal projection of a repository for routing its webhook events.
+type WebhookEndpointRef struct {
+	RepositoryID      int
+	WebhookEndpointID string
+	VCSType           vcs.Type
+	// SyncEnabled is false if the repository is quarantined, so its pushes aren't synced.
+	SyncEnabled bool
 }
 
 // RepositoryDelete is the API message for deleting a repository.
@@ -124,13 +601,701 @@ type RepositoryDelete struct {
 	// Standard fields
 	// Value is assigned from the jwt subject field passed by the client.
 	DeleterID int
+
+	// Domain specific fields
+	// CleanupTs is the time the deferred cleanup finalizes. Until then the repository is kept archived with its settings,
+	// and the project is in the VCSPendingCleanupWorkflow. 0 deletes the repository and flips the project to the UI workflow immediately.
+	CleanupTs int64
+}
+
+// BranchEnvironmentMapping maps the VCS branch to the name of the environment, e.g. "develop": "Staging", "main": "Prod",
+// so a push to the branch only applies the migration to the databases in the mapped environment.
+// Empty mapping means the environment isn't resolved from the branch.
+type BranchEnvironmentMapping map[string]string
+
+// ResolveEnvironment returns the name of the environment mapped from the branch.
+// Returns false if the mapping is not empty and the branch is not mapped, in which case the push should be ignored.
+// Returns an empty environment and true if the mapping is empty.
+func (m BranchEnvironmentMapping) ResolveEnvironment(branch string) (string, bool) {
+	if len(m) == 0 {
+		return "", true
+	}
+	environment, ok := m[branch]
+	return environment, ok
+}
+
+// PushSimulation is the API message for simulating a push of the changed files to the branch of the repository.
+type PushSimulation struct {
+	Branch string `jsonapi:"attr,branch"`
+	// ChangedFileList is the paths of the files changed by the push.
+	ChangedFileList []string `jsonapi:"attr,changedFileList"`
+}
+
+// PushSimulationResult is the API message for the result of simulating a push to the repository.
+type PushSimulationResult struct {
+	// BranchMatched is false if the branch doesn't match the branch filter, in which case none of the files is processed.
+	BranchMatched bool             `jsonapi:"attr,branchMatched"`
+	FileList      []*SimulatedFile `jsonapi:"attr,fileList"`
+}
+
+// SimulatedFile is the API message for how a changed file would be processed in the push simulation.
+type SimulatedFile struct {
+	FilePath string `jsonapi:"attr,filePath"`
+	// SkipReason tells why the file won't become a migration. It's empty if the file becomes a migration.
+	SkipReason    string           `jsonapi:"attr,skipReason"`
+	MigrationType db.MigrationType `jsonapi:"attr,migrationType"`
+	Version       string           `jsonapi:"attr,version"`
+	// DatabaseList is the names of the databases the migration applies to, in the form of "{{ENV_NAME}}/{{DB_NAME}}".
+	// For the tenant mode project, the databases are determined by the deployment config at the time of the deployment,
+	// so it only contains the database name.
+	DatabaseList []string `jsonapi:"attr,databaseList"`
+}
+
+// PushPreview is the API message for previewing the databases the migration file pushed to the ref would be applied to.
+type PushPreview struct {
+	// Ref is the pushed ref, e.g. "refs/heads/main".
+	Ref      string `jsonapi:"attr,ref"`
+	FilePath string `jsonapi:"attr,filePath"`
+}
+
+// AffectedDatabasesPreview is the API message for the databases the pushed migration file would be applied to, in the rollout order.
+type AffectedDatabasesPreview struct {
+	FilePath      string           `jsonapi:"attr,filePath"`
+	MigrationType db.MigrationType `jsonapi:"attr,migrationType"`
+	Version       string           `jsonapi:"attr,version"`
+	StageList     []*AffectedStage `jsonapi:"attr,stageList"`
+}
+
+// AffectedStage is the API message for a stage of the rollout previewed, e.g. a deployment of the tenant mode project.
+type AffectedStage struct {
+	Name            string `jsonapi:"attr,name"`
+	EnvironmentName string `jsonapi:"attr,environmentName"`
+	// DatabaseList is the names of the databases in the stage, in the form of "{{ENV_NAME}}/{{DB_NAME}}".
+	DatabaseList []string `jsonapi:"attr,databaseList"`
+}
+
+// PushReplay is the API message for replaying a commit pushed to the repository.
+type PushReplay struct {
+	CommitID string `jsonapi:"attr,commitId"`
+	// Branch is the branch or the tag ref, e.g. "refs/tags/v1.0.0", the commit is pushed to.
+	// It can be omitted if the branch filter of the repository is a single branch.
+	Branch string `jsonapi:"attr,branch"`
+}
+
+// PushReplayResult is the API message for the result of replaying a commit pushed to the repository.
+type PushReplayResult struct {
+	CommitID string          `jsonapi:"attr,commitId"`
+	FileList []*ReplayedFile `jsonapi:"attr,fileList"`
+}
+
+// ReplayedFile is the API message for how a file added by the replayed commit is processed.
+type ReplayedFile struct {
+	FilePath string `jsonapi:"attr,filePath"`
+	// SkipReason tells why no issue is created for the file, e.g. the migration version is already applied.
+	SkipReason string `jsonapi:"attr,skipReason"`
+	IssueID    int    `jsonapi:"attr,issueId"`
+	IssueName  string `jsonapi:"attr,issueName"`
+}
+
+// WorkflowReconcileReport is the API message for the result of reconciling the project workflow types with the linked repositories.
+type WorkflowReconcileReport struct {
+	ChangeList []*WorkflowReconcileChange `jsonapi:"attr,changeList"`
+}
+
+// WorkflowReconcileChange is the API message for a project workflow type corrected by the reconciliation.
+type WorkflowReconcileChange struct {
+	ProjectID       int                 `jsonapi:"attr,projectId"`
+	RepositoryCount int                 `jsonapi:"attr,repositoryCount"`
+	From            ProjectWorkflowType `jsonapi:"attr,from"`
+	To              ProjectWorkflowType `jsonapi:"attr,to"`
+}
+
+// RepositoryCheckType is the type of a check in the preflight validation of a repository.
+type RepositoryCheckType string
+
+const (
+	// RepositoryCheckConnectivity checks the repository is reachable at the VCS with the access token.
+	RepositoryCheckConnectivity RepositoryCheckType = "CONNECTIVITY"
+	// RepositoryCheckPathExpansion checks the file path template expands to a migration path parsed back to the database.
+	RepositoryCheckPathExpansion RepositoryCheckType = "PATH_EXPANSION"
+	// RepositoryCheckDatabaseMapping checks the migration path of the database maps to the database only.
+	RepositoryCheckDatabaseMapping RepositoryCheckType = "DATABASE_MAPPING"
+	// RepositoryCheckSchemaPath checks the schema path of the database exists in the repository.
+	RepositoryCheckSchemaPath RepositoryCheckType = "SCHEMA_PATH"
+)
+
+// RepositoryCheckStatus is the status of a check in the preflight validation of a repository.
+type RepositoryCheckStatus string
+
+const (
+	// RepositoryCheckPass is the status of the passed check.
+	RepositoryCheckPass RepositoryCheckStatus = "PASS"
+	// RepositoryCheckFail is the status of the failed check.
+	RepositoryCheckFail RepositoryCheckStatus = "FAIL"
+	// RepositoryCheckSkip is the status of the check which can't be run, e.g. the schema path can't be checked
+	// if the repository isn't reachable.
+	RepositoryCheckSkip RepositoryCheckStatus = "SKIP"
+)
+
+// FullValidationReport is the API message for the preflight validation of the repository config against the databases
+// before enabling the sync. All the checks are run regardless of the failed ones.
+type FullValidationReport struct {
+	RepositoryID int `jsonapi:"attr,repositoryId"`
+	// Passed is true if none of the checks fails.
+	Passed    bool               `jsonapi:"attr,passed"`
+	CheckList []*RepositoryCheck `jsonapi:"attr,checkList"`
+}
+
+// RepositoryCheck is the API message for a check in the preflight validation of a repository.
+type RepositoryCheck struct {
+	Type RepositoryCheckType `jsonapi:"attr,type"`
+	// Database is the database checked in the form of "{{ENV_NAME}}/{{DB_NAME}}", empty for the repository level check.
+	Database string                `jsonapi:"attr,database"`
+	Status   RepositoryCheckStatus `jsonapi:"attr,status"`
+	// Message explains the failed or skipped check, e.g. the missing schema path.
+	Message string `jsonapi:"attr,message"`
+}
+
+// BulkTemplateUpdate is the API message for updating the templates of the repositories in a VCS.
+type BulkTemplateUpdate struct {
+	// FilePathTemplate and SchemaPathTemplate are the new templates, empty to keep the current ones.
+	FilePathTemplate   string `jsonapi:"attr,filePathTemplate"`
+	SchemaPathTemplate string `jsonapi:"attr,schemaPathTemplate"`
+	// RepositoryIDList is the IDs of the repositories confirmed from the preview to update, ignored by the preview.
+	// The IDs are strings since jsonapi doesn't unmarshal an int list.
+	RepositoryIDList []string `jsonapi:"attr,repositoryIdList"`
+}
+
+// BulkUpdatePreview is the API message for previewing the template update of all repositories in a VCS, so the repositories
+// broken by the new templates are found before the update is applied.
+type BulkUpdatePreview struct {
+	VCSID int `jsonapi:"attr,vcsId"`
+	// FilePathTemplate and SchemaPathTemplate are the new templates, empty to keep the current ones.
+	FilePathTemplate   string                       `jsonapi:"attr,filePathTemplate"`
+	SchemaPathTemplate string                       `jsonapi:"attr,schemaPathTemplate"`
+	RepositoryList     []*RepositoryTemplatePreview `jsonapi:"attr,repositoryList"`
+}
+
+// RepositoryTemplatePreview is the API message for the template update of a repository in the bulk update preview.
+type RepositoryTemplatePreview struct {
+	RepositoryID               int    `jsonapi:"attr,repositoryId"`
+	FullPath                   string `jsonapi:"attr,fullPath"`
+	CurrentFilePathTemplate    string `jsonapi:"attr,currentFilePathTemplate"`
+	ProposedFilePathTemplate   string `jsonapi:"attr,proposedFilePathTemplate"`
+	CurrentSchemaPathTemplate  string `jsonapi:"attr,currentSchemaPathTemplate"`
+	ProposedSchemaPathTemplate string `jsonapi:"attr,proposedSchemaPathTemplate"`
+	// UnmatchedFileList is the existing migration files matching the current file path template but not the proposed one.
+	UnmatchedFileList []string `jsonapi:"attr,unmatchedFileList"`
+	// WouldBreak is true if the proposed templates are invalid for the project, any existing migration file wouldn't match,
+	// or the existing migration files can't be listed.
+	WouldBreak bool `jsonapi:"attr,wouldBreak"`
+	// Message explains why the repository would break.
+	Message string `jsonapi:"attr,message"`
+}
+
+// WebhookSecretReport is the API message for the coherence of the webhook secret token of a repository with its webhook
+// at the VCS. The secret token is orphaned if the recorded webhook isn't among the live webhooks calling back the repository,
+// e.g. the external webhook ID is stale after importing the repository config, so the push events can't be verified.
+type WebhookSecretReport struct {
+	RepositoryID int  `jsonapi:"attr,repositoryId"`
+	Orphaned     bool `jsonapi:"attr,orphaned"`
+	// ExternalWebhookID is the webhook recorded for the repository, which is the recreated one once remediated.
+	ExternalWebhookID string `jsonapi:"attr,externalWebhookId"`
+	// LiveWebhookIDList is the webhooks at the VCS calling back the repository when checked.
+	LiveWebhookIDList []string `jsonapi:"attr,liveWebhookIdList"`
+	// Remediated is true if the orphaned secret token is rotated and the webhook is recreated with it.
+	Remediated bool `jsonapi:"attr,remediated"`
+}
+
+// RepositoryDescription is the API message for the human-readable summary of the effective configuration of a repository,
+// with the defaults resolved, for onboarding and audits.
+type RepositoryDescription struct {
+	RepositoryID int               `jsonapi:"attr,repositoryId"`
+	FullPath     string            `jsonapi:"attr,fullPath"`
+	TenantMode   ProjectTenantMode `jsonapi:"attr,tenantMode"`
+	BranchFilter string            `jsonapi:"attr,branchFilter"`
+	// TargetBranchFilter is "*" if the repository acts on the merge requests targeting any branch.
+	TargetBranchFilter  string           `jsonapi:"attr,targetBranchFilter"`
+	BaseDirectory       string           `jsonapi:"attr,baseDirectory"`
+	FilePathTemplate    string           `jsonapi:"attr,filePathTemplate"`
+	SchemaPathTemplate  string           `jsonapi:"attr,schemaPathTemplate"`
+	SchemaSourceType    SchemaSourceType `jsonapi:"attr,schemaSourceType"`
+	IgnorePathPatterns  []string         `jsonapi:"attr,ignorePathPatterns"`
+	CommitAuthor        string           `jsonapi:"attr,commitAuthor"`
+	CommitStatusContext string           `jsonapi:"attr,commitStatusContext"`
+	// BranchEnvironmentMapping is empty if the migrations apply to the databases in all environments.
+	BranchEnvironmentMapping BranchEnvironmentMapping `jsonapi:"attr,branchEnvironmentMapping"`
+	ExampleList              []*RepositoryPathExample `jsonapi:"attr,exampleList"`
+}
+
+// RepositoryPathExample is the API message for the example paths of the migration file and the schema of a sample database.
+type RepositoryPathExample struct {
+	EnvironmentName string `jsonapi:"attr,environmentName"`
+	DatabaseName    string `jsonapi:"attr,databaseName"`
+	MigrationPath   string `jsonapi:"attr,migrationPath"`
+	// SchemaPath is empty if Bytebase doesn't write the latest schema back to the repository.
+	SchemaPath string `jsonapi:"attr,schemaPath"`
+	// Ignored is true if the migration path matches the ignore path patterns.
+	Ignored bool `jsonapi:"attr,ignored"`
+}
+
+// ConfigDivergenceReport is the API message for auditing the repositories against the shared conventions, i.e. the fields
+// of the effective configs, with the defaults resolved, where the repositories diverge from the most common value.
+// The secrets aren't compared.
+type ConfigDivergenceReport struct {
+	RepositoryCount int `jsonapi:"attr,repositoryCount"`
+	// FieldList is in the order of the fields of the repository, and only has the fields with more than one value.
+	FieldList []*ConfigFieldDivergence `jsonapi:"attr,fieldList"`
+}
+
+// ConfigFieldDivergence is the API message for a config field having more than one value among the repositories.
+type ConfigFieldDivergence struct {
+	Field string `jsonapi:"attr,field"`
+	// CommonValue is the most common value, which the other values diverge from.
+	CommonValue string `jsonapi:"attr,commonValue"`
+	// GroupList groups the repositories by their value of the field, the most common value first.
+	GroupList []*ConfigValueGroup `jsonapi:"attr,groupList"`
+}
+
+// ConfigValueGroup is the API message for the repositories sharing the value of a config field.
+type ConfigValueGroup struct {
+	Value            string `jsonapi:"attr,value"`
+	RepositoryIDList []int  `jsonapi:"attr,repositoryIdList"`
+}
+
+// RepositorySyncResult is the result of syncing a push to the repository.
+type RepositorySyncResult string
+
+const (
+	// RepositorySyncSuccess means the pushed files are processed, whether or not any issue is created.
+	RepositorySyncSuccess RepositorySyncResult = "SUCCESS"
+	// RepositorySyncFailed means processing the pushed files failed.
+	RepositorySyncFailed RepositorySyncResult = "FAILED"
+)
+
+func (e RepositorySyncResult) String() string {
+	switch e {
+	case RepositorySyncSuccess:
+		return "SUCCESS"
+	case RepositorySyncFailed:
+		return "FAILED"
+	}
+	return ""
+}
+
+// RepositorySyncHistoryRetention is the number of the most recent sync history entries kept for each repository.
+const RepositorySyncHistoryRetention = 100
+
+// SyncHistoryEntry is the API message for an entry of the sync history of a repository.
+type SyncHistoryEntry struct {
+	ID int `jsonapi:"primary,syncHistoryEntry"`
+
+	// Related fields
+	RepositoryID int `jsonapi:"attr,repositoryId"`
+
+	// Domain specific fields
+	Ref      string               `jsonapi:"attr,ref"`
+	CommitID string               `jsonapi:"attr,commitId"`
+	Result   RepositorySyncResult `jsonapi:"attr,result"`
+	// Detail is the issues created for a successful sync, or the error for a failed sync.
+	Detail     string `jsonapi:"attr,detail"`
+	StartedTs  int64  `jsonapi:"attr,startedTs"`
+	DurationMs int64  `jsonapi:"attr,durationMs"`
+}
+
+// SyncHistoryEntryCreate is the API message for appending an entry to the sync history of a repository.
+type SyncHistoryEntryCreate struct {
+	RepositoryID int
+	Ref          string
+	CommitID     string
+	Result       RepositorySyncResult
+	Detail       string
+	StartedTs    int64
+	DurationMs   int64
 }
 
 // RepositoryService is the service for repositories.
 type RepositoryService interface {
 	CreateRepository(ctx context.Context, create *RepositoryCreate) (*Repository, error)
+	// UpsertRepository creates the repository, or updates the repository linked to the same VCS and external ID.
+	// Returns true if the repository is created.
+	UpsertRepository(ctx context.Context, create *RepositoryCreate) (*Repository, bool, error)
 	FindRepositoryList(ctx context.Context, find *RepositoryFind) ([]*Repository, error)
+	// FindRepositoryIDs returns the IDs of the repositories matching find, which is much cheaper than FindRepositoryList
+	// for the jobs scanning all the repositories.
+	FindRepositoryIDs(ctx context.Context, find *RepositoryFind) ([]int, error)
 	FindRepository(ctx context.Context, find *RepositoryFind) (*Repository, error)
+	// GetRepositoryByWebhookEndpoint retrieves the repository, including the secrets, by the webhook endpoint ID.
+	// Returns nil if not found.
+	GetRepositoryByWebhookEndpoint(ctx context.Context, webhookEndpointID string) (*Repository, error)
+	// ListWebhookEndpoints returns the webhook endpoints of all the repositories not archived.
+	ListWebhookEndpoints(ctx context.Context) ([]*WebhookEndpointRef, error)
+	// FindRepositoryDetailed returns the number of the matching repositories, and the repository only if exactly 1 matches.
+	FindRepositoryDetailed(ctx context.Context, find *RepositoryFind) (*Repository, int, error)
 	PatchRepository(ctx context.Context, patch *RepositoryPatch) (*Repository, error)
 	DeleteRepository(ctx context.Context, delete *RepositoryDelete) error
+	// ArchiveRepositoriesForProject archives all repositories of the deleted project without changing its workflow type,
+	// and returns the number of the archived repositories.
+	ArchiveRepositoriesForProject(ctx context.Context, projectID int, deleterID int) (int, error)
+	// FindRepositoryByWebURL finds the repository by the web URL or the git remote URL, e.g. for the CLI to map a checkout to its project.
+	// Returns nil if not found.
+	FindRepositoryByWebURL(ctx context.Context, webURL string) (*Repository, error)
+	// FinalizeRepositoryCleanup deletes the repositories whose deferred cleanup is due at now, flips their projects to the UI workflow,
+	// and returns the IDs of the projects.
+	FinalizeRepositoryCleanup(ctx context.Context, now int64) ([]int, error)
+	// CountByVCSType returns the number of repositories keyed by the VCS type.
+	CountByVCSType(ctx context.Context) (map[string]int, error)
+	// PatchRepositoryList patches the repositories in a single transaction, so either all or none of them are patched.
+	// The tokens can't be patched by it.
+	PatchRepositoryList(ctx context.Context, patchList []*RepositoryPatch) ([]*Repository, error)
+	// FindRepositoriesWithoutWebhook returns the repositories lacking the external webhook.
+	FindRepositoriesWithoutWebhook(ctx context.Context) ([]*Repository, error)
+	// FindOrphanedRepositories returns the repositories referencing a deleted VCS.
+	FindOrphanedRepositories(ctx context.Context) ([]*Repository, error)
+	// FindExpiringRepositories returns the repositories with a valid access token expiring before expiresBefore, the Unix timestamp in seconds.
+	FindExpiringRepositories(ctx context.Context, expiresBefore int64) ([]*Repository, error)
+	// SwapRepositoryToken stores the refreshed access token and marks it valid if the refresh token of the repository is still
+	// swap.OldRefreshToken. Returns false if the refresh token has changed, i.e. another refresh won the race.
+	SwapRepositoryToken(ctx context.Context, swap *RepositoryTokenSwap) (bool, error)
+	// ClaimRepositorySync claims the lease of the exclusive sync of the repository for the owner, e.g. a replica, for leaseTTL.
+	// Returns true if the lease is acquired, i.e. it isn't held by another owner or has expired. The owner holding the lease renews it.
+	ClaimRepositorySync(ctx context.Context, repositoryID int, leaseTTL time.Duration, owner string) (bool, error)
+	// ReleaseRepositorySync releases the lease of the repository sync if it's held by the owner.
+	ReleaseRepositorySync(ctx context.Context, repositoryID int, owner string) error
+	// ReconcileProjectWorkflow corrects the workflow type of the projects disagreeing with whether they have linked repositories,
+	// i.e. VCS if linked and UI if not, and reports each change. It's idempotent.
+	ReconcileProjectWorkflow(ctx context.Context) (*WorkflowReconcileReport, error)
+	// DescribeRepository returns the effective configuration of the repository with the defaults resolved, along with the example
+	// paths for the sample databases of the project. It's read-only.
+	DescribeRepository(ctx context.Context, repositoryID int) (*RepositoryDescription, error)
+	// FindLastSyncedSchemaHash returns the hash of the schema file content last synced to the database from the path in the repository.
+	// Returns empty if the schema file has never been synced to the database.
+	FindLastSyncedSchemaHash(ctx context.Context, databaseID int, path string) (string, error)
+	// UpsertLastSyncedSchemaHash records the hash of the schema file content synced to the database from the path in the repository.
+	UpsertLastSyncedSchemaHash(ctx context.Context, databaseID int, path string, hash string) error
+	// AppendSyncHistory appends the entry to the sync history of the repository, and prunes the entries beyond the
+	// most recent RepositorySyncHistoryRetention ones.
+	AppendSyncHistory(ctx context.Context, create *SyncHistoryEntryCreate) error
+	// RecordSyncResult counts the consecutive sync failures of the repository, which a successful sync resets, and quarantines
+	// the repository once the count reaches threshold. Returns true only if the failure quarantines the repository.
+	RecordSyncResult(ctx context.Context, repositoryID int, result RepositorySyncResult, threshold int) (bool, error)
+	// ListSyncHistory returns the most recent limit entries of the sync history of the repository, the latest first.
+	ListSyncHistory(ctx context.Context, repositoryID int, limit int) ([]*SyncHistoryEntry, error)
+}
+
+// MatchPathToDatabase parses the environment and database name from the migration file path using the file path template
+// under the base directory, and resolves the database it applies to from databaseList.
+// The database instances must be composed with their environments.
+// Returns ENOTFOUND if no database matches, and ECONFLICT if more than one database matches.
+func MatchPathToDatabase(filePath, fileTemplate, baseDir string, databaseList []*Database) (*Database, error) {
+	mi, err := db.ParseMigrationInfo(filePath, filepath.Join(baseDir, fileTemplate))
+	if err != nil {
+		return nil, &common.Error{Code: common.Invalid, Err: err}
+	}
+
+	var matchedList []*Database
+	for _, database := range databaseList {
+		if database.Name != mi.Database {
+			continue
+		}
+		// Environment name comparison is case insensitive.
+		if mi.Environment != "" && !strings.EqualFold(database.Instance.Environment.Name, mi.Environment) {
+			continue
+		}
+		matchedList = append(matchedList, database)
+	}
+
+	switch len(matchedList) {
+	case 0:
+		if mi.Environment != "" {
+			return nil, &common.Error{Code: common.NotFound, Err: fmt.Errorf("no database %q in environment %q matches file %q", mi.Database, mi.Environment, filePath)}
+		}
+		return nil, &common.Error{Code: common.NotFound, Err: fmt.Errorf("no database %q matches file %q", mi.Database, filePath)}
+	case 1:
+		return matchedList[0], nil
+	default:
+		var instanceList []string
+		for _, database := range matchedList {
+			instanceList = append(instanceList, fmt.Sprintf("%q in environment %q", database.Instance.Name, database.Instance.Environment.Name))
+		}
+		return nil, &common.Error{Code: common.Conflict, Err: fmt.Errorf("file %q matches %d databases %q on instances %s", filePath, len(matchedList), mi.Database, strings.Join(instanceList, ", "))}
+	}
+}
+
+// ParseRepositoryPatchIgnorePathPatterns parses the ignorePathPatterns attribute of the repository patch payload.
+// Returns nil if the attribute is absent.
+func ParseRepositoryPatchIgnorePathPatterns(payload []byte) (*[]string, error) {
+	var patch struct {
+		Data struct {
+			Attributes struct {
+				IgnorePathPatterns *[]string `json:"ignorePathPatterns"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &patch); err != nil {
+		return nil, err
+	}
+	return patch.Data.Attributes.IgnorePathPatterns, nil
+}
+
+// ParseRepositoryLabelSelector parses the label selector in the form of "key1=value1,key2=value2".
+func ParseRepositoryLabelSelector(selector string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, requirement := range strings.Split(selector, ",") {
+		pair := strings.SplitN(requirement, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("label selector requirement %q isn't in the form of key=value", requirement)
+		}
+		key, value := strings.TrimSpace(pair[0]), strings.TrimSpace(pair[1])
+		if key == "" {
+			return nil, fmt.Errorf("label selector requirement %q has an empty key", requirement)
+		}
+		if v, ok := labels[key]; ok && v != value {
+			return nil, fmt.Errorf("label selector has conflicting values %q and %q for key %q", v, value, key)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// NormalizeRepositoryWebURL normalizes the URL of a repository to the form of "host/path" in lower case, so that the web URL and
+// the git remote URLs of the same repository are normalized the same, e.g. "https://gitlab.com/group/project/",
+// "https://gitlab.com/group/project.git" and "git@gitlab.com:group/project.git" are all normalized to "gitlab.com/group/project".
+// The scheme and the user are dropped, and so is the port of the SSH URL since it isn't the port of the web URL.
+// The URL without the scheme and not in the scp-like syntax, e.g. "gitlab.com/group/project", is taken as "host/path".
+// Returns an empty string if the URL has no host.
+func NormalizeRepositoryWebURL(url string) string {
+	url = strings.TrimSpace(url)
+	var host, path string
+	if i := strings.Index(url, "://"); i >= 0 {
+		scheme := strings.ToLower(url[:i])
+		host, path = splitRepositoryURL(url[i+len("://"):], "/")
+		if i := strings.LastIndex(host, "@"); i >= 0 {
+			host = host[i+1:]
+		}
+		if scheme != "http" && scheme != "https" {
+			host, _ = splitRepositoryURL(host, ":")
+		}
+	} else if strings.Contains(url, ":") {
+		// The scp-like syntax of the SSH URL, e.g. "git@gitlab.com:group/project.git".
+		host, path = splitRepositoryURL(url, ":")
+		if i := strings.LastIndex(host, "@"); i >= 0 {
+			host = host[i+1:]
+		}
+	} else {
+		// The URL without the scheme, e.g. "gitlab.com/group/project".
+		host, path = splitRepositoryURL(url, "/")
+	}
+	if host == "" {
+		return ""
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return strings.ToLower(host)
+	}
+	return strings.ToLower(host + "/" + path)
+}
+
+// splitRepositoryURL splits the URL around the first instance of sep. The second part is empty if sep isn't found.
+func splitRepositoryURL(url string, sep string) (string, string) {
+	parts := strings.SplitN(url, sep, 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// ValidateRepositoryBranchEnvironmentMapping validates the json-encoded branch environment mapping.
+func ValidateRepositoryBranchEnvironmentMapping(mappingJSON string) (BranchEnvironmentMapping, error) {
+	var mapping BranchEnvironmentMapping
+	if err := json.Unmarshal([]byte(mappingJSON), &mapping); err != nil {
+		return nil, fmt.Errorf("invalid branch environment mapping %q, error %v", mappingJSON, err)
+	}
+	for branch, environment := range mapping {
+		if branch == "" || environment == "" {
+			return nil, fmt.Errorf("invalid branch environment mapping %q: %q, neither branch nor environment can be empty", branch, environment)
+		}
+	}
+	return mapping, nil
+}
+
+const (
+	// WebhookSecretTokenLength is the length of the generated webhook secret token.
+	WebhookSecretTokenLength = 32
+	// MinWebhookSecretTokenLength is the minimum length of the webhook secret token.
+	MinWebhookSecretTokenLength = 20
+	// MinWebhookSecretTokenEntropy is the minimum estimated entropy in bits of the webhook secret token.
+	MinWebhookSecretTokenEntropy = 64
+)
+
+// ValidateRepositoryWebhookSecretToken validates the webhook secret token is strong enough, so the webhook requests can't be forged by guessing it.
+// The entropy is estimated as the length multiplied by the bits of the distinct characters, which rejects the repetitive tokens like "abababab...".
+// Returns EINVALID if the token is too weak.
+func ValidateRepositoryWebhookSecretToken(token string) error {
+	if len(token) < MinWebhookSecretTokenLength {
+		return &common.Error{Code: common.Invalid, Err: fmt.Errorf("webhook secret token must be at least %d characters, got %d", MinWebhookSecretTokenLength, len(token))}
+	}
+	distinct := make(map[rune]bool)
+	for _, r := range token {
+		distinct[r] = true
+	}
+	if entropy := float64(len(token)) * math.Log2(float64(len(distinct))); entropy < MinWebhookSecretTokenEntropy {
+		return &common.Error{Code: common.Invalid, Err: fmt.Errorf("webhook secret token is too predictable, estimated entropy %.0f bits is less than %d bits", entropy, MinWebhookSecretTokenEntropy)}
+	}
+	return nil
+}
+
+// ValidateRepositoryLabels validates the json-encoded repository labels.
+func ValidateRepositoryLabels(labelsJSON string) error {
+	var labels map[string]string
+	if err := json.Unmarshal([]byte(labelsJSON), &labels); err != nil {
+		return fmt.Errorf("invalid repository labels %q, error %v", labelsJSON, err)
+	}
+	for key, value := range labels {
+		// The label selector uses "," and "=" as the separators.
+		if key == "" || strings.ContainsAny(key, ",=") || strings.ContainsAny(value, ",=") {
+			return fmt.Errorf("invalid repository label %q: %q, the key must be non-empty and neither key nor value can contain \",\" or \"=\"", key, value)
+		}
+	}
+	return nil
+}
+
+// CompareRepositoryConfigs compares the effective configs of the repositories, with the defaults resolved, and reports the
+// fields where they diverge from the most common value, e.g. the one team using a nonstandard file path template.
+// The tie of the most common values is broken by the value order, so the report is deterministic.
+// The identity, the statuses and the secrets of the repositories aren't compared. It's read-only.
+func CompareRepositoryConfigs(repositoryList []*Repository) (*ConfigDivergenceReport, error) {
+	report := &ConfigDivergenceReport{
+		RepositoryCount: len(repositoryList),
+		FieldList:       []*ConfigFieldDivergence{},
+	}
+	var fieldOrder []string
+	// groupMap is keyed by the field and then the value.
+	groupMap := make(map[string]map[string]*ConfigValueGroup)
+	for _, repository := range repositoryList {
+		config, err := effectiveRepositoryConfig(repository)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range config {
+			valueMap, ok := groupMap[field.name]
+			if !ok {
+				valueMap = make(map[string]*ConfigValueGroup)
+				groupMap[field.name] = valueMap
+				fieldOrder = append(fieldOrder, field.name)
+			}
+			group, ok := valueMap[field.value]
+			if !ok {
+				group = &ConfigValueGroup{Value: field.value}
+				valueMap[field.value] = group
+			}
+			group.RepositoryIDList = append(group.RepositoryIDList, repository.ID)
+		}
+	}
+
+	for _, field := range fieldOrder {
+		valueMap := groupMap[field]
+		if len(valueMap) < 2 {
+			continue
+		}
+		divergence := &ConfigFieldDivergence{Field: field}
+		for _, group := range valueMap {
+			divergence.GroupList = append(divergence.GroupList, group)
+		}
+		sort.Slice(divergence.GroupList, func(i, j int) bool {
+			a, b := divergence.GroupList[i], divergence.GroupList[j]
+			if len(a.RepositoryIDList) != len(b.RepositoryIDList) {
+				return len(a.RepositoryIDList) > len(b.RepositoryIDList)
+			}
+			return a.Value < b.Value
+		})
+		divergence.CommonValue = divergence.GroupList[0].Value
+		report.FieldList = append(report.FieldList, divergence)
+	}
+	return report, nil
+}
+
+type repositoryConfigField struct {
+	name  string
+	value string
+}
+
+// effectiveRepositoryConfig returns the compared config fields of the repository, named by their API attributes,
+// with the defaults resolved so that the repositories relying on the default agree with those spelling it out.
+func effectiveRepositoryConfig(repository *Repository) ([]repositoryConfigField, error) {
+	targetBranchFilter := repository.TargetBranchFilter
+	if targetBranchFilter == "" {
+		targetBranchFilter = "*"
+	}
+	schemaSourceType := repository.SchemaSourceType
+	if schemaSourceType == "" {
+		schemaSourceType = SchemaSourceSingleFile
+	}
+	duplicateVersionPolicy := repository.DuplicateVersionPolicy
+	if duplicateVersionPolicy == "" {
+		duplicateVersionPolicy = DuplicateVersionError
+	}
+	emptyMigrationPolicy := repository.EmptyMigrationPolicy
+	if emptyMigrationPolicy == "" {
+		emptyMigrationPolicy = EmptyMigrationSkip
+	}
+	driftAction := repository.DriftAction
+	if driftAction == "" {
+		driftAction = DriftActionAnomalyOnly
+	}
+	commitStatusContext := repository.CommitStatusContext
+	if commitStatusContext == "" {
+		commitStatusContext = vcs.DefaultCommitStatusContext
+	}
+	branchEnvironmentMapping := ""
+	if len(repository.BranchEnvironmentMapping) > 0 {
+		// The map keys are marshaled in the sorted order.
+		b, err := json.Marshal(repository.BranchEnvironmentMapping)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal branch environment mapping of repository %d, error %w", repository.ID, err)
+		}
+		branchEnvironmentMapping = string(b)
+	}
+
+	return []repositoryConfigField{
+		{"branchFilter", repository.BranchFilter},
+		{"targetBranchFilter", targetBranchFilter},
+		{"baseDirectory", repository.BaseDirectory},
+		{"filePathTemplate", repository.FilePathTemplate},
+		{"schemaPathTemplate", repository.SchemaPathTemplate},
+		{"schemaSourceType", string(schemaSourceType)},
+		{"duplicateVersionPolicy", string(duplicateVersionPolicy)},
+		{"emptyMigrationPolicy", string(emptyMigrationPolicy)},
+		{"migrationStatementTimeout", strconv.Itoa(repository.MigrationStatementTimeout)},
+		{"driftAction", string(driftAction)},
+		{"requireSignedCommits", strconv.FormatBool(repository.RequireSignedCommits)},
+		{"skipDirective", repository.SkipDirective},
+		{"schemaRef", repository.SchemaRef},
+		{"schemaSnapshotOnApply", strconv.FormatBool(repository.SchemaSnapshotOnApply)},
+		{"ignorePathPatterns", strings.Join(repository.IgnorePathPatterns, ",")},
+		{"commitAuthorName", repository.CommitAuthorName},
+		{"commitAuthorEmail", repository.CommitAuthorEmail},
+		{"commitStatusContext", commitStatusContext},
+		{"branchEnvironmentMapping", branchEnvironmentMapping},
+	}, nil
+}
+
+// ConfigFingerprint returns the hex-encoded SHA-256 of the fields affecting how the pushes to the repository are synced,
+// i.e. the VCS, the external ID and the effective config, so that the caches and the reconcilers can tell whether the
+// repository has changed by a single value. The secrets, the statuses and the timestamps are excluded. The fingerprint is
+// stable across runs, and returns the empty string if the config can't be encoded.
+func (r *Repository) ConfigFingerprint() string {
+	config, err := effectiveRepositoryConfig(r)
+	if err != nil {
+		return ""
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "vcsId=%d\n", r.VCSID)
+	fmt.Fprintf(h, "externalId=%q\n", r.ExternalID)
+	for _, field := range config {
+		// The values are quoted, so a value containing the separator can't collide with another field.
+		fmt.Fprintf(h, "%s=%q\n", field.name, field.value)
+	}
+	return hex.EncodeToString(h.Sum(nil))
 }
@@ -11,6 +11,8 @@ type SettingName string
 const (
 	// SettingAuthSecret is the setting name for auth secret.
 	SettingAuthSecret SettingName = "bb.auth.secret"
+	// SettingWorkspaceID is the setting name for workspace identifier.
+	SettingWorkspaceID SettingName = "bb.workspace.id"
 )
 
 // Setting is the API message for a setting.
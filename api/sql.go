@@ -36,6 +36,14 @@ type SQLExecute struct {
 	Limit int `jsonapi:"attr,limit"`
 }
 
+// DryRunResult is the API message for the result of dry-running a migration against a shadow database.
+type DryRunResult struct {
+	// FailedStatement is the statement failing to apply. It's empty if the migration applies cleanly.
+	FailedStatement string `jsonapi:"attr,failedStatement"`
+	// Error is the database error of the failed statement.
+	Error string `jsonapi:"attr,error"`
+}
+
 // SQLResultSet is the API message for SQL results.
 type SQLResultSet struct {
 	// A list of rows marshalled into a JSON.
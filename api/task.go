@@ -87,12 +87,42 @@ type TaskDatabaseCreatePayload struct {
 	SchemaVersion string `json:"schemaVersion,omitempty"`
 }
 
+// TaskRetryPolicy is the policy of automatically retrying the task failed by a transient error, e.g. a lock timeout.
+type TaskRetryPolicy struct {
+	// MaxAttempts is the maximum number of the attempts including the first one, so 1 means never retrying.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// InitialBackoff is the seconds waited before the first retry, doubled for each further retry.
+	InitialBackoff int64 `json:"initialBackoff,omitempty"`
+	// MaxBackoff caps the seconds waited before a retry, 0 means no cap.
+	MaxBackoff int64 `json:"maxBackoff,omitempty"`
+}
+
+// Backoff returns the seconds waited before the retry following retryCount retries.
+func (policy *TaskRetryPolicy) Backoff(retryCount int) int64 {
+	backoff := policy.InitialBackoff
+	for i := 0; i < retryCount; i++ {
+		if policy.MaxBackoff > 0 && backoff >= policy.MaxBackoff {
+			break
+		}
+		backoff *= 2
+	}
+	if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+		return policy.MaxBackoff
+	}
+	return backoff
+}
+
 // TaskDatabaseSchemaUpdatePayload is the task payload for database schema update (DDL).
 type TaskDatabaseSchemaUpdatePayload struct {
 	MigrationType     db.MigrationType `json:"migrationType,omitempty"`
 	Statement         string           `json:"statement,omitempty"`
 	RollbackStatement string           `json:"rollbackStatement,omitempty"`
 	VCSPushEvent      *vcs.PushEvent   `json:"pushEvent,omitempty"`
+	// RetryPolicy is nil if the task isn't retried automatically.
+	RetryPolicy *TaskRetryPolicy `json:"retryPolicy,omitempty"`
+	// ExtraApprovalRequired is true if the statement contains destructive operations,
+	// so that the task requires the approval of a DBA or an Owner.
+	ExtraApprovalRequired bool `json:"extraApprovalRequired,omitempty"`
 }
 
 // TaskDatabaseDataUpdatePayload is the task payload for database data update (DML).
@@ -100,6 +130,8 @@ type TaskDatabaseDataUpdatePayload struct {
 	Statement         string         `json:"statement,omitempty"`
 	RollbackStatement string         `json:"rollbackStatement,omitempty"`
 	VCSPushEvent      *vcs.PushEvent `json:"pushEvent,omitempty"`
+	// RetryPolicy is nil if the task isn't retried automatically.
+	RetryPolicy *TaskRetryPolicy `json:"retryPolicy,omitempty"`
 }
 
 // TaskDatabaseBackupPayload is the task payload for database backup.
@@ -145,6 +177,19 @@ type Task struct {
 	Type              TaskType   `jsonapi:"attr,type"`
 	Payload           string     `jsonapi:"attr,payload"`
 	EarliestAllowedTs int64      `jsonapi:"attr,earliestAllowedTs"`
+	// ApprovedTs is when the task is approved, 0 if the task isn't approved.
+	ApprovedTs int64 `jsonapi:"attr,approvedTs"`
+	// ApprovalList is the json-encoded []Approval of the task in order, recording the progress of the approval chain.
+	ApprovalList string `jsonapi:"attr,approvalList"`
+	// HoldUntilTs is when the approved task is held until by the minimum hold duration of the approval policy,
+	// 0 if the task isn't held. It's not persisted.
+	HoldUntilTs int64 `jsonapi:"attr,holdUntilTs"`
+	// RetryCount is the number of the automatic retries of the current run after the transient errors.
+	RetryCount int `jsonapi:"attr,retryCount"`
+	// LastError is the error of the last failed attempt, kept after the task succeeds on a retry.
+	LastError string `jsonapi:"attr,lastError"`
+	// NextRetryTs is when the running task is retried after the transient error, 0 if it's not waiting for a retry.
+	NextRetryTs int64 `jsonapi:"attr,nextRetryTs"`
 }
 
 // TaskCreate is the API message for creating a task.
@@ -211,6 +256,11 @@ type TaskPatch struct {
 	Statement         *string `jsonapi:"attr,statement"`
 	Payload           *string
 	EarliestAllowedTs *int64 `jsonapi:"attr,earliestAllowedTs"`
+	// ApprovalList is the json-encoded []Approval.
+	ApprovalList *string
+	RetryCount   *int
+	LastError    *string
+	NextRetryTs  *int64
 }
 
 // TaskStatusPatch is the API message for patching a task status.
@@ -90,3 +90,95 @@ type VCSService interface {
 	PatchVCS(ctx context.Context, patch *VCSPatch) (*VCS, error)
 	DeleteVCS(ctx context.Context, delete *VCSDelete) error
 }
+
+// VCSOAuthAuthorize is the API message for starting the OAuth authorization of a VCS.
+// The state and the PKCE code challenge should be sent in the authorization request.
+type VCSOAuthAuthorize struct {
+	State               string `jsonapi:"attr,state"`
+	CodeChallenge       string `jsonapi:"attr,codeChallenge"`
+	CodeChallengeMethod string `jsonapi:"attr,codeChallengeMethod"`
+}
+
+// VCSOAuthExchange is the API message for exchanging the OAuth authorization code of a VCS for a token.
+type VCSOAuthExchange struct {
+	// State is the state returned by the OAuth callback, it must match the one issued by the authorization.
+	State       string `jsonapi:"attr,state"`
+	Code        string `jsonapi:"attr,code"`
+	RedirectURL string `jsonapi:"attr,redirectUrl"`
+}
+
+// VCSOAuthToken is the API message for the token exchanged from the OAuth authorization code.
+type VCSOAuthToken struct {
+	AccessToken  string `jsonapi:"attr,accessToken"`
+	RefreshToken string `jsonapi:"attr,refreshToken"`
+	ExpiresTs    int64  `jsonapi:"attr,expiresTs"`
+	// Ticket is issued by the server for the verified exchange, it's redeemed for the token when linking a repository.
+	Ticket string `jsonapi:"attr,ticket"`
+}
+
+// VCSOAuthState is the pending OAuth authorization started by a principal for a VCS.
+type VCSOAuthState struct {
+	State        string
+	VCSID        int
+	PrincipalID  int
+	CodeVerifier string
+	ExpiresTs    int64
+}
+
+// VCSOAuthTicket keeps the token of the verified OAuth token exchange by a principal for a VCS,
+// redeemed by the ticket when linking a repository.
+type VCSOAuthTicket struct {
+	Ticket       string
+	VCSID        int
+	PrincipalID  int
+	AccessToken  string
+	RefreshToken string
+	// 0 means the access token never expires.
+	TokenExpiresTs int64
+	ExpiresTs      int64
+}
+
+// VCSOAuthService is the service for the VCS OAuth states and tickets.
+type VCSOAuthService interface {
+	// CreateOAuthState creates the OAuth state, purging the expired states and tickets.
+	CreateOAuthState(ctx context.Context, create *VCSOAuthState) error
+	// ConsumeOAuthState deletes the OAuth state and returns it, nil if it's not found.
+	ConsumeOAuthState(ctx context.Context, state string) (*VCSOAuthState, error)
+	// CreateOAuthTicket creates the OAuth ticket.
+	CreateOAuthTicket(ctx context.Context, create *VCSOAuthTicket) error
+	// FindOAuthTicket returns the OAuth ticket, nil if it's not found.
+	FindOAuthTicket(ctx context.Context, ticket string) (*VCSOAuthTicket, error)
+	// DeleteOAuthTicket deletes the OAuth ticket, it's a no-op if the ticket is not found.
+	DeleteOAuthTicket(ctx context.Context, ticket string) error
+}
+
+// VCSRateLimit is the API message for the rate limit state of the VCS instance, for diagnosing the slow or failed VCS requests.
+type VCSRateLimit struct {
+	// VCSID is the ID of the VCS.
+	VCSID int `jsonapi:"primary,vcsRateLimit"`
+
+	// Known is false if the VCS instance hasn't told its rate limit since the server started.
+	Known bool `jsonapi:"attr,known"`
+	// Limit is the maximum number of requests in the rate limit window.
+	Limit     int `jsonapi:"attr,limit"`
+	Remaining int `jsonapi:"attr,remaining"`
+	// ResetTs is the Unix timestamp in seconds when the rate limit window is reset.
+	ResetTs int64 `jsonapi:"attr,resetTs"`
+	// RetryAfterTs is the Unix timestamp in seconds until which the requests are held back after being rejected, 0 if not rejected.
+	RetryAfterTs int64 `jsonapi:"attr,retryAfterTs"`
+	UpdatedTs    int64 `jsonapi:"attr,updatedTs"`
+}
+
+// VCSCapability is the API message for the capabilities detected of the VCS instance, for diagnosing the VCS calls adapted
+// to the older self-hosted instances.
+type VCSCapability struct {
+	// VCSID is the ID of the VCS.
+	VCSID int `jsonapi:"primary,vcsCapability"`
+
+	// Known is false if the capabilities haven't been detected since the server started.
+	Known bool `jsonapi:"attr,known"`
+	// Version is the version of the VCS instance, empty if the instance doesn't tell its version.
+	Version      string `jsonapi:"attr,version"`
+	CommitStatus bool   `jsonapi:"attr,commitStatus"`
+	DetectedTs   int64  `jsonapi:"attr,detectedTs"`
+}
@@ -16,9 +16,11 @@ import (
 	"github.com/bytebase/bytebase/common"
 	enterprise "github.com/bytebase/bytebase/enterprise/service"
 	dbdriver "github.com/bytebase/bytebase/plugin/db"
+	"github.com/bytebase/bytebase/plugin/vcs"
 	"github.com/bytebase/bytebase/resources"
 	"github.com/bytebase/bytebase/server"
 	"github.com/bytebase/bytebase/store"
+	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -96,6 +98,22 @@ var (
 	readonly bool
 	demo     bool
 	debug    bool
+	// When we are running in air-gapped mode, the license must be bound to this workspace.
+	airgap bool
+	// The maximum size in bytes of the VCS webhook request body, since the webhook endpoint is publicly exposed.
+	webhookMaxBodySize int64
+	// The maximum size in bytes of a file read from the VCS, e.g. a migration file.
+	vcsMaxFileSize int64
+	// The hosts of the webhook callback URL keyed by the logical host key, e.g. "eu=https://eu.example.com,us=https://us.example.com".
+	webhookHosts string
+	// The TTL of the in-memory cache of the repositories looked up by the webhook events, 0 disables the cache.
+	webhookRepositoryCacheTTL time.Duration
+	// The maximum attempts of the VCS-driven migration task failed by the transient errors, 0 disables the retry.
+	taskRetryMaxAttempts int
+	// The backoff before the first retry of the failed task, doubled for each further retry.
+	taskRetryInitialBackoff time.Duration
+	// The grace window of the deferred repository cleanup, during which re-linking the unlinked repository restores it.
+	repositoryCleanupGracePeriod time.Duration
 
 	rootCmd = &cobra.Command{
 		Use:   "bytebase",
@@ -129,6 +147,14 @@ func init() {
 	rootCmd.PersistentFlags().BoolVar(&readonly, "readonly", false, "whether to run in read-only mode")
 	rootCmd.PersistentFlags().BoolVar(&demo, "demo", false, "whether to run using demo data")
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "whether to enable debug level logging")
+	rootCmd.PersistentFlags().BoolVar(&airgap, "airgap", false, "whether to run in air-gapped mode, which requires the license to be bound to this workspace")
+	rootCmd.PersistentFlags().Int64Var(&webhookMaxBodySize, "webhook-max-body-size", server.DefaultWebhookMaxBodySize, "maximum size in bytes of the VCS webhook request body. The oversized request is rejected with 413")
+	rootCmd.PersistentFlags().Int64Var(&vcsMaxFileSize, "vcs-max-file-size", vcs.DefaultMaxFileSize, "maximum size in bytes of a file read from the VCS, e.g. a migration file. The oversized migration file is ignored with a warning activity")
+	rootCmd.PersistentFlags().DurationVar(&webhookRepositoryCacheTTL, "webhook-repository-cache-ttl", 0, "TTL of the in-memory cache of the repositories looked up by the VCS webhook events, e.g. 30s. The cache is invalidated on the repository changes made by this server, while the other replicas may serve the stale repository until the TTL. Default is 0, which disables the cache")
+	rootCmd.PersistentFlags().StringVar(&webhookHosts, "webhook-hosts", "", "hosts of the VCS webhook callback URL keyed by the logical host key, in the form of key1=https://host1,key2=https://host2. A repository linked with a host key receives the webhook through the host. Default is the same as --host")
+	rootCmd.PersistentFlags().IntVar(&taskRetryMaxAttempts, "task-retry-max-attempts", 0, "maximum attempts of the migration task created by the VCS push, including the first one. The task failed by a transient error, e.g. a lock timeout, is retried with exponential backoff. Default is 0, which disables the retry")
+	rootCmd.PersistentFlags().DurationVar(&taskRetryInitialBackoff, "task-retry-initial-backoff", 30*time.Second, "backoff before the first retry of the migration task failed by a transient error, doubled for each further retry")
+	rootCmd.PersistentFlags().DurationVar(&repositoryCleanupGracePeriod, "repository-cleanup-grace-period", server.DefaultRepositoryCleanupGracePeriod, "grace window of the repository unlinked with the deferred cleanup, e.g. 72h. Re-linking the same repository within the window restores its settings, and the repository is deleted after the window")
 }
 
 // -----------------------------------Command Line Config END--------------------------------------
@@ -162,6 +188,8 @@ type Profile struct {
 type config struct {
 	// secret used to sign the JWT auth token
 	secret string
+	// workspaceID used to bind the license
+	workspaceID string
 }
 
 // Main is the main server for Bytebase.
@@ -289,6 +317,12 @@ func NewMain(activeProfile Profile, logger *zap.Logger) (*Main, error) {
 	fmt.Printf("readonly=%t\n", readonly)
 	fmt.Printf("demo=%t\n", demo)
 	fmt.Printf("debug=%t\n", debug)
+	fmt.Printf("airgap=%t\n", airgap)
+	fmt.Printf("webhookMaxBodySize=%d\n", webhookMaxBodySize)
+	fmt.Printf("webhookHosts=%s\n", webhookHosts)
+	fmt.Printf("webhookRepositoryCacheTTL=%s\n", webhookRepositoryCacheTTL)
+	fmt.Printf("taskRetryMaxAttempts=%d\n", taskRetryMaxAttempts)
+	fmt.Printf("taskRetryInitialBackoff=%s\n", taskRetryInitialBackoff)
 	fmt.Println("-----Config END-------")
 
 	pgBinDir, err := resources.InstallPostgres(resourceDir, pgDataDir, activeProfile.pgUser)
@@ -318,6 +352,19 @@ func initSetting(ctx context.Context, settingService api.SettingService) (*confi
 		}
 		result.secret = config.Value
 	}
+	{
+		configCreate := &api.SettingCreate{
+			CreatorID:   api.SystemBotID,
+			Name:        api.SettingWorkspaceID,
+			Value:       uuid.New().String(),
+			Description: "The workspace identifier, used to bind the license.",
+		}
+		config, err := settingService.CreateSettingIfNotExist(ctx, configCreate)
+		if err != nil {
+			return nil, err
+		}
+		result.workspaceID = config.Value
+	}
 
 	return result, nil
 }
@@ -353,10 +400,31 @@ func (m *Main) Run(ctx context.Context) error {
 	m.db = db
 
 	s := server.NewServer(m.l, m.lvl, version, host, m.profile.port, frontendHost, frontendPort, m.profile.mode, m.profile.dataDir, m.profile.backupRunnerInterval, config.secret, readonly, demo, debug)
+	s.SetWebhookMaxBodySize(webhookMaxBodySize)
+	s.SetVCSMaxFileSize(vcsMaxFileSize)
+	s.SetRepositoryCleanupGracePeriod(repositoryCleanupGracePeriod)
+	if taskRetryMaxAttempts > 1 {
+		s.SetTaskRetryPolicy(&api.TaskRetryPolicy{
+			MaxAttempts:    taskRetryMaxAttempts,
+			InitialBackoff: int64(taskRetryInitialBackoff.Seconds()),
+		})
+	}
+	if webhookHosts != "" {
+		hostMap, err := server.ParseWebhookHostMap(webhookHosts)
+		if err != nil {
+			return fmt.Errorf("invalid --webhook-hosts: %w", err)
+		}
+		s.SetWebhookHostResolver(server.NewWebhookHostResolver(hostMap))
+	}
 	s.SettingService = settingService
 	s.PrincipalService = store.NewPrincipalService(m.l, db, s.CacheService)
 	s.MemberService = store.NewMemberService(m.l, db, s.CacheService)
-	s.PolicyService = store.NewPolicyService(m.l, db, s.CacheService)
+	policyService := store.NewPolicyService(m.l, db, s.CacheService)
+	// The environment tier defaults only apply if the plan allows backup policy.
+	policyService.SetTierDefaultEnabled(func() bool {
+		return s.IsFeatureEnabled(api.FeatureBackupPolicy)
+	})
+	s.PolicyService = policyService
 	s.ProjectService = store.NewProjectService(m.l, db, s.CacheService)
 	s.ProjectMemberService = store.NewProjectMemberService(m.l, db)
 	s.ProjectWebhookService = store.NewProjectWebhookService(m.l, db)
@@ -380,7 +448,12 @@ func (m *Main) Run(ctx context.Context) error {
 	s.InboxService = store.NewInboxService(m.l, db, s.ActivityService)
 	s.BookmarkService = store.NewBookmarkService(m.l, db)
 	s.VCSService = store.NewVCSService(m.l, db)
-	s.RepositoryService = store.NewRepositoryService(m.l, db, s.ProjectService)
+	s.VCSOAuthService = store.NewVCSOAuthService(m.l, db)
+	repositoryService := store.NewRepositoryService(m.l, db, s.ProjectService)
+	if webhookRepositoryCacheTTL > 0 {
+		repositoryService.SetRepositoryCache(store.NewRepositoryTTLCache(webhookRepositoryCacheTTL))
+	}
+	s.RepositoryService = repositoryService
 	s.AnomalyService = store.NewAnomalyService(m.l, db)
 	s.LabelService = store.NewLabelService(m.l, db)
 	s.DeploymentConfigService = store.NewDeploymentConfigService(m.l, db)
@@ -388,7 +461,7 @@ func (m *Main) Run(ctx context.Context) error {
 
 	s.ActivityManager = server.NewActivityManager(s, s.ActivityService)
 
-	licenseService, err := enterprise.NewLicenseService(m.l, m.profile.dataDir, m.profile.mode)
+	licenseService, err := enterprise.NewLicenseService(m.l, m.profile.dataDir, m.profile.mode, config.workspaceID, airgap)
 	if err != nil {
 		return err
 	}
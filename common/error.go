@@ -17,6 +17,11 @@ const (
 	NotFound       Code = 4
 	Conflict       Code = 5
 	NotImplemented Code = 6
+	// Unavailable is the code for failing to reach a dependency at all, e.g. the metadata database is down,
+	// as opposed to the dependency rejecting the request. The request may succeed on retry.
+	Unavailable Code = 7
+	// PaymentRequired is the code for exceeding the quota of the current plan, the request may succeed after upgrading the plan.
+	PaymentRequired Code = 8
 
 	// 101 ~ 199 db error
 	DbConnectionFailure    Code = 101
@@ -9,5 +9,6 @@ type OauthContext struct {
 	ClientSecret string
 	AccessToken  string
 	RefreshToken string
-	Refresher    TokenRefresher
+	// Refresher is nil if the access token never expires.
+	Refresher TokenRefresher
 }
@@ -1,6 +1,8 @@
 package common
 
 import (
+	crand "crypto/rand"
+	"math/big"
 	"math/rand"
 	"sort"
 	"strings"
@@ -28,6 +30,21 @@ func RandomString(n int) string {
 	return sb.String()
 }
 
+// RandomSecret returns a cryptographically secure random string with length n, which is suitable for secrets.
+func RandomSecret(n int) (string, error) {
+	var sb strings.Builder
+	sb.Grow(n)
+	max := big.NewInt(int64(len(letters)))
+	for i := 0; i < n; i++ {
+		index, err := crand.Int(crand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteRune(letters[index.Int64()])
+	}
+	return sb.String(), nil
+}
+
 // HasPrefixes returns true if the string s has any of the given prefixes.
 func HasPrefixes(src string, prefixes ...string) bool {
 	for _, prefix := range prefixes {
@@ -21,6 +21,10 @@ type License struct {
 	IssuedTs      int64
 	Plan          api.PlanType
 	Trialing      bool
+	// WorkspaceID is the workspace the license is bound to. Empty means not bound.
+	WorkspaceID string
+	// FeatureOverrides enables or disables the feature regardless of the plan.
+	FeatureOverrides map[api.FeatureType]bool
 }
 
 // Valid will check if license expired or has correct plan type.
@@ -14,4 +14,6 @@ type Subscription struct {
 	StartedTs     int64        `jsonapi:"attr,startedTs"`
 	Plan          api.PlanType `jsonapi:"attr,plan"`
 	Trialing      bool         `jsonapi:"attr,trialing"`
+	// FeatureOverrides is granted by the license and only used on the server side for feature gating.
+	FeatureOverrides map[api.FeatureType]bool
 }
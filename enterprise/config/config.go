@@ -25,6 +25,11 @@ type Config struct {
 	MinimumInstance int
 	// StorePath is the file path to store license.
 	StorePath string
+	// WorkspaceID is the ID of this workspace. A license bound to another workspace is rejected.
+	WorkspaceID string
+	// Airgap requires the license to be bound to this workspace, because the license sharing
+	// can't be detected online in the air-gapped deployment.
+	Airgap bool
 }
 
 const (
@@ -39,7 +44,7 @@ const (
 )
 
 // NewConfig will create a new enterprise config instance.
-func NewConfig(l *zap.Logger, dataDir string, mode string) (*Config, error) {
+func NewConfig(l *zap.Logger, dataDir string, mode string, workspaceID string, airgap bool) (*Config, error) {
 	l.Info("get project env", zap.String("env", mode))
 
 	filename := fmt.Sprintf("keys/%s.pub.pem", mode)
@@ -61,5 +66,7 @@ func NewConfig(l *zap.Logger, dataDir string, mode string) (*Config, error) {
 		Audience:        audience,
 		MinimumInstance: minimumInstance,
 		StorePath:       fmt.Sprintf("%s/%s", dataDir, storefile),
+		WorkspaceID:     workspaceID,
+		Airgap:          airgap,
 	}, nil
 }
@@ -24,12 +24,16 @@ type Claims struct {
 	InstanceCount int    `json:"instanceCount"`
 	Trialing      bool   `json:"trialing"`
 	Plan          string `json:"plan"`
+	// WorkspaceID binds the license to a workspace to prevent license sharing.
+	WorkspaceID string `json:"workspaceId"`
+	// Features overrides the enablement of the features of the plan.
+	Features map[string]bool `json:"features"`
 	jwt.StandardClaims
 }
 
 // NewLicenseService will create a new enterprise license service.
-func NewLicenseService(l *zap.Logger, dataDir string, mode string) (*LicenseService, error) {
-	config, err := config.NewConfig(l, dataDir, mode)
+func NewLicenseService(l *zap.Logger, dataDir string, mode string, workspaceID string, airgap bool) (*LicenseService, error) {
+	config, err := config.NewConfig(l, dataDir, mode, workspaceID, airgap)
 	if err != nil {
 		return nil, err
 	}
@@ -110,6 +114,19 @@ func (s *LicenseService) parseClaims(claims *Claims) (*enterpriseAPI.License, er
 		return nil, common.Errorf(common.Invalid, fmt.Errorf("aud is not valid, expect %s but found '%v'", s.config.Audience, claims.Audience))
 	}
 
+	if claims.WorkspaceID == "" {
+		if s.config.Airgap {
+			return nil, common.Errorf(common.Invalid, fmt.Errorf("license is not bound to any workspace, expect the license bound to workspace %s in the air-gapped mode", s.config.WorkspaceID))
+		}
+	} else if claims.WorkspaceID != s.config.WorkspaceID {
+		return nil, common.Errorf(common.Invalid, fmt.Errorf("license is bound to workspace '%v', expect %s", claims.WorkspaceID, s.config.WorkspaceID))
+	}
+
+	featureOverrides, err := convertFeatureOverrides(claims.Features)
+	if err != nil {
+		return nil, common.Errorf(common.Invalid, err)
+	}
+
 	instanceCount := claims.InstanceCount
 	if instanceCount < s.config.MinimumInstance {
 		return nil, common.Errorf(common.Invalid, fmt.Errorf("license instance count '%v' is not valid, minimum instance requirement is %d", instanceCount, s.config.MinimumInstance))
@@ -121,12 +138,14 @@ func (s *LicenseService) parseClaims(claims *Claims) (*enterpriseAPI.License, er
 	}
 
 	license := &enterpriseAPI.License{
-		InstanceCount: instanceCount,
-		ExpiresTs:     claims.ExpiresAt,
-		IssuedTs:      claims.IssuedAt,
-		Plan:          planType,
-		Subject:       claims.Subject,
-		Trialing:      claims.Trialing,
+		InstanceCount:    instanceCount,
+		ExpiresTs:        claims.ExpiresAt,
+		IssuedTs:         claims.IssuedAt,
+		Plan:             planType,
+		Subject:          claims.Subject,
+		Trialing:         claims.Trialing,
+		WorkspaceID:      claims.WorkspaceID,
+		FeatureOverrides: featureOverrides,
 	}
 
 	if err := license.Valid(); err != nil {
@@ -164,3 +183,17 @@ func convertPlanType(candidate string) (api.PlanType, error) {
 		return api.FREE, fmt.Errorf("cannot conver plan type %q", candidate)
 	}
 }
+
+func convertFeatureOverrides(features map[string]bool) (map[api.FeatureType]bool, error) {
+	if len(features) == 0 {
+		return nil, nil
+	}
+	featureOverrides := make(map[api.FeatureType]bool)
+	for feature, enabled := range features {
+		if _, ok := api.FeatureMatrix[api.FeatureType(feature)]; !ok {
+			return nil, fmt.Errorf("cannot convert feature %q", feature)
+		}
+		featureOverrides[api.FeatureType(feature)] = enabled
+	}
+	return featureOverrides, nil
+}
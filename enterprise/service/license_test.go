@@ -0,0 +1,149 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/enterprise/config"
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+)
+
+const testWorkspaceID = "6b4e1c4e-6f5b-4f5e-9d0a-2f8e6c3b7a10"
+
+func newTestLicenseService(t *testing.T, airgap bool) (*LicenseService, *rsa.PrivateKey) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() got error %v, want OK.", err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() got error %v, want OK.", err)
+	}
+	return &LicenseService{
+		l: zap.NewNop(),
+		config: &config.Config{
+			PublicKey:       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})),
+			Version:         "v1",
+			Issuer:          "bytebase",
+			Audience:        "bb.license",
+			MinimumInstance: 5,
+			WorkspaceID:     testWorkspaceID,
+			Airgap:          airgap,
+		},
+	}, privateKey
+}
+
+func signLicense(t *testing.T, privateKey *rsa.PrivateKey, claims *Claims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "v1"
+	license, err := token.SignedString(privateKey)
+	if err != nil {
+		t.Fatalf("SignedString() got error %v, want OK.", err)
+	}
+	return license
+}
+
+func newClaims(expiresAt time.Time) *Claims {
+	return &Claims{
+		InstanceCount: 10,
+		Plan:          api.ENTERPRISE.String(),
+		WorkspaceID:   testWorkspaceID,
+		Features: map[string]bool{
+			string(api.FeatureSchemaDrift): false,
+		},
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    "bytebase",
+			Audience:  "bb.license",
+			Subject:   "acme",
+			IssuedAt:  time.Now().Add(-time.Hour).Unix(),
+			ExpiresAt: expiresAt.Unix(),
+		},
+	}
+}
+
+func TestParseLicense(t *testing.T) {
+	s, privateKey := newTestLicenseService(t, true /* airgap */)
+
+	license, err := s.parseLicense(signLicense(t, privateKey, newClaims(time.Now().Add(24*time.Hour))))
+	if err != nil {
+		t.Fatalf("parseLicense() got error %v, want OK.", err)
+	}
+	if license.Plan != api.ENTERPRISE {
+		t.Errorf("parseLicense() got plan %s, want %s.", license.Plan, api.ENTERPRISE)
+	}
+	if license.WorkspaceID != testWorkspaceID {
+		t.Errorf("parseLicense() got workspace ID %q, want %q.", license.WorkspaceID, testWorkspaceID)
+	}
+	if enabled, ok := license.FeatureOverrides[api.FeatureSchemaDrift]; !ok || enabled {
+		t.Errorf("parseLicense() got feature overrides %v, want %s disabled.", license.FeatureOverrides, api.FeatureSchemaDrift)
+	}
+
+	unboundClaims := newClaims(time.Now().Add(24 * time.Hour))
+	unboundClaims.WorkspaceID = ""
+	otherWorkspaceClaims := newClaims(time.Now().Add(24 * time.Hour))
+	otherWorkspaceClaims.WorkspaceID = "another-workspace"
+	unknownFeatureClaims := newClaims(time.Now().Add(24 * time.Hour))
+	unknownFeatureClaims.Features = map[string]bool{"bb.feature.unknown": true}
+	// Upgrade the plan in the payload while keeping the original signature.
+	teamClaims := newClaims(time.Now().Add(24 * time.Hour))
+	teamClaims.Plan = api.TEAM.String()
+	teamParts := strings.Split(signLicense(t, privateKey, teamClaims), ".")
+	enterpriseParts := strings.Split(signLicense(t, privateKey, newClaims(time.Now().Add(24*time.Hour))), ".")
+	tampered := strings.Join([]string{teamParts[0], enterpriseParts[1], teamParts[2]}, ".")
+	otherPrivateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() got error %v, want OK.", err)
+	}
+
+	tests := []struct {
+		name    string
+		license string
+	}{
+		{
+			name:    "expired",
+			license: signLicense(t, privateKey, newClaims(time.Now().Add(-time.Minute))),
+		},
+		{
+			name:    "tampered signature",
+			license: tampered,
+		},
+		{
+			name:    "signed by another key",
+			license: signLicense(t, otherPrivateKey, newClaims(time.Now().Add(24*time.Hour))),
+		},
+		{
+			name:    "bound to another workspace",
+			license: signLicense(t, privateKey, otherWorkspaceClaims),
+		},
+		{
+			name:    "not bound in the air-gapped mode",
+			license: signLicense(t, privateKey, unboundClaims),
+		},
+		{
+			name:    "unknown feature",
+			license: signLicense(t, privateKey, unknownFeatureClaims),
+		},
+	}
+
+	for _, test := range tests {
+		if _, err := s.parseLicense(test.license); common.ErrorCode(err) != common.Invalid {
+			t.Errorf("%q: parseLicense() got error %v, want invalid.", test.name, err)
+		}
+	}
+
+	// The license isn't required to be bound to the workspace outside the air-gapped mode.
+	s, privateKey = newTestLicenseService(t, false /* airgap */)
+	unboundClaims = newClaims(time.Now().Add(24 * time.Hour))
+	unboundClaims.WorkspaceID = ""
+	if _, err := s.parseLicense(signLicense(t, privateKey, unboundClaims)); err != nil {
+		t.Errorf("parseLicense() got error %v for the unbound license, want OK.", err)
+	}
+}
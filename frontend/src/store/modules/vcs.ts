@@ -9,6 +9,9 @@ import {
   VCSPatch,
   empty,
   EMPTY_ID,
+  OAuthAuthorize,
+  OAuthToken,
+  redirectUrl,
 } from "../../types";
 import { getPrincipalFromIncludedList } from "./principal";
 
@@ -139,6 +142,38 @@ const actions = {
     return updatedVCS;
   },
 
+  async authorizeOAuth({}: any, vcsId: VCSId): Promise<OAuthAuthorize> {
+    const data = (await axios.post(`/api/vcs/${vcsId}/oauth/authorize`)).data;
+    return data.data.attributes as OAuthAuthorize;
+  },
+
+  async exchangeOAuthToken(
+    {}: any,
+    {
+      vcsId,
+      state,
+      code,
+    }: {
+      vcsId: VCSId;
+      state: string;
+      code: string;
+    }
+  ): Promise<OAuthToken> {
+    const data = (
+      await axios.post(`/api/vcs/${vcsId}/oauth/token`, {
+        data: {
+          type: "VCSOAuthExchange",
+          attributes: {
+            state,
+            code,
+            redirectUrl: redirectUrl(),
+          },
+        },
+      })
+    ).data;
+    return data.data.attributes as OAuthToken;
+  },
+
   async deleteVCSById(
     { commit }: { state: VCSState; commit: any },
     vcsId: VCSId
@@ -40,6 +40,8 @@ export type AnomalyDatabaseSchemaDriftPayload = {
   version: string;
   expect: string;
   actual: string;
+  // The issue tracking the remediation, only set if the drift action is CREATE_ISSUE.
+  issueId?: number;
 };
 
 export type AnomalyPayload =
@@ -193,6 +193,7 @@ export const unknown = (
     rowStatus: "NORMAL",
     name: "<<Unknown environment>>",
     order: 0,
+    tier: "UNSPECIFIED",
   };
 
   const UNKNOWN_PROJECT: Project = {
@@ -581,6 +582,7 @@ export const empty = (
     rowStatus: "NORMAL",
     name: "",
     order: 0,
+    tier: "UNSPECIFIED",
   };
 
   const EMPTY_PROJECT: Project = {
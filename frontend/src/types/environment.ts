@@ -2,6 +2,8 @@ import { RowStatus } from "./common";
 import { EnvironmentId } from "./id";
 import { Principal } from "./principal";
 
+export type EnvironmentTier = "UNSPECIFIED" | "PROD" | "STAGING" | "DEV";
+
 export type Environment = {
   id: EnvironmentId;
 
@@ -15,11 +17,13 @@ export type Environment = {
   // Domain specific fields
   name: string;
   order: number;
+  tier: EnvironmentTier;
 };
 
 export type EnvironmentCreate = {
   // Domain specific fields
   name: string;
+  tier?: EnvironmentTier;
 };
 
 export type EnvironmentPatch = {
@@ -29,4 +33,5 @@ export type EnvironmentPatch = {
   // Domain specific fields
   name?: string;
   order?: number;
+  tier?: EnvironmentTier;
 };
@@ -65,6 +65,8 @@ export type Instance = {
   // In mysql, username can be empty which means anonymous user
   username?: string;
   password?: string;
+  // Only set in the create response, when the instance count is approaching the quota.
+  quotaWarning?: string;
 };
 
 export type InstanceCreate = {
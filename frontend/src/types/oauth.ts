@@ -13,6 +13,17 @@ export type OAuthToken = {
   accessToken: string;
   expiresTs: number;
   refreshToken: string;
+  // ticket is issued by the server for the verified token exchange, it's absent
+  // if the token is exchanged with the VCS directly.
+  ticket?: string;
+};
+
+// OAuthAuthorize is the state and the PKCE code challenge issued by the server
+// when starting the authorization, the server verifies them on the token exchange.
+export type OAuthAuthorize = {
+  state: string;
+  codeChallenge: string;
+  codeChallengeMethod: string;
 };
 
 export const OAuthStateSessionKey = "oauthstate";
@@ -20,6 +31,8 @@ export const OAuthStateSessionKey = "oauthstate";
 export type OAuthWindowEventPayload = {
   error: string;
   code: string;
+  // state is the state passed to the oauth callback without the oauth type prefix.
+  state: string;
 };
 
 export function redirectUrl(): string {
@@ -38,16 +51,24 @@ export type OAuthType =
 export function openWindowForOAuth(
   endpoint: string,
   applicationId: string,
-  type: OAuthType
+  type: OAuthType,
+  authorize?: OAuthAuthorize
 ): Window | null {
   // we use type to determine oauth type when receiving the callback
-  const stateQueryParameter = `${type}-${randomString(20)}`;
+  const stateQueryParameter = `${type}-${
+    authorize ? authorize.state : randomString(20)
+  }`;
   sessionStorage.setItem(OAuthStateSessionKey, stateQueryParameter);
 
+  let url = `${endpoint}?client_id=${applicationId}&redirect_uri=${encodeURIComponent(
+    redirectUrl()
+  )}&state=${stateQueryParameter}&response_type=code&scope=api`;
+  if (authorize) {
+    url += `&code_challenge=${authorize.codeChallenge}&code_challenge_method=${authorize.codeChallengeMethod}`;
+  }
+
   return window.open(
-    `${endpoint}?client_id=${applicationId}&redirect_uri=${encodeURIComponent(
-      redirectUrl()
-    )}&state=${stateQueryParameter}&response_type=code&scope=api`,
+    url,
     "oauth",
     "location=yes,left=200,top=200,height=640,width=480,scrollbars=yes,status=yes"
   );
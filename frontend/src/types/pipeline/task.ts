@@ -50,6 +50,7 @@ export type TaskDatabaseSchemaUpdatePayload = {
   statement: string;
   rollbackStatement: string;
   pushEvent?: VCSPushEvent;
+  extraApprovalRequired?: boolean;
 };
 
 export type TaskDatabaseDataUpdatePayload = {
@@ -92,6 +93,17 @@ export type Task = {
   type: TaskType;
   instance: Instance;
   earliestAllowedTs: number;
+  approvedTs: number;
+  // The json-encoded approvals of the task in order, recording the progress of the approval chain.
+  approvalList: string;
+  // The approved task is held until holdUntilTs by the minimum hold duration of the approval policy, 0 if not held.
+  holdUntilTs: number;
+  // The number of the automatic retries of the current run after the transient errors, e.g. a lock timeout.
+  retryCount: number;
+  // The error of the last failed attempt.
+  lastError: string;
+  // The running task is retried at nextRetryTs, 0 if it's not waiting for a retry.
+  nextRetryTs: number;
   // Tasks like creating database may not have database.
   database?: Database;
   payload?: TaskPayload;
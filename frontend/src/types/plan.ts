@@ -10,9 +10,12 @@ export type FeatureType =
   // Policy Control
   | "bb.feature.approval-policy"
   | "bb.feature.backup-policy"
+  | "bb.feature.custom-approval-chain"
   // Admin & Security
   | "bb.feature.rbac"
-  | "bb.feature.3rd-party-login";
+  | "bb.feature.3rd-party-login"
+  // SQL Editor
+  | "bb.feature.query-console";
 
 export enum PlanType {
   FREE = 0,
@@ -53,9 +56,12 @@ export const FEATURE_MATRIX: Map<FeatureType, boolean[]> = new Map([
   // Policy Control
   ["bb.feature.approval-policy", [false, true, true]],
   ["bb.feature.backup-policy", [false, true, true]],
+  ["bb.feature.custom-approval-chain", [false, false, true]],
   // Admin & Security
   ["bb.feature.rbac", [false, true, true]],
   ["bb.feature.3rd-party-login", [false, true, true]],
+  // SQL Editor
+  ["bb.feature.query-console", [true, true, true]],
 ]);
 
 export const FEATURE_SECTIONS = [
@@ -1,4 +1,4 @@
-import { Environment, PolicyId, Principal } from ".";
+import { Environment, PolicyId, Principal, RoleType } from ".";
 
 export type PolicyType =
   | "bb.policy.pipeline-approval"
@@ -10,6 +10,19 @@ export type PipelineApprovalPolicyValue =
 
 export type PipelineApporvalPolicyPayload = {
   value: PipelineApprovalPolicyValue;
+  // The minimum number of seconds between the approval of a task and its execution.
+  minHoldDuration?: number;
+  // The multi-step approval of the tasks, only available to the enterprise plan.
+  approvalChain?: ApprovalChain;
+};
+
+export type ApprovalStep = {
+  name: string;
+  role: RoleType;
+};
+
+export type ApprovalChain = {
+  stepList: ApprovalStep[];
 };
 
 export const DefaultApporvalPolicy: PipelineApprovalPolicyValue =
@@ -28,10 +28,54 @@ export type Repository = {
   branchFilter: string;
   filePathTemplate: string;
   schemaPathTemplate: string;
+  duplicateVersionPolicy: DuplicateVersionPolicy;
+  emptyMigrationPolicy: EmptyMigrationPolicy;
+  // The timeout in seconds of each statement of the pushed migrations. 0 means the instance default.
+  migrationStatementTimeout: number;
+  driftAction: DriftAction;
+  providerUserId: string;
+  providerUsername: string;
+  requireSignedCommits: boolean;
+  skipDirective: string;
+  // The branch, tag or commit SHA the schema baseline is read from. Empty means the pushed commit.
+  schemaRef: string;
+  // Commits the schema dump back to the schema path after a migration issued from the UI applies.
+  schemaSnapshotOnApply: boolean;
+  notificationWebhookUrlList: string[];
+  defaultAssigneeId?: number;
   // e.g. In GitLab, this is the corresponding project id.
   externalId: string;
+  webhookStatus: RepositoryWebhookStatus;
+  tokenStatus: RepositoryTokenStatus;
+  providerStatus: RepositoryProviderStatus;
+  syncStatus: RepositorySyncStatus;
+  syncFailureCount: number;
 };
 
+// WEBHOOK_PENDING means the webhook creation failed when linking the repository,
+// and Bytebase keeps retrying it in the background.
+export type RepositoryWebhookStatus = "WEBHOOK_PENDING" | "WEBHOOK_ACTIVE";
+
+// TOKEN_INVALID means refreshing the access token failed unrecoverably,
+// and the repository needs to be linked again.
+export type RepositoryTokenStatus = "TOKEN_VALID" | "TOKEN_INVALID";
+
+// PROVIDER_MISSING means the VCS reports the repository not found,
+// e.g. it's deleted or made private, while the project is still linked to it.
+export type RepositoryProviderStatus = "PROVIDER_FOUND" | "PROVIDER_MISSING";
+
+export type RepositorySyncStatus = "ACTIVE" | "QUARANTINED";
+
+// How the migration version pushed again with different content is resolved, e.g. the same version on two branches.
+// ERROR rejects it, LATEST_WINS applies the most recent commit, and BRANCH_SCOPED namespaces the versions per branch.
+export type DuplicateVersionPolicy = "ERROR" | "LATEST_WINS" | "BRANCH_SCOPED";
+
+export type EmptyMigrationPolicy = "ERROR" | "SKIP" | "ALLOW";
+
+// How the schema drift detected on the databases of the project is responded.
+// ANOMALY_ONLY reports the anomaly, and CREATE_ISSUE also creates an issue tracking the remediation.
+export type DriftAction = "ANOMALY_ONLY" | "CREATE_ISSUE";
+
 export type RepositoryCreate = {
   // Related fields
   vcsId: VCSId;
@@ -45,9 +89,11 @@ export type RepositoryCreate = {
   filePathTemplate: string;
   schemaPathTemplate: string;
   externalId: string;
-  accessToken: string;
-  expiresTs: number;
-  refreshToken: string;
+  // oauthTicket is issued by the server for the verified OAuth token exchange,
+  // the server links the repository with the exchanged token.
+  oauthTicket: string;
+  allowPendingWebhook?: boolean;
+  preserveMigrationHistory?: boolean;
 };
 
 export type RepositoryPatch = {
@@ -55,6 +101,19 @@ export type RepositoryPatch = {
   branchFilter?: string;
   filePathTemplate?: string;
   schemaPathTemplate?: string;
+  duplicateVersionPolicy?: DuplicateVersionPolicy;
+  emptyMigrationPolicy?: EmptyMigrationPolicy;
+  migrationStatementTimeout?: number;
+  driftAction?: DriftAction;
+  requireSignedCommits?: boolean;
+  skipDirective?: string;
+  schemaRef?: string;
+  schemaSnapshotOnApply?: boolean;
+  // Only ACTIVE is accepted, to un-quarantine the repository.
+  syncStatus?: RepositorySyncStatus;
+  // Comma separated URLs.
+  notificationWebhookUrlList?: string;
+  defaultAssigneeId?: number;
 };
 
 export type RepositoryConfig = {
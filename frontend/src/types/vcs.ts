@@ -57,6 +57,7 @@ export type VCSFileCommit = {
   createdTs: number;
   url: string;
   authorName: string;
+  authorEmail: string;
   added: string;
 };
 
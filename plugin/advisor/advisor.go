@@ -55,6 +55,18 @@ type Advice struct {
 	Content string
 }
 
+// RequiresExtraApproval returns true if the advices of the migration compatibility advisor contain any destructive
+// operation, i.e. DROP DATABASE, DROP TABLE or DROP COLUMN, which requires an extra approval regardless of the approval policy.
+func RequiresExtraApproval(adviceList []Advice) bool {
+	for _, advice := range adviceList {
+		switch advice.Code {
+		case common.CompatibilityDropDatabase, common.CompatibilityDropTable, common.CompatibilityDropColumn:
+			return true
+		}
+	}
+	return false
+}
+
 // Context is the context for advisor.
 type Context struct {
 	Logger    *zap.Logger
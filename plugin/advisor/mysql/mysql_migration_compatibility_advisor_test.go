@@ -335,3 +335,43 @@ func TestAlterTableChangeColumnType(t *testing.T) {
 
 	runTests(t, tests)
 }
+
+func TestRequiresExtraApproval(t *testing.T) {
+	tests := []struct {
+		statement string
+		want      bool
+	}{
+		{
+			statement: "DROP TABLE t1",
+			want:      true,
+		},
+		{
+			statement: "ALTER TABLE t1 DROP COLUMN c1",
+			want:      true,
+		},
+		{
+			statement: "CREATE TABLE t2 (id INT); ALTER TABLE t1 ADD COLUMN c2 INT",
+			want:      false,
+		},
+		{
+			// Incompatible but not destructive.
+			statement: "ALTER TABLE t1 RENAME COLUMN c1 TO c2",
+			want:      false,
+		},
+	}
+
+	adv := CompatibilityAdvisor{}
+	ctx := advisor.Context{
+		Logger: zap.NewNop(),
+	}
+	for _, tc := range tests {
+		adviceList, err := adv.Check(ctx, tc.statement)
+		if err != nil {
+			t.Errorf("statement=%s: expected no error, got %v", tc.statement, err)
+			continue
+		}
+		if got := advisor.RequiresExtraApproval(adviceList); got != tc.want {
+			t.Errorf("statement=%s: expected RequiresExtraApproval %v, got %v", tc.statement, tc.want, got)
+		}
+	}
+}
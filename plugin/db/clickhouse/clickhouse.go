@@ -409,6 +409,20 @@ func (driver *Driver) SetupMigrationIfNeeded(ctx context.Context) error {
 	return nil
 }
 
+// DeleteFailedHistory will delete the FAILED migration record of the version.
+func (Driver) DeleteFailedHistory(ctx context.Context, tx *sql.Tx, namespace string, source db.MigrationSource, version string) error {
+	const deleteFailedHistoryQuery = `
+		ALTER TABLE
+			bytebase.migration_history
+		DELETE
+		WHERE namespace = $1 AND source = $2 AND version = $3 AND status = 'FAILED'
+	`
+	if _, err := tx.ExecContext(ctx, deleteFailedHistoryQuery, namespace, source.String(), version); err != nil {
+		return util.FormatErrorWithQuery(err, deleteFailedHistoryQuery)
+	}
+	return nil
+}
+
 // CheckDuplicateVersion will check whether the version is already applied.
 func (Driver) CheckDuplicateVersion(ctx context.Context, tx *sql.Tx, namespace string, source db.MigrationSource, version string) (bool, error) {
 	const checkDuplicateVersionQuery = `
@@ -9,6 +9,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/bytebase/bytebase/plugin/vcs"
 	"go.uber.org/zap"
@@ -187,6 +188,22 @@ func (e MigrationType) String() string {
 	return "UNKNOWN"
 }
 
+// TemplateToken returns the value of the {{TYPE}} token in the file path template for the migration type.
+func (e MigrationType) TemplateToken() string {
+	return strings.ToLower(string(e))
+}
+
+// ParseMigrationType parses the migration type from the value of the {{TYPE}} token in the file path template,
+// e.g. "migrate" for MIGRATE. The value is case-insensitive.
+func ParseMigrationType(s string) (MigrationType, error) {
+	for _, migrationType := range []MigrationType{Baseline, Migrate, Branch, Data} {
+		if strings.EqualFold(s, migrationType.TemplateToken()) {
+			return migrationType, nil
+		}
+	}
+	return "", fmt.Errorf("invalid migration type %q, must be 'baseline', 'migrate', 'data' or 'branch'", s)
+}
+
 // MigrationStatus is the status of migration.
 type MigrationStatus string
 
@@ -231,22 +248,32 @@ type MigrationInfo struct {
 	IssueID        string
 	Payload        string
 	CreateDatabase bool
+	// ReplaceFailedHistory replaces the FAILED migration history of the version, e.g. left by the failed attempt of the retried task,
+	// instead of failing the migration as already applied.
+	ReplaceFailedHistory bool
+	// StatementTimeout aborts each statement of the migration running longer than it on the engines supporting it, e.g. MySQL and Postgres.
+	// 0 means the instance default.
+	StatementTimeout time.Duration
 }
 
+// filePathPlaceholderList is the placeholders of the file path template, each matching filePathPlaceholderPattern.
+var filePathPlaceholderList = []string{
+	"ENV_NAME",
+	"VERSION",
+	"DB_NAME",
+	"TYPE",
+	"DESCRIPTION",
+}
+
+const filePathPlaceholderPattern = "[a-zA-Z0-9+-=/_#?!$. ]+"
+
 // ParseMigrationInfo matches filePath against filePathTemplate
 // If filePath matches, then it will derive MigrationInfo from the filePath.
 // Both filePath and filePathTemplate are the full file path (including the base directory) of the repository.
 func ParseMigrationInfo(filePath string, filePathTemplate string) (*MigrationInfo, error) {
-	placeholderList := []string{
-		"ENV_NAME",
-		"VERSION",
-		"DB_NAME",
-		"TYPE",
-		"DESCRIPTION",
-	}
 	filePathRegex := filePathTemplate
-	for _, placeholder := range placeholderList {
-		filePathRegex = strings.ReplaceAll(filePathRegex, fmt.Sprintf("{{%s}}", placeholder), fmt.Sprintf("(?P<%s>[a-zA-Z0-9+-=/_#?!$. ]+)", placeholder))
+	for _, placeholder := range filePathPlaceholderList {
+		filePathRegex = strings.ReplaceAll(filePathRegex, fmt.Sprintf("{{%s}}", placeholder), fmt.Sprintf("(?P<%s>%s)", placeholder, filePathPlaceholderPattern))
 	}
 	myRegex, err := regexp.Compile(filePathRegex)
 	if err != nil {
@@ -261,7 +288,7 @@ func ParseMigrationInfo(filePath string, filePathTemplate string) (*MigrationInf
 		Type:   Migrate,
 	}
 	matchList := myRegex.FindStringSubmatch(filePath)
-	for _, placeholder := range placeholderList {
+	for _, placeholder := range filePathPlaceholderList {
 		index := myRegex.SubexpIndex(placeholder)
 		if index >= 0 {
 			switch placeholder {
@@ -273,16 +300,15 @@ func ParseMigrationInfo(filePath string, filePathTemplate string) (*MigrationInf
 				mi.Namespace = matchList[index]
 				mi.Database = matchList[index]
 			case "TYPE":
-				switch matchList[index] {
-				case "baseline":
-					mi.Type = Baseline
-				case "data":
-					mi.Type = Data
-				case "migrate":
-					mi.Type = Migrate
-				default:
-					return nil, fmt.Errorf("file path %q contains invalid migration type %q, must be 'baseline', 'migrate' or 'data'", filePath, matchList[index])
+				migrationType, err := ParseMigrationType(matchList[index])
+				if err != nil {
+					return nil, fmt.Errorf("file path %q contains invalid migration type: %w", filePath, err)
+				}
+				// The branch migrations are created by restoring the backups, and can't be committed.
+				if migrationType == Branch {
+					return nil, fmt.Errorf("file path %q contains migration type %q, which can't be committed, must be 'baseline', 'migrate' or 'data'", filePath, matchList[index])
 				}
+				mi.Type = migrationType
 			case "DESCRIPTION":
 				mi.Description = matchList[index]
 			}
@@ -180,6 +180,31 @@ func TestParseMigrationInfo(t *testing.T) {
 			},
 			wantErr: "",
 		},
+		{
+			filePath:         "db_shop1__001foo__DATA",
+			filePathTemplate: "{{DB_NAME}}__{{VERSION}}__{{TYPE}}",
+			want: MigrationInfo{
+				Version:     "001foo",
+				Namespace:   "db_shop1",
+				Database:    "db_shop1",
+				Environment: "",
+				Source:      VCS,
+				Type:        Data,
+				Description: "Create db_shop1 data change",
+				Creator:     "",
+			},
+			wantErr: "",
+		},
+		{
+			filePath:         "db_shop1__001foo__ddl",
+			filePathTemplate: "{{DB_NAME}}__{{VERSION}}__{{TYPE}}",
+			wantErr:          "invalid migration type",
+		},
+		{
+			filePath:         "db_shop1__001foo__branch",
+			filePathTemplate: "{{DB_NAME}}__{{VERSION}}__{{TYPE}}",
+			wantErr:          "can't be committed",
+		},
 		{
 			filePath:         "db",
 			filePathTemplate: "{{DB_NAME}}__{{VERSION}}",
@@ -198,6 +223,10 @@ func TestParseMigrationInfo(t *testing.T) {
 
 	for _, tc := range tests {
 		mi, err := ParseMigrationInfo(tc.filePath, tc.filePathTemplate)
+		if err == nil && tc.wantErr != "" {
+			t.Errorf("filePath=%s, filePathTemplate=%s: expected error %s, got %+v", tc.filePath, tc.filePathTemplate, tc.wantErr, *mi)
+			continue
+		}
 		if err != nil {
 			if tc.wantErr == "" {
 				t.Errorf("filePath=%s, filePathTemplate=%s: expected no error, got %v", tc.filePath, tc.filePathTemplate, err)
@@ -212,3 +241,40 @@ func TestParseMigrationInfo(t *testing.T) {
 
 	}
 }
+
+func TestParseMigrationType(t *testing.T) {
+	tests := []struct {
+		token   string
+		want    MigrationType
+		wantErr bool
+	}{
+		{token: "baseline", want: Baseline},
+		{token: "migrate", want: Migrate},
+		{token: "data", want: Data},
+		{token: "branch", want: Branch},
+		{token: "MIGRATE", want: Migrate},
+		{token: "ddl", wantErr: true},
+		{token: "", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		migrationType, err := ParseMigrationType(tc.token)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("token=%s: expected error, got %s", tc.token, migrationType)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("token=%s: expected no error, got %v", tc.token, err)
+			continue
+		}
+		if migrationType != tc.want {
+			t.Errorf("token=%s: expected %s, got %s", tc.token, tc.want, migrationType)
+		}
+		// The template token round-trips.
+		if got, err := ParseMigrationType(migrationType.TemplateToken()); err != nil || got != migrationType {
+			t.Errorf("token=%s: expected %s from template token %s, got %s, %v", tc.token, migrationType, migrationType.TemplateToken(), got, err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// MatchDiagnosis explains where the file path diverges from the file path template.
+type MatchDiagnosis struct {
+	Matched bool `json:"matched"`
+	// SegmentIndex is the index of the first "/" separated segment of the file path diverging from the template, -1 if matched.
+	SegmentIndex int `json:"segmentIndex"`
+	// ExpectedSegment is the template segment at the divergence, empty if the file path has more segments than the template.
+	ExpectedSegment string `json:"expectedSegment"`
+	// ActualSegment is the file path segment at the divergence, empty if the file path has fewer segments than the template.
+	ActualSegment string `json:"actualSegment"`
+	// Token is the placeholder failing to match, e.g. "{{VERSION}}". It's empty if the literal part of the template fails.
+	Token string `json:"token"`
+	// Expected is the part of the template segment failing to match, i.e. the placeholder or the literal text.
+	Expected string `json:"expected"`
+	// Actual is the part of the file path segment failing to match if it can be told, e.g. the invalid migration type
+	// or the trailing text.
+	Actual string `json:"actual"`
+	// Reason explains the divergence, empty if matched.
+	Reason string `json:"reason"`
+}
+
+var filePathPlaceholderRegex = regexp.MustCompile(`\{\{(` + strings.Join(filePathPlaceholderList, "|") + `)\}\}`)
+
+// templateElement is either a placeholder or the literal text between the placeholders of a template segment.
+type templateElement struct {
+	// placeholder is the placeholder name, e.g. "VERSION", empty for the literal text.
+	placeholder string
+	text        string
+}
+
+func (e templateElement) pattern() string {
+	if e.placeholder != "" {
+		return fmt.Sprintf("(?P<%s>%s)", e.placeholder, filePathPlaceholderPattern)
+	}
+	return regexp.QuoteMeta(e.text)
+}
+
+func splitTemplateSegment(segment string) []templateElement {
+	var elementList []templateElement
+	start := 0
+	for _, loc := range filePathPlaceholderRegex.FindAllStringSubmatchIndex(segment, -1) {
+		if loc[0] > start {
+			elementList = append(elementList, templateElement{text: segment[start:loc[0]]})
+		}
+		elementList = append(elementList, templateElement{placeholder: segment[loc[2]:loc[3]], text: segment[loc[0]:loc[1]]})
+		start = loc[1]
+	}
+	if start < len(segment) {
+		elementList = append(elementList, templateElement{text: segment[start:]})
+	}
+	return elementList
+}
+
+func joinTemplateElements(elementList []templateElement) (string, string) {
+	var text, pattern strings.Builder
+	for _, element := range elementList {
+		text.WriteString(element.text)
+		pattern.WriteString(element.pattern())
+	}
+	return text.String(), pattern.String()
+}
+
+// DiagnoseMatch explains whether the file path matches the file path template under the base directory the same way as
+// ParseMigrationInfo, and otherwise where the file path diverges from the template, i.e. the first diverging segment
+// and the placeholder or the literal text failing to match in the segment.
+// Returns error if the template is invalid.
+func DiagnoseMatch(tmpl string, baseDir string, filePath string) (*MatchDiagnosis, error) {
+	filePathTemplate := filepath.Join(baseDir, tmpl)
+	_, parseErr := ParseMigrationInfo(filePath, filePathTemplate)
+	if parseErr == nil {
+		return &MatchDiagnosis{Matched: true, SegmentIndex: -1}, nil
+	}
+	templateRegex := filePathTemplate
+	for _, placeholder := range filePathPlaceholderList {
+		templateRegex = strings.ReplaceAll(templateRegex, fmt.Sprintf("{{%s}}", placeholder), filePathPlaceholderPattern)
+	}
+	if _, err := regexp.Compile(templateRegex); err != nil {
+		return nil, fmt.Errorf("invalid file path template: %q", filePathTemplate)
+	}
+
+	templateSegmentList := strings.Split(filePathTemplate, "/")
+	pathSegmentList := strings.Split(filePath, "/")
+	for i := 0; i < len(templateSegmentList) || i < len(pathSegmentList); i++ {
+		diagnosis := &MatchDiagnosis{SegmentIndex: i}
+		if i >= len(templateSegmentList) {
+			diagnosis.ActualSegment = pathSegmentList[i]
+			diagnosis.Actual = pathSegmentList[i]
+			diagnosis.Reason = fmt.Sprintf("unexpected segment %q after the last template segment %q", pathSegmentList[i], templateSegmentList[len(templateSegmentList)-1])
+			return diagnosis, nil
+		}
+		diagnosis.ExpectedSegment = templateSegmentList[i]
+		if i >= len(pathSegmentList) {
+			diagnosis.Expected = templateSegmentList[i]
+			diagnosis.Reason = fmt.Sprintf("file path ends before the template segment %q", templateSegmentList[i])
+			return diagnosis, nil
+		}
+		diagnosis.ActualSegment = pathSegmentList[i]
+		if diagnoseSegment(diagnosis, splitTemplateSegment(templateSegmentList[i]), pathSegmentList[i]) {
+			return diagnosis, nil
+		}
+	}
+	// Every segment matches on its own, e.g. the template lacks the required placeholder.
+	return &MatchDiagnosis{SegmentIndex: -1, Reason: parseErr.Error()}, nil
+}
+
+// diagnoseSegment fills the divergence of the path segment from the template segment in diagnosis.
+// Returns false if the segment matches.
+func diagnoseSegment(diagnosis *MatchDiagnosis, elementList []templateElement, segment string) bool {
+	// Find the first element failing to extend the matched prefix.
+	for k := 1; k <= len(elementList); k++ {
+		_, pattern := joinTemplateElements(elementList[:k])
+		if regexp.MustCompile("^" + pattern).MatchString(segment) {
+			continue
+		}
+		failed := elementList[k-1]
+		diagnosis.Expected = failed.text
+		if failed.placeholder != "" {
+			diagnosis.Token = failed.text
+		}
+		if k == 1 {
+			diagnosis.Reason = fmt.Sprintf("segment %q doesn't start with %q of template segment %q", segment, failed.text, diagnosis.ExpectedSegment)
+		} else {
+			matchedText, _ := joinTemplateElements(elementList[:k-1])
+			diagnosis.Reason = fmt.Sprintf("segment %q doesn't have %q after %q of template segment %q", segment, failed.text, matchedText, diagnosis.ExpectedSegment)
+		}
+		return true
+	}
+
+	_, pattern := joinTemplateElements(elementList)
+	segmentRegex := regexp.MustCompile("^" + pattern + "$")
+	matchList := segmentRegex.FindStringSubmatch(segment)
+	if matchList == nil {
+		prefix := regexp.MustCompile("^" + pattern).FindString(segment)
+		diagnosis.Actual = segment[len(prefix):]
+		diagnosis.Reason = fmt.Sprintf("segment %q has unexpected trailing %q after template segment %q", segment, diagnosis.Actual, diagnosis.ExpectedSegment)
+		return true
+	}
+
+	// The migration type is validated beyond its pattern.
+	if index := segmentRegex.SubexpIndex("TYPE"); index >= 0 {
+		value := matchList[index]
+		migrationType, err := ParseMigrationType(value)
+		if err == nil && migrationType == Branch {
+			err = fmt.Errorf("migration type %q can't be committed, must be 'baseline', 'migrate' or 'data'", value)
+		}
+		if err != nil {
+			diagnosis.Token = "{{TYPE}}"
+			diagnosis.Expected = "{{TYPE}}"
+			diagnosis.Actual = value
+			diagnosis.Reason = fmt.Sprintf("segment %q has invalid {{TYPE}}: %s", segment, err.Error())
+			return true
+		}
+	}
+	return false
+}
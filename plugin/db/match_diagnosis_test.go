@@ -0,0 +1,109 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiagnoseMatch(t *testing.T) {
+	const (
+		tmpl    = "{{ENV_NAME}}/{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql"
+		baseDir = "bytebase"
+		segment = "{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql"
+	)
+	tests := []struct {
+		name     string
+		filePath string
+		want     *MatchDiagnosis
+	}{
+		{
+			name:     "matched",
+			filePath: "bytebase/dev/blog__202101131000__migrate__add_users.sql",
+			want:     &MatchDiagnosis{Matched: true, SegmentIndex: -1},
+		},
+		{
+			name:     "missing separator",
+			filePath: "bytebase/dev/blog_202101131000__migrate__add_users.sql",
+			want: &MatchDiagnosis{
+				SegmentIndex:    2,
+				ExpectedSegment: segment,
+				ActualSegment:   "blog_202101131000__migrate__add_users.sql",
+				Expected:        "__",
+				Reason:          `segment "blog_202101131000__migrate__add_users.sql" doesn't have "__" after "{{DB_NAME}}__{{VERSION}}__{{TYPE}}" of template segment "{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql"`,
+			},
+		},
+		{
+			name:     "invalid version",
+			filePath: "bytebase/dev/blog__@202101131000__migrate__add_users.sql",
+			want: &MatchDiagnosis{
+				SegmentIndex:    2,
+				ExpectedSegment: segment,
+				ActualSegment:   "blog__@202101131000__migrate__add_users.sql",
+				Token:           "{{VERSION}}",
+				Expected:        "{{VERSION}}",
+				Reason:          `segment "blog__@202101131000__migrate__add_users.sql" doesn't have "{{VERSION}}" after "{{DB_NAME}}__" of template segment "{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql"`,
+			},
+		},
+		{
+			name:     "wrong extension",
+			filePath: "bytebase/dev/blog__202101131000__migrate__add_users.txt",
+			want: &MatchDiagnosis{
+				SegmentIndex:    2,
+				ExpectedSegment: segment,
+				ActualSegment:   "blog__202101131000__migrate__add_users.txt",
+				Expected:        ".sql",
+				Reason:          `segment "blog__202101131000__migrate__add_users.txt" doesn't have ".sql" after "{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}" of template segment "{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql"`,
+			},
+		},
+		{
+			// Same as ParseMigrationInfo, the trailing text after the template is allowed.
+			name:     "trailing text",
+			filePath: "bytebase/dev/blog__202101131000__migrate__add_users.sql.bak",
+			want:     &MatchDiagnosis{Matched: true, SegmentIndex: -1},
+		},
+		{
+			name:     "invalid migration type",
+			filePath: "bytebase/dev/blog__202101131000__branch__add_users.sql",
+			want: &MatchDiagnosis{
+				SegmentIndex:    2,
+				ExpectedSegment: segment,
+				ActualSegment:   "blog__202101131000__branch__add_users.sql",
+				Token:           "{{TYPE}}",
+				Expected:        "{{TYPE}}",
+				Actual:          "branch",
+				Reason:          `segment "blog__202101131000__branch__add_users.sql" has invalid {{TYPE}}: migration type "branch" can't be committed, must be 'baseline', 'migrate' or 'data'`,
+			},
+		},
+		{
+			name:     "wrong base directory",
+			filePath: "migrations/dev/blog__202101131000__migrate__add_users.sql",
+			want: &MatchDiagnosis{
+				SegmentIndex:    0,
+				ExpectedSegment: "bytebase",
+				ActualSegment:   "migrations",
+				Expected:        "bytebase",
+				Reason:          `segment "migrations" doesn't start with "bytebase" of template segment "bytebase"`,
+			},
+		},
+		{
+			name:     "missing environment directory",
+			filePath: "bytebase/blog__202101131000__migrate__add_users.sql",
+			want: &MatchDiagnosis{
+				SegmentIndex:    2,
+				ExpectedSegment: segment,
+				Expected:        segment,
+				Reason:          `file path ends before the template segment "{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql"`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		diagnosis, err := DiagnoseMatch(tmpl, baseDir, test.filePath)
+		if err != nil {
+			t.Fatalf("%q: DiagnoseMatch() got error %v, want OK.", test.name, err)
+		}
+		if !reflect.DeepEqual(diagnosis, test.want) {
+			t.Errorf("%q: DiagnoseMatch() got %+v, want %+v.", test.name, diagnosis, test.want)
+		}
+	}
+}
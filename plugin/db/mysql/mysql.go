@@ -8,6 +8,7 @@ import (
 	"io"
 	"regexp"
 	"strings"
+	"time"
 
 	// embed will embeds the migration schema.
 	_ "embed"
@@ -542,6 +543,26 @@ func (driver *Driver) Execute(ctx context.Context, statement string, useTransact
 	return err
 }
 
+// ExecuteWithStatementTimeout executes the statement in a single transaction, and kills the statement running longer than statementTimeout
+// with KILL QUERY, since cancelling the context doesn't stop the statement, e.g. the DDL, running on the server.
+func (driver *Driver) ExecuteWithStatementTimeout(ctx context.Context, statement string, statementTimeout time.Duration) error {
+	conn, err := driver.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var connectionID int64
+	if err := conn.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&connectionID); err != nil {
+		return err
+	}
+	return util.ExecuteWithQueryKiller(ctx, conn, statement, statementTimeout, func() error {
+		// The query is killed from another connection of the pool, since the connection executing the statement is busy.
+		_, err := driver.db.ExecContext(context.Background(), fmt.Sprintf("KILL QUERY %d", connectionID))
+		return err
+	})
+}
+
 // Query queries a SQL statement.
 func (driver *Driver) Query(ctx context.Context, statement string, limit int) ([]interface{}, error) {
 	return util.Query(ctx, driver.l, driver.db, statement, limit)
@@ -590,6 +611,18 @@ func (driver *Driver) SetupMigrationIfNeeded(ctx context.Context) error {
 	return nil
 }
 
+// DeleteFailedHistory will delete the FAILED migration record of the version.
+func (Driver) DeleteFailedHistory(ctx context.Context, tx *sql.Tx, namespace string, source db.MigrationSource, version string) error {
+	const deleteFailedHistoryQuery = `
+		DELETE FROM bytebase.migration_history
+		WHERE namespace = ? AND source = ? AND version = ? AND status = 'FAILED'
+	`
+	if _, err := tx.ExecContext(ctx, deleteFailedHistoryQuery, namespace, source.String(), version); err != nil {
+		return util.FormatErrorWithQuery(err, deleteFailedHistoryQuery)
+	}
+	return nil
+}
+
 // CheckDuplicateVersion will check whether the version is already applied.
 func (Driver) CheckDuplicateVersion(ctx context.Context, tx *sql.Tx, namespace string, source db.MigrationSource, version string) (bool, error) {
 	const checkDuplicateVersionQuery = `
@@ -400,6 +400,25 @@ func (driver *Driver) Execute(ctx context.Context, statement string, useTransact
 	return err
 }
 
+// ExecuteWithStatementTimeout executes the statement in a single transaction, and the statement running longer than statementTimeout
+// is aborted by the server with statement_timeout.
+func (driver *Driver) ExecuteWithStatementTimeout(ctx context.Context, statement string, statementTimeout time.Duration) error {
+	tx, err := driver.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// SET LOCAL lasts until the end of the transaction, so the timeout doesn't apply to the other statements sharing the connection.
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", statementTimeout.Milliseconds())); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, statement); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 // Query queries a SQL statement.
 func (driver *Driver) Query(ctx context.Context, statement string, limit int) ([]interface{}, error) {
 	return util.Query(ctx, driver.l, driver.db, statement, limit)
@@ -502,6 +521,18 @@ func (driver *Driver) SetupMigrationIfNeeded(ctx context.Context) error {
 	return nil
 }
 
+// DeleteFailedHistory will delete the FAILED migration record of the version.
+func (Driver) DeleteFailedHistory(ctx context.Context, tx *sql.Tx, namespace string, source db.MigrationSource, version string) error {
+	const deleteFailedHistoryQuery = `
+		DELETE FROM migration_history
+		WHERE namespace = $1 AND source = $2 AND version = $3 AND status = 'FAILED'
+	`
+	if _, err := tx.ExecContext(ctx, deleteFailedHistoryQuery, namespace, source.String(), version); err != nil {
+		return util.FormatErrorWithQuery(err, deleteFailedHistoryQuery)
+	}
+	return nil
+}
+
 // CheckDuplicateVersion will check whether the version is already applied.
 func (Driver) CheckDuplicateVersion(ctx context.Context, tx *sql.Tx, namespace string, source db.MigrationSource, version string) (bool, error) {
 	const checkDuplicateVersionQuery = `
@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/db"
+	_ "github.com/mattn/go-sqlite3"
+	"go.uber.org/zap"
+)
+
+func TestExecuteMigrationReplaceFailedHistory(t *testing.T) {
+	ctx := context.Background()
+	driver, err := newDriver(db.DriverConfig{Logger: zap.NewNop()}).Open(ctx, db.SQLite, db.ConnectionConfig{Host: t.TempDir()}, db.ConnectionContext{})
+	if err != nil {
+		t.Fatalf("Open() got error %v, want OK.", err)
+	}
+	defer driver.Close(ctx)
+	if err := driver.SetupMigrationIfNeeded(ctx); err != nil {
+		t.Fatalf("SetupMigrationIfNeeded() got error %v, want OK.", err)
+	}
+	newMigrationInfo := func(migrationType db.MigrationType, version string) *db.MigrationInfo {
+		return &db.MigrationInfo{
+			Version:   version,
+			Namespace: "blog",
+			Database:  "blog",
+			Source:    db.VCS,
+			Type:      migrationType,
+		}
+	}
+	baseline := newMigrationInfo(db.Baseline, "0001")
+	baseline.CreateDatabase = true
+	if _, _, err := driver.ExecuteMigration(ctx, baseline, "CREATE DATABASE 'blog';"); err != nil {
+		t.Fatalf("ExecuteMigration() of the baseline got error %v, want OK.", err)
+	}
+
+	// The first attempt fails, e.g. by a lock timeout, leaving the FAILED migration history.
+	if _, _, err := driver.ExecuteMigration(ctx, newMigrationInfo(db.Migrate, "0002"), "CREATE TABLE post (id INT);\nINSERT INTO missing VALUES (1);"); err == nil {
+		t.Fatalf("ExecuteMigration() of the failing statement got OK, want error.")
+	}
+
+	// Running the version again without replacing the FAILED history fails as already applied.
+	const statement = "CREATE TABLE post (id INT);"
+	_, _, err = driver.ExecuteMigration(ctx, newMigrationInfo(db.Migrate, "0002"), statement)
+	if common.ErrorCode(err) != common.MigrationAlreadyApplied {
+		t.Fatalf("ExecuteMigration() without replacing the failed history got error %v, want %v.", err, common.MigrationAlreadyApplied)
+	}
+
+	// The retry replaces the FAILED history and applies the version.
+	retry := newMigrationInfo(db.Migrate, "0002")
+	retry.ReplaceFailedHistory = true
+	if _, _, err := driver.ExecuteMigration(ctx, retry, statement); err != nil {
+		t.Fatalf("ExecuteMigration() of the retry got error %v, want OK.", err)
+	}
+	version := "0002"
+	historyList, err := driver.FindMigrationHistoryList(ctx, &db.MigrationHistoryFind{Database: &baseline.Database, Version: &version})
+	if err != nil {
+		t.Fatalf("FindMigrationHistoryList() got error %v, want OK.", err)
+	}
+	if len(historyList) != 1 || historyList[0].Status != db.Done {
+		t.Errorf("FindMigrationHistoryList() got %d histories of version 0002, want a single DONE one.", len(historyList))
+	}
+
+	// The applied version isn't replaced.
+	_, _, err = driver.ExecuteMigration(ctx, retry, statement)
+	if common.ErrorCode(err) != common.MigrationAlreadyApplied {
+		t.Errorf("ExecuteMigration() of the applied version got error %v, want %v.", err, common.MigrationAlreadyApplied)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bytebase/bytebase/common"
@@ -112,6 +113,8 @@ func NeedsSetupMigrationSchema(ctx context.Context, sqldb *sql.DB, query string)
 // MigrationExecutor is an adapter for ExecuteMigration().
 type MigrationExecutor interface {
 	db.Driver
+	// DeleteFailedHistory will delete the FAILED migration record of the version.
+	DeleteFailedHistory(ctx context.Context, tx *sql.Tx, namespace string, source db.MigrationSource, version string) error
 	// CheckDuplicateVersion will check whether the version is already applied.
 	CheckDuplicateVersion(ctx context.Context, tx *sql.Tx, namespace string, source db.MigrationSource, version string) (isDuplicate bool, err error)
 	// CheckOutOfOrderVersion will return versions that are higher than the given version.
@@ -173,7 +176,7 @@ func ExecuteMigration(ctx context.Context, l *zap.Logger, executor MigrationExec
 		// MySQL executes DDL in its own transaction, so there is no need to supply a transaction from previous migration history updates.
 		// Also, we don't use transaction for creating databases in Postgres.
 		// https://github.com/bytebase/bytebase/issues/202
-		if err := executor.Execute(ctx, statement, !m.CreateDatabase); err != nil {
+		if err := executeMigrationStatement(ctx, executor, statement, !m.CreateDatabase, m.StatementTimeout); err != nil {
 			return -1, "", formatError(err)
 		}
 	}
@@ -187,6 +190,81 @@ func ExecuteMigration(ctx context.Context, l *zap.Logger, executor MigrationExec
 	return insertedID, afterSchemaBuf.String(), nil
 }
 
+// statementExecutor executes the statement, which is the part of db.Driver executeMigrationStatement needs.
+type statementExecutor interface {
+	Execute(ctx context.Context, statement string, useTransaction bool) error
+}
+
+// StatementTimeoutExecutor is implemented by the driver able to abort the statement running longer than the timeout on the server.
+type StatementTimeoutExecutor interface {
+	// ExecuteWithStatementTimeout executes the statement in a single transaction, aborting the statement running longer than statementTimeout.
+	ExecuteWithStatementTimeout(ctx context.Context, statement string, statementTimeout time.Duration) error
+}
+
+// executeMigrationStatement executes the migration statement. If statementTimeout is positive and the migration runs in a transaction,
+// the statement running longer than statementTimeout is aborted by the executor implementing StatementTimeoutExecutor.
+// The migration is executed in a single transaction either way, so a failed statement rolls back the statements before it.
+func executeMigrationStatement(ctx context.Context, executor statementExecutor, statement string, useTransaction bool, statementTimeout time.Duration) error {
+	if statementTimeout > 0 && useTransaction {
+		if timeoutExecutor, ok := executor.(StatementTimeoutExecutor); ok {
+			return timeoutExecutor.ExecuteWithStatementTimeout(ctx, statement, statementTimeout)
+		}
+	}
+	return executor.Execute(ctx, statement, useTransaction)
+}
+
+// ExecuteWithQueryKiller executes the statements one by one in a single transaction on conn, so a failed statement rolls back
+// the statements before it. The statement running longer than statementTimeout is aborted by killQuery, e.g. KILL QUERY on MySQL,
+// since cancelling the context doesn't stop the statement running on the server.
+func ExecuteWithQueryKiller(ctx context.Context, conn *sql.Conn, statement string, statementTimeout time.Duration, killQuery func() error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	index := 0
+	// ApplyMultiStatements wraps the error of the statement as a plain error, so the timeout error is returned as is instead.
+	var timeoutErr error
+	sc := bufio.NewScanner(strings.NewReader(statement))
+	if err := ApplyMultiStatements(sc, func(stmt string) error {
+		index++
+		// The mutex makes sure the query is killed before executing the next statement, if the timer fires right after the statement finishes.
+		var mu sync.Mutex
+		done, killed := false, false
+		var killErr error
+		timer := time.AfterFunc(statementTimeout, func() {
+			mu.Lock()
+			defer mu.Unlock()
+			if !done {
+				killed = true
+				killErr = killQuery()
+			}
+		})
+		_, err := tx.ExecContext(ctx, stmt)
+		timer.Stop()
+		mu.Lock()
+		done = true
+		mu.Unlock()
+		if err != nil {
+			if killed {
+				if killErr != nil {
+					err = fmt.Errorf("%w, and failed to kill the query: %v", err, killErr)
+				}
+				timeoutErr = common.Errorf(common.DbExecutionError, fmt.Errorf("statement #%d is aborted for running longer than the statement timeout %v: %w\n\nstatement:\n%q", index, statementTimeout, err, stmt))
+			}
+			return err
+		}
+		return nil
+	}); err != nil {
+		if timeoutErr != nil {
+			return timeoutErr
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
 // beginMigration checks before executing migration and inserts a migration history record with pending status.
 func beginMigration(ctx context.Context, executor MigrationExecutor, m *db.MigrationInfo, prevSchema string, statement string) (insertedID int64, err error) {
 	sqldb, err := executor.GetDbConnection(ctx, bytebaseDatabase)
@@ -200,6 +278,12 @@ func beginMigration(ctx context.Context, executor MigrationExecutor, m *db.Migra
 	defer tx.Rollback()
 
 	// Phase 1 - Precheck before executing migration
+	// The FAILED record of the version is replaced by the new PENDING one within the transaction, otherwise the version is duplicated.
+	if m.ReplaceFailedHistory {
+		if err := executor.DeleteFailedHistory(ctx, tx, m.Namespace, m.Source, m.Version); err != nil {
+			return -1, err
+		}
+	}
 	// Check if the same migration version has alraedy been applied
 	if duplicate, err := executor.CheckDuplicateVersion(ctx, tx, m.Namespace, m.Source, m.Version); err != nil {
 		return -1, err
@@ -0,0 +1,159 @@
+package util
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bytebase/bytebase/common"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// fakeStatementExecutor records the executed statements.
+type fakeStatementExecutor struct {
+	executedList []string
+}
+
+func (e *fakeStatementExecutor) Execute(_ context.Context, statement string, _ bool) error {
+	e.executedList = append(e.executedList, statement)
+	return nil
+}
+
+// fakeStatementTimeoutExecutor records the statements executed with the statement timeout.
+type fakeStatementTimeoutExecutor struct {
+	fakeStatementExecutor
+	timeoutList []time.Duration
+}
+
+func (e *fakeStatementTimeoutExecutor) ExecuteWithStatementTimeout(_ context.Context, statement string, statementTimeout time.Duration) error {
+	e.executedList = append(e.executedList, statement)
+	e.timeoutList = append(e.timeoutList, statementTimeout)
+	return nil
+}
+
+func TestExecuteMigrationStatement(t *testing.T) {
+	ctx := context.Background()
+	statement := "CREATE TABLE t1 (id INT);\nCREATE TABLE t2 (id INT);"
+	tests := []struct {
+		name             string
+		useTransaction   bool
+		statementTimeout time.Duration
+		wantTimeoutList  []time.Duration
+	}{
+		{
+			name:           "without the statement timeout",
+			useTransaction: true,
+		},
+		{
+			name:             "with the statement timeout",
+			useTransaction:   true,
+			statementTimeout: time.Second,
+			wantTimeoutList:  []time.Duration{time.Second},
+		},
+		{
+			name:             "with the statement timeout but no transaction",
+			statementTimeout: time.Second,
+		},
+	}
+
+	for _, test := range tests {
+		executor := &fakeStatementTimeoutExecutor{}
+		if err := executeMigrationStatement(ctx, executor, statement, test.useTransaction, test.statementTimeout); err != nil {
+			t.Fatalf("%q: executeMigrationStatement() got error %v, want OK.", test.name, err)
+		}
+		// The migration is executed as a whole either way.
+		if want := []string{statement}; !reflect.DeepEqual(executor.executedList, want) {
+			t.Errorf("%q: executeMigrationStatement() executed %q, want %q.", test.name, executor.executedList, want)
+		}
+		if !reflect.DeepEqual(executor.timeoutList, test.wantTimeoutList) {
+			t.Errorf("%q: executeMigrationStatement() got statement timeouts %v, want %v.", test.name, executor.timeoutList, test.wantTimeoutList)
+		}
+	}
+
+	// The executor not supporting the statement timeout executes the migration without it.
+	executor := &fakeStatementExecutor{}
+	if err := executeMigrationStatement(ctx, executor, statement, true, time.Second); err != nil {
+		t.Fatalf("executeMigrationStatement() got error %v, want OK.", err)
+	}
+	if want := []string{statement}; !reflect.DeepEqual(executor.executedList, want) {
+		t.Errorf("executeMigrationStatement() executed %q, want %q.", executor.executedList, want)
+	}
+}
+
+func TestExecuteWithQueryKiller(t *testing.T) {
+	ctx := context.Background()
+	sqldb, err := sql.Open("sqlite3", fmt.Sprintf("file:%s", filepath.Join(t.TempDir(), "migration.db")))
+	if err != nil {
+		t.Fatalf("sql.Open() got error %v, want OK.", err)
+	}
+	defer sqldb.Close()
+	tableExists := func(name string) bool {
+		var count int
+		if err := sqldb.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&count); err != nil {
+			t.Fatalf("failed to find table %q, error %v", name, err)
+		}
+		return count > 0
+	}
+	execute := func(ctx context.Context, statement string, killQuery func() error) error {
+		conn, err := sqldb.Conn(context.Background())
+		if err != nil {
+			t.Fatalf("Conn() got error %v, want OK.", err)
+		}
+		defer conn.Close()
+		return ExecuteWithQueryKiller(ctx, conn, statement, 50*time.Millisecond, killQuery)
+	}
+	noKill := func() error {
+		t.Errorf("killQuery() got called, want not.")
+		return nil
+	}
+
+	// The failed statement rolls back the statements before it.
+	if err := execute(ctx, "CREATE TABLE t1 (id INT);\nINSERT INTO t1 VALUES (1);\nINSERT INTO missing VALUES (1);", noKill); err == nil {
+		t.Fatalf("ExecuteWithQueryKiller() got OK, want the error of the failed statement.")
+	}
+	if tableExists("t1") {
+		t.Errorf("ExecuteWithQueryKiller() left table t1 created by the statement before the failed one, want rolled back.")
+	}
+
+	// The statements are committed together.
+	if err := execute(ctx, "CREATE TABLE t1 (id INT);\nINSERT INTO t1 VALUES (1);", noKill); err != nil {
+		t.Fatalf("ExecuteWithQueryKiller() got error %v, want OK.", err)
+	}
+	if !tableExists("t1") {
+		t.Errorf("ExecuteWithQueryKiller() got table t1 not created, want created.")
+	}
+
+	// The statement running longer than the statement timeout is killed, rolling back the statements before it.
+	// sqlite interrupts the statement when the context is cancelled, which stands for killing the query on the server.
+	killCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	killed := false
+	longStatement := "CREATE TABLE t2 (id INT);\n" +
+		"WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT COUNT(*) FROM c;\n" +
+		"CREATE TABLE t3 (id INT);"
+	err = execute(killCtx, longStatement, func() error {
+		killed = true
+		cancel()
+		return nil
+	})
+	if err == nil {
+		t.Fatalf("ExecuteWithQueryKiller() got OK, want the statement timeout error.")
+	}
+	if !killed {
+		t.Errorf("ExecuteWithQueryKiller() didn't kill the long statement.")
+	}
+	if common.ErrorCode(err) != common.DbExecutionError {
+		t.Errorf("ExecuteWithQueryKiller() got error code %v, want %v.", common.ErrorCode(err), common.DbExecutionError)
+	}
+	if !strings.Contains(err.Error(), "statement #2") || !strings.Contains(err.Error(), "WITH RECURSIVE") {
+		t.Errorf("ExecuteWithQueryKiller() got error %q, want naming the aborted statement.", err.Error())
+	}
+	if tableExists("t2") || tableExists("t3") {
+		t.Errorf("ExecuteWithQueryKiller() left table t2 or t3 created, want rolled back.")
+	}
+}
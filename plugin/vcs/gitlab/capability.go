@@ -0,0 +1,137 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+)
+
+const (
+	// capabilityTTL is how long the detected capabilities are cached, so the upgraded instance is detected again.
+	capabilityTTL = time.Hour
+)
+
+// minCommitStatusVersion is the earliest GitLab version supporting the commit status API.
+var minCommitStatusVersion = version{major: 8, minor: 1}
+
+// VersionInfo is the API message for the version of the GitLab instance.
+type VersionInfo struct {
+	Version  string `json:"version"`
+	Revision string `json:"revision"`
+}
+
+// version is the major and minor version of the GitLab instance, e.g. 15.2 of "15.2.1-ee".
+type version struct {
+	major int
+	minor int
+}
+
+// parseVersion parses the version told by the GitLab instance, e.g. "15.2.1-ee" and "8.13.0-pre".
+func parseVersion(s string) (version, bool) {
+	partList := strings.SplitN(s, ".", 3)
+	if len(partList) < 2 {
+		return version{}, false
+	}
+	major, err := strconv.Atoi(partList[0])
+	if err != nil {
+		return version{}, false
+	}
+	minor, err := strconv.Atoi(strings.SplitN(partList[1], "-", 2)[0])
+	if err != nil {
+		return version{}, false
+	}
+	return version{major: major, minor: minor}, true
+}
+
+func (v version) less(other version) bool {
+	if v.major != other.major {
+		return v.major < other.major
+	}
+	return v.minor < other.minor
+}
+
+// capabilityDetector detects the capabilities of each GitLab instance from its version, and caches them for capabilityTTL.
+type capabilityDetector struct {
+	mu              sync.Mutex
+	capabilitiesMap map[string]*vcs.Capabilities
+
+	now func() time.Time
+}
+
+// detector is the capability detector shared by all requests to the GitLab instances.
+var detector = newCapabilityDetector()
+
+func newCapabilityDetector() *capabilityDetector {
+	return &capabilityDetector{
+		capabilitiesMap: make(map[string]*vcs.Capabilities),
+		now:             time.Now,
+	}
+}
+
+// get returns a copy of the capabilities of the instance, or nil if they haven't been detected.
+func (d *capabilityDetector) get(instanceURL string) *vcs.Capabilities {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	capabilities, ok := d.capabilitiesMap[instanceURL]
+	if !ok {
+		return nil
+	}
+	copied := *capabilities
+	return &copied
+}
+
+// detect returns the capabilities of the instance, detecting them by the version API if the cached ones are missing or stale.
+// The instance not telling its version, e.g. the version API blocked by a proxy, is assumed to support all capabilities.
+func (d *capabilityDetector) detect(ctx context.Context, oauthCtx *common.OauthContext, instanceURL string) (*vcs.Capabilities, error) {
+	if capabilities := d.get(instanceURL); capabilities != nil && d.now().Sub(time.Unix(capabilities.DetectedTs, 0)) < capabilityTTL {
+		return capabilities, nil
+	}
+
+	code, body, err := httpGet(
+		ctx,
+		instanceURL,
+		"version",
+		&oauthCtx.AccessToken,
+		oauthContext{
+			ClientID:     oauthCtx.ClientID,
+			ClientSecret: oauthCtx.ClientSecret,
+			RefreshToken: oauthCtx.RefreshToken,
+		},
+		oauthCtx.Refresher,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect the version of GitLab instance %s: %w", instanceURL, err)
+	}
+	capabilities := &vcs.Capabilities{
+		CommitStatus: true,
+		DetectedTs:   d.now().Unix(),
+	}
+	if code < 300 {
+		info := &VersionInfo{}
+		if err := json.Unmarshal([]byte(body), info); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal the version of GitLab instance %s: %w", instanceURL, err)
+		}
+		capabilities.Version = info.Version
+		if v, ok := parseVersion(info.Version); ok {
+			capabilities.CommitStatus = !v.less(minCommitStatusVersion)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.capabilitiesMap[instanceURL] = capabilities
+	copied := *capabilities
+	return &copied, nil
+}
+
+// Capabilities returns the capabilities of the GitLab instance detected by the earlier calls, or nil if they haven't been detected.
+func (provider *Provider) Capabilities(instanceURL string) *vcs.Capabilities {
+	return detector.get(instanceURL)
+}
@@ -0,0 +1,140 @@
+package gitlab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"go.uber.org/zap"
+)
+
+func TestSetCommitStatusCapability(t *testing.T) {
+	tests := []struct {
+		name             string
+		versionCode      int
+		versionBody      string
+		wantCommitStatus bool
+	}{
+		{
+			name:             "older version without the commit status API",
+			versionCode:      http.StatusOK,
+			versionBody:      `{"version":"7.14.3","revision":"12d9ee8"}`,
+			wantCommitStatus: false,
+		},
+		{
+			name:             "newer version",
+			versionCode:      http.StatusOK,
+			versionBody:      `{"version":"15.2.1-ee","revision":"4e963fe"}`,
+			wantCommitStatus: true,
+		},
+		{
+			name:             "version not told",
+			versionCode:      http.StatusNotFound,
+			versionBody:      `{"message":"404 Not Found"}`,
+			wantCommitStatus: true,
+		},
+	}
+
+	for _, test := range tests {
+		versionRequests, statusRequests := 0, 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/v4/version":
+				versionRequests++
+				w.WriteHeader(test.versionCode)
+				_, _ = w.Write([]byte(test.versionBody))
+			case "/api/v4/projects/1/statuses/abc123":
+				statusRequests++
+				w.WriteHeader(http.StatusCreated)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop()})
+		oauthCtx := common.OauthContext{AccessToken: "token"}
+		status := vcs.CommitStatus{State: vcs.CommitStateSuccess, Context: "bytebase/schema"}
+		// The unsupported commit status is skipped rather than failing.
+		for i := 0; i < 2; i++ {
+			if err := provider.SetCommitStatus(context.Background(), oauthCtx, server.URL, "1", "abc123", status); err != nil {
+				t.Fatalf("%q: SetCommitStatus() got error %v, want OK.", test.name, err)
+			}
+		}
+		wantStatusRequests := 0
+		if test.wantCommitStatus {
+			wantStatusRequests = 2
+		}
+		if statusRequests != wantStatusRequests {
+			t.Errorf("%q: SetCommitStatus() sent %d commit status requests, want %d.", test.name, statusRequests, wantStatusRequests)
+		}
+		// The capabilities are detected once and cached.
+		if versionRequests != 1 {
+			t.Errorf("%q: got %d version requests, want 1.", test.name, versionRequests)
+		}
+		capabilities := provider.Capabilities(server.URL)
+		if capabilities == nil || capabilities.CommitStatus != test.wantCommitStatus {
+			t.Errorf("%q: Capabilities() got %+v, want commit status %v.", test.name, capabilities, test.wantCommitStatus)
+		}
+		server.Close()
+	}
+}
+
+func TestCapabilityDetectorTTL(t *testing.T) {
+	versionBody := `{"version":"7.14.3"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(versionBody))
+	}))
+	defer server.Close()
+
+	now := time.Unix(1650000000, 0)
+	d := newCapabilityDetector()
+	d.now = func() time.Time { return now }
+	oauthCtx := &common.OauthContext{AccessToken: "token"}
+	if _, err := d.detect(context.Background(), oauthCtx, server.URL); err != nil {
+		t.Fatalf("detect() got error %v, want OK.", err)
+	}
+
+	// The upgraded instance is detected again once the cached capabilities expire.
+	versionBody = `{"version":"15.2.1"}`
+	now = now.Add(capabilityTTL - time.Second)
+	capabilities, err := d.detect(context.Background(), oauthCtx, server.URL)
+	if err != nil {
+		t.Fatalf("detect() got error %v, want OK.", err)
+	}
+	if capabilities.Version != "7.14.3" {
+		t.Errorf("detect() within the TTL got version %q, want the cached %q.", capabilities.Version, "7.14.3")
+	}
+	now = now.Add(time.Second)
+	capabilities, err = d.detect(context.Background(), oauthCtx, server.URL)
+	if err != nil {
+		t.Fatalf("detect() got error %v, want OK.", err)
+	}
+	if capabilities.Version != "15.2.1" || !capabilities.CommitStatus {
+		t.Errorf("detect() after the TTL got %+v, want version %q supporting the commit status.", capabilities, "15.2.1")
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    version
+		wantOK  bool
+	}{
+		{"15.2.1-ee", version{major: 15, minor: 2}, true},
+		{"8.13.0-pre", version{major: 8, minor: 13}, true},
+		{"16.0-rc1", version{major: 16, minor: 0}, true},
+		{"", version{}, false},
+		{"unknown", version{}, false},
+	}
+
+	for _, test := range tests {
+		got, ok := parseVersion(test.version)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("parseVersion(%q) got %v %v, want %v %v.", test.version, got, ok, test.want, test.wantOK)
+		}
+	}
+}
@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bytebase/bytebase/common"
 	"github.com/bytebase/bytebase/plugin/vcs"
@@ -17,9 +19,6 @@ import (
 )
 
 const (
-	// SecretTokenLength is the length of secret token.
-	SecretTokenLength = 16
-
 	maxRetries = 3
 
 	// apiPath is the API path.
@@ -36,27 +35,44 @@ type WebhookType string
 const (
 	// WebhookPush is the webhook type for push.
 	WebhookPush WebhookType = "push"
+	// WebhookTagPush is the webhook type for tag push.
+	WebhookTagPush WebhookType = "tag_push"
+	// WebhookMergeRequest is the webhook type for merge request.
+	WebhookMergeRequest WebhookType = "merge_request"
+
+	// ZeroSHA is the commit SHA GitLab uses for the nonexistent side of a ref change,
+	// e.g. the after SHA of a branch deletion and the before SHA of a branch creation.
+	ZeroSHA = "0000000000000000000000000000000000000000"
+	// TagRefPrefix is the ref prefix of the tags.
+	TagRefPrefix = "refs/tags/"
 )
 
 func (e WebhookType) String() string {
 	switch e {
 	case WebhookPush:
 		return "push"
+	case WebhookTagPush:
+		return "tag_push"
+	case WebhookMergeRequest:
+		return "merge_request"
 	}
 	return "UNKNOWN"
 }
 
 // WebhookInfo is the API message for webhook info.
 type WebhookInfo struct {
-	ID int `json:"id"`
+	ID  int    `json:"id"`
+	URL string `json:"url"`
 }
 
 // WebhookPost is the API message for webhook POST.
 type WebhookPost struct {
 	URL         string `json:"url"`
 	SecretToken string `json:"token"`
-	// This is set to true
+	// This is set to true unless the branch filter is configured for tags.
 	PushEvents bool `json:"push_events"`
+	// This is set to true if the branch filter is configured for tags.
+	TagPushEvents bool `json:"tag_push_events"`
 	// For now, there is no native dry run DDL support in mysql/postgres. One may wonder if we could wrap the DDL
 	// in a transaction and just not commit at the end, unfortunately there are side effects which are hard to control.
 	// See https://www.postgresql.org/message-id/CAMsr%2BYGiYQ7PYvYR2Voio37YdCpp79j5S%2BcmgVJMOLM2LnRQcA%40mail.gmail.com
@@ -70,7 +86,11 @@ type WebhookPost struct {
 
 // WebhookPut is the API message for webhook PUT.
 type WebhookPut struct {
-	URL                    string `json:"url"`
+	URL string `json:"url"`
+	// SecretToken is only set when rotating the secret token.
+	SecretToken            string `json:"token,omitempty"`
+	PushEvents             bool   `json:"push_events"`
+	TagPushEvents          bool   `json:"tag_push_events"`
 	PushEventsBranchFilter string `json:"push_events_branch_filter"`
 }
 
@@ -83,7 +103,8 @@ type WebhookProject struct {
 
 // WebhookCommitAuthor is the API message for webhook commit author.
 type WebhookCommitAuthor struct {
-	Name string `json:"name"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
 }
 
 // WebhookCommit is the API message for webhook commit.
@@ -101,17 +122,97 @@ type WebhookCommit struct {
 type WebhookPushEvent struct {
 	ObjectKind WebhookType     `json:"object_kind"`
 	Ref        string          `json:"ref"`
+	Before     string          `json:"before"`
+	After      string          `json:"after"`
 	AuthorName string          `json:"user_name"`
 	Project    WebhookProject  `json:"project"`
 	CommitList []WebhookCommit `json:"commits"`
 }
 
+// IsRefDeletion returns true if the push event deletes the branch or tag.
+func (e *WebhookPushEvent) IsRefDeletion() bool {
+	return e.After == ZeroSHA
+}
+
+// IsBranchCreation returns true if the push event creates the branch.
+func (e *WebhookPushEvent) IsBranchCreation() bool {
+	return e.ObjectKind == WebhookPush && e.Before == ZeroSHA
+}
+
+// WebhookMergeRequestLastCommit is the API message for the last commit of the merge request in webhook merge request event.
+type WebhookMergeRequestLastCommit struct {
+	ID string `json:"id"`
+}
+
+// WebhookMergeRequestAttributes is the API message for the merge request attributes of webhook merge request event.
+type WebhookMergeRequestAttributes struct {
+	IID          int                           `json:"iid"`
+	SourceBranch string                        `json:"source_branch"`
+	TargetBranch string                        `json:"target_branch"`
+	Action       string                        `json:"action"`
+	LastCommit   WebhookMergeRequestLastCommit `json:"last_commit"`
+}
+
+// WebhookMergeRequestEvent is the API message for webhook merge request event.
+type WebhookMergeRequestEvent struct {
+	ObjectKind       WebhookType                   `json:"object_kind"`
+	Project          WebhookProject                `json:"project"`
+	ObjectAttributes WebhookMergeRequestAttributes `json:"object_attributes"`
+}
+
 // FileCommit is the API message for file commit.
 type FileCommit struct {
 	Branch        string `json:"branch"`
 	Content       string `json:"content"`
 	CommitMessage string `json:"commit_message"`
 	LastCommitID  string `json:"last_commit_id,omitempty"`
+	AuthorName    string `json:"author_name,omitempty"`
+	AuthorEmail   string `json:"author_email,omitempty"`
+}
+
+// CommitAction is the API message for commit action.
+type CommitAction struct {
+	Action   string `json:"action"`
+	FilePath string `json:"file_path"`
+	Content  string `json:"content,omitempty"`
+}
+
+// CommitCreate is the API message for creating a commit with multiple file changes.
+type CommitCreate struct {
+	Branch        string         `json:"branch"`
+	CommitMessage string         `json:"commit_message"`
+	ActionList    []CommitAction `json:"actions"`
+	AuthorName    string         `json:"author_name,omitempty"`
+	AuthorEmail   string         `json:"author_email,omitempty"`
+}
+
+// Commit is the API message for commit.
+type Commit struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Message     string `json:"message"`
+	CreatedAt   string `json:"created_at"`
+	WebURL      string `json:"web_url"`
+	AuthorName  string `json:"author_name"`
+	AuthorEmail string `json:"author_email"`
+}
+
+// CommitFileDiff is the API message for the diff of a file in a commit.
+type CommitFileDiff struct {
+	NewPath string `json:"new_path"`
+	NewFile bool   `json:"new_file"`
+}
+
+// MergeRequestChanges is the API message for the files changed by a merge request.
+type MergeRequestChanges struct {
+	Changes []CommitFileDiff `json:"changes"`
+}
+
+// CommitSignature is the API message for the signature of a commit.
+type CommitSignature struct {
+	SignatureType      string `json:"signature_type"`
+	VerificationStatus string `json:"verification_status"`
+	GPGKeyPrimaryKeyID string `json:"gpg_key_primary_keyid"`
 }
 
 // FileMeta is the API message for file metadata.
@@ -119,6 +220,47 @@ type FileMeta struct {
 	LastCommitID string `json:"last_commit_id"`
 }
 
+// MergeRequestNote is the API message for merge request note.
+type MergeRequestNote struct {
+	ID   int    `json:"id"`
+	Body string `json:"body"`
+}
+
+// MergeRequestNoteCreate is the API message for creating or updating merge request note.
+type MergeRequestNoteCreate struct {
+	Body string `json:"body"`
+}
+
+// Project is the API message for project.
+type Project struct {
+	ID            int    `json:"id"`
+	DefaultBranch string `json:"default_branch"`
+}
+
+// User is the API message for user.
+type User struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+}
+
+// TreeNode is the API message for a node of the repository tree.
+type TreeNode struct {
+	Name string `json:"name"`
+	// Type is "blob" for a file, "tree" for a directory.
+	Type string `json:"type"`
+	Path string `json:"path"`
+}
+
+// CommitStatusCreate is the API message for setting the commit status.
+type CommitStatusCreate struct {
+	State       string `json:"state"`
+	Name        string `json:"name"`
+	TargetURL   string `json:"target_url,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
 // ProjectRole is the role of the project member
 type ProjectRole string
 
@@ -168,12 +310,18 @@ func init() {
 
 // Provider is the GitLab self host provider.
 type Provider struct {
-	l *zap.Logger
+	l           *zap.Logger
+	maxFileSize int64
 }
 
 func newProvider(config vcs.ProviderConfig) vcs.Provider {
+	maxFileSize := config.MaxFileSize
+	if maxFileSize <= 0 {
+		maxFileSize = vcs.DefaultMaxFileSize
+	}
 	return &Provider{
-		l: config.Logger,
+		l:           config.Logger,
+		maxFileSize: maxFileSize,
 	}
 }
 
@@ -182,9 +330,76 @@ func (provider *Provider) APIURL(instanceURL string) string {
 	return fmt.Sprintf("%s/%s", instanceURL, apiPath)
 }
 
+// ExchangeOAuthToken exchanges the OAuth authorization code for a token.
+func (provider *Provider) ExchangeOAuthToken(ctx context.Context, instanceURL string, oauthExchange *vcs.OAuthExchange) (*vcs.OAuthToken, error) {
+	url := fmt.Sprintf("%s/oauth/token", instanceURL)
+	body, err := json.Marshal(oauthExchangeRequest{
+		ClientID:     oauthExchange.ClientID,
+		ClientSecret: oauthExchange.ClientSecret,
+		Code:         oauthExchange.Code,
+		RedirectURI:  oauthExchange.RedirectURL,
+		CodeVerifier: oauthExchange.CodeVerifier,
+		GrantType:    "authorization_code",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct exchange token POST %v (%w)", url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send exchange token POST %v (%w)", url, err)
+	}
+	defer resp.Body.Close()
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body from exchange token POST %v (%w)", url, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to exchange oauth token, response code %v body %s", resp.StatusCode, body)
+	}
+
+	var r refreshOauthResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal body from exchange token POST %v (%w)", url, err)
+	}
+
+	// Same as refreshing, the access token doesn't expire if expires_in is 0.
+	var expireAt int64
+	if r.ExpiresIn != 0 {
+		expireAt = r.CreatedAt + r.ExpiresIn
+	}
+	return &vcs.OAuthToken{
+		AccessToken:  r.AccessToken,
+		RefreshToken: r.RefreshToken,
+		ExpiresTs:    expireAt,
+	}, nil
+}
+
+// RefreshToken refreshes the access token.
+func (provider *Provider) RefreshToken(ctx context.Context, oauthCtx common.OauthContext, instanceURL string) error {
+	return refreshToken(
+		instanceURL,
+		&oauthCtx.AccessToken,
+		oauthContext{
+			ClientID:     oauthCtx.ClientID,
+			ClientSecret: oauthCtx.ClientSecret,
+			RefreshToken: oauthCtx.RefreshToken,
+		},
+		oauthCtx.Refresher,
+	)
+}
+
 // TryLogin will try to login GitLab.
 func (provider *Provider) TryLogin(ctx context.Context, oauthCtx common.OauthContext, instanceURL string) (*vcs.UserInfo, error) {
 	code, body, err := httpGet(
+		ctx,
 		instanceURL,
 		"user",
 		&oauthCtx.AccessToken,
@@ -216,6 +431,41 @@ func (provider *Provider) TryLogin(ctx context.Context, oauthCtx common.OauthCon
 	return UserInfo, err
 }
 
+// CurrentUser fetches the GitLab user the access token belongs to.
+func (provider *Provider) CurrentUser(ctx context.Context, oauthCtx common.OauthContext, instanceURL string) (*vcs.ProviderUser, error) {
+	code, body, err := httpGet(
+		ctx,
+		instanceURL,
+		"user",
+		&oauthCtx.AccessToken,
+		oauthContext{
+			ClientID:     oauthCtx.ClientID,
+			ClientSecret: oauthCtx.ClientSecret,
+			RefreshToken: oauthCtx.RefreshToken,
+		},
+		oauthCtx.Refresher,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the current user from GitLab instance %s: %w", instanceURL, err)
+	}
+	if code == http.StatusUnauthorized {
+		return nil, common.Errorf(common.NotAuthorized, fmt.Errorf("failed to fetch the current user from GitLab instance %s, status code: %d", instanceURL, code))
+	} else if code >= 300 {
+		return nil, fmt.Errorf("failed to fetch the current user from GitLab instance %s, status code: %d", instanceURL, code)
+	}
+
+	user := &User{}
+	if err := json.Unmarshal([]byte(body), user); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the current user from GitLab instance %s: %w", instanceURL, err)
+	}
+	return &vcs.ProviderUser{
+		ID:       strconv.Itoa(user.ID),
+		Username: user.Username,
+		Name:     user.Name,
+		Email:    user.Email,
+	}, nil
+}
+
 func getRoleAndMappedRole(accessLevel int32) (gitLabRole ProjectRole, bytebaseRole common.ProjectRole) {
 	// see https://docs.gitlab.com/ee/api/members.html for the detailed role type at GitLab
 	switch accessLevel {
@@ -241,6 +491,7 @@ func getRoleAndMappedRole(accessLevel int32) (gitLabRole ProjectRole, bytebaseRo
 // FetchRepositoryActiveMemberList fetch all active members of a repository
 func (provider *Provider) FetchRepositoryActiveMemberList(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string) ([]*vcs.RepositoryMember, error) {
 	code, body, err := httpGet(
+		ctx,
 		instanceURL,
 		fmt.Sprintf("projects/%s/members", repositoryID),
 		&oauthCtx.AccessToken,
@@ -295,14 +546,17 @@ func (provider *Provider) CreateFile(ctx context.Context, oauthCtx common.OauthC
 		Branch:        fileCommitCreate.Branch,
 		CommitMessage: fileCommitCreate.CommitMessage,
 		Content:       fileCommitCreate.Content,
+		AuthorName:    fileCommitCreate.Author.Name,
+		AuthorEmail:   fileCommitCreate.Author.Email,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to marshal file commit: %w", err)
 	}
 
 	code, _, err := httpPost(
+		ctx,
 		instanceURL,
-		fmt.Sprintf("projects/%s/repository/files/%s", repositoryID, url.QueryEscape(filePath)),
+		fmt.Sprintf("projects/%s/repository/files/%s", repositoryID, encodeFilePath(filePath)),
 		&oauthCtx.AccessToken,
 		bytes.NewBuffer(body),
 		oauthContext{
@@ -333,14 +587,17 @@ func (provider *Provider) OverwriteFile(ctx context.Context, oauthCtx common.Oau
 		CommitMessage: fileCommitCreate.CommitMessage,
 		Content:       fileCommitCreate.Content,
 		LastCommitID:  fileCommitCreate.LastCommitID,
+		AuthorName:    fileCommitCreate.Author.Name,
+		AuthorEmail:   fileCommitCreate.Author.Email,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to marshal file commit: %w", err)
 	}
 
 	code, _, err := httpPut(
+		ctx,
 		instanceURL,
-		fmt.Sprintf("projects/%s/repository/files/%s", repositoryID, url.QueryEscape(filePath)),
+		fmt.Sprintf("projects/%s/repository/files/%s", repositoryID, encodeFilePath(filePath)),
 		&oauthCtx.AccessToken,
 		bytes.NewBuffer(body),
 		oauthContext{
@@ -364,12 +621,61 @@ func (provider *Provider) OverwriteFile(ctx context.Context, oauthCtx common.Oau
 	return nil
 }
 
+// CreateCommit creates a commit with a list of file changes.
+func (provider *Provider) CreateCommit(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, branch string, message string, fileChangeList []vcs.FileChange, author vcs.Author) (string, error) {
+	commitCreate := CommitCreate{
+		Branch:        branch,
+		CommitMessage: message,
+		AuthorName:    author.Name,
+		AuthorEmail:   author.Email,
+	}
+	for _, fileChange := range fileChangeList {
+		commitCreate.ActionList = append(commitCreate.ActionList, CommitAction{
+			Action:   string(fileChange.Action),
+			FilePath: fileChange.FilePath,
+			Content:  fileChange.Content,
+		})
+	}
+	body, err := json.Marshal(commitCreate)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal commit: %w", err)
+	}
+
+	code, respBody, err := httpPost(
+		ctx,
+		instanceURL,
+		fmt.Sprintf("projects/%s/repository/commits", repositoryID),
+		&oauthCtx.AccessToken,
+		bytes.NewBuffer(body),
+		oauthContext{
+			ClientID:     oauthCtx.ClientID,
+			ClientSecret: oauthCtx.ClientSecret,
+			RefreshToken: oauthCtx.RefreshToken,
+		},
+		oauthCtx.Refresher,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to create commit on branch %s for repository %s from GitLab instance %s: %w", branch, repositoryID, instanceURL, err)
+	}
+	if code >= 300 {
+		return "", fmt.Errorf("failed to create commit on branch %s for repository %s from GitLab instance %s, status code: %d", branch, repositoryID, instanceURL, code)
+	}
+
+	commit := &Commit{}
+	if err := json.Unmarshal([]byte(respBody), commit); err != nil {
+		return "", fmt.Errorf("failed to unmarshal create commit response for repository %s from GitLab instance %s: %w", repositoryID, instanceURL, err)
+	}
+	return commit.ID, nil
+}
+
 // ReadFile reads the content of a file.
 func (provider *Provider) ReadFile(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, filePath string, commitID string) (string, error) {
-	code, body, err := httpGet(
+	code, body, err := httpGetWithLimit(
+		ctx,
 		instanceURL,
-		fmt.Sprintf("projects/%s/repository/files/%s/raw?ref=%s", repositoryID, url.QueryEscape(filePath), commitID),
+		fmt.Sprintf("projects/%s/repository/files/%s/raw?ref=%s", repositoryID, encodeFilePath(filePath), url.QueryEscape(commitID)),
 		&oauthCtx.AccessToken,
+		provider.maxFileSize,
 		oauthContext{
 			ClientID:     oauthCtx.ClientID,
 			ClientSecret: oauthCtx.ClientSecret,
@@ -395,11 +701,285 @@ func (provider *Provider) ReadFile(ctx context.Context, oauthCtx common.OauthCon
 	return body, nil
 }
 
+// ListFiles lists the paths of the files directly under the directory.
+func (provider *Provider) ListFiles(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, directory string, commitID string) ([]string, error) {
+	return listTree(ctx, oauthCtx, instanceURL, repositoryID, directory, commitID, false /* recursive */)
+}
+
+// ListFilesRecursively lists the paths of the files under the directory, including the files in the subdirectories.
+func (provider *Provider) ListFilesRecursively(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, directory string, commitID string) ([]string, error) {
+	return listTree(ctx, oauthCtx, instanceURL, repositoryID, directory, commitID, true /* recursive */)
+}
+
+// listTree lists the paths of the files under the directory page by page, including the files in the subdirectories if recursive is set.
+func listTree(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, directory string, commitID string, recursive bool) ([]string, error) {
+	const perPage = 100
+	var filePathList []string
+	for page := 1; ; page++ {
+		code, body, err := httpGet(
+			ctx,
+			instanceURL,
+			fmt.Sprintf("projects/%s/repository/tree?path=%s&ref=%s&recursive=%t&per_page=%d&page=%d", repositoryID, url.QueryEscape(directory), url.QueryEscape(commitID), recursive, perPage, page),
+			&oauthCtx.AccessToken,
+			oauthContext{
+				ClientID:     oauthCtx.ClientID,
+				ClientSecret: oauthCtx.ClientSecret,
+				RefreshToken: oauthCtx.RefreshToken,
+			},
+			oauthCtx.Refresher,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list directory %s from GitLab instance %s: %w", directory, instanceURL, err)
+		}
+		if code == 404 {
+			return nil, common.Errorf(common.NotFound, fmt.Errorf("failed to list directory %s from GitLab instance %s, directory not found", directory, instanceURL))
+		} else if code >= 300 {
+			return nil, fmt.Errorf("failed to list directory %s from GitLab instance %s, status code: %d", directory, instanceURL, code)
+		}
+
+		var nodeList []TreeNode
+		if err := json.Unmarshal([]byte(body), &nodeList); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal directory %s from GitLab instance %s: %w", directory, instanceURL, err)
+		}
+		for _, node := range nodeList {
+			if node.Type == "blob" {
+				filePathList = append(filePathList, node.Path)
+			}
+		}
+		if len(nodeList) < perPage {
+			return filePathList, nil
+		}
+	}
+}
+
+// FetchCommit fetches the commit, without the files changed by it.
+func (provider *Provider) FetchCommit(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, commitID string) (*vcs.Commit, error) {
+	code, body, err := httpGet(
+		ctx,
+		instanceURL,
+		fmt.Sprintf("projects/%s/repository/commits/%s", repositoryID, url.PathEscape(commitID)),
+		&oauthCtx.AccessToken,
+		oauthContext{
+			ClientID:     oauthCtx.ClientID,
+			ClientSecret: oauthCtx.ClientSecret,
+			RefreshToken: oauthCtx.RefreshToken,
+		},
+		oauthCtx.Refresher,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch commit %s from GitLab instance %s: %w", commitID, instanceURL, err)
+	}
+	if code == 404 {
+		return nil, common.Errorf(common.NotFound, fmt.Errorf("failed to fetch commit %s from GitLab instance %s, commit not found", commitID, instanceURL))
+	} else if code >= 300 {
+		return nil, fmt.Errorf("failed to fetch commit %s from GitLab instance %s, status code: %d", commitID, instanceURL, code)
+	}
+
+	commit := &Commit{}
+	if err := json.Unmarshal([]byte(body), commit); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal commit %s from GitLab instance %s: %w", commitID, instanceURL, err)
+	}
+	createdTime, err := time.Parse(time.RFC3339, commit.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the creation time %q of commit %s from GitLab instance %s: %w", commit.CreatedAt, commitID, instanceURL, err)
+	}
+
+	return &vcs.Commit{
+		ID:          commit.ID,
+		Title:       commit.Title,
+		Message:     commit.Message,
+		CreatedTs:   createdTime.Unix(),
+		URL:         commit.WebURL,
+		AuthorName:  commit.AuthorName,
+		AuthorEmail: commit.AuthorEmail,
+	}, nil
+}
+
+// CommitDiff fetches the files changed by the commit under the directory pathPrefix.
+// GitLab's commit diff API can't be scoped to a path, so the whole diff is fetched and filtered.
+func (provider *Provider) CommitDiff(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, commitID string, pathPrefix string) ([]*vcs.ChangedFile, error) {
+	const perPage = 100
+	var fileList []*vcs.ChangedFile
+	for page := 1; ; page++ {
+		code, body, err := httpGet(
+			ctx,
+			instanceURL,
+			fmt.Sprintf("projects/%s/repository/commits/%s/diff?per_page=%d&page=%d", repositoryID, url.PathEscape(commitID), perPage, page),
+			&oauthCtx.AccessToken,
+			oauthContext{
+				ClientID:     oauthCtx.ClientID,
+				ClientSecret: oauthCtx.ClientSecret,
+				RefreshToken: oauthCtx.RefreshToken,
+			},
+			oauthCtx.Refresher,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch the diff of commit %s from GitLab instance %s: %w", commitID, instanceURL, err)
+		}
+		if code == 404 {
+			return nil, common.Errorf(common.NotFound, fmt.Errorf("failed to fetch the diff of commit %s from GitLab instance %s, commit not found", commitID, instanceURL))
+		} else if code >= 300 {
+			return nil, fmt.Errorf("failed to fetch the diff of commit %s from GitLab instance %s, status code: %d", commitID, instanceURL, code)
+		}
+
+		var diffList []CommitFileDiff
+		if err := json.Unmarshal([]byte(body), &diffList); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal the diff of commit %s from GitLab instance %s: %w", commitID, instanceURL, err)
+		}
+		for _, diff := range diffList {
+			fileList = append(fileList, &vcs.ChangedFile{
+				Path:  diff.NewPath,
+				Added: diff.NewFile,
+			})
+		}
+		if len(diffList) < perPage {
+			return vcs.FilterChangedFileList(fileList, pathPrefix), nil
+		}
+	}
+}
+
+// MergeRequestDiff fetches the files changed by the merge request against its target branch under the directory pathPrefix.
+// GitLab's merge request changes API can't be scoped to a path either, so the whole diff is fetched and filtered.
+func (provider *Provider) MergeRequestDiff(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, mergeRequestID int, pathPrefix string) ([]*vcs.ChangedFile, error) {
+	code, body, err := httpGet(
+		ctx,
+		instanceURL,
+		fmt.Sprintf("projects/%s/merge_requests/%d/changes", repositoryID, mergeRequestID),
+		&oauthCtx.AccessToken,
+		oauthContext{
+			ClientID:     oauthCtx.ClientID,
+			ClientSecret: oauthCtx.ClientSecret,
+			RefreshToken: oauthCtx.RefreshToken,
+		},
+		oauthCtx.Refresher,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the changes of merge request !%d from GitLab instance %s: %w", mergeRequestID, instanceURL, err)
+	}
+	if code == 404 {
+		return nil, common.Errorf(common.NotFound, fmt.Errorf("failed to fetch the changes of merge request !%d from GitLab instance %s, merge request not found", mergeRequestID, instanceURL))
+	} else if code >= 300 {
+		return nil, fmt.Errorf("failed to fetch the changes of merge request !%d from GitLab instance %s, status code: %d", mergeRequestID, instanceURL, code)
+	}
+
+	changes := &MergeRequestChanges{}
+	if err := json.Unmarshal([]byte(body), changes); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the changes of merge request !%d from GitLab instance %s: %w", mergeRequestID, instanceURL, err)
+	}
+	var fileList []*vcs.ChangedFile
+	for _, diff := range changes.Changes {
+		fileList = append(fileList, &vcs.ChangedFile{
+			Path:  diff.NewPath,
+			Added: diff.NewFile,
+		})
+	}
+	return vcs.FilterChangedFileList(fileList, pathPrefix), nil
+}
+
+// FetchCommitSignature fetches the signature of the commit. GitLab responds 404 if the commit isn't signed.
+func (provider *Provider) FetchCommitSignature(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, commitID string) (*vcs.CommitSignature, error) {
+	code, body, err := httpGet(
+		ctx,
+		instanceURL,
+		fmt.Sprintf("projects/%s/repository/commits/%s/signature", repositoryID, url.PathEscape(commitID)),
+		&oauthCtx.AccessToken,
+		oauthContext{
+			ClientID:     oauthCtx.ClientID,
+			ClientSecret: oauthCtx.ClientSecret,
+			RefreshToken: oauthCtx.RefreshToken,
+		},
+		oauthCtx.Refresher,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the signature of commit %s from GitLab instance %s: %w", commitID, instanceURL, err)
+	}
+	if code == http.StatusNotFound {
+		return &vcs.CommitSignature{}, nil
+	} else if code >= 300 {
+		return nil, fmt.Errorf("failed to fetch the signature of commit %s from GitLab instance %s, status code: %d", commitID, instanceURL, code)
+	}
+
+	signature := &CommitSignature{}
+	if err := json.Unmarshal([]byte(body), signature); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the signature of commit %s from GitLab instance %s: %w", commitID, instanceURL, err)
+	}
+	return &vcs.CommitSignature{
+		Signed:             true,
+		Verified:           signature.VerificationStatus == "verified",
+		VerificationStatus: signature.VerificationStatus,
+		KeyID:              signature.GPGKeyPrimaryKeyID,
+	}, nil
+}
+
+// DefaultBranch returns the default branch of a GitLab project.
+func (provider *Provider) DefaultBranch(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string) (string, error) {
+	code, body, err := httpGet(
+		ctx,
+		instanceURL,
+		fmt.Sprintf("projects/%s", repositoryID),
+		&oauthCtx.AccessToken,
+		oauthContext{
+			ClientID:     oauthCtx.ClientID,
+			ClientSecret: oauthCtx.ClientSecret,
+			RefreshToken: oauthCtx.RefreshToken,
+		},
+		oauthCtx.Refresher,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch repository %s from GitLab instance %s: %w", repositoryID, instanceURL, err)
+	}
+	if code == 404 {
+		return "", common.Errorf(common.NotFound, fmt.Errorf("failed to fetch repository %s from GitLab instance %s, repository not found", repositoryID, instanceURL))
+	} else if code >= 300 {
+		return "", fmt.Errorf("failed to fetch repository %s from GitLab instance %s, status code: %d", repositoryID, instanceURL, code)
+	}
+
+	project := &Project{}
+	if err := json.Unmarshal([]byte(body), project); err != nil {
+		return "", fmt.Errorf("failed to unmarshal repository %s from GitLab instance %s: %w", repositoryID, instanceURL, err)
+	}
+	// An empty repository doesn't have the default branch.
+	if project.DefaultBranch == "" {
+		return "", common.Errorf(common.NotFound, fmt.Errorf("repository %s from GitLab instance %s doesn't have the default branch", repositoryID, instanceURL))
+	}
+	return project.DefaultBranch, nil
+}
+
+// RepositoryExists checks whether the repository still exists.
+// GitLab responds 404 for the private repository the user can't access as well, which is taken as missing too.
+func (provider *Provider) RepositoryExists(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string) (bool, error) {
+	code, _, err := httpGet(
+		ctx,
+		instanceURL,
+		fmt.Sprintf("projects/%s", repositoryID),
+		&oauthCtx.AccessToken,
+		oauthContext{
+			ClientID:     oauthCtx.ClientID,
+			ClientSecret: oauthCtx.ClientSecret,
+			RefreshToken: oauthCtx.RefreshToken,
+		},
+		oauthCtx.Refresher,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch repository %s from GitLab instance %s: %w", repositoryID, instanceURL, err)
+	}
+	switch {
+	case code == http.StatusNotFound:
+		return false, nil
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return false, common.Errorf(common.NotAuthorized, fmt.Errorf("failed to fetch repository %s from GitLab instance %s, status code: %d", repositoryID, instanceURL, code))
+	case code >= 300:
+		return false, fmt.Errorf("failed to fetch repository %s from GitLab instance %s, status code: %d", repositoryID, instanceURL, code)
+	}
+	return true, nil
+}
+
 // ReadFileMeta reads the metadata of a file.
 func (provider *Provider) ReadFileMeta(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, filePath string, branch string) (*vcs.FileMeta, error) {
 	code, body, err := httpGet(
+		ctx,
 		instanceURL,
-		fmt.Sprintf("projects/%s/repository/files/%s?ref=%s", repositoryID, url.QueryEscape(filePath), url.QueryEscape(branch)),
+		fmt.Sprintf("projects/%s/repository/files/%s?ref=%s", repositoryID, encodeFilePath(filePath), url.QueryEscape(branch)),
 		&oauthCtx.AccessToken,
 		oauthContext{
 			ClientID:     oauthCtx.ClientID,
@@ -437,6 +1017,7 @@ func (provider *Provider) ReadFileMeta(ctx context.Context, oauthCtx common.Oaut
 func (provider *Provider) CreateWebhook(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, payload []byte) (string, error) {
 	resourcePath := fmt.Sprintf("projects/%s/hooks", repositoryID)
 	code, body, err := httpPost(
+		ctx,
 		instanceURL,
 		resourcePath,
 		&oauthCtx.AccessToken,
@@ -474,10 +1055,53 @@ func (provider *Provider) CreateWebhook(ctx context.Context, oauthCtx common.Oau
 	return strconv.Itoa(webhookInfo.ID), nil
 }
 
+// ListWebhooks lists all the webhooks of a GitLab project, following all the pages.
+func (provider *Provider) ListWebhooks(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string) ([]*vcs.Webhook, error) {
+	const perPage = 100
+	var webhookList []*vcs.Webhook
+	for page := 1; ; page++ {
+		code, body, err := httpGet(
+			ctx,
+			instanceURL,
+			fmt.Sprintf("projects/%s/hooks?per_page=%d&page=%d", repositoryID, perPage, page),
+			&oauthCtx.AccessToken,
+			oauthContext{
+				ClientID:     oauthCtx.ClientID,
+				ClientSecret: oauthCtx.ClientSecret,
+				RefreshToken: oauthCtx.RefreshToken,
+			},
+			oauthCtx.Refresher,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list webhooks for repository %s from GitLab instance %s: %w", repositoryID, instanceURL, err)
+		}
+		if code == 404 {
+			return nil, common.Errorf(common.NotFound, fmt.Errorf("failed to list webhooks for repository %s from GitLab instance %s, repository not found", repositoryID, instanceURL))
+		} else if code >= 300 {
+			return nil, fmt.Errorf("failed to list webhooks for repository %s from GitLab instance %s, status code: %d", repositoryID, instanceURL, code)
+		}
+
+		var webhookInfoList []WebhookInfo
+		if err := json.Unmarshal([]byte(body), &webhookInfoList); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal webhooks for repository %s from GitLab instance %s: %w", repositoryID, instanceURL, err)
+		}
+		for _, webhookInfo := range webhookInfoList {
+			webhookList = append(webhookList, &vcs.Webhook{
+				ID:  strconv.Itoa(webhookInfo.ID),
+				URL: webhookInfo.URL,
+			})
+		}
+		if len(webhookInfoList) < perPage {
+			return webhookList, nil
+		}
+	}
+}
+
 // PatchWebhook patches a webhook in a GitLab project.
 func (provider *Provider) PatchWebhook(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, webhookID string, payload []byte) error {
 	resourcePath := fmt.Sprintf("projects/%s/hooks/%s", repositoryID, webhookID)
 	code, _, err := httpPut(
+		ctx,
 		instanceURL,
 		resourcePath,
 		&oauthCtx.AccessToken,
@@ -503,6 +1127,7 @@ func (provider *Provider) PatchWebhook(ctx context.Context, oauthCtx common.Oaut
 func (provider *Provider) DeleteWebhook(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, webhookID string) error {
 	resourcePath := fmt.Sprintf("projects/%s/hooks/%s", repositoryID, webhookID)
 	code, _, err := httpDelete(
+		ctx,
 		instanceURL,
 		resourcePath,
 		&oauthCtx.AccessToken,
@@ -523,12 +1148,176 @@ func (provider *Provider) DeleteWebhook(ctx context.Context, oauthCtx common.Oau
 	return nil
 }
 
+// CreateOrUpdateComment creates a note on the GitLab merge request, or updates the existing note containing the marker.
+func (provider *Provider) CreateOrUpdateComment(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, mergeRequestID int, marker string, body string) error {
+	// The marker is embedded as a HTML comment which is invisible in the rendered markdown.
+	markerComment := fmt.Sprintf("<!-- %s -->", marker)
+	resourcePath := fmt.Sprintf("projects/%s/merge_requests/%d/notes", repositoryID, mergeRequestID)
+	note, err := findMergeRequestNote(ctx, oauthCtx, instanceURL, repositoryID, mergeRequestID, markerComment)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(MergeRequestNoteCreate{
+		Body: fmt.Sprintf("%s\n%s", markerComment, body),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal merge request note: %w", err)
+	}
+
+	if note != nil {
+		code, _, err := httpPut(
+			ctx,
+			instanceURL,
+			fmt.Sprintf("%s/%d", resourcePath, note.ID),
+			&oauthCtx.AccessToken,
+			bytes.NewBuffer(payload),
+			oauthContext{
+				ClientID:     oauthCtx.ClientID,
+				ClientSecret: oauthCtx.ClientSecret,
+				RefreshToken: oauthCtx.RefreshToken,
+			},
+			oauthCtx.Refresher,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update note %d of merge request %d for repository %s from GitLab instance %s: %w", note.ID, mergeRequestID, repositoryID, instanceURL, err)
+		}
+		if code >= 300 {
+			return fmt.Errorf("failed to update note %d of merge request %d for repository %s from GitLab instance %s, status code: %d", note.ID, mergeRequestID, repositoryID, instanceURL, code)
+		}
+		return nil
+	}
+
+	code, _, err := httpPost(
+		ctx,
+		instanceURL,
+		resourcePath,
+		&oauthCtx.AccessToken,
+		bytes.NewBuffer(payload),
+		oauthContext{
+			ClientID:     oauthCtx.ClientID,
+			ClientSecret: oauthCtx.ClientSecret,
+			RefreshToken: oauthCtx.RefreshToken,
+		},
+		oauthCtx.Refresher,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create note on merge request %d for repository %s from GitLab instance %s: %w", mergeRequestID, repositoryID, instanceURL, err)
+	}
+	if code >= 300 {
+		return fmt.Errorf("failed to create note on merge request %d for repository %s from GitLab instance %s, status code: %d", mergeRequestID, repositoryID, instanceURL, code)
+	}
+	return nil
+}
+
+// findMergeRequestNote finds the note containing the marker comment on the GitLab merge request, following all the pages.
+// Returns nil if not found.
+func findMergeRequestNote(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, mergeRequestID int, markerComment string) (*MergeRequestNote, error) {
+	const perPage = 100
+	for page := 1; ; page++ {
+		code, body, err := httpGet(
+			ctx,
+			instanceURL,
+			fmt.Sprintf("projects/%s/merge_requests/%d/notes?per_page=%d&page=%d", repositoryID, mergeRequestID, perPage, page),
+			&oauthCtx.AccessToken,
+			oauthContext{
+				ClientID:     oauthCtx.ClientID,
+				ClientSecret: oauthCtx.ClientSecret,
+				RefreshToken: oauthCtx.RefreshToken,
+			},
+			oauthCtx.Refresher,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list notes of merge request %d for repository %s from GitLab instance %s: %w", mergeRequestID, repositoryID, instanceURL, err)
+		}
+		if code == 404 {
+			return nil, common.Errorf(common.NotFound, fmt.Errorf("failed to list notes of merge request %d for repository %s from GitLab instance %s, merge request not found", mergeRequestID, repositoryID, instanceURL))
+		} else if code >= 300 {
+			return nil, fmt.Errorf("failed to list notes of merge request %d for repository %s from GitLab instance %s, status code: %d", mergeRequestID, repositoryID, instanceURL, code)
+		}
+
+		var noteList []MergeRequestNote
+		if err := json.Unmarshal([]byte(body), &noteList); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal notes of merge request %d for repository %s from GitLab instance %s: %w", mergeRequestID, repositoryID, instanceURL, err)
+		}
+		for i := range noteList {
+			if strings.Contains(noteList[i].Body, markerComment) {
+				return &noteList[i], nil
+			}
+		}
+		if len(noteList) < perPage {
+			return nil, nil
+		}
+	}
+}
+
+// SetCommitStatus sets the status of a commit in a GitLab project. The context is used as the status name.
+// It's skipped if the GitLab instance is too old to support the commit status.
+func (provider *Provider) SetCommitStatus(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, commitID string, status vcs.CommitStatus) error {
+	capabilities, err := detector.detect(ctx, &oauthCtx, instanceURL)
+	if err != nil {
+		// Failing to detect the capabilities doesn't fail the commit status, which is tried as if supported.
+		provider.l.Debug("Failed to detect the capabilities of GitLab instance", zap.String("instance", instanceURL), zap.Error(err))
+	} else if !capabilities.CommitStatus {
+		provider.l.Debug("Skipped setting the commit status unsupported by GitLab instance",
+			zap.String("instance", instanceURL),
+			zap.String("version", capabilities.Version),
+		)
+		return nil
+	}
+
+	body, err := json.Marshal(CommitStatusCreate{
+		State:       string(status.State),
+		Name:        status.Context,
+		TargetURL:   status.TargetURL,
+		Description: status.Description,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal commit status: %w", err)
+	}
+
+	code, _, err := httpPost(
+		ctx,
+		instanceURL,
+		fmt.Sprintf("projects/%s/statuses/%s", repositoryID, commitID),
+		&oauthCtx.AccessToken,
+		bytes.NewBuffer(body),
+		oauthContext{
+			ClientID:     oauthCtx.ClientID,
+			ClientSecret: oauthCtx.ClientSecret,
+			RefreshToken: oauthCtx.RefreshToken,
+		},
+		oauthCtx.Refresher,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set status of commit %s for repository %s from GitLab instance %s: %w", commitID, repositoryID, instanceURL, err)
+	}
+	if code == 404 {
+		return common.Errorf(common.NotFound, fmt.Errorf("failed to set status of commit %s for repository %s from GitLab instance %s, commit not found", commitID, repositoryID, instanceURL))
+	} else if code >= 300 {
+		return fmt.Errorf("failed to set status of commit %s for repository %s from GitLab instance %s, status code: %d", commitID, repositoryID, instanceURL, code)
+	}
+	return nil
+}
+
+// encodeFilePath encodes the file path as a single segment of the repository files API path, which GitLab requires
+// to be URL-encoded as a whole, including "/" as "%2F". Unlike url.QueryEscape, spaces are encoded as "%20" instead of "+",
+// which GitLab would take literally.
+func encodeFilePath(filePath string) string {
+	return url.PathEscape(filePath)
+}
+
 // httpPost sends a POST request.
-func httpPost(instanceURL string, resourcePath string, token *string, body io.Reader, oauthContext oauthContext, refresher common.TokenRefresher) (code int, respBody string, err error) {
-	return retry(instanceURL, token, oauthContext, refresher, func() (*http.Response, error) {
+func httpPost(ctx context.Context, instanceURL string, resourcePath string, token *string, body io.Reader, oauthContext oauthContext, refresher common.TokenRefresher) (code int, respBody string, err error) {
+	// The body is buffered, so it can be sent again on retries.
+	bodyBytes, err := io.ReadAll(body)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read POST body (%w)", err)
+	}
+	return retry(ctx, instanceURL, token, 0, oauthContext, refresher, func() (*http.Response, error) {
 		url := fmt.Sprintf("%s/%s/%s", instanceURL, apiPath, resourcePath)
-		req, err := http.NewRequest("POST",
-			url, body)
+		req, err := http.NewRequestWithContext(ctx, "POST",
+			url, bytes.NewReader(bodyBytes))
 		if err != nil {
 			return nil, fmt.Errorf("failed to construct POST %v (%w)", url, err)
 		}
@@ -545,10 +1334,16 @@ func httpPost(instanceURL string, resourcePath string, token *string, body io.Re
 }
 
 // httpGet sends a GET request.
-func httpGet(instanceURL string, resourcePath string, token *string, oauthContext oauthContext, refresher common.TokenRefresher) (code int, respBody string, err error) {
-	return retry(instanceURL, token, oauthContext, refresher, func() (*http.Response, error) {
+func httpGet(ctx context.Context, instanceURL string, resourcePath string, token *string, oauthContext oauthContext, refresher common.TokenRefresher) (code int, respBody string, err error) {
+	return httpGetWithLimit(ctx, instanceURL, resourcePath, token, 0, oauthContext, refresher)
+}
+
+// httpGetWithLimit sends a GET request. Returns vcs.ErrFileTooLarge if the response body exceeds maxBodySize bytes.
+// A non-positive maxBodySize means no limit.
+func httpGetWithLimit(ctx context.Context, instanceURL string, resourcePath string, token *string, maxBodySize int64, oauthContext oauthContext, refresher common.TokenRefresher) (code int, respBody string, err error) {
+	return retry(ctx, instanceURL, token, maxBodySize, oauthContext, refresher, func() (*http.Response, error) {
 		url := fmt.Sprintf("%s/%s/%s", instanceURL, apiPath, resourcePath)
-		req, err := http.NewRequest("GET",
+		req, err := http.NewRequestWithContext(ctx, "GET",
 			url, nil)
 		if err != nil {
 			return nil, fmt.Errorf("failed to construct GET %v (%w)", url, err)
@@ -566,11 +1361,16 @@ func httpGet(instanceURL string, resourcePath string, token *string, oauthContex
 }
 
 // httpPut sends a PUT request.
-func httpPut(instanceURL string, resourcePath string, token *string, body io.Reader, oauthContext oauthContext, refresher common.TokenRefresher) (code int, respBody string, err error) {
-	return retry(instanceURL, token, oauthContext, refresher, func() (*http.Response, error) {
+func httpPut(ctx context.Context, instanceURL string, resourcePath string, token *string, body io.Reader, oauthContext oauthContext, refresher common.TokenRefresher) (code int, respBody string, err error) {
+	// The body is buffered, so it can be sent again on retries.
+	bodyBytes, err := io.ReadAll(body)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read PUT body (%w)", err)
+	}
+	return retry(ctx, instanceURL, token, 0, oauthContext, refresher, func() (*http.Response, error) {
 		url := fmt.Sprintf("%s/%s/%s", instanceURL, apiPath, resourcePath)
-		req, err := http.NewRequest("PUT",
-			url, body)
+		req, err := http.NewRequestWithContext(ctx, "PUT",
+			url, bytes.NewReader(bodyBytes))
 		if err != nil {
 			return nil, fmt.Errorf("failed to construct PUT %v (%w)", url, err)
 		}
@@ -587,10 +1387,10 @@ func httpPut(instanceURL string, resourcePath string, token *string, body io.Rea
 }
 
 // httpDelete sends a DELETE request.
-func httpDelete(instanceURL string, resourcePath string, token *string, oauthContext oauthContext, refresher common.TokenRefresher) (code int, respBody string, err error) {
-	return retry(instanceURL, token, oauthContext, refresher, func() (*http.Response, error) {
+func httpDelete(ctx context.Context, instanceURL string, resourcePath string, token *string, oauthContext oauthContext, refresher common.TokenRefresher) (code int, respBody string, err error) {
+	return retry(ctx, instanceURL, token, 0, oauthContext, refresher, func() (*http.Response, error) {
 		url := fmt.Sprintf("%s/%s/%s", instanceURL, apiPath, resourcePath)
-		req, err := http.NewRequest("DELETE",
+		req, err := http.NewRequestWithContext(ctx, "DELETE",
 			url, nil)
 		if err != nil {
 			return nil, fmt.Errorf("failed to construct DELETE %v (%w)", url, err)
@@ -607,21 +1407,42 @@ func httpDelete(instanceURL string, resourcePath string, token *string, oauthCon
 	})
 }
 
-func retry(instanceURL string, token *string, oauthContext oauthContext, refresher common.TokenRefresher, f func() (*http.Response, error)) (code int, respBody string, err error) {
+func retry(ctx context.Context, instanceURL string, token *string, maxBodySize int64, oauthContext oauthContext, refresher common.TokenRefresher, f func() (*http.Response, error)) (code int, respBody string, err error) {
 	retries := 0
+	rateLimitRetries := 0
 RETRY:
 	retries++
 
+	// Slow down if the instance is running out of the rate limit, or asks to retry after a while.
+	if err := limiter.wait(ctx, instanceURL); err != nil {
+		return 0, "", err
+	}
 	resp, err := f()
 	if err != nil {
 		return 0, "", err
 	}
-	body, err := io.ReadAll(resp.Body)
+	limiter.update(instanceURL, resp)
+	body, err := readBody(resp, maxBodySize)
 	if err != nil {
+		if errors.Is(err, vcs.ErrFileTooLarge) {
+			return 0, "", err
+		}
 		return 0, "", fmt.Errorf("failed to read gitlab response body, code %v, error: %v", resp.StatusCode, err)
 	}
 
+	// The request is rejected by the rate limit, retry after the delay told by the instance.
+	if resp.StatusCode == http.StatusTooManyRequests && rateLimitRetries < maxRateLimitRetries {
+		rateLimitRetries++
+		// The rate limit retries don't count toward the token refresh retries.
+		retries--
+		goto RETRY
+	}
+
 	if err := getOAuthErrorDetails(resp.StatusCode, string(body)); err != nil {
+		// A nil refresher means the token never expires, so refreshing can't help.
+		if refresher == nil {
+			return 0, "", fmt.Errorf("the non-expiring access token is rejected, code %v body %s; oauth error: %v", resp.StatusCode, string(body), err)
+		}
 		if _, ok := err.(oauthError); ok && retries < maxRetries {
 			// Refresh and store the token.
 			if err := refreshToken(instanceURL, token, oauthContext, refresher); err != nil {
@@ -637,6 +1458,28 @@ RETRY:
 	return resp.StatusCode, string(body), nil
 }
 
+// readBody reads the response body. If maxBodySize is positive, it stops reading and returns vcs.ErrFileTooLarge
+// as soon as the body exceeds maxBodySize bytes, so we never buffer more than maxBodySize+1 bytes.
+func readBody(resp *http.Response, maxBodySize int64) ([]byte, error) {
+	if maxBodySize <= 0 {
+		return io.ReadAll(resp.Body)
+	}
+
+	if resp.ContentLength > maxBodySize {
+		resp.Body.Close()
+		return nil, fmt.Errorf("content length %d exceeds %d bytes: %w", resp.ContentLength, maxBodySize, vcs.ErrFileTooLarge)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBodySize {
+		resp.Body.Close()
+		return nil, fmt.Errorf("content exceeds %d bytes: %w", maxBodySize, vcs.ErrFileTooLarge)
+	}
+	return body, nil
+}
+
 type oauthError struct {
 	Err              string `json:"error"`
 	ErrorDescription string `json:"error_description"`
@@ -676,6 +1519,16 @@ type oauthContext struct {
 	GrantType    string `json:"grant_type"`
 }
 
+// oauthExchangeRequest is the request for exchanging the authorization code for a token.
+type oauthExchangeRequest struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	Code         string `json:"code"`
+	RedirectURI  string `json:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier"`
+	GrantType    string `json:"grant_type"`
+}
+
 type refreshOauthResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
@@ -711,6 +1564,10 @@ func refreshToken(instanceURL string, oldToken *string, oauthContext oauthContex
 	// In the sequence of 1) get file content with oauth error, 2) refresh token.
 	// If step 2) failed still with oauth error, we should stop retries because we should always expect refreshing token request to succeed unless we're holding any invalid refresh token already.
 
+	// GitLab responds 400 invalid_grant or 401 if the refresh token is revoked or has been used.
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("failed to fetch refresh token, response code %v body %s: %w", resp.StatusCode, body, vcs.ErrTokenInvalid)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("failed to fetch refresh token, response code %v body %s", resp.StatusCode, body)
 	}
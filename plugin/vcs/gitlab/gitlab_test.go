@@ -0,0 +1,810 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"go.uber.org/zap"
+)
+
+// fakeNoteServer is a fake GitLab serving the merge request note API, paginated by the per_page and page parameters.
+type fakeNoteServer struct {
+	notes      []*MergeRequestNote
+	nextNoteID int
+	created    int
+	updated    int
+}
+
+func (f *fakeNoteServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const notesPath = "/api/v4/projects/1/merge_requests/7/notes"
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == notesPath:
+		perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+		if err != nil {
+			perPage = 20
+		}
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil {
+			page = 1
+		}
+		start, end := (page-1)*perPage, page*perPage
+		if start > len(f.notes) {
+			start = len(f.notes)
+		}
+		if end > len(f.notes) {
+			end = len(f.notes)
+		}
+		_ = json.NewEncoder(w).Encode(f.notes[start:end])
+	case r.Method == http.MethodPost && r.URL.Path == notesPath:
+		note := &MergeRequestNote{ID: f.nextNoteID}
+		if err := decodeNote(r.Body, note); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.nextNoteID++
+		f.created++
+		f.notes = append(f.notes, note)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(note)
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, notesPath+"/"):
+		for _, note := range f.notes {
+			if r.URL.Path == fmt.Sprintf("%s/%d", notesPath, note.ID) {
+				if err := decodeNote(r.Body, note); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				f.updated++
+				_ = json.NewEncoder(w).Encode(note)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func decodeNote(r io.Reader, note *MergeRequestNote) error {
+	var create MergeRequestNoteCreate
+	if err := json.NewDecoder(r).Decode(&create); err != nil {
+		return err
+	}
+	note.Body = create.Body
+	return nil
+}
+
+func TestCreateOrUpdateComment(t *testing.T) {
+	// There are more unrelated notes than a page, so the review note is only found on the second page.
+	const unrelatedNoteCount = 150
+	fake := &fakeNoteServer{
+		nextNoteID: unrelatedNoteCount + 1,
+	}
+	for i := 1; i <= unrelatedNoteCount; i++ {
+		fake.notes = append(fake.notes, &MergeRequestNote{ID: i, Body: "LGTM"})
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop()})
+	oauthCtx := common.OauthContext{
+		AccessToken: "token",
+		Refresher: func(token, refreshToken string, expiresTs int64) error {
+			return nil
+		},
+	}
+
+	// The first call creates the comment.
+	if err := provider.CreateOrUpdateComment(context.Background(), oauthCtx, server.URL, "1", 7, "bytebase-schema-review", "first review"); err != nil {
+		t.Fatalf("CreateOrUpdateComment() got error %v, want OK.", err)
+	}
+	if fake.created != 1 || fake.updated != 0 {
+		t.Fatalf("CreateOrUpdateComment() got created %d updated %d, want created 1 updated 0.", fake.created, fake.updated)
+	}
+
+	// The second call updates the comment found by the marker.
+	if err := provider.CreateOrUpdateComment(context.Background(), oauthCtx, server.URL, "1", 7, "bytebase-schema-review", "second review"); err != nil {
+		t.Fatalf("CreateOrUpdateComment() got error %v, want OK.", err)
+	}
+	if fake.created != 1 || fake.updated != 1 {
+		t.Fatalf("CreateOrUpdateComment() got created %d updated %d, want created 1 updated 1.", fake.created, fake.updated)
+	}
+	if len(fake.notes) != unrelatedNoteCount+1 {
+		t.Fatalf("got %d notes, want %d.", len(fake.notes), unrelatedNoteCount+1)
+	}
+	if fake.notes[0].Body != "LGTM" {
+		t.Errorf("unrelated note got body %q, want %q.", fake.notes[0].Body, "LGTM")
+	}
+	if want := "<!-- bytebase-schema-review -->\nsecond review"; fake.notes[unrelatedNoteCount].Body != want {
+		t.Errorf("review note got body %q, want %q.", fake.notes[unrelatedNoteCount].Body, want)
+	}
+}
+
+func TestReadFileTooLarge(t *testing.T) {
+	const maxFileSize = 1024
+	chunk := []byte(strings.Repeat("x", 512))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ref") == "small" {
+			_, _ = w.Write(chunk)
+			return
+		}
+		// Stream an endless body without Content-Length, so the client must stop reading on its own.
+		flusher := w.(http.Flusher)
+		for {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}))
+	defer server.Close()
+
+	provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop(), MaxFileSize: maxFileSize})
+	oauthCtx := common.OauthContext{
+		AccessToken: "token",
+		Refresher: func(token, refreshToken string, expiresTs int64) error {
+			return nil
+		},
+	}
+
+	content, err := provider.ReadFile(context.Background(), oauthCtx, server.URL, "1", "dev/db__v1.sql", "small")
+	if err != nil {
+		t.Fatalf("ReadFile() got error %v, want OK.", err)
+	}
+	if len(content) != len(chunk) {
+		t.Errorf("ReadFile() got %d bytes, want %d.", len(content), len(chunk))
+	}
+
+	if _, err := provider.ReadFile(context.Background(), oauthCtx, server.URL, "1", "dev/db__v2.sql", "large"); !errors.Is(err, vcs.ErrFileTooLarge) {
+		t.Errorf("ReadFile() got error %v, want %v.", err, vcs.ErrFileTooLarge)
+	}
+}
+
+func TestEncodeFilePath(t *testing.T) {
+	tests := []struct {
+		filePath string
+		want     string
+	}{
+		{
+			filePath: "db__v1.sql",
+			want:     "db__v1.sql",
+		},
+		{
+			filePath: "bytebase/prod/blog__v1__migrate__init.sql",
+			want:     "bytebase%2Fprod%2Fblog__v1__migrate__init.sql",
+		},
+		{
+			filePath: "bytebase/prod/blog__v1__migrate__add users.sql",
+			want:     "bytebase%2Fprod%2Fblog__v1__migrate__add%20users.sql",
+		},
+		{
+			filePath: "bytebase/prod/blog__v1__migrate__issue#42.sql",
+			want:     "bytebase%2Fprod%2Fblog__v1__migrate__issue%2342.sql",
+		},
+		{
+			filePath: "bytebase/prod/blog__v1__migrate__100%.sql",
+			want:     "bytebase%2Fprod%2Fblog__v1__migrate__100%25.sql",
+		},
+		{
+			filePath: "bytebase/生产/博客__v1__migrate__初始化.sql",
+			want:     "bytebase%2F%E7%94%9F%E4%BA%A7%2F%E5%8D%9A%E5%AE%A2__v1__migrate__%E5%88%9D%E5%A7%8B%E5%8C%96.sql",
+		},
+	}
+
+	for _, test := range tests {
+		if got := encodeFilePath(test.filePath); got != test.want {
+			t.Errorf("encodeFilePath(%q) got %q, want %q.", test.filePath, got, test.want)
+		}
+	}
+}
+
+func TestReadFileEncodedPath(t *testing.T) {
+	const content = "CREATE TABLE user (id INT);"
+	filePathList := []string{
+		"bytebase/prod/blog__v1__migrate__add users.sql",
+		"bytebase/prod/blog__v1__migrate__issue#42.sql",
+		"bytebase/生产/博客__v1__migrate__初始化.sql",
+	}
+	fileMap := make(map[string]bool)
+	for _, filePath := range filePathList {
+		fileMap[filePath] = true
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// GitLab takes the file path as a single URL-encoded path segment.
+		escaped := strings.TrimSuffix(strings.TrimPrefix(r.URL.EscapedPath(), "/api/v4/projects/1/repository/files/"), "/raw")
+		if strings.Contains(escaped, "/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		filePath, err := url.PathUnescape(escaped)
+		if err != nil || !fileMap[filePath] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop()})
+	oauthCtx := common.OauthContext{
+		AccessToken: "token",
+	}
+	for _, filePath := range filePathList {
+		got, err := provider.ReadFile(context.Background(), oauthCtx, server.URL, "1", filePath, "main")
+		if err != nil {
+			t.Errorf("ReadFile(%q) got error %v, want OK.", filePath, err)
+			continue
+		}
+		if got != content {
+			t.Errorf("ReadFile(%q) got %q, want %q.", filePath, got, content)
+		}
+	}
+}
+
+func TestCreateCommitAuthor(t *testing.T) {
+	var got CommitCreate
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v4/projects/1/repository/commits" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(Commit{ID: "abc123"})
+	}))
+	defer server.Close()
+
+	provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop()})
+	oauthCtx := common.OauthContext{
+		AccessToken: "token",
+		Refresher: func(token, refreshToken string, expiresTs int64) error {
+			return nil
+		},
+	}
+	fileChangeList := []vcs.FileChange{
+		{Action: vcs.FileChangeUpdate, FilePath: "dev/.db__LATEST.sql", Content: "CREATE TABLE t (id INT);"},
+	}
+	author := vcs.Author{Name: "Bytebase Bot", Email: "bot@bytebase.com"}
+	sha, err := provider.CreateCommit(context.Background(), oauthCtx, server.URL, "1", "main", "Update schema", fileChangeList, author)
+	if err != nil {
+		t.Fatalf("CreateCommit() got error %v, want OK.", err)
+	}
+	if sha != "abc123" {
+		t.Errorf("CreateCommit() got sha %q, want %q.", sha, "abc123")
+	}
+	if got.AuthorName != author.Name || got.AuthorEmail != author.Email {
+		t.Errorf("CreateCommit() got author %q <%s>, want %q <%s>.", got.AuthorName, got.AuthorEmail, author.Name, author.Email)
+	}
+	if len(got.ActionList) != 1 || got.ActionList[0].Action != "update" || got.ActionList[0].FilePath != "dev/.db__LATEST.sql" {
+		t.Errorf("CreateCommit() got actions %+v, want the update of %q.", got.ActionList, "dev/.db__LATEST.sql")
+	}
+}
+
+func TestNeverExpiringTokenNotRefreshed(t *testing.T) {
+	refreshed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth/token" {
+			refreshed = true
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"invalid_token","error_description":"Token is expired."}`))
+	}))
+	defer server.Close()
+
+	provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop()})
+	// A nil refresher means the access token never expires.
+	oauthCtx := common.OauthContext{
+		AccessToken: "token",
+	}
+	if _, err := provider.ReadFile(context.Background(), oauthCtx, server.URL, "1", "dev/db__v1.sql", "main"); err == nil {
+		t.Errorf("ReadFile() got OK, want error.")
+	}
+	if refreshed {
+		t.Errorf("ReadFile() refreshed the never-expiring token, want not refreshed.")
+	}
+}
+
+func TestSetCommitStatus(t *testing.T) {
+	var got CommitStatusCreate
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v4/projects/1/statuses/abc123" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop()})
+	oauthCtx := common.OauthContext{
+		AccessToken: "token",
+	}
+	status := vcs.CommitStatus{
+		State:       vcs.CommitStateSuccess,
+		Context:     "ci/bytebase-prod",
+		TargetURL:   "https://bytebase.example.com/issue/1",
+		Description: "Applied migration version 001 to database \"blog\".",
+	}
+	if err := provider.SetCommitStatus(context.Background(), oauthCtx, server.URL, "1", "abc123", status); err != nil {
+		t.Fatalf("SetCommitStatus() got error %v, want OK.", err)
+	}
+	want := CommitStatusCreate{
+		State:       "success",
+		Name:        "ci/bytebase-prod",
+		TargetURL:   "https://bytebase.example.com/issue/1",
+		Description: "Applied migration version 001 to database \"blog\".",
+	}
+	if got != want {
+		t.Errorf("SetCommitStatus() got request %+v, want %+v.", got, want)
+	}
+
+	if err := provider.SetCommitStatus(context.Background(), oauthCtx, server.URL, "1", "def456", status); common.ErrorCode(err) != common.NotFound {
+		t.Errorf("SetCommitStatus() got error %v, want not found.", err)
+	}
+}
+
+func TestDefaultBranch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v4/projects/1":
+			_ = json.NewEncoder(w).Encode(Project{ID: 1, DefaultBranch: "trunk"})
+		case "/api/v4/projects/2":
+			// An empty repository.
+			_ = json.NewEncoder(w).Encode(Project{ID: 2})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop()})
+	oauthCtx := common.OauthContext{
+		AccessToken: "token",
+	}
+	branch, err := provider.DefaultBranch(context.Background(), oauthCtx, server.URL, "1")
+	if err != nil {
+		t.Fatalf("DefaultBranch() got error %v, want OK.", err)
+	}
+	if branch != "trunk" {
+		t.Errorf("DefaultBranch() got %q, want %q.", branch, "trunk")
+	}
+	for _, repositoryID := range []string{"2", "3"} {
+		if _, err := provider.DefaultBranch(context.Background(), oauthCtx, server.URL, repositoryID); common.ErrorCode(err) != common.NotFound {
+			t.Errorf("DefaultBranch(%q) got error %v, want not found.", repositoryID, err)
+		}
+	}
+}
+
+func TestFetchCommit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v4/projects/1/repository/commits/abc123":
+			_ = json.NewEncoder(w).Encode(Commit{
+				ID:          "abc123",
+				Title:       "Add users",
+				Message:     "Add users\n\nFor the sign-up.",
+				CreatedAt:   "2022-04-15T09:30:00+08:00",
+				WebURL:      "https://gitlab.example.com/acme/blog/-/commit/abc123",
+				AuthorName:  "Alice",
+				AuthorEmail: "alice@example.com",
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop()})
+	oauthCtx := common.OauthContext{
+		AccessToken: "token",
+	}
+	commit, err := provider.FetchCommit(context.Background(), oauthCtx, server.URL, "1", "abc123")
+	if err != nil {
+		t.Fatalf("FetchCommit() got error %v, want OK.", err)
+	}
+	want := &vcs.Commit{
+		ID:          "abc123",
+		Title:       "Add users",
+		Message:     "Add users\n\nFor the sign-up.",
+		CreatedTs:   1649986200,
+		URL:         "https://gitlab.example.com/acme/blog/-/commit/abc123",
+		AuthorName:  "Alice",
+		AuthorEmail: "alice@example.com",
+	}
+	if !reflect.DeepEqual(commit, want) {
+		t.Errorf("FetchCommit() got %+v, want %+v.", commit, want)
+	}
+
+	if _, err := provider.FetchCommit(context.Background(), oauthCtx, server.URL, "1", "def456"); common.ErrorCode(err) != common.NotFound {
+		t.Errorf("FetchCommit() got error %v, want not found.", err)
+	}
+}
+
+func TestCommitDiff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v4/projects/1/repository/commits/abc123/diff" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]CommitFileDiff{
+			{NewPath: "bytebase/prod/blog__202204150930__migrate__add_users.sql", NewFile: true},
+			{NewPath: "bytebase/prod/.blog__LATEST.sql"},
+			{NewPath: "bytebase2/prod/blog__202204150930__migrate__add_posts.sql", NewFile: true},
+			{NewPath: "README.md"},
+		})
+	}))
+	defer server.Close()
+
+	provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop()})
+	oauthCtx := common.OauthContext{
+		AccessToken: "token",
+	}
+	tests := []struct {
+		pathPrefix string
+		want       []*vcs.ChangedFile
+	}{
+		{
+			pathPrefix: "",
+			want: []*vcs.ChangedFile{
+				{Path: "bytebase/prod/blog__202204150930__migrate__add_users.sql", Added: true},
+				{Path: "bytebase/prod/.blog__LATEST.sql"},
+				{Path: "bytebase2/prod/blog__202204150930__migrate__add_posts.sql", Added: true},
+				{Path: "README.md"},
+			},
+		},
+		{
+			pathPrefix: "bytebase",
+			want: []*vcs.ChangedFile{
+				{Path: "bytebase/prod/blog__202204150930__migrate__add_users.sql", Added: true},
+				{Path: "bytebase/prod/.blog__LATEST.sql"},
+			},
+		},
+		{
+			pathPrefix: "bytebase/test",
+			want:       nil,
+		},
+	}
+	for _, test := range tests {
+		fileList, err := provider.CommitDiff(context.Background(), oauthCtx, server.URL, "1", "abc123", test.pathPrefix)
+		if err != nil {
+			t.Fatalf("CommitDiff(%q) got error %v, want OK.", test.pathPrefix, err)
+		}
+		if !reflect.DeepEqual(fileList, test.want) {
+			t.Errorf("CommitDiff(%q) got %+v, want %+v.", test.pathPrefix, fileList, test.want)
+		}
+	}
+
+	if _, err := provider.CommitDiff(context.Background(), oauthCtx, server.URL, "1", "def456", ""); common.ErrorCode(err) != common.NotFound {
+		t.Errorf("CommitDiff() got error %v, want not found.", err)
+	}
+}
+
+func TestMergeRequestDiff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v4/projects/1/merge_requests/7/changes" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(MergeRequestChanges{
+			Changes: []CommitFileDiff{
+				{NewPath: "bytebase/prod/blog__202204150930__migrate__add_users.sql", NewFile: true},
+				{NewPath: "bytebase/prod/blog__202204150931__migrate__add_posts.sql", NewFile: true},
+				{NewPath: "bytebase/prod/.blog__LATEST.sql"},
+				{NewPath: "README.md"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop()})
+	oauthCtx := common.OauthContext{
+		AccessToken: "token",
+	}
+	fileList, err := provider.MergeRequestDiff(context.Background(), oauthCtx, server.URL, "1", 7, "bytebase")
+	if err != nil {
+		t.Fatalf("MergeRequestDiff() got error %v, want OK.", err)
+	}
+	want := []*vcs.ChangedFile{
+		{Path: "bytebase/prod/blog__202204150930__migrate__add_users.sql", Added: true},
+		{Path: "bytebase/prod/blog__202204150931__migrate__add_posts.sql", Added: true},
+		{Path: "bytebase/prod/.blog__LATEST.sql"},
+	}
+	if !reflect.DeepEqual(fileList, want) {
+		t.Errorf("MergeRequestDiff() got %+v, want %+v.", fileList, want)
+	}
+
+	if _, err := provider.MergeRequestDiff(context.Background(), oauthCtx, server.URL, "1", 8, ""); common.ErrorCode(err) != common.NotFound {
+		t.Errorf("MergeRequestDiff() got error %v, want not found.", err)
+	}
+}
+
+func TestFetchCommitSignature(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v4/projects/1/repository/commits/verified/signature":
+			_ = json.NewEncoder(w).Encode(CommitSignature{SignatureType: "PGP", VerificationStatus: "verified", GPGKeyPrimaryKeyID: "ABCD1234"})
+		case "/api/v4/projects/1/repository/commits/unverified/signature":
+			_ = json.NewEncoder(w).Encode(CommitSignature{SignatureType: "PGP", VerificationStatus: "unknown_key", GPGKeyPrimaryKeyID: "ABCD1234"})
+		default:
+			// GitLab responds 404 for the unsigned commits.
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop()})
+	oauthCtx := common.OauthContext{
+		AccessToken: "token",
+	}
+	tests := []struct {
+		commitID string
+		want     *vcs.CommitSignature
+	}{
+		{
+			commitID: "verified",
+			want:     &vcs.CommitSignature{Signed: true, Verified: true, VerificationStatus: "verified", KeyID: "ABCD1234"},
+		},
+		{
+			commitID: "unverified",
+			want:     &vcs.CommitSignature{Signed: true, VerificationStatus: "unknown_key", KeyID: "ABCD1234"},
+		},
+		{
+			commitID: "unsigned",
+			want:     &vcs.CommitSignature{},
+		},
+	}
+	for _, test := range tests {
+		signature, err := provider.FetchCommitSignature(context.Background(), oauthCtx, server.URL, "1", test.commitID)
+		if err != nil {
+			t.Fatalf("FetchCommitSignature(%q) got error %v, want OK.", test.commitID, err)
+		}
+		if !reflect.DeepEqual(signature, test.want) {
+			t.Errorf("FetchCommitSignature(%q) got %+v, want %+v.", test.commitID, signature, test.want)
+		}
+	}
+}
+
+func TestExchangeOAuthToken(t *testing.T) {
+	var got oauthExchangeRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/oauth/token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(refreshOauthResponse{
+			AccessToken:  "access",
+			RefreshToken: "refresh",
+			ExpiresIn:    7200,
+			CreatedAt:    1000,
+		})
+	}))
+	defer server.Close()
+
+	provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop()})
+	token, err := provider.ExchangeOAuthToken(context.Background(), server.URL, &vcs.OAuthExchange{
+		ClientID:     "id",
+		ClientSecret: "secret",
+		Code:         "code",
+		RedirectURL:  "http://localhost/oauth/callback",
+		CodeVerifier: "verifier",
+	})
+	if err != nil {
+		t.Fatalf("ExchangeOAuthToken() got error %v, want OK.", err)
+	}
+	want := &vcs.OAuthToken{AccessToken: "access", RefreshToken: "refresh", ExpiresTs: 8200}
+	if !reflect.DeepEqual(token, want) {
+		t.Errorf("ExchangeOAuthToken() got %+v, want %+v.", token, want)
+	}
+	if got.GrantType != "authorization_code" || got.CodeVerifier != "verifier" || got.Code != "code" {
+		t.Errorf("ExchangeOAuthToken() sent %+v, want authorization_code grant with the code verifier.", got)
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req oauthContext
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if req.RefreshToken != "refresh" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(refreshOauthResponse{
+			AccessToken:  "new-access",
+			RefreshToken: "new-refresh",
+			ExpiresIn:    7200,
+			CreatedAt:    1000,
+		})
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		refreshToken string
+		wantInvalid  bool
+	}{
+		{
+			name:         "refreshed",
+			refreshToken: "refresh",
+			wantInvalid:  false,
+		},
+		{
+			name:         "revoked refresh token",
+			refreshToken: "revoked",
+			wantInvalid:  true,
+		},
+	}
+
+	provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop()})
+	for _, test := range tests {
+		var gotToken string
+		var gotExpiresTs int64
+		oauthCtx := common.OauthContext{
+			AccessToken:  "access",
+			RefreshToken: test.refreshToken,
+			Refresher: func(token, refreshToken string, expiresTs int64) error {
+				gotToken, gotExpiresTs = token, expiresTs
+				return nil
+			},
+		}
+		err := provider.RefreshToken(context.Background(), oauthCtx, server.URL)
+		if test.wantInvalid {
+			if !errors.Is(err, vcs.ErrTokenInvalid) {
+				t.Errorf("%q: RefreshToken() got error %v, want ErrTokenInvalid.", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: RefreshToken() got error %v, want OK.", test.name, err)
+		}
+		if gotToken != "new-access" || gotExpiresTs != 8200 {
+			t.Errorf("%q: RefreshToken() stored token %q expires %d, want %q expires %d.", test.name, gotToken, gotExpiresTs, "new-access", 8200)
+		}
+	}
+}
+
+func TestRepositoryExists(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v4/projects/1":
+			_, _ = w.Write([]byte(`{"id":1,"default_branch":"main"}`))
+		case "/api/v4/projects/2":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"404 Project Not Found"}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"message":"401 Unauthorized"}`))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		repositoryID string
+		want         bool
+		wantErrCode  common.Code
+	}{
+		{
+			name:         "exists",
+			repositoryID: "1",
+			want:         true,
+		},
+		{
+			name:         "missing",
+			repositoryID: "2",
+			want:         false,
+		},
+		{
+			name:         "unauthorized",
+			repositoryID: "3",
+			want:         false,
+			wantErrCode:  common.NotAuthorized,
+		},
+	}
+
+	provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop()})
+	for _, test := range tests {
+		got, err := provider.RepositoryExists(context.Background(), common.OauthContext{AccessToken: "access"}, server.URL, test.repositoryID)
+		if test.wantErrCode != common.Ok {
+			if common.ErrorCode(err) != test.wantErrCode {
+				t.Errorf("%q: RepositoryExists() got error %v, want error code %v.", test.name, err, test.wantErrCode)
+			}
+		} else if err != nil {
+			t.Fatalf("%q: RepositoryExists() got error %v, want OK.", test.name, err)
+		}
+		if got != test.want {
+			t.Errorf("%q: RepositoryExists() got %v, want %v.", test.name, got, test.want)
+		}
+	}
+}
+
+func TestListWebhooks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v4/projects/1/hooks" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// The first page is full of the other webhooks, and the Bytebase webhook is on the second page.
+		var webhookInfoList []WebhookInfo
+		switch r.URL.Query().Get("page") {
+		case "1":
+			for i := 1; i <= 100; i++ {
+				webhookInfoList = append(webhookInfoList, WebhookInfo{ID: i, URL: fmt.Sprintf("https://ci.example.com/hook/%d", i)})
+			}
+		case "2":
+			webhookInfoList = append(webhookInfoList, WebhookInfo{ID: 101, URL: "https://bytebase.example.com/hook/gitlab/endpoint"})
+		}
+		_ = json.NewEncoder(w).Encode(webhookInfoList)
+	}))
+	defer server.Close()
+
+	provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop()})
+	webhookList, err := provider.ListWebhooks(context.Background(), common.OauthContext{AccessToken: "token"}, server.URL, "1")
+	if err != nil {
+		t.Fatalf("ListWebhooks() got error %v, want OK.", err)
+	}
+	if len(webhookList) != 101 {
+		t.Fatalf("ListWebhooks() got %d webhooks, want 101.", len(webhookList))
+	}
+	want := &vcs.Webhook{ID: "101", URL: "https://bytebase.example.com/hook/gitlab/endpoint"}
+	if got := webhookList[100]; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListWebhooks() got the last webhook %+v, want %+v.", got, want)
+	}
+}
+
+func TestCurrentUser(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v4/user" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"message":"401 Unauthorized"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":42,"username":"jdoe","name":"Jane Doe","email":"jdoe@example.com","state":"active"}`))
+	}))
+	defer server.Close()
+
+	provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop()})
+	user, err := provider.CurrentUser(context.Background(), common.OauthContext{AccessToken: "access"}, server.URL)
+	if err != nil {
+		t.Fatalf("CurrentUser() got error %v, want OK.", err)
+	}
+	want := &vcs.ProviderUser{ID: "42", Username: "jdoe", Name: "Jane Doe", Email: "jdoe@example.com"}
+	if !reflect.DeepEqual(user, want) {
+		t.Errorf("CurrentUser() got %+v, want %+v.", user, want)
+	}
+
+	if _, err := provider.CurrentUser(context.Background(), common.OauthContext{AccessToken: "revoked"}, server.URL); common.ErrorCode(err) != common.NotAuthorized {
+		t.Errorf("CurrentUser() with the revoked token got error %v, want not authorized.", err)
+	}
+}
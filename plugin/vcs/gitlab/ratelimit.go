@@ -0,0 +1,188 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bytebase/bytebase/plugin/vcs"
+)
+
+const (
+	// maxRateLimitRetries is the maximum number of retries of a request rejected by 429 Too Many Requests.
+	maxRateLimitRetries = 3
+	// rateLimitSlowdownPercent is the percentage of the remaining requests from which the requests are spread
+	// over the rest of the rate limit window, rather than sent at once.
+	rateLimitSlowdownPercent = 10
+	// maxRateLimitSlowdown is the maximum delay of a request when slowing down.
+	maxRateLimitSlowdown = 10 * time.Second
+	// defaultRetryAfter is the delay of the retry if the 429 response tells neither Retry-After nor RateLimit-Reset.
+	defaultRetryAfter = time.Second
+)
+
+// rateLimiter tracks the rate limit of each GitLab instance from the RateLimit-* and Retry-After response headers,
+// and delays the requests so we slow down before the instance rejects us.
+type rateLimiter struct {
+	mu       sync.Mutex
+	stateMap map[string]*vcs.RateLimit
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// limiter is the rate limiter shared by all requests to the GitLab instances.
+var limiter = newRateLimiter()
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		stateMap: make(map[string]*vcs.RateLimit),
+		now:      time.Now,
+		sleep:    sleepContext,
+	}
+}
+
+// sleepContext sleeps for d, or returns the context error if ctx is done before that.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// get returns a copy of the rate limit state of the instance, or nil if the instance hasn't told its rate limit.
+func (l *rateLimiter) get(instanceURL string) *vcs.RateLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	state, ok := l.stateMap[instanceURL]
+	if !ok {
+		return nil
+	}
+	copied := *state
+	return &copied
+}
+
+// delay returns how long the next request to the instance should wait.
+// It's until the Retry-After of the last 429 response if any. Otherwise, if the remaining requests are running low,
+// the remaining requests are spread over the rest of the rate limit window.
+func (l *rateLimiter) delay(instanceURL string) time.Duration {
+	state := l.get(instanceURL)
+	if state == nil {
+		return 0
+	}
+	now := l.now()
+	if state.RetryAfterTs > now.Unix() {
+		return time.Unix(state.RetryAfterTs, 0).Sub(now)
+	}
+	if state.Limit <= 0 || state.ResetTs <= now.Unix() || state.Remaining*100 > state.Limit*rateLimitSlowdownPercent {
+		return 0
+	}
+	untilReset := time.Unix(state.ResetTs, 0).Sub(now)
+	if state.Remaining <= 0 {
+		return untilReset
+	}
+	delay := untilReset / time.Duration(state.Remaining+1)
+	if delay > maxRateLimitSlowdown {
+		delay = maxRateLimitSlowdown
+	}
+	return delay
+}
+
+// wait delays the next request to the instance. Returns error without waiting if the delay is beyond the context deadline,
+// since the request would fail anyway.
+func (l *rateLimiter) wait(ctx context.Context, instanceURL string) error {
+	delay := l.delay(instanceURL)
+	if delay <= 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && l.now().Add(delay).After(deadline) {
+		return fmt.Errorf("rate limited by GitLab instance %s for %v, beyond the deadline %v", instanceURL, delay, deadline)
+	}
+	return l.sleep(ctx, delay)
+}
+
+// update records the rate limit told by the response headers of the instance.
+func (l *rateLimiter) update(instanceURL string, resp *http.Response) {
+	now := l.now()
+	limit, hasLimit := parseRateLimitHeader(resp.Header, "RateLimit-Limit")
+	remaining, hasRemaining := parseRateLimitHeader(resp.Header, "RateLimit-Remaining")
+	reset, hasReset := parseRateLimitHeader(resp.Header, "RateLimit-Reset")
+	tooManyRequests := resp.StatusCode == http.StatusTooManyRequests
+	if !hasLimit && !hasRemaining && !hasReset && !tooManyRequests {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	state, ok := l.stateMap[instanceURL]
+	if !ok {
+		state = &vcs.RateLimit{}
+		l.stateMap[instanceURL] = state
+	}
+	if hasLimit {
+		state.Limit = limit
+	}
+	if hasRemaining {
+		state.Remaining = remaining
+	}
+	if hasReset {
+		state.ResetTs = int64(reset)
+	}
+	state.RetryAfterTs = 0
+	if tooManyRequests {
+		retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now)
+		switch {
+		case ok:
+			state.RetryAfterTs = now.Add(retryAfter).Unix()
+		case state.ResetTs > now.Unix():
+			state.RetryAfterTs = state.ResetTs
+		default:
+			state.RetryAfterTs = now.Add(defaultRetryAfter).Unix()
+		}
+		// Always wait for a while before the retry, even if Retry-After is 0 or in the past.
+		if state.RetryAfterTs <= now.Unix() {
+			state.RetryAfterTs = now.Unix() + 1
+		}
+	}
+	state.UpdatedTs = now.Unix()
+}
+
+func parseRateLimitHeader(header http.Header, key string) (int, bool) {
+	value := header.Get(key)
+	if value == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// parseRetryAfter parses the Retry-After header, which is either the delay in seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t.Sub(now), true
+	}
+	return 0, false
+}
+
+// RateLimit returns the rate limit state of the GitLab instance, or nil if it hasn't told its rate limit.
+func (provider *Provider) RateLimit(instanceURL string) *vcs.RateLimit {
+	return limiter.get(instanceURL)
+}
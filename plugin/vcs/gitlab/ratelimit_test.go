@@ -0,0 +1,136 @@
+package gitlab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"go.uber.org/zap"
+)
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "2")
+			w.Header().Set("RateLimit-Limit", "600")
+			w.Header().Set("RateLimit-Remaining", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"message":"429 Too Many Requests"}`))
+			return
+		}
+		w.Header().Set("RateLimit-Limit", "600")
+		w.Header().Set("RateLimit-Remaining", "599")
+		_, _ = w.Write([]byte(`{"id":1,"default_branch":"main"}`))
+	}))
+	defer server.Close()
+
+	now := time.Unix(1650000000, 0)
+	var sleeps []time.Duration
+	defer func(original *rateLimiter) { limiter = original }(limiter)
+	limiter = newRateLimiter()
+	limiter.now = func() time.Time { return now }
+	limiter.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		now = now.Add(d)
+		return nil
+	}
+
+	provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop()})
+	branch, err := provider.DefaultBranch(context.Background(), common.OauthContext{AccessToken: "access"}, server.URL, "1")
+	if err != nil {
+		t.Fatalf("DefaultBranch() got error %v, want OK after the retry.", err)
+	}
+	if branch != "main" {
+		t.Errorf("DefaultBranch() got %q, want %q.", branch, "main")
+	}
+	if requests != 2 {
+		t.Errorf("got %d requests, want 2.", requests)
+	}
+	// The retry is delayed by Retry-After rather than sent immediately.
+	if want := []time.Duration{2 * time.Second}; !reflect.DeepEqual(sleeps, want) {
+		t.Errorf("got sleeps %v, want %v.", sleeps, want)
+	}
+	state := provider.RateLimit(server.URL)
+	if state == nil || state.Remaining != 599 || state.RetryAfterTs != 0 {
+		t.Errorf("RateLimit() got %+v, want remaining 599 and no retry after.", state)
+	}
+}
+
+func TestRateLimitRetryAfterBeyondDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	defer func(original *rateLimiter) { limiter = original }(limiter)
+	limiter = newRateLimiter()
+	slept := false
+	limiter.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = true
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	provider := newProvider(vcs.ProviderConfig{Logger: zap.NewNop()})
+	if _, err := provider.DefaultBranch(ctx, common.OauthContext{AccessToken: "access"}, server.URL, "1"); err == nil {
+		t.Errorf("DefaultBranch() got OK, want error since Retry-After is beyond the deadline.")
+	}
+	if slept {
+		t.Errorf("got slept, want failing without waiting beyond the deadline.")
+	}
+}
+
+func TestRateLimitDelay(t *testing.T) {
+	now := time.Unix(1650000000, 0)
+	reset := strconv.FormatInt(now.Add(time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		remaining string
+		want      time.Duration
+	}{
+		{
+			name:      "plenty remaining",
+			remaining: "100",
+			want:      0,
+		},
+		{
+			name:      "running low",
+			remaining: "59",
+			want:      time.Second,
+		},
+		{
+			name:      "capped slowdown",
+			remaining: "1",
+			want:      maxRateLimitSlowdown,
+		},
+		{
+			name:      "exhausted",
+			remaining: "0",
+			want:      time.Minute,
+		},
+	}
+
+	for _, test := range tests {
+		l := newRateLimiter()
+		l.now = func() time.Time { return now }
+		header := http.Header{}
+		header.Set("RateLimit-Limit", "600")
+		header.Set("RateLimit-Remaining", test.remaining)
+		header.Set("RateLimit-Reset", reset)
+		l.update("https://gitlab.example.com", &http.Response{StatusCode: http.StatusOK, Header: header})
+		if got := l.delay("https://gitlab.example.com"); got != test.want {
+			t.Errorf("%q: delay() got %v, want %v.", test.name, got, test.want)
+		}
+	}
+}
@@ -15,3 +15,29 @@ func Branch(ref string) (string, error) {
 
 	return "", fmt.Errorf("invalid Git ref: %s", ref)
 }
+
+// NormalizePathPrefix returns the directory path relative to the repository root, without the leading and trailing slashes,
+// e.g. "/bytebase/" becomes "bytebase". Returns empty for the repository root.
+func NormalizePathPrefix(pathPrefix string) string {
+	pathPrefix = strings.Trim(strings.TrimSpace(pathPrefix), "/")
+	if pathPrefix == "." {
+		return ""
+	}
+	return pathPrefix
+}
+
+// FilterChangedFileList returns the changed files under the directory pathPrefix normalized by NormalizePathPrefix.
+// It's the client-side fallback of the providers not supporting the path-scoped diff.
+func FilterChangedFileList(fileList []*ChangedFile, pathPrefix string) []*ChangedFile {
+	if pathPrefix == "" {
+		return fileList
+	}
+	var filteredList []*ChangedFile
+	for _, file := range fileList {
+		// Match the whole directory name, so "bytebase" doesn't match "bytebase2/...".
+		if strings.HasPrefix(file.Path, pathPrefix+"/") {
+			filteredList = append(filteredList, file)
+		}
+	}
+	return filteredList
+}
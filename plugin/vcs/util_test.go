@@ -1,6 +1,7 @@
 package vcs
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -42,3 +43,53 @@ func TestBranch(t *testing.T) {
 		}
 	}
 }
+
+func TestNormalizePathPrefix(t *testing.T) {
+	tests := []struct {
+		pathPrefix string
+		want       string
+	}{
+		{pathPrefix: "", want: ""},
+		{pathPrefix: "/", want: ""},
+		{pathPrefix: ".", want: ""},
+		{pathPrefix: "bytebase", want: "bytebase"},
+		{pathPrefix: "/bytebase/", want: "bytebase"},
+		{pathPrefix: " bytebase/prod/ ", want: "bytebase/prod"},
+	}
+	for _, test := range tests {
+		if got := NormalizePathPrefix(test.pathPrefix); got != test.want {
+			t.Errorf("NormalizePathPrefix(%q) got %q, want %q.", test.pathPrefix, got, test.want)
+		}
+	}
+}
+
+func TestFilterChangedFileList(t *testing.T) {
+	fileList := []*ChangedFile{
+		{Path: "bytebase/prod/blog__202204150930__migrate__add_users.sql", Added: true},
+		{Path: "bytebase2/prod/blog__202204150930__migrate__add_posts.sql", Added: true},
+		{Path: "bytebase"},
+		{Path: "README.md"},
+	}
+	tests := []struct {
+		pathPrefix string
+		want       []*ChangedFile
+	}{
+		{
+			pathPrefix: "",
+			want:       fileList,
+		},
+		{
+			pathPrefix: "bytebase",
+			want:       fileList[:1],
+		},
+		{
+			pathPrefix: "bytebase/test",
+			want:       nil,
+		},
+	}
+	for _, test := range tests {
+		if got := FilterChangedFileList(fileList, test.pathPrefix); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("FilterChangedFileList(%q) got %+v, want %+v.", test.pathPrefix, got, test.want)
+		}
+	}
+}
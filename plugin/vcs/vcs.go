@@ -2,12 +2,26 @@ package vcs
 
 import (
 	"context"
+	"errors"
 	"sync"
 
 	"github.com/bytebase/bytebase/common"
 	"go.uber.org/zap"
 )
 
+const (
+	// DefaultMaxFileSize is the default maximum size in bytes of a file read from the VCS.
+	DefaultMaxFileSize = 5 * 1024 * 1024
+)
+
+var (
+	// ErrFileTooLarge is returned when the file read from the VCS exceeds the maximum file size.
+	ErrFileTooLarge = errors.New("file exceeds the maximum file size")
+	// ErrTokenInvalid is returned when the VCS rejects refreshing the access token, e.g. the refresh token is revoked.
+	// Retrying doesn't help, the user needs to authorize again.
+	ErrTokenInvalid = errors.New("the oauth token is invalid")
+)
+
 // Type is the type of a VCS.
 type Type string
 
@@ -30,13 +44,14 @@ func (e Type) String() string {
 
 // FileCommit is the API message for a VCS file commit.
 type FileCommit struct {
-	ID         string `json:"id"`
-	Title      string `json:"title"`
-	Message    string `json:"message"`
-	CreatedTs  int64  `json:"createdTs"`
-	URL        string `json:"url"`
-	AuthorName string `json:"authorName"`
-	Added      string `json:"added"`
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Message     string `json:"message"`
+	CreatedTs   int64  `json:"createdTs"`
+	URL         string `json:"url"`
+	AuthorName  string `json:"authorName"`
+	AuthorEmail string `json:"authorEmail"`
+	Added       string `json:"added"`
 }
 
 // FileCommitCreate is the payload for committing a new file.
@@ -45,6 +60,109 @@ type FileCommitCreate struct {
 	Content       string
 	CommitMessage string
 	LastCommitID  string
+	// Optional. The VCS provider uses the authenticated user if empty.
+	Author Author
+}
+
+// Author is the commit author.
+type Author struct {
+	Name  string
+	Email string
+}
+
+// FileChangeAction is the action of a file change in a commit.
+type FileChangeAction string
+
+const (
+	// FileChangeCreate creates a new file.
+	FileChangeCreate FileChangeAction = "create"
+	// FileChangeUpdate updates an existing file.
+	FileChangeUpdate FileChangeAction = "update"
+	// FileChangeDelete deletes an existing file.
+	FileChangeDelete FileChangeAction = "delete"
+)
+
+// FileChange is the API message for a file change in a commit.
+type FileChange struct {
+	Action   FileChangeAction
+	FilePath string
+	// Content is ignored for FileChangeDelete.
+	Content string
+}
+
+// CommitState is the state of a commit status.
+type CommitState string
+
+const (
+	// CommitStatePending means the commit is waiting to be applied.
+	CommitStatePending CommitState = "pending"
+	// CommitStateRunning means the commit is being applied.
+	CommitStateRunning CommitState = "running"
+	// CommitStateSuccess means the commit is applied successfully.
+	CommitStateSuccess CommitState = "success"
+	// CommitStateFailed means the commit fails to apply.
+	CommitStateFailed CommitState = "failed"
+)
+
+const (
+	// DefaultCommitStatusContext is the default context of the commit status reported by Bytebase.
+	DefaultCommitStatusContext = "bytebase/schema"
+	// MaxCommitStatusContextLength is the maximum length of the commit status context accepted by the VCS providers.
+	MaxCommitStatusContextLength = 255
+)
+
+// CommitStatus is the API message for a commit status.
+type CommitStatus struct {
+	State CommitState
+	// Context distinguishes the status from the statuses reported by other systems on the same commit.
+	Context     string
+	TargetURL   string
+	Description string
+}
+
+// OAuthExchange is the API message for exchanging an OAuth authorization code for a token.
+type OAuthExchange struct {
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURL  string
+	// CodeVerifier is the PKCE code verifier whose challenge was sent in the authorization request.
+	CodeVerifier string
+}
+
+// OAuthToken is the API message for the token returned by an OAuth token exchange.
+type OAuthToken struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	// ExpiresTs is 0 if the access token never expires.
+	ExpiresTs int64 `json:"expiresTs"`
+}
+
+// RateLimit is the rate limit state of a VCS instance, tracked from the rate limit headers of its responses.
+type RateLimit struct {
+	// Limit is the maximum number of requests in the rate limit window.
+	Limit int `json:"limit"`
+	// Remaining is the number of requests remaining in the rate limit window.
+	Remaining int `json:"remaining"`
+	// ResetTs is the Unix timestamp in seconds when the rate limit window is reset.
+	ResetTs int64 `json:"resetTs"`
+	// RetryAfterTs is the Unix timestamp in seconds until which the requests are held back after the VCS rejects a request
+	// with 429 Too Many Requests. It's 0 if the last request isn't rejected.
+	RetryAfterTs int64 `json:"retryAfterTs"`
+	// UpdatedTs is the Unix timestamp in seconds when the state is updated by the last response.
+	UpdatedTs int64 `json:"updatedTs"`
+}
+
+// Capabilities are the capabilities of a VCS instance, detected from its version, so the calls adapt to the older
+// self-hosted instances instead of assuming the latest API.
+type Capabilities struct {
+	// Version is the version of the VCS instance, empty if the instance doesn't tell its version.
+	// All capabilities are assumed to be supported then.
+	Version string `json:"version"`
+	// CommitStatus is whether the instance supports setting the commit status. Setting the commit status is skipped otherwise.
+	CommitStatus bool `json:"commitStatus"`
+	// DetectedTs is the Unix timestamp in seconds when the capabilities are detected.
+	DetectedTs int64 `json:"detectedTs"`
 }
 
 // FileMeta records the file metadata.
@@ -52,6 +170,44 @@ type FileMeta struct {
 	LastCommitID string
 }
 
+// Commit is the API message for a VCS commit and the files added by it.
+type Commit struct {
+	ID          string
+	Title       string
+	Message     string
+	CreatedTs   int64
+	URL         string
+	AuthorName  string
+	AuthorEmail string
+	AddedList   []string
+}
+
+// CommitSignature is the signature of a commit, e.g. the GPG signature.
+type CommitSignature struct {
+	// Signed is false if the commit isn't signed, in which case the other fields are empty.
+	Signed bool
+	// Verified is true if the VCS provider verifies the signature by a key of a known user.
+	Verified bool
+	// VerificationStatus is the verification status reported by the VCS provider, e.g. "unverified" or "unknown_key".
+	VerificationStatus string
+	// KeyID is the ID of the key signing the commit.
+	KeyID string
+}
+
+// ChangedFile is a file changed by a commit.
+type ChangedFile struct {
+	Path string
+	// Added is true if the file is added by the commit, rather than modified, renamed or deleted.
+	Added bool
+}
+
+// Webhook is a webhook of the repository at the VCS provider.
+type Webhook struct {
+	ID string
+	// URL is the callback URL of the webhook.
+	URL string
+}
+
 // PushEvent is the API message for a VCS push event.
 type PushEvent struct {
 	VCSType            Type       `json:"vcsType"`
@@ -62,6 +218,9 @@ type PushEvent struct {
 	RepositoryFullPath string     `json:"repositoryFullPath"`
 	AuthorName         string     `json:"authorName"`
 	FileCommit         FileCommit `json:"fileCommit"`
+	// MigrationVersion is the version the added migration file is applied as if it differs from the version in the file path,
+	// e.g. qualified by the branch as resolved by the duplicate version policy of the repository.
+	MigrationVersion string `json:"migrationVersion,omitempty"`
 }
 
 // State is the state of a VCS user account.
@@ -81,6 +240,16 @@ type UserInfo struct {
 	State State  `json:"state"`
 }
 
+// ProviderUser is the user of the VCS provider an access token belongs to.
+type ProviderUser struct {
+	// ID is the immutable ID of the user at the VCS provider.
+	ID string
+	// Username is the login of the user, e.g. "jdoe".
+	Username string
+	Name     string
+	Email    string
+}
+
 // RepositoryMember is the API message for  repository member info.
 type RepositoryMember struct {
 	Email        string             `json:"email"`
@@ -96,11 +265,28 @@ type Provider interface {
 	// Returns the API URL for a given VCS instance URL
 	APIURL(instanceURL string) string
 
+	// Exchanges the OAuth authorization code for a token
+	//
+	// instanceURL: VCS instance URL
+	// oauthExchange: the authorization code and the PKCE code verifier to be exchanged
+	ExchangeOAuthToken(ctx context.Context, instanceURL string, oauthExchange *OAuthExchange) (*OAuthToken, error)
+
+	// Refreshes the access token and stores the new token by oauthCtx.Refresher. Returns ErrTokenInvalid if the VCS rejects the refresh token.
+	//
+	// oauthCtx: OAuth context holding the refresh token
+	// instanceURL: VCS instance URL
+	RefreshToken(ctx context.Context, oauthCtx common.OauthContext, instanceURL string) error
+
 	// Try to use this provider as an auth provider and fetch the user info stored at this provider
 	//
 	// oauthCtx: OAuth context to write the file content
 	// instanceURL: VCS instance URL
 	TryLogin(ctx context.Context, oauthCtx common.OauthContext, instanceURL string) (*UserInfo, error)
+	// Fetches the user the access token belongs to, e.g. to attribute the actions taken by the token to the person.
+	//
+	// oauthCtx: OAuth context holding the access token
+	// instanceURL: VCS instance URL
+	CurrentUser(ctx context.Context, oauthCtx common.OauthContext, instanceURL string) (*ProviderUser, error)
 
 	// Fetch all active members of a given repository
 	//
@@ -109,6 +295,31 @@ type Provider interface {
 	// repositoryID: the repository ID from the external VCS system (note this is NOT the ID of Bytebase's own repository resource)
 	FetchRepositoryActiveMemberList(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string) ([]*RepositoryMember, error)
 
+	// Fetch the default branch of a given repository. Returns NotFound error if the repository doesn't have the default branch, e.g. it's empty.
+	//
+	// oauthCtx: OAuth context to read the repository
+	// instanceURL: VCS instance URL
+	// repositoryID: the repository ID from the external VCS system (note this is NOT the ID of Bytebase's own repository resource)
+	DefaultBranch(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string) (string, error)
+
+	// Checks whether a given repository still exists. Returns false only if the VCS definitively reports the repository not found,
+	// and NotAuthorized error if the VCS rejects the access token, so the auth failures aren't taken as a missing repository.
+	//
+	// oauthCtx: OAuth context to read the repository
+	// instanceURL: VCS instance URL
+	// repositoryID: the repository ID from the external VCS system (note this is NOT the ID of Bytebase's own repository resource)
+	RepositoryExists(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string) (bool, error)
+
+	// Returns the rate limit state of the VCS instance tracked from its responses, or nil if it hasn't told its rate limit.
+	//
+	// instanceURL: VCS instance URL
+	RateLimit(instanceURL string) *RateLimit
+
+	// Returns the capabilities of the VCS instance detected by the earlier calls, or nil if they haven't been detected.
+	//
+	// instanceURL: VCS instance URL
+	Capabilities(instanceURL string) *Capabilities
+
 	// Commits a new file
 	//
 	// oauthCtx: OAuth context to write the file content
@@ -121,7 +332,18 @@ type Provider interface {
 	//
 	// Similar to CreateFile except it overwrites an existing file. The fileCommit shoud includes the "LastCommitID" field which is used to detect conflicting writes.
 	OverwriteFile(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, filePath string, fileCommit FileCommitCreate) error
+	// Commits a list of file changes in a single commit. Returns the commit ID on success.
+	//
+	// oauthCtx: OAuth context to write the file content
+	// instanceURL: VCS instance URL
+	// repositoryID: the repository ID from the external VCS system (note this is NOT the ID of Bytebase's own repository resource)
+	// branch: the branch to commit to
+	// message: the commit message
+	// fileChangeList: the file changes included in the commit
+	// author: the commit author, the VCS provider uses the authenticated user if empty
+	CreateCommit(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, branch string, message string, fileChangeList []FileChange, author Author) (string, error)
 	// Reads the file content. Returns an io.ReadCloser on success. If file does not exist, returns NotFound error.
+	// If the file exceeds the maximum file size of the provider config, returns ErrFileTooLarge without reading the whole file.
 	//
 	// oauthCtx: OAuth context to read the file content
 	// instanceURL: VCS instance URL
@@ -129,6 +351,54 @@ type Provider interface {
 	// filePath: file path to be read
 	// commitID: the specific version to be read
 	ReadFile(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, filePath string, commitID string) (string, error)
+	// Lists the paths of the files directly under the directory, excluding the subdirectories. If the directory does not exist, returns NotFound error.
+	//
+	// oauthCtx: OAuth context to read the directory
+	// instanceURL: VCS instance URL
+	// repositoryID: the repository ID from the external VCS system (note this is NOT the ID of Bytebase's own repository resource)
+	// directory: directory path to be listed
+	// commitID: the specific version to be listed
+	ListFiles(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, directory string, commitID string) ([]string, error)
+	// Lists the paths of the files under the directory, including the files in the subdirectories. If the directory does not exist, returns NotFound error.
+	//
+	// oauthCtx: OAuth context to read the directory
+	// instanceURL: VCS instance URL
+	// repositoryID: the repository ID from the external VCS system (note this is NOT the ID of Bytebase's own repository resource)
+	// directory: directory path to be listed
+	// commitID: the specific version to be listed
+	ListFilesRecursively(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, directory string, commitID string) ([]string, error)
+	// Fetches the commit, without the files changed by it. If the commit does not exist, returns NotFound error.
+	//
+	// oauthCtx: OAuth context to read the commit
+	// instanceURL: VCS instance URL
+	// repositoryID: the repository ID from the external VCS system (note this is NOT the ID of Bytebase's own repository resource)
+	// commitID: the commit to be fetched
+	FetchCommit(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, commitID string) (*Commit, error)
+	// Fetches the files changed by the commit under the directory pathPrefix.
+	// The provider asks the VCS for the path-scoped diff where supported, and otherwise filters the whole diff with FilterChangedFileList.
+	//
+	// oauthCtx: OAuth context to read the commit
+	// instanceURL: VCS instance URL
+	// repositoryID: the repository ID from the external VCS system (note this is NOT the ID of Bytebase's own repository resource)
+	// commitID: the commit to be diffed
+	// pathPrefix: the directory normalized by NormalizePathPrefix, empty for the whole repository
+	CommitDiff(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, commitID string, pathPrefix string) ([]*ChangedFile, error)
+	// Fetches the files changed by the merge request against its target branch under the directory pathPrefix,
+	// the same as CommitDiff. If the merge request does not exist, returns NotFound error.
+	//
+	// oauthCtx: OAuth context to read the merge request
+	// instanceURL: VCS instance URL
+	// repositoryID: the repository ID from the external VCS system (note this is NOT the ID of Bytebase's own repository resource)
+	// mergeRequestID: the merge request ID scoped to the repository from the external VCS system
+	// pathPrefix: the directory normalized by NormalizePathPrefix, empty for the whole repository
+	MergeRequestDiff(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, mergeRequestID int, pathPrefix string) ([]*ChangedFile, error)
+	// Fetches the signature of the commit along with its verification status.
+	//
+	// oauthCtx: OAuth context to read the commit
+	// instanceURL: VCS instance URL
+	// repositoryID: the repository ID from the external VCS system (note this is NOT the ID of Bytebase's own repository resource)
+	// commitID: the commit whose signature is fetched
+	FetchCommitSignature(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, commitID string) (*CommitSignature, error)
 	// Reads the file metadata. Returns the file meta on success.
 	//
 	// Similar to ReadFile except it specifies a branch instead of a commitID.
@@ -140,12 +410,36 @@ type Provider interface {
 	// repositoryID: the repository ID from the external VCS system (note this is NOT the ID of Bytebase's own repository resource)
 	// payload: the webhook payload
 	CreateWebhook(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, payload []byte) (string, error)
+	// Lists all the webhooks of the repository, following all the pages.
+	//
+	// oauthCtx: OAuth context to read the webhooks
+	// instanceURL: VCS instance URL
+	// repositoryID: the repository ID from the external VCS system (note this is NOT the ID of Bytebase's own repository resource)
+	ListWebhooks(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string) ([]*Webhook, error)
 	// Patches a webhook.
 	//
 	// The payload stores the patched field(s).
 	PatchWebhook(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, webhookID string, payload []byte) error
 	// Deletes a webhook.
 	DeleteWebhook(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, webhookID string) error
+
+	// Creates a comment on the merge request, or updates the existing comment containing the marker.
+	//
+	// oauthCtx: OAuth context to write the comment
+	// instanceURL: VCS instance URL
+	// repositoryID: the repository ID from the external VCS system (note this is NOT the ID of Bytebase's own repository resource)
+	// mergeRequestID: the merge request ID scoped to the repository from the external VCS system
+	// marker: the hidden marker identifying the comment, so repeated calls update one comment instead of creating new ones
+	// body: the comment body
+	CreateOrUpdateComment(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, mergeRequestID int, marker string, body string) error
+	// Sets the status of a commit.
+	//
+	// oauthCtx: OAuth context to write the commit status
+	// instanceURL: VCS instance URL
+	// repositoryID: the repository ID from the external VCS system (note this is NOT the ID of Bytebase's own repository resource)
+	// commitID: the commit ID
+	// status: the commit status, a later status with the same context replaces the earlier one
+	SetCommitStatus(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, commitID string, status CommitStatus) error
 }
 
 var (
@@ -156,6 +450,9 @@ var (
 // ProviderConfig is the provider configuration.
 type ProviderConfig struct {
 	Logger *zap.Logger
+	// MaxFileSize is the maximum size in bytes of a file read from the VCS.
+	// DefaultMaxFileSize is used if it's not positive.
+	MaxFileSize int64
 }
 
 type providerFunc func(ProviderConfig) Provider
@@ -0,0 +1,85 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// CustomWebhookMeta is the API message for custom webhook metadata.
+type CustomWebhookMeta struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// CustomWebhook is the API message for custom webhook, which is the webhook context as is.
+type CustomWebhook struct {
+	Level        Level               `json:"level"`
+	Title        string              `json:"title"`
+	Description  string              `json:"description"`
+	Link         string              `json:"link"`
+	CreatorName  string              `json:"creatorName"`
+	CreatorEmail string              `json:"creatorEmail"`
+	CreatedTs    int64               `json:"createdTs"`
+	MetaList     []CustomWebhookMeta `json:"metaList"`
+}
+
+func init() {
+	register(CustomWebhookType, &CustomReceiver{})
+}
+
+// CustomReceiver is the receiver for the custom webhook endpoints accepting the JSON payload.
+type CustomReceiver struct {
+}
+
+func (receiver *CustomReceiver) post(context Context) error {
+	metaList := []CustomWebhookMeta{}
+	for _, meta := range context.MetaList {
+		metaList = append(metaList, CustomWebhookMeta{
+			Name:  meta.Name,
+			Value: meta.Value,
+		})
+	}
+	post := CustomWebhook{
+		Level:        context.Level,
+		Title:        context.Title,
+		Description:  context.Description,
+		Link:         context.Link,
+		CreatorName:  context.CreatorName,
+		CreatorEmail: context.CreatorEmail,
+		CreatedTs:    context.CreatedTs,
+		MetaList:     metaList,
+	}
+	body, err := json.Marshal(post)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook POST request: %v", context.URL)
+	}
+	req, err := http.NewRequest("POST",
+		context.URL, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to construct webhook POST request %v (%w)", context.URL, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{
+		Timeout: timeout,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to POST webhook %+v (%w)", context.URL, err)
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read POST webhook response %v (%w)", context.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to POST webhook %v, status %d: %.100s", context.URL, resp.StatusCode, string(b))
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package webhook
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 )
@@ -14,6 +15,21 @@ var (
 	timeFormat = "2006-01-02 15:04:05"
 )
 
+// CustomWebhookType is the webhook type of the custom webhook endpoints accepting the JSON payload.
+const CustomWebhookType = "bb.plugin.webhook.custom"
+
+// urlPrefixTypeList is the webhook types recognized by the URL prefix.
+var urlPrefixTypeList = []struct {
+	urlPrefix   string
+	webhookType string
+}{
+	{urlPrefix: "https://hooks.slack.com/", webhookType: "bb.plugin.webhook.slack"},
+	{urlPrefix: "https://discord.com/api/webhooks", webhookType: "bb.plugin.webhook.discord"},
+	{urlPrefix: "https://oapi.dingtalk.com", webhookType: "bb.plugin.webhook.dingtalk"},
+	{urlPrefix: "https://open.feishu.cn", webhookType: "bb.plugin.webhook.feishu"},
+	{urlPrefix: "https://qyapi.weixin.qq.com", webhookType: "bb.plugin.webhook.wecom"},
+}
+
 // Meta is the webhook metadata.
 type Meta struct {
 	Name  string
@@ -78,3 +94,14 @@ func Post(webhookType string, context Context) error {
 
 	return r.post(context)
 }
+
+// TypeOfURL returns the webhook type recognized by the URL, e.g. the Slack webhook for "https://hooks.slack.com/services/...".
+// Returns CustomWebhookType if the URL isn't recognized.
+func TypeOfURL(url string) string {
+	for _, item := range urlPrefixTypeList {
+		if strings.HasPrefix(url, item.urlPrefix) {
+			return item.webhookType
+		}
+	}
+	return CustomWebhookType
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/db"
+	"github.com/bytebase/bytebase/plugin/vcs"
+)
+
+// PreviewAffectedDatabases previews the databases the migration file added by the push event would be applied to, staged in the
+// order of the rollout, so that the reviewers know which databases a production push touches before it's applied. The databases
+// are resolved the same way as processing the push event in the webhook, and the tenant mode project is staged by the deployment
+// config referenced by the repository. Unlike SimulatePush, it reads the databases of the project but creates nothing.
+func (s *Server) PreviewAffectedDatabases(ctx context.Context, repositoryID int, pushEvent *vcs.PushEvent) (*api.AffectedDatabasesPreview, error) {
+	repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ID: &repositoryID})
+	if err != nil {
+		return nil, err
+	}
+	if repository == nil {
+		return nil, &common.Error{Code: common.NotFound, Err: fmt.Errorf("repository ID not found: %d", repositoryID)}
+	}
+	if err := s.composeRepositoryRelationship(ctx, repository); err != nil {
+		return nil, err
+	}
+
+	added := pushEvent.FileCommit.Added
+	mi, err := db.ParseMigrationInfo(added, filepath.Join(repository.BaseDirectory, repository.FilePathTemplate))
+	if err != nil {
+		return nil, &common.Error{Code: common.Invalid, Err: err}
+	}
+	preview := &api.AffectedDatabasesPreview{
+		FilePath:      added,
+		MigrationType: mi.Type,
+		Version:       mi.Version,
+	}
+
+	if repository.Project.TenantMode == api.TenantModeTenant {
+		if mi.Environment != "" {
+			return nil, &common.Error{Code: common.Invalid, Err: fmt.Errorf("environment isn't accepted in schema update for tenant mode project")}
+		}
+		databaseList, err := s.DatabaseService.FindDatabaseList(ctx, &api.DatabaseFind{
+			ProjectID: &repository.ProjectID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		deployments, matrix, err := s.getTenantDatabaseMatrix(ctx, repository.ProjectID, repository.DeploymentConfigID, repository.Project.DBNameTemplate, databaseList, mi.Database)
+		if err != nil {
+			return nil, err
+		}
+		preview.StageList = getTenantAffectedStageList(deployments, matrix)
+		return preview, nil
+	}
+
+	branchEnvironment, ok := resolveBranchEnvironment(repository, strings.TrimPrefix(pushEvent.Ref, "refs/heads/"))
+	if !ok {
+		return nil, &common.Error{Code: common.Invalid, Err: fmt.Errorf("ref %q isn't mapped to any environment", pushEvent.Ref)}
+	}
+	databaseList, err := s.resolveDatabaseList(ctx, repository, pushEvent)
+	if err != nil {
+		return nil, &common.Error{Code: common.Invalid, Err: err}
+	}
+	if branchEnvironment != "" {
+		databaseList = filterDatabaseListByEnvironment(databaseList, branchEnvironment)
+	}
+	// Each database is a stage of its own, the same as the pipeline created for the push.
+	for _, database := range databaseList {
+		preview.StageList = append(preview.StageList, &api.AffectedStage{
+			Name:            fmt.Sprintf("%s %s", database.Instance.Environment.Name, database.Name),
+			EnvironmentName: database.Instance.Environment.Name,
+			DatabaseList:    []string{fmt.Sprintf("%s/%s", database.Instance.Environment.Name, database.Name)},
+		})
+	}
+	return preview, nil
+}
+
+// getTenantAffectedStageList returns the stages of the tenant databases matrix staged by the deployments.
+// The databases must be composed with their environments.
+func getTenantAffectedStageList(deployments []*api.Deployment, matrix [][]*api.Database) []*api.AffectedStage {
+	var stageList []*api.AffectedStage
+	for i, databaseList := range matrix {
+		stage := &api.AffectedStage{
+			Name: fmt.Sprintf("Deployment: %s", deployments[i].Name),
+		}
+		for _, database := range databaseList {
+			stage.EnvironmentName = database.Instance.Environment.Name
+			stage.DatabaseList = append(stage.DatabaseList, fmt.Sprintf("%s/%s", database.Instance.Environment.Name, database.Name))
+		}
+		stageList = append(stageList, stage)
+	}
+	return stageList
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+)
+
+func TestGetTenantAffectedStageList(t *testing.T) {
+	newDatabase := func(id int, name string, environmentName string, tenant string) *api.Database {
+		return &api.Database{
+			ID:     id,
+			Name:   name,
+			Labels: fmt.Sprintf(`[{"key":"bb.environment","value":%q},{"key":"bb.tenant","value":%q}]`, environmentName, tenant),
+			Instance: &api.Instance{
+				Environment: &api.Environment{Name: environmentName},
+			},
+		}
+	}
+	databaseList := []*api.Database{
+		newDatabase(1, "blog_acme", "Prod", "acme"),
+		newDatabase(2, "blog_globex", "Prod", "globex"),
+		newDatabase(3, "blog_test", "Staging", "test"),
+		newDatabase(4, "blog_canary", "Prod", "canary"),
+		// The database of another base database name isn't affected.
+		newDatabase(5, "shop_acme", "Prod", "acme"),
+	}
+	schedule := &api.DeploymentSchedule{
+		Deployments: []*api.Deployment{
+			{
+				Name: "Staging",
+				Spec: &api.DeploymentSpec{Selector: &api.LabelSelector{MatchExpressions: []*api.LabelSelectorRequirement{
+					{Key: api.EnvironmentKeyName, Operator: api.InOperatorType, Values: []string{"Staging"}},
+				}}},
+			},
+			{
+				Name: "Prod canary",
+				Spec: &api.DeploymentSpec{Selector: &api.LabelSelector{MatchExpressions: []*api.LabelSelectorRequirement{
+					{Key: api.EnvironmentKeyName, Operator: api.InOperatorType, Values: []string{"Prod"}},
+					{Key: api.TenantLabelKey, Operator: api.InOperatorType, Values: []string{"canary"}},
+				}}},
+			},
+			{
+				Name: "Prod",
+				Spec: &api.DeploymentSpec{Selector: &api.LabelSelector{MatchExpressions: []*api.LabelSelectorRequirement{
+					{Key: api.EnvironmentKeyName, Operator: api.InOperatorType, Values: []string{"Prod"}},
+				}}},
+			},
+			{
+				// The deployment matching no database isn't a stage.
+				Name: "Dev",
+				Spec: &api.DeploymentSpec{Selector: &api.LabelSelector{MatchExpressions: []*api.LabelSelectorRequirement{
+					{Key: api.EnvironmentKeyName, Operator: api.InOperatorType, Values: []string{"Dev"}},
+				}}},
+			},
+		},
+	}
+
+	deployments, matrix, err := getDatabaseMatrixFromDeploymentSchedule(schedule, "blog", "{{DB_NAME}}_{{TENANT}}", databaseList)
+	if err != nil {
+		t.Fatalf("getDatabaseMatrixFromDeploymentSchedule() got error %v, want OK.", err)
+	}
+	got := getTenantAffectedStageList(deployments, matrix)
+	want := []*api.AffectedStage{
+		{
+			Name:            "Deployment: Staging",
+			EnvironmentName: "Staging",
+			DatabaseList:    []string{"Staging/blog_test"},
+		},
+		{
+			Name:            "Deployment: Prod canary",
+			EnvironmentName: "Prod",
+			DatabaseList:    []string{"Prod/blog_canary"},
+		},
+		{
+			Name:            "Deployment: Prod",
+			EnvironmentName: "Prod",
+			DatabaseList:    []string{"Prod/blog_acme", "Prod/blog_globex"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getTenantAffectedStageList() got %+v, want %+v.", got, want)
+	}
+}
@@ -331,6 +331,13 @@ func (s *AnomalyScanner) checkDatabaseAnomaly(ctx context.Context, instance *api
 					Expect:  list[0].Schema,
 					Actual:  schemaBuf.String(),
 				}
+				// The anomaly is reported even if the issue tracking the drift fails to be created.
+				if err := s.server.resolveSchemaDriftIssue(ctx, database, &anomalyPayload); err != nil {
+					s.l.Error("Failed to create schema drift issue",
+						zap.String("instance", instance.Name),
+						zap.String("database", database.Name),
+						zap.Error(err))
+				}
 				payload, err := json.Marshal(anomalyPayload)
 				if err != nil {
 					s.l.Error("Failed to marshal anomaly payload",
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+)
+
+// approveTaskByChain records the approval of the task by the principal against the approval chain of its environment.
+// Returns the task still pending the approval of the outstanding steps, so the scheduler doesn't run it until the chain
+// is satisfied. Returns nil if the task is approved, i.e. the chain is satisfied, or there is no chain, or the plan
+// falls back to the single approval of the approval policy without FeatureCustomApprovalChain.
+func (s *Server) approveTaskByChain(ctx context.Context, task *api.Task, principalID int) (*api.Task, error) {
+	if !s.feature(api.FeatureCustomApprovalChain) {
+		return nil, nil
+	}
+	instance, err := s.InstanceService.FindInstance(ctx, &api.InstanceFind{ID: &task.InstanceID})
+	if err != nil {
+		return nil, err
+	}
+	if instance == nil {
+		return nil, fmt.Errorf("instance ID not found %v", task.InstanceID)
+	}
+	policy, err := s.PolicyService.GetPipelineApprovalPolicy(ctx, instance.EnvironmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get approval policy for environment ID %d: %w", instance.EnvironmentID, err)
+	}
+	if policy.Value != api.PipelineApprovalValueManualAlways || policy.ApprovalChain == nil {
+		return nil, nil
+	}
+
+	member, err := s.MemberService.FindMember(ctx, &api.MemberFind{PrincipalID: &principalID})
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, &common.Error{Code: common.Invalid, Err: fmt.Errorf("principal ID %d isn't a member to approve task %q", principalID, task.Name)}
+	}
+	approvalList, next, err := recordApproval(*policy.ApprovalChain, task.ApprovalList, api.Approval{
+		PrincipalID: principalID,
+		Role:        member.Role,
+		ApprovedTs:  time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	patchedTask, err := s.TaskService.PatchTask(ctx, &api.TaskPatch{
+		ID:           task.ID,
+		UpdaterID:    principalID,
+		ApprovalList: &approvalList,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record the approval of task %q: %w", task.Name, err)
+	}
+	if next == nil {
+		return nil, nil
+	}
+	return patchedTask, nil
+}
+
+// recordApproval appends the approval to the json-encoded approvals of the task if it approves the outstanding step of
+// the chain. Returns the json-encoded approvals and the next outstanding step, nil if the chain is satisfied.
+// Returns EINVALID if the approval doesn't approve the outstanding step, e.g. the principal lacks the role of the step.
+func recordApproval(chain api.ApprovalChain, approvalListJSON string, approval api.Approval) (string, *api.ApprovalStep, error) {
+	var approvalList []api.Approval
+	if approvalListJSON != "" {
+		if err := json.Unmarshal([]byte(approvalListJSON), &approvalList); err != nil {
+			return "", nil, fmt.Errorf("failed to unmarshal approval list %q: %w", approvalListJSON, err)
+		}
+	}
+	step, done := api.NextApprover(chain, approvalList)
+	if done {
+		return approvalListJSON, nil, nil
+	}
+
+	approvalList = append(approvalList, approval)
+	next, done := api.NextApprover(chain, approvalList)
+	if !done && next == step {
+		return "", nil, &common.Error{Code: common.Invalid, Err: fmt.Errorf("approval step %q awaits the approval by a %s who hasn't approved the earlier steps", step.Name, step.Role)}
+	}
+	b, err := json.Marshal(approvalList)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal approval list: %w", err)
+	}
+	return string(b), next, nil
+}
+
+// checkExtraApproval returns EINVALID if the task contains destructive operations and the principal approving it is
+// neither a DBA nor an Owner. The extra approval is required regardless of the approval policy and chain, so it's
+// checked after the chain is satisfied.
+func (s *Server) checkExtraApproval(ctx context.Context, task *api.Task, principalID int) error {
+	required, err := extraApprovalRequired(task)
+	if err != nil {
+		return err
+	}
+	if !required {
+		return nil
+	}
+	member, err := s.MemberService.FindMember(ctx, &api.MemberFind{PrincipalID: &principalID})
+	if err != nil {
+		return err
+	}
+	if member == nil || (member.Role != api.DBA && member.Role != api.Owner) {
+		return &common.Error{Code: common.Invalid, Err: fmt.Errorf("task %q contains destructive operations and requires the approval of a DBA or an Owner", task.Name)}
+	}
+	return nil
+}
+
+// extraApprovalRequired returns true if the task is escalated to require the approval of a DBA or an Owner.
+func extraApprovalRequired(task *api.Task) (bool, error) {
+	if task.Type != api.TaskDatabaseSchemaUpdate {
+		return false, nil
+	}
+	payload := &api.TaskDatabaseSchemaUpdatePayload{}
+	if err := json.Unmarshal([]byte(task.Payload), payload); err != nil {
+		return false, fmt.Errorf("invalid database schema update payload: %w", err)
+	}
+	return payload.ExtraApprovalRequired, nil
+}
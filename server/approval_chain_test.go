@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/db"
+	"go.uber.org/zap"
+
+	enterprise "github.com/bytebase/bytebase/enterprise/api"
+)
+
+func TestRecordApproval(t *testing.T) {
+	chain := api.ApprovalChain{
+		StepList: []*api.ApprovalStep{
+			{Name: "Team lead", Role: api.Developer},
+			{Name: "DBA", Role: api.DBA},
+		},
+	}
+
+	// The task progresses through the chain one approval at a time.
+	approvalList := "[]"
+	approvalList, next, err := recordApproval(chain, approvalList, api.Approval{PrincipalID: 101, Role: api.Developer})
+	if err != nil {
+		t.Fatalf("recordApproval() by the team lead got error %v, want OK.", err)
+	}
+	if next == nil || next.Name != "DBA" {
+		t.Fatalf("recordApproval() by the team lead got next step %+v, want %q.", next, "DBA")
+	}
+
+	// The approvals not approving the outstanding step are rejected.
+	for _, approval := range []api.Approval{
+		{PrincipalID: 102, Role: api.Developer},
+		{PrincipalID: 101, Role: api.DBA},
+	} {
+		if _, _, err := recordApproval(chain, approvalList, approval); common.ErrorCode(err) != common.Invalid {
+			t.Errorf("recordApproval() by %+v got error %v, want EINVALID.", approval, err)
+		}
+	}
+
+	approvalList, next, err = recordApproval(chain, approvalList, api.Approval{PrincipalID: 103, Role: api.DBA})
+	if err != nil {
+		t.Fatalf("recordApproval() by the DBA got error %v, want OK.", err)
+	}
+	if next != nil {
+		t.Errorf("recordApproval() by the DBA got next step %+v, want the chain satisfied.", next)
+	}
+	var got []api.Approval
+	if err := json.Unmarshal([]byte(approvalList), &got); err != nil {
+		t.Fatalf("recordApproval() got malformed approval list %q, error %v.", approvalList, err)
+	}
+	if len(got) != 2 || got[0].PrincipalID != 101 || got[1].PrincipalID != 103 {
+		t.Errorf("recordApproval() got approval list %+v, want the team lead then the DBA.", got)
+	}
+}
+
+type fakeMemberService struct {
+	api.MemberService
+	roleMap map[int]api.Role
+}
+
+func (f *fakeMemberService) FindMember(_ context.Context, find *api.MemberFind) (*api.Member, error) {
+	role, ok := f.roleMap[*find.PrincipalID]
+	if !ok {
+		return nil, nil
+	}
+	return &api.Member{PrincipalID: *find.PrincipalID, Role: role}, nil
+}
+
+func TestCheckExtraApproval(t *testing.T) {
+	const developerID, dbaID, ownerID = 101, 102, 103
+	s := &Server{
+		l:            zap.NewNop(),
+		subscription: &enterprise.Subscription{},
+		MemberService: &fakeMemberService{roleMap: map[int]api.Role{
+			developerID: api.Developer,
+			dbaID:       api.DBA,
+			ownerID:     api.Owner,
+		}},
+	}
+	payload, err := json.Marshal(api.TaskDatabaseSchemaUpdatePayload{
+		MigrationType:         db.Migrate,
+		Statement:             "DROP TABLE t;",
+		ExtraApprovalRequired: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal payload, error %v.", err)
+	}
+	task := &api.Task{
+		ID:      1,
+		Name:    "Update \"db\" schema",
+		Type:    api.TaskDatabaseSchemaUpdate,
+		Status:  api.TaskPendingApproval,
+		Payload: string(payload),
+	}
+
+	// The developer can't clear the escalation by approving the task.
+	_, err = s.changeTaskStatusWithPatch(context.Background(), task, &api.TaskStatusPatch{
+		ID:        task.ID,
+		UpdaterID: developerID,
+		Status:    api.TaskPending,
+	})
+	if common.ErrorCode(err) != common.Invalid {
+		t.Errorf("changeTaskStatusWithPatch() by the developer got error %v, want EINVALID.", err)
+	}
+
+	for _, principalID := range []int{dbaID, ownerID} {
+		if err := s.checkExtraApproval(context.Background(), task, principalID); err != nil {
+			t.Errorf("checkExtraApproval() by principal %d got error %v, want OK.", principalID, err)
+		}
+	}
+
+	// The task without destructive operations doesn't require the extra approval.
+	payload, err = json.Marshal(api.TaskDatabaseSchemaUpdatePayload{MigrationType: db.Migrate, Statement: "CREATE TABLE t (id INT);"})
+	if err != nil {
+		t.Fatalf("failed to marshal payload, error %v.", err)
+	}
+	task.Payload = string(payload)
+	if err := s.checkExtraApproval(context.Background(), task, developerID); err != nil {
+		t.Errorf("checkExtraApproval() without destructive operations got error %v, want OK.", err)
+	}
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/db"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"github.com/google/jsonapi"
+)
+
+// PreviewBulkTemplateUpdate previews updating the file path template and the schema path template of all repositories in the VCS,
+// showing the current and the proposed templates of each repository, and flagging the repositories whose existing migration
+// files wouldn't match the new file path template. The empty template keeps the current one. It only reads from the VCS provider.
+func (s *Server) PreviewBulkTemplateUpdate(ctx context.Context, vcsID int, filePathTemplate string, schemaPathTemplate string) (*api.BulkUpdatePreview, error) {
+	vcsConfig, err := s.VCSService.FindVCS(ctx, &api.VCSFind{ID: &vcsID})
+	if err != nil {
+		return nil, err
+	}
+	if vcsConfig == nil {
+		return nil, &common.Error{Code: common.NotFound, Err: fmt.Errorf("VCS ID not found: %d", vcsID)}
+	}
+	repositoryList, err := s.RepositoryService.FindRepositoryList(ctx, &api.RepositoryFind{VCSID: &vcsID, IncludeSecrets: true})
+	if err != nil {
+		return nil, err
+	}
+
+	provider := vcs.Get(vcsConfig.Type, s.vcsProviderConfig())
+	preview := &api.BulkUpdatePreview{
+		VCSID:              vcsID,
+		FilePathTemplate:   filePathTemplate,
+		SchemaPathTemplate: schemaPathTemplate,
+		RepositoryList:     []*api.RepositoryTemplatePreview{},
+	}
+	for _, repository := range repositoryList {
+		if err := s.composeRepositoryRelationship(ctx, repository); err != nil {
+			return nil, err
+		}
+		oauthCtx := common.OauthContext{
+			ClientID:     repository.VCS.ApplicationID,
+			ClientSecret: repository.VCS.Secret,
+			AccessToken:  repository.AccessToken,
+			RefreshToken: repository.RefreshToken,
+			Refresher:    s.refreshToken(ctx, repository),
+		}
+		preview.RepositoryList = append(preview.RepositoryList, previewTemplateUpdate(ctx, provider, oauthCtx, repository, filePathTemplate, schemaPathTemplate))
+	}
+	return preview, nil
+}
+
+// unmarshalBulkTemplateUpdate unmarshals the bulk template update request, returning the IDs of the confirmed repositories.
+func unmarshalBulkTemplateUpdate(body io.Reader) (*api.BulkTemplateUpdate, []int, error) {
+	templateUpdate := &api.BulkTemplateUpdate{}
+	if err := jsonapi.UnmarshalPayload(body, templateUpdate); err != nil {
+		return nil, nil, err
+	}
+	var idList []int
+	for _, idString := range templateUpdate.RepositoryIDList {
+		id, err := strconv.Atoi(idString)
+		if err != nil {
+			return nil, nil, fmt.Errorf("repository ID is not a number: %s", idString)
+		}
+		idList = append(idList, id)
+	}
+	return templateUpdate, idList, nil
+}
+
+// ApplyBulkTemplateUpdate updates the templates of the repositories in the VCS confirmed from the preview in a single transaction.
+// The preview is taken again, so the confirmed repository broken by the files pushed since the preview is rejected as well.
+func (s *Server) ApplyBulkTemplateUpdate(ctx context.Context, vcsID int, filePathTemplate string, schemaPathTemplate string, confirmedIDList []int, updaterID int) ([]*api.Repository, error) {
+	preview, err := s.PreviewBulkTemplateUpdate(ctx, vcsID, filePathTemplate, schemaPathTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return s.applyBulkTemplateUpdate(ctx, preview, confirmedIDList, updaterID)
+}
+
+// applyBulkTemplateUpdate patches the proposed templates of the confirmed repositories in the preview. The repositories not
+// confirmed are left as is, and it fails without patching any repository if a confirmed repository isn't in the preview or
+// would break.
+func (s *Server) applyBulkTemplateUpdate(ctx context.Context, preview *api.BulkUpdatePreview, confirmedIDList []int, updaterID int) ([]*api.Repository, error) {
+	repositoryPreviewMap := make(map[int]*api.RepositoryTemplatePreview)
+	for _, repositoryPreview := range preview.RepositoryList {
+		repositoryPreviewMap[repositoryPreview.RepositoryID] = repositoryPreview
+	}
+	var patchList []*api.RepositoryPatch
+	for _, id := range confirmedIDList {
+		repositoryPreview, ok := repositoryPreviewMap[id]
+		if !ok {
+			return nil, &common.Error{Code: common.Invalid, Err: fmt.Errorf("repository %d isn't in VCS %d", id, preview.VCSID)}
+		}
+		if repositoryPreview.WouldBreak {
+			return nil, &common.Error{Code: common.Invalid, Err: fmt.Errorf("repository %s would break by the new templates: %s", repositoryPreview.FullPath, repositoryPreview.Message)}
+		}
+		patchList = append(patchList, &api.RepositoryPatch{
+			ID:                 id,
+			UpdaterID:          updaterID,
+			FilePathTemplate:   &repositoryPreview.ProposedFilePathTemplate,
+			SchemaPathTemplate: &repositoryPreview.ProposedSchemaPathTemplate,
+		})
+	}
+	if len(patchList) == 0 {
+		return []*api.Repository{}, nil
+	}
+	return s.RepositoryService.PatchRepositoryList(ctx, patchList)
+}
+
+// previewTemplateUpdate previews updating the templates of the repository. The existing migration files are the files under
+// the base directory matching the current file path template at the branch the pushes are synced from.
+// The repository must be composed with its VCS and project.
+func previewTemplateUpdate(ctx context.Context, provider vcs.Provider, oauthCtx common.OauthContext, repository *api.Repository, filePathTemplate string, schemaPathTemplate string) *api.RepositoryTemplatePreview {
+	preview := &api.RepositoryTemplatePreview{
+		RepositoryID:               repository.ID,
+		FullPath:                   repository.FullPath,
+		CurrentFilePathTemplate:    repository.FilePathTemplate,
+		ProposedFilePathTemplate:   repository.FilePathTemplate,
+		CurrentSchemaPathTemplate:  repository.SchemaPathTemplate,
+		ProposedSchemaPathTemplate: repository.SchemaPathTemplate,
+		UnmatchedFileList:          []string{},
+	}
+	if filePathTemplate != "" {
+		preview.ProposedFilePathTemplate = filePathTemplate
+	}
+	if schemaPathTemplate != "" {
+		preview.ProposedSchemaPathTemplate = schemaPathTemplate
+	}
+
+	if err := api.ValidateRepositoryFilePathTemplate(preview.ProposedFilePathTemplate, repository.Project.TenantMode); err != nil {
+		preview.WouldBreak = true
+		preview.Message = err.Error()
+		return preview
+	}
+	if err := api.ValidateRepositorySchemaPathTemplate(preview.ProposedSchemaPathTemplate, repository.Project.TenantMode); err != nil {
+		preview.WouldBreak = true
+		preview.Message = err.Error()
+		return preview
+	}
+	if preview.ProposedFilePathTemplate == preview.CurrentFilePathTemplate {
+		return preview
+	}
+
+	branch, err := resolveReplayBranch(repository, "")
+	if err != nil {
+		branch, err = provider.DefaultBranch(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID)
+		if err != nil {
+			preview.WouldBreak = true
+			preview.Message = fmt.Sprintf("failed to resolve the branch to list the migration files: %v", err)
+			return preview
+		}
+	}
+	filePathList, err := provider.ListFilesRecursively(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID, repository.BaseDirectory, branch)
+	if err != nil && common.ErrorCode(err) != common.NotFound {
+		preview.WouldBreak = true
+		preview.Message = fmt.Sprintf("failed to list the migration files at branch %q: %v", branch, err)
+		return preview
+	}
+	for _, filePath := range filePathList {
+		if _, err := db.ParseMigrationInfo(filePath, path.Join(repository.BaseDirectory, preview.CurrentFilePathTemplate)); err != nil {
+			continue
+		}
+		if _, err := db.ParseMigrationInfo(filePath, path.Join(repository.BaseDirectory, preview.ProposedFilePathTemplate)); err != nil {
+			preview.UnmatchedFileList = append(preview.UnmatchedFileList, filePath)
+		}
+	}
+	if len(preview.UnmatchedFileList) > 0 {
+		preview.WouldBreak = true
+		preview.Message = fmt.Sprintf("%d existing migration files wouldn't match the new file path template", len(preview.UnmatchedFileList))
+	}
+	return preview
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	bulkCurrentTemplate  = "{{ENV_NAME}}/{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql"
+	bulkProposedTemplate = "{{ENV_NAME}}/{{DB_NAME}}/{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql"
+)
+
+// fakeTreeProvider serves the files of the repositories keyed by the external ID. The repository without files has no base directory.
+type fakeTreeProvider struct {
+	vcs.Provider
+	fileMap map[string][]string
+}
+
+func (p *fakeTreeProvider) ListFilesRecursively(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, directory string, commitID string) ([]string, error) {
+	fileList, ok := p.fileMap[repositoryID]
+	if !ok {
+		return nil, common.Errorf(common.NotFound, fmt.Errorf("directory %s not found", directory))
+	}
+	return fileList, nil
+}
+
+func (f *fakeRepositoryService) PatchRepositoryList(ctx context.Context, patchList []*api.RepositoryPatch) ([]*api.Repository, error) {
+	var list []*api.Repository
+	for _, patch := range patchList {
+		for _, repository := range f.repositoryList {
+			if repository.ID == patch.ID {
+				repository.FilePathTemplate = *patch.FilePathTemplate
+				repository.SchemaPathTemplate = *patch.SchemaPathTemplate
+				list = append(list, repository)
+			}
+		}
+	}
+	return list, nil
+}
+
+func TestPreviewTemplateUpdate(t *testing.T) {
+	provider := &fakeTreeProvider{
+		fileMap: map[string][]string{
+			"1": {"bytebase/README.md", "bytebase/prod/blog__202204150900__migrate__add_post.sql"},
+		},
+	}
+
+	tests := []struct {
+		name             string
+		externalID       string
+		filePathTemplate string
+		wantUnmatched    []string
+		wantBreak        bool
+	}{
+		{
+			name:             "existing migration file wouldn't match",
+			externalID:       "1",
+			filePathTemplate: bulkProposedTemplate,
+			wantUnmatched:    []string{"bytebase/prod/blog__202204150900__migrate__add_post.sql"},
+			wantBreak:        true,
+		},
+		{
+			name:             "no existing migration file",
+			externalID:       "2",
+			filePathTemplate: bulkProposedTemplate,
+			wantUnmatched:    []string{},
+			wantBreak:        false,
+		},
+		{
+			name:             "file path template kept",
+			externalID:       "1",
+			filePathTemplate: "",
+			wantUnmatched:    []string{},
+			wantBreak:        false,
+		},
+		{
+			name:             "invalid template",
+			externalID:       "2",
+			filePathTemplate: "{{ENV_NAME}}/{{DB_NAME}}.sql",
+			wantUnmatched:    []string{},
+			wantBreak:        true,
+		},
+	}
+
+	for _, test := range tests {
+		repository := &api.Repository{
+			ID:               1,
+			ExternalID:       test.externalID,
+			BranchFilter:     "main",
+			BaseDirectory:    "bytebase",
+			FilePathTemplate: bulkCurrentTemplate,
+			VCS:              &api.VCS{},
+			Project:          &api.Project{TenantMode: api.TenantModeDisabled},
+		}
+		preview := previewTemplateUpdate(context.Background(), provider, common.OauthContext{}, repository, test.filePathTemplate, "{{ENV_NAME}}/{{DB_NAME}}__LATEST.sql")
+		if preview.WouldBreak != test.wantBreak || !reflect.DeepEqual(preview.UnmatchedFileList, test.wantUnmatched) {
+			t.Errorf("%q: previewTemplateUpdate() got would break %v with unmatched files %v, want %v with %v.", test.name, preview.WouldBreak, preview.UnmatchedFileList, test.wantBreak, test.wantUnmatched)
+		}
+		if preview.CurrentFilePathTemplate != bulkCurrentTemplate || preview.ProposedSchemaPathTemplate != "{{ENV_NAME}}/{{DB_NAME}}__LATEST.sql" {
+			t.Errorf("%q: previewTemplateUpdate() got %+v, want the current file path template and the proposed schema path template.", test.name, preview)
+		}
+	}
+}
+
+func TestApplyBulkTemplateUpdate(t *testing.T) {
+	repositoryService := &fakeRepositoryService{
+		repositoryList: []*api.Repository{
+			{ID: 1, FullPath: "bytebase/blog", FilePathTemplate: bulkCurrentTemplate},
+			{ID: 2, FullPath: "bytebase/shop", FilePathTemplate: bulkCurrentTemplate},
+			{ID: 3, FullPath: "bytebase/crm", FilePathTemplate: bulkCurrentTemplate},
+		},
+	}
+	s := &Server{RepositoryService: repositoryService}
+	preview := &api.BulkUpdatePreview{
+		VCSID:            1,
+		FilePathTemplate: bulkProposedTemplate,
+		RepositoryList: []*api.RepositoryTemplatePreview{
+			{RepositoryID: 1, FullPath: "bytebase/blog", ProposedFilePathTemplate: bulkProposedTemplate, WouldBreak: true, Message: "1 existing migration files wouldn't match the new file path template"},
+			{RepositoryID: 2, FullPath: "bytebase/shop", ProposedFilePathTemplate: bulkProposedTemplate},
+			{RepositoryID: 3, FullPath: "bytebase/crm", ProposedFilePathTemplate: bulkProposedTemplate},
+		},
+	}
+	wantTemplates := func(step string, want ...string) {
+		for i, repository := range repositoryService.repositoryList {
+			if repository.FilePathTemplate != want[i] {
+				t.Errorf("%s: repository %d got file path template %q, want %q.", step, repository.ID, repository.FilePathTemplate, want[i])
+			}
+		}
+	}
+
+	// Confirming the repository that would break rejects the whole update.
+	if _, err := s.applyBulkTemplateUpdate(context.Background(), preview, []int{1, 2}, 101); common.ErrorCode(err) != common.Invalid {
+		t.Errorf("applyBulkTemplateUpdate() confirming the would-break repository got error %v, want invalid.", err)
+	}
+	// The repository of another VCS isn't updated.
+	if _, err := s.applyBulkTemplateUpdate(context.Background(), preview, []int{2, 4}, 101); common.ErrorCode(err) != common.Invalid {
+		t.Errorf("applyBulkTemplateUpdate() confirming the repository not in the preview got error %v, want invalid.", err)
+	}
+	wantTemplates("rejected", bulkCurrentTemplate, bulkCurrentTemplate, bulkCurrentTemplate)
+
+	list, err := s.applyBulkTemplateUpdate(context.Background(), preview, []int{2}, 101)
+	if err != nil {
+		t.Fatalf("applyBulkTemplateUpdate() got error %v, want OK.", err)
+	}
+	if len(list) != 1 || list[0].ID != 2 {
+		t.Errorf("applyBulkTemplateUpdate() got %v, want repository 2 updated only.", list)
+	}
+	wantTemplates("applied", bulkCurrentTemplate, bulkProposedTemplate, bulkCurrentTemplate)
+}
+
+// fakeVCSService finds no VCS.
+type fakeVCSService struct {
+	api.VCSService
+}
+
+func (*fakeVCSService) FindVCS(ctx context.Context, find *api.VCSFind) (*api.VCS, error) {
+	return nil, nil
+}
+
+func TestBulkTemplateUpdateRoute(t *testing.T) {
+	s := &Server{l: zap.NewNop(), e: echo.New(), VCSService: &fakeVCSService{}}
+	g := s.e.Group("/api")
+	g.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(getPrincipalIDContextKey(), 101)
+			return next(c)
+		}
+	})
+	s.registerVCSRoutes(g)
+
+	tests := []struct {
+		name             string
+		repositoryIDList string
+		wantCode         int
+	}{
+		{
+			name:             "confirmed repositories",
+			repositoryIDList: `["1","2"]`,
+			// The confirmed IDs are unmarshalled, and the update fails for the VCS not found.
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:             "no confirmed repository",
+			repositoryIDList: `[]`,
+			wantCode:         http.StatusBadRequest,
+		},
+		{
+			name:             "repository ID not a number",
+			repositoryIDList: `["blog"]`,
+			wantCode:         http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		body := fmt.Sprintf(`{"data":{"type":"bulkTemplateUpdate","attributes":{"filePathTemplate":%q,"repositoryIdList":%s}}}`, bulkProposedTemplate, test.repositoryIDList)
+		req := httptest.NewRequest(http.MethodPost, "/api/vcs/1/repository/template", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		s.e.ServeHTTP(rec, req)
+		if rec.Code != test.wantCode {
+			t.Errorf("%q: got status %d body %q, want %d.", test.name, rec.Code, rec.Body.String(), test.wantCode)
+		}
+	}
+}
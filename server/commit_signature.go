@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"github.com/bytebase/bytebase/plugin/vcs/gitlab"
+	"go.uber.org/zap"
+)
+
+// checkCommitSignature returns the reason to reject the commit if the repository requires the signed commits, and the
+// signature of the commit isn't verified by the VCS provider. Returns empty if the commit is accepted.
+// The commit is rejected as well if its signature can't be fetched, since it can't be told to be trusted.
+func checkCommitSignature(ctx context.Context, provider vcs.Provider, oauthCtx common.OauthContext, repository *api.Repository, commitID string) string {
+	if !repository.RequireSignedCommits {
+		return ""
+	}
+	signature, err := provider.FetchCommitSignature(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID, commitID)
+	if err != nil {
+		return fmt.Sprintf("failed to verify the commit signature, %s", err.Error())
+	}
+	if !signature.Signed {
+		return "the commit isn't signed"
+	}
+	if !signature.Verified {
+		return fmt.Sprintf("the commit signature by key %q isn't verified, the verification status is %q", signature.KeyID, signature.VerificationStatus)
+	}
+	return ""
+}
+
+// verifyPushedCommit returns the reason to reject the pushed commit by its signature, and records the rejection
+// in a WARNING project activity. Returns empty if the commit is accepted.
+func (s *Server) verifyPushedCommit(ctx context.Context, repository *api.Repository, pushEvent *gitlab.WebhookPushEvent, commit gitlab.WebhookCommit) string {
+	reason := checkCommitSignature(
+		ctx,
+		vcs.Get(repository.VCS.Type, s.vcsProviderConfig()),
+		common.OauthContext{
+			ClientID:     repository.VCS.ApplicationID,
+			ClientSecret: repository.VCS.Secret,
+			AccessToken:  repository.AccessToken,
+			RefreshToken: repository.RefreshToken,
+			Refresher:    s.refreshToken(ctx, repository),
+		},
+		repository,
+		commit.ID,
+	)
+	if reason == "" {
+		return ""
+	}
+
+	s.l.Warn("Rejected pushed commit by its signature.", zap.String("commit", commit.ID), zap.String("reason", reason))
+	createdTime, _ := time.Parse(time.RFC3339, commit.Timestamp)
+	bytes, err := json.Marshal(api.ActivityProjectRepositoryPushPayload{
+		VCSPushEvent: composeVCSPushEvent(repository, pushEvent, commit, "", createdTime),
+	})
+	if err != nil {
+		s.l.Warn("Failed to construct project activity payload to record rejected commit", zap.Error(err))
+		return reason
+	}
+	activityCreate := &api.ActivityCreate{
+		CreatorID:   api.SystemBotID,
+		ContainerID: repository.ProjectID,
+		Type:        api.ActivityProjectRepositoryPush,
+		Level:       api.ActivityWarn,
+		Comment:     fmt.Sprintf("Rejected commit %s since the repository requires signed commits, %s. Its committed files are ignored.", commit.ID, reason),
+		Payload:     string(bytes),
+	}
+	if _, err := s.ActivityManager.CreateActivity(ctx, activityCreate, &ActivityMeta{}); err != nil {
+		s.l.Warn("Failed to create project activity to record rejected commit", zap.Error(err))
+	}
+	return reason
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+)
+
+// fakeSignatureProvider returns the signature of the commit by its ID, and records the commits it's asked for.
+type fakeSignatureProvider struct {
+	vcs.Provider
+	signatureMap map[string]*vcs.CommitSignature
+	fetchedList  []string
+}
+
+func (p *fakeSignatureProvider) FetchCommitSignature(_ context.Context, _ common.OauthContext, _, _, commitID string) (*vcs.CommitSignature, error) {
+	p.fetchedList = append(p.fetchedList, commitID)
+	return p.signatureMap[commitID], nil
+}
+
+func TestCheckCommitSignature(t *testing.T) {
+	signatureMap := map[string]*vcs.CommitSignature{
+		"unsigned":   {},
+		"unverified": {Signed: true, VerificationStatus: "unknown_key", KeyID: "ABCD1234"},
+		"verified":   {Signed: true, Verified: true, VerificationStatus: "verified", KeyID: "ABCD1234"},
+	}
+
+	tests := []struct {
+		commitID             string
+		requireSignedCommits bool
+		wantRejected         bool
+	}{
+		{commitID: "unsigned", requireSignedCommits: false, wantRejected: false},
+		{commitID: "unverified", requireSignedCommits: false, wantRejected: false},
+		{commitID: "unsigned", requireSignedCommits: true, wantRejected: true},
+		{commitID: "unverified", requireSignedCommits: true, wantRejected: true},
+		{commitID: "verified", requireSignedCommits: true, wantRejected: false},
+	}
+
+	for _, test := range tests {
+		provider := &fakeSignatureProvider{signatureMap: signatureMap}
+		repository := &api.Repository{
+			VCS:                  &api.VCS{},
+			RequireSignedCommits: test.requireSignedCommits,
+		}
+		reason := checkCommitSignature(context.Background(), provider, common.OauthContext{}, repository, test.commitID)
+		if rejected := reason != ""; rejected != test.wantRejected {
+			t.Errorf("%q: checkCommitSignature() with requireSignedCommits %v got reason %q, want rejected %v.", test.commitID, test.requireSignedCommits, reason, test.wantRejected)
+		}
+		// The signature isn't fetched unless the repository requires the signed commits.
+		if !test.requireSignedCommits && len(provider.fetchedList) != 0 {
+			t.Errorf("%q: checkCommitSignature() fetched the signature %v, want none.", test.commitID, provider.fetchedList)
+		}
+	}
+}
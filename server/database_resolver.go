@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/db"
+	"github.com/bytebase/bytebase/plugin/vcs"
+)
+
+// DatabaseResolver resolves the databases the migration file added by the push event applies to, so that the orgs can
+// target the databases by their own rules, e.g. by the team owning the databases that the commit author belongs to.
+// It's not consulted for the tenant mode projects, whose databases are selected by the deployment config.
+type DatabaseResolver interface {
+	// Resolve returns the databases of the project linked to the repository that the migration file pushed by pushEvent
+	// applies to. Returns error if none of the databases matches.
+	Resolve(ctx context.Context, repository *api.Repository, pushEvent *vcs.PushEvent) ([]*api.Database, error)
+}
+
+// pathDatabaseResolver is the default DatabaseResolver resolving the databases by the database name and the environment
+// name in the path of the migration file.
+type pathDatabaseResolver struct {
+	findDatabaseList func(ctx context.Context, find *api.DatabaseFind) ([]*api.Database, error)
+}
+
+func (r *pathDatabaseResolver) Resolve(ctx context.Context, repository *api.Repository, pushEvent *vcs.PushEvent) ([]*api.Database, error) {
+	added := pushEvent.FileCommit.Added
+	mi, err := db.ParseMigrationInfo(added, filepath.Join(repository.BaseDirectory, repository.FilePathTemplate))
+	if err != nil {
+		return nil, err
+	}
+
+	// We support 3 patterns on how to organize the schema files.
+	// Pattern 1: 	The database name is the same across all environments. Each environment will have its own directory, so the
+	//              schema file looks like "dev/v1__db1", "staging/v1__db1".
+	//
+	// Pattern 2: 	Like 1, the database name is the same across all environments. All environment shares the same schema file,
+	//              say v1__db1, when a new file is added like v2__db1__add_column, we will create a multi stage pipeline where
+	//              each stage corresponds to an environment.
+	//
+	// Pattern 3:  	The database name is different among different environments. In such case, the database name alone is enough
+	//             	to identify ambiguity.
+	databaseList, err := r.findDatabaseList(ctx, &api.DatabaseFind{
+		ProjectID: &repository.ProjectID,
+		Name:      &mi.Database,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find database matching database %q referenced by the committed file", mi.Database)
+	} else if len(databaseList) == 0 {
+		return nil, fmt.Errorf("project ID %d does not own database %q referenced by the committed file", repository.ProjectID, mi.Database)
+	}
+
+	// Further scope to the single database in the environment if applicable.
+	if mi.Environment != "" {
+		database, err := api.MatchPathToDatabase(added, repository.FilePathTemplate, repository.BaseDirectory, databaseList)
+		if err != nil {
+			return nil, err
+		}
+		return []*api.Database{database}, nil
+	}
+	return databaseList, nil
+}
+
+// SetDatabaseResolver sets the resolver of the databases the pushed migration files apply to. Without the resolver,
+// the databases are resolved by the path of the migration file.
+func (s *Server) SetDatabaseResolver(resolver DatabaseResolver) {
+	s.databaseResolver = resolver
+}
+
+// resolveDatabaseList returns the databases the migration file pushed by pushEvent applies to by the configured resolver.
+func (s *Server) resolveDatabaseList(ctx context.Context, repository *api.Repository, pushEvent *vcs.PushEvent) ([]*api.Database, error) {
+	resolver := s.databaseResolver
+	if resolver == nil {
+		resolver = &pathDatabaseResolver{findDatabaseList: s.composeDatabaseListByFind}
+	}
+	return resolver.Resolve(ctx, repository, pushEvent)
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/vcs"
+)
+
+// fakeTeamDatabaseResolver resolves the databases owned by the team of the commit author.
+type fakeTeamDatabaseResolver struct {
+	teamDatabaseMap map[string][]*api.Database
+}
+
+func (r *fakeTeamDatabaseResolver) Resolve(_ context.Context, _ *api.Repository, pushEvent *vcs.PushEvent) ([]*api.Database, error) {
+	return r.teamDatabaseMap[pushEvent.FileCommit.AuthorName], nil
+}
+
+func TestPathDatabaseResolver(t *testing.T) {
+	dev := &api.Environment{Name: "Dev"}
+	prod := &api.Environment{Name: "Prod"}
+	devBlog := &api.Database{ID: 1, Name: "blog", Instance: &api.Instance{Name: "dev-instance", Environment: dev}}
+	prodBlog := &api.Database{ID: 2, Name: "blog", Instance: &api.Instance{Name: "prod-instance", Environment: prod}}
+	resolver := &pathDatabaseResolver{
+		findDatabaseList: func(_ context.Context, find *api.DatabaseFind) ([]*api.Database, error) {
+			if *find.Name == "blog" {
+				return []*api.Database{devBlog, prodBlog}, nil
+			}
+			return nil, nil
+		},
+	}
+
+	tests := []struct {
+		name             string
+		filePathTemplate string
+		added            string
+		want             []*api.Database
+		wantErr          bool
+	}{
+		{
+			name:             "database in all environments",
+			filePathTemplate: "{{DB_NAME}}__{{VERSION}}__{{TYPE}}.sql",
+			added:            "bytebase/blog__202204150930__migrate.sql",
+			want:             []*api.Database{devBlog, prodBlog},
+		},
+		{
+			name:             "database in the environment",
+			filePathTemplate: "{{ENV_NAME}}/{{DB_NAME}}__{{VERSION}}__{{TYPE}}.sql",
+			added:            "bytebase/prod/blog__202204150930__migrate.sql",
+			want:             []*api.Database{prodBlog},
+		},
+		{
+			name:             "database not owned by the project",
+			filePathTemplate: "{{DB_NAME}}__{{VERSION}}__{{TYPE}}.sql",
+			added:            "bytebase/shop__202204150930__migrate.sql",
+			wantErr:          true,
+		},
+	}
+
+	for _, test := range tests {
+		repository := &api.Repository{
+			ProjectID:        101,
+			BaseDirectory:    "bytebase",
+			FilePathTemplate: test.filePathTemplate,
+		}
+		pushEvent := &vcs.PushEvent{FileCommit: vcs.FileCommit{Added: test.added}}
+		databaseList, err := resolver.Resolve(context.Background(), repository, pushEvent)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%q: Resolve() got %v, want error.", test.name, databaseList)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: Resolve() got error %v, want OK.", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(databaseList, test.want) {
+			t.Errorf("%q: Resolve() got %v, want %v.", test.name, databaseList, test.want)
+		}
+	}
+}
+
+func TestResolveDatabaseListByCustomResolver(t *testing.T) {
+	payments := &api.Database{ID: 1, Name: "payments"}
+	ledger := &api.Database{ID: 2, Name: "ledger"}
+	s := &Server{}
+	s.SetDatabaseResolver(&fakeTeamDatabaseResolver{
+		teamDatabaseMap: map[string][]*api.Database{
+			"alice": {payments, ledger},
+		},
+	})
+
+	// The file path names a database the project doesn't own, which the custom resolver ignores.
+	repository := &api.Repository{
+		ProjectID:        101,
+		FilePathTemplate: "{{DB_NAME}}__{{VERSION}}__{{TYPE}}.sql",
+	}
+	pushEvent := &vcs.PushEvent{
+		FileCommit: vcs.FileCommit{
+			AuthorName: "alice",
+			Added:      "shop__202204150930__migrate.sql",
+		},
+	}
+	databaseList, err := s.resolveDatabaseList(context.Background(), repository, pushEvent)
+	if err != nil {
+		t.Fatalf("resolveDatabaseList() got error %v, want OK.", err)
+	}
+	if want := []*api.Database{payments, ledger}; !reflect.DeepEqual(databaseList, want) {
+		t.Errorf("resolveDatabaseList() got %v, want %v.", databaseList, want)
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/db"
+	"go.uber.org/zap"
+)
+
+// versionQualifierReg matches the characters not allowed in the qualifier of the migration version.
+var versionQualifierReg = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// migrationVersionClaim is a migration file claiming a version of a database, pushed to a branch by a commit.
+type migrationVersionClaim struct {
+	ref       string
+	commitID  string
+	commitTs  int64
+	statement string
+}
+
+// resolveDuplicateVersion resolves the version the pushed migration file is applied as by the duplicate version policy,
+// given the migration files already applied as the same version. The applied files with the same content are the same
+// migration pushed again rather than the duplicates, which are left to the migration history to tell.
+// Returns error if the pushed file isn't applied.
+func resolveDuplicateVersion(policy api.DuplicateVersionPolicy, version string, pushed *migrationVersionClaim, appliedList []*migrationVersionClaim) (string, error) {
+	var duplicateList []*migrationVersionClaim
+	for _, applied := range appliedList {
+		if applied.statement != pushed.statement {
+			duplicateList = append(duplicateList, applied)
+		}
+	}
+	if len(duplicateList) == 0 {
+		return version, nil
+	}
+
+	switch policy {
+	case api.DuplicateVersionLatestWins:
+		for _, duplicate := range duplicateList {
+			if duplicate.commitTs >= pushed.commitTs {
+				return "", fmt.Errorf("version %s is superseded by the later commit %s on %q already applied", version, duplicate.commitID, duplicate.ref)
+			}
+		}
+		// The version is taken by the older commit, so the latest one is applied as the version qualified by the commit.
+		return qualifyMigrationVersion(version, shortCommitID(pushed.commitID)), nil
+	case api.DuplicateVersionBranchScoped:
+		for _, duplicate := range duplicateList {
+			if duplicate.ref == pushed.ref {
+				return "", fmt.Errorf("version %s is already applied from commit %s on the same %q with different content", version, duplicate.commitID, duplicate.ref)
+			}
+		}
+		return qualifyMigrationVersion(version, strings.TrimPrefix(pushed.ref, "refs/heads/")), nil
+	}
+	duplicate := duplicateList[0]
+	return "", fmt.Errorf("version %s is already applied from commit %s on %q with different content", version, duplicate.commitID, duplicate.ref)
+}
+
+// qualifyMigrationVersion returns the version qualified by the qualifier, e.g. "0001.feature_x" for "0001" and "feature/x".
+// The qualified version sorts right after the version itself, so it doesn't break the version order.
+func qualifyMigrationVersion(version string, qualifier string) string {
+	return version + "." + versionQualifierReg.ReplaceAllString(qualifier, "_")
+}
+
+// shortCommitID returns the abbreviated commit ID as displayed by the VCS.
+func shortCommitID(commitID string) string {
+	if len(commitID) > 8 {
+		return commitID[:8]
+	}
+	return commitID
+}
+
+// findMigrationVersionClaimList returns the migration files pushed to the repository and applied as the version to the databases.
+func findMigrationVersionClaimList(ctx context.Context, databaseList []*api.Database, version string, logger *zap.Logger) ([]*migrationVersionClaim, error) {
+	var claimList []*migrationVersionClaim
+	for _, database := range databaseList {
+		driver, err := getDatabaseDriver(ctx, database.Instance, "", logger)
+		if err != nil {
+			return nil, err
+		}
+		historyList, err := driver.FindMigrationHistoryList(ctx, &db.MigrationHistoryFind{
+			Database: &database.Name,
+			Version:  &version,
+		})
+		driver.Close(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find migration history of database %q: %w", database.Name, err)
+		}
+		for _, history := range historyList {
+			if history.Source != db.VCS || history.Payload == "" {
+				continue
+			}
+			payload := &db.MigrationInfoPayload{}
+			if err := json.Unmarshal([]byte(history.Payload), payload); err != nil || payload.VCSPushEvent == nil {
+				continue
+			}
+			claimList = append(claimList, &migrationVersionClaim{
+				ref:       payload.VCSPushEvent.Ref,
+				commitID:  payload.VCSPushEvent.FileCommit.ID,
+				commitTs:  payload.VCSPushEvent.FileCommit.CreatedTs,
+				statement: history.Statement,
+			})
+		}
+	}
+	return claimList, nil
+}
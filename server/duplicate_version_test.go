@@ -0,0 +1,111 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+)
+
+func TestResolveDuplicateVersion(t *testing.T) {
+	// The same version 0001 is applied from the feature branch, and pushed to the main branch with different content.
+	featureClaim := &migrationVersionClaim{
+		ref:       "refs/heads/feature/users",
+		commitID:  "a1b2c3d4e5f6",
+		commitTs:  1650000000,
+		statement: "CREATE TABLE users (id INT);",
+	}
+	tests := []struct {
+		name        string
+		policy      api.DuplicateVersionPolicy
+		pushed      *migrationVersionClaim
+		appliedList []*migrationVersionClaim
+		want        string
+		wantErr     bool
+	}{
+		{
+			name:   "no version applied",
+			policy: api.DuplicateVersionError,
+			pushed: &migrationVersionClaim{ref: "refs/heads/main", commitID: "f6e5d4c3b2a1", commitTs: 1650000100, statement: "CREATE TABLE posts (id INT);"},
+			want:   "0001",
+		},
+		{
+			name:        "same content pushed again",
+			policy:      api.DuplicateVersionError,
+			pushed:      &migrationVersionClaim{ref: "refs/heads/main", commitID: "f6e5d4c3b2a1", commitTs: 1650000100, statement: "CREATE TABLE users (id INT);"},
+			appliedList: []*migrationVersionClaim{featureClaim},
+			want:        "0001",
+		},
+		{
+			name:        "error",
+			policy:      api.DuplicateVersionError,
+			pushed:      &migrationVersionClaim{ref: "refs/heads/main", commitID: "f6e5d4c3b2a1", commitTs: 1650000100, statement: "CREATE TABLE posts (id INT);"},
+			appliedList: []*migrationVersionClaim{featureClaim},
+			wantErr:     true,
+		},
+		{
+			name:        "latest wins with the pushed commit more recent",
+			policy:      api.DuplicateVersionLatestWins,
+			pushed:      &migrationVersionClaim{ref: "refs/heads/main", commitID: "f6e5d4c3b2a1", commitTs: 1650000100, statement: "CREATE TABLE posts (id INT);"},
+			appliedList: []*migrationVersionClaim{featureClaim},
+			want:        "0001.f6e5d4c3",
+		},
+		{
+			name:        "latest wins with the applied commit more recent",
+			policy:      api.DuplicateVersionLatestWins,
+			pushed:      &migrationVersionClaim{ref: "refs/heads/main", commitID: "f6e5d4c3b2a1", commitTs: 1649999900, statement: "CREATE TABLE posts (id INT);"},
+			appliedList: []*migrationVersionClaim{featureClaim},
+			wantErr:     true,
+		},
+		{
+			name:        "branch scoped on another branch",
+			policy:      api.DuplicateVersionBranchScoped,
+			pushed:      &migrationVersionClaim{ref: "refs/heads/main", commitID: "f6e5d4c3b2a1", commitTs: 1650000100, statement: "CREATE TABLE posts (id INT);"},
+			appliedList: []*migrationVersionClaim{featureClaim},
+			want:        "0001.main",
+		},
+		{
+			name:        "branch scoped on the same branch",
+			policy:      api.DuplicateVersionBranchScoped,
+			pushed:      &migrationVersionClaim{ref: "refs/heads/feature/users", commitID: "f6e5d4c3b2a1", commitTs: 1650000100, statement: "CREATE TABLE posts (id INT);"},
+			appliedList: []*migrationVersionClaim{featureClaim},
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		version, err := resolveDuplicateVersion(test.policy, "0001", test.pushed, test.appliedList)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%q: resolveDuplicateVersion() got version %q, want error.", test.name, version)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: resolveDuplicateVersion() got error %v, want OK.", test.name, err)
+			continue
+		}
+		if version != test.want {
+			t.Errorf("%q: resolveDuplicateVersion() got %q, want %q.", test.name, version, test.want)
+		}
+	}
+}
+
+func TestQualifyMigrationVersion(t *testing.T) {
+	tests := []struct {
+		qualifier string
+		want      string
+	}{
+		{qualifier: "main", want: "0001.main"},
+		{qualifier: "feature/add-users", want: "0001.feature_add_users"},
+	}
+	for _, test := range tests {
+		got := qualifyMigrationVersion("0001", test.qualifier)
+		if got != test.want {
+			t.Errorf("qualifyMigrationVersion(%q) got %q, want %q.", test.qualifier, got, test.want)
+		}
+		// The qualified version sorts between the version and the next one.
+		if !("0001" < got && got < "0002") {
+			t.Errorf("qualifyMigrationVersion(%q) got %q, want sorting between %q and %q.", test.qualifier, got, "0001", "0002")
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/db/util"
+)
+
+// resolveEmptyMigration resolves the pushed migration file by the empty migration policy if the statement is empty.
+// Returns the skip reason if the file is skipped, or error if the file is rejected. Both are empty if the file is applied.
+func resolveEmptyMigration(policy api.EmptyMigrationPolicy, statement string) (string, error) {
+	if !isEmptyMigrationStatement(statement) {
+		return "", nil
+	}
+	switch policy {
+	case api.EmptyMigrationError:
+		return "", fmt.Errorf("the migration file is empty or only has comments")
+	case api.EmptyMigrationAllow:
+		return "", nil
+	}
+	return "the migration file is empty or only has comments", nil
+}
+
+// isEmptyMigrationStatement returns true if the statement has no statement to execute after the comments and the whitespaces
+// are stripped by the SQL splitter. The statement the splitter fails to split isn't empty, which is left to the apply to report.
+func isEmptyMigrationStatement(statement string) bool {
+	count := 0
+	if err := util.ApplyMultiStatements(bufio.NewScanner(strings.NewReader(statement)), func(stmt string) error {
+		count++
+		return nil
+	}); err != nil {
+		return false
+	}
+	return count == 0
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+)
+
+func TestIsEmptyMigrationStatement(t *testing.T) {
+	tests := []struct {
+		statement string
+		want      bool
+	}{
+		{"", true},
+		{"\n\t \n", true},
+		{"-- TODO: add the index\n-- after the backfill\n", true},
+		{"/*\n placeholder\n*/\n\n-- nothing yet\n", true},
+		{"-- add the index\nCREATE INDEX idx_name ON users(name);\n", false},
+		{"ALTER TABLE users ADD COLUMN age INT", false},
+	}
+
+	for _, test := range tests {
+		if got := isEmptyMigrationStatement(test.statement); got != test.want {
+			t.Errorf("isEmptyMigrationStatement(%q) got %v, want %v.", test.statement, got, test.want)
+		}
+	}
+}
+
+func TestResolveEmptyMigration(t *testing.T) {
+	const commentsOnly = "-- TODO: add the index\n"
+	const statement = "CREATE INDEX idx_name ON users(name);\n"
+	tests := []struct {
+		name           string
+		policy         api.EmptyMigrationPolicy
+		statement      string
+		wantSkipReason string
+		wantErr        bool
+	}{
+		{
+			name:           "skip empty",
+			policy:         api.EmptyMigrationSkip,
+			statement:      commentsOnly,
+			wantSkipReason: "the migration file is empty or only has comments",
+		},
+		{
+			name:           "skip by default",
+			policy:         "",
+			statement:      commentsOnly,
+			wantSkipReason: "the migration file is empty or only has comments",
+		},
+		{
+			name:      "reject empty",
+			policy:    api.EmptyMigrationError,
+			statement: commentsOnly,
+			wantErr:   true,
+		},
+		{
+			name:      "allow empty",
+			policy:    api.EmptyMigrationAllow,
+			statement: commentsOnly,
+		},
+		{
+			name:      "non-empty",
+			policy:    api.EmptyMigrationError,
+			statement: statement,
+		},
+	}
+
+	for _, test := range tests {
+		skipReason, err := resolveEmptyMigration(test.policy, test.statement)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%q: resolveEmptyMigration() got error %v, want error %v.", test.name, err, test.wantErr)
+		}
+		if skipReason != test.wantSkipReason {
+			t.Errorf("%q: resolveEmptyMigration() got skip reason %q, want %q.", test.name, skipReason, test.wantSkipReason)
+		}
+	}
+}
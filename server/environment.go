@@ -20,14 +20,23 @@ func (s *Server) registerEnvironmentRoutes(g *echo.Group) {
 		if err := jsonapi.UnmarshalPayload(c.Request().Body, environmentCreate); err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, "Malformatted create environment request").SetInternal(err)
 		}
+		if environmentCreate.Tier != "" {
+			if err := api.ValidateEnvironmentTier(environmentCreate.Tier); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+			}
+		}
 
 		environmentCreate.CreatorID = c.Get(getPrincipalIDContextKey()).(int)
+		environmentCreate.Plan = s.loadSubscription().Plan
 
 		environment, err := s.EnvironmentService.CreateEnvironment(ctx, environmentCreate)
 		if err != nil {
 			if common.ErrorCode(err) == common.Conflict {
 				return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("Environment name already exists: %s", environmentCreate.Name))
 			}
+			if common.ErrorCode(err) == common.PaymentRequired {
+				return echo.NewHTTPError(http.StatusPaymentRequired, common.ErrorMessage(err))
+			}
 			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create environment").SetInternal(err)
 		}
 
@@ -81,6 +90,11 @@ func (s *Server) registerEnvironmentRoutes(g *echo.Group) {
 		if err := jsonapi.UnmarshalPayload(c.Request().Body, environmentPatch); err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, "Malformatted patch environment request").SetInternal(err)
 		}
+		if v := environmentPatch.Tier; v != nil {
+			if err := api.ValidateEnvironmentTier(*v); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+			}
+		}
 
 		environment, err := s.EnvironmentService.PatchEnvironment(ctx, environmentPatch)
 		if err != nil {
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/bytebase/bytebase/api"
+)
+
+// featureConfiguredChecker returns true if the feature is actually set up.
+type featureConfiguredChecker func(ctx context.Context) (bool, error)
+
+// featureConfiguredCheckerMap returns the checker of each feature provided by the service owning the feature's configuration.
+// The feature without a checker is reported as not configured.
+func (s *Server) featureConfiguredCheckerMap() map[api.FeatureType]featureConfiguredChecker {
+	return map[api.FeatureType]featureConfiguredChecker{
+		api.FeatureMultiTenancy:        s.isMultiTenancyConfigured,
+		api.FeatureRBAC:                s.isRBACConfigured,
+		api.FeatureApprovalPolicy:      s.isApprovalPolicyConfigured,
+		api.FeatureBackupPolicy:        s.isBackupPolicyConfigured,
+		api.FeatureCustomApprovalChain: s.isCustomApprovalChainConfigured,
+		api.Feature3rdPartyLogin:       s.is3rdPartyLoginConfigured,
+	}
+}
+
+// getFeatureUsageReport reports whether each feature is available on the plan and whether it's configured.
+func (s *Server) getFeatureUsageReport(ctx context.Context) (*api.FeatureUsageReport, error) {
+	return composeFeatureUsageReport(ctx, s.getPlan(), s.featureConfiguredCheckerMap())
+}
+
+// composeFeatureUsageReport reports every feature in api.FeatureMatrix, so that a feature available on the plan but unused
+// is distinguished from one that's configured.
+func composeFeatureUsageReport(ctx context.Context, plan api.Plan, checkerMap map[api.FeatureType]featureConfiguredChecker) (*api.FeatureUsageReport, error) {
+	var featureList []api.FeatureType
+	for feature := range api.FeatureMatrix {
+		featureList = append(featureList, feature)
+	}
+	sort.Slice(featureList, func(i, j int) bool {
+		return featureList[i] < featureList[j]
+	})
+
+	report := &api.FeatureUsageReport{
+		Plan: plan.Type,
+	}
+	for _, feature := range featureList {
+		usage := &api.FeatureUsage{
+			Feature:   feature,
+			Available: plan.GateInfo(feature).Enabled,
+		}
+		if checker, ok := checkerMap[feature]; ok {
+			configured, err := checker(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check whether feature %q is configured: %w", feature, err)
+			}
+			usage.Configured = configured
+		}
+		report.FeatureList = append(report.FeatureList, usage)
+	}
+	return report, nil
+}
+
+// isMultiTenancyConfigured returns true if any project is in tenant mode.
+func (s *Server) isMultiTenancyConfigured(ctx context.Context) (bool, error) {
+	rowStatus := api.Normal
+	projectList, err := s.ProjectService.FindProjectList(ctx, &api.ProjectFind{RowStatus: &rowStatus})
+	if err != nil {
+		return false, err
+	}
+	for _, project := range projectList {
+		if project.TenantMode == api.TenantModeTenant {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isRBACConfigured returns true if any active workspace member is assigned a role other than the owner.
+func (s *Server) isRBACConfigured(ctx context.Context) (bool, error) {
+	memberList, err := s.MemberService.FindMemberList(ctx, &api.MemberFind{})
+	if err != nil {
+		return false, err
+	}
+	for _, member := range memberList {
+		if member.RowStatus == api.Normal && member.Role != api.Owner {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isApprovalPolicyConfigured returns true if the pipeline approval policy of any environment differs from the default.
+func (s *Server) isApprovalPolicyConfigured(ctx context.Context) (bool, error) {
+	environmentList, err := s.findActiveEnvironmentList(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, environment := range environmentList {
+		policy, err := s.PolicyService.GetPipelineApprovalPolicy(ctx, environment.ID)
+		if err != nil {
+			return false, err
+		}
+		if policy.Value != api.PipelineApprovalValueManualAlways {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isCustomApprovalChainConfigured returns true if the pipeline approval policy of any environment has the approval chain.
+func (s *Server) isCustomApprovalChainConfigured(ctx context.Context) (bool, error) {
+	environmentList, err := s.findActiveEnvironmentList(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, environment := range environmentList {
+		policy, err := s.PolicyService.GetPipelineApprovalPolicy(ctx, environment.ID)
+		if err != nil {
+			return false, err
+		}
+		if policy.ApprovalChain != nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isBackupPolicyConfigured returns true if the backup plan policy of any environment schedules the backup.
+func (s *Server) isBackupPolicyConfigured(ctx context.Context) (bool, error) {
+	environmentList, err := s.findActiveEnvironmentList(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, environment := range environmentList {
+		policy, err := s.PolicyService.GetBackupPlanPolicy(ctx, environment.ID)
+		if err != nil {
+			return false, err
+		}
+		if policy.Schedule != api.BackupPlanPolicyScheduleUnset {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// is3rdPartyLoginConfigured returns true if any VCS is linked, since its OAuth application is used for the login.
+func (s *Server) is3rdPartyLoginConfigured(ctx context.Context) (bool, error) {
+	vcsList, err := s.VCSService.FindVCSList(ctx, &api.VCSFind{})
+	if err != nil {
+		return false, err
+	}
+	return len(vcsList) > 0, nil
+}
+
+func (s *Server) findActiveEnvironmentList(ctx context.Context) ([]*api.Environment, error) {
+	rowStatus := api.Normal
+	return s.EnvironmentService.FindEnvironmentList(ctx, &api.EnvironmentFind{RowStatus: &rowStatus})
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+)
+
+func TestComposeFeatureUsageReport(t *testing.T) {
+	configured := func(ctx context.Context) (bool, error) { return true, nil }
+	unconfigured := func(ctx context.Context) (bool, error) { return false, nil }
+
+	tests := []struct {
+		name       string
+		plan       api.Plan
+		checkerMap map[api.FeatureType]featureConfiguredChecker
+		feature    api.FeatureType
+		want       api.FeatureUsage
+	}{
+		{
+			name:       "available but unconfigured",
+			plan:       api.Plan{Type: api.TEAM},
+			checkerMap: map[api.FeatureType]featureConfiguredChecker{api.FeatureRBAC: unconfigured},
+			feature:    api.FeatureRBAC,
+			want:       api.FeatureUsage{Feature: api.FeatureRBAC, Available: true},
+		},
+		{
+			name:       "available and configured",
+			plan:       api.Plan{Type: api.TEAM},
+			checkerMap: map[api.FeatureType]featureConfiguredChecker{api.FeatureRBAC: configured},
+			feature:    api.FeatureRBAC,
+			want:       api.FeatureUsage{Feature: api.FeatureRBAC, Available: true, Configured: true},
+		},
+		{
+			name:       "configured before downgrading",
+			plan:       api.Plan{Type: api.FREE},
+			checkerMap: map[api.FeatureType]featureConfiguredChecker{api.FeatureMultiTenancy: configured},
+			feature:    api.FeatureMultiTenancy,
+			want:       api.FeatureUsage{Feature: api.FeatureMultiTenancy, Configured: true},
+		},
+		{
+			name:    "unavailable without checker",
+			plan:    api.Plan{Type: api.TEAM},
+			feature: api.FeatureDBAWorkflow,
+			want:    api.FeatureUsage{Feature: api.FeatureDBAWorkflow},
+		},
+		{
+			name:       "available by the feature override",
+			plan:       api.Plan{Type: api.TEAM, FeatureOverrides: map[api.FeatureType]bool{api.FeatureDBAWorkflow: true}},
+			checkerMap: map[api.FeatureType]featureConfiguredChecker{api.FeatureDBAWorkflow: unconfigured},
+			feature:    api.FeatureDBAWorkflow,
+			want:       api.FeatureUsage{Feature: api.FeatureDBAWorkflow, Available: true},
+		},
+	}
+
+	for _, test := range tests {
+		report, err := composeFeatureUsageReport(context.Background(), test.plan, test.checkerMap)
+		if err != nil {
+			t.Errorf("%q: composeFeatureUsageReport() got error %v, want OK.", test.name, err)
+			continue
+		}
+		if report.Plan != test.plan.Type {
+			t.Errorf("%q: composeFeatureUsageReport() got plan %v, want %v.", test.name, report.Plan, test.plan.Type)
+		}
+		if len(report.FeatureList) != len(api.FeatureMatrix) {
+			t.Errorf("%q: composeFeatureUsageReport() got %d features, want %d.", test.name, len(report.FeatureList), len(api.FeatureMatrix))
+		}
+		var got *api.FeatureUsage
+		for i, usage := range report.FeatureList {
+			if i > 0 && report.FeatureList[i-1].Feature >= usage.Feature {
+				t.Errorf("%q: composeFeatureUsageReport() got feature %q after %q, want ordered.", test.name, usage.Feature, report.FeatureList[i-1].Feature)
+			}
+			if usage.Feature == test.feature {
+				got = usage
+			}
+		}
+		if got == nil || *got != test.want {
+			t.Errorf("%q: composeFeatureUsageReport() got usage %+v, want %+v.", test.name, got, test.want)
+		}
+	}
+
+	// The report fails if the owning service fails to tell whether the feature is configured.
+	checkerMap := map[api.FeatureType]featureConfiguredChecker{
+		api.FeatureRBAC: func(ctx context.Context) (bool, error) { return false, fmt.Errorf("failed to find members") },
+	}
+	if _, err := composeFeatureUsageReport(context.Background(), api.Plan{Type: api.TEAM}, checkerMap); err == nil {
+		t.Errorf("composeFeatureUsageReport() with failed checker got OK, want error.")
+	}
+}
@@ -57,6 +57,8 @@ func (s *Server) registerInstanceRoutes(g *echo.Group) {
 			s.syncEngineVersionAndSchema(ctx, instance)
 		}
 
+		instance.QuotaWarning = s.instanceQuotaWarning(ctx)
+
 		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
 		if err := jsonapi.MarshalPayload(c.Response().Writer, instance); err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to marshal create instance response").SetInternal(err)
@@ -552,20 +554,45 @@ func (s *Server) findInstanceAdminPasswordByID(ctx context.Context, instanceID i
 }
 
 // instanceCountGuard is a feature guard for instance count.
-// We only count instances with NORMAL status since users cannot make any operations for ARCHIVED one.
 func (s *Server) instanceCountGuard(ctx context.Context) error {
+	usage, err := s.instanceQuotaUsage(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to count instance").SetInternal(err)
+	}
+	if usage.Status == api.QuotaExceeded {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("You have reached the maximum instance count %d.", usage.Quota))
+	}
+
+	return nil
+}
+
+// instanceQuotaUsage returns the usage of the instance count quota of the subscription.
+// We only count instances with NORMAL status since users cannot make any operations for ARCHIVED one.
+func (s *Server) instanceQuotaUsage(ctx context.Context) (api.QuotaStatus, error) {
 	status := api.Normal
 	count, err := s.InstanceService.CountInstance(ctx, &api.InstanceFind{
 		RowStatus: &status,
 	})
-
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to count instance").SetInternal(err)
+		return api.QuotaStatus{}, err
 	}
 	subscription := s.loadSubscription()
-	if count >= subscription.InstanceCount {
-		return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("You have reached the maximum instance count %d.", subscription.InstanceCount))
-	}
+	// The instance count quota is granted by the license rather than fixed by the plan.
+	return subscription.Plan.QuotaUsage(count, func(api.PlanType) int {
+		return subscription.InstanceCount
+	}), nil
+}
 
-	return nil
+// instanceQuotaWarning returns the warning if the instance count is approaching the quota, or empty otherwise.
+// It never blocks, since the instance has been created.
+func (s *Server) instanceQuotaWarning(ctx context.Context) string {
+	usage, err := s.instanceQuotaUsage(ctx)
+	if err != nil {
+		s.l.Warn("Failed to count instance for the quota warning", zap.Error(err))
+		return ""
+	}
+	if usage.Status == api.QuotaOK {
+		return ""
+	}
+	return fmt.Sprintf("You have used %d of the maximum instance count %d, please upgrade to add more.", usage.Current, usage.Quota)
 }
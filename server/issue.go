@@ -6,12 +6,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"path"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/bytebase/bytebase/api"
 	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/advisor"
 	"github.com/bytebase/bytebase/plugin/db"
 	"github.com/bytebase/bytebase/plugin/vcs"
 	"github.com/google/jsonapi"
@@ -381,6 +383,9 @@ func (s *Server) createIssue(ctx context.Context, issueCreate *api.IssueCreate,
 					payload.Statement = taskCreate.Statement
 					payload.RollbackStatement = taskCreate.RollbackStatement
 					payload.VCSPushEvent = taskCreate.VCSPushEvent
+					if taskCreate.VCSPushEvent != nil {
+						payload.RetryPolicy = s.taskRetryPolicy
+					}
 					bytes, err := json.Marshal(payload)
 					if err != nil {
 						return nil, fmt.Errorf("failed to create schema update task, unable to marshal payload %w", err)
@@ -391,6 +396,9 @@ func (s *Server) createIssue(ctx context.Context, issueCreate *api.IssueCreate,
 					payload.Statement = taskCreate.Statement
 					payload.RollbackStatement = taskCreate.RollbackStatement
 					payload.VCSPushEvent = taskCreate.VCSPushEvent
+					if taskCreate.VCSPushEvent != nil {
+						payload.RetryPolicy = s.taskRetryPolicy
+					}
 					bytes, err := json.Marshal(payload)
 					if err != nil {
 						return nil, fmt.Errorf("failed to create data update task, unable to marshal payload %w", err)
@@ -463,13 +471,15 @@ func (s *Server) createIssue(ctx context.Context, issueCreate *api.IssueCreate,
 		return issue, nil
 	}
 
-	task, err := s.ScheduleNextTaskIfNeeded(ctx, issue.Pipeline)
+	task, err := s.TaskScheduler.SchedulePipeline(ctx, issue.Pipeline)
 	if err != nil {
 		return nil, fmt.Errorf("failed to schedule task after creating the issue: %v. Error %w", issue.Name, err)
 	}
-	// We need to re-compose task relationship because the one in issue is modified by ScheduleNextTaskIfNeeded.
-	if err := s.composeTaskRelationship(ctx, task); err != nil {
-		return nil, fmt.Errorf("failed to compose task %v, error %w", task.Name, err)
+	// We need to re-compose task relationship because the one in issue is modified by SchedulePipeline.
+	if task != nil {
+		if err := s.composeTaskRelationship(ctx, task); err != nil {
+			return nil, fmt.Errorf("failed to compose task %v, error %w", task.Name, err)
+		}
 	}
 
 	createActivityPayload := api.ActivityIssueCreatePayload{
@@ -799,6 +809,8 @@ func (s *Server) createPipelineFromIssue(ctx context.Context, issueCreate *api.I
 		if err != nil {
 			return nil, echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch project ID: %v", issueCreate.ProjectID)).SetInternal(err)
 		}
+		// The databases whose tasks require an extra approval because of the destructive operations.
+		var extraApprovalDatabaseList []string
 
 		// Tenant mode project pipeline has its own generation.
 		if project.TenantMode == api.TenantModeTenant {
@@ -826,7 +838,7 @@ func (s *Server) createPipelineFromIssue(ctx context.Context, issueCreate *api.I
 			if err != nil {
 				return nil, fmt.Errorf("api.GetBaseDatabaseName(%q, %q) failed, error: %v", d.DatabaseName, project.DBNameTemplate, err)
 			}
-			deployments, p, err := s.getTenantDatabaseMatrix(ctx, issueCreate.ProjectID, project.DBNameTemplate, databaseList, baseDatabaseName)
+			deployments, p, err := s.getTenantDatabaseMatrix(ctx, issueCreate.ProjectID, m.DeploymentConfigID, project.DBNameTemplate, databaseList, baseDatabaseName)
 			if err != nil {
 				return nil, err
 			}
@@ -847,7 +859,15 @@ func (s *Server) createPipelineFromIssue(ctx context.Context, issueCreate *api.I
 					if policy.Value == api.PipelineApprovalValueManualNever {
 						taskStatus = api.TaskPending
 					}
-					taskCreate, err := getUpdateTask(database, m.MigrationType, m.VCSPushEvent, d, taskStatus)
+					extraApproval, err := s.requiresExtraApproval(database, m.MigrationType, d.Statement)
+					if err != nil {
+						return nil, err
+					}
+					if extraApproval {
+						taskStatus = api.TaskPendingApproval
+						extraApprovalDatabaseList = append(extraApprovalDatabaseList, database.Name)
+					}
+					taskCreate, err := getUpdateTask(database, m.MigrationType, m.VCSPushEvent, d, taskStatus, extraApproval)
 					if err != nil {
 						return nil, err
 					}
@@ -871,7 +891,14 @@ func (s *Server) createPipelineFromIssue(ctx context.Context, issueCreate *api.I
 			pipelineCreate = pc
 		} else {
 			for _, d := range m.UpdateSchemaDetailList {
-				if m.MigrationType == db.Migrate && d.Statement == "" {
+				migrationType, vcsPushEvent := m.MigrationType, m.VCSPushEvent
+				if d.MigrationType != "" {
+					migrationType = d.MigrationType
+				}
+				if d.VCSPushEvent != nil {
+					vcsPushEvent = d.VCSPushEvent
+				}
+				if migrationType == db.Migrate && d.Statement == "" {
 					return nil, echo.NewHTTPError(http.StatusBadRequest, "Failed to create issue, sql statement missing")
 				}
 				databaseFind := &api.DatabaseFind{
@@ -893,20 +920,37 @@ func (s *Server) createPipelineFromIssue(ctx context.Context, issueCreate *api.I
 				if policy.Value == api.PipelineApprovalValueManualNever {
 					taskStatus = api.TaskPending
 				}
+				extraApproval, err := s.requiresExtraApproval(database, migrationType, d.Statement)
+				if err != nil {
+					return nil, err
+				}
+				if extraApproval {
+					taskStatus = api.TaskPendingApproval
+					extraApprovalDatabaseList = append(extraApprovalDatabaseList, database.Name)
+				}
 
-				taskCreate, err := getUpdateTask(database, m.MigrationType, m.VCSPushEvent, d, taskStatus)
+				taskCreate, err := getUpdateTask(database, migrationType, vcsPushEvent, d, taskStatus, extraApproval)
 				if err != nil {
 					return nil, err
 				}
 
+				stageName := fmt.Sprintf("%s %s", database.Instance.Environment.Name, database.Name)
+				// Tell apart the stages of the migration files pushed together.
+				if d.VCSPushEvent != nil {
+					stageName = fmt.Sprintf("%s (%s)", stageName, path.Base(d.VCSPushEvent.FileCommit.Added))
+				}
 				pc.StageList = append(pc.StageList, api.StageCreate{
-					Name:          fmt.Sprintf("%s %s", database.Instance.Environment.Name, database.Name),
+					Name:          stageName,
 					EnvironmentID: database.Instance.Environment.ID,
 					TaskList:      []api.TaskCreate{*taskCreate},
 				})
 			}
 			pipelineCreate = pc
 		}
+		// Make the approval escalation visible in the issue.
+		if len(extraApprovalDatabaseList) > 0 {
+			issueCreate.Description = appendExtraApprovalNote(issueCreate.Description, extraApprovalDatabaseList)
+		}
 	default:
 		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid issue type %q", issueCreate.Type))
 	}
@@ -942,7 +986,46 @@ func (s *Server) createPipelineFromIssue(ctx context.Context, issueCreate *api.I
 	return createdPipeline, nil
 }
 
-func getUpdateTask(database *api.Database, migrationType db.MigrationType, vcsPushEvent *vcs.PushEvent, d *api.UpdateSchemaDetail, taskStatus api.TaskStatus) (*api.TaskCreate, error) {
+// requiresExtraApproval returns true if the migration statement contains destructive operations on the database,
+// which require an extra approval regardless of the environment approval policy.
+func (s *Server) requiresExtraApproval(database *api.Database, migrationType db.MigrationType, statement string) (bool, error) {
+	if !s.feature(api.FeatureApprovalPolicy) || migrationType != db.Migrate {
+		return false, nil
+	}
+	// For now we only supported MySQL dialect compatibility check.
+	if database.Instance.Engine != db.MySQL && database.Instance.Engine != db.TiDB {
+		return false, nil
+	}
+	adviceList, err := advisor.Check(
+		database.Instance.Engine,
+		advisor.MySQLMigrationCompatibility,
+		advisor.Context{
+			Logger:    s.l,
+			Charset:   database.CharacterSet,
+			Collation: database.Collation,
+		},
+		statement,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to check destructive operations for database %q, error %w", database.Name, err)
+	}
+	return advisor.RequiresExtraApproval(adviceList), nil
+}
+
+// appendExtraApprovalNote appends the note explaining the extra approval to the issue description.
+func appendExtraApprovalNote(description string, databaseNameList []string) string {
+	var quotedList []string
+	for _, name := range databaseNameList {
+		quotedList = append(quotedList, fmt.Sprintf("%q", name))
+	}
+	note := fmt.Sprintf("Extra approval by a DBA or an Owner is required because the migration contains destructive operations (DROP DATABASE/TABLE/COLUMN) on database %s.", strings.Join(quotedList, ", "))
+	if description == "" {
+		return note
+	}
+	return description + "\n\n" + note
+}
+
+func getUpdateTask(database *api.Database, migrationType db.MigrationType, vcsPushEvent *vcs.PushEvent, d *api.UpdateSchemaDetail, taskStatus api.TaskStatus, extraApproval bool) (*api.TaskCreate, error) {
 	taskName := fmt.Sprintf("Establish %q baseline", database.Name)
 	if migrationType == db.Migrate {
 		taskName = fmt.Sprintf("Update %q schema", database.Name)
@@ -958,6 +1041,7 @@ func getUpdateTask(database *api.Database, migrationType db.MigrationType, vcsPu
 	if vcsPushEvent != nil {
 		payload.VCSPushEvent = vcsPushEvent
 	}
+	payload.ExtraApprovalRequired = extraApproval
 	bytes, err := json.Marshal(payload)
 	if err != nil {
 		errMsg := fmt.Sprintf("Failed to marshal database schema update payload: %v", err)
@@ -1065,6 +1149,9 @@ func (s *Server) changeIssueStatus(ctx context.Context, issue *api.Issue, newSta
 	if _, err := s.PipelineService.PatchPipeline(ctx, pipelinePatch); err != nil {
 		return nil, fmt.Errorf("failed to update issue status: %v, failed to update pipeline status: %w", issue.Name, err)
 	}
+	if pipelineStatus != api.PipelineOpen && s.TaskScheduler != nil {
+		s.TaskScheduler.FinishPipeline(issue.PipelineID)
+	}
 
 	issuePatch := &api.IssuePatch{
 		ID:        issue.ID,
@@ -1146,14 +1233,22 @@ func (s *Server) postInboxIssueActivity(ctx context.Context, issue *api.Issue, a
 	return nil
 }
 
-func (s *Server) getTenantDatabaseMatrix(ctx context.Context, projectID int, dbNameTemplate string, databaseList []*api.Database, baseDatabaseName string) ([]*api.Deployment, [][]*api.Database, error) {
-	deployConfig, err := s.DeploymentConfigService.FindDeploymentConfig(ctx, &api.DeploymentConfigFind{
+// getTenantDatabaseMatrix stages the databases by the deployment config with deploymentConfigID, or the deployment config of the project if nil.
+func (s *Server) getTenantDatabaseMatrix(ctx context.Context, projectID int, deploymentConfigID *int, dbNameTemplate string, databaseList []*api.Database, baseDatabaseName string) ([]*api.Deployment, [][]*api.Database, error) {
+	deployConfigFind := &api.DeploymentConfigFind{
 		ProjectID: &projectID,
-	})
+	}
+	if deploymentConfigID != nil {
+		deployConfigFind.ID = deploymentConfigID
+	}
+	deployConfig, err := s.DeploymentConfigService.FindDeploymentConfig(ctx, deployConfigFind)
 	if err != nil {
 		return nil, nil, echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch deployment config for project ID: %v", projectID)).SetInternal(err)
 	}
 	if deployConfig == nil {
+		if deploymentConfigID != nil {
+			return nil, nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Deployment config ID %v not found in project ID: %v", *deploymentConfigID, projectID))
+		}
 		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Deployment config missing for project ID: %v", projectID)).SetInternal(err)
 	}
 	deploySchedule, err := api.ValidateAndGetDeploymentSchedule(deployConfig.Payload)
@@ -1185,7 +1280,7 @@ func (s *Server) getSchemaFromPeerTenantDatabase(ctx context.Context, instance *
 		return "", "", echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch databases in project ID: %v", projectID)).SetInternal(err)
 	}
 
-	_, pipeline, err := s.getTenantDatabaseMatrix(ctx, projectID, project.DBNameTemplate, databaseList, baseDatabaseName)
+	_, pipeline, err := s.getTenantDatabaseMatrix(ctx, projectID, nil /* deploymentConfigID */, project.DBNameTemplate, databaseList, baseDatabaseName)
 	if err != nil {
 		return "", "", err
 	}
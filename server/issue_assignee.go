@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"go.uber.org/zap"
+)
+
+// AssigneeResolver resolves the principal assigned the issue created by the push event, so that the orgs can assign
+// the issues by their own rules, e.g. to the on-call DBA.
+type AssigneeResolver interface {
+	// Resolve returns the ID of the principal assigned the issue created by the migration file pushed by pushEvent
+	// to the repository.
+	Resolve(ctx context.Context, repository *api.Repository, pushEvent *vcs.PushEvent) (int, error)
+}
+
+// memberAssigneeResolver is the default AssigneeResolver. It assigns the commit author if the principal with the
+// author email is a member of the project, otherwise the default assignee of the repository, otherwise the project owners
+// in turn. The system bot is assigned if none of them is found.
+type memberAssigneeResolver struct {
+	findPrincipalByEmail  func(ctx context.Context, email string) (*api.Principal, error)
+	findProjectMemberList func(ctx context.Context, projectID int) ([]*api.ProjectMember, error)
+	rotation              *ownerRotation
+}
+
+func (r *memberAssigneeResolver) Resolve(ctx context.Context, repository *api.Repository, pushEvent *vcs.PushEvent) (int, error) {
+	memberList, err := r.findProjectMemberList(ctx, repository.ProjectID)
+	if err != nil {
+		return api.UnknownID, err
+	}
+
+	if email := strings.TrimSpace(pushEvent.FileCommit.AuthorEmail); email != "" {
+		author, err := r.findPrincipalByEmail(ctx, email)
+		if err != nil {
+			return api.UnknownID, err
+		}
+		if author != nil {
+			for _, member := range memberList {
+				if member.PrincipalID == author.ID {
+					return author.ID, nil
+				}
+			}
+		}
+	}
+
+	if repository.DefaultAssigneeID != nil {
+		return *repository.DefaultAssigneeID, nil
+	}
+
+	var ownerIDList []int
+	for _, member := range memberList {
+		if member.Role == string(common.ProjectOwner) {
+			ownerIDList = append(ownerIDList, member.PrincipalID)
+		}
+	}
+	if len(ownerIDList) > 0 {
+		return r.rotation.next(repository.ProjectID, ownerIDList), nil
+	}
+	return api.SystemBotID, nil
+}
+
+// ownerRotation assigns the owners of each project in turn. The zero value is ready to use.
+type ownerRotation struct {
+	mu sync.Mutex
+	// turnMap is the number of the assignments made for each project ID.
+	turnMap map[int]int
+}
+
+// next returns the owner whose turn it is in the project, in the order of the principal ID.
+func (r *ownerRotation) next(projectID int, ownerIDList []int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.turnMap == nil {
+		r.turnMap = make(map[int]int)
+	}
+	sortedList := append([]int(nil), ownerIDList...)
+	sort.Ints(sortedList)
+	turn := r.turnMap[projectID]
+	r.turnMap[projectID] = turn + 1
+	return sortedList[turn%len(sortedList)]
+}
+
+// SetAssigneeResolver sets the resolver of the principal assigned the issues created by the pushes. NewServer sets the
+// resolver assigning the commit author, the default assignee of the repository or the project owners.
+func (s *Server) SetAssigneeResolver(resolver AssigneeResolver) {
+	s.assigneeResolver = resolver
+}
+
+// newMemberAssigneeResolver creates the default assignee resolver looking up the principals and the project members of the server.
+func newMemberAssigneeResolver(s *Server) *memberAssigneeResolver {
+	return &memberAssigneeResolver{
+		findPrincipalByEmail: func(ctx context.Context, email string) (*api.Principal, error) {
+			return s.PrincipalService.FindPrincipal(ctx, &api.PrincipalFind{Email: &email})
+		},
+		findProjectMemberList: func(ctx context.Context, projectID int) ([]*api.ProjectMember, error) {
+			return s.ProjectMemberService.FindProjectMemberList(ctx, &api.ProjectMemberFind{ProjectID: &projectID})
+		},
+		rotation: &s.ownerRotation,
+	}
+}
+
+// resolveIssueAssignee returns the ID of the principal assigned the issue created by the push event by the configured resolver.
+// The system bot is assigned if the resolution fails, since it's not critical enough to fail the issue creation.
+func (s *Server) resolveIssueAssignee(ctx context.Context, repository *api.Repository, pushEvent *vcs.PushEvent) int {
+	assigneeID, err := s.assigneeResolver.Resolve(ctx, repository, pushEvent)
+	if err != nil || assigneeID == api.UnknownID {
+		s.l.Warn("Failed to resolve the issue assignee, assigning the system bot",
+			zap.Int("repository_id", repository.ID),
+			zap.String("author_email", pushEvent.FileCommit.AuthorEmail),
+			zap.Error(err),
+		)
+		return api.SystemBotID
+	}
+	return assigneeID
+}
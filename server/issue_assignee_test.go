@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+)
+
+func TestMemberAssigneeResolver(t *testing.T) {
+	principalList := []*api.Principal{
+		{ID: 101, Email: "alice@example.com"},
+		{ID: 102, Email: "bob@example.com"},
+		{ID: 103, Email: "carol@example.com"},
+		{ID: 104, Email: "dave@example.com"},
+	}
+	findPrincipalByEmail := func(ctx context.Context, email string) (*api.Principal, error) {
+		for _, principal := range principalList {
+			if principal.Email == email {
+				return principal, nil
+			}
+		}
+		return nil, nil
+	}
+	// Dave is a Bytebase user, but not a member of the project.
+	projectMemberMap := map[int][]*api.ProjectMember{
+		1: {
+			{PrincipalID: 101, Role: string(common.ProjectDeveloper)},
+			{PrincipalID: 103, Role: string(common.ProjectOwner)},
+			{PrincipalID: 102, Role: string(common.ProjectOwner)},
+		},
+		2: {
+			{PrincipalID: 101, Role: string(common.ProjectDeveloper)},
+		},
+	}
+	findProjectMemberList := func(ctx context.Context, projectID int) ([]*api.ProjectMember, error) {
+		return projectMemberMap[projectID], nil
+	}
+	defaultAssigneeID := 105
+
+	tests := []struct {
+		name        string
+		repository  *api.Repository
+		authorEmail string
+		want        []int
+	}{
+		{
+			name:        "author match",
+			repository:  &api.Repository{ProjectID: 1, DefaultAssigneeID: &defaultAssigneeID},
+			authorEmail: "alice@example.com",
+			want:        []int{101, 101},
+		},
+		{
+			name:        "fallback to default",
+			repository:  &api.Repository{ProjectID: 1, DefaultAssigneeID: &defaultAssigneeID},
+			authorEmail: "dave@example.com",
+			want:        []int{105, 105},
+		},
+		{
+			name:        "round-robin among owners",
+			repository:  &api.Repository{ProjectID: 1},
+			authorEmail: "unknown@example.com",
+			want:        []int{102, 103, 102},
+		},
+		{
+			name:        "no match",
+			repository:  &api.Repository{ProjectID: 2},
+			authorEmail: "dave@example.com",
+			want:        []int{api.SystemBotID},
+		},
+	}
+
+	for _, test := range tests {
+		resolver := &memberAssigneeResolver{
+			findPrincipalByEmail:  findPrincipalByEmail,
+			findProjectMemberList: findProjectMemberList,
+			rotation:              &ownerRotation{},
+		}
+		pushEvent := &vcs.PushEvent{
+			FileCommit: vcs.FileCommit{
+				AuthorEmail: test.authorEmail,
+			},
+		}
+		for _, want := range test.want {
+			assigneeID, err := resolver.Resolve(context.Background(), test.repository, pushEvent)
+			if err != nil {
+				t.Fatalf("%q: Resolve() got error %v, want OK.", test.name, err)
+			}
+			if assigneeID != want {
+				t.Errorf("%q: Resolve() got %d, want %d.", test.name, assigneeID, want)
+			}
+		}
+	}
+}
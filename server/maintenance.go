@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs/gitlab"
+	"github.com/google/jsonapi"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxDeferredWebhookEventCount is the maximum number of the webhook events deferred during the maintenance.
+	// The events beyond are rejected instead of growing the memory without bound.
+	maxDeferredWebhookEventCount = 1000
+)
+
+// deferredWebhookEvent is the push or the merge request event received during the maintenance, verified against the linked repository.
+type deferredWebhookEvent struct {
+	repositoryID int
+	// branch is the branch or the tag ref accepted by ReplayPush.
+	branch       string
+	commitIDList []string
+	// mergeRequest is the merge request of the merge request event, which is reviewed again instead of replaying the commits.
+	mergeRequest *gitlab.WebhookMergeRequestAttributes
+}
+
+func (s *Server) registerMaintenanceRoutes(g *echo.Group) {
+	g.GET("/maintenance", func(c echo.Context) error {
+		return s.currentMaintenanceState(c)
+	})
+
+	g.PATCH("/maintenance", func(c echo.Context) error {
+		var maintenancePatch api.MaintenancePatch
+		if err := jsonapi.UnmarshalPayload(c.Request().Body, &maintenancePatch); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Failed to unmarshal maintenance patch request").SetInternal(err)
+		}
+
+		s.SetMaintenanceMode(maintenancePatch.IsMaintenance)
+
+		return s.currentMaintenanceState(c)
+	})
+}
+
+func (s *Server) currentMaintenanceState(c echo.Context) error {
+	s.maintenanceMu.Lock()
+	maintenance := &api.Maintenance{
+		IsMaintenance:      s.maintenanceMode,
+		DeferredEventCount: len(s.deferredWebhookEventList),
+	}
+	s.maintenanceMu.Unlock()
+
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+	if err := jsonapi.MarshalPayload(c.Response().Writer, maintenance); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to marshal maintenance info response").SetInternal(err)
+	}
+	return nil
+}
+
+// SetMaintenanceMode turns the maintenance mode on or off. In maintenance mode, the verified VCS webhook events are acknowledged
+// without processing, so nothing is synced from the repositories while upgrading Bytebase or maintaining the databases.
+// The deferred events are replayed in the receiving order by ReplayPush when the maintenance mode is turned off, and the
+// merge requests of the deferred merge request events are reviewed again.
+// The deferred events are kept in memory, thus they are lost if the server restarts during the maintenance.
+func (s *Server) SetMaintenanceMode(on bool) {
+	s.maintenanceMu.Lock()
+	s.maintenanceMode = on
+	var eventList []*deferredWebhookEvent
+	if !on {
+		eventList = s.deferredWebhookEventList
+		s.deferredWebhookEventList = nil
+	}
+	s.maintenanceMu.Unlock()
+
+	s.l.Info("Set maintenance mode.", zap.Bool("on", on), zap.Int("deferred_event_count", len(eventList)))
+	if len(eventList) == 0 {
+		return
+	}
+	go replayDeferredWebhookEventList(context.Background(), eventList, s.l, func(ctx context.Context, repositoryID int, commitID string, branch string) error {
+		_, err := s.ReplayPush(ctx, repositoryID, commitID, branch)
+		return err
+	}, s.reviewDeferredMergeRequest)
+}
+
+// reviewDeferredMergeRequest reviews the merge request of the event deferred during the maintenance the same as the webhook does.
+func (s *Server) reviewDeferredMergeRequest(ctx context.Context, repositoryID int, mergeRequest gitlab.WebhookMergeRequestAttributes) error {
+	repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ID: &repositoryID, IncludeSecrets: true})
+	if err != nil {
+		return err
+	}
+	if repository == nil {
+		return &common.Error{Code: common.NotFound, Err: fmt.Errorf("repository ID not found: %d", repositoryID)}
+	}
+	if err := s.composeRepositoryRelationship(ctx, repository); err != nil {
+		return err
+	}
+	if repository.VCS == nil {
+		return fmt.Errorf("VCS not found for ID: %v", repository.VCSID)
+	}
+	if !isMergeRequestTargetMatched(repository, mergeRequest.TargetBranch, s.l) || !isSchemaReviewAction(mergeRequest.Action) {
+		return nil
+	}
+	return s.reviewMergeRequest(ctx, repository, mergeRequest)
+}
+
+// deferWebhookEventIfInMaintenance records the push event of the repository for replaying later if in maintenance mode.
+// The mergeRequest is set for the merge request event, which is reviewed again after the maintenance.
+// Returns whether it's in maintenance mode, and whether the event is deferred, which is false if there are too many deferred events.
+func (s *Server) deferWebhookEventIfInMaintenance(repository *api.Repository, pushEvent *gitlab.WebhookPushEvent, mergeRequest *gitlab.WebhookMergeRequestAttributes) (bool, bool) {
+	s.maintenanceMu.Lock()
+	defer s.maintenanceMu.Unlock()
+	if !s.maintenanceMode {
+		return false, false
+	}
+	if len(s.deferredWebhookEventList) >= maxDeferredWebhookEventCount {
+		return true, false
+	}
+	if mergeRequest != nil {
+		s.deferredWebhookEventList = append(s.deferredWebhookEventList, &deferredWebhookEvent{
+			repositoryID: repository.ID,
+			mergeRequest: mergeRequest,
+		})
+		return true, true
+	}
+	branch := pushEvent.Ref
+	if pushEvent.ObjectKind == gitlab.WebhookPush {
+		branch = strings.TrimPrefix(pushEvent.Ref, "refs/heads/")
+	}
+	event := &deferredWebhookEvent{
+		repositoryID: repository.ID,
+		branch:       branch,
+	}
+	for _, commit := range pushEvent.CommitList {
+		event.commitIDList = append(event.commitIDList, commit.ID)
+	}
+	s.deferredWebhookEventList = append(s.deferredWebhookEventList, event)
+	return true, true
+}
+
+// replayDeferredWebhookEventList replays the commits of the deferred events in the receiving order with replay, and reviews
+// the merge requests of the deferred merge request events with review. A failed commit or review is logged and doesn't stop
+// replaying the rest.
+func replayDeferredWebhookEventList(
+	ctx context.Context,
+	eventList []*deferredWebhookEvent,
+	logger *zap.Logger,
+	replay func(ctx context.Context, repositoryID int, commitID string, branch string) error,
+	review func(ctx context.Context, repositoryID int, mergeRequest gitlab.WebhookMergeRequestAttributes) error,
+) {
+	for _, event := range eventList {
+		if event.mergeRequest != nil {
+			if err := review(ctx, event.repositoryID, *event.mergeRequest); err != nil {
+				logger.Error("Failed to review deferred merge request event",
+					zap.Int("repository_id", event.repositoryID),
+					zap.Int("merge_request", event.mergeRequest.IID),
+					zap.Error(err),
+				)
+				continue
+			}
+			logger.Info("Reviewed deferred merge request event",
+				zap.Int("repository_id", event.repositoryID),
+				zap.Int("merge_request", event.mergeRequest.IID),
+			)
+			continue
+		}
+		for _, commitID := range event.commitIDList {
+			if err := replay(ctx, event.repositoryID, commitID, event.branch); err != nil {
+				logger.Error("Failed to replay deferred webhook event",
+					zap.Int("repository_id", event.repositoryID),
+					zap.String("branch", event.branch),
+					zap.String("commit", commitID),
+					zap.Error(err),
+				)
+				continue
+			}
+			logger.Info("Replayed deferred webhook event",
+				zap.Int("repository_id", event.repositoryID),
+				zap.String("branch", event.branch),
+				zap.String("commit", commitID),
+			)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/vcs/gitlab"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// fakeWebhookRepositoryService finds no repository for any webhook endpoint.
+type fakeWebhookRepositoryService struct {
+	api.RepositoryService
+}
+
+func (*fakeWebhookRepositoryService) GetRepositoryByWebhookEndpoint(ctx context.Context, webhookEndpointID string) (*api.Repository, error) {
+	return nil, nil
+}
+
+func TestMaintenanceModeRejectsUnknownEndpoint(t *testing.T) {
+	s := &Server{l: zap.NewNop(), e: echo.New(), RepositoryService: &fakeWebhookRepositoryService{}}
+	s.registerWebhookRoutes(s.e.Group("/hook"))
+	s.SetMaintenanceMode(true)
+
+	const sha = "3f5bcd0a6b2d4a7e0c8b5d3a2e1f0c9b8a7d6e5f"
+	body := fmt.Sprintf(`{"object_kind":%q,"ref":"refs/heads/main","before":%q,"after":%q,"commits":[{"id":"abc"}]}`, gitlab.WebhookPush, sha, sha)
+	req := httptest.NewRequest(http.MethodPost, "/hook/gitlab/endpoint", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("got status %d body %q, want %d.", rec.Code, rec.Body.String(), http.StatusNotFound)
+	}
+	if len(s.deferredWebhookEventList) != 0 {
+		t.Errorf("got %d deferred events, want 0 for the unknown endpoint.", len(s.deferredWebhookEventList))
+	}
+}
+
+func TestDeferWebhookEventIfInMaintenance(t *testing.T) {
+	s := &Server{l: zap.NewNop()}
+	repository := &api.Repository{ID: 1}
+	pushEvent := &gitlab.WebhookPushEvent{
+		ObjectKind: gitlab.WebhookPush,
+		Ref:        "refs/heads/main",
+		CommitList: []gitlab.WebhookCommit{{ID: "abc"}, {ID: "def"}},
+	}
+	tagPushEvent := &gitlab.WebhookPushEvent{
+		ObjectKind: gitlab.WebhookTagPush,
+		Ref:        "refs/tags/v1.0",
+		CommitList: []gitlab.WebhookCommit{{ID: "ghi"}},
+	}
+
+	if inMaintenance, _ := s.deferWebhookEventIfInMaintenance(repository, pushEvent, nil); inMaintenance {
+		t.Fatalf("got in maintenance before turning on the maintenance mode.")
+	}
+
+	s.SetMaintenanceMode(true)
+	for _, event := range []*gitlab.WebhookPushEvent{pushEvent, tagPushEvent} {
+		if inMaintenance, deferred := s.deferWebhookEventIfInMaintenance(repository, event, nil); !inMaintenance || !deferred {
+			t.Errorf("%s: got in maintenance %v deferred %v, want both true.", event.Ref, inMaintenance, deferred)
+		}
+	}
+	// The merge request event is deferred as well, to review the merge request after the maintenance.
+	mergeRequestEvent := &gitlab.WebhookPushEvent{ObjectKind: gitlab.WebhookMergeRequest}
+	mergeRequest := &gitlab.WebhookMergeRequestAttributes{IID: 7, Action: "open", TargetBranch: "main"}
+	if inMaintenance, deferred := s.deferWebhookEventIfInMaintenance(repository, mergeRequestEvent, mergeRequest); !inMaintenance || !deferred {
+		t.Errorf("merge request: got in maintenance %v deferred %v, want both true.", inMaintenance, deferred)
+	}
+	want := []*deferredWebhookEvent{
+		{repositoryID: 1, branch: "main", commitIDList: []string{"abc", "def"}},
+		{repositoryID: 1, branch: "refs/tags/v1.0", commitIDList: []string{"ghi"}},
+		{repositoryID: 1, mergeRequest: mergeRequest},
+	}
+	if !reflect.DeepEqual(s.deferredWebhookEventList, want) {
+		t.Errorf("got deferred events %+v, want %+v.", s.deferredWebhookEventList, want)
+	}
+
+	for len(s.deferredWebhookEventList) < maxDeferredWebhookEventCount {
+		s.deferWebhookEventIfInMaintenance(repository, pushEvent, nil)
+	}
+	if inMaintenance, deferred := s.deferWebhookEventIfInMaintenance(repository, pushEvent, nil); !inMaintenance || deferred {
+		t.Errorf("at the limit: got in maintenance %v deferred %v, want in maintenance and not deferred.", inMaintenance, deferred)
+	}
+	if len(s.deferredWebhookEventList) != maxDeferredWebhookEventCount {
+		t.Errorf("at the limit: got %d deferred events, want %d.", len(s.deferredWebhookEventList), maxDeferredWebhookEventCount)
+	}
+}
+
+func TestReplayDeferredWebhookEventList(t *testing.T) {
+	eventList := []*deferredWebhookEvent{
+		{repositoryID: 1, branch: "main", commitIDList: []string{"abc", "def"}},
+		{repositoryID: 1, mergeRequest: &gitlab.WebhookMergeRequestAttributes{IID: 7}},
+		{repositoryID: 2, branch: "refs/tags/v1.0", commitIDList: []string{"ghi"}},
+	}
+	var got []string
+	replayDeferredWebhookEventList(context.Background(), eventList, zap.NewNop(), func(ctx context.Context, repositoryID int, commitID string, branch string) error {
+		got = append(got, fmt.Sprintf("%d/%s/%s", repositoryID, branch, commitID))
+		// The failed commit doesn't stop replaying the rest.
+		if commitID == "abc" {
+			return fmt.Errorf("failed to fetch commit %s", commitID)
+		}
+		return nil
+	}, func(ctx context.Context, repositoryID int, mergeRequest gitlab.WebhookMergeRequestAttributes) error {
+		got = append(got, fmt.Sprintf("%d/!%d", repositoryID, mergeRequest.IID))
+		return nil
+	})
+	want := []string{"1/main/abc", "1/main/def", "1/!7", "2/refs/tags/v1.0/ghi"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got replayed %v, want %v.", got, want)
+	}
+}
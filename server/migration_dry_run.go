@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/db"
+	"github.com/bytebase/bytebase/plugin/db/util"
+	"go.uber.org/zap"
+)
+
+// DryRunMigration applies the migration statement to a shadow database cloned from the schema of the database on the instance,
+// so we can validate the migration applies cleanly before applying it to the database.
+// The shadow database is dropped afterwards. The returned result tells which statement failed if the migration doesn't apply cleanly.
+func (s *Server) DryRunMigration(ctx context.Context, instanceID int, databaseName string, statement string) (*api.DryRunResult, error) {
+	instance, err := s.composeInstanceByID(ctx, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	databaseFind := &api.DatabaseFind{
+		InstanceID: &instanceID,
+		Name:       &databaseName,
+	}
+	database, err := s.DatabaseService.FindDatabase(ctx, databaseFind)
+	if err != nil {
+		return nil, err
+	}
+	if database == nil {
+		return nil, &common.Error{Code: common.NotFound, Err: fmt.Errorf("database %q not found in instance %q", databaseName, instance.Name)}
+	}
+	return dryRunMigration(ctx, instance, database, statement, s.l)
+}
+
+// dryRunMigration clones the schema of database to a shadow database on the instance, applies the statement one by one to the
+// shadow database and drops the shadow database at last.
+func dryRunMigration(ctx context.Context, instance *api.Instance, database *api.Database, statement string, logger *zap.Logger) (*api.DryRunResult, error) {
+	switch instance.Engine {
+	case db.MySQL, db.TiDB, db.Postgres, db.SQLite:
+	default:
+		return nil, common.Errorf(common.Invalid, fmt.Errorf("dry run migration isn't supported for %s", instance.Engine))
+	}
+
+	var schema bytes.Buffer
+	if err := func() error {
+		driver, err := getDatabaseDriver(ctx, instance, database.Name, logger)
+		if err != nil {
+			return err
+		}
+		defer driver.Close(ctx)
+		return driver.Dump(ctx, database.Name, &schema, true /* schemaOnly */)
+	}(); err != nil {
+		return nil, fmt.Errorf("failed to dump the schema of database %q, error %w", database.Name, err)
+	}
+
+	shadowDatabaseName, createStatement := getDatabaseNameAndStatement(instance.Engine, fmt.Sprintf("bytebase_shadow_%d", time.Now().UnixNano()), database.CharacterSet, database.Collation, "" /* schema */)
+	adminDriver, err := getDatabaseDriver(ctx, instance, "", logger)
+	if err != nil {
+		return nil, err
+	}
+	defer adminDriver.Close(ctx)
+	if err := adminDriver.Execute(ctx, createStatement, false /* useTransaction */); err != nil {
+		return nil, fmt.Errorf("failed to create shadow database %q, error %w", shadowDatabaseName, err)
+	}
+	defer func() {
+		if err := dropShadowDatabase(ctx, adminDriver, instance, shadowDatabaseName); err != nil {
+			logger.Error("Failed to drop shadow database",
+				zap.String("instance", instance.Name),
+				zap.String("database", shadowDatabaseName),
+				zap.Error(err),
+			)
+		}
+	}()
+
+	shadowDriver, err := getDatabaseDriver(ctx, instance, shadowDatabaseName, logger)
+	if err != nil {
+		return nil, err
+	}
+	// The shadow database connection must be closed before dropping the shadow database.
+	defer shadowDriver.Close(ctx)
+
+	if err := shadowDriver.Restore(ctx, bufio.NewScanner(&schema)); err != nil {
+		return nil, fmt.Errorf("failed to clone the schema of database %q to shadow database %q, error %w", database.Name, shadowDatabaseName, err)
+	}
+
+	result := &api.DryRunResult{}
+	if err := util.ApplyMultiStatements(bufio.NewScanner(strings.NewReader(statement)), func(stmt string) error {
+		if err := shadowDriver.Execute(ctx, stmt, false /* useTransaction */); err != nil {
+			result.FailedStatement = stmt
+			result.Error = err.Error()
+			return err
+		}
+		return nil
+	}); err != nil && result.FailedStatement == "" {
+		// The statement can't be splitted.
+		return nil, common.Errorf(common.Invalid, err)
+	}
+	return result, nil
+}
+
+func dropShadowDatabase(ctx context.Context, adminDriver db.Driver, instance *api.Instance, shadowDatabaseName string) error {
+	switch instance.Engine {
+	case db.MySQL, db.TiDB:
+		return adminDriver.Execute(ctx, fmt.Sprintf("DROP DATABASE `%s`;", shadowDatabaseName), false /* useTransaction */)
+	case db.Postgres:
+		return adminDriver.Execute(ctx, fmt.Sprintf("DROP DATABASE \"%s\";", shadowDatabaseName), false /* useTransaction */)
+	case db.SQLite:
+		// A single SQLite file under the instance directory represents a database.
+		return os.Remove(filepath.Join(instance.Host, fmt.Sprintf("%s.db", shadowDatabaseName)))
+	}
+	return nil
+}
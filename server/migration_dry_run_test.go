@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/db"
+	_ "github.com/bytebase/bytebase/plugin/db/sqlite"
+	_ "github.com/mattn/go-sqlite3"
+	"go.uber.org/zap"
+)
+
+func TestDryRunMigration(t *testing.T) {
+	ctx := context.Background()
+	instance := &api.Instance{
+		Name:        "test",
+		Engine:      db.SQLite,
+		Host:        t.TempDir(),
+		Environment: &api.Environment{Name: "test"},
+	}
+	database := &api.Database{Name: "blog"}
+
+	// Prepare the source database.
+	driver, err := getDatabaseDriver(ctx, instance, "", zap.NewNop())
+	if err != nil {
+		t.Fatalf("getDatabaseDriver() got error %v, want OK.", err)
+	}
+	if err := driver.Execute(ctx, "CREATE DATABASE 'blog';", false); err != nil {
+		t.Fatalf("failed to create database, error %v", err)
+	}
+	driver.Close(ctx)
+	driver, err = getDatabaseDriver(ctx, instance, database.Name, zap.NewNop())
+	if err != nil {
+		t.Fatalf("getDatabaseDriver() got error %v, want OK.", err)
+	}
+	if err := driver.Execute(ctx, "CREATE TABLE book (id INTEGER PRIMARY KEY, name TEXT);", false); err != nil {
+		t.Fatalf("failed to create table, error %v", err)
+	}
+	driver.Close(ctx)
+
+	tests := []struct {
+		name                string
+		statement           string
+		wantFailedStatement string
+		wantError           string
+	}{
+		{
+			name:      "success",
+			statement: "ALTER TABLE book ADD COLUMN author TEXT;\nCREATE INDEX idx_book_name ON book(name);",
+		},
+		{
+			name:                "statement failure",
+			statement:           "ALTER TABLE book ADD COLUMN author TEXT;\nALTER TABLE author ADD COLUMN email TEXT;\nCREATE TABLE review (id INTEGER PRIMARY KEY);",
+			wantFailedStatement: "ALTER TABLE author ADD COLUMN email TEXT;",
+			wantError:           "no such table: author",
+		},
+	}
+
+	for _, test := range tests {
+		result, err := dryRunMigration(ctx, instance, database, test.statement, zap.NewNop())
+		if err != nil {
+			t.Fatalf("%q: dryRunMigration() got error %v, want OK.", test.name, err)
+		}
+		if result.FailedStatement != test.wantFailedStatement {
+			t.Errorf("%q: dryRunMigration() got failed statement %q, want %q.", test.name, result.FailedStatement, test.wantFailedStatement)
+		}
+		if !strings.Contains(result.Error, test.wantError) || (test.wantError == "" && result.Error != "") {
+			t.Errorf("%q: dryRunMigration() got error %q, want %q.", test.name, result.Error, test.wantError)
+		}
+	}
+
+	// The shadow databases are dropped, and the source database is untouched.
+	files, err := os.ReadDir(instance.Host)
+	if err != nil {
+		t.Fatalf("failed to read instance directory, error %v", err)
+	}
+	if len(files) != 1 || files[0].Name() != "blog.db" {
+		var names []string
+		for _, file := range files {
+			names = append(names, file.Name())
+		}
+		t.Errorf("got instance files %v, want [blog.db].", names)
+	}
+	driver, err = getDatabaseDriver(ctx, instance, database.Name, zap.NewNop())
+	if err != nil {
+		t.Fatalf("getDatabaseDriver() got error %v, want OK.", err)
+	}
+	defer driver.Close(ctx)
+	if err := driver.Execute(ctx, "ALTER TABLE book ADD COLUMN author TEXT;", false); err != nil {
+		t.Errorf("source database got modified by dry run, error %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/db"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"github.com/bytebase/bytebase/plugin/vcs/gitlab"
+	"go.uber.org/zap"
+)
+
+// migrationManifestFile is the manifest under the base directory listing the migration files in the order to apply.
+// Each line is a file path relative to the base directory, optionally followed by the checksum of the file content in the form of
+// "sha256:<hex>", e.g. "prod/db1__001__migrate__create_user.sql sha256:9f86d0...". The blank lines and the lines starting with "#" are ignored.
+const migrationManifestFile = "migrations.txt"
+
+// migrationChecksumPrefix is the prefix of the checksum of the migration file in the manifest.
+const migrationChecksumPrefix = "sha256:"
+
+// pushedFile is a file added by a commit in the push event.
+type pushedFile struct {
+	commit gitlab.WebhookCommit
+	added  string
+}
+
+// readMigrationManifest reads the migration manifest of the repository at the commit, and returns the listed migration files
+// along with their checksums keyed by the file path. Returns nil if the repository doesn't have the manifest, or it can't be read.
+func (s *Server) readMigrationManifest(ctx context.Context, repository *api.Repository, commitID string) ([]string, map[string]string) {
+	manifestPath := path.Join(repository.BaseDirectory, migrationManifestFile)
+	content, err := vcs.Get(repository.VCS.Type, s.vcsProviderConfig()).ReadFile(
+		ctx,
+		common.OauthContext{
+			ClientID:     repository.VCS.ApplicationID,
+			ClientSecret: repository.VCS.Secret,
+			AccessToken:  repository.AccessToken,
+			RefreshToken: repository.RefreshToken,
+			Refresher:    s.refreshToken(ctx, repository),
+		},
+		repository.VCS.InstanceURL,
+		repository.ExternalID,
+		manifestPath,
+		commitID,
+	)
+	if err != nil {
+		if common.ErrorCode(err) != common.NotFound {
+			s.l.Warn("Failed to read the migration manifest, fall back to the version order.", zap.String("manifest", manifestPath), zap.Error(err))
+		}
+		return nil, nil
+	}
+	return parseMigrationManifest(repository.BaseDirectory, content), parseMigrationChecksums(repository.BaseDirectory, content)
+}
+
+// parseMigrationManifest returns the migration file paths listed in the manifest, joined with the base directory.
+func parseMigrationManifest(baseDirectory string, content string) []string {
+	manifest := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		manifest = append(manifest, path.Join(baseDirectory, strings.Fields(line)[0]))
+	}
+	return manifest
+}
+
+// parseMigrationChecksums returns the checksums of the migration files in the manifest keyed by the file path joined with the base directory.
+// The checksum is the lower case hex of the SHA-256 of the file content, without migrationChecksumPrefix.
+func parseMigrationChecksums(baseDirectory string, content string) map[string]string {
+	checksumMap := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.HasPrefix(fields[1], migrationChecksumPrefix) {
+			continue
+		}
+		checksumMap[path.Join(baseDirectory, fields[0])] = strings.ToLower(strings.TrimPrefix(fields[1], migrationChecksumPrefix))
+	}
+	return checksumMap
+}
+
+// verifyMigrationChecksum verifies the content of the pushed migration file against its checksum in the manifest, guarding against
+// the file tampered between the push and the apply. Once the manifest records any checksum, every migration file must have one,
+// so a file sneaked in without being recorded is refused as well. Nothing is verified if the manifest records no checksum.
+func verifyMigrationChecksum(checksumMap map[string]string, filePath string, content string) error {
+	if len(checksumMap) == 0 {
+		return nil
+	}
+	want, ok := checksumMap[filePath]
+	if !ok {
+		return fmt.Errorf("the checksum is missing from the manifest %q", migrationManifestFile)
+	}
+	sum := sha256.Sum256([]byte(content))
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("the checksum %s%s mismatches %s%s recorded in the manifest %q", migrationChecksumPrefix, got, migrationChecksumPrefix, want, migrationManifestFile)
+	}
+	return nil
+}
+
+// orderPushedFileList orders the pushed files to apply. If the manifest isn't nil, the files listed in the manifest come first in
+// the manifest order, followed by the rest in the version order. Otherwise, the files are in the version order.
+// Returns the migration files missing from the manifest as well, which should be warned.
+// The files not parsed as migration files are left at the end in the pushed order, and they are skipped by processPushedFile.
+func orderPushedFileList(repository *api.Repository, fileList []*pushedFile, manifest []string) ([]*pushedFile, []*pushedFile) {
+	filePathTemplate := filepath.Join(repository.BaseDirectory, repository.FilePathTemplate)
+	position := make(map[string]int)
+	for i, filePath := range manifest {
+		if _, ok := position[filePath]; !ok {
+			position[filePath] = i
+		}
+	}
+
+	type orderedFile struct {
+		file     *pushedFile
+		version  string
+		position int
+	}
+	var listedList, unlistedList, otherList []*orderedFile
+	var missingList []*pushedFile
+	for _, file := range fileList {
+		mi, err := db.ParseMigrationInfo(file.added, filePathTemplate)
+		if err != nil {
+			otherList = append(otherList, &orderedFile{file: file})
+			continue
+		}
+		if i, ok := position[file.added]; ok {
+			listedList = append(listedList, &orderedFile{file: file, version: mi.Version, position: i})
+			continue
+		}
+		unlistedList = append(unlistedList, &orderedFile{file: file, version: mi.Version})
+		if manifest != nil {
+			missingList = append(missingList, file)
+		}
+	}
+	sort.SliceStable(listedList, func(i, j int) bool {
+		return listedList[i].position < listedList[j].position
+	})
+	sort.SliceStable(unlistedList, func(i, j int) bool {
+		return unlistedList[i].version < unlistedList[j].version
+	})
+
+	var orderedList []*pushedFile
+	for _, list := range [][]*orderedFile{listedList, unlistedList, otherList} {
+		for _, f := range list {
+			orderedList = append(orderedList, f.file)
+		}
+	}
+	return orderedList, missingList
+}
+
+// warnMissingFromManifest creates a WARNING project activity for the pushed migration file missing from the manifest.
+func (s *Server) warnMissingFromManifest(ctx context.Context, repository *api.Repository, pushEvent *gitlab.WebhookPushEvent, file *pushedFile) {
+	manifestPath := path.Join(repository.BaseDirectory, migrationManifestFile)
+	s.l.Warn("Migration file missing from the manifest, applied after the listed files.", zap.String("file", file.added), zap.String("manifest", manifestPath))
+	createdTime, _ := time.Parse(time.RFC3339, file.commit.Timestamp)
+	bytes, err := json.Marshal(api.ActivityProjectRepositoryPushPayload{
+		VCSPushEvent: composeVCSPushEvent(repository, pushEvent, file.commit, file.added, createdTime),
+	})
+	if err != nil {
+		s.l.Warn("Failed to construct project activity payload to record migration file missing from the manifest", zap.Error(err))
+		return
+	}
+
+	activityCreate := &api.ActivityCreate{
+		CreatorID:   api.SystemBotID,
+		ContainerID: repository.ProjectID,
+		Type:        api.ActivityProjectRepositoryPush,
+		Level:       api.ActivityWarn,
+		Comment:     fmt.Sprintf("Committed file %q is missing from the manifest %q, applied after the files in the manifest.", file.added, manifestPath),
+		Payload:     string(bytes),
+	}
+	if _, err := s.ActivityManager.CreateActivity(ctx, activityCreate, &ActivityMeta{}); err != nil {
+		s.l.Warn("Failed to create project activity to record migration file missing from the manifest", zap.Error(err))
+	}
+}
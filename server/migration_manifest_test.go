@@ -0,0 +1,173 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/vcs/gitlab"
+)
+
+func TestParseMigrationManifest(t *testing.T) {
+	content := `
+# Create the tables before the foreign keys.
+prod/db1__002__migrate__create_user.sql
+  prod/db1__001__migrate__create_fk.sql sha256:9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08
+
+`
+	want := []string{"bytebase/prod/db1__002__migrate__create_user.sql", "bytebase/prod/db1__001__migrate__create_fk.sql"}
+	if got := parseMigrationManifest("bytebase", content); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMigrationManifest() got %v, want %v.", got, want)
+	}
+}
+
+func TestParseMigrationChecksums(t *testing.T) {
+	content := `
+# The checksum is optional.
+prod/db1__002__migrate__create_user.sql
+prod/db1__001__migrate__create_fk.sql sha256:9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08
+prod/db1__003__migrate__add_index.sql md5:098f6bcd4621d373cade4e832627b4f6
+`
+	want := map[string]string{
+		"bytebase/prod/db1__001__migrate__create_fk.sql": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+	}
+	if got := parseMigrationChecksums("bytebase", content); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMigrationChecksums() got %v, want %v.", got, want)
+	}
+}
+
+func TestVerifyMigrationChecksum(t *testing.T) {
+	// The SHA-256 of "test".
+	checksumMap := map[string]string{
+		"bytebase/prod/db1__001__migrate__create_fk.sql": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+	}
+	tests := []struct {
+		name        string
+		checksumMap map[string]string
+		filePath    string
+		content     string
+		wantErr     bool
+	}{
+		{
+			name:        "matching file",
+			checksumMap: checksumMap,
+			filePath:    "bytebase/prod/db1__001__migrate__create_fk.sql",
+			content:     "test",
+		},
+		{
+			name:        "tampered file",
+			checksumMap: checksumMap,
+			filePath:    "bytebase/prod/db1__001__migrate__create_fk.sql",
+			content:     "test; DROP TABLE user;",
+			wantErr:     true,
+		},
+		{
+			name:        "file missing from the checksums",
+			checksumMap: checksumMap,
+			filePath:    "bytebase/prod/db1__002__migrate__create_user.sql",
+			content:     "test",
+			wantErr:     true,
+		},
+		{
+			name:     "manifest without checksums",
+			filePath: "bytebase/prod/db1__002__migrate__create_user.sql",
+			content:  "test",
+		},
+	}
+
+	for _, test := range tests {
+		err := verifyMigrationChecksum(test.checksumMap, test.filePath, test.content)
+		if test.wantErr && err == nil {
+			t.Errorf("%q: verifyMigrationChecksum() got OK, want error.", test.name)
+		}
+		if !test.wantErr && err != nil {
+			t.Errorf("%q: verifyMigrationChecksum() got error %v, want OK.", test.name, err)
+		}
+	}
+}
+
+func TestOrderPushedFileList(t *testing.T) {
+	repository := &api.Repository{
+		BaseDirectory:    "bytebase",
+		FilePathTemplate: "{{ENV_NAME}}/{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql",
+	}
+	fileList := []*pushedFile{
+		{commit: gitlab.WebhookCommit{ID: "c1"}, added: "bytebase/prod/db1__003__migrate__add_index.sql"},
+		{commit: gitlab.WebhookCommit{ID: "c1"}, added: "bytebase/README.md"},
+		{commit: gitlab.WebhookCommit{ID: "c2"}, added: "bytebase/prod/db1__001__migrate__create_fk.sql"},
+		{commit: gitlab.WebhookCommit{ID: "c2"}, added: "bytebase/prod/db1__002__migrate__create_user.sql"},
+		{commit: gitlab.WebhookCommit{ID: "c2"}, added: "bytebase/prod/db1__004__migrate__add_column.sql"},
+	}
+
+	tests := []struct {
+		name        string
+		manifest    []string
+		want        []string
+		wantMissing []string
+	}{
+		{
+			name:     "version order without manifest",
+			manifest: nil,
+			want: []string{
+				"bytebase/prod/db1__001__migrate__create_fk.sql",
+				"bytebase/prod/db1__002__migrate__create_user.sql",
+				"bytebase/prod/db1__003__migrate__add_index.sql",
+				"bytebase/prod/db1__004__migrate__add_column.sql",
+				"bytebase/README.md",
+			},
+		},
+		{
+			name: "manifest order",
+			manifest: []string{
+				"bytebase/prod/db1__002__migrate__create_user.sql",
+				"bytebase/prod/db1__001__migrate__create_fk.sql",
+				"bytebase/prod/db1__004__migrate__add_column.sql",
+				"bytebase/prod/db1__003__migrate__add_index.sql",
+			},
+			want: []string{
+				"bytebase/prod/db1__002__migrate__create_user.sql",
+				"bytebase/prod/db1__001__migrate__create_fk.sql",
+				"bytebase/prod/db1__004__migrate__add_column.sql",
+				"bytebase/prod/db1__003__migrate__add_index.sql",
+				"bytebase/README.md",
+			},
+		},
+		{
+			name: "missing from manifest",
+			manifest: []string{
+				// The files applied before are listed as well.
+				"bytebase/prod/db1__000__migrate__init.sql",
+				"bytebase/prod/db1__002__migrate__create_user.sql",
+				"bytebase/prod/db1__001__migrate__create_fk.sql",
+			},
+			want: []string{
+				"bytebase/prod/db1__002__migrate__create_user.sql",
+				"bytebase/prod/db1__001__migrate__create_fk.sql",
+				"bytebase/prod/db1__003__migrate__add_index.sql",
+				"bytebase/prod/db1__004__migrate__add_column.sql",
+				"bytebase/README.md",
+			},
+			wantMissing: []string{
+				"bytebase/prod/db1__003__migrate__add_index.sql",
+				"bytebase/prod/db1__004__migrate__add_column.sql",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		orderedList, missingList := orderPushedFileList(repository, fileList, test.manifest)
+		var got, gotMissing []string
+		for _, file := range orderedList {
+			got = append(got, file.added)
+		}
+		for _, file := range missingList {
+			gotMissing = append(gotMissing, file.added)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: orderPushedFileList() got %v, want %v.", test.name, got, test.want)
+		}
+		if !reflect.DeepEqual(gotMissing, test.wantMissing) {
+			t.Errorf("%q: orderPushedFileList() got missing %v, want %v.", test.name, gotMissing, test.wantMissing)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+)
+
+const (
+	// oauthStateTTL is how long an OAuth state stays valid after the authorization starts.
+	oauthStateTTL = 10 * time.Minute
+	// oauthStateLength is the length of the OAuth state.
+	oauthStateLength = 32
+	// oauthCodeVerifierLength is the length of the PKCE code verifier, which must be between 43 and 128.
+	oauthCodeVerifierLength = 64
+	// oauthCodeChallengeMethod is the PKCE code challenge method.
+	oauthCodeChallengeMethod = "S256"
+	// oauthTicketTTL is how long an OAuth ticket stays valid after the token exchange.
+	oauthTicketTTL = 30 * time.Minute
+	// oauthTicketLength is the length of the OAuth ticket.
+	oauthTicketLength = 32
+)
+
+// createOAuthState starts an OAuth authorization for the principal and the VCS.
+// Returns the state and the PKCE code challenge to be sent in the authorization request.
+// The state is persisted, so the token exchange can be verified by any replica and across restarts.
+func (s *Server) createOAuthState(ctx context.Context, vcsID int, principalID int, now time.Time) (string, string, error) {
+	state, err := common.RandomSecret(oauthStateLength)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate oauth state: %w", err)
+	}
+	codeVerifier, err := common.RandomSecret(oauthCodeVerifierLength)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate oauth code verifier: %w", err)
+	}
+	if err := s.VCSOAuthService.CreateOAuthState(ctx, &api.VCSOAuthState{
+		State:        state,
+		VCSID:        vcsID,
+		PrincipalID:  principalID,
+		CodeVerifier: codeVerifier,
+		ExpiresTs:    now.Add(oauthStateTTL).Unix(),
+	}); err != nil {
+		return "", "", fmt.Errorf("failed to create oauth state: %w", err)
+	}
+	return state, oauthCodeChallenge(codeVerifier), nil
+}
+
+// consumeOAuthState verifies the state returned by the OAuth callback and returns its PKCE code verifier.
+// The state is removed whether or not the verification succeeds, so it can't be replayed.
+func (s *Server) consumeOAuthState(ctx context.Context, state string, vcsID int, principalID int, now time.Time) (string, error) {
+	oauthState, err := s.VCSOAuthService.ConsumeOAuthState(ctx, state)
+	if err != nil {
+		return "", fmt.Errorf("failed to consume oauth state: %w", err)
+	}
+	if oauthState == nil {
+		return "", common.Errorf(common.Invalid, fmt.Errorf("oauth state mismatch"))
+	}
+	if now.Unix() >= oauthState.ExpiresTs {
+		return "", common.Errorf(common.Invalid, fmt.Errorf("oauth state expired"))
+	}
+	if oauthState.VCSID != vcsID || oauthState.PrincipalID != principalID {
+		return "", common.Errorf(common.Invalid, fmt.Errorf("oauth state mismatch"))
+	}
+	return oauthState.CodeVerifier, nil
+}
+
+// issueOAuthTicket keeps the token of the verified exchange, and returns the ticket redeeming it.
+func (s *Server) issueOAuthTicket(ctx context.Context, vcsID int, principalID int, token *vcs.OAuthToken, now time.Time) (string, error) {
+	ticket, err := common.RandomSecret(oauthTicketLength)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate oauth ticket: %w", err)
+	}
+	if err := s.VCSOAuthService.CreateOAuthTicket(ctx, &api.VCSOAuthTicket{
+		Ticket:         ticket,
+		VCSID:          vcsID,
+		PrincipalID:    principalID,
+		AccessToken:    token.AccessToken,
+		RefreshToken:   token.RefreshToken,
+		TokenExpiresTs: token.ExpiresTs,
+		ExpiresTs:      now.Add(oauthTicketTTL).Unix(),
+	}); err != nil {
+		return "", fmt.Errorf("failed to create oauth ticket: %w", err)
+	}
+	return ticket, nil
+}
+
+// redeemOAuthTicket verifies the ticket issued to the principal for the VCS and returns it with the token.
+// The caller deletes the ticket once it's used, so a failed request can be retried with the same ticket.
+func (s *Server) redeemOAuthTicket(ctx context.Context, ticket string, vcsID int, principalID int, now time.Time) (*api.VCSOAuthTicket, error) {
+	if ticket == "" {
+		return nil, common.Errorf(common.Invalid, fmt.Errorf("oauth ticket is required"))
+	}
+	oauthTicket, err := s.VCSOAuthService.FindOAuthTicket(ctx, ticket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find oauth ticket: %w", err)
+	}
+	if oauthTicket == nil || oauthTicket.VCSID != vcsID || oauthTicket.PrincipalID != principalID {
+		return nil, common.Errorf(common.Invalid, fmt.Errorf("oauth ticket mismatch"))
+	}
+	if now.Unix() >= oauthTicket.ExpiresTs {
+		return nil, common.Errorf(common.Invalid, fmt.Errorf("oauth ticket expired"))
+	}
+	return oauthTicket, nil
+}
+
+// oauthCodeChallenge returns the S256 PKCE code challenge of the code verifier.
+func oauthCodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
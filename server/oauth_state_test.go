@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+)
+
+// fakeVCSOAuthService keeps the OAuth states and tickets in memory, shared by the servers as if it were the database.
+type fakeVCSOAuthService struct {
+	stateMap  map[string]*api.VCSOAuthState
+	ticketMap map[string]*api.VCSOAuthTicket
+}
+
+func newFakeVCSOAuthService() *fakeVCSOAuthService {
+	return &fakeVCSOAuthService{
+		stateMap:  make(map[string]*api.VCSOAuthState),
+		ticketMap: make(map[string]*api.VCSOAuthTicket),
+	}
+}
+
+func (f *fakeVCSOAuthService) CreateOAuthState(ctx context.Context, create *api.VCSOAuthState) error {
+	f.stateMap[create.State] = create
+	return nil
+}
+
+func (f *fakeVCSOAuthService) ConsumeOAuthState(ctx context.Context, state string) (*api.VCSOAuthState, error) {
+	oauthState := f.stateMap[state]
+	delete(f.stateMap, state)
+	return oauthState, nil
+}
+
+func (f *fakeVCSOAuthService) CreateOAuthTicket(ctx context.Context, create *api.VCSOAuthTicket) error {
+	f.ticketMap[create.Ticket] = create
+	return nil
+}
+
+func (f *fakeVCSOAuthService) FindOAuthTicket(ctx context.Context, ticket string) (*api.VCSOAuthTicket, error) {
+	return f.ticketMap[ticket], nil
+}
+
+func (f *fakeVCSOAuthService) DeleteOAuthTicket(ctx context.Context, ticket string) error {
+	delete(f.ticketMap, ticket)
+	return nil
+}
+
+func TestOAuthState(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1650000000, 0)
+	tests := []struct {
+		name        string
+		state       func(state string) string
+		vcsID       int
+		principalID int
+		consumeAt   time.Time
+		wantErr     bool
+	}{
+		{
+			name:        "matched state",
+			state:       func(state string) string { return state },
+			vcsID:       1,
+			principalID: 101,
+			consumeAt:   now.Add(time.Minute),
+			wantErr:     false,
+		},
+		{
+			name:        "mismatched state",
+			state:       func(state string) string { return state + "x" },
+			vcsID:       1,
+			principalID: 101,
+			consumeAt:   now.Add(time.Minute),
+			wantErr:     true,
+		},
+		{
+			name:        "expired state",
+			state:       func(state string) string { return state },
+			vcsID:       1,
+			principalID: 101,
+			consumeAt:   now.Add(oauthStateTTL),
+			wantErr:     true,
+		},
+		{
+			name:        "another VCS",
+			state:       func(state string) string { return state },
+			vcsID:       2,
+			principalID: 101,
+			consumeAt:   now.Add(time.Minute),
+			wantErr:     true,
+		},
+		{
+			name:        "another principal",
+			state:       func(state string) string { return state },
+			vcsID:       1,
+			principalID: 102,
+			consumeAt:   now.Add(time.Minute),
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		oauthService := newFakeVCSOAuthService()
+		s := &Server{VCSOAuthService: oauthService}
+		state, codeChallenge, err := s.createOAuthState(ctx, 1, 101, now)
+		if err != nil {
+			t.Fatalf("%q: createOAuthState() got error %v, want OK.", test.name, err)
+		}
+		// The state is verified by another server sharing the database, e.g. a replica or the restarted server.
+		s = &Server{VCSOAuthService: oauthService}
+		codeVerifier, err := s.consumeOAuthState(ctx, test.state(state), test.vcsID, test.principalID, test.consumeAt)
+		if test.wantErr {
+			if common.ErrorCode(err) != common.Invalid {
+				t.Errorf("%q: consumeOAuthState() got error %v, want Invalid error.", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: consumeOAuthState() got error %v, want OK.", test.name, err)
+		}
+		if got := oauthCodeChallenge(codeVerifier); got != codeChallenge {
+			t.Errorf("%q: code challenge of the verifier got %q, want %q.", test.name, got, codeChallenge)
+		}
+	}
+}
+
+func TestOAuthStateSingleUse(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1650000000, 0)
+	s := &Server{VCSOAuthService: newFakeVCSOAuthService()}
+	state, _, err := s.createOAuthState(ctx, 1, 101, now)
+	if err != nil {
+		t.Fatalf("createOAuthState() got error %v, want OK.", err)
+	}
+	if _, err := s.consumeOAuthState(ctx, state, 1, 101, now); err != nil {
+		t.Fatalf("consumeOAuthState() got error %v, want OK.", err)
+	}
+	if _, err := s.consumeOAuthState(ctx, state, 1, 101, now); common.ErrorCode(err) != common.Invalid {
+		t.Errorf("consumeOAuthState() again got error %v, want Invalid error.", err)
+	}
+}
+
+func TestOAuthTicket(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1650000000, 0)
+	s := &Server{VCSOAuthService: newFakeVCSOAuthService()}
+	ticket, err := s.issueOAuthTicket(ctx, 1, 101, &vcs.OAuthToken{AccessToken: "access", RefreshToken: "refresh", ExpiresTs: 1650007200}, now)
+	if err != nil {
+		t.Fatalf("issueOAuthTicket() got error %v, want OK.", err)
+	}
+
+	oauthTicket, err := s.redeemOAuthTicket(ctx, ticket, 1, 101, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("redeemOAuthTicket() got error %v, want OK.", err)
+	}
+	if oauthTicket.AccessToken != "access" || oauthTicket.RefreshToken != "refresh" || oauthTicket.TokenExpiresTs != 1650007200 {
+		t.Errorf("redeemOAuthTicket() got %+v, want the exchanged token.", oauthTicket)
+	}
+
+	tests := []struct {
+		name        string
+		ticket      string
+		vcsID       int
+		principalID int
+		redeemAt    time.Time
+	}{
+		{name: "without ticket", ticket: "", vcsID: 1, principalID: 101, redeemAt: now},
+		{name: "unknown ticket", ticket: ticket + "x", vcsID: 1, principalID: 101, redeemAt: now},
+		{name: "another VCS", ticket: ticket, vcsID: 2, principalID: 101, redeemAt: now},
+		{name: "another principal", ticket: ticket, vcsID: 1, principalID: 102, redeemAt: now},
+		{name: "expired ticket", ticket: ticket, vcsID: 1, principalID: 101, redeemAt: now.Add(oauthTicketTTL)},
+	}
+	for _, test := range tests {
+		if _, err := s.redeemOAuthTicket(ctx, test.ticket, test.vcsID, test.principalID, test.redeemAt); common.ErrorCode(err) != common.Invalid {
+			t.Errorf("%q: redeemOAuthTicket() got error %v, want Invalid error.", test.name, err)
+		}
+	}
+}
@@ -49,9 +49,42 @@ func (s *Server) composePipelineRelationship(ctx context.Context, pipeline *api.
 		}
 	}
 
+	// TaskScheduler is nil in readonly mode.
+	if s.TaskScheduler != nil {
+		pipeline.Queued = s.TaskScheduler.IsPipelineQueued(pipeline.ID)
+	}
+
 	return nil
 }
 
+// isPipelineRunning returns true if the pipeline has a running task.
+func isPipelineRunning(pipeline *api.Pipeline) bool {
+	for _, stage := range pipeline.StageList {
+		for _, task := range stage.TaskList {
+			if task.Status == api.TaskRunning {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isPipelinePendingToRun returns true if the next task to schedule for the pipeline is PENDING.
+// It follows the same order as ScheduleNextTaskIfNeeded.
+func isPipelinePendingToRun(pipeline *api.Pipeline) bool {
+	for _, stage := range pipeline.StageList {
+		for _, task := range stage.TaskList {
+			switch task.Status {
+			case api.TaskRunning, api.TaskFailed, api.TaskPendingApproval:
+				return false
+			case api.TaskPending:
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // ScheduleNextTaskIfNeeded tries to schedule the next task if needed.
 // Returns nil if no task applicable can be scheduled
 func (s *Server) ScheduleNextTaskIfNeeded(ctx context.Context, pipeline *api.Pipeline) (*api.Task, error) {
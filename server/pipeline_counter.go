@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bytebase/bytebase/api"
+)
+
+// PipelineCounter counts the active pipelines per project in-process, so that the concurrent pipeline limit
+// is enforced without querying the database every time. A pipeline is active from its first task starting until
+// the pipeline is completed or canceled.
+//
+// The active pipelines are tracked by their IDs rather than a bare number, so that starting or completing the same
+// pipeline more than once, e.g. by the scheduler and the API racing with each other, doesn't skew the count.
+type PipelineCounter struct {
+	mu sync.Mutex
+	// activeMap maps the project ID to the set of its active pipeline IDs.
+	activeMap map[int]map[int]bool
+	// projectMap maps the active pipeline ID to its project ID, since the completion doesn't know the project.
+	projectMap map[int]int
+}
+
+// NewPipelineCounter returns a new PipelineCounter without any active pipeline.
+func NewPipelineCounter() *PipelineCounter {
+	return &PipelineCounter{
+		activeMap:  make(map[int]map[int]bool),
+		projectMap: make(map[int]int),
+	}
+}
+
+// Start counts the pipeline of the project as active. It's a no-op if the pipeline is already active.
+func (c *PipelineCounter) Start(projectID int, pipelineID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.start(projectID, pipelineID)
+}
+
+// TryStart counts the pipeline of the project as active only if the project has fewer than limit active pipelines,
+// checking and counting at once so that the concurrent starts can't exceed the limit. A negative limit means unlimited.
+// Returns true if the pipeline is active, including the case it's already active.
+func (c *PipelineCounter) TryStart(projectID int, pipelineID int, limit int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.projectMap[pipelineID]; ok {
+		return true
+	}
+	if limit >= 0 && len(c.activeMap[projectID]) >= limit {
+		return false
+	}
+	c.start(projectID, pipelineID)
+	return true
+}
+
+func (c *PipelineCounter) start(projectID int, pipelineID int) {
+	if _, ok := c.projectMap[pipelineID]; ok {
+		return
+	}
+	if c.activeMap[projectID] == nil {
+		c.activeMap[projectID] = make(map[int]bool)
+	}
+	c.activeMap[projectID][pipelineID] = true
+	c.projectMap[pipelineID] = projectID
+}
+
+// Finish stops counting the pipeline as active. It's a no-op if the pipeline isn't active.
+func (c *PipelineCounter) Finish(pipelineID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	projectID, ok := c.projectMap[pipelineID]
+	if !ok {
+		return
+	}
+	delete(c.projectMap, pipelineID)
+	delete(c.activeMap[projectID], pipelineID)
+	if len(c.activeMap[projectID]) == 0 {
+		delete(c.activeMap, projectID)
+	}
+}
+
+// Count returns the number of the active pipelines of the project.
+func (c *PipelineCounter) Count(projectID int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.activeMap[projectID])
+}
+
+// IsActive returns true if the pipeline is counted as active.
+func (c *PipelineCounter) IsActive(pipelineID int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.projectMap[pipelineID]
+	return ok
+}
+
+// Reconcile replaces the active pipelines with those found in the database, keyed by the pipeline ID to its project ID.
+func (c *PipelineCounter) Reconcile(activePipelineMap map[int]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.activeMap = make(map[int]map[int]bool)
+	c.projectMap = make(map[int]int)
+	for pipelineID, projectID := range activePipelineMap {
+		c.start(projectID, pipelineID)
+	}
+}
+
+// isPipelineStarted returns true if any task of the pipeline has started, i.e. isn't waiting to run.
+func isPipelineStarted(pipeline *api.Pipeline) bool {
+	for _, stage := range pipeline.StageList {
+		for _, task := range stage.TaskList {
+			if task.Status != api.TaskPending && task.Status != api.TaskPendingApproval {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findPipelineProjectID returns the project ID of the pipeline by its issue.
+// The pipeline not wrapped in an issue is counted in the default project.
+func (s *Server) findPipelineProjectID(ctx context.Context, pipelineID int) (int, error) {
+	issue, err := s.IssueService.FindIssue(ctx, &api.IssueFind{PipelineID: &pipelineID})
+	if err != nil {
+		return 0, err
+	}
+	if issue == nil {
+		return api.DefaultProjectID, nil
+	}
+	return issue.ProjectID, nil
+}
+
+// reconcilePipelineCounter counts the open pipelines which have started as active. The pipelines must be
+// composed with their tasks.
+func (s *Server) reconcilePipelineCounter(ctx context.Context, counter *PipelineCounter, openPipelineList []*api.Pipeline) error {
+	activePipelineMap := make(map[int]int)
+	for _, pipeline := range openPipelineList {
+		if !isPipelineStarted(pipeline) {
+			continue
+		}
+		projectID, err := s.findPipelineProjectID(ctx, pipeline.ID)
+		if err != nil {
+			return err
+		}
+		activePipelineMap[pipeline.ID] = projectID
+	}
+	counter.Reconcile(activePipelineMap)
+	return nil
+}
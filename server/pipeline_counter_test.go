@@ -0,0 +1,107 @@
+package server
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestPipelineCounterConcurrent(t *testing.T) {
+	counter := NewPipelineCounter()
+	const projectCount = 4
+	const pipelineCount = 200
+
+	// Start every pipeline twice and finish the odd pipelines twice concurrently.
+	var wg sync.WaitGroup
+	for projectID := 1; projectID <= projectCount; projectID++ {
+		for i := 0; i < pipelineCount; i++ {
+			pipelineID := projectID*pipelineCount + i
+			for k := 0; k < 2; k++ {
+				wg.Add(1)
+				go func(projectID, pipelineID int) {
+					defer wg.Done()
+					counter.Start(projectID, pipelineID)
+				}(projectID, pipelineID)
+			}
+		}
+	}
+	wg.Wait()
+	for projectID := 1; projectID <= projectCount; projectID++ {
+		if got := counter.Count(projectID); got != pipelineCount {
+			t.Errorf("Count(%d) got %d after starting, want %d.", projectID, got, pipelineCount)
+		}
+	}
+
+	for projectID := 1; projectID <= projectCount; projectID++ {
+		for i := 1; i < pipelineCount; i += 2 {
+			pipelineID := projectID*pipelineCount + i
+			for k := 0; k < 2; k++ {
+				wg.Add(1)
+				go func(pipelineID int) {
+					defer wg.Done()
+					counter.Finish(pipelineID)
+				}(pipelineID)
+			}
+		}
+	}
+	wg.Wait()
+	for projectID := 1; projectID <= projectCount; projectID++ {
+		if got := counter.Count(projectID); got != pipelineCount/2 {
+			t.Errorf("Count(%d) got %d after finishing, want %d.", projectID, got, pipelineCount/2)
+		}
+	}
+}
+
+func TestPipelineCounterTryStart(t *testing.T) {
+	counter := NewPipelineCounter()
+	const limit = 3
+
+	// The concurrent starts can't exceed the limit.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	startedCount := 0
+	for pipelineID := 1; pipelineID <= 100; pipelineID++ {
+		wg.Add(1)
+		go func(pipelineID int) {
+			defer wg.Done()
+			if counter.TryStart(1, pipelineID, limit) {
+				mu.Lock()
+				startedCount++
+				mu.Unlock()
+			}
+		}(pipelineID)
+	}
+	wg.Wait()
+	if startedCount != limit {
+		t.Errorf("TryStart() got %d pipelines started, want %d.", startedCount, limit)
+	}
+	if got := counter.Count(1); got != limit {
+		t.Errorf("Count(1) got %d, want %d.", got, limit)
+	}
+	// The other project isn't limited by this project.
+	if !counter.TryStart(2, 1000, limit) {
+		t.Errorf("TryStart(2, 1000) got false, want true.")
+	}
+	// A negative limit means unlimited.
+	if !counter.TryStart(1, 1001, -1) {
+		t.Errorf("TryStart(1, 1001, -1) got false, want true.")
+	}
+}
+
+func TestPipelineCounterReconcile(t *testing.T) {
+	counter := NewPipelineCounter()
+	counter.Start(1, 10)
+	counter.Start(1, 11)
+	counter.Start(2, 20)
+
+	// Pipeline 11 completed while the server was down, and pipeline 12 started by another replica.
+	counter.Reconcile(map[int]int{10: 1, 12: 1, 30: 3})
+	for projectID, want := range map[int]int{1: 2, 2: 0, 3: 1} {
+		if got := counter.Count(projectID); got != want {
+			t.Errorf("Count(%d) got %d, want %d.", projectID, got, want)
+		}
+	}
+	counter.Finish(11)
+	if got := counter.Count(1); got != 2 {
+		t.Errorf("Count(1) got %d after finishing the reconciled away pipeline, want 2.", got)
+	}
+}
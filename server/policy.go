@@ -23,6 +23,15 @@ func (s *Server) hasAccessToUpsertPolicy(policyUpsert *api.PolicyUpsert) error {
 		if policyUpsert.Payload != defaultPolicy && !s.feature(api.FeatureApprovalPolicy) {
 			return fmt.Errorf(api.FeatureApprovalPolicy.AccessErrorMessage())
 		}
+		if policyUpsert.Payload != "" {
+			policy, err := api.UnmarshalPipelineApprovalPolicy(policyUpsert.Payload)
+			if err != nil {
+				return err
+			}
+			if policy.ApprovalChain != nil && !s.feature(api.FeatureCustomApprovalChain) {
+				return fmt.Errorf(api.FeatureCustomApprovalChain.AccessErrorMessage())
+			}
+		}
 	case api.PolicyTypeBackupPlan:
 		if policyUpsert.Payload != defaultPolicy && !s.feature(api.FeatureBackupPolicy) {
 			return fmt.Errorf(api.FeatureBackupPolicy.AccessErrorMessage())
@@ -1,12 +1,15 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bytebase/bytebase/api"
 	"github.com/bytebase/bytebase/common"
@@ -16,6 +19,7 @@ import (
 	"github.com/google/jsonapi"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
 )
 
 func (s *Server) registerProjectRoutes(g *echo.Group) {
@@ -146,6 +150,13 @@ func (s *Server) registerProjectRoutes(g *echo.Group) {
 			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to patch project ID: %v", id)).SetInternal(err)
 		}
 
+		// Clean up the repositories of the deleted project.
+		if v := projectPatch.RowStatus; v != nil && api.RowStatus(*v) == api.Archived {
+			if err := s.archiveProjectRepositories(ctx, id, projectPatch.UpdaterID); err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to archive the repositories of project ID: %v", id)).SetInternal(err)
+			}
+		}
+
 		if err := s.composeProjectRelationship(ctx, project); err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch updated project relationship: %v", project.Name)).SetInternal(err)
 		}
@@ -188,6 +199,104 @@ func (s *Server) registerProjectRoutes(g *echo.Group) {
 			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted create linked repository request: %s", err.Error()))
 		}
 
+		if repositoryCreate.SchemaSourceType == "" {
+			repositoryCreate.SchemaSourceType = api.SchemaSourceSingleFile
+		}
+		if err := api.ValidateRepositorySchemaSourceType(repositoryCreate.SchemaSourceType, repositoryCreate.SchemaPathTemplate); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted create linked repository request: %s", err.Error()))
+		}
+		if err := api.ValidateRepositorySchemaSnapshotOnApply(repositoryCreate.SchemaSnapshotOnApply, repositoryCreate.SchemaSourceType, repositoryCreate.SchemaPathTemplate); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted create linked repository request: %s", err.Error()))
+		}
+
+		if repositoryCreate.DuplicateVersionPolicy == "" {
+			repositoryCreate.DuplicateVersionPolicy = api.DuplicateVersionError
+		}
+		if err := api.ValidateRepositoryDuplicateVersionPolicy(repositoryCreate.DuplicateVersionPolicy); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted create linked repository request: %s", err.Error()))
+		}
+
+		if repositoryCreate.EmptyMigrationPolicy == "" {
+			repositoryCreate.EmptyMigrationPolicy = api.EmptyMigrationSkip
+		}
+		if err := api.ValidateRepositoryEmptyMigrationPolicy(repositoryCreate.EmptyMigrationPolicy); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted create linked repository request: %s", err.Error()))
+		}
+
+		if err := api.ValidateRepositoryMigrationStatementTimeout(repositoryCreate.MigrationStatementTimeout); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted create linked repository request: %s", err.Error()))
+		}
+
+		if repositoryCreate.DriftAction == "" {
+			repositoryCreate.DriftAction = api.DriftActionAnomalyOnly
+		}
+		if err := api.ValidateRepositoryDriftAction(repositoryCreate.DriftAction); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted create linked repository request: %s", err.Error()))
+		}
+		if repositoryCreate.DriftAction == api.DriftActionCreateIssue && !s.feature(api.FeatureSchemaDrift) {
+			return echo.NewHTTPError(http.StatusForbidden, api.FeatureSchemaDrift.AccessErrorMessage())
+		}
+
+		if err := api.ValidateRepositoryIgnorePathPatterns(repositoryCreate.IgnorePathPatterns); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted create linked repository request: %s", err.Error()))
+		}
+
+		if err := api.ValidateRepositoryNotificationWebhookURLList(repositoryCreate.NotificationWebhookURLList); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted create linked repository request: %s", err.Error()))
+		}
+
+		if err := api.ValidateRepositoryTargetBranchFilter(repositoryCreate.TargetBranchFilter); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted create linked repository request: %s", err.Error()))
+		}
+
+		if repositoryCreate.SkipDirective == "" {
+			repositoryCreate.SkipDirective = api.DefaultRepositorySkipDirective
+		}
+		if err := api.ValidateRepositorySkipDirective(repositoryCreate.SkipDirective); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted create linked repository request: %s", err.Error()))
+		}
+
+		if err := api.ValidateRepositorySchemaRef(repositoryCreate.SchemaRef); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted create linked repository request: %s", err.Error()))
+		}
+
+		if err := api.ValidateRepositoryCommitAuthorEmail(repositoryCreate.CommitAuthorEmail); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted create linked repository request: %s", err.Error()))
+		}
+
+		// 0 means the deployment config of the project is used.
+		if repositoryCreate.DeploymentConfigID != nil && *repositoryCreate.DeploymentConfigID == 0 {
+			repositoryCreate.DeploymentConfigID = nil
+		}
+		if repositoryCreate.DeploymentConfigID != nil {
+			if err := s.validateRepositoryDeploymentConfig(ctx, project, *repositoryCreate.DeploymentConfigID); err != nil {
+				if common.ErrorCode(err) == common.Invalid {
+					return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted create linked repository request: %s", err.Error()))
+				}
+				return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to validate deployment config for project ID: %v", projectID)).SetInternal(err)
+			}
+		}
+
+		// 0 means no default assignee.
+		if repositoryCreate.DefaultAssigneeID != nil && *repositoryCreate.DefaultAssigneeID == 0 {
+			repositoryCreate.DefaultAssigneeID = nil
+		}
+		if repositoryCreate.DefaultAssigneeID != nil {
+			if err := s.validateRepositoryDefaultAssignee(ctx, *repositoryCreate.DefaultAssigneeID); err != nil {
+				if common.ErrorCode(err) == common.Invalid {
+					return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted create linked repository request: %s", err.Error()))
+				}
+				return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to validate default assignee ID: %v", *repositoryCreate.DefaultAssigneeID)).SetInternal(err)
+			}
+		}
+
+		if repositoryCreate.CommitStatusContext == "" {
+			repositoryCreate.CommitStatusContext = vcsPlugin.DefaultCommitStatusContext
+		}
+		if err := api.ValidateRepositoryCommitStatusContext(repositoryCreate.CommitStatusContext); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted create linked repository request: %s", err.Error()))
+		}
+
 		vcsFind := &api.VCSFind{
 			ID: &repositoryCreate.VCSID,
 		}
@@ -199,25 +308,54 @@ func (s *Server) registerProjectRoutes(g *echo.Group) {
 			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("VCS ID not found: %d", repositoryCreate.VCSID))
 		}
 
+		// The token is redeemed by the ticket issued to the creator by the verified OAuth token exchange of the VCS.
+		oauthTicket, err := s.redeemOAuthTicket(ctx, repositoryCreate.OAuthTicket, repositoryCreate.VCSID, repositoryCreate.CreatorID, time.Now())
+		if err != nil {
+			if common.ErrorCode(err) == common.Invalid {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted create linked repository request: %s", err.Error()))
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to redeem the OAuth ticket for project ID: %v", projectID)).SetInternal(err)
+		}
+		repositoryCreate.AccessToken = oauthTicket.AccessToken
+		repositoryCreate.RefreshToken = oauthTicket.RefreshToken
+		repositoryCreate.ExpiresTs = oauthTicket.TokenExpiresTs
+
+		provider := vcsPlugin.Get(vcs.Type, vcsPlugin.ProviderConfig{Logger: s.l})
+		oauthCtx := common.OauthContext{
+			AccessToken: repositoryCreate.AccessToken,
+			// We use s.refreshTokenNoop() because the repository isn't created yet.
+			Refresher: s.refreshTokenNoop(),
+		}
+		if err := populateProviderUser(ctx, provider, oauthCtx, vcs.InstanceURL, repositoryCreate); err != nil {
+			if common.ErrorCode(err) == common.NotAuthorized {
+				return echo.NewHTTPError(http.StatusBadRequest, "Failed to verify the access token for linking the repository").SetInternal(err)
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch the user of the access token for project ID: %v", repositoryCreate.ProjectID)).SetInternal(err)
+		}
+		if err := populateDefaultBranchFilter(ctx, provider, oauthCtx, vcs.InstanceURL, repositoryCreate); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch the default branch for project ID: %v", repositoryCreate.ProjectID)).SetInternal(err)
+		}
+
 		repositoryCreate.WebhookURLHost = fmt.Sprintf("%s:%d", s.host, s.port)
+		if repositoryCreate.WebhookHostKey != "" {
+			if isLiteralWebhookHost(repositoryCreate.WebhookHostKey) {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Webhook host key %q must be a logical key rather than a literal host", repositoryCreate.WebhookHostKey))
+			}
+			if _, err := s.resolveWebhookHost(repositoryCreate.WebhookHostKey); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+			}
+			repositoryCreate.WebhookURLHost = repositoryCreate.WebhookHostKey
+		}
 		repositoryCreate.WebhookEndpointID = uuid.New().String()
-		repositoryCreate.WebhookSecretToken = common.RandomString(gitlab.SecretTokenLength)
+		repositoryCreate.WebhookSecretToken, err = common.RandomSecret(api.WebhookSecretTokenLength)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to generate webhook secret token").SetInternal(err)
+		}
 
 		// Create webhook and retrieve the created webhook id
-		var webhookCreatePayload []byte
-		switch vcs.Type {
-		case "GITLAB_SELF_HOST":
-			webhookPost := gitlab.WebhookPost{
-				URL:                    fmt.Sprintf("%s:%d/%s/%s", s.host, s.port, gitLabWebhookPath, repositoryCreate.WebhookEndpointID),
-				SecretToken:            repositoryCreate.WebhookSecretToken,
-				PushEvents:             true,
-				PushEventsBranchFilter: repositoryCreate.BranchFilter,
-				EnableSSLVerification:  false,
-			}
-			webhookCreatePayload, err = json.Marshal(webhookPost)
-			if err != nil {
-				return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal post request for creating webhook for project ID: %v", repositoryCreate.ProjectID)).SetInternal(err)
-			}
+		webhookCreatePayload, err := s.composeWebhookCreatePayload(vcs.Type, repositoryCreate.WebhookURLHost, repositoryCreate.WebhookEndpointID, repositoryCreate.WebhookSecretToken, repositoryCreate.BranchFilter)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal post request for creating webhook for project ID: %v", repositoryCreate.ProjectID)).SetInternal(err)
 		}
 
 		webhookID, err := vcsPlugin.Get(vcs.Type, vcsPlugin.ProviderConfig{Logger: s.l}).CreateWebhook(
@@ -233,9 +371,20 @@ func (s *Server) registerProjectRoutes(g *echo.Group) {
 		)
 
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to create webhook for project ID: %v", repositoryCreate.ProjectID)).SetInternal(err)
+			if !repositoryCreate.AllowPendingWebhook {
+				return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to create webhook for project ID: %v", repositoryCreate.ProjectID)).SetInternal(err)
+			}
+			// The webhook creation will be retried by the webhook retrier in the background.
+			s.l.Warn("Failed to create webhook, link the repository with the pending webhook",
+				zap.Int("project_id", repositoryCreate.ProjectID),
+				zap.String("repository", repositoryCreate.FullPath),
+				zap.Error(err),
+			)
+			repositoryCreate.WebhookStatus = api.WebhookPending
+		} else {
+			repositoryCreate.ExternalWebhookID = webhookID
+			repositoryCreate.WebhookStatus = api.WebhookActive
 		}
-		repositoryCreate.ExternalWebhookID = webhookID
 
 		// Remove enclosing /
 		repositoryCreate.BaseDirectory = strings.Trim(repositoryCreate.BaseDirectory, "/")
@@ -246,6 +395,23 @@ func (s *Server) registerProjectRoutes(g *echo.Group) {
 			}
 			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to link project repository").SetInternal(err)
 		}
+		// The ticket is used up, and it expires anyway if failing to delete.
+		if err := s.VCSOAuthService.DeleteOAuthTicket(ctx, oauthTicket.Ticket); err != nil {
+			s.l.Warn("Failed to delete the redeemed OAuth ticket", zap.Int("repository_id", repository.ID), zap.Error(err))
+		}
+		s.refreshWebhookRoutes(ctx)
+		s.requestRepositoryStatusMetricsRefresh()
+
+		if repositoryCreate.PreserveMigrationHistory {
+			// The repository is linked anyway, so the failure is left to the replay push to retry.
+			if _, err := s.RelinkMigrationHistory(ctx, repository.ID); err != nil {
+				s.l.Warn("Failed to re-associate the re-linked repository with the migration history",
+					zap.Int("project_id", repositoryCreate.ProjectID),
+					zap.String("repository", repositoryCreate.FullPath),
+					zap.Error(err),
+				)
+			}
+		}
 
 		if err := s.composeRepositoryRelationship(ctx, repository); err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create project").SetInternal(err)
@@ -294,7 +460,305 @@ func (s *Server) registerProjectRoutes(g *echo.Group) {
 		return nil
 	})
 
-	// When we unlink the repository with the project, we will also change the project workflow type to UI
+	// Replays a commit pushed to the linked repository, e.g. to re-trigger a migration missed by a bug without re-pushing.
+	g.POST("/project/:projectID/repository/replay", func(c echo.Context) error {
+		ctx := context.Background()
+		projectID, err := strconv.Atoi(c.Param("projectID"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Project ID is not a number: %s", c.Param("projectID"))).SetInternal(err)
+		}
+		pushReplay := &api.PushReplay{}
+		if err := jsonapi.UnmarshalPayload(c.Request().Body, pushReplay); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Malformatted replay push request").SetInternal(err)
+		}
+		if pushReplay.CommitID == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Malformatted replay push request, missing commit ID")
+		}
+
+		repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ProjectID: &projectID})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch repository for project ID: %d", projectID)).SetInternal(err)
+		}
+		if repository == nil {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Repository not found for project ID: %d", projectID))
+		}
+
+		result, err := s.ReplayPush(ctx, repository.ID, pushReplay.CommitID, pushReplay.Branch)
+		if err != nil {
+			switch common.ErrorCode(err) {
+			case common.NotFound:
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			case common.Invalid:
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to replay commit %s for project ID: %d", pushReplay.CommitID, projectID)).SetInternal(err)
+		}
+
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+		if err := jsonapi.MarshalPayload(c.Response().Writer, result); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal replay push response: %v", projectID)).SetInternal(err)
+		}
+		return nil
+	})
+
+	// Simulates a push of the changed files to the linked repository, for debugging the repository config.
+	g.POST("/project/:projectID/repository/simulate-push", func(c echo.Context) error {
+		ctx := context.Background()
+		projectID, err := strconv.Atoi(c.Param("projectID"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Project ID is not a number: %s", c.Param("projectID"))).SetInternal(err)
+		}
+		pushSimulation := &api.PushSimulation{}
+		if err := jsonapi.UnmarshalPayload(c.Request().Body, pushSimulation); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Malformatted simulate push request").SetInternal(err)
+		}
+		if pushSimulation.Branch == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Malformatted simulate push request, missing branch")
+		}
+
+		repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ProjectID: &projectID})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch repository for project ID: %d", projectID)).SetInternal(err)
+		}
+		if repository == nil {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Repository not found for project ID: %d", projectID))
+		}
+
+		result, err := s.SimulatePush(ctx, repository.ID, pushSimulation.Branch, pushSimulation.ChangedFileList)
+		if err != nil {
+			if common.ErrorCode(err) == common.NotFound {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to simulate push for project ID: %d", projectID)).SetInternal(err)
+		}
+
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+		if err := jsonapi.MarshalPayload(c.Response().Writer, result); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal simulate push response: %v", projectID)).SetInternal(err)
+		}
+		return nil
+	})
+
+	// Previews the databases the migration file pushed to the linked repository would be applied to, in the rollout order.
+	g.POST("/project/:projectID/repository/affected-database", func(c echo.Context) error {
+		ctx := context.Background()
+		projectID, err := strconv.Atoi(c.Param("projectID"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Project ID is not a number: %s", c.Param("projectID"))).SetInternal(err)
+		}
+		pushPreview := &api.PushPreview{}
+		if err := jsonapi.UnmarshalPayload(c.Request().Body, pushPreview); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Malformatted preview affected databases request").SetInternal(err)
+		}
+		if pushPreview.Ref == "" || pushPreview.FilePath == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Malformatted preview affected databases request, missing ref or file path")
+		}
+
+		repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ProjectID: &projectID})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch repository for project ID: %d", projectID)).SetInternal(err)
+		}
+		if repository == nil {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Repository not found for project ID: %d", projectID))
+		}
+
+		pushEvent := &vcsPlugin.PushEvent{
+			VCSType:            vcsPlugin.GitLabSelfHost,
+			BaseDirectory:      repository.BaseDirectory,
+			Ref:                pushPreview.Ref,
+			RepositoryID:       repository.ExternalID,
+			RepositoryURL:      repository.WebURL,
+			RepositoryFullPath: repository.FullPath,
+			FileCommit: vcsPlugin.FileCommit{
+				Added: pushPreview.FilePath,
+			},
+		}
+		preview, err := s.PreviewAffectedDatabases(ctx, repository.ID, pushEvent)
+		if err != nil {
+			switch common.ErrorCode(err) {
+			case common.NotFound:
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			case common.Invalid:
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to preview affected databases of file %q for project ID: %d", pushPreview.FilePath, projectID)).SetInternal(err)
+		}
+
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+		if err := jsonapi.MarshalPayload(c.Response().Writer, preview); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal preview affected databases response: %v", projectID)).SetInternal(err)
+		}
+		return nil
+	})
+
+	// Rotates the webhook secret token of the linked repository, e.g. after the token is leaked.
+	g.POST("/project/:projectID/repository/rotate-secret", func(c echo.Context) error {
+		ctx := context.Background()
+		projectID, err := strconv.Atoi(c.Param("projectID"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Project ID is not a number: %s", c.Param("projectID"))).SetInternal(err)
+		}
+
+		repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ProjectID: &projectID})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch repository for project ID: %d", projectID)).SetInternal(err)
+		}
+		if repository == nil {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Repository not found for project ID: %d", projectID))
+		}
+
+		repository, err = s.RotateWebhookSecret(ctx, repository.ID, c.Get(getPrincipalIDContextKey()).(int))
+		if err != nil {
+			if common.ErrorCode(err) == common.NotFound {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to rotate webhook secret for project ID: %d", projectID)).SetInternal(err)
+		}
+		if err := s.composeRepositoryRelationship(ctx, repository); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch repository relationship: %v", repository.Name)).SetInternal(err)
+		}
+
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+		if err := jsonapi.MarshalPayload(c.Response().Writer, repository); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal rotate webhook secret response: %v", projectID)).SetInternal(err)
+		}
+		return nil
+	})
+
+	// Checks the webhook secret token of the linked repository is used by its webhook at the VCS.
+	g.GET("/project/:projectID/repository/webhook-secret", func(c echo.Context) error {
+		ctx := context.Background()
+		projectID, err := strconv.Atoi(c.Param("projectID"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Project ID is not a number: %s", c.Param("projectID"))).SetInternal(err)
+		}
+
+		repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ProjectID: &projectID})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch repository for project ID: %d", projectID)).SetInternal(err)
+		}
+		if repository == nil {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Repository not found for project ID: %d", projectID))
+		}
+
+		report, err := s.ReconcileWebhookSecret(ctx, repository.ID, c.Get(getPrincipalIDContextKey()).(int), false)
+		if err != nil {
+			if common.ErrorCode(err) == common.NotFound {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to check webhook secret for project ID: %d", projectID)).SetInternal(err)
+		}
+
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+		if err := jsonapi.MarshalPayload(c.Response().Writer, report); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal webhook secret report response: %v", projectID)).SetInternal(err)
+		}
+		return nil
+	})
+
+	// Remediates the orphaned webhook secret token of the linked repository by rotating it and recreating the webhook.
+	g.POST("/project/:projectID/repository/webhook-secret", func(c echo.Context) error {
+		ctx := context.Background()
+		projectID, err := strconv.Atoi(c.Param("projectID"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Project ID is not a number: %s", c.Param("projectID"))).SetInternal(err)
+		}
+
+		repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ProjectID: &projectID})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch repository for project ID: %d", projectID)).SetInternal(err)
+		}
+		if repository == nil {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Repository not found for project ID: %d", projectID))
+		}
+
+		report, err := s.ReconcileWebhookSecret(ctx, repository.ID, c.Get(getPrincipalIDContextKey()).(int), true)
+		if err != nil {
+			if common.ErrorCode(err) == common.NotFound {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to reconcile webhook secret for project ID: %d", projectID)).SetInternal(err)
+		}
+
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+		if err := jsonapi.MarshalPayload(c.Response().Writer, report); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal webhook secret report response: %v", projectID)).SetInternal(err)
+		}
+		return nil
+	})
+
+	// Validates the linked repository config against the databases of the project, as the preflight before enabling the sync.
+	g.GET("/project/:projectID/repository/validation", func(c echo.Context) error {
+		ctx := context.Background()
+		projectID, err := strconv.Atoi(c.Param("projectID"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Project ID is not a number: %s", c.Param("projectID"))).SetInternal(err)
+		}
+
+		repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ProjectID: &projectID})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch repository for project ID: %d", projectID)).SetInternal(err)
+		}
+		if repository == nil {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Repository not found for project ID: %d", projectID))
+		}
+		databaseList, err := s.composeDatabaseListByFind(ctx, &api.DatabaseFind{ProjectID: &projectID})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch databases for project ID: %d", projectID)).SetInternal(err)
+		}
+
+		report, err := s.ValidateAgainstDatabases(ctx, repository.ID, databaseList)
+		if err != nil {
+			if common.ErrorCode(err) == common.NotFound {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to validate repository for project ID: %d", projectID)).SetInternal(err)
+		}
+
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+		if err := jsonapi.MarshalPayload(c.Response().Writer, report); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal repository validation response: %v", projectID)).SetInternal(err)
+		}
+		return nil
+	})
+
+	// Returns the most recent syncs of the pushes to the linked repository, the latest first.
+	g.GET("/project/:projectID/repository/sync-history", func(c echo.Context) error {
+		ctx := context.Background()
+		projectID, err := strconv.Atoi(c.Param("projectID"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Project ID is not a number: %s", c.Param("projectID"))).SetInternal(err)
+		}
+		limit := defaultSyncHistoryLimit
+		if limitStr := c.QueryParam("limit"); limitStr != "" {
+			limit, err = strconv.Atoi(limitStr)
+			if err != nil || limit <= 0 || limit > api.RepositorySyncHistoryRetention {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Limit must be a number between 1 and %d: %s", api.RepositorySyncHistoryRetention, limitStr))
+			}
+		}
+
+		repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ProjectID: &projectID})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch repository for project ID: %d", projectID)).SetInternal(err)
+		}
+		if repository == nil {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Repository not found for project ID: %d", projectID))
+		}
+
+		list, err := s.RepositoryService.ListSyncHistory(ctx, repository.ID, limit)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch sync history for project ID: %d", projectID)).SetInternal(err)
+		}
+
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+		if err := jsonapi.MarshalPayload(c.Response().Writer, list); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal sync history response: %v", projectID)).SetInternal(err)
+		}
+		return nil
+	})
+
+	// When we unlink the repository with the project, we will also change the project workflow type to UI,
+	// or to VCS_PENDING_CLEANUP until the grace window ends if the cleanup is deferred.
 	g.PATCH("/project/:projectID/repository", func(c echo.Context) error {
 		ctx := context.Background()
 		projectID, err := strconv.Atoi(c.Param("projectID"))
@@ -304,7 +768,14 @@ func (s *Server) registerProjectRoutes(g *echo.Group) {
 		repositoryPatch := &api.RepositoryPatch{
 			UpdaterID: c.Get(getPrincipalIDContextKey()).(int),
 		}
-		if err := jsonapi.UnmarshalPayload(c.Request().Body, repositoryPatch); err != nil {
+		payload, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Failed to read patch linked repository request").SetInternal(err)
+		}
+		if err := jsonapi.UnmarshalPayload(bytes.NewReader(payload), repositoryPatch); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Malformatted patch linked repository request").SetInternal(err)
+		}
+		if repositoryPatch.IgnorePathPatterns, err = api.ParseRepositoryPatchIgnorePathPatterns(payload); err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, "Malformatted patch linked repository request").SetInternal(err)
 		}
 		project, err := s.composeProjectByID(ctx, projectID)
@@ -327,6 +798,89 @@ func (s *Server) registerProjectRoutes(g *echo.Group) {
 			}
 		}
 
+		if repositoryPatch.IgnorePathPatterns != nil {
+			if err := api.ValidateRepositoryIgnorePathPatterns(*repositoryPatch.IgnorePathPatterns); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: %s", err.Error()))
+			}
+		}
+
+		if repositoryPatch.NotificationWebhookURLList != nil && *repositoryPatch.NotificationWebhookURLList != "" {
+			if err := api.ValidateRepositoryNotificationWebhookURLList(strings.Split(*repositoryPatch.NotificationWebhookURLList, ",")); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: %s", err.Error()))
+			}
+		}
+
+		if repositoryPatch.CommitAuthorEmail != nil {
+			if err := api.ValidateRepositoryCommitAuthorEmail(*repositoryPatch.CommitAuthorEmail); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: %s", err.Error()))
+			}
+		}
+
+		if repositoryPatch.CommitStatusContext != nil {
+			if err := api.ValidateRepositoryCommitStatusContext(*repositoryPatch.CommitStatusContext); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: %s", err.Error()))
+			}
+		}
+
+		if repositoryPatch.TargetBranchFilter != nil {
+			if err := api.ValidateRepositoryTargetBranchFilter(*repositoryPatch.TargetBranchFilter); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: %s", err.Error()))
+			}
+		}
+
+		if repositoryPatch.SkipDirective != nil {
+			if err := api.ValidateRepositorySkipDirective(*repositoryPatch.SkipDirective); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: %s", err.Error()))
+			}
+		}
+
+		if repositoryPatch.SchemaRef != nil {
+			if err := api.ValidateRepositorySchemaRef(*repositoryPatch.SchemaRef); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: %s", err.Error()))
+			}
+		}
+
+		// The repository is only quarantined by the consecutive sync failures, and un-quarantined manually.
+		if repositoryPatch.SyncStatus != nil && *repositoryPatch.SyncStatus != api.SyncActive {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: sync status can only be patched to %s, got %q", api.SyncActive, *repositoryPatch.SyncStatus))
+		}
+
+		if repositoryPatch.DeploymentConfigID != nil && *repositoryPatch.DeploymentConfigID != 0 {
+			if err := s.validateRepositoryDeploymentConfig(ctx, project, *repositoryPatch.DeploymentConfigID); err != nil {
+				if common.ErrorCode(err) == common.Invalid {
+					return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: %s", err.Error()))
+				}
+				return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to validate deployment config for project ID: %v", projectID)).SetInternal(err)
+			}
+		}
+
+		if repositoryPatch.DefaultAssigneeID != nil && *repositoryPatch.DefaultAssigneeID != 0 {
+			if err := s.validateRepositoryDefaultAssignee(ctx, *repositoryPatch.DefaultAssigneeID); err != nil {
+				if common.ErrorCode(err) == common.Invalid {
+					return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: %s", err.Error()))
+				}
+				return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to validate default assignee ID: %v", *repositoryPatch.DefaultAssigneeID)).SetInternal(err)
+			}
+		}
+
+		if repositoryPatch.Labels != nil {
+			if err := api.ValidateRepositoryLabels(*repositoryPatch.Labels); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: %s", err.Error()))
+			}
+		}
+
+		var branchEnvironmentMapping api.BranchEnvironmentMapping
+		if repositoryPatch.BranchEnvironmentMapping != nil {
+			branchEnvironmentMapping, err = api.ValidateRepositoryBranchEnvironmentMapping(*repositoryPatch.BranchEnvironmentMapping)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: %s", err.Error()))
+			}
+			// The databases needing schema update are determined by the deployment config for tenant mode project.
+			if len(branchEnvironmentMapping) > 0 && project.TenantMode == api.TenantModeTenant {
+				return echo.NewHTTPError(http.StatusBadRequest, "Malformatted patch linked repository request: branch environment mapping isn't supported for tenant mode project")
+			}
+		}
+
 		// Remove enclosing /
 		if repositoryPatch.BaseDirectory != nil {
 			baseDir := strings.Trim(*repositoryPatch.BaseDirectory, "/")
@@ -334,7 +888,8 @@ func (s *Server) registerProjectRoutes(g *echo.Group) {
 		}
 
 		repositoryFind := &api.RepositoryFind{
-			ProjectID: &projectID,
+			ProjectID:      &projectID,
+			IncludeSecrets: true,
 		}
 		list, err := s.RepositoryService.FindRepositoryList(ctx, repositoryFind)
 		if err != nil {
@@ -349,11 +904,74 @@ func (s *Server) registerProjectRoutes(g *echo.Group) {
 		}
 
 		repository := list[0]
+
+		// The webhook only receives the pushes matching the branch filter, so every mapped branch must match it.
+		if repositoryPatch.BranchEnvironmentMapping != nil || repositoryPatch.BranchFilter != nil {
+			branchFilter := repository.BranchFilter
+			if repositoryPatch.BranchFilter != nil {
+				branchFilter = *repositoryPatch.BranchFilter
+			}
+			if repositoryPatch.BranchEnvironmentMapping == nil {
+				branchEnvironmentMapping = repository.BranchEnvironmentMapping
+			}
+			for branch := range branchEnvironmentMapping {
+				if !isBranchMatched(branchFilter, branch, s.l) {
+					return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: mapped branch %q doesn't match the branch filter %q", branch, branchFilter))
+				}
+			}
+		}
+
+		if repositoryPatch.SchemaSourceType != nil || repositoryPatch.SchemaPathTemplate != nil || repositoryPatch.SchemaSnapshotOnApply != nil {
+			schemaSourceType := repository.SchemaSourceType
+			if repositoryPatch.SchemaSourceType != nil {
+				schemaSourceType = *repositoryPatch.SchemaSourceType
+			}
+			schemaPathTemplate := repository.SchemaPathTemplate
+			if repositoryPatch.SchemaPathTemplate != nil {
+				schemaPathTemplate = *repositoryPatch.SchemaPathTemplate
+			}
+			schemaSnapshotOnApply := repository.SchemaSnapshotOnApply
+			if repositoryPatch.SchemaSnapshotOnApply != nil {
+				schemaSnapshotOnApply = *repositoryPatch.SchemaSnapshotOnApply
+			}
+			if err := api.ValidateRepositorySchemaSourceType(schemaSourceType, schemaPathTemplate); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: %s", err.Error()))
+			}
+			if err := api.ValidateRepositorySchemaSnapshotOnApply(schemaSnapshotOnApply, schemaSourceType, schemaPathTemplate); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: %s", err.Error()))
+			}
+		}
+		if v := repositoryPatch.DuplicateVersionPolicy; v != nil {
+			if err := api.ValidateRepositoryDuplicateVersionPolicy(*v); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: %s", err.Error()))
+			}
+		}
+		if v := repositoryPatch.EmptyMigrationPolicy; v != nil {
+			if err := api.ValidateRepositoryEmptyMigrationPolicy(*v); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: %s", err.Error()))
+			}
+		}
+		if v := repositoryPatch.MigrationStatementTimeout; v != nil {
+			if err := api.ValidateRepositoryMigrationStatementTimeout(*v); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: %s", err.Error()))
+			}
+		}
+		if v := repositoryPatch.DriftAction; v != nil {
+			if err := api.ValidateRepositoryDriftAction(*v); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Malformatted patch linked repository request: %s", err.Error()))
+			}
+			if *v == api.DriftActionCreateIssue && !s.feature(api.FeatureSchemaDrift) {
+				return echo.NewHTTPError(http.StatusForbidden, api.FeatureSchemaDrift.AccessErrorMessage())
+			}
+		}
+
 		repositoryPatch.ID = repository.ID
 		updatedRepository, err := s.RepositoryService.PatchRepository(ctx, repositoryPatch)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to update repository for project ID: %d", projectID)).SetInternal(err)
 		}
+		s.refreshWebhookRoutes(ctx)
+		s.requestRepositoryStatusMetricsRefresh()
 
 		if repositoryPatch.BranchFilter != nil {
 			vcsFind := &api.VCSFind{
@@ -373,8 +991,14 @@ func (s *Server) registerProjectRoutes(g *echo.Group) {
 			var webhookPatchPayload []byte
 			switch vcs.Type {
 			case "GITLAB_SELF_HOST":
+				callbackURL, err := s.webhookCallbackURL(updatedRepository.WebhookURLHost, updatedRepository.WebhookEndpointID)
+				if err != nil {
+					return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to resolve the webhook callback URL for project ID: %v", projectID)).SetInternal(err)
+				}
 				webhookPut := gitlab.WebhookPut{
-					URL:                    fmt.Sprintf("%s:%d/%s/%s", s.host, s.port, gitLabWebhookPath, updatedRepository.WebhookEndpointID),
+					URL:                    callbackURL,
+					PushEvents:             !isTagBranchFilter(*repositoryPatch.BranchFilter),
+					TagPushEvents:          isTagBranchFilter(*repositoryPatch.BranchFilter),
 					PushEventsBranchFilter: *repositoryPatch.BranchFilter,
 				}
 				webhookPatchPayload, err = json.Marshal(webhookPut)
@@ -391,7 +1015,7 @@ func (s *Server) registerProjectRoutes(g *echo.Group) {
 					ClientSecret: vcs.Secret,
 					AccessToken:  repository.AccessToken,
 					RefreshToken: repository.RefreshToken,
-					Refresher:    s.refreshToken(ctx, repository.ID),
+					Refresher:    s.refreshToken(ctx, repository),
 				},
 				vcs.InstanceURL,
 				repository.ExternalID,
@@ -415,7 +1039,8 @@ func (s *Server) registerProjectRoutes(g *echo.Group) {
 		return nil
 	})
 
-	// When we unlink the repository with the project, we will also change the project workflow type to UI
+	// When we unlink the repository with the project, we will also change the project workflow type to UI,
+	// or to VCS_PENDING_CLEANUP until the grace window ends if the cleanup is deferred.
 	g.DELETE("/project/:projectID/repository", func(c echo.Context) error {
 		ctx := context.Background()
 		projectID, err := strconv.Atoi(c.Param("projectID"))
@@ -424,7 +1049,8 @@ func (s *Server) registerProjectRoutes(g *echo.Group) {
 		}
 
 		repositoryFind := &api.RepositoryFind{
-			ProjectID: &projectID,
+			ProjectID:      &projectID,
+			IncludeSecrets: true,
 		}
 		list, err := s.RepositoryService.FindRepositoryList(ctx, repositoryFind)
 		if err != nil {
@@ -455,9 +1081,21 @@ func (s *Server) registerProjectRoutes(g *echo.Group) {
 			ProjectID: projectID,
 			DeleterID: c.Get(getPrincipalIDContextKey()).(int),
 		}
+		// The deferred cleanup keeps the repository settings for the grace window, during which re-linking the same repository restores them.
+		if deferCleanupStr := c.QueryParam("deferCleanup"); deferCleanupStr != "" {
+			deferCleanup, err := strconv.ParseBool(deferCleanupStr)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Query parameter deferCleanup is not a boolean: %s", deferCleanupStr)).SetInternal(err)
+			}
+			if deferCleanup {
+				repositoryDelete.CleanupTs = s.getRepositoryCleanupTs(time.Now())
+			}
+		}
 		if err := s.RepositoryService.DeleteRepository(ctx, repositoryDelete); err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to delete repository for project ID: %d", projectID)).SetInternal(err)
 		}
+		s.refreshWebhookRoutes(ctx)
+		s.requestRepositoryStatusMetricsRefresh()
 
 		// Delete the webhook after we successfully delete the repository.
 		// This is because in case the webhook deletion fails, we can still have a cleanup process to cleanup the orphaned webhook.
@@ -470,7 +1108,7 @@ func (s *Server) registerProjectRoutes(g *echo.Group) {
 				ClientSecret: vcs.Secret,
 				AccessToken:  repository.AccessToken,
 				RefreshToken: repository.RefreshToken,
-				Refresher:    s.refreshToken(ctx, repository.ID),
+				Refresher:    s.refreshToken(ctx, repository),
 			},
 			vcs.InstanceURL,
 			repository.ExternalID,
@@ -559,6 +1197,46 @@ func (s *Server) registerProjectRoutes(g *echo.Group) {
 		}
 		return nil
 	})
+
+	g.GET("/project/:projectID/tenant-database", func(c echo.Context) error {
+		ctx := context.Background()
+		projectID, err := strconv.Atoi(c.Param("projectID"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Project ID is not a number: %s", c.Param("projectID"))).SetInternal(err)
+		}
+
+		var labelSelector map[string]string
+		if selector := c.QueryParam("labelSelector"); selector != "" {
+			labelSelector, err = api.ParseRepositoryLabelSelector(selector)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid label selector %q: %s", selector, err.Error()))
+			}
+		}
+		databaseList, err := s.DiscoverTenantDatabases(ctx, projectID, labelSelector)
+		if err != nil {
+			switch common.ErrorCode(err) {
+			case common.NotAuthorized:
+				return echo.NewHTTPError(http.StatusForbidden, api.FeatureMultiTenancy.AccessErrorMessage())
+			case common.NotFound:
+				return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Project ID not found: %d", projectID))
+			case common.Invalid:
+				return echo.NewHTTPError(http.StatusBadRequest, common.ErrorMessage(err))
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to discover tenant databases for project ID: %d", projectID)).SetInternal(err)
+		}
+
+		for _, database := range databaseList {
+			if err := s.composeDatabaseRelationship(ctx, database); err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to compose database relationship for database ID %v", database.ID)).SetInternal(err)
+			}
+		}
+
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+		if err := jsonapi.MarshalPayload(c.Response().Writer, databaseList); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal tenant database list response for project ID: %d", projectID)).SetInternal(err)
+		}
+		return nil
+	})
 }
 
 func (s *Server) composeProjectByID(ctx context.Context, id int) (*api.Project, error) {
@@ -618,16 +1296,87 @@ func (s *Server) composeDeploymentConfigRelationship(ctx context.Context, deploy
 	return nil
 }
 
+// validateRepositoryDeploymentConfig validates the deployment config referenced by the repository of the project.
+func (s *Server) validateRepositoryDeploymentConfig(ctx context.Context, project *api.Project, deploymentConfigID int) error {
+	deploymentConfig, err := s.DeploymentConfigService.FindDeploymentConfig(ctx, &api.DeploymentConfigFind{
+		ID: &deploymentConfigID,
+	})
+	if err != nil {
+		return err
+	}
+	return checkRepositoryDeploymentConfig(project, deploymentConfigID, deploymentConfig)
+}
+
+// checkRepositoryDeploymentConfig returns an invalid error unless the deployment config found by deploymentConfigID is a valid
+// deployment config of the tenant mode project, since only the pipeline of a tenant mode project is staged by the deployment config.
+func checkRepositoryDeploymentConfig(project *api.Project, deploymentConfigID int, deploymentConfig *api.DeploymentConfig) error {
+	if project.TenantMode != api.TenantModeTenant {
+		return &common.Error{Code: common.Invalid, Err: fmt.Errorf("deployment config is only supported for tenant mode project")}
+	}
+	if deploymentConfig == nil || deploymentConfig.ProjectID != project.ID {
+		return &common.Error{Code: common.Invalid, Err: fmt.Errorf("deployment config ID %d not found in project ID %d", deploymentConfigID, project.ID)}
+	}
+	if _, err := api.ValidateAndGetDeploymentSchedule(deploymentConfig.Payload); err != nil {
+		return &common.Error{Code: common.Invalid, Err: fmt.Errorf("invalid deployment schedule of deployment config ID %d: %v", deploymentConfigID, err)}
+	}
+	return nil
+}
+
+// validateRepositoryDefaultAssignee returns an invalid error unless the principal found by principalID is a workspace
+// DBA or owner, who are able to approve the issues assigned.
+func (s *Server) validateRepositoryDefaultAssignee(ctx context.Context, principalID int) error {
+	principal, err := s.PrincipalService.FindPrincipal(ctx, &api.PrincipalFind{ID: &principalID})
+	if err != nil {
+		return err
+	}
+	if principal == nil {
+		return &common.Error{Code: common.Invalid, Err: fmt.Errorf("default assignee ID %d not found", principalID)}
+	}
+	if err := s.composePrincipalRole(ctx, principal); err != nil {
+		return err
+	}
+	if principal.Role != api.Owner && principal.Role != api.DBA {
+		return &common.Error{Code: common.Invalid, Err: fmt.Errorf("default assignee ID %d must be a DBA or owner, got %s", principalID, principal.Role)}
+	}
+	return nil
+}
+
+// populateDefaultBranchFilter sets the branch filter to the default branch of the repository if it's empty,
+// since the default branch varies among the repositories, e.g. "main", "master" or "trunk".
+func populateDefaultBranchFilter(ctx context.Context, provider vcsPlugin.Provider, oauthCtx common.OauthContext, instanceURL string, repositoryCreate *api.RepositoryCreate) error {
+	if repositoryCreate.BranchFilter != "" {
+		return nil
+	}
+	branch, err := provider.DefaultBranch(ctx, oauthCtx, instanceURL, repositoryCreate.ExternalID)
+	if err != nil {
+		return err
+	}
+	repositoryCreate.BranchFilter = branch
+	return nil
+}
+
+// populateProviderUser verifies the access token linking the repository by fetching the VCS provider user it belongs to,
+// and records the user on the repository for attributing the automated actions on the repository to the person.
+func populateProviderUser(ctx context.Context, provider vcsPlugin.Provider, oauthCtx common.OauthContext, instanceURL string, repositoryCreate *api.RepositoryCreate) error {
+	user, err := provider.CurrentUser(ctx, oauthCtx, instanceURL)
+	if err != nil {
+		return err
+	}
+	repositoryCreate.ProviderUserID = user.ID
+	repositoryCreate.ProviderUsername = user.Username
+	return nil
+}
+
 // refreshToken is a token refresher that stores the latest access token configuration to repository.
-func (s *Server) refreshToken(ctx context.Context, repositoryID int) common.TokenRefresher {
+// It returns nil if the access token never expires, so the VCS provider won't try to refresh it.
+func (s *Server) refreshToken(ctx context.Context, repository *api.Repository) common.TokenRefresher {
+	if repository.TokenNeverExpires() {
+		return nil
+	}
 	return func(token, refreshToken string, expiresTs int64) error {
-		if _, err := s.RepositoryService.PatchRepository(ctx, &api.RepositoryPatch{
-			ID:           repositoryID,
-			UpdaterID:    api.SystemBotID,
-			AccessToken:  &token,
-			ExpiresTs:    &expiresTs,
-			RefreshToken: &refreshToken,
-		}); err != nil {
+		// If another refresh, e.g. the token refresher, stored its token first, the caller still proceeds with
+		// the token just refreshed, and the stored token is left as is.
+		if _, err := s.swapRepositoryToken(ctx, repository, token, refreshToken, expiresTs); err != nil {
 			return err
 		}
 		return nil
@@ -38,7 +38,7 @@ func (s *Server) registerProjectMemberRoutes(g *echo.Group) {
 		}
 
 		// fetch project member from VCS
-		repoFind := &api.RepositoryFind{ProjectID: &projectID}
+		repoFind := &api.RepositoryFind{ProjectID: &projectID, IncludeSecrets: true}
 		repo, err := s.RepositoryService.FindRepository(ctx, repoFind)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch relevant VCS repo, Project ID: %s", c.Param("projectID"))).SetInternal(err)
@@ -59,7 +59,7 @@ func (s *Server) registerProjectMemberRoutes(g *echo.Group) {
 				ClientSecret: vcs.Secret,
 				AccessToken:  repo.AccessToken,
 				RefreshToken: repo.RefreshToken,
-				Refresher:    s.refreshToken(ctx, repo.ID),
+				Refresher:    s.refreshToken(ctx, repo),
 			},
 			vcs.InstanceURL,
 			repo.ExternalID,
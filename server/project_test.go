@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+)
+
+// fakeDefaultBranchProvider is a fake VCS provider only serving the default branch.
+type fakeDefaultBranchProvider struct {
+	vcs.Provider
+	defaultBranch string
+	called        bool
+}
+
+func (p *fakeDefaultBranchProvider) DefaultBranch(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string) (string, error) {
+	p.called = true
+	return p.defaultBranch, nil
+}
+
+func TestPopulateDefaultBranchFilter(t *testing.T) {
+	tests := []struct {
+		name         string
+		branchFilter string
+		want         string
+		wantCalled   bool
+	}{
+		{
+			name:         "empty branch filter",
+			branchFilter: "",
+			want:         "main",
+			wantCalled:   true,
+		},
+		{
+			name:         "specified branch filter",
+			branchFilter: "release/*",
+			want:         "release/*",
+			wantCalled:   false,
+		},
+	}
+
+	for _, test := range tests {
+		provider := &fakeDefaultBranchProvider{defaultBranch: "main"}
+		repositoryCreate := &api.RepositoryCreate{
+			ExternalID:   "1",
+			BranchFilter: test.branchFilter,
+		}
+		if err := populateDefaultBranchFilter(context.Background(), provider, common.OauthContext{}, "https://gitlab.example.com", repositoryCreate); err != nil {
+			t.Fatalf("%q: populateDefaultBranchFilter() got error %v, want OK.", test.name, err)
+		}
+		if repositoryCreate.BranchFilter != test.want {
+			t.Errorf("%q: populateDefaultBranchFilter() got branch filter %q, want %q.", test.name, repositoryCreate.BranchFilter, test.want)
+		}
+		if provider.called != test.wantCalled {
+			t.Errorf("%q: populateDefaultBranchFilter() got provider called %v, want %v.", test.name, provider.called, test.wantCalled)
+		}
+	}
+}
+
+func TestCheckRepositoryDeploymentConfig(t *testing.T) {
+	const payload = `{"deployments":[{"name":"Staging","spec":{"selector":{"matchExpressions":[{"key":"bb.environment","operator":"In","values":["Staging"]}]}}}]}`
+	tenantProject := &api.Project{ID: 101, TenantMode: api.TenantModeTenant}
+
+	tests := []struct {
+		name             string
+		project          *api.Project
+		deploymentConfig *api.DeploymentConfig
+		wantErr          bool
+	}{
+		{
+			name:             "deployment config of the tenant mode project",
+			project:          tenantProject,
+			deploymentConfig: &api.DeploymentConfig{ID: 201, ProjectID: 101, Payload: payload},
+		},
+		{
+			name:             "non-tenant mode project",
+			project:          &api.Project{ID: 101, TenantMode: api.TenantModeDisabled},
+			deploymentConfig: &api.DeploymentConfig{ID: 201, ProjectID: 101, Payload: payload},
+			wantErr:          true,
+		},
+		{
+			name:    "deployment config not found",
+			project: tenantProject,
+			wantErr: true,
+		},
+		{
+			name:             "deployment config of another project",
+			project:          tenantProject,
+			deploymentConfig: &api.DeploymentConfig{ID: 201, ProjectID: 102, Payload: payload},
+			wantErr:          true,
+		},
+		{
+			name:             "invalid deployment schedule",
+			project:          tenantProject,
+			deploymentConfig: &api.DeploymentConfig{ID: 201, ProjectID: 101, Payload: `{"deployments":[{"name":""}]}`},
+			wantErr:          true,
+		},
+	}
+
+	for _, test := range tests {
+		err := checkRepositoryDeploymentConfig(test.project, 201, test.deploymentConfig)
+		if test.wantErr {
+			if common.ErrorCode(err) != common.Invalid {
+				t.Errorf("%q: checkRepositoryDeploymentConfig() got error %v, want invalid.", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: checkRepositoryDeploymentConfig() got error %v, want OK.", test.name, err)
+		}
+	}
+}
+
+// fakeCurrentUserProvider is a fake VCS provider only serving the user of the access token.
+type fakeCurrentUserProvider struct {
+	vcs.Provider
+	userMap map[string]*vcs.ProviderUser
+}
+
+func (p *fakeCurrentUserProvider) CurrentUser(ctx context.Context, oauthCtx common.OauthContext, instanceURL string) (*vcs.ProviderUser, error) {
+	user, ok := p.userMap[oauthCtx.AccessToken]
+	if !ok {
+		return nil, common.Errorf(common.NotAuthorized, errors.New("401 Unauthorized"))
+	}
+	return user, nil
+}
+
+func TestPopulateProviderUser(t *testing.T) {
+	provider := &fakeCurrentUserProvider{userMap: map[string]*vcs.ProviderUser{
+		"access": {ID: "42", Username: "jdoe", Name: "Jane Doe"},
+	}}
+
+	repositoryCreate := &api.RepositoryCreate{ExternalID: "1", AccessToken: "access"}
+	if err := populateProviderUser(context.Background(), provider, common.OauthContext{AccessToken: "access"}, "https://gitlab.example.com", repositoryCreate); err != nil {
+		t.Fatalf("populateProviderUser() got error %v, want OK.", err)
+	}
+	if repositoryCreate.ProviderUserID != "42" || repositoryCreate.ProviderUsername != "jdoe" {
+		t.Errorf("populateProviderUser() got provider user %q %q, want %q %q.", repositoryCreate.ProviderUserID, repositoryCreate.ProviderUsername, "42", "jdoe")
+	}
+
+	repositoryCreate = &api.RepositoryCreate{ExternalID: "1", AccessToken: "revoked"}
+	if err := populateProviderUser(context.Background(), provider, common.OauthContext{AccessToken: "revoked"}, "https://gitlab.example.com", repositoryCreate); common.ErrorCode(err) != common.NotAuthorized {
+		t.Errorf("populateProviderUser() with the revoked token got error %v, want not authorized.", err)
+	}
+	if repositoryCreate.ProviderUserID != "" {
+		t.Errorf("populateProviderUser() with the revoked token got provider user ID %q, want empty.", repositoryCreate.ProviderUserID)
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/db"
+	"github.com/bytebase/bytebase/plugin/vcs"
+)
+
+// pushedMigration is the migration of the pushed file prepared to be applied by the issue of the push event.
+type pushedMigration struct {
+	mi           *db.MigrationInfo
+	vcsPushEvent vcs.PushEvent
+	// createContext is the api.UpdateSchemaContext applying the file alone.
+	createContext string
+}
+
+// composePushIssueCreate composes the issue applying the migrations pushed together, in the order of migrationList.
+// A single migration is applied by the issue the same as before batching. Otherwise, the update schema details of
+// the migrations are concatenated into a single pipeline, each carrying its own migration type and push event, so the
+// reviewers see the push as one change and the migrations are applied in order.
+// The caller fills in the project and the assignee.
+func composePushIssueCreate(migrationList []*pushedMigration) (*api.IssueCreate, error) {
+	if len(migrationList) == 0 {
+		return nil, fmt.Errorf("no migration to create the issue")
+	}
+	dataOnly := true
+	for _, migration := range migrationList {
+		if migration.mi.Type != db.Data {
+			dataOnly = false
+		}
+	}
+	issueType := api.IssueDatabaseSchemaUpdate
+	if dataOnly {
+		issueType = api.IssueDatabaseDataUpdate
+	}
+
+	if len(migrationList) == 1 {
+		name, description := composeIssueFromCommit(migrationList[0].vcsPushEvent.FileCommit)
+		return &api.IssueCreate{
+			Name:          name,
+			Type:          issueType,
+			Description:   description,
+			CreateContext: migrationList[0].createContext,
+		}, nil
+	}
+
+	// The pipeline is named by the shared migration type, or the schema update for the mixed types.
+	batched := &api.UpdateSchemaContext{
+		MigrationType: migrationList[0].mi.Type,
+	}
+	var fileList []string
+	for _, migration := range migrationList {
+		m := &api.UpdateSchemaContext{}
+		if err := json.Unmarshal([]byte(migration.createContext), m); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal the issue create context of %q, error %w", migration.vcsPushEvent.FileCommit.Added, err)
+		}
+		if m.MigrationType != batched.MigrationType {
+			batched.MigrationType = db.Migrate
+		}
+		for _, detail := range m.UpdateSchemaDetailList {
+			detail.MigrationType = m.MigrationType
+			detail.VCSPushEvent = m.VCSPushEvent
+			batched.UpdateSchemaDetailList = append(batched.UpdateSchemaDetailList, detail)
+		}
+		batched.VCSPushEvent = m.VCSPushEvent
+		fileList = append(fileList, fmt.Sprintf("- %s", path.Base(migration.vcsPushEvent.FileCommit.Added)))
+	}
+	createContext, err := json.Marshal(batched)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct issue create context payload, error %w", err)
+	}
+
+	// The issue is named after the head commit of the push.
+	name, description := composeIssueFromCommit(migrationList[len(migrationList)-1].vcsPushEvent.FileCommit)
+	name = fmt.Sprintf("%s (%d migrations)", name, len(migrationList))
+	migrationDescription := fmt.Sprintf("Migrations in order:\n%s", strings.Join(fileList, "\n"))
+	if description == "" {
+		description = migrationDescription
+	} else {
+		description = migrationDescription + "\n\n" + description
+	}
+	return &api.IssueCreate{
+		Name:          name,
+		Type:          issueType,
+		Description:   description,
+		CreateContext: string(createContext),
+	}, nil
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/db"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"github.com/bytebase/bytebase/plugin/vcs/gitlab"
+)
+
+func TestComposePushIssueCreate(t *testing.T) {
+	repository := &api.Repository{
+		BaseDirectory:    "bytebase",
+		FilePathTemplate: "{{ENV_NAME}}/{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql",
+	}
+	database := &api.Database{
+		ID:       1,
+		Name:     "blog",
+		Instance: &api.Instance{ID: 1},
+	}
+	// The three files are pushed by two commits out of the version order.
+	commit1 := gitlab.WebhookCommit{ID: "1111111", Message: "Add post"}
+	commit2 := gitlab.WebhookCommit{ID: "2222222", Message: "Add comment and tag"}
+	fileList := []*pushedFile{
+		{commit: commit1, added: "bytebase/prod/blog__202204150900__migrate__add_post.sql"},
+		{commit: commit2, added: "bytebase/prod/blog__202204170900__data__add_tag.sql"},
+		{commit: commit2, added: "bytebase/prod/blog__202204160900__migrate__add_comment.sql"},
+	}
+	fileList, _ = orderPushedFileList(repository, fileList, nil)
+
+	var migrationList []*pushedMigration
+	for _, file := range fileList {
+		mi, err := db.ParseMigrationInfo(file.added, filepath.Join(repository.BaseDirectory, repository.FilePathTemplate))
+		if err != nil {
+			t.Fatalf("ParseMigrationInfo(%q) got error %v, want OK.", file.added, err)
+		}
+		vcsPushEvent := vcs.PushEvent{
+			Ref:        "refs/heads/main",
+			FileCommit: vcs.FileCommit{ID: file.commit.ID, Message: file.commit.Message, Added: file.added},
+		}
+		createContext, err := json.Marshal(&api.UpdateSchemaContext{
+			MigrationType: mi.Type,
+			VCSPushEvent:  &vcsPushEvent,
+			UpdateSchemaDetailList: []*api.UpdateSchemaDetail{
+				{
+					DatabaseID: database.ID,
+					Statement:  fmt.Sprintf("-- %s", mi.Description),
+				},
+			},
+		})
+		if err != nil {
+			t.Fatalf("json.Marshal() got error %v, want OK.", err)
+		}
+		migrationList = append(migrationList, &pushedMigration{mi: mi, vcsPushEvent: vcsPushEvent, createContext: string(createContext)})
+	}
+
+	issueCreate, err := composePushIssueCreate(migrationList)
+	if err != nil {
+		t.Fatalf("composePushIssueCreate() got error %v, want OK.", err)
+	}
+	if want := "Add comment and tag (3 migrations)"; issueCreate.Name != want {
+		t.Errorf("composePushIssueCreate() got name %q, want %q.", issueCreate.Name, want)
+	}
+	if issueCreate.Type != api.IssueDatabaseSchemaUpdate {
+		t.Errorf("composePushIssueCreate() got type %q, want %q.", issueCreate.Type, api.IssueDatabaseSchemaUpdate)
+	}
+	m := &api.UpdateSchemaContext{}
+	if err := json.Unmarshal([]byte(issueCreate.CreateContext), m); err != nil {
+		t.Fatalf("composePushIssueCreate() got malformed context %q, error %v.", issueCreate.CreateContext, err)
+	}
+	if m.MigrationType != db.Migrate {
+		t.Errorf("composePushIssueCreate() got migration type %q, want %q.", m.MigrationType, db.Migrate)
+	}
+
+	// The single pipeline applies the files in the version order, each by its own task.
+	want := []struct {
+		added         string
+		migrationType db.MigrationType
+		taskType      api.TaskType
+		statement     string
+	}{
+		{"bytebase/prod/blog__202204150900__migrate__add_post.sql", db.Migrate, api.TaskDatabaseSchemaUpdate, "-- Add post"},
+		{"bytebase/prod/blog__202204160900__migrate__add_comment.sql", db.Migrate, api.TaskDatabaseSchemaUpdate, "-- Add comment"},
+		{"bytebase/prod/blog__202204170900__data__add_tag.sql", db.Data, api.TaskDatabaseDataUpdate, "-- Add tag"},
+	}
+	if len(m.UpdateSchemaDetailList) != len(want) {
+		t.Fatalf("composePushIssueCreate() got %d update schema details, want %d.", len(m.UpdateSchemaDetailList), len(want))
+	}
+	for i, d := range m.UpdateSchemaDetailList {
+		if d.VCSPushEvent == nil || d.VCSPushEvent.FileCommit.Added != want[i].added || d.MigrationType != want[i].migrationType || d.Statement != want[i].statement {
+			t.Errorf("composePushIssueCreate() got detail %d %+v, want file %q of type %q.", i, d, want[i].added, want[i].migrationType)
+			continue
+		}
+		taskCreate, err := getUpdateTask(database, d.MigrationType, d.VCSPushEvent, d, api.TaskPending, false)
+		if err != nil {
+			t.Fatalf("getUpdateTask() got error %v, want OK.", err)
+		}
+		payload := &api.TaskDatabaseSchemaUpdatePayload{}
+		if err := json.Unmarshal([]byte(taskCreate.Payload), payload); err != nil {
+			t.Fatalf("getUpdateTask() got malformed payload %q, error %v.", taskCreate.Payload, err)
+		}
+		if taskCreate.Type != want[i].taskType || payload.VCSPushEvent == nil || payload.VCSPushEvent.FileCommit.Added != want[i].added {
+			t.Errorf("getUpdateTask() got task %d of type %q applying %+v, want type %q applying %q.", i, taskCreate.Type, payload.VCSPushEvent, want[i].taskType, want[i].added)
+		}
+	}
+}
+
+func TestComposePushIssueCreateSingle(t *testing.T) {
+	migration := &pushedMigration{
+		mi: &db.MigrationInfo{Type: db.Data},
+		vcsPushEvent: vcs.PushEvent{
+			FileCommit: vcs.FileCommit{Message: "Add tag", Added: "bytebase/prod/blog__202204170900__data__add_tag.sql"},
+		},
+		createContext: `{"migrationType":"DATA"}`,
+	}
+	issueCreate, err := composePushIssueCreate([]*pushedMigration{migration})
+	if err != nil {
+		t.Fatalf("composePushIssueCreate() got error %v, want OK.", err)
+	}
+	// The single migration is applied the same as before batching.
+	if issueCreate.Name != "Add tag" || issueCreate.Type != api.IssueDatabaseDataUpdate || issueCreate.CreateContext != migration.createContext {
+		t.Errorf("composePushIssueCreate() got %+v, want the issue of the single migration.", issueCreate)
+	}
+	if _, err := composePushIssueCreate(nil); err == nil {
+		t.Errorf("composePushIssueCreate(nil) got OK, want error.")
+	}
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/db"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"github.com/bytebase/bytebase/plugin/vcs/gitlab"
+	"go.uber.org/zap"
+)
+
+// ReplayPush processes the commit pushed to the branch of the repository again as if it's received from the webhook, so that
+// a migration missed by a bug can be re-triggered without asking the developers to re-push. The files added by the commit are
+// fetched from the VCS provider. The migration file whose version is already applied to any of the matching databases is skipped,
+// so replaying a processed commit doesn't create duplicate migrations.
+func (s *Server) ReplayPush(ctx context.Context, repositoryID int, commitID string, branch string) (*api.PushReplayResult, error) {
+	repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ID: &repositoryID, IncludeSecrets: true})
+	if err != nil {
+		return nil, err
+	}
+	if repository == nil {
+		return nil, &common.Error{Code: common.NotFound, Err: fmt.Errorf("repository ID not found: %d", repositoryID)}
+	}
+	if err := s.composeRepositoryRelationship(ctx, repository); err != nil {
+		return nil, err
+	}
+	if repository.VCS == nil {
+		return nil, fmt.Errorf("VCS not found for ID: %v", repository.VCSID)
+	}
+
+	branch, err = resolveReplayBranch(repository, branch)
+	if err != nil {
+		return nil, err
+	}
+	if !isBranchMatched(repository.BranchFilter, branch, s.l) {
+		return nil, &common.Error{Code: common.Invalid, Err: fmt.Errorf("branch %q doesn't match the branch filter %q", branch, repository.BranchFilter)}
+	}
+	branchEnvironment, ok := resolveBranchEnvironment(repository, branch)
+	if !ok {
+		return nil, &common.Error{Code: common.Invalid, Err: fmt.Errorf("branch %q isn't mapped to any environment", branch)}
+	}
+	externalID, err := strconv.Atoi(repository.ExternalID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid external ID %q of repository %d: %w", repository.ExternalID, repository.ID, err)
+	}
+
+	provider := vcs.Get(repository.VCS.Type, s.vcsProviderConfig())
+	oauthCtx := common.OauthContext{
+		ClientID:     repository.VCS.ApplicationID,
+		ClientSecret: repository.VCS.Secret,
+		AccessToken:  repository.AccessToken,
+		RefreshToken: repository.RefreshToken,
+		Refresher:    s.refreshToken(ctx, repository),
+	}
+	commit, err := provider.FetchCommit(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID, commitID)
+	if err != nil {
+		return nil, err
+	}
+	if reason := checkCommitSignature(ctx, provider, oauthCtx, repository, commit.ID); reason != "" {
+		return nil, &common.Error{Code: common.Invalid, Err: fmt.Errorf("commit %s is rejected since the repository requires signed commits, %s", commit.ID, reason)}
+	}
+	addedList, err := fetchBaseDirectoryAddedList(ctx, provider, oauthCtx, repository, commit.ID)
+	if err != nil {
+		return nil, err
+	}
+	commit.AddedList = addedList
+
+	pushEvent, webhookCommit := composeReplayPushEvent(repository, externalID, branch, commit)
+	_, checksumMap := s.readMigrationManifest(ctx, repository, commit.ID)
+
+	result, err := replayCommit(
+		ctx,
+		repository,
+		commit,
+		func(ctx context.Context, mi *db.MigrationInfo, added string) ([]string, error) {
+			return s.findAppliedDatabaseList(ctx, repository, mi, added, branchEnvironment)
+		},
+		func(ctx context.Context, added string) (*api.Issue, string, error) {
+			return s.processPushedFile(ctx, repository, pushEvent, webhookCommit, added, branchEnvironment, checksumMap)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	s.l.Info("Replayed push event.",
+		zap.Int("repository_id", repository.ID),
+		zap.String("ref", pushEvent.Ref),
+		zap.String("commit", commit.ID),
+	)
+	return result, nil
+}
+
+// composeReplayPushEvent composes the push event of the commit to the branch the webhook would receive.
+func composeReplayPushEvent(repository *api.Repository, externalID int, branch string, commit *vcs.Commit) (*gitlab.WebhookPushEvent, gitlab.WebhookCommit) {
+	pushEvent := &gitlab.WebhookPushEvent{
+		ObjectKind: gitlab.WebhookPush,
+		Ref:        "refs/heads/" + branch,
+		After:      commit.ID,
+		AuthorName: commit.AuthorName,
+		Project: gitlab.WebhookProject{
+			ID:       externalID,
+			WebURL:   repository.WebURL,
+			FullPath: repository.FullPath,
+		},
+	}
+	if isTagBranchFilter(branch) {
+		pushEvent.ObjectKind = gitlab.WebhookTagPush
+		pushEvent.Ref = branch
+	}
+	webhookCommit := gitlab.WebhookCommit{
+		ID:        commit.ID,
+		Title:     commit.Title,
+		Message:   commit.Message,
+		Timestamp: time.Unix(commit.CreatedTs, 0).UTC().Format(time.RFC3339),
+		URL:       commit.URL,
+		Author: gitlab.WebhookCommitAuthor{
+			Name:  commit.AuthorName,
+			Email: commit.AuthorEmail,
+		},
+		AddedList: commit.AddedList,
+	}
+	pushEvent.CommitList = []gitlab.WebhookCommit{webhookCommit}
+
+	return pushEvent, webhookCommit
+}
+
+// fetchBaseDirectoryAddedList returns the paths of the files added by the commit under the base directory of the repository.
+func fetchBaseDirectoryAddedList(ctx context.Context, provider vcs.Provider, oauthCtx common.OauthContext, repository *api.Repository, commitID string) ([]string, error) {
+	fileList, err := provider.CommitDiff(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID, commitID, vcs.NormalizePathPrefix(repository.BaseDirectory))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the files changed by commit %s under base directory %q: %w", commitID, repository.BaseDirectory, err)
+	}
+	var addedList []string
+	for _, file := range fileList {
+		if file.Added {
+			addedList = append(addedList, file.Path)
+		}
+	}
+	return addedList, nil
+}
+
+// resolveReplayBranch returns the branch to replay the push to. It defaults to the branch filter if it's a single branch.
+func resolveReplayBranch(repository *api.Repository, branch string) (string, error) {
+	if branch != "" {
+		return branch, nil
+	}
+	if repository.BranchFilter == "" || isTagBranchFilter(repository.BranchFilter) || strings.ContainsAny(repository.BranchFilter, `*?[\`) {
+		return "", &common.Error{Code: common.Invalid, Err: fmt.Errorf("branch is required since the branch filter %q isn't a single branch", repository.BranchFilter)}
+	}
+	return repository.BranchFilter, nil
+}
+
+// replayCommit processes the files added by the commit with processFile in order, except for the migration file whose version
+// is already applied to any of the databases returned by findAppliedDatabaseList, which is skipped.
+func replayCommit(
+	ctx context.Context,
+	repository *api.Repository,
+	commit *vcs.Commit,
+	findAppliedDatabaseList func(ctx context.Context, mi *db.MigrationInfo, added string) ([]string, error),
+	processFile func(ctx context.Context, added string) (*api.Issue, string, error),
+) (*api.PushReplayResult, error) {
+	result := &api.PushReplayResult{
+		CommitID: commit.ID,
+	}
+	for _, added := range commit.AddedList {
+		file := &api.ReplayedFile{
+			FilePath: added,
+		}
+		result.FileList = append(result.FileList, file)
+
+		// The file not parsed as a migration file is left to processFile to tell the skip reason.
+		if mi, err := db.ParseMigrationInfo(added, filepath.Join(repository.BaseDirectory, repository.FilePathTemplate)); err == nil {
+			appliedList, err := findAppliedDatabaseList(ctx, mi, added)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check whether version %s of file %q is applied: %w", mi.Version, added, err)
+			}
+			if len(appliedList) > 0 {
+				file.SkipReason = fmt.Sprintf("version %s is already applied to %s", mi.Version, strings.Join(appliedList, ", "))
+				continue
+			}
+		}
+
+		issue, skipReason, err := processFile(ctx, added)
+		if err != nil {
+			return nil, err
+		}
+		if issue == nil {
+			file.SkipReason = skipReason
+			continue
+		}
+		file.IssueID = issue.ID
+		file.IssueName = issue.Name
+	}
+	return result, nil
+}
+
+// findAppliedDatabaseList returns the databases matching the migration file which the migration version is already applied to,
+// in the form of "{{ENV_NAME}}/{{DB_NAME}}". Returns an empty list if no database matches, which is reported by processPushedFile.
+func (s *Server) findAppliedDatabaseList(ctx context.Context, repository *api.Repository, mi *db.MigrationInfo, added string, branchEnvironment string) ([]string, error) {
+	databaseList, err := s.composeDatabaseListByFind(ctx, &api.DatabaseFind{
+		ProjectID: &repository.ProjectID,
+		Name:      &mi.Database,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if repository.Project.TenantMode != api.TenantModeTenant {
+		if mi.Environment != "" {
+			database, err := api.MatchPathToDatabase(added, repository.FilePathTemplate, repository.BaseDirectory, databaseList)
+			if err != nil {
+				return nil, nil
+			}
+			databaseList = []*api.Database{database}
+		}
+		if branchEnvironment != "" {
+			databaseList = filterDatabaseListByEnvironment(databaseList, branchEnvironment)
+		}
+	}
+
+	var appliedList []string
+	for _, database := range databaseList {
+		applied, err := isMigrationVersionApplied(ctx, database, mi.Version, s.l)
+		if err != nil {
+			return nil, err
+		}
+		if applied {
+			appliedList = append(appliedList, fmt.Sprintf("%s/%s", database.Instance.Environment.Name, database.Name))
+		}
+	}
+	return appliedList, nil
+}
+
+// isMigrationVersionApplied returns true if the migration history of the database contains the version.
+func isMigrationVersionApplied(ctx context.Context, database *api.Database, version string, logger *zap.Logger) (bool, error) {
+	driver, err := getDatabaseDriver(ctx, database.Instance, "", logger)
+	if err != nil {
+		return false, err
+	}
+	defer driver.Close(ctx)
+
+	list, err := driver.FindMigrationHistoryList(ctx, &db.MigrationHistoryFind{
+		Database: &database.Name,
+		Version:  &version,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to find migration history of database %q: %w", database.Name, err)
+	}
+	return len(list) > 0, nil
+}
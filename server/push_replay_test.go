@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/db"
+	"github.com/bytebase/bytebase/plugin/vcs"
+)
+
+func TestReplayCommit(t *testing.T) {
+	repository := &api.Repository{
+		BaseDirectory:    "bytebase",
+		FilePathTemplate: "{{ENV_NAME}}/{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql",
+	}
+	// The migration history of the databases keyed by "{{ENV_NAME}}/{{DB_NAME}}".
+	appliedVersionMap := map[string][]string{
+		"prod/blog": {"202204150900"},
+	}
+	findAppliedDatabaseList := func(ctx context.Context, mi *db.MigrationInfo, added string) ([]string, error) {
+		var appliedList []string
+		for _, version := range appliedVersionMap[fmt.Sprintf("%s/%s", mi.Environment, mi.Database)] {
+			if version == mi.Version {
+				appliedList = append(appliedList, fmt.Sprintf("%s/%s", mi.Environment, mi.Database))
+			}
+		}
+		return appliedList, nil
+	}
+
+	tests := []struct {
+		name          string
+		addedList     []string
+		wantProcessed []string
+		wantFileList  []*api.ReplayedFile
+	}{
+		{
+			name:      "already applied",
+			addedList: []string{"bytebase/prod/blog__202204150900__migrate__add_users.sql"},
+			wantFileList: []*api.ReplayedFile{
+				{
+					FilePath:   "bytebase/prod/blog__202204150900__migrate__add_users.sql",
+					SkipReason: "version 202204150900 is already applied to prod/blog",
+				},
+			},
+		},
+		{
+			name: "missed",
+			addedList: []string{
+				"bytebase/prod/blog__202204150900__migrate__add_users.sql",
+				"bytebase/prod/blog__202204151000__migrate__add_posts.sql",
+				"docs/README.md",
+			},
+			wantProcessed: []string{
+				"bytebase/prod/blog__202204151000__migrate__add_posts.sql",
+				"docs/README.md",
+			},
+			wantFileList: []*api.ReplayedFile{
+				{
+					FilePath:   "bytebase/prod/blog__202204150900__migrate__add_users.sql",
+					SkipReason: "version 202204150900 is already applied to prod/blog",
+				},
+				{
+					FilePath:  "bytebase/prod/blog__202204151000__migrate__add_posts.sql",
+					IssueID:   101,
+					IssueName: "Add posts",
+				},
+				{
+					FilePath:   "docs/README.md",
+					SkipReason: `not under the base directory "bytebase"`,
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		var processed []string
+		processFile := func(ctx context.Context, added string) (*api.Issue, string, error) {
+			processed = append(processed, added)
+			if added == "docs/README.md" {
+				return nil, `not under the base directory "bytebase"`, nil
+			}
+			return &api.Issue{ID: 101, Name: "Add posts"}, "", nil
+		}
+		commit := &vcs.Commit{
+			ID:        "abc123",
+			AddedList: test.addedList,
+		}
+		result, err := replayCommit(context.Background(), repository, commit, findAppliedDatabaseList, processFile)
+		if err != nil {
+			t.Errorf("%q: replayCommit() got error %v, want OK.", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(processed, test.wantProcessed) {
+			t.Errorf("%q: replayCommit() processed %v, want %v.", test.name, processed, test.wantProcessed)
+		}
+		if result.CommitID != commit.ID {
+			t.Errorf("%q: replayCommit() got commit ID %q, want %q.", test.name, result.CommitID, commit.ID)
+		}
+		if len(result.FileList) != len(test.wantFileList) {
+			t.Errorf("%q: replayCommit() got %d files, want %d.", test.name, len(result.FileList), len(test.wantFileList))
+			continue
+		}
+		for i, file := range result.FileList {
+			if !reflect.DeepEqual(file, test.wantFileList[i]) {
+				t.Errorf("%q: replayCommit() got file %+v, want %+v.", test.name, file, test.wantFileList[i])
+			}
+		}
+	}
+}
+
+func TestResolveReplayBranch(t *testing.T) {
+	tests := []struct {
+		branchFilter string
+		branch       string
+		want         string
+		wantErr      bool
+	}{
+		{
+			branchFilter: "main",
+			want:         "main",
+		},
+		{
+			branchFilter: "release/*",
+			branch:       "release/1.0",
+			want:         "release/1.0",
+		},
+		{
+			branchFilter: "release/*",
+			wantErr:      true,
+		},
+		{
+			branchFilter: "refs/tags/v*",
+			wantErr:      true,
+		},
+		{
+			branchFilter: "",
+			wantErr:      true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := resolveReplayBranch(&api.Repository{BranchFilter: test.branchFilter}, test.branch)
+		if test.wantErr {
+			if common.ErrorCode(err) != common.Invalid {
+				t.Errorf("resolveReplayBranch(%q, %q) got error %v, want invalid.", test.branchFilter, test.branch, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("resolveReplayBranch(%q, %q) got error %v, want OK.", test.branchFilter, test.branch, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("resolveReplayBranch(%q, %q) got %q, want %q.", test.branchFilter, test.branch, got, test.want)
+		}
+	}
+}
+
+// fakeCommitDiffProvider is the provider returning the diff of a commit, either scoped to the path prefix by the VCS,
+// or filtered on the client side from the whole diff.
+type fakeCommitDiffProvider struct {
+	vcs.Provider
+	fileList []*vcs.ChangedFile
+	scoped   bool
+}
+
+func (p *fakeCommitDiffProvider) CommitDiff(_ context.Context, _ common.OauthContext, _ string, _ string, _ string, pathPrefix string) ([]*vcs.ChangedFile, error) {
+	if !p.scoped {
+		return vcs.FilterChangedFileList(p.fileList, pathPrefix), nil
+	}
+	// The VCS matches the whole directory name of the path prefix, as the client-side filter does.
+	var fileList []*vcs.ChangedFile
+	for _, file := range p.fileList {
+		if pathPrefix == "" || strings.HasPrefix(file.Path, pathPrefix+"/") {
+			fileList = append(fileList, file)
+		}
+	}
+	return fileList, nil
+}
+
+func TestFetchBaseDirectoryAddedList(t *testing.T) {
+	fileList := []*vcs.ChangedFile{
+		{Path: "bytebase/prod/blog__202204150930__migrate__add_users.sql", Added: true},
+		{Path: "bytebase/prod/.blog__LATEST.sql"},
+		{Path: "bytebase2/prod/blog__202204150930__migrate__add_posts.sql", Added: true},
+		{Path: "README.md", Added: true},
+	}
+	tests := []struct {
+		baseDirectory string
+		want          []string
+	}{
+		{
+			baseDirectory: "",
+			want: []string{
+				"bytebase/prod/blog__202204150930__migrate__add_users.sql",
+				"bytebase2/prod/blog__202204150930__migrate__add_posts.sql",
+				"README.md",
+			},
+		},
+		{
+			baseDirectory: "bytebase",
+			want:          []string{"bytebase/prod/blog__202204150930__migrate__add_users.sql"},
+		},
+		{
+			baseDirectory: "/bytebase/",
+			want:          []string{"bytebase/prod/blog__202204150930__migrate__add_users.sql"},
+		},
+		{
+			baseDirectory: "bytebase/test",
+			want:          nil,
+		},
+	}
+	for _, test := range tests {
+		repository := &api.Repository{
+			VCS:           &api.VCS{},
+			BaseDirectory: test.baseDirectory,
+		}
+		for _, scoped := range []bool{true, false} {
+			provider := &fakeCommitDiffProvider{fileList: fileList, scoped: scoped}
+			addedList, err := fetchBaseDirectoryAddedList(context.Background(), provider, common.OauthContext{}, repository, "abc123")
+			if err != nil {
+				t.Fatalf("%q: fetchBaseDirectoryAddedList() with scoped %v got error %v, want OK.", test.baseDirectory, scoped, err)
+			}
+			if !reflect.DeepEqual(addedList, test.want) {
+				t.Errorf("%q: fetchBaseDirectoryAddedList() with scoped %v got %v, want %v.", test.baseDirectory, scoped, addedList, test.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/db"
+	"go.uber.org/zap"
+)
+
+// SimulatePush previews which of the changed files would become migrations if they were pushed to the branch of the repository,
+// and why the others would be skipped. It's for debugging the repository config, so it only reasons over the stored config
+// without reading the files, creating issues or calling the VCS provider.
+func (s *Server) SimulatePush(ctx context.Context, repositoryID int, branch string, changedFileList []string) (*api.PushSimulationResult, error) {
+	repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ID: &repositoryID})
+	if err != nil {
+		return nil, err
+	}
+	if repository == nil {
+		return nil, &common.Error{Code: common.NotFound, Err: fmt.Errorf("repository ID not found: %d", repositoryID)}
+	}
+	if err := s.composeRepositoryRelationship(ctx, repository); err != nil {
+		return nil, err
+	}
+
+	databaseList, err := s.composeDatabaseListByFind(ctx, &api.DatabaseFind{
+		ProjectID: &repository.ProjectID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return simulatePush(repository, branch, changedFileList, databaseList, s.l), nil
+}
+
+// simulatePush goes through the same steps as processing the push event in the webhook.
+// The repository must be composed with its project, and the database instances must be composed with their environments.
+func simulatePush(repository *api.Repository, branch string, changedFileList []string, databaseList []*api.Database, logger *zap.Logger) *api.PushSimulationResult {
+	filterMatched := isBranchMatched(repository.BranchFilter, branch, logger)
+	branchEnvironment, mapped := resolveBranchEnvironment(repository, branch)
+	result := &api.PushSimulationResult{
+		BranchMatched: filterMatched && mapped,
+	}
+	for _, changed := range changedFileList {
+		file := &api.SimulatedFile{
+			FilePath: changed,
+		}
+		result.FileList = append(result.FileList, file)
+
+		if !filterMatched {
+			file.SkipReason = fmt.Sprintf("branch %q doesn't match the branch filter %q", branch, repository.BranchFilter)
+			continue
+		}
+		if !mapped {
+			file.SkipReason = fmt.Sprintf("branch %q isn't mapped to any environment", branch)
+			continue
+		}
+		if !strings.HasPrefix(changed, repository.BaseDirectory) {
+			file.SkipReason = fmt.Sprintf("not under the base directory %q", repository.BaseDirectory)
+			continue
+		}
+		if isSkipGeneratedSchemaFile(repository, changed, logger) {
+			file.SkipReason = fmt.Sprintf("matches the schema path template %q", repository.SchemaPathTemplate)
+			continue
+		}
+		mi, err := db.ParseMigrationInfo(changed, filepath.Join(repository.BaseDirectory, repository.FilePathTemplate))
+		if err != nil {
+			file.SkipReason = err.Error()
+			// Tells where the file path diverges from the template, e.g. the missing separator, to fix the near-miss file.
+			if diagnosis, diagnoseErr := db.DiagnoseMatch(repository.FilePathTemplate, repository.BaseDirectory, changed); diagnoseErr == nil && diagnosis.SegmentIndex >= 0 {
+				file.SkipReason = fmt.Sprintf("%s: %s", file.SkipReason, diagnosis.Reason)
+			}
+			continue
+		}
+		if isIgnoredPath(repository, changed, logger) {
+			file.SkipReason = fmt.Sprintf("matches the ignore path patterns %q", strings.Join(repository.IgnorePathPatterns, ","))
+			continue
+		}
+		file.MigrationType = mi.Type
+		file.Version = mi.Version
+
+		if repository.Project.TenantMode == api.TenantModeTenant {
+			if mi.Environment != "" {
+				file.SkipReason = "environment isn't accepted in schema update for tenant mode project"
+				continue
+			}
+			file.DatabaseList = []string{mi.Database}
+			continue
+		}
+
+		var matchedList []*api.Database
+		if mi.Environment != "" {
+			database, err := api.MatchPathToDatabase(changed, repository.FilePathTemplate, repository.BaseDirectory, databaseList)
+			if err != nil {
+				file.SkipReason = err.Error()
+				continue
+			}
+			matchedList = append(matchedList, database)
+		} else {
+			for _, database := range databaseList {
+				if database.Name == mi.Database {
+					matchedList = append(matchedList, database)
+				}
+			}
+			if len(matchedList) == 0 {
+				file.SkipReason = fmt.Sprintf("project ID %d does not own database %q referenced by the committed file", repository.ProjectID, mi.Database)
+				continue
+			}
+		}
+
+		if branchEnvironment != "" {
+			matchedList = filterDatabaseListByEnvironment(matchedList, branchEnvironment)
+			if len(matchedList) == 0 {
+				file.SkipReason = fmt.Sprintf("no database %q referenced by the committed file in environment %q mapped from the branch", mi.Database, branchEnvironment)
+				continue
+			}
+		}
+
+		databaseCountByEnv := make(map[int]int)
+		for _, database := range matchedList {
+			databaseCountByEnv[database.Instance.EnvironmentID]++
+			if databaseCountByEnv[database.Instance.EnvironmentID] > 1 {
+				file.SkipReason = fmt.Sprintf("multiple ambiguous databases %q in environment %q", mi.Database, database.Instance.Environment.Name)
+				break
+			}
+		}
+		if file.SkipReason != "" {
+			continue
+		}
+		for _, database := range matchedList {
+			file.DatabaseList = append(file.DatabaseList, fmt.Sprintf("%s/%s", database.Instance.Environment.Name, database.Name))
+		}
+	}
+	return result
+}
+
+// isBranchMatched returns true if the branch or the tag ref matches the branch filter. Empty branch filter matches all branches.
+func isBranchMatched(branchFilter string, branch string, logger *zap.Logger) bool {
+	if isTagBranchFilter(branchFilter) {
+		return isTagRefMatched(branchFilter, branch, logger)
+	}
+	if branchFilter == "" {
+		return true
+	}
+	matched, err := path.Match(branchFilter, branch)
+	if err != nil {
+		logger.Warn("Invalid branch filter.", zap.String("branch_filter", branchFilter), zap.Error(err))
+		return false
+	}
+	return matched
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/db"
+	"go.uber.org/zap"
+)
+
+func TestSimulatePush(t *testing.T) {
+	newDatabase := func(name string, environmentID int, environmentName string) *api.Database {
+		return &api.Database{
+			Name: name,
+			Instance: &api.Instance{
+				EnvironmentID: environmentID,
+				Environment:   &api.Environment{ID: environmentID, Name: environmentName},
+			},
+		}
+	}
+	databaseList := []*api.Database{
+		newDatabase("blog", 1, "dev"),
+		newDatabase("blog", 2, "prod"),
+		newDatabase("shop", 1, "dev"),
+		newDatabase("shop", 1, "dev"),
+	}
+	repository := &api.Repository{
+		ProjectID:          1,
+		Project:            &api.Project{TenantMode: api.TenantModeDisabled},
+		BranchFilter:       "main",
+		BaseDirectory:      "bytebase",
+		FilePathTemplate:   "{{ENV_NAME}}/{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql",
+		SchemaPathTemplate: "{{ENV_NAME}}/.{{DB_NAME}}__LATEST.sql",
+		IgnorePathPatterns: []string{"bytebase/*/seed__*"},
+	}
+
+	type wantFile struct {
+		filePath      string
+		skipReason    string
+		migrationType db.MigrationType
+		version       string
+		databaseList  []string
+	}
+	tests := []struct {
+		name              string
+		branch            string
+		changedFileList   []string
+		wantBranchMatched bool
+		wantFileList      []wantFile
+	}{
+		{
+			name:   "mixed files",
+			branch: "main",
+			changedFileList: []string{
+				"bytebase/dev/blog__202101131000__migrate__add_users.sql",
+				"bytebase/prod/blog__202101131000__data__seed_users.sql",
+				"docs/README.md",
+				"bytebase/dev/.blog__LATEST.sql",
+				"bytebase/dev/blog.sql",
+				"bytebase/dev/seed__202101131000__data__users.sql",
+				"bytebase/dev/orders__202101131000__migrate__add_orders.sql",
+				"bytebase/dev/shop__202101131000__migrate__add_items.sql",
+			},
+			wantBranchMatched: true,
+			wantFileList: []wantFile{
+				{
+					filePath:      "bytebase/dev/blog__202101131000__migrate__add_users.sql",
+					migrationType: db.Migrate,
+					version:       "202101131000",
+					databaseList:  []string{"dev/blog"},
+				},
+				{
+					filePath:      "bytebase/prod/blog__202101131000__data__seed_users.sql",
+					migrationType: db.Data,
+					version:       "202101131000",
+					databaseList:  []string{"prod/blog"},
+				},
+				{
+					filePath:   "docs/README.md",
+					skipReason: "not under the base directory",
+				},
+				{
+					filePath:   "bytebase/dev/.blog__LATEST.sql",
+					skipReason: "matches the schema path template",
+				},
+				{
+					filePath:   "bytebase/dev/blog.sql",
+					skipReason: `does not match file path template "bytebase/{{ENV_NAME}}/{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql": segment "blog.sql" doesn't have "__" after "{{DB_NAME}}"`,
+				},
+				{
+					filePath:   "bytebase/dev/seed__202101131000__data__users.sql",
+					skipReason: "matches the ignore path patterns",
+				},
+				{
+					filePath:      "bytebase/dev/orders__202101131000__migrate__add_orders.sql",
+					skipReason:    "no database \"orders\"",
+					migrationType: db.Migrate,
+					version:       "202101131000",
+				},
+				{
+					filePath:      "bytebase/dev/shop__202101131000__migrate__add_items.sql",
+					skipReason:    "matches 2 databases",
+					migrationType: db.Migrate,
+					version:       "202101131000",
+				},
+			},
+		},
+		{
+			name:   "branch not matching the branch filter",
+			branch: "feature",
+			changedFileList: []string{
+				"bytebase/dev/blog__202101131000__migrate__add_users.sql",
+			},
+			wantBranchMatched: false,
+			wantFileList: []wantFile{
+				{
+					filePath:   "bytebase/dev/blog__202101131000__migrate__add_users.sql",
+					skipReason: "doesn't match the branch filter",
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		result := simulatePush(repository, test.branch, test.changedFileList, databaseList, zap.NewNop())
+		if result.BranchMatched != test.wantBranchMatched {
+			t.Errorf("%q: simulatePush() got branch matched %v, want %v.", test.name, result.BranchMatched, test.wantBranchMatched)
+		}
+		if len(result.FileList) != len(test.wantFileList) {
+			t.Fatalf("%q: simulatePush() got %d files, want %d.", test.name, len(result.FileList), len(test.wantFileList))
+		}
+		for i, want := range test.wantFileList {
+			got := result.FileList[i]
+			if got.FilePath != want.filePath {
+				t.Errorf("%q: simulatePush() got file %q, want %q.", test.name, got.FilePath, want.filePath)
+			}
+			if want.skipReason == "" {
+				if got.SkipReason != "" {
+					t.Errorf("%q: simulatePush() got file %q skipped for %q, want not skipped.", test.name, got.FilePath, got.SkipReason)
+				}
+			} else if !strings.Contains(got.SkipReason, want.skipReason) {
+				t.Errorf("%q: simulatePush() got file %q skip reason %q, want containing %q.", test.name, got.FilePath, got.SkipReason, want.skipReason)
+			}
+			if got.MigrationType != want.migrationType || got.Version != want.version {
+				t.Errorf("%q: simulatePush() got file %q type %q version %q, want type %q version %q.", test.name, got.FilePath, got.MigrationType, got.Version, want.migrationType, want.version)
+			}
+			if strings.Join(got.DatabaseList, ",") != strings.Join(want.databaseList, ",") {
+				t.Errorf("%q: simulatePush() got file %q databases %v, want %v.", test.name, got.FilePath, got.DatabaseList, want.databaseList)
+			}
+		}
+	}
+}
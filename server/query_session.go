@@ -0,0 +1,35 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/bytebase/bytebase/api"
+)
+
+// querySessionTracker limits the number of the query sessions running concurrently in the SQL console by the plan.
+// A query session lasts while the query is executed. The zero value is ready to use.
+type querySessionTracker struct {
+	mu      sync.Mutex
+	running int
+}
+
+// begin starts a query session, and returns the function to call after the query session ends.
+// Returns error without starting the session if the plan's maximum number of concurrent query sessions is reached.
+func (t *querySessionTracker) begin(plan api.PlanType) (func(), error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if limit := plan.MaxConcurrentQuerySessions(); limit >= 0 && t.running >= limit {
+		return nil, fmt.Errorf("the %s plan allows at most %d concurrent query sessions, please wait for the running queries to finish or upgrade the plan", plan.String(), limit)
+	}
+	t.running++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.running--
+		})
+	}, nil
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+)
+
+func TestQuerySessionTracker(t *testing.T) {
+	tests := []struct {
+		plan api.PlanType
+		// begin is the number of the query sessions to begin.
+		begin   int
+		wantErr bool
+	}{
+		{plan: api.FREE, begin: 1},
+		{plan: api.FREE, begin: 2, wantErr: true},
+		{plan: api.TEAM, begin: 10},
+		{plan: api.TEAM, begin: 11, wantErr: true},
+		{plan: api.ENTERPRISE, begin: 100},
+	}
+
+	for _, test := range tests {
+		tracker := &querySessionTracker{}
+		var doneList []func()
+		var err error
+		for i := 0; i < test.begin; i++ {
+			var done func()
+			done, err = tracker.begin(test.plan)
+			if err != nil {
+				break
+			}
+			doneList = append(doneList, done)
+		}
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: begin() %d sessions got OK, want error.", test.plan, test.begin)
+				continue
+			}
+			// The message tells the limit.
+			if limit := test.plan.MaxConcurrentQuerySessions(); !strings.Contains(err.Error(), fmt.Sprintf("at most %d", limit)) || len(doneList) != limit {
+				t.Errorf("%s: begin() got error %q after %d sessions, want the limit %d.", test.plan, err, len(doneList), limit)
+			}
+			// Ending a session makes room for a new one, and ending it twice doesn't.
+			doneList[0]()
+			doneList[0]()
+			if _, err := tracker.begin(test.plan); err != nil {
+				t.Errorf("%s: begin() after ending a session got error %v, want OK.", test.plan, err)
+			}
+			if _, err := tracker.begin(test.plan); err == nil {
+				t.Errorf("%s: begin() over the limit again got OK, want error.", test.plan)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: begin() %d sessions got error %v, want OK.", test.plan, test.begin, err)
+		}
+	}
+}
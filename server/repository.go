@@ -2,9 +2,19 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"github.com/bytebase/bytebase/plugin/vcs/gitlab"
+	"go.uber.org/zap"
+)
+
+const (
+	// schemaReviewCommentMarker identifies the schema review comment created by Bytebase on the merge request.
+	schemaReviewCommentMarker = "bytebase-schema-review"
 )
 
 func (s *Server) composeRepositoryRelationship(ctx context.Context, repository *api.Repository) error {
@@ -36,3 +46,268 @@ func (s *Server) composeRepositoryRelationship(ctx context.Context, repository *
 
 	return nil
 }
+
+// createOrUpdateSchemaReviewComment posts the schema review result as a single comment on the merge request.
+// Repeated calls for the same merge request update the existing comment instead of creating a new one.
+func (s *Server) createOrUpdateSchemaReviewComment(ctx context.Context, repository *api.Repository, mergeRequestID int, body string) error {
+	if repository.VCS == nil {
+		return fmt.Errorf("VCS not found for ID: %v", repository.VCSID)
+	}
+	return vcs.Get(repository.VCS.Type, s.vcsProviderConfig()).CreateOrUpdateComment(
+		ctx,
+		common.OauthContext{
+			ClientID:     repository.VCS.ApplicationID,
+			ClientSecret: repository.VCS.Secret,
+			AccessToken:  repository.AccessToken,
+			RefreshToken: repository.RefreshToken,
+			Refresher:    s.refreshToken(ctx, repository),
+		},
+		repository.VCS.InstanceURL,
+		repository.ExternalID,
+		mergeRequestID,
+		schemaReviewCommentMarker,
+		body,
+	)
+}
+
+// RotateWebhookSecret replaces the webhook secret token of the repository with a newly generated strong one.
+// The webhook is updated before the repository, so the push events are verified against the new token once it's stored.
+func (s *Server) RotateWebhookSecret(ctx context.Context, repositoryID int, updaterID int) (*api.Repository, error) {
+	repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ID: &repositoryID, IncludeSecrets: true})
+	if err != nil {
+		return nil, err
+	}
+	if repository == nil {
+		return nil, &common.Error{Code: common.NotFound, Err: fmt.Errorf("repository ID not found: %d", repositoryID)}
+	}
+	if err := s.composeRepositoryRelationship(ctx, repository); err != nil {
+		return nil, err
+	}
+
+	secretToken, err := common.RandomSecret(api.WebhookSecretTokenLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate webhook secret token: %w", err)
+	}
+
+	var webhookPatchPayload []byte
+	switch repository.VCS.Type {
+	case vcs.GitLabSelfHost:
+		callbackURL, err := s.webhookCallbackURL(repository.WebhookURLHost, repository.WebhookEndpointID)
+		if err != nil {
+			return nil, err
+		}
+		webhookPatchPayload, err = json.Marshal(gitlab.WebhookPut{
+			URL:                    callbackURL,
+			SecretToken:            secretToken,
+			PushEvents:             !isTagBranchFilter(repository.BranchFilter),
+			TagPushEvents:          isTagBranchFilter(repository.BranchFilter),
+			PushEventsBranchFilter: repository.BranchFilter,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal put request for updating webhook %s: %w", repository.ExternalWebhookID, err)
+		}
+	}
+	if err := vcs.Get(repository.VCS.Type, s.vcsProviderConfig()).PatchWebhook(
+		ctx,
+		common.OauthContext{
+			ClientID:     repository.VCS.ApplicationID,
+			ClientSecret: repository.VCS.Secret,
+			AccessToken:  repository.AccessToken,
+			RefreshToken: repository.RefreshToken,
+			Refresher:    s.refreshToken(ctx, repository),
+		},
+		repository.VCS.InstanceURL,
+		repository.ExternalID,
+		repository.ExternalWebhookID,
+		webhookPatchPayload,
+	); err != nil {
+		return nil, fmt.Errorf("failed to update webhook %s with the rotated secret token: %w", repository.ExternalWebhookID, err)
+	}
+
+	return s.RepositoryService.PatchRepository(ctx, &api.RepositoryPatch{
+		ID:                 repository.ID,
+		UpdaterID:          updaterID,
+		WebhookSecretToken: &secretToken,
+	})
+}
+
+// archiveProjectRepositories archives the repositories of the deleted project, then deletes their webhooks on a best-effort
+// basis. A webhook failed to delete is only logged, since the repository is already archived and its pushes are ignored.
+func (s *Server) archiveProjectRepositories(ctx context.Context, projectID int, deleterID int) error {
+	repositoryList, err := s.RepositoryService.FindRepositoryList(ctx, &api.RepositoryFind{ProjectID: &projectID, IncludeSecrets: true})
+	if err != nil {
+		return err
+	}
+	if len(repositoryList) == 0 {
+		return nil
+	}
+	if _, err := s.RepositoryService.ArchiveRepositoriesForProject(ctx, projectID, deleterID); err != nil {
+		return err
+	}
+	s.refreshWebhookRoutes(ctx)
+	s.requestRepositoryStatusMetricsRefresh()
+
+	for _, repository := range repositoryList {
+		if repository.ExternalWebhookID == "" {
+			continue
+		}
+		if err := s.deleteRepositoryWebhook(ctx, repository); err != nil {
+			s.l.Warn("Failed to delete the webhook of the archived repository.",
+				zap.Int("repository_id", repository.ID),
+				zap.Int("project_id", projectID),
+				zap.String("webhook_id", repository.ExternalWebhookID),
+				zap.Error(err),
+			)
+		}
+	}
+	return nil
+}
+
+// deleteRepositoryWebhook deletes the webhook of the repository from the VCS.
+func (s *Server) deleteRepositoryWebhook(ctx context.Context, repository *api.Repository) error {
+	vcsInstance, err := s.composeVCSByID(ctx, repository.VCSID)
+	if err != nil {
+		return err
+	}
+	if vcsInstance == nil {
+		return fmt.Errorf("VCS not found for ID: %d", repository.VCSID)
+	}
+	return vcs.Get(vcsInstance.Type, s.vcsProviderConfig()).DeleteWebhook(
+		ctx,
+		common.OauthContext{
+			ClientID:     vcsInstance.ApplicationID,
+			ClientSecret: vcsInstance.Secret,
+			AccessToken:  repository.AccessToken,
+			RefreshToken: repository.RefreshToken,
+			Refresher:    s.refreshToken(ctx, repository),
+		},
+		vcsInstance.InstanceURL,
+		repository.ExternalID,
+		repository.ExternalWebhookID,
+	)
+}
+
+// composeWebhookCreatePayload composes the VCS specific payload for creating the webhook of the repository.
+// webhookURLHost is the webhook URL host stored in the repository, either the literal host or a logical host key.
+func (s *Server) composeWebhookCreatePayload(vcsType vcs.Type, webhookURLHost string, webhookEndpointID string, secretToken string, branchFilter string) ([]byte, error) {
+	switch vcsType {
+	case vcs.GitLabSelfHost:
+		callbackURL, err := s.webhookCallbackURL(webhookURLHost, webhookEndpointID)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(gitlab.WebhookPost{
+			URL:                    callbackURL,
+			SecretToken:            secretToken,
+			PushEvents:             !isTagBranchFilter(branchFilter),
+			TagPushEvents:          isTagBranchFilter(branchFilter),
+			PushEventsBranchFilter: branchFilter,
+			EnableSSLVerification:  false,
+		})
+	}
+	return nil, nil
+}
+
+// createRepositoryWebhook creates the webhook of the linked repository and returns the created webhook ID.
+// It's used for retrying the webhook creation of the repository in the WebhookPending status.
+// The existing webhook calling back the repository is reused, since the previous attempt may have created it at the VCS
+// without being recorded, e.g. the response timed out.
+func (s *Server) createRepositoryWebhook(ctx context.Context, repository *api.Repository) (string, error) {
+	if err := s.composeRepositoryRelationship(ctx, repository); err != nil {
+		return "", err
+	}
+	callbackURL, err := s.webhookCallbackURL(repository.WebhookURLHost, repository.WebhookEndpointID)
+	if err != nil {
+		return "", err
+	}
+	webhookCreatePayload, err := s.composeWebhookCreatePayload(repository.VCS.Type, repository.WebhookURLHost, repository.WebhookEndpointID, repository.WebhookSecretToken, repository.BranchFilter)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal post request for creating webhook: %w", err)
+	}
+	return ensureRepositoryWebhook(
+		ctx,
+		vcs.Get(repository.VCS.Type, s.vcsProviderConfig()),
+		common.OauthContext{
+			ClientID:     repository.VCS.ApplicationID,
+			ClientSecret: repository.VCS.Secret,
+			AccessToken:  repository.AccessToken,
+			RefreshToken: repository.RefreshToken,
+			Refresher:    s.refreshToken(ctx, repository),
+		},
+		repository.VCS.InstanceURL,
+		repository.ExternalID,
+		callbackURL,
+		webhookCreatePayload,
+	)
+}
+
+// ensureRepositoryWebhook returns the ID of the webhook of the repository calling back callbackURL, and only creates
+// the webhook by payload if there is none. All the webhooks at the VCS are listed across the pages, since the Bytebase
+// webhook missed on a later page would be duplicated. The webhook isn't created if the listing fails for the same reason.
+func ensureRepositoryWebhook(ctx context.Context, provider vcs.Provider, oauthCtx common.OauthContext, instanceURL string, repositoryID string, callbackURL string, payload []byte) (string, error) {
+	webhookList, err := provider.ListWebhooks(ctx, oauthCtx, instanceURL, repositoryID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list the existing webhooks: %w", err)
+	}
+	for _, webhook := range webhookList {
+		if webhook.URL == callbackURL {
+			return webhook.ID, nil
+		}
+	}
+	return provider.CreateWebhook(ctx, oauthCtx, instanceURL, repositoryID, payload)
+}
+
+// VerifyRepositoryExists checks whether the repository still exists at the VCS provider, e.g. it's not deleted or made private
+// while the project is still linked to it. Returns false only if the VCS definitively reports the repository not found,
+// in which case the repository is flagged ProviderMissing. Returns NotAuthorized error if the VCS rejects the access token,
+// which needs the repository to be linked again rather than taken as missing.
+func (s *Server) VerifyRepositoryExists(ctx context.Context, repositoryID int) (bool, error) {
+	repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ID: &repositoryID, IncludeSecrets: true})
+	if err != nil {
+		return false, err
+	}
+	if repository == nil {
+		return false, &common.Error{Code: common.NotFound, Err: fmt.Errorf("repository ID not found: %d", repositoryID)}
+	}
+	if err := s.composeRepositoryRelationship(ctx, repository); err != nil {
+		return false, err
+	}
+
+	return s.verifyRepositoryExists(
+		ctx,
+		vcs.Get(repository.VCS.Type, s.vcsProviderConfig()),
+		common.OauthContext{
+			ClientID:     repository.VCS.ApplicationID,
+			ClientSecret: repository.VCS.Secret,
+			AccessToken:  repository.AccessToken,
+			RefreshToken: repository.RefreshToken,
+			Refresher:    s.refreshToken(ctx, repository),
+		},
+		repository.VCS.InstanceURL,
+		repository,
+	)
+}
+
+// verifyRepositoryExists checks the repository by the provider and updates its provider status if it's changed.
+// A missing repository found again, e.g. it's made public again, is flagged ProviderFound.
+func (s *Server) verifyRepositoryExists(ctx context.Context, provider vcs.Provider, oauthCtx common.OauthContext, instanceURL string, repository *api.Repository) (bool, error) {
+	exists, err := provider.RepositoryExists(ctx, oauthCtx, instanceURL, repository.ExternalID)
+	if err != nil {
+		return false, err
+	}
+
+	providerStatus := api.ProviderFound
+	if !exists {
+		providerStatus = api.ProviderMissing
+	}
+	if repository.ProviderStatus != providerStatus {
+		if _, err := s.RepositoryService.PatchRepository(ctx, &api.RepositoryPatch{
+			ID:             repository.ID,
+			UpdaterID:      api.SystemBotID,
+			ProviderStatus: &providerStatus,
+		}); err != nil {
+			return exists, fmt.Errorf("failed to flag repository ID %d %s: %w", repository.ID, providerStatus, err)
+		}
+	}
+	return exists, nil
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	repositoryCleanerInterval = time.Duration(10) * time.Minute
+	// DefaultRepositoryCleanupGracePeriod is the default grace window of the deferred repository cleanup.
+	DefaultRepositoryCleanupGracePeriod = time.Duration(7*24) * time.Hour
+)
+
+// SetRepositoryCleanupGracePeriod sets the grace window of the deferred repository cleanup, during which re-linking the unlinked
+// repository restores it. Non-positive means DefaultRepositoryCleanupGracePeriod.
+func (s *Server) SetRepositoryCleanupGracePeriod(gracePeriod time.Duration) {
+	if gracePeriod <= 0 {
+		gracePeriod = DefaultRepositoryCleanupGracePeriod
+	}
+	s.repositoryCleanupGracePeriod = gracePeriod
+}
+
+// getRepositoryCleanupTs returns the time the deferred cleanup of the repository unlinked at now finalizes.
+func (s *Server) getRepositoryCleanupTs(now time.Time) int64 {
+	gracePeriod := s.repositoryCleanupGracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = DefaultRepositoryCleanupGracePeriod
+	}
+	return now.Add(gracePeriod).Unix()
+}
+
+// NewRepositoryCleaner creates a repository cleaner.
+func NewRepositoryCleaner(logger *zap.Logger, server *Server) *RepositoryCleaner {
+	return &RepositoryCleaner{
+		l:      logger,
+		server: server,
+		now:    time.Now,
+	}
+}
+
+// RepositoryCleaner finalizes the deferred cleanup of the unlinked repositories whose grace window ends,
+// which deletes the repositories and flips their projects to the UI workflow.
+type RepositoryCleaner struct {
+	l      *zap.Logger
+	server *Server
+
+	now func() time.Time
+}
+
+// Run will run the repository cleaner.
+func (r *RepositoryCleaner) Run(ctx context.Context, wg *sync.WaitGroup) {
+	ticker := time.NewTicker(repositoryCleanerInterval)
+	defer ticker.Stop()
+	defer wg.Done()
+	r.l.Debug(fmt.Sprintf("Repository cleaner started and will run every %v", repositoryCleanerInterval))
+	for {
+		select {
+		case <-ticker.C:
+			projectIDList, err := r.server.RepositoryService.FinalizeRepositoryCleanup(context.Background(), r.now().Unix())
+			if err != nil {
+				r.l.Error("Failed to finalize the deferred repository cleanup", zap.Error(err))
+				continue
+			}
+			if len(projectIDList) > 0 {
+				r.l.Info("Finalized the deferred repository cleanup", zap.Ints("project_ids", projectIDList))
+			}
+		case <-ctx.Done(): // if cancel() execute
+			return
+		}
+	}
+}
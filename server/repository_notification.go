@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"github.com/bytebase/bytebase/plugin/webhook"
+	"go.uber.org/zap"
+)
+
+// repositorySyncOutcome is the outcome of applying a migration file pushed to the repository.
+type repositorySyncOutcome struct {
+	success  bool
+	database string
+	version  string
+	detail   string
+	// issueLink is the link to the issue applying the migration, empty if the issue isn't found.
+	issueLink string
+}
+
+// composeRepositorySyncWebhookContext returns the webhook context notifying the outcome of applying the migration file pushed by pushEvent.
+func composeRepositorySyncWebhookContext(repository *api.Repository, pushEvent *vcs.PushEvent, outcome repositorySyncOutcome) webhook.Context {
+	level := webhook.WebhookSuccess
+	status := "SUCCESS"
+	title := fmt.Sprintf("Migration applied - %s", repository.FullPath)
+	if !outcome.success {
+		level = webhook.WebhookError
+		status = "FAILED"
+		title = fmt.Sprintf("Migration failed - %s", repository.FullPath)
+	}
+	branch, err := vcs.Branch(pushEvent.Ref)
+	if err != nil {
+		branch = pushEvent.Ref
+	}
+	return webhook.Context{
+		Level:        level,
+		Title:        title,
+		Description:  outcome.detail,
+		Link:         outcome.issueLink,
+		CreatorName:  pushEvent.FileCommit.AuthorName,
+		CreatorEmail: pushEvent.FileCommit.AuthorEmail,
+		CreatedTs:    time.Now().Unix(),
+		MetaList: []webhook.Meta{
+			{Name: "Repository", Value: repository.WebURL},
+			{Name: "Branch", Value: branch},
+			{Name: "Commit", Value: pushEvent.FileCommit.ID},
+			{Name: "File", Value: pushEvent.FileCommit.Added},
+			{Name: "Database", Value: outcome.database},
+			{Name: "Version", Value: outcome.version},
+			{Name: "Status", Value: status},
+		},
+	}
+}
+
+// postRepositorySyncNotification posts the webhook context to the notification webhooks of the repository.
+// We just emit a warning on failure since the notification webhook endpoint is out of our code control.
+func postRepositorySyncNotification(l *zap.Logger, urlList []string, webhookCtx webhook.Context) {
+	for _, url := range urlList {
+		webhookCtx.URL = url
+		webhookType := webhook.TypeOfURL(url)
+		if err := webhook.Post(webhookType, webhookCtx); err != nil {
+			l.Warn("Failed to post repository sync notification",
+				zap.String("webhook_type", webhookType),
+				zap.String("url", url),
+				zap.String("title", webhookCtx.Title),
+				zap.Error(err))
+		}
+	}
+}
+
+// notifyRepositorySync notifies the notification webhooks of the repository of the outcome of applying the migration file
+// pushed by pushEvent. The webhooks are called in the background to avoid blocking the migration.
+func notifyRepositorySync(l *zap.Logger, repository *api.Repository, pushEvent *vcs.PushEvent, outcome repositorySyncOutcome) {
+	if len(repository.NotificationWebhookURLList) == 0 {
+		return
+	}
+	webhookCtx := composeRepositorySyncWebhookContext(repository, pushEvent, outcome)
+	go postRepositorySyncNotification(l, repository.NotificationWebhookURLList, webhookCtx)
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"github.com/bytebase/bytebase/plugin/webhook"
+	"go.uber.org/zap"
+)
+
+func TestPostRepositorySyncNotification(t *testing.T) {
+	var got []webhook.CustomWebhook
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhook.CustomWebhook
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		got = append(got, payload)
+	}))
+	defer server.Close()
+
+	repository := &api.Repository{
+		FullPath:                   "bytebase/blog",
+		WebURL:                     "https://gitlab.example.com/bytebase/blog",
+		NotificationWebhookURLList: []string{server.URL + "/notify"},
+	}
+	pushEvent := &vcs.PushEvent{
+		Ref: "refs/heads/main",
+		FileCommit: vcs.FileCommit{
+			ID:          "abc123",
+			AuthorName:  "alice",
+			AuthorEmail: "alice@example.com",
+			Added:       "bytebase/blog__202204150930__migrate.sql",
+		},
+	}
+
+	tests := []struct {
+		name    string
+		outcome repositorySyncOutcome
+		want    webhook.CustomWebhook
+	}{
+		{
+			name: "succeeded",
+			outcome: repositorySyncOutcome{
+				success:   true,
+				database:  "blog",
+				version:   "202204150930",
+				detail:    `Applied migration version 202204150930 to database "blog".`,
+				issueLink: "http://localhost:8080/issue/1?stage=1",
+			},
+			want: webhook.CustomWebhook{
+				Level:        webhook.WebhookSuccess,
+				Title:        "Migration applied - bytebase/blog",
+				Description:  `Applied migration version 202204150930 to database "blog".`,
+				Link:         "http://localhost:8080/issue/1?stage=1",
+				CreatorName:  "alice",
+				CreatorEmail: "alice@example.com",
+				MetaList: []webhook.CustomWebhookMeta{
+					{Name: "Repository", Value: "https://gitlab.example.com/bytebase/blog"},
+					{Name: "Branch", Value: "main"},
+					{Name: "Commit", Value: "abc123"},
+					{Name: "File", Value: "bytebase/blog__202204150930__migrate.sql"},
+					{Name: "Database", Value: "blog"},
+					{Name: "Version", Value: "202204150930"},
+					{Name: "Status", Value: "SUCCESS"},
+				},
+			},
+		},
+		{
+			name: "failed",
+			outcome: repositorySyncOutcome{
+				database: "blog",
+				version:  "202204150930",
+				detail:   "table already exists",
+			},
+			want: webhook.CustomWebhook{
+				Level:        webhook.WebhookError,
+				Title:        "Migration failed - bytebase/blog",
+				Description:  "table already exists",
+				CreatorName:  "alice",
+				CreatorEmail: "alice@example.com",
+				MetaList: []webhook.CustomWebhookMeta{
+					{Name: "Repository", Value: "https://gitlab.example.com/bytebase/blog"},
+					{Name: "Branch", Value: "main"},
+					{Name: "Commit", Value: "abc123"},
+					{Name: "File", Value: "bytebase/blog__202204150930__migrate.sql"},
+					{Name: "Database", Value: "blog"},
+					{Name: "Version", Value: "202204150930"},
+					{Name: "Status", Value: "FAILED"},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got = nil
+		webhookCtx := composeRepositorySyncWebhookContext(repository, pushEvent, test.outcome)
+		postRepositorySyncNotification(zap.NewNop(), repository.NotificationWebhookURLList, webhookCtx)
+		if len(got) != 1 {
+			t.Errorf("%q: postRepositorySyncNotification() posted %d payloads, want 1.", test.name, len(got))
+			continue
+		}
+		// The creation time varies.
+		got[0].CreatedTs = 0
+		if !reflect.DeepEqual(got[0], test.want) {
+			t.Errorf("%q: postRepositorySyncNotification() posted %+v, want %+v.", test.name, got[0], test.want)
+		}
+	}
+}
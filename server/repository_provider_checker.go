@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"go.uber.org/zap"
+)
+
+const (
+	repositoryProviderCheckerInterval = time.Duration(1) * time.Hour
+)
+
+// NewRepositoryProviderChecker creates a repository provider checker.
+func NewRepositoryProviderChecker(logger *zap.Logger, server *Server) *RepositoryProviderChecker {
+	return &RepositoryProviderChecker{
+		l:      logger,
+		server: server,
+	}
+}
+
+// RepositoryProviderChecker checks whether the linked repositories still exist at the VCS provider, and flags the ones
+// deleted or made private ProviderMissing, see VerifyRepositoryExists.
+type RepositoryProviderChecker struct {
+	l      *zap.Logger
+	server *Server
+}
+
+// Run will run the repository provider checker.
+func (r *RepositoryProviderChecker) Run(ctx context.Context, wg *sync.WaitGroup) {
+	ticker := time.NewTicker(repositoryProviderCheckerInterval)
+	defer ticker.Stop()
+	defer wg.Done()
+	r.l.Debug(fmt.Sprintf("Repository provider checker started and will run every %v", repositoryProviderCheckerInterval))
+	for {
+		select {
+		case <-ticker.C:
+			ctx := context.Background()
+			repositoryList, err := r.server.RepositoryService.FindRepositoryList(ctx, &api.RepositoryFind{})
+			if err != nil {
+				r.l.Error("Failed to find the repositories to check at the VCS provider", zap.Error(err))
+				continue
+			}
+			for _, repository := range repositoryList {
+				exists, err := r.server.VerifyRepositoryExists(ctx, repository.ID)
+				if err != nil {
+					// The repository with the rejected token is left to the token refresher and re-linking.
+					r.l.Warn("Failed to check the repository at the VCS provider", zap.Int("repository_id", repository.ID), zap.Error(err))
+					continue
+				}
+				if !exists {
+					r.l.Warn("Repository not found at the VCS provider", zap.Int("repository_id", repository.ID), zap.String("web_url", repository.WebURL))
+				}
+			}
+		case <-ctx.Done(): // if cancel() execute
+			return
+		}
+	}
+}
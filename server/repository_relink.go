@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/db"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"go.uber.org/zap"
+)
+
+// RelinkMigrationHistory re-associates the repository re-linked to the project with the migration history of the project's databases.
+// The migration files under the base directory at the head of the branch are processed in the version order as if they're pushed,
+// except for the ones whose version is already recorded in the migration history, which are treated as done instead of re-run.
+// So the migrations pushed while the repository is unlinked are caught up without re-applying the ones applied before.
+func (s *Server) RelinkMigrationHistory(ctx context.Context, repositoryID int) (*api.PushReplayResult, error) {
+	repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ID: &repositoryID, IncludeSecrets: true})
+	if err != nil {
+		return nil, err
+	}
+	if repository == nil {
+		return nil, &common.Error{Code: common.NotFound, Err: fmt.Errorf("repository ID not found: %d", repositoryID)}
+	}
+	if err := s.composeRepositoryRelationship(ctx, repository); err != nil {
+		return nil, err
+	}
+	if repository.VCS == nil {
+		return nil, fmt.Errorf("VCS not found for ID: %v", repository.VCSID)
+	}
+	externalID, err := strconv.Atoi(repository.ExternalID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid external ID %q of repository %d: %w", repository.ExternalID, repository.ID, err)
+	}
+
+	provider := vcs.Get(repository.VCS.Type, s.vcsProviderConfig())
+	oauthCtx := common.OauthContext{
+		ClientID:     repository.VCS.ApplicationID,
+		ClientSecret: repository.VCS.Secret,
+		AccessToken:  repository.AccessToken,
+		RefreshToken: repository.RefreshToken,
+		Refresher:    s.refreshToken(ctx, repository),
+	}
+	branch, err := resolveReplayBranch(repository, "")
+	if err != nil {
+		branch, err = provider.DefaultBranch(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve the branch to list the migration files: %w", err)
+		}
+	}
+	if !isBranchMatched(repository.BranchFilter, branch, s.l) {
+		return nil, &common.Error{Code: common.Invalid, Err: fmt.Errorf("branch %q doesn't match the branch filter %q", branch, repository.BranchFilter)}
+	}
+	branchEnvironment, ok := resolveBranchEnvironment(repository, branch)
+	if !ok {
+		return nil, &common.Error{Code: common.Invalid, Err: fmt.Errorf("branch %q isn't mapped to any environment", branch)}
+	}
+
+	commit, err := provider.FetchCommit(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID, branch)
+	if err != nil {
+		return nil, err
+	}
+	filePathList, err := provider.ListFilesRecursively(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID, repository.BaseDirectory, commit.ID)
+	if err != nil && common.ErrorCode(err) != common.NotFound {
+		return nil, fmt.Errorf("failed to list the migration files at branch %q: %w", branch, err)
+	}
+	commit.AddedList = getRelinkMigrationFileList(repository, filePathList)
+
+	pushEvent, webhookCommit := composeReplayPushEvent(repository, externalID, branch, commit)
+	_, checksumMap := s.readMigrationManifest(ctx, repository, commit.ID)
+	result, err := replayCommit(
+		ctx,
+		repository,
+		commit,
+		func(ctx context.Context, mi *db.MigrationInfo, added string) ([]string, error) {
+			return s.findAppliedDatabaseList(ctx, repository, mi, added, branchEnvironment)
+		},
+		func(ctx context.Context, added string) (*api.Issue, string, error) {
+			return s.processPushedFile(ctx, repository, pushEvent, webhookCommit, added, branchEnvironment, checksumMap)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	s.l.Info("Re-associated the re-linked repository with the migration history.",
+		zap.Int("repository_id", repository.ID),
+		zap.String("ref", pushEvent.Ref),
+		zap.String("commit", commit.ID),
+	)
+	return result, nil
+}
+
+// getRelinkMigrationFileList returns the migration files in the file list sorted by the version, dropping the other files.
+func getRelinkMigrationFileList(repository *api.Repository, filePathList []string) []string {
+	type versionedFile struct {
+		filePath string
+		version  string
+	}
+	var fileList []*versionedFile
+	for _, filePath := range filePathList {
+		mi, err := db.ParseMigrationInfo(filePath, filepath.Join(repository.BaseDirectory, repository.FilePathTemplate))
+		if err != nil {
+			continue
+		}
+		fileList = append(fileList, &versionedFile{filePath: filePath, version: mi.Version})
+	}
+	sort.SliceStable(fileList, func(i, j int) bool {
+		return fileList[i].version < fileList[j].version
+	})
+
+	var migrationFileList []string
+	for _, file := range fileList {
+		migrationFileList = append(migrationFileList, file.filePath)
+	}
+	return migrationFileList
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/db"
+	"github.com/bytebase/bytebase/plugin/vcs"
+)
+
+func TestRelinkMigrationHistory(t *testing.T) {
+	repository := &api.Repository{
+		BaseDirectory:    "bytebase",
+		FilePathTemplate: "{{ENV_NAME}}/{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql",
+	}
+	// The files at the head of the branch, listed in the path order rather than the version order.
+	filePathList := []string{
+		"bytebase/README.md",
+		"bytebase/prod/blog__202204151000__migrate__add_posts.sql",
+		"bytebase/prod/blog__202204150900__migrate__add_users.sql",
+		"bytebase/prod/blog__202204151100__migrate__add_tags.sql",
+	}
+	// The versions recorded in the migration history before the repository is unlinked.
+	appliedVersionMap := map[string]bool{
+		"202204150900": true,
+		"202204151000": true,
+	}
+
+	commit := &vcs.Commit{
+		ID:        "1a2b3c4d",
+		AddedList: getRelinkMigrationFileList(repository, filePathList),
+	}
+	wantAddedList := []string{
+		"bytebase/prod/blog__202204150900__migrate__add_users.sql",
+		"bytebase/prod/blog__202204151000__migrate__add_posts.sql",
+		"bytebase/prod/blog__202204151100__migrate__add_tags.sql",
+	}
+	if !reflect.DeepEqual(commit.AddedList, wantAddedList) {
+		t.Fatalf("getRelinkMigrationFileList() got %v, want %v.", commit.AddedList, wantAddedList)
+	}
+
+	var processedList []string
+	result, err := replayCommit(
+		context.Background(),
+		repository,
+		commit,
+		func(ctx context.Context, mi *db.MigrationInfo, added string) ([]string, error) {
+			if appliedVersionMap[mi.Version] {
+				return []string{"prod/blog"}, nil
+			}
+			return nil, nil
+		},
+		func(ctx context.Context, added string) (*api.Issue, string, error) {
+			processedList = append(processedList, added)
+			return &api.Issue{ID: 101, Name: "Add tags"}, "", nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("replayCommit() got error %v, want OK.", err)
+	}
+
+	wantProcessed := []string{"bytebase/prod/blog__202204151100__migrate__add_tags.sql"}
+	if !reflect.DeepEqual(processedList, wantProcessed) {
+		t.Errorf("replayCommit() processed %v, want %v.", processedList, wantProcessed)
+	}
+	wantFileList := []*api.ReplayedFile{
+		{
+			FilePath:   "bytebase/prod/blog__202204150900__migrate__add_users.sql",
+			SkipReason: "version 202204150900 is already applied to prod/blog",
+		},
+		{
+			FilePath:   "bytebase/prod/blog__202204151000__migrate__add_posts.sql",
+			SkipReason: "version 202204151000 is already applied to prod/blog",
+		},
+		{
+			FilePath:  "bytebase/prod/blog__202204151100__migrate__add_tags.sql",
+			IssueID:   101,
+			IssueName: "Add tags",
+		},
+	}
+	if !reflect.DeepEqual(result.FileList, wantFileList) {
+		t.Errorf("replayCommit() got file list %+v, want %+v.", result.FileList, wantFileList)
+	}
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"go.uber.org/zap"
+)
+
+// fakeRepositoryExistsProvider is a fake VCS provider only serving whether the repository exists.
+type fakeRepositoryExistsProvider struct {
+	vcs.Provider
+	exists bool
+	err    error
+}
+
+func (p *fakeRepositoryExistsProvider) RepositoryExists(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string) (bool, error) {
+	return p.exists, p.err
+}
+
+func TestVerifyRepositoryExists(t *testing.T) {
+	tests := []struct {
+		name           string
+		providerStatus api.RepositoryProviderStatus
+		provider       *fakeRepositoryExistsProvider
+		want           bool
+		wantErrCode    common.Code
+		wantStatus     api.RepositoryProviderStatus
+	}{
+		{
+			name:           "exists",
+			providerStatus: api.ProviderFound,
+			provider:       &fakeRepositoryExistsProvider{exists: true},
+			want:           true,
+			wantStatus:     api.ProviderFound,
+		},
+		{
+			name:           "missing",
+			providerStatus: api.ProviderFound,
+			provider:       &fakeRepositoryExistsProvider{exists: false},
+			want:           false,
+			wantStatus:     api.ProviderMissing,
+		},
+		{
+			name:           "found again",
+			providerStatus: api.ProviderMissing,
+			provider:       &fakeRepositoryExistsProvider{exists: true},
+			want:           true,
+			wantStatus:     api.ProviderFound,
+		},
+		{
+			// The access token is rejected, which isn't taken as missing.
+			name:           "auth error",
+			providerStatus: api.ProviderFound,
+			provider:       &fakeRepositoryExistsProvider{err: common.Errorf(common.NotAuthorized, errors.New("status code: 401"))},
+			want:           false,
+			wantErrCode:    common.NotAuthorized,
+			wantStatus:     api.ProviderFound,
+		},
+	}
+
+	for _, test := range tests {
+		repository := &api.Repository{ID: 1, ExternalID: "42", ProviderStatus: test.providerStatus}
+		repositoryService := &fakeRepositoryService{repositoryList: []*api.Repository{repository}}
+		s := &Server{l: zap.NewNop(), RepositoryService: repositoryService}
+		copied := *repository
+		got, err := s.verifyRepositoryExists(context.Background(), test.provider, common.OauthContext{}, "https://gitlab.example.com", &copied)
+		if test.wantErrCode != common.Ok {
+			if common.ErrorCode(err) != test.wantErrCode {
+				t.Errorf("%q: verifyRepositoryExists() got error %v, want error code %v.", test.name, err, test.wantErrCode)
+			}
+		} else if err != nil {
+			t.Fatalf("%q: verifyRepositoryExists() got error %v, want OK.", test.name, err)
+		}
+		if got != test.want {
+			t.Errorf("%q: verifyRepositoryExists() got %v, want %v.", test.name, got, test.want)
+		}
+		if repository.ProviderStatus != test.wantStatus {
+			t.Errorf("%q: verifyRepositoryExists() got provider status %s, want %s.", test.name, repository.ProviderStatus, test.wantStatus)
+		}
+	}
+}
+
+// fakeWebhookProvider serves the webhooks of a repository from memory in pages.
+type fakeWebhookProvider struct {
+	vcs.Provider
+	pageList [][]*vcs.Webhook
+	created  int
+}
+
+func (p *fakeWebhookProvider) ListWebhooks(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string) ([]*vcs.Webhook, error) {
+	var webhookList []*vcs.Webhook
+	for _, page := range p.pageList {
+		webhookList = append(webhookList, page...)
+	}
+	return webhookList, nil
+}
+
+func (p *fakeWebhookProvider) CreateWebhook(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, payload []byte) (string, error) {
+	p.created++
+	return "created", nil
+}
+
+func TestEnsureRepositoryWebhook(t *testing.T) {
+	const callbackURL = "https://bytebase.example.com/hook/gitlab/endpoint"
+	otherPage := []*vcs.Webhook{
+		{ID: "1", URL: "https://ci.example.com/hook/1"},
+		{ID: "2", URL: "https://ci.example.com/hook/2"},
+	}
+	tests := []struct {
+		name        string
+		pageList    [][]*vcs.Webhook
+		wantID      string
+		wantCreated int
+	}{
+		{
+			name:        "Bytebase webhook on page 2 reused",
+			pageList:    [][]*vcs.Webhook{otherPage, {{ID: "3", URL: callbackURL}}},
+			wantID:      "3",
+			wantCreated: 0,
+		},
+		{
+			name:        "missing webhook created",
+			pageList:    [][]*vcs.Webhook{otherPage, {{ID: "3", URL: "https://other.example.com/hook/gitlab/endpoint"}}},
+			wantID:      "created",
+			wantCreated: 1,
+		},
+	}
+
+	for _, test := range tests {
+		provider := &fakeWebhookProvider{pageList: test.pageList}
+		webhookID, err := ensureRepositoryWebhook(context.Background(), provider, common.OauthContext{}, "https://gitlab.example.com", "1", callbackURL, nil)
+		if err != nil {
+			t.Fatalf("%q: ensureRepositoryWebhook() got error %v, want OK.", test.name, err)
+		}
+		if webhookID != test.wantID {
+			t.Errorf("%q: ensureRepositoryWebhook() got webhook ID %q, want %q.", test.name, webhookID, test.wantID)
+		}
+		if provider.created != test.wantCreated {
+			t.Errorf("%q: ensureRepositoryWebhook() created %d webhooks, want %d.", test.name, provider.created, test.wantCreated)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/db"
+	"github.com/bytebase/bytebase/plugin/vcs"
+)
+
+const (
+	// The migration version and description expanding the file path template in the preflight validation.
+	validationExampleVersion     = "202204150900"
+	validationExampleDescription = "preflight"
+)
+
+// ValidateAgainstDatabases runs the preflight validation of the repository config against the databases before enabling the sync,
+// i.e. the repository is reachable with the access token, and for each database the file path template expands, the migration
+// path maps to the database unambiguously and the schema path exists. It only reads from the VCS provider.
+// The database instances must be composed with their environments.
+func (s *Server) ValidateAgainstDatabases(ctx context.Context, repositoryID int, databaseList []*api.Database) (*api.FullValidationReport, error) {
+	repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ID: &repositoryID, IncludeSecrets: true})
+	if err != nil {
+		return nil, err
+	}
+	if repository == nil {
+		return nil, &common.Error{Code: common.NotFound, Err: fmt.Errorf("repository ID not found: %d", repositoryID)}
+	}
+	if err := s.composeRepositoryRelationship(ctx, repository); err != nil {
+		return nil, err
+	}
+
+	return validateAgainstDatabases(
+		ctx,
+		vcs.Get(repository.VCS.Type, s.vcsProviderConfig()),
+		common.OauthContext{
+			ClientID:     repository.VCS.ApplicationID,
+			ClientSecret: repository.VCS.Secret,
+			AccessToken:  repository.AccessToken,
+			RefreshToken: repository.RefreshToken,
+			Refresher:    s.refreshToken(ctx, repository),
+		},
+		repository,
+		databaseList,
+	), nil
+}
+
+// validateAgainstDatabases runs all the checks of the preflight validation and reports each of them, so a failed check
+// doesn't hide the others. The checks needing the VCS are skipped if the repository isn't reachable.
+// The repository must be composed with its VCS and project.
+func validateAgainstDatabases(ctx context.Context, provider vcs.Provider, oauthCtx common.OauthContext, repository *api.Repository, databaseList []*api.Database) *api.FullValidationReport {
+	report := &api.FullValidationReport{
+		RepositoryID: repository.ID,
+		CheckList:    []*api.RepositoryCheck{},
+	}
+
+	connectivity := checkRepositoryConnectivity(ctx, provider, oauthCtx, repository)
+	report.CheckList = append(report.CheckList, connectivity)
+
+	// The schema paths are checked at the branch the pushes are synced from.
+	var branch string
+	var branchErr error
+	if repository.SchemaPathTemplate != "" && connectivity.Status == api.RepositoryCheckPass {
+		branch, branchErr = resolveReplayBranch(repository, "")
+		if branchErr != nil {
+			branch, branchErr = provider.DefaultBranch(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID)
+		}
+	}
+
+	for _, database := range databaseList {
+		target := fmt.Sprintf("%s/%s", database.Instance.Environment.Name, database.Name)
+		expansion, migrationPath := checkPathExpansion(repository, database)
+		expansion.Database = target
+		report.CheckList = append(report.CheckList, expansion)
+
+		mapping := &api.RepositoryCheck{
+			Type:    api.RepositoryCheckDatabaseMapping,
+			Status:  api.RepositoryCheckSkip,
+			Message: "the file path template doesn't expand for the database",
+		}
+		if expansion.Status == api.RepositoryCheckPass {
+			mapping = checkDatabaseMapping(repository, database, migrationPath, databaseList)
+		}
+		mapping.Database = target
+		report.CheckList = append(report.CheckList, mapping)
+
+		if repository.SchemaPathTemplate == "" {
+			continue
+		}
+		schemaPath := &api.RepositoryCheck{
+			Type:     api.RepositoryCheckSchemaPath,
+			Database: target,
+		}
+		switch {
+		case connectivity.Status != api.RepositoryCheckPass:
+			schemaPath.Status = api.RepositoryCheckSkip
+			schemaPath.Message = "the repository isn't reachable"
+		case branchErr != nil:
+			schemaPath.Status = api.RepositoryCheckFail
+			schemaPath.Message = fmt.Sprintf("failed to resolve the branch to check the schema path: %v", branchErr)
+		default:
+			checkSchemaPath(ctx, provider, oauthCtx, repository, database, branch, schemaPath)
+		}
+		report.CheckList = append(report.CheckList, schemaPath)
+	}
+
+	report.Passed = true
+	for _, check := range report.CheckList {
+		if check.Status == api.RepositoryCheckFail {
+			report.Passed = false
+			break
+		}
+	}
+	return report
+}
+
+// checkRepositoryConnectivity checks the repository is reachable at the VCS with the access token.
+func checkRepositoryConnectivity(ctx context.Context, provider vcs.Provider, oauthCtx common.OauthContext, repository *api.Repository) *api.RepositoryCheck {
+	check := &api.RepositoryCheck{
+		Type:   api.RepositoryCheckConnectivity,
+		Status: api.RepositoryCheckFail,
+	}
+	exists, err := provider.RepositoryExists(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID)
+	switch {
+	case common.ErrorCode(err) == common.NotAuthorized:
+		check.Message = fmt.Sprintf("the access token is rejected, link the repository again: %v", err)
+	case err != nil:
+		check.Message = fmt.Sprintf("failed to reach the repository: %v", err)
+	case !exists:
+		check.Message = fmt.Sprintf("repository %q isn't found", repository.FullPath)
+	default:
+		check.Status = api.RepositoryCheckPass
+	}
+	return check
+}
+
+// checkPathExpansion checks the file path template expands for the database to the migration path parsed back to the database,
+// and returns the migration path if it passes.
+func checkPathExpansion(repository *api.Repository, database *api.Database) (*api.RepositoryCheck, string) {
+	check := &api.RepositoryCheck{
+		Type:   api.RepositoryCheckPathExpansion,
+		Status: api.RepositoryCheckFail,
+	}
+	environmentName := database.Instance.Environment.Name
+	migrationPath, err := api.FormatTemplate(repository.FilePathTemplate, map[string]string{
+		api.EnvironemntToken: environmentName,
+		api.DBNameToken:      database.Name,
+		"{{VERSION}}":        validationExampleVersion,
+		"{{TYPE}}":           db.Migrate.TemplateToken(),
+		"{{DESCRIPTION}}":    validationExampleDescription,
+	})
+	if err != nil {
+		check.Message = fmt.Sprintf("failed to expand file path template %q: %v", repository.FilePathTemplate, err)
+		return check, ""
+	}
+	migrationPath = path.Join(repository.BaseDirectory, migrationPath)
+	mi, err := db.ParseMigrationInfo(migrationPath, path.Join(repository.BaseDirectory, repository.FilePathTemplate))
+	if err != nil {
+		check.Message = fmt.Sprintf("expanded migration path %q isn't parsed back: %v", migrationPath, err)
+		return check, ""
+	}
+	// Environment name comparison is case insensitive.
+	if mi.Database != database.Name || (mi.Environment != "" && !strings.EqualFold(mi.Environment, environmentName)) {
+		check.Message = fmt.Sprintf("expanded migration path %q is parsed back to database %q in environment %q", migrationPath, mi.Database, mi.Environment)
+		return check, ""
+	}
+	check.Status = api.RepositoryCheckPass
+	return check, migrationPath
+}
+
+// checkDatabaseMapping checks the migration path of the database maps to the database only among databaseList.
+// The databases of the tenant mode project are mapped by the deployment config instead.
+func checkDatabaseMapping(repository *api.Repository, database *api.Database, migrationPath string, databaseList []*api.Database) *api.RepositoryCheck {
+	check := &api.RepositoryCheck{
+		Type:   api.RepositoryCheckDatabaseMapping,
+		Status: api.RepositoryCheckFail,
+	}
+	if repository.Project.TenantMode == api.TenantModeTenant {
+		check.Status = api.RepositoryCheckSkip
+		check.Message = "the databases of the tenant mode project are mapped by the deployment config"
+		return check
+	}
+	matched, err := api.MatchPathToDatabase(migrationPath, repository.FilePathTemplate, repository.BaseDirectory, databaseList)
+	switch {
+	case common.ErrorCode(err) == common.Conflict:
+		check.Message = fmt.Sprintf("ambiguous mapping: %v", err)
+	case err != nil:
+		check.Message = err.Error()
+	case matched.ID != database.ID:
+		check.Message = fmt.Sprintf("migration path %q maps to database ID %d instead", migrationPath, matched.ID)
+	default:
+		check.Status = api.RepositoryCheckPass
+	}
+	return check
+}
+
+// checkSchemaPath checks the schema path of the database exists at the branch, i.e. the schema file for the SINGLE_FILE
+// schema source or the schema directory for the DIRECTORY schema source.
+func checkSchemaPath(ctx context.Context, provider vcs.Provider, oauthCtx common.OauthContext, repository *api.Repository, database *api.Database, branch string, check *api.RepositoryCheck) {
+	schemaPath := composeSchemaPath(repository, database.Instance.Environment.Name, database.Name)
+	var err error
+	if repository.SchemaSourceType == api.SchemaSourceDirectory {
+		_, err = provider.ListFiles(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID, schemaPath, branch)
+	} else {
+		_, err = provider.ReadFileMeta(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID, schemaPath, branch)
+	}
+	switch {
+	case common.ErrorCode(err) == common.NotFound:
+		check.Status = api.RepositoryCheckFail
+		check.Message = fmt.Sprintf("schema path %q doesn't exist at branch %q", schemaPath, branch)
+	case err != nil:
+		check.Status = api.RepositoryCheckFail
+		check.Message = fmt.Sprintf("failed to check schema path %q at branch %q: %v", schemaPath, branch, err)
+	default:
+		check.Status = api.RepositoryCheckPass
+	}
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+)
+
+// fakeValidationProvider is a fake VCS provider serving whether the repository exists and the schema files at the branch.
+type fakeValidationProvider struct {
+	vcs.Provider
+	exists bool
+	err    error
+	// fileMap is keyed by "{{BRANCH}}:{{PATH}}".
+	fileMap map[string]bool
+}
+
+func (p *fakeValidationProvider) RepositoryExists(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string) (bool, error) {
+	return p.exists, p.err
+}
+
+func (p *fakeValidationProvider) ReadFileMeta(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, filePath string, branch string) (*vcs.FileMeta, error) {
+	if !p.fileMap[fmt.Sprintf("%s:%s", branch, filePath)] {
+		return nil, common.Errorf(common.NotFound, fmt.Errorf("file %s not found", filePath))
+	}
+	return &vcs.FileMeta{}, nil
+}
+
+func TestValidateAgainstDatabases(t *testing.T) {
+	newDatabase := func(id int, name string, environmentName string) *api.Database {
+		return &api.Database{
+			ID:   id,
+			Name: name,
+			Instance: &api.Instance{
+				Environment: &api.Environment{Name: environmentName},
+			},
+		}
+	}
+	// The dev/blog databases on two instances can't be told apart by the migration path.
+	// The database name "shop@v2" can't be parsed back from the migration path.
+	databaseList := []*api.Database{
+		newDatabase(1, "blog", "dev"),
+		newDatabase(2, "blog", "prod"),
+		newDatabase(3, "shop@v2", "dev"),
+		newDatabase(4, "blog", "dev"),
+	}
+	repository := &api.Repository{
+		ID:                 1,
+		Project:            &api.Project{TenantMode: api.TenantModeDisabled},
+		VCS:                &api.VCS{},
+		FullPath:           "bytebase/test",
+		BranchFilter:       "main",
+		BaseDirectory:      "bytebase",
+		FilePathTemplate:   "{{ENV_NAME}}/{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql",
+		SchemaPathTemplate: "{{ENV_NAME}}/.{{DB_NAME}}__LATEST.sql",
+	}
+	// Only the schema file of prod/blog is missing.
+	fileMap := map[string]bool{
+		"main:bytebase/dev/.blog__LATEST.sql":    true,
+		"main:bytebase/dev/.shop@v2__LATEST.sql": true,
+	}
+
+	type wantCheck struct {
+		checkType api.RepositoryCheckType
+		database  string
+		status    api.RepositoryCheckStatus
+	}
+	tests := []struct {
+		name     string
+		provider *fakeValidationProvider
+		want     []wantCheck
+	}{
+		{
+			name:     "reachable",
+			provider: &fakeValidationProvider{exists: true, fileMap: fileMap},
+			want: []wantCheck{
+				{api.RepositoryCheckConnectivity, "", api.RepositoryCheckPass},
+				{api.RepositoryCheckPathExpansion, "dev/blog", api.RepositoryCheckPass},
+				{api.RepositoryCheckDatabaseMapping, "dev/blog", api.RepositoryCheckFail},
+				{api.RepositoryCheckSchemaPath, "dev/blog", api.RepositoryCheckPass},
+				{api.RepositoryCheckPathExpansion, "prod/blog", api.RepositoryCheckPass},
+				{api.RepositoryCheckDatabaseMapping, "prod/blog", api.RepositoryCheckPass},
+				{api.RepositoryCheckSchemaPath, "prod/blog", api.RepositoryCheckFail},
+				{api.RepositoryCheckPathExpansion, "dev/shop@v2", api.RepositoryCheckFail},
+				{api.RepositoryCheckDatabaseMapping, "dev/shop@v2", api.RepositoryCheckSkip},
+				{api.RepositoryCheckSchemaPath, "dev/shop@v2", api.RepositoryCheckPass},
+				{api.RepositoryCheckPathExpansion, "dev/blog", api.RepositoryCheckPass},
+				{api.RepositoryCheckDatabaseMapping, "dev/blog", api.RepositoryCheckFail},
+				{api.RepositoryCheckSchemaPath, "dev/blog", api.RepositoryCheckPass},
+			},
+		},
+		{
+			// The checks not needing the VCS still run.
+			name:     "token rejected",
+			provider: &fakeValidationProvider{err: common.Errorf(common.NotAuthorized, errors.New("status code: 401"))},
+			want: []wantCheck{
+				{api.RepositoryCheckConnectivity, "", api.RepositoryCheckFail},
+				{api.RepositoryCheckPathExpansion, "dev/blog", api.RepositoryCheckPass},
+				{api.RepositoryCheckDatabaseMapping, "dev/blog", api.RepositoryCheckFail},
+				{api.RepositoryCheckSchemaPath, "dev/blog", api.RepositoryCheckSkip},
+				{api.RepositoryCheckPathExpansion, "prod/blog", api.RepositoryCheckPass},
+				{api.RepositoryCheckDatabaseMapping, "prod/blog", api.RepositoryCheckPass},
+				{api.RepositoryCheckSchemaPath, "prod/blog", api.RepositoryCheckSkip},
+				{api.RepositoryCheckPathExpansion, "dev/shop@v2", api.RepositoryCheckFail},
+				{api.RepositoryCheckDatabaseMapping, "dev/shop@v2", api.RepositoryCheckSkip},
+				{api.RepositoryCheckSchemaPath, "dev/shop@v2", api.RepositoryCheckSkip},
+				{api.RepositoryCheckPathExpansion, "dev/blog", api.RepositoryCheckPass},
+				{api.RepositoryCheckDatabaseMapping, "dev/blog", api.RepositoryCheckFail},
+				{api.RepositoryCheckSchemaPath, "dev/blog", api.RepositoryCheckSkip},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		report := validateAgainstDatabases(context.Background(), test.provider, common.OauthContext{}, repository, databaseList)
+		if report.Passed {
+			t.Errorf("%q: validateAgainstDatabases() got passed, want failed.", test.name)
+		}
+		if len(report.CheckList) != len(test.want) {
+			t.Fatalf("%q: validateAgainstDatabases() got %d checks, want %d.", test.name, len(report.CheckList), len(test.want))
+		}
+		for i, check := range report.CheckList {
+			got := wantCheck{check.Type, check.Database, check.Status}
+			if got != test.want[i] {
+				t.Errorf("%q: validateAgainstDatabases() got check %d %v (%s), want %v.", test.name, i, got, check.Message, test.want[i])
+			}
+			if check.Status != api.RepositoryCheckPass && check.Message == "" {
+				t.Errorf("%q: validateAgainstDatabases() got check %d %v without message.", test.name, i, got)
+			}
+		}
+	}
+
+	// All the checks pass once the ambiguous database and the database with the invalid name are excluded and the schema file is added.
+	fileMap["main:bytebase/prod/.blog__LATEST.sql"] = true
+	report := validateAgainstDatabases(context.Background(), &fakeValidationProvider{exists: true, fileMap: fileMap}, common.OauthContext{}, repository, databaseList[:2])
+	if !report.Passed {
+		t.Errorf("validateAgainstDatabases() got failed %+v, want passed.", report.CheckList)
+	}
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bytebase/bytebase/plugin/db/util"
+)
+
+var (
+	// schemaObjectDefinitionReg matches the schema object defined by the statement, e.g. "CREATE VIEW v AS ...".
+	schemaObjectDefinitionReg = regexp.MustCompile(`(?is)^CREATE\s+(?:OR\s+REPLACE\s+)?(?:(?:GLOBAL|LOCAL)\s+)?(?:(?:TEMP|TEMPORARY|UNLOGGED)\s+)?(TABLE|VIEW|MATERIALIZED\s+VIEW)\s+(?:IF\s+NOT\s+EXISTS\s+)?([\w."` + "`" + `]+)`)
+	// schemaObjectReferenceReg matches the schema objects referenced by the statement, e.g. "FROM t" and "REFERENCES t".
+	schemaObjectReferenceReg = regexp.MustCompile(`(?i)\b(?:FROM|JOIN|REFERENCES)\s+([\w."` + "`" + `]+)`)
+	// schemaStringLiteralReg matches the string literals, which may contain anything looking like a reference.
+	schemaStringLiteralReg = regexp.MustCompile(`'(?:[^']|'')*'`)
+)
+
+// schemaStatement is a statement of the schema file.
+type schemaStatement struct {
+	filePath  string
+	statement string
+}
+
+// schemaForwardReference is a statement referencing a schema object defined by a later statement.
+type schemaForwardReference struct {
+	// object is the schema object defined by the referencing statement, or the statement itself if it doesn't define one.
+	object             string
+	filePath           string
+	dependency         string
+	dependencyFilePath string
+}
+
+// schemaDependencyReport is the result of analyzing the dependencies among the schema objects of the baseline.
+type schemaDependencyReport struct {
+	forwardReferenceList []*schemaForwardReference
+	// cycle is the schema objects depending on each other in a circle, with the first one repeated at the end,
+	// e.g. ["a", "b", "a"]. A view selecting from itself is reported as ["v", "v"].
+	cycle []string
+	// suggestedOrder is the order of the defined schema objects resolving the forward references.
+	// It's empty if there is a cycle, since no order resolves it.
+	suggestedOrder []string
+}
+
+// splitSchemaStatementList splits the schema files into statements in the order of the files.
+func splitSchemaStatementList(filePathList []string, contentList []string) ([]*schemaStatement, error) {
+	var statementList []*schemaStatement
+	for i, filePath := range filePathList {
+		if err := util.ApplyMultiStatements(bufio.NewScanner(strings.NewReader(contentList[i])), func(stmt string) error {
+			statementList = append(statementList, &schemaStatement{filePath: filePath, statement: stmt})
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("failed to split schema file %q: %w", filePath, err)
+		}
+	}
+	return statementList, nil
+}
+
+// analyzeSchemaDependency analyzes the dependencies among the tables and views defined by the statements.
+// A statement depends on the schema objects it selects from, joins or references by a foreign key. Only the objects
+// defined by the statements themselves are considered, the rest are assumed to exist already.
+// Returns nil if every statement comes after its dependencies.
+func analyzeSchemaDependency(statementList []*schemaStatement) *schemaDependencyReport {
+	// definedMap maps the schema object name to the index of the statement defining it.
+	definedMap := make(map[string]int)
+	definedList := make([]string, len(statementList))
+	for i, stmt := range statementList {
+		match := schemaObjectDefinitionReg.FindStringSubmatch(stmt.statement)
+		if match == nil {
+			continue
+		}
+		name := normalizeSchemaObjectName(match[2])
+		if _, ok := definedMap[name]; !ok {
+			definedMap[name] = i
+			definedList[i] = name
+		}
+	}
+
+	// dependencyList is the indexes of the defining statements each statement depends on.
+	dependencyList := make([][]int, len(statementList))
+	for i, stmt := range statementList {
+		isTable := false
+		if match := schemaObjectDefinitionReg.FindStringSubmatch(stmt.statement); match != nil {
+			isTable = strings.EqualFold(match[1], "TABLE")
+		}
+		seen := make(map[int]bool)
+		for _, match := range schemaObjectReferenceReg.FindAllStringSubmatch(schemaStringLiteralReg.ReplaceAllString(stmt.statement, "''"), -1) {
+			j, ok := definedMap[normalizeSchemaObjectName(match[1])]
+			// A table referencing itself by a foreign key is fine.
+			if !ok || seen[j] || (j == i && isTable) {
+				continue
+			}
+			seen[j] = true
+			dependencyList[i] = append(dependencyList[i], j)
+		}
+		sort.Ints(dependencyList[i])
+	}
+
+	report := &schemaDependencyReport{}
+	for i, stmt := range statementList {
+		for _, j := range dependencyList[i] {
+			if j <= i {
+				continue
+			}
+			object := definedList[i]
+			if object == "" {
+				object = stmt.statement
+			}
+			report.forwardReferenceList = append(report.forwardReferenceList, &schemaForwardReference{
+				object:             object,
+				filePath:           stmt.filePath,
+				dependency:         definedList[j],
+				dependencyFilePath: statementList[j].filePath,
+			})
+		}
+	}
+
+	if cycle := findSchemaDependencyCycle(definedList, dependencyList); cycle != nil {
+		report.cycle = cycle
+		return report
+	}
+	if len(report.forwardReferenceList) == 0 {
+		return nil
+	}
+	report.suggestedOrder = orderSchemaObjectList(definedList, dependencyList)
+	return report
+}
+
+// findSchemaDependencyCycle returns the first dependency cycle among the defined schema objects, or nil if there is none.
+func findSchemaDependencyCycle(definedList []string, dependencyList [][]int) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(definedList))
+	var stack []int
+	var visit func(i int) []string
+	visit = func(i int) []string {
+		state[i] = visiting
+		stack = append(stack, i)
+		for _, j := range dependencyList[i] {
+			switch state[j] {
+			case visiting:
+				var cycle []string
+				for k := len(stack) - 1; k >= 0; k-- {
+					if stack[k] == j {
+						for _, index := range stack[k:] {
+							cycle = append(cycle, definedList[index])
+						}
+						break
+					}
+				}
+				return append(cycle, definedList[j])
+			case unvisited:
+				if cycle := visit(j); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[i] = visited
+		return nil
+	}
+	for i, name := range definedList {
+		if name == "" || state[i] != unvisited {
+			continue
+		}
+		if cycle := visit(i); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// orderSchemaObjectList returns the defined schema objects with every object after its dependencies.
+// The objects keep their original order unless they have to be moved. The dependencies must not have a cycle.
+func orderSchemaObjectList(definedList []string, dependencyList [][]int) []string {
+	var orderedList []string
+	placed := make([]bool, len(definedList))
+	var place func(i int)
+	place = func(i int) {
+		if placed[i] {
+			return
+		}
+		placed[i] = true
+		for _, j := range dependencyList[i] {
+			place(j)
+		}
+		orderedList = append(orderedList, definedList[i])
+	}
+	for i, name := range definedList {
+		if name != "" {
+			place(i)
+		}
+	}
+	return orderedList
+}
+
+// normalizeSchemaObjectName strips the quotes of the schema object name, and lowercases it.
+func normalizeSchemaObjectName(name string) string {
+	name = strings.TrimRight(name, ".")
+	return strings.ToLower(strings.NewReplacer(`"`, "", "`", "").Replace(name))
+}
+
+// schemaDependencyError returns the error describing the ordering problems in the report, so the baseline fails before
+// applying any statement.
+func schemaDependencyError(report *schemaDependencyReport) error {
+	if len(report.cycle) > 0 {
+		if len(report.cycle) == 2 {
+			return fmt.Errorf("schema object %q depends on itself", report.cycle[0])
+		}
+		return fmt.Errorf("schema objects depend on each other in a circle: %s", strings.Join(report.cycle, " -> "))
+	}
+	var referenceList []string
+	for _, reference := range report.forwardReferenceList {
+		referenceList = append(referenceList, fmt.Sprintf("%q in %q depends on %q defined later in %q", reference.object, reference.filePath, reference.dependency, reference.dependencyFilePath))
+	}
+	return fmt.Errorf("schema objects are defined after their dependents: %s; reorder the schema objects as: %s", strings.Join(referenceList, ", "), strings.Join(report.suggestedOrder, ", "))
+}
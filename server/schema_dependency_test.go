@@ -0,0 +1,80 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzeSchemaDependency(t *testing.T) {
+	tests := []struct {
+		name                 string
+		fileList             []string
+		contentList          []string
+		wantForwardReference []string
+		wantCycle            []string
+		wantSuggestedOrder   []string
+	}{
+		{
+			name:        "ordered dependencies",
+			fileList:    []string{"tables.sql", "views.sql"},
+			contentList: []string{"CREATE TABLE t (id INT, parent_id INT REFERENCES t(id));\n", "CREATE VIEW v AS SELECT * FROM t;\n"},
+		},
+		{
+			name:     "forward reference",
+			fileList: []string{"a_views.sql", "b_tables.sql"},
+			contentList: []string{
+				"CREATE VIEW active_user AS\nSELECT u.* FROM \"user\" u JOIN membership m ON u.id = m.user_id;\n",
+				"-- Tables.\nCREATE TABLE \"user\" (id INT);\nCREATE TABLE membership (user_id INT REFERENCES \"user\"(id), note TEXT DEFAULT 'from nowhere');\n",
+			},
+			wantForwardReference: []string{"active_user>user", "active_user>membership"},
+			wantSuggestedOrder:   []string{"user", "membership", "active_user"},
+		},
+		{
+			name:     "cycle",
+			fileList: []string{"views.sql"},
+			contentList: []string{
+				"CREATE TABLE t (id INT);\nCREATE VIEW a AS SELECT * FROM b;\nCREATE VIEW b AS SELECT * FROM c JOIN t ON c.id = t.id;\nCREATE VIEW c AS SELECT * FROM a;\n",
+			},
+			wantForwardReference: []string{"a>b", "b>c"},
+			wantCycle:            []string{"a", "b", "c", "a"},
+		},
+		{
+			name:        "self reference",
+			fileList:    []string{"views.sql"},
+			contentList: []string{"CREATE OR REPLACE VIEW v AS SELECT * FROM v;\n"},
+			wantCycle:   []string{"v", "v"},
+		},
+	}
+
+	for _, test := range tests {
+		statementList, err := splitSchemaStatementList(test.fileList, test.contentList)
+		if err != nil {
+			t.Errorf("%q: splitSchemaStatementList() got error %v.", test.name, err)
+			continue
+		}
+		report := analyzeSchemaDependency(statementList)
+		if test.wantForwardReference == nil && test.wantCycle == nil {
+			if report != nil {
+				t.Errorf("%q: analyzeSchemaDependency() got %+v, want nil.", test.name, report)
+			}
+			continue
+		}
+		if report == nil {
+			t.Errorf("%q: analyzeSchemaDependency() got nil, want a report.", test.name)
+			continue
+		}
+		var forwardReference []string
+		for _, reference := range report.forwardReferenceList {
+			forwardReference = append(forwardReference, reference.object+">"+reference.dependency)
+		}
+		if !reflect.DeepEqual(forwardReference, test.wantForwardReference) {
+			t.Errorf("%q: analyzeSchemaDependency() got forward references %v, want %v.", test.name, forwardReference, test.wantForwardReference)
+		}
+		if !reflect.DeepEqual(report.cycle, test.wantCycle) {
+			t.Errorf("%q: analyzeSchemaDependency() got cycle %v, want %v.", test.name, report.cycle, test.wantCycle)
+		}
+		if !reflect.DeepEqual(report.suggestedOrder, test.wantSuggestedOrder) {
+			t.Errorf("%q: analyzeSchemaDependency() got suggested order %v, want %v.", test.name, report.suggestedOrder, test.wantSuggestedOrder)
+		}
+	}
+}
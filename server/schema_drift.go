@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bytebase/bytebase/api"
+)
+
+// resolveSchemaDriftIssue creates the issue tracking the remediation of the schema drift of the database if the repository
+// of its project asks for it, and records the issue in the drift payload. The issue created for the active drift anomaly
+// is reused while it's open, so the drift persisting across the scans isn't tracked by duplicated issues.
+func (s *Server) resolveSchemaDriftIssue(ctx context.Context, database *api.Database, payload *api.AnomalyDatabaseSchemaDriftPayload) error {
+	repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ProjectID: &database.ProjectID})
+	if err != nil {
+		return fmt.Errorf("failed to find repository for project %d: %w", database.ProjectID, err)
+	}
+	if repository == nil || repository.DriftAction != api.DriftActionCreateIssue {
+		return nil
+	}
+
+	rowStatus := api.Normal
+	anomalyType := api.AnomalyDatabaseSchemaDrift
+	anomalyList, err := s.AnomalyService.FindAnomalyList(ctx, &api.AnomalyFind{
+		RowStatus:  &rowStatus,
+		DatabaseID: &database.ID,
+		Type:       &anomalyType,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find schema drift anomaly of database %q: %w", database.Name, err)
+	}
+	for _, anomaly := range anomalyList {
+		active := &api.AnomalyDatabaseSchemaDriftPayload{}
+		if err := json.Unmarshal([]byte(anomaly.Payload), active); err != nil {
+			return fmt.Errorf("failed to unmarshal schema drift anomaly payload %q: %w", anomaly.Payload, err)
+		}
+		if active.IssueID == 0 {
+			continue
+		}
+		issue, err := s.IssueService.FindIssue(ctx, &api.IssueFind{ID: &active.IssueID})
+		if err != nil {
+			return fmt.Errorf("failed to find schema drift issue %d: %w", active.IssueID, err)
+		}
+		if issue != nil && issue.Status == api.IssueOpen {
+			payload.IssueID = issue.ID
+			return nil
+		}
+	}
+
+	// The issue has nothing to run, so it's created with an empty pipeline rather than by createIssue generating the tasks.
+	pipeline, err := s.PipelineService.CreatePipeline(ctx, &api.PipelineCreate{
+		CreatorID: api.SystemBotID,
+		Name:      "Remediate schema drift",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create pipeline for schema drift issue: %w", err)
+	}
+	assigneeID := api.SystemBotID
+	if repository.DefaultAssigneeID != nil {
+		assigneeID = *repository.DefaultAssigneeID
+	}
+	issue, err := s.IssueService.CreateIssue(ctx, &api.IssueCreate{
+		CreatorID:   api.SystemBotID,
+		ProjectID:   database.ProjectID,
+		PipelineID:  pipeline.ID,
+		Name:        fmt.Sprintf("Schema drift detected on database %q", database.Name),
+		Type:        api.IssueGeneral,
+		Description: describeSchemaDrift(payload),
+		AssigneeID:  assigneeID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create schema drift issue: %w", err)
+	}
+	payload.IssueID = issue.ID
+	return nil
+}
+
+// describeSchemaDrift describes the objects drifted from the schema recorded by the migration of payload.Version.
+// The schemas are compared statement by statement, and each drifted object is named by the first line of its statement.
+func describeSchemaDrift(payload *api.AnomalyDatabaseSchemaDriftPayload) string {
+	expectSet := make(map[string]bool)
+	for _, statement := range splitSchemaStatements(payload.Expect) {
+		expectSet[statement] = true
+	}
+	actualSet := make(map[string]bool)
+	var unexpectedList []string
+	for _, statement := range splitSchemaStatements(payload.Actual) {
+		actualSet[statement] = true
+		if !expectSet[statement] {
+			unexpectedList = append(unexpectedList, "- "+firstLine(statement))
+		}
+	}
+	var missingList []string
+	for _, statement := range splitSchemaStatements(payload.Expect) {
+		if !actualSet[statement] {
+			missingList = append(missingList, "- "+firstLine(statement))
+		}
+	}
+
+	description := fmt.Sprintf("The schema drifted from the schema recorded by the migration version %s.", payload.Version)
+	if len(unexpectedList) > 0 {
+		description += fmt.Sprintf("\n\nObjects added or altered outside the migrations:\n%s", strings.Join(unexpectedList, "\n"))
+	}
+	if len(missingList) > 0 {
+		description += fmt.Sprintf("\n\nObjects expected by the migrations:\n%s", strings.Join(missingList, "\n"))
+	}
+	return description
+}
+
+// splitSchemaStatements splits the schema dump into the trimmed statements, skipping the comments.
+func splitSchemaStatements(schema string) []string {
+	var statementList []string
+	for _, statement := range strings.Split(schema, ";\n") {
+		var lineList []string
+		for _, line := range strings.Split(statement, "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+				lineList = append(lineList, line)
+			}
+		}
+		if len(lineList) > 0 {
+			statementList = append(statementList, strings.TrimSuffix(strings.Join(lineList, "\n"), ";"))
+		}
+	}
+	return statementList
+}
+
+func firstLine(s string) string {
+	if i := strings.Index(s, "\n"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+)
+
+// fakeAnomalyService serves the anomalies from memory.
+type fakeAnomalyService struct {
+	api.AnomalyService
+	anomalyList []*api.Anomaly
+}
+
+func (f *fakeAnomalyService) FindAnomalyList(ctx context.Context, find *api.AnomalyFind) ([]*api.Anomaly, error) {
+	var list []*api.Anomaly
+	for _, anomaly := range f.anomalyList {
+		if *anomaly.DatabaseID == *find.DatabaseID && anomaly.Type == *find.Type {
+			list = append(list, anomaly)
+		}
+	}
+	return list, nil
+}
+
+// fakeIssueService keeps the created issues in memory.
+type fakeIssueService struct {
+	api.IssueService
+	issueList []*api.Issue
+}
+
+func (f *fakeIssueService) CreateIssue(ctx context.Context, create *api.IssueCreate) (*api.Issue, error) {
+	issue := &api.Issue{
+		ID:          len(f.issueList) + 1,
+		ProjectID:   create.ProjectID,
+		PipelineID:  create.PipelineID,
+		Name:        create.Name,
+		Status:      api.IssueOpen,
+		Type:        create.Type,
+		Description: create.Description,
+		AssigneeID:  create.AssigneeID,
+	}
+	f.issueList = append(f.issueList, issue)
+	return issue, nil
+}
+
+func (f *fakeIssueService) FindIssue(ctx context.Context, find *api.IssueFind) (*api.Issue, error) {
+	for _, issue := range f.issueList {
+		if issue.ID == *find.ID {
+			return issue, nil
+		}
+	}
+	return nil, nil
+}
+
+// fakePipelineService creates the pipelines without keeping them.
+type fakePipelineService struct {
+	api.PipelineService
+	count int
+}
+
+func (f *fakePipelineService) CreatePipeline(ctx context.Context, create *api.PipelineCreate) (*api.Pipeline, error) {
+	f.count++
+	return &api.Pipeline{ID: f.count, Name: create.Name}, nil
+}
+
+func TestResolveSchemaDriftIssue(t *testing.T) {
+	ctx := context.Background()
+	database := &api.Database{ID: 1, ProjectID: 101, Name: "blog"}
+	newPayload := func() *api.AnomalyDatabaseSchemaDriftPayload {
+		return &api.AnomalyDatabaseSchemaDriftPayload{
+			Version: "202204150900",
+			Expect:  "CREATE TABLE `post` (\n  `id` int\n);\n",
+			Actual:  "CREATE TABLE `post` (\n  `id` int\n);\n\nCREATE TABLE `tmp` (\n  `id` int\n);\n",
+		}
+	}
+
+	tests := []struct {
+		name        string
+		driftAction api.DriftAction
+		wantIssue   bool
+	}{
+		{
+			name:        "anomaly only",
+			driftAction: api.DriftActionAnomalyOnly,
+			wantIssue:   false,
+		},
+		{
+			name:        "create issue",
+			driftAction: api.DriftActionCreateIssue,
+			wantIssue:   true,
+		},
+	}
+
+	for _, test := range tests {
+		issueService := &fakeIssueService{}
+		s := &Server{
+			RepositoryService: &fakeRepositoryService{repositoryList: []*api.Repository{{ID: 1, ProjectID: 101, DriftAction: test.driftAction}}},
+			AnomalyService:    &fakeAnomalyService{},
+			IssueService:      issueService,
+			PipelineService:   &fakePipelineService{},
+		}
+		payload := newPayload()
+		if err := s.resolveSchemaDriftIssue(ctx, database, payload); err != nil {
+			t.Fatalf("%q: resolveSchemaDriftIssue() got error %v, want OK.", test.name, err)
+		}
+		if got := len(issueService.issueList) > 0; got != test.wantIssue {
+			t.Fatalf("%q: resolveSchemaDriftIssue() created issue %v, want %v.", test.name, got, test.wantIssue)
+		}
+		if !test.wantIssue {
+			if payload.IssueID != 0 {
+				t.Errorf("%q: resolveSchemaDriftIssue() got issue ID %d, want 0.", test.name, payload.IssueID)
+			}
+			continue
+		}
+		issue := issueService.issueList[0]
+		if payload.IssueID != issue.ID || issue.ProjectID != database.ProjectID || issue.Type != api.IssueGeneral {
+			t.Errorf("%q: resolveSchemaDriftIssue() got issue %+v recorded as %d, want the general issue of project %d.", test.name, issue, payload.IssueID, database.ProjectID)
+		}
+		if !strings.Contains(issue.Description, "- CREATE TABLE `tmp` (") || strings.Contains(issue.Description, "`post`") {
+			t.Errorf("%q: resolveSchemaDriftIssue() got description %q, want the drifted table tmp only.", test.name, issue.Description)
+		}
+	}
+}
+
+func TestResolveSchemaDriftIssueNoDuplicate(t *testing.T) {
+	ctx := context.Background()
+	database := &api.Database{ID: 1, ProjectID: 101, Name: "blog"}
+	anomalyService := &fakeAnomalyService{}
+	issueService := &fakeIssueService{}
+	s := &Server{
+		RepositoryService: &fakeRepositoryService{repositoryList: []*api.Repository{{ID: 1, ProjectID: 101, DriftAction: api.DriftActionCreateIssue}}},
+		AnomalyService:    anomalyService,
+		IssueService:      issueService,
+		PipelineService:   &fakePipelineService{},
+	}
+	// scan resolves the issue of the drift detected by a scan and upserts the active anomaly like the anomaly scanner.
+	scan := func() int {
+		payload := &api.AnomalyDatabaseSchemaDriftPayload{Version: "202204150900", Expect: "CREATE TABLE `post` (`id` int);\n", Actual: ""}
+		if err := s.resolveSchemaDriftIssue(ctx, database, payload); err != nil {
+			t.Fatalf("resolveSchemaDriftIssue() got error %v, want OK.", err)
+		}
+		b, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatalf("json.Marshal() got error %v, want OK.", err)
+		}
+		anomalyService.anomalyList = []*api.Anomaly{{DatabaseID: &database.ID, Type: api.AnomalyDatabaseSchemaDrift, Payload: string(b)}}
+		return payload.IssueID
+	}
+
+	first := scan()
+	// The drift persisting to the next scan is tracked by the same open issue.
+	if second := scan(); second != first || len(issueService.issueList) != 1 {
+		t.Errorf("resolveSchemaDriftIssue() again got issue %d with %d issues, want issue %d only.", second, len(issueService.issueList), first)
+	}
+	// The issue is resolved while the drift remains, so the drift is tracked by a new issue.
+	issueService.issueList[0].Status = api.IssueDone
+	if third := scan(); third == first || len(issueService.issueList) != 2 {
+		t.Errorf("resolveSchemaDriftIssue() after resolving got issue %d with %d issues, want a new issue.", third, len(issueService.issueList))
+	}
+}
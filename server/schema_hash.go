@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/db"
+)
+
+// computeSchemaHash returns the hash of the schema file content. The line endings and the surrounding whitespace are
+// normalized, so the same schema checked out on different platforms has the same hash.
+func computeSchemaHash(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\r", "\n")
+	content = strings.TrimSpace(content)
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// composeSchemaSyncPath returns the path the schema of the baseline migration file added is synced from.
+// It's the schema directory for the DIRECTORY schema source, the schema file if the schema is read at the schema ref,
+// and the added file otherwise.
+func composeSchemaSyncPath(repository *api.Repository, mi *db.MigrationInfo, added string) string {
+	if repository.SchemaSourceType == api.SchemaSourceDirectory || (repository.SchemaRef != "" && repository.SchemaPathTemplate != "") {
+		return composeSchemaPath(repository, mi.Environment, mi.Database)
+	}
+	return added
+}
+
+// filterChangedSchemaDatabaseList returns the databases whose schema last synced from the path differs from the content,
+// so that the unchanged schema isn't applied again.
+func (s *Server) filterChangedSchemaDatabaseList(ctx context.Context, databaseList []*api.Database, path string, content string) ([]*api.Database, error) {
+	return filterChangedSchemaDatabaseList(databaseList, computeSchemaHash(content), func(databaseID int) (string, error) {
+		return s.RepositoryService.FindLastSyncedSchemaHash(ctx, databaseID, path)
+	})
+}
+
+func filterChangedSchemaDatabaseList(databaseList []*api.Database, hash string, findLastSyncedHash func(databaseID int) (string, error)) ([]*api.Database, error) {
+	var changedList []*api.Database
+	for _, database := range databaseList {
+		lastSyncedHash, err := findLastSyncedHash(database.ID)
+		if err != nil {
+			return nil, err
+		}
+		if lastSyncedHash != hash {
+			changedList = append(changedList, database)
+		}
+	}
+	return changedList, nil
+}
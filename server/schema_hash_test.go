@@ -0,0 +1,64 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+)
+
+func TestComputeSchemaHash(t *testing.T) {
+	want := computeSchemaHash("CREATE TABLE t1 (id INT);\nCREATE TABLE t2 (id INT);\n")
+	for _, content := range []string{
+		"CREATE TABLE t1 (id INT);\r\nCREATE TABLE t2 (id INT);\r\n",
+		"CREATE TABLE t1 (id INT);\rCREATE TABLE t2 (id INT);",
+		"\n\nCREATE TABLE t1 (id INT);\nCREATE TABLE t2 (id INT);\n\n",
+	} {
+		if got := computeSchemaHash(content); got != want {
+			t.Errorf("computeSchemaHash(%q) got %s, want %s.", content, got, want)
+		}
+	}
+	if got := computeSchemaHash("CREATE TABLE t1 (id BIGINT);\nCREATE TABLE t2 (id INT);\n"); got == want {
+		t.Errorf("computeSchemaHash() of the changed schema got %s, want different.", got)
+	}
+}
+
+func TestFilterChangedSchemaDatabaseList(t *testing.T) {
+	devBlog := &api.Database{ID: 1, Name: "blog"}
+	prodBlog := &api.Database{ID: 2, Name: "blog"}
+	schema := "CREATE TABLE post (id INT);\n"
+	// The schema was synced to the dev database, but not yet to the prod database.
+	lastSyncedHashMap := map[int]string{
+		devBlog.ID: computeSchemaHash(schema),
+	}
+	findLastSyncedHash := func(databaseID int) (string, error) {
+		return lastSyncedHashMap[databaseID], nil
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    []*api.Database
+	}{
+		{
+			name:    "unchanged schema skipped",
+			content: "CREATE TABLE post (id INT);\r\n",
+			want:    []*api.Database{prodBlog},
+		},
+		{
+			name:    "changed schema processed",
+			content: "CREATE TABLE post (id INT, title TEXT);\n",
+			want:    []*api.Database{devBlog, prodBlog},
+		},
+	}
+
+	for _, test := range tests {
+		databaseList, err := filterChangedSchemaDatabaseList([]*api.Database{devBlog, prodBlog}, computeSchemaHash(test.content), findLastSyncedHash)
+		if err != nil {
+			t.Fatalf("%q: filterChangedSchemaDatabaseList() got error %v, want OK.", test.name, err)
+		}
+		if !reflect.DeepEqual(databaseList, test.want) {
+			t.Errorf("%q: filterChangedSchemaDatabaseList() got %v, want %v.", test.name, databaseList, test.want)
+		}
+	}
+}
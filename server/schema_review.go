@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/advisor"
+	"github.com/bytebase/bytebase/plugin/db"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"github.com/bytebase/bytebase/plugin/vcs/gitlab"
+)
+
+// schemaReviewFile is the schema review result of a migration file in the merge request.
+type schemaReviewFile struct {
+	path       string
+	adviceList []advisor.Advice
+	// skipReason is the reason the file isn't reviewed, e.g. no database matching the file.
+	skipReason string
+}
+
+// isSchemaReviewAction returns true if the merge request action changes the migration files to review.
+func isSchemaReviewAction(action string) bool {
+	switch action {
+	case "open", "reopen", "update":
+		return true
+	}
+	return false
+}
+
+// reviewMergeRequest reviews the migration files added by the merge request against its target branch at the last commit,
+// and posts the result as the schema review comment on the merge request. Nothing is posted if the merge request adds
+// no migration file.
+func (s *Server) reviewMergeRequest(ctx context.Context, repository *api.Repository, mergeRequest gitlab.WebhookMergeRequestAttributes) error {
+	if mergeRequest.LastCommit.ID == "" {
+		return nil
+	}
+	provider := vcs.Get(repository.VCS.Type, s.vcsProviderConfig())
+	oauthCtx := common.OauthContext{
+		ClientID:     repository.VCS.ApplicationID,
+		ClientSecret: repository.VCS.Secret,
+		AccessToken:  repository.AccessToken,
+		RefreshToken: repository.RefreshToken,
+		Refresher:    s.refreshToken(ctx, repository),
+	}
+	addedList, err := fetchMergeRequestAddedList(ctx, provider, oauthCtx, repository, mergeRequest.IID)
+	if err != nil {
+		return err
+	}
+
+	var fileList []*schemaReviewFile
+	for _, added := range addedList {
+		mi, err := db.ParseMigrationInfo(added, filepath.Join(repository.BaseDirectory, repository.FilePathTemplate))
+		if err != nil || mi.Type != db.Migrate || isIgnoredPath(repository, added, s.l) {
+			continue
+		}
+		file := &schemaReviewFile{path: added}
+		fileList = append(fileList, file)
+
+		content, err := provider.ReadFile(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID, added, mergeRequest.LastCommit.ID)
+		if err != nil {
+			file.skipReason = fmt.Sprintf("failed to read the file, %s", err.Error())
+			continue
+		}
+		databaseList, err := s.composeDatabaseListByFind(ctx, &api.DatabaseFind{
+			ProjectID: &repository.ProjectID,
+			Name:      &mi.Database,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to find the databases matching file %q: %w", added, err)
+		}
+		if len(databaseList) == 0 {
+			file.skipReason = fmt.Sprintf("no database %q in the project", mi.Database)
+			continue
+		}
+		// The databases of the same name are expected to share the engine, so the first one is reviewed against.
+		database := databaseList[0]
+		if database.Instance.Engine != db.MySQL && database.Instance.Engine != db.TiDB {
+			file.skipReason = fmt.Sprintf("schema review isn't supported for %s", database.Instance.Engine)
+			continue
+		}
+		file.adviceList, err = advisor.Check(
+			database.Instance.Engine,
+			advisor.MySQLMigrationCompatibility,
+			advisor.Context{
+				Logger:    s.l,
+				Charset:   database.CharacterSet,
+				Collation: database.Collation,
+			},
+			content,
+		)
+		if err != nil {
+			file.skipReason = fmt.Sprintf("failed to review the statement, %s", err.Error())
+		}
+	}
+	if len(fileList) == 0 {
+		return nil
+	}
+
+	return s.createOrUpdateSchemaReviewComment(ctx, repository, mergeRequest.IID, composeSchemaReviewComment(mergeRequest.LastCommit.ID, fileList))
+}
+
+// fetchMergeRequestAddedList returns the paths of the files under the base directory added by the merge request across all its commits.
+func fetchMergeRequestAddedList(ctx context.Context, provider vcs.Provider, oauthCtx common.OauthContext, repository *api.Repository, mergeRequestID int) ([]string, error) {
+	fileList, err := provider.MergeRequestDiff(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID, mergeRequestID, vcs.NormalizePathPrefix(repository.BaseDirectory))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the files changed by merge request !%d under base directory %q: %w", mergeRequestID, repository.BaseDirectory, err)
+	}
+	var addedList []string
+	for _, file := range fileList {
+		if file.Added {
+			addedList = append(addedList, file.Path)
+		}
+	}
+	return addedList, nil
+}
+
+// composeSchemaReviewComment composes the markdown body of the schema review comment for the files reviewed at the commit.
+func composeSchemaReviewComment(commitID string, fileList []*schemaReviewFile) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "### Bytebase schema review\n\nReviewed at commit %s.\n", commitID)
+	for _, file := range fileList {
+		fmt.Fprintf(&sb, "\n#### %s\n\n", file.path)
+		if file.skipReason != "" {
+			fmt.Fprintf(&sb, "- Skipped, %s.\n", file.skipReason)
+			continue
+		}
+		for _, advice := range file.adviceList {
+			fmt.Fprintf(&sb, "- **%s** %s: %s\n", advice.Status, advice.Title, advice.Content)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/advisor"
+	"github.com/bytebase/bytebase/plugin/vcs"
+)
+
+func TestComposeSchemaReviewComment(t *testing.T) {
+	fileList := []*schemaReviewFile{
+		{
+			path: "bytebase/blog__202101131000__migrate__drop_users.sql",
+			adviceList: []advisor.Advice{
+				{Status: advisor.Warn, Code: common.CompatibilityDropTable, Title: "Incompatible migration", Content: `"DROP TABLE users" may cause incompatibility with the existing data and code`},
+			},
+		},
+		{
+			path: "bytebase/blog__202101131001__migrate__add_posts.sql",
+			adviceList: []advisor.Advice{
+				{Status: advisor.Success, Code: common.Ok, Title: "OK", Content: "Migration is backward compatible"},
+			},
+		},
+		{
+			path:       "bytebase/shop__202101131002__migrate__add_orders.sql",
+			skipReason: `no database "shop" in the project`,
+		},
+	}
+	want := "### Bytebase schema review\n\nReviewed at commit abc.\n" +
+		"\n#### bytebase/blog__202101131000__migrate__drop_users.sql\n\n" +
+		"- **WARN** Incompatible migration: \"DROP TABLE users\" may cause incompatibility with the existing data and code\n" +
+		"\n#### bytebase/blog__202101131001__migrate__add_posts.sql\n\n" +
+		"- **INFO** OK: Migration is backward compatible\n" +
+		"\n#### bytebase/shop__202101131002__migrate__add_orders.sql\n\n" +
+		"- Skipped, no database \"shop\" in the project.\n"
+	if got := composeSchemaReviewComment("abc", fileList); got != want {
+		t.Errorf("got comment %q, want %q.", got, want)
+	}
+}
+
+func TestIsSchemaReviewAction(t *testing.T) {
+	tests := []struct {
+		action string
+		want   bool
+	}{
+		{action: "open", want: true},
+		{action: "reopen", want: true},
+		{action: "update", want: true},
+		{action: "close", want: false},
+		{action: "merge", want: false},
+		{action: "approved", want: false},
+	}
+	for _, test := range tests {
+		if got := isSchemaReviewAction(test.action); got != test.want {
+			t.Errorf("%q: got %v, want %v.", test.action, got, test.want)
+		}
+	}
+}
+
+// fakeMergeRequestDiffProvider is the provider returning the files changed by the merge request 7 across its commits.
+type fakeMergeRequestDiffProvider struct {
+	vcs.Provider
+	fileList []*vcs.ChangedFile
+}
+
+func (p *fakeMergeRequestDiffProvider) MergeRequestDiff(_ context.Context, _ common.OauthContext, _ string, _ string, mergeRequestID int, pathPrefix string) ([]*vcs.ChangedFile, error) {
+	if mergeRequestID != 7 {
+		return nil, common.Errorf(common.NotFound, fmt.Errorf("merge request !%d not found", mergeRequestID))
+	}
+	return vcs.FilterChangedFileList(p.fileList, pathPrefix), nil
+}
+
+func TestFetchMergeRequestAddedList(t *testing.T) {
+	provider := &fakeMergeRequestDiffProvider{
+		fileList: []*vcs.ChangedFile{
+			// Added by the earlier commit of the merge request.
+			{Path: "bytebase/prod/blog__202204150930__migrate__add_users.sql", Added: true},
+			// Added by the last commit of the merge request.
+			{Path: "bytebase/prod/blog__202204150931__migrate__add_posts.sql", Added: true},
+			{Path: "bytebase/prod/.blog__LATEST.sql"},
+			{Path: "README.md", Added: true},
+		},
+	}
+	repository := &api.Repository{
+		BaseDirectory: "bytebase",
+		VCS:           &api.VCS{},
+	}
+	got, err := fetchMergeRequestAddedList(context.Background(), provider, common.OauthContext{}, repository, 7)
+	if err != nil {
+		t.Fatalf("fetchMergeRequestAddedList() got error %v, want OK.", err)
+	}
+	want := []string{
+		"bytebase/prod/blog__202204150930__migrate__add_users.sql",
+		"bytebase/prod/blog__202204150931__migrate__add_posts.sql",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fetchMergeRequestAddedList() got %v, want %v.", got, want)
+	}
+
+	if _, err := fetchMergeRequestAddedList(context.Background(), provider, common.OauthContext{}, repository, 8); common.ErrorCode(err) != common.NotFound {
+		t.Errorf("fetchMergeRequestAddedList() got error %v, want not found.", err)
+	}
+}
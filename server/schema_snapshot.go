@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/db"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"go.uber.org/zap"
+)
+
+// snapshotSchemaOnApply commits the schema dump of the database back to the schema path in the repository linked to
+// the project after the migration issued from the UI applies, if the repository opts in by the schema snapshot on apply,
+// so the repository stays the source of truth of the schema. The migration is already applied, so the failure is only logged.
+func (s *Server) snapshotSchemaOnApply(ctx context.Context, task *api.Task, issue *api.Issue, mi *db.MigrationInfo, schema string, bytebaseURL string) {
+	repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ProjectID: &task.Database.ProjectID, IncludeSecrets: true})
+	if err != nil {
+		s.l.Error("Failed to find the linked repository for the schema snapshot on apply", zap.Int("task_id", task.ID), zap.Error(err))
+		return
+	}
+	if repository == nil || !repository.SchemaSnapshotOnApply || repository.SchemaPathTemplate == "" || repository.SchemaSourceType == api.SchemaSourceDirectory {
+		return
+	}
+	repository.VCS, err = s.composeVCSByID(ctx, repository.VCSID)
+	if err != nil {
+		s.l.Error("Failed to fetch VCS for the schema snapshot on apply", zap.Int("task_id", task.ID), zap.Error(err))
+		return
+	}
+	if repository.VCS == nil {
+		s.l.Error("VCS not found for the schema snapshot on apply", zap.Int("task_id", task.ID), zap.Int("vcs_id", repository.VCSID))
+		return
+	}
+
+	provider, oauthCtx := s.schemaSourceProvider(ctx, repository)
+	// The schema is committed to the branch the pushes are synced from.
+	branch, err := resolveReplayBranch(repository, "")
+	if err != nil {
+		branch, err = provider.DefaultBranch(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID)
+		if err != nil {
+			s.l.Error("Failed to resolve the branch for the schema snapshot on apply", zap.Int("task_id", task.ID), zap.Error(err))
+			return
+		}
+	}
+	schemaPath := composeSchemaPath(repository, task.Instance.Environment.Name, task.Database.Name)
+
+	message := fmt.Sprintf("[Bytebase] Update latest schema for %q after migration %s\n\nTHIS COMMIT IS AUTO-GENERATED BY BYTEBASE", mi.Database, mi.Version)
+	if bytebaseURL != "" {
+		message += "\n\n" + bytebaseURL
+	}
+	commitID, err := commitSchemaSnapshot(ctx, provider, oauthCtx, repository, branch, schemaPath, schema, message)
+	if err != nil {
+		s.l.Error("Failed to commit the schema snapshot on apply",
+			zap.Int("task_id", task.ID),
+			zap.String("repository", repository.WebURL),
+			zap.String("file_path", schemaPath),
+			zap.Error(err),
+		)
+		return
+	}
+	if commitID == "" {
+		s.l.Debug("Skipped the schema snapshot on apply since the schema is unchanged",
+			zap.Int("task_id", task.ID),
+			zap.String("file_path", schemaPath),
+		)
+		return
+	}
+
+	payload, err := json.Marshal(api.ActivityPipelineTaskFileCommitPayload{
+		TaskID:             task.ID,
+		VCSInstanceURL:     repository.VCS.InstanceURL,
+		RepositoryFullPath: repository.FullPath,
+		Branch:             branch,
+		FilePath:           schemaPath,
+		CommitID:           commitID,
+	})
+	if err != nil {
+		s.l.Error("Failed to marshal file commit activity after the schema snapshot on apply", zap.Int("task_id", task.ID), zap.Error(err))
+		return
+	}
+	containerID := task.PipelineID
+	if issue != nil {
+		containerID = issue.ID
+	}
+	activityCreate := &api.ActivityCreate{
+		CreatorID:   task.CreatorID,
+		ContainerID: containerID,
+		Type:        api.ActivityPipelineTaskFileCommit,
+		Level:       api.ActivityInfo,
+		Comment:     fmt.Sprintf("Committed the latest schema after applying migration version %s to %q.", mi.Version, mi.Database),
+		Payload:     string(payload),
+	}
+	if _, err := s.ActivityManager.CreateActivity(ctx, activityCreate, &ActivityMeta{}); err != nil {
+		s.l.Error("Failed to create file commit activity after the schema snapshot on apply", zap.Int("task_id", task.ID), zap.Error(err))
+	}
+}
+
+// commitSchemaSnapshot commits the schema to the schema path at the branch as the commit author of the repository,
+// creating the schema file if it doesn't exist. Returns the commit ID, or empty if the committed schema is unchanged,
+// in which case nothing is committed, since the empty commit only adds noise to the history.
+func commitSchemaSnapshot(ctx context.Context, provider vcs.Provider, oauthCtx common.OauthContext, repository *api.Repository, branch string, schemaPath string, schema string, message string) (string, error) {
+	action := vcs.FileChangeUpdate
+	content, err := provider.ReadFile(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID, schemaPath, branch)
+	switch {
+	case common.ErrorCode(err) == common.NotFound:
+		action = vcs.FileChangeCreate
+	case err != nil:
+		return "", fmt.Errorf("failed to read schema file %q at branch %q: %w", schemaPath, branch, err)
+	case computeSchemaHash(content) == computeSchemaHash(schema):
+		return "", nil
+	}
+
+	commitID, err := provider.CreateCommit(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID, branch, message,
+		[]vcs.FileChange{
+			{
+				Action:   action,
+				FilePath: schemaPath,
+				Content:  schema,
+			},
+		},
+		vcs.Author{
+			Name:  repository.CommitAuthorName,
+			Email: repository.CommitAuthorEmail,
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to commit schema file %q to branch %q: %w", schemaPath, branch, err)
+	}
+	return commitID, nil
+}
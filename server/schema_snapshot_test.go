@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+)
+
+// fakeSnapshotProvider is a fake VCS provider serving the files at the branch and recording the commits.
+type fakeSnapshotProvider struct {
+	vcs.Provider
+	// fileMap is keyed by "{{BRANCH}}:{{PATH}}".
+	fileMap    map[string]string
+	commitList []fakeSnapshotCommit
+}
+
+type fakeSnapshotCommit struct {
+	branch     string
+	fileChange vcs.FileChange
+	author     vcs.Author
+}
+
+func (p *fakeSnapshotProvider) ReadFile(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, filePath string, commitID string) (string, error) {
+	content, ok := p.fileMap[fmt.Sprintf("%s:%s", commitID, filePath)]
+	if !ok {
+		return "", common.Errorf(common.NotFound, fmt.Errorf("file %s not found", filePath))
+	}
+	return content, nil
+}
+
+func (p *fakeSnapshotProvider) CreateCommit(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, branch string, message string, fileChangeList []vcs.FileChange, author vcs.Author) (string, error) {
+	for _, fileChange := range fileChangeList {
+		p.commitList = append(p.commitList, fakeSnapshotCommit{branch: branch, fileChange: fileChange, author: author})
+		p.fileMap[fmt.Sprintf("%s:%s", branch, fileChange.FilePath)] = fileChange.Content
+	}
+	return fmt.Sprintf("commit%d", len(p.commitList)), nil
+}
+
+func TestCommitSchemaSnapshot(t *testing.T) {
+	repository := &api.Repository{
+		VCS:               &api.VCS{},
+		CommitAuthorName:  "Bytebase",
+		CommitAuthorEmail: "bytebase@example.com",
+	}
+	const schemaPath = "bytebase/prod/.blog__LATEST.sql"
+
+	tests := []struct {
+		name string
+		// committed is the schema file at the branch, empty if it doesn't exist.
+		committed    string
+		schema       string
+		wantCommitID string
+		wantAction   vcs.FileChangeAction
+	}{
+		{
+			name:         "create the schema file",
+			schema:       "CREATE TABLE t (id INT);\n",
+			wantCommitID: "commit1",
+			wantAction:   vcs.FileChangeCreate,
+		},
+		{
+			name:         "update the changed schema",
+			committed:    "CREATE TABLE t (id INT);\n",
+			schema:       "CREATE TABLE t (id INT, name TEXT);\n",
+			wantCommitID: "commit1",
+			wantAction:   vcs.FileChangeUpdate,
+		},
+		{
+			name:      "skip the unchanged schema",
+			committed: "CREATE TABLE t (id INT);\n",
+			schema:    "CREATE TABLE t (id INT);\n",
+		},
+		{
+			name:      "skip the schema only differing in the line endings",
+			committed: "CREATE TABLE t (id INT);\r\n",
+			schema:    "CREATE TABLE t (id INT);\n\n",
+		},
+	}
+
+	for _, test := range tests {
+		provider := &fakeSnapshotProvider{fileMap: map[string]string{}}
+		if test.committed != "" {
+			provider.fileMap["main:"+schemaPath] = test.committed
+		}
+		commitID, err := commitSchemaSnapshot(context.Background(), provider, common.OauthContext{}, repository, "main", schemaPath, test.schema, "Update schema")
+		if err != nil {
+			t.Errorf("%q: commitSchemaSnapshot() got error %v, want OK.", test.name, err)
+			continue
+		}
+		if commitID != test.wantCommitID {
+			t.Errorf("%q: commitSchemaSnapshot() got commit ID %q, want %q.", test.name, commitID, test.wantCommitID)
+		}
+		if test.wantCommitID == "" {
+			if len(provider.commitList) != 0 {
+				t.Errorf("%q: commitSchemaSnapshot() got %d commits, want none.", test.name, len(provider.commitList))
+			}
+			continue
+		}
+		if len(provider.commitList) != 1 {
+			t.Errorf("%q: commitSchemaSnapshot() got %d commits, want 1.", test.name, len(provider.commitList))
+			continue
+		}
+		want := fakeSnapshotCommit{
+			branch: "main",
+			fileChange: vcs.FileChange{
+				Action:   test.wantAction,
+				FilePath: schemaPath,
+				Content:  test.schema,
+			},
+			author: vcs.Author{Name: "Bytebase", Email: "bytebase@example.com"},
+		}
+		if got := provider.commitList[0]; got != want {
+			t.Errorf("%q: commitSchemaSnapshot() got commit %+v, want %+v.", test.name, got, want)
+		}
+	}
+}
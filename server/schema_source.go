@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"github.com/bytebase/bytebase/plugin/vcs/gitlab"
+)
+
+// composeSchemaPath returns the path of the latest schema of the database in the repository.
+// It's a file for the SINGLE_FILE schema source and a directory for the DIRECTORY schema source.
+func composeSchemaPath(repository *api.Repository, environmentName string, databaseName string) string {
+	schemaPath := filepath.Join(repository.BaseDirectory, repository.SchemaPathTemplate)
+	schemaPath = strings.ReplaceAll(schemaPath, "{{ENV_NAME}}", environmentName)
+	schemaPath = strings.ReplaceAll(schemaPath, "{{DB_NAME}}", databaseName)
+	return schemaPath
+}
+
+// readSchemaDirectory reads the schema files in the directory at the commit and concatenates them to form the database baseline.
+func (s *Server) readSchemaDirectory(ctx context.Context, repository *api.Repository, directory string, commitID string) (string, error) {
+	provider, oauthCtx := s.schemaSourceProvider(ctx, repository)
+	return readSchemaDirectory(ctx, provider, oauthCtx, repository, directory, commitID)
+}
+
+// readSchemaAtRef reads the schema of the database baseline at the schema ref of the repository instead of the pushed commit,
+// e.g. at the release tag. schemaPath is the schema file for the SINGLE_FILE schema source and the schema directory for the
+// DIRECTORY schema source.
+func (s *Server) readSchemaAtRef(ctx context.Context, repository *api.Repository, schemaPath string) (string, error) {
+	provider, oauthCtx := s.schemaSourceProvider(ctx, repository)
+	return readSchemaAtRef(ctx, provider, oauthCtx, repository, schemaPath)
+}
+
+func (s *Server) schemaSourceProvider(ctx context.Context, repository *api.Repository) (vcs.Provider, common.OauthContext) {
+	return vcs.Get(repository.VCS.Type, s.vcsProviderConfig()), common.OauthContext{
+		ClientID:     repository.VCS.ApplicationID,
+		ClientSecret: repository.VCS.Secret,
+		AccessToken:  repository.AccessToken,
+		RefreshToken: repository.RefreshToken,
+		Refresher:    s.refreshToken(ctx, repository),
+	}
+}
+
+func readSchemaDirectory(ctx context.Context, provider vcs.Provider, oauthCtx common.OauthContext, repository *api.Repository, directory string, commitID string) (string, error) {
+	filePathList, err := provider.ListFiles(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID, directory, commitID)
+	if err != nil {
+		return "", err
+	}
+	return concatSchemaFileList(directory, filePathList, func(filePath string) (string, error) {
+		return provider.ReadFile(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID, filePath, commitID)
+	})
+}
+
+func readSchemaAtRef(ctx context.Context, provider vcs.Provider, oauthCtx common.OauthContext, repository *api.Repository, schemaPath string) (string, error) {
+	commitID, err := resolveSchemaRef(ctx, provider, oauthCtx, repository)
+	if err != nil {
+		return "", err
+	}
+	if repository.SchemaSourceType == api.SchemaSourceDirectory {
+		return readSchemaDirectory(ctx, provider, oauthCtx, repository, schemaPath, commitID)
+	}
+	content, err := provider.ReadFile(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID, schemaPath, commitID)
+	if common.ErrorCode(err) == common.NotFound {
+		return "", common.Errorf(common.NotFound, fmt.Errorf("schema file %q doesn't exist at schema ref %q", schemaPath, repository.SchemaRef))
+	}
+	return content, err
+}
+
+// resolveSchemaRef resolves the schema ref of the repository, i.e. a branch, a tag or a commit SHA, to the commit SHA,
+// so that all the schema files are read at the same commit even if the branch moves in between.
+func resolveSchemaRef(ctx context.Context, provider vcs.Provider, oauthCtx common.OauthContext, repository *api.Repository) (string, error) {
+	ref := strings.TrimPrefix(repository.SchemaRef, "refs/heads/")
+	ref = strings.TrimPrefix(ref, gitlab.TagRefPrefix)
+	commit, err := provider.FetchCommit(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID, ref)
+	if err != nil {
+		if common.ErrorCode(err) == common.NotFound {
+			return "", common.Errorf(common.NotFound, fmt.Errorf("schema ref %q isn't found as a branch, tag or commit in repository %s", repository.SchemaRef, repository.FullPath))
+		}
+		return "", fmt.Errorf("failed to resolve schema ref %q: %w", repository.SchemaRef, err)
+	}
+	return commit.ID, nil
+}
+
+// concatSchemaFileList concatenates the schema files in the directory in the order of orderSchemaFileList.
+// Returns error if a schema object is defined after the statements depending on it, or the schema objects depend on
+// each other in a circle, so the baseline fails before applying any statement rather than in the middle.
+func concatSchemaFileList(directory string, filePathList []string, readFile func(filePath string) (string, error)) (string, error) {
+	orderedFilePathList, err := orderSchemaFileList(directory, filePathList, readFile)
+	if err != nil {
+		return "", err
+	}
+
+	var contentList []string
+	var schema strings.Builder
+	for _, filePath := range orderedFilePathList {
+		content, err := readFile(filePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read schema file %q: %w", filePath, err)
+		}
+		contentList = append(contentList, content)
+		schema.WriteString(content)
+		// Make sure the last statement of a file isn't joined with the first statement of the next file.
+		if !strings.HasSuffix(content, "\n") {
+			schema.WriteString("\n")
+		}
+	}
+
+	statementList, err := splitSchemaStatementList(orderedFilePathList, contentList)
+	if err != nil {
+		return "", err
+	}
+	if report := analyzeSchemaDependency(statementList); report != nil {
+		return "", schemaDependencyError(report)
+	}
+	return schema.String(), nil
+}
+
+// orderSchemaFileList returns the .sql schema files in the directory in the order of concatenation.
+// The order matters because a schema object may depend on another, e.g. a view depends on its tables.
+// If the directory contains the api.SchemaDirectoryIndexFile, the files are ordered as listed by it, one file name per line.
+// Empty lines and lines starting with "#" are skipped. Every schema file must be listed exactly once, so a newly added
+// file isn't silently dropped from the baseline. Otherwise, the files are ordered alphabetically.
+func orderSchemaFileList(directory string, filePathList []string, readFile func(filePath string) (string, error)) ([]string, error) {
+	indexFilePath := path.Join(directory, api.SchemaDirectoryIndexFile)
+	hasIndex := false
+	schemaFileMap := make(map[string]bool)
+	var schemaFilePathList []string
+	for _, filePath := range filePathList {
+		if filePath == indexFilePath {
+			hasIndex = true
+			continue
+		}
+		if strings.HasSuffix(filePath, ".sql") {
+			schemaFileMap[filePath] = true
+			schemaFilePathList = append(schemaFilePathList, filePath)
+		}
+	}
+
+	if !hasIndex {
+		sort.Strings(schemaFilePathList)
+		return schemaFilePathList, nil
+	}
+
+	index, err := readFile(indexFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema index file %q: %w", indexFilePath, err)
+	}
+	var orderedFilePathList []string
+	listed := make(map[string]bool)
+	for _, line := range strings.Split(index, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		filePath := path.Join(directory, line)
+		if !schemaFileMap[filePath] {
+			return nil, fmt.Errorf("schema file %q listed in the index file %q is not found", line, indexFilePath)
+		}
+		if listed[filePath] {
+			return nil, fmt.Errorf("schema file %q is listed more than once in the index file %q", line, indexFilePath)
+		}
+		listed[filePath] = true
+		orderedFilePathList = append(orderedFilePathList, filePath)
+	}
+	for _, filePath := range schemaFilePathList {
+		if !listed[filePath] {
+			return nil, fmt.Errorf("schema file %q is not listed in the index file %q", filePath, indexFilePath)
+		}
+	}
+	return orderedFilePathList, nil
+}
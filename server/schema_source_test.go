@@ -0,0 +1,254 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+)
+
+// fakeSchemaRefProvider is a fake VCS provider resolving the refs to the commits and serving the files at the commits.
+type fakeSchemaRefProvider struct {
+	vcs.Provider
+	// commitMap maps the branch, tag or commit SHA to the commit SHA.
+	commitMap map[string]string
+	// fileMap is keyed by "{{COMMIT}}:{{PATH}}".
+	fileMap map[string]string
+}
+
+func (p *fakeSchemaRefProvider) FetchCommit(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, commitID string) (*vcs.Commit, error) {
+	id, ok := p.commitMap[commitID]
+	if !ok {
+		return nil, common.Errorf(common.NotFound, fmt.Errorf("commit %s not found", commitID))
+	}
+	return &vcs.Commit{ID: id}, nil
+}
+
+func (p *fakeSchemaRefProvider) ReadFile(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, filePath string, commitID string) (string, error) {
+	content, ok := p.fileMap[fmt.Sprintf("%s:%s", commitID, filePath)]
+	if !ok {
+		return "", common.Errorf(common.NotFound, fmt.Errorf("file %s not found", filePath))
+	}
+	return content, nil
+}
+
+func (p *fakeSchemaRefProvider) ListFiles(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, directory string, commitID string) ([]string, error) {
+	var filePathList []string
+	for key := range p.fileMap {
+		if strings.HasPrefix(key, fmt.Sprintf("%s:%s/", commitID, directory)) {
+			filePathList = append(filePathList, strings.TrimPrefix(key, commitID+":"))
+		}
+	}
+	return filePathList, nil
+}
+
+func TestReadSchemaAtRef(t *testing.T) {
+	// The release tag v1.0 points to an older commit than the main branch.
+	provider := &fakeSchemaRefProvider{
+		commitMap: map[string]string{
+			"v1.0":    "1111111",
+			"main":    "2222222",
+			"1111111": "1111111",
+			"2222222": "2222222",
+		},
+		fileMap: map[string]string{
+			"1111111:bytebase/prod/.blog__LATEST.sql":  "CREATE TABLE t (id INT);\n",
+			"2222222:bytebase/prod/.blog__LATEST.sql":  "CREATE TABLE t (id INT, name TEXT);\n",
+			"1111111:bytebase/prod/blog/tables.sql":    "CREATE TABLE t (id INT);\n",
+			"2222222:bytebase/prod/blog/tables.sql":    "CREATE TABLE t (id INT, name TEXT);\n",
+			"2222222:bytebase/prod/blog/functions.sql": "CREATE FUNCTION f() RETURNS INT AS 'SELECT 1' LANGUAGE SQL;\n",
+		},
+	}
+
+	tests := []struct {
+		name             string
+		schemaRef        string
+		schemaSourceType api.SchemaSourceType
+		schemaPath       string
+		want             string
+		wantCode         common.Code
+	}{
+		{
+			name:             "tag",
+			schemaRef:        "v1.0",
+			schemaSourceType: api.SchemaSourceSingleFile,
+			schemaPath:       "bytebase/prod/.blog__LATEST.sql",
+			want:             "CREATE TABLE t (id INT);\n",
+		},
+		{
+			name:             "fully qualified tag",
+			schemaRef:        "refs/tags/v1.0",
+			schemaSourceType: api.SchemaSourceSingleFile,
+			schemaPath:       "bytebase/prod/.blog__LATEST.sql",
+			want:             "CREATE TABLE t (id INT);\n",
+		},
+		{
+			name:             "branch",
+			schemaRef:        "main",
+			schemaSourceType: api.SchemaSourceSingleFile,
+			schemaPath:       "bytebase/prod/.blog__LATEST.sql",
+			want:             "CREATE TABLE t (id INT, name TEXT);\n",
+		},
+		{
+			name:             "fully qualified branch",
+			schemaRef:        "refs/heads/main",
+			schemaSourceType: api.SchemaSourceSingleFile,
+			schemaPath:       "bytebase/prod/.blog__LATEST.sql",
+			want:             "CREATE TABLE t (id INT, name TEXT);\n",
+		},
+		{
+			name:             "commit SHA",
+			schemaRef:        "1111111",
+			schemaSourceType: api.SchemaSourceSingleFile,
+			schemaPath:       "bytebase/prod/.blog__LATEST.sql",
+			want:             "CREATE TABLE t (id INT);\n",
+		},
+		{
+			name:             "directory at tag",
+			schemaRef:        "v1.0",
+			schemaSourceType: api.SchemaSourceDirectory,
+			schemaPath:       "bytebase/prod/blog",
+			want:             "CREATE TABLE t (id INT);\n",
+		},
+		{
+			name:             "directory at branch",
+			schemaRef:        "main",
+			schemaSourceType: api.SchemaSourceDirectory,
+			schemaPath:       "bytebase/prod/blog",
+			want:             "CREATE FUNCTION f() RETURNS INT AS 'SELECT 1' LANGUAGE SQL;\nCREATE TABLE t (id INT, name TEXT);\n",
+		},
+		{
+			name:             "nonexistent ref",
+			schemaRef:        "v2.0",
+			schemaSourceType: api.SchemaSourceSingleFile,
+			schemaPath:       "bytebase/prod/.blog__LATEST.sql",
+			wantCode:         common.NotFound,
+		},
+		{
+			name:             "schema file missing at ref",
+			schemaRef:        "v1.0",
+			schemaSourceType: api.SchemaSourceSingleFile,
+			schemaPath:       "bytebase/prod/.shop__LATEST.sql",
+			wantCode:         common.NotFound,
+		},
+	}
+
+	for _, test := range tests {
+		repository := &api.Repository{
+			VCS:              &api.VCS{},
+			FullPath:         "bytebase/test",
+			SchemaRef:        test.schemaRef,
+			SchemaSourceType: test.schemaSourceType,
+		}
+		got, err := readSchemaAtRef(context.Background(), provider, common.OauthContext{}, repository, test.schemaPath)
+		if test.wantCode != common.Ok {
+			if code := common.ErrorCode(err); code != test.wantCode {
+				t.Errorf("%q: readSchemaAtRef() got error %v, want code %d.", test.name, err, test.wantCode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: readSchemaAtRef() got error %v, want OK.", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q: readSchemaAtRef() got %q, want %q.", test.name, got, test.want)
+		}
+	}
+
+	// The nonexistent ref is reported by its name.
+	_, err := readSchemaAtRef(context.Background(), provider, common.OauthContext{}, &api.Repository{VCS: &api.VCS{}, FullPath: "bytebase/test", SchemaRef: "v2.0"}, "bytebase/prod/.blog__LATEST.sql")
+	if want := `schema ref "v2.0" isn't found as a branch, tag or commit in repository bytebase/test`; err == nil || err.Error() != want {
+		t.Errorf("readSchemaAtRef() got error %v, want %q.", err, want)
+	}
+}
+
+func TestConcatSchemaFileList(t *testing.T) {
+	const directory = "bytebase/prod/blog"
+	fileContentMap := map[string]string{
+		"bytebase/prod/blog/functions.sql": "CREATE FUNCTION f() RETURNS INT AS 'SELECT 1' LANGUAGE SQL;",
+		"bytebase/prod/blog/tables.sql":    "CREATE TABLE t (id INT);\n",
+		"bytebase/prod/blog/views.sql":     "CREATE VIEW v AS SELECT * FROM t;\n",
+		"bytebase/prod/blog/README.md":     "The schema of the blog database.\n",
+	}
+
+	tests := []struct {
+		name    string
+		index   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "alphabetical order without the index file",
+			want: "CREATE FUNCTION f() RETURNS INT AS 'SELECT 1' LANGUAGE SQL;\n" +
+				"CREATE TABLE t (id INT);\n" +
+				"CREATE VIEW v AS SELECT * FROM t;\n",
+		},
+		{
+			name:  "index file order",
+			index: "# Tables first since the views depend on them.\ntables.sql\n\nviews.sql\nfunctions.sql\n",
+			want: "CREATE TABLE t (id INT);\n" +
+				"CREATE VIEW v AS SELECT * FROM t;\n" +
+				"CREATE FUNCTION f() RETURNS INT AS 'SELECT 1' LANGUAGE SQL;\n",
+		},
+		{
+			name:    "schema file missing from the index file",
+			index:   "tables.sql\nviews.sql\n",
+			wantErr: true,
+		},
+		{
+			name:    "index file listing a nonexistent file",
+			index:   "tables.sql\nviews.sql\nfunctions.sql\nprocedures.sql\n",
+			wantErr: true,
+		},
+		{
+			name:    "index file ordering the views before their tables",
+			index:   "views.sql\ntables.sql\nfunctions.sql\n",
+			wantErr: true,
+		},
+		{
+			name:    "index file listing a file twice",
+			index:   "tables.sql\nviews.sql\nfunctions.sql\ntables.sql\n",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		contentMap := make(map[string]string)
+		for filePath, content := range fileContentMap {
+			contentMap[filePath] = content
+		}
+		if test.index != "" {
+			contentMap["bytebase/prod/blog/index.txt"] = test.index
+		}
+		// The VCS lists the files in an arbitrary order.
+		filePathList := []string{
+			"bytebase/prod/blog/views.sql",
+			"bytebase/prod/blog/README.md",
+			"bytebase/prod/blog/tables.sql",
+			"bytebase/prod/blog/functions.sql",
+		}
+		if test.index != "" {
+			filePathList = append(filePathList, "bytebase/prod/blog/index.txt")
+		}
+
+		got, err := concatSchemaFileList(directory, filePathList, func(filePath string) (string, error) {
+			content, ok := contentMap[filePath]
+			if !ok {
+				return "", fmt.Errorf("file %q not found", filePath)
+			}
+			return content, nil
+		})
+		if (err != nil) != test.wantErr {
+			t.Errorf("%q: concatSchemaFileList() got error %v, want error %v.", test.name, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q: concatSchemaFileList() got %q, want %q.", test.name, got, test.want)
+		}
+	}
+}
@@ -15,10 +15,13 @@ import (
 
 	"github.com/bytebase/bytebase/api"
 	enterprise "github.com/bytebase/bytebase/enterprise/api"
+	"github.com/bytebase/bytebase/plugin/vcs"
 	"github.com/casbin/casbin/v2"
 	"github.com/casbin/casbin/v2/model"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	scas "github.com/qiangmzsx/string-adapter/v2"
 	"go.uber.org/zap"
 )
@@ -26,12 +29,16 @@ import (
 // Server is the Bytebase server.
 type Server struct {
 	// Asynchronous runners.
-	TaskScheduler      *TaskScheduler
-	TaskCheckScheduler *TaskCheckScheduler
-	SchemaSyncer       *SchemaSyncer
-	BackupRunner       *BackupRunner
-	AnomalyScanner     *AnomalyScanner
-	runnerWG           sync.WaitGroup
+	TaskScheduler             *TaskScheduler
+	TaskCheckScheduler        *TaskCheckScheduler
+	SchemaSyncer              *SchemaSyncer
+	BackupRunner              *BackupRunner
+	AnomalyScanner            *AnomalyScanner
+	WebhookRetrier            *WebhookRetrier
+	TokenRefresher            *TokenRefresher
+	RepositoryCleaner         *RepositoryCleaner
+	RepositoryProviderChecker *RepositoryProviderChecker
+	runnerWG                  sync.WaitGroup
 
 	ActivityManager *ActivityManager
 
@@ -64,6 +71,7 @@ type Server struct {
 	InboxService            api.InboxService
 	BookmarkService         api.BookmarkService
 	VCSService              api.VCSService
+	VCSOAuthService         api.VCSOAuthService
 	RepositoryService       api.RepositoryService
 	AnomalyService          api.AnomalyService
 	LabelService            api.LabelService
@@ -87,6 +95,54 @@ type Server struct {
 	demo         bool
 	dataDir      string
 	subscription *enterprise.Subscription
+
+	// maintenanceMode defers the VCS webhook events until the maintenance ends, see SetMaintenanceMode.
+	maintenanceMu            sync.Mutex
+	maintenanceMode          bool
+	deferredWebhookEventList []*deferredWebhookEvent
+
+	// pushOrder keeps the push events for the same branch processed in order.
+	pushOrder pushOrderTracker
+
+	// syncLeaseOwner identifies this replica holding the lease of the repository sync, see claimRepositorySync.
+	syncLeaseOwner       string
+	syncClaimBackoffList []time.Duration
+
+	// webhookRoutes routes the webhook events by the endpoint ID, warmed up in Run.
+	webhookRoutes webhookRouteMap
+
+	// syncMetrics is the Prometheus metrics of syncing the pushes to the repositories, served by the metrics endpoint.
+	syncMetrics *syncMetrics
+	// repositoryStatusMetricsRefreshC requests refreshing the status gauge of syncMetrics, see requestRepositoryStatusMetricsRefresh.
+	repositoryStatusMetricsRefreshC chan struct{}
+
+	// repositoryCleanupGracePeriod is the grace window of the deferred repository cleanup, see SetRepositoryCleanupGracePeriod.
+	repositoryCleanupGracePeriod time.Duration
+
+	// webhookMaxBodySize is the maximum size in bytes of the webhook request body, see SetWebhookMaxBodySize.
+	webhookMaxBodySize int64
+
+	// vcsMaxFileSize is the maximum size in bytes of a file read from the VCS, see SetVCSMaxFileSize.
+	vcsMaxFileSize int64
+
+	// webhookHostResolver resolves the logical webhook host keys, see SetWebhookHostResolver.
+	webhookHostResolver WebhookHostResolver
+
+	// databaseResolver resolves the databases the pushed migration files apply to, see SetDatabaseResolver.
+	databaseResolver DatabaseResolver
+
+	// taskErrorClassifier decides the errors retried by the task retry policy, see SetTaskErrorClassifier.
+	taskErrorClassifier TaskErrorClassifier
+	// taskRetryPolicy is the retry policy of the tasks created by the pushes, see SetTaskRetryPolicy.
+	taskRetryPolicy *api.TaskRetryPolicy
+
+	// assigneeResolver resolves the assignee of the issues created by the pushes, see SetAssigneeResolver.
+	assigneeResolver AssigneeResolver
+	// ownerRotation assigns the project owners in turn by the default assignee resolver.
+	ownerRotation ownerRotation
+
+	// querySessions limits the query sessions running concurrently in the SQL console by the plan.
+	querySessions querySessionTracker
 }
 
 //go:embed acl_casbin_model.conf
@@ -131,7 +187,17 @@ func NewServer(logger *zap.Logger, loggerLevel *zap.AtomicLevel, version string,
 		readonly:     readonly,
 		demo:         demo,
 		dataDir:      dataDir,
+
+		webhookMaxBodySize: DefaultWebhookMaxBodySize,
+		vcsMaxFileSize:     vcs.DefaultMaxFileSize,
+
+		syncLeaseOwner:       uuid.New().String(),
+		syncClaimBackoffList: defaultRepositorySyncClaimBackoffList,
 	}
+	// The assignee resolver of the issues created by the pushes.
+	s.SetAssigneeResolver(newMemberAssigneeResolver(s))
+	// The classifier of the transient task errors retried by the task retry policy.
+	s.SetTaskErrorClassifier(lockErrorClassifier{})
 
 	if !readonly {
 		// Task scheduler
@@ -184,13 +250,25 @@ func NewServer(logger *zap.Logger, loggerLevel *zap.AtomicLevel, version string,
 
 		// Anomaly scanner
 		s.AnomalyScanner = NewAnomalyScanner(logger, s)
+
+		// Webhook retrier
+		s.WebhookRetrier = NewWebhookRetrier(logger, s)
+
+		// Token refresher
+		s.TokenRefresher = NewTokenRefresher(logger, s)
+
+		// Repository cleaner
+		s.RepositoryCleaner = NewRepositoryCleaner(logger, s)
+
+		// Repository provider checker
+		s.RepositoryProviderChecker = NewRepositoryProviderChecker(logger, s)
 	}
 
 	// Middleware
 	if mode == "dev" || debug {
 		e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
 			Skipper: func(c echo.Context) bool {
-				return !common.HasPrefixes(c.Path(), "/api", "/hook")
+				return !common.HasPrefixes(c.Path(), "/api", webhookGroupPath)
 			},
 			Format: `{"time":"${time_rfc3339}",` +
 				`"method":"${method}","uri":"${uri}",` +
@@ -201,7 +279,12 @@ func NewServer(logger *zap.Logger, loggerLevel *zap.AtomicLevel, version string,
 		return recoverMiddleware(logger, next)
 	})
 
-	webhookGroup := e.Group("/hook")
+	// The metrics endpoint is scraped by Prometheus without the principal.
+	s.syncMetrics = newSyncMetrics()
+	s.repositoryStatusMetricsRefreshC = make(chan struct{}, 1)
+	e.GET("/metrics", echo.WrapHandler(promhttp.HandlerFor(s.syncMetrics.registry, promhttp.HandlerOpts{})))
+
+	webhookGroup := e.Group(webhookGroupPath)
 	s.registerWebhookRoutes(webhookGroup)
 
 	apiGroup := e.Group("/api")
@@ -223,6 +306,7 @@ func NewServer(logger *zap.Logger, loggerLevel *zap.AtomicLevel, version string,
 		return aclMiddleware(logger, s, ce, next, readonly)
 	})
 	s.registerDebugRoutes(apiGroup)
+	s.registerMaintenanceRoutes(apiGroup)
 	s.registerSettingRoutes(apiGroup)
 	s.registerActuatorRoutes(apiGroup)
 	s.registerAuthRoutes(apiGroup)
@@ -264,6 +348,10 @@ func (server *Server) InitSubscription() {
 
 // Run will run the server.
 func (server *Server) Run(ctx context.Context) error {
+	server.refreshWebhookRoutes(ctx)
+	server.refreshRepositoryStatusMetrics(ctx)
+	go server.runRepositoryStatusMetrics(ctx, &server.runnerWG)
+	server.runnerWG.Add(1)
 	if !server.readonly {
 		// runnerWG waits for all goroutines to complete.
 		go server.TaskScheduler.Run(ctx, &server.runnerWG)
@@ -276,6 +364,14 @@ func (server *Server) Run(ctx context.Context) error {
 		server.runnerWG.Add(1)
 		go server.AnomalyScanner.Run(ctx, &server.runnerWG)
 		server.runnerWG.Add(1)
+		go server.WebhookRetrier.Run(ctx, &server.runnerWG)
+		server.runnerWG.Add(1)
+		go server.TokenRefresher.Run(ctx, &server.runnerWG)
+		server.runnerWG.Add(1)
+		go server.RepositoryCleaner.Run(ctx, &server.runnerWG)
+		server.runnerWG.Add(1)
+		go server.RepositoryProviderChecker.Run(ctx, &server.runnerWG)
+		server.runnerWG.Add(1)
 	}
 
 	// Sleep for 1 sec to make sure port is released between runs.
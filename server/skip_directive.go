@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/vcs/gitlab"
+	"go.uber.org/zap"
+)
+
+// headCommit returns the head commit of the push event, i.e. the commit the ref is pushed to.
+// It falls back to the last listed commit if the head commit isn't listed. Returns nil if no commit is listed.
+func headCommit(pushEvent *gitlab.WebhookPushEvent) *gitlab.WebhookCommit {
+	for i := range pushEvent.CommitList {
+		if pushEvent.CommitList[i].ID == pushEvent.After {
+			return &pushEvent.CommitList[i]
+		}
+	}
+	if len(pushEvent.CommitList) == 0 {
+		return nil
+	}
+	return &pushEvent.CommitList[len(pushEvent.CommitList)-1]
+}
+
+// hasSkipDirective returns true if the commit message contains the skip directive, case-insensitively.
+// The empty directive never matches.
+func hasSkipDirective(message string, directive string) bool {
+	if directive == "" {
+		return false
+	}
+	return strings.Contains(strings.ToLower(message), strings.ToLower(directive))
+}
+
+// findSkippingCommit returns the head commit of the push event if its message contains the skip directive of the repository,
+// in which case the whole push event is skipped, analogous to "[skip ci]". Returns nil otherwise.
+func findSkippingCommit(repository *api.Repository, pushEvent *gitlab.WebhookPushEvent) *gitlab.WebhookCommit {
+	commit := headCommit(pushEvent)
+	if commit == nil || !hasSkipDirective(commit.Message, repository.SkipDirective) {
+		return nil
+	}
+	return commit
+}
+
+// recordSkippedPushEvent records the push event skipped by the directive in the head commit in a project activity,
+// so that it can be audited why the committed files aren't applied.
+func (s *Server) recordSkippedPushEvent(ctx context.Context, repository *api.Repository, pushEvent *gitlab.WebhookPushEvent, commit *gitlab.WebhookCommit) {
+	s.l.Info("Skipped push event by the skip directive in the head commit.",
+		zap.String("ref", pushEvent.Ref),
+		zap.String("commit", commit.ID),
+		zap.String("skip_directive", repository.SkipDirective),
+	)
+	createdTime, _ := time.Parse(time.RFC3339, commit.Timestamp)
+	bytes, err := json.Marshal(api.ActivityProjectRepositoryPushPayload{
+		VCSPushEvent: composeVCSPushEvent(repository, pushEvent, *commit, "", createdTime),
+	})
+	if err != nil {
+		s.l.Warn("Failed to construct project activity payload to record skipped push event", zap.Error(err))
+		return
+	}
+	activityCreate := &api.ActivityCreate{
+		CreatorID:   api.SystemBotID,
+		ContainerID: repository.ProjectID,
+		Type:        api.ActivityProjectRepositoryPush,
+		Level:       api.ActivityInfo,
+		Comment:     fmt.Sprintf("Skipped push to %s since the head commit %s contains the skip directive %q. Its committed files are ignored.", pushEvent.Ref, commit.ID, repository.SkipDirective),
+		Payload:     string(bytes),
+	}
+	if _, err := s.ActivityManager.CreateActivity(ctx, activityCreate, &ActivityMeta{}); err != nil {
+		s.l.Warn("Failed to create project activity to record skipped push event", zap.Error(err))
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/vcs/gitlab"
+)
+
+func TestFindSkippingCommit(t *testing.T) {
+	tests := []struct {
+		name          string
+		skipDirective string
+		commitList    []gitlab.WebhookCommit
+		after         string
+		want          string
+	}{
+		{
+			name:          "head commit with directive skipped",
+			skipDirective: api.DefaultRepositorySkipDirective,
+			commitList: []gitlab.WebhookCommit{
+				{ID: "c1", Message: "Add the post table"},
+				{ID: "c2", Message: "Fix the comment typo [skip bytebase]\n"},
+			},
+			after: "c2",
+			want:  "c2",
+		},
+		{
+			name:          "directive matched case-insensitively",
+			skipDirective: api.DefaultRepositorySkipDirective,
+			commitList: []gitlab.WebhookCommit{
+				{ID: "c1", Message: "Fix the comment typo\n\n[Skip Bytebase]"},
+			},
+			after: "c1",
+			want:  "c1",
+		},
+		{
+			name:          "head commit without directive processed",
+			skipDirective: api.DefaultRepositorySkipDirective,
+			commitList: []gitlab.WebhookCommit{
+				{ID: "c1", Message: "Fix the comment typo [skip bytebase]"},
+				{ID: "c2", Message: "Add the post table"},
+			},
+			after: "c2",
+			want:  "",
+		},
+		{
+			name:          "configured directive",
+			skipDirective: "[no migrate]",
+			commitList: []gitlab.WebhookCommit{
+				{ID: "c1", Message: "Fix the comment typo [skip bytebase]"},
+				{ID: "c2", Message: "Fix the comment typo [no migrate]"},
+			},
+			after: "c1",
+			want:  "",
+		},
+		{
+			name:          "head commit not listed",
+			skipDirective: "[no migrate]",
+			commitList: []gitlab.WebhookCommit{
+				{ID: "c1", Message: "Fix the comment typo [no migrate]"},
+			},
+			after: "c9",
+			want:  "c1",
+		},
+		{
+			name:          "empty directive never skips",
+			skipDirective: "",
+			commitList: []gitlab.WebhookCommit{
+				{ID: "c1", Message: "Fix the comment typo [skip bytebase]"},
+			},
+			after: "c1",
+			want:  "",
+		},
+	}
+
+	for _, test := range tests {
+		repository := &api.Repository{SkipDirective: test.skipDirective}
+		pushEvent := &gitlab.WebhookPushEvent{
+			After:      test.after,
+			CommitList: test.commitList,
+		}
+		got := ""
+		if commit := findSkippingCommit(repository, pushEvent); commit != nil {
+			got = commit.ID
+		}
+		if got != test.want {
+			t.Errorf("%q: findSkippingCommit() got commit %q, want %q.", test.name, got, test.want)
+		}
+	}
+}
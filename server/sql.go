@@ -116,6 +116,15 @@ func (s *Server) registerSQLRoutes(g *echo.Group) {
 			return echo.NewHTTPError(http.StatusBadRequest, "Malformatted sql execute request, only support SELECT sql statement")
 		}
 
+		if !s.feature(api.FeatureQueryConsole) {
+			return echo.NewHTTPError(http.StatusForbidden, api.FeatureQueryConsole.AccessErrorMessage())
+		}
+		done, err := s.querySessions.begin(s.getEffectivePlan())
+		if err != nil {
+			return echo.NewHTTPError(http.StatusTooManyRequests, err.Error())
+		}
+		defer done()
+
 		instance, err := s.composeInstanceByID(ctx, exec.InstanceID)
 		if err != nil {
 			if common.ErrorCode(err) == common.NotFound {
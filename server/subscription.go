@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -21,6 +22,20 @@ func (s *Server) registerSubscriptionRoutes(g *echo.Group) {
 		return nil
 	})
 
+	g.GET("/subscription/feature-usage", func(c echo.Context) error {
+		ctx := context.Background()
+		report, err := s.getFeatureUsageReport(ctx)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to compose feature usage report").SetInternal(err)
+		}
+
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+		if err := jsonapi.MarshalPayload(c.Response().Writer, report); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to marshal feature usage report response").SetInternal(err)
+		}
+		return nil
+	})
+
 	g.PATCH("/subscription", func(c echo.Context) error {
 		patch := &enterpriseAPI.SubscriptionPatch{}
 		if err := jsonapi.UnmarshalPayload(c.Request().Body, patch); err != nil {
@@ -53,11 +68,12 @@ func (s *Server) loadSubscription() *enterpriseAPI.Subscription {
 	license, _ := s.loadLicense()
 	if license != nil {
 		subscription = &enterpriseAPI.Subscription{
-			Plan:          license.Plan,
-			ExpiresTs:     license.ExpiresTs,
-			StartedTs:     license.IssuedTs,
-			InstanceCount: license.InstanceCount,
-			Trialing:      license.Trialing,
+			Plan:             license.Plan,
+			ExpiresTs:        license.ExpiresTs,
+			StartedTs:        license.IssuedTs,
+			InstanceCount:    license.InstanceCount,
+			Trialing:         license.Trialing,
+			FeatureOverrides: license.FeatureOverrides,
 		}
 	}
 
@@ -81,14 +97,34 @@ func (s *Server) loadLicense() (*enterpriseAPI.License, error) {
 		zap.String("plan", license.Plan.String()),
 		zap.Time("expiresAt", time.Unix(license.ExpiresTs, 0)),
 		zap.Int("instanceCount", license.InstanceCount),
+		zap.String("workspaceID", license.WorkspaceID),
 	)
 
 	return license, nil
 }
 
 func (s *Server) feature(feature api.FeatureType) bool {
+	return s.getPlan().GateInfo(feature).Enabled
+}
+
+// IsFeatureEnabled returns true if the current subscription enables the feature.
+func (s *Server) IsFeatureEnabled(feature api.FeatureType) bool {
+	return s.feature(feature)
+}
+
+// getPlan returns the plan of the subscription with the feature overrides granted by the license,
+// or FREE without any override if the subscription has expired.
+func (s *Server) getPlan() api.Plan {
 	if expireTime := time.Unix(s.subscription.ExpiresTs, 0); expireTime.Before(time.Now()) {
-		return api.FeatureMatrix[feature][api.FREE]
+		return api.Plan{Type: api.FREE}
 	}
-	return api.FeatureMatrix[feature][s.subscription.Plan]
+	return api.Plan{
+		Type:             s.subscription.Plan,
+		FeatureOverrides: s.subscription.FeatureOverrides,
+	}
+}
+
+// getEffectivePlan returns the plan of the subscription, or FREE if the subscription has expired.
+func (s *Server) getEffectivePlan() api.PlanType {
+	return s.getPlan().Type
 }
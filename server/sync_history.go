@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/vcs/gitlab"
+	"go.uber.org/zap"
+)
+
+// defaultSyncHistoryLimit is the number of the sync history entries returned if the limit isn't specified.
+const defaultSyncHistoryLimit = 20
+
+// recordSyncHistory appends the sync of the push to the ref started at startedTime to the sync history of the repository,
+// and records it in the sync metrics.
+// We just emit the error on failure since it's not critical enough to fail the sync.
+func (s *Server) recordSyncHistory(ctx context.Context, repositoryID int, ref string, commitID string, startedTime time.Time, result api.RepositorySyncResult, detail string) {
+	if err := s.RepositoryService.AppendSyncHistory(ctx, &api.SyncHistoryEntryCreate{
+		RepositoryID: repositoryID,
+		Ref:          ref,
+		CommitID:     commitID,
+		Result:       result,
+		Detail:       detail,
+		StartedTs:    startedTime.Unix(),
+		DurationMs:   time.Since(startedTime).Milliseconds(),
+	}); err != nil {
+		s.l.Error("Failed to append the repository sync history",
+			zap.Int("repository_id", repositoryID),
+			zap.String("commit", commitID),
+			zap.Error(err),
+		)
+	}
+	s.syncMetrics.observeSync(repositoryID, result, time.Since(startedTime))
+}
+
+// recordSyncResult counts the consecutive sync failures of the repository, and raises a single error project activity
+// when the failures quarantine the repository, telling the operator to fix the config and un-quarantine it.
+// We just emit the error on failure since it's not critical enough to fail the sync.
+func (s *Server) recordSyncResult(ctx context.Context, repository *api.Repository, pushEvent *gitlab.WebhookPushEvent, result api.RepositorySyncResult, detail string) {
+	quarantined, err := s.RepositoryService.RecordSyncResult(ctx, repository.ID, result, api.RepositoryQuarantineThreshold)
+	if err != nil {
+		s.l.Error("Failed to record the repository sync result",
+			zap.Int("repository_id", repository.ID),
+			zap.String("result", string(result)),
+			zap.Error(err),
+		)
+		return
+	}
+	if !quarantined {
+		return
+	}
+	s.requestRepositoryStatusMetricsRefresh()
+
+	s.l.Warn("Quarantined repository after consecutive sync failures.",
+		zap.Int("repository_id", repository.ID),
+		zap.String("repository", repository.FullPath),
+		zap.Int("threshold", api.RepositoryQuarantineThreshold),
+	)
+	payload := ""
+	if commit := headCommit(pushEvent); commit != nil {
+		createdTime, _ := time.Parse(time.RFC3339, commit.Timestamp)
+		bytes, err := json.Marshal(api.ActivityProjectRepositoryPushPayload{
+			VCSPushEvent: composeVCSPushEvent(repository, pushEvent, *commit, "", createdTime),
+		})
+		if err != nil {
+			s.l.Warn("Failed to construct project activity payload to alert quarantined repository", zap.Error(err))
+		} else {
+			payload = string(bytes)
+		}
+	}
+	activityCreate := &api.ActivityCreate{
+		CreatorID:   api.SystemBotID,
+		ContainerID: repository.ProjectID,
+		Type:        api.ActivityProjectRepositoryPush,
+		Level:       api.ActivityError,
+		Comment: fmt.Sprintf("Quarantined repository %s after %d consecutive sync failures, its pushes are ignored. The last failure: %s. Fix the repository config, then un-quarantine the repository to resume the sync.",
+			repository.FullPath, api.RepositoryQuarantineThreshold, detail),
+		Payload: payload,
+	}
+	if _, err := s.ActivityManager.CreateActivity(ctx, activityCreate, &ActivityMeta{}); err != nil {
+		s.l.Warn("Failed to create project activity to alert quarantined repository", zap.Error(err))
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// repositorySyncLeaseTTL is how long the replica processing a push holds the lease of the repository sync.
+// The lease is released once the push is processed, and only expires this way if the replica dies while processing.
+const repositorySyncLeaseTTL = 5 * time.Minute
+
+// defaultRepositorySyncClaimBackoffList is the backoff before each retry of claiming the lease held by another replica.
+var defaultRepositorySyncClaimBackoffList = []time.Duration{500 * time.Millisecond, 1 * time.Second, 2 * time.Second}
+
+// claimRepositorySync claims the lease of the exclusive sync of the repository for this replica, retrying by
+// syncClaimBackoffList while another replica holds it. Returns the function releasing the lease, or false if
+// another replica still holds the lease after the retries.
+func (s *Server) claimRepositorySync(ctx context.Context, repositoryID int) (func(), bool, error) {
+	for i := 0; ; i++ {
+		claimed, err := s.RepositoryService.ClaimRepositorySync(ctx, repositoryID, repositorySyncLeaseTTL, s.syncLeaseOwner)
+		if err != nil {
+			return nil, false, err
+		}
+		if claimed {
+			release := func() {
+				// The lease expires by itself if we fail to release it.
+				if err := s.RepositoryService.ReleaseRepositorySync(ctx, repositoryID, s.syncLeaseOwner); err != nil {
+					s.l.Warn("Failed to release the lease of the repository sync.", zap.Int("repository_id", repositoryID), zap.Error(err))
+				}
+			}
+			return release, true, nil
+		}
+		if i >= len(s.syncClaimBackoffList) {
+			return nil, false, nil
+		}
+		time.Sleep(s.syncClaimBackoffList[i])
+	}
+}
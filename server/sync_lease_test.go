@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"go.uber.org/zap"
+)
+
+type fakeSyncLeaseRepositoryService struct {
+	api.RepositoryService
+	// heldCount is the number of claims failing before the lease is free.
+	heldCount    int
+	claimCount   int
+	releaseCount int
+}
+
+func (f *fakeSyncLeaseRepositoryService) ClaimRepositorySync(ctx context.Context, repositoryID int, leaseTTL time.Duration, owner string) (bool, error) {
+	f.claimCount++
+	return f.claimCount > f.heldCount, nil
+}
+
+func (f *fakeSyncLeaseRepositoryService) ReleaseRepositorySync(ctx context.Context, repositoryID int, owner string) error {
+	f.releaseCount++
+	return nil
+}
+
+func TestClaimRepositorySync(t *testing.T) {
+	tests := []struct {
+		name      string
+		heldCount int
+		claimed   bool
+		claims    int
+	}{
+		{name: "free", heldCount: 0, claimed: true, claims: 1},
+		{name: "released during the backoff", heldCount: 2, claimed: true, claims: 3},
+		{name: "held after the backoff", heldCount: 10, claimed: false, claims: 3},
+	}
+	for _, test := range tests {
+		repositoryService := &fakeSyncLeaseRepositoryService{heldCount: test.heldCount}
+		s := &Server{
+			l:                    zap.NewNop(),
+			RepositoryService:    repositoryService,
+			syncLeaseOwner:       "replica",
+			syncClaimBackoffList: []time.Duration{time.Millisecond, time.Millisecond},
+		}
+		release, claimed, err := s.claimRepositorySync(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("%s: claimRepositorySync() got error %v.", test.name, err)
+		}
+		if claimed != test.claimed {
+			t.Errorf("%s: got claimed %v, want %v.", test.name, claimed, test.claimed)
+		}
+		if repositoryService.claimCount != test.claims {
+			t.Errorf("%s: got %d claims, want %d.", test.name, repositoryService.claimCount, test.claims)
+		}
+		if claimed {
+			release()
+			if repositoryService.releaseCount != 1 {
+				t.Errorf("%s: got %d releases, want 1.", test.name, repositoryService.releaseCount)
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxSyncMetricsRepositories caps the number of the repositories labeled in the sync metrics, so that the cardinality
+	// is bounded. The syncs of the repositories beyond the cap are counted under otherRepositoryLabel.
+	maxSyncMetricsRepositories = 500
+	otherRepositoryLabel       = "other"
+
+	// The repository statuses in the status gauge. A repository is counted under a single status in the order of
+	// quarantined, token invalid and active, so the statuses add up to the repositories.
+	repositoryMetricsStatusActive       = "ACTIVE"
+	repositoryMetricsStatusQuarantined  = "QUARANTINED"
+	repositoryMetricsStatusTokenInvalid = "TOKEN_INVALID"
+
+	// repositoryStatusMetricsInterval is the interval of refreshing the status gauge, which also catches up with the
+	// status transitions made by the other replicas.
+	repositoryStatusMetricsInterval = time.Minute
+)
+
+// syncMetrics is the Prometheus metrics of syncing the pushes to the repositories, registered to its own registry
+// served by the metrics endpoint. The nil syncMetrics records nothing.
+type syncMetrics struct {
+	registry *prometheus.Registry
+
+	attemptCounter    *prometheus.CounterVec
+	resultCounter     *prometheus.CounterVec
+	durationHistogram *prometheus.HistogramVec
+	statusGauge       *prometheus.GaugeVec
+
+	mu sync.Mutex
+	// repositoryLabelSet is the repositories labeled so far, capped by maxSyncMetricsRepositories.
+	repositoryLabelSet map[string]bool
+}
+
+func newSyncMetrics() *syncMetrics {
+	m := &syncMetrics{
+		registry: prometheus.NewRegistry(),
+		attemptCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "bytebase",
+			Name:      "repository_sync_attempts_total",
+			Help:      "The number of the pushes synced to the repository.",
+		}, []string{"repository"}),
+		resultCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "bytebase",
+			Name:      "repository_sync_results_total",
+			Help:      "The number of the pushes synced to the repository by the outcome.",
+		}, []string{"repository", "outcome"}),
+		durationHistogram: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "bytebase",
+			Name:      "repository_sync_duration_seconds",
+			Help:      "The duration of syncing a push to the repository by the outcome.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"outcome"}),
+		statusGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "bytebase",
+			Name:      "repositories",
+			Help:      "The number of the linked repositories by the status.",
+		}, []string{"status"}),
+		repositoryLabelSet: make(map[string]bool),
+	}
+	m.registry.MustRegister(m.attemptCounter, m.resultCounter, m.durationHistogram, m.statusGauge)
+	return m
+}
+
+// observeSync records the sync of a push to the repository with the result taking duration.
+func (m *syncMetrics) observeSync(repositoryID int, result api.RepositorySyncResult, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	repository := m.repositoryLabel(repositoryID)
+	m.attemptCounter.WithLabelValues(repository).Inc()
+	m.resultCounter.WithLabelValues(repository, string(result)).Inc()
+	m.durationHistogram.WithLabelValues(string(result)).Observe(duration.Seconds())
+}
+
+// repositoryLabel returns the label of the repository, or otherRepositoryLabel if the cap is reached by the others.
+func (m *syncMetrics) repositoryLabel(repositoryID int) string {
+	label := strconv.Itoa(repositoryID)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.repositoryLabelSet[label] {
+		return label
+	}
+	if len(m.repositoryLabelSet) >= maxSyncMetricsRepositories {
+		return otherRepositoryLabel
+	}
+	m.repositoryLabelSet[label] = true
+	return label
+}
+
+// setStatus sets the status gauge by the statuses of the repositories.
+func (m *syncMetrics) setStatus(repositoryList []*api.Repository) {
+	if m == nil {
+		return
+	}
+	countMap := map[string]int{
+		repositoryMetricsStatusActive:       0,
+		repositoryMetricsStatusQuarantined:  0,
+		repositoryMetricsStatusTokenInvalid: 0,
+	}
+	for _, repository := range repositoryList {
+		switch {
+		case repository.SyncStatus == api.SyncQuarantined:
+			countMap[repositoryMetricsStatusQuarantined]++
+		case repository.TokenStatus == api.TokenInvalid:
+			countMap[repositoryMetricsStatusTokenInvalid]++
+		default:
+			countMap[repositoryMetricsStatusActive]++
+		}
+	}
+	for status, count := range countMap {
+		m.statusGauge.WithLabelValues(status).Set(float64(count))
+	}
+}
+
+// requestRepositoryStatusMetricsRefresh asks runRepositoryStatusMetrics to refresh the status gauge on a status transition.
+// The requests are coalesced, so a burst of the transitions, e.g. the tokens marked invalid by a single refresh round,
+// lists the repositories once off the request path.
+func (s *Server) requestRepositoryStatusMetricsRefresh() {
+	select {
+	case s.repositoryStatusMetricsRefreshC <- struct{}{}:
+	default:
+	}
+}
+
+// runRepositoryStatusMetrics refreshes the status gauge on the requested status transitions and on the ticker until ctx is done.
+func (s *Server) runRepositoryStatusMetrics(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(repositoryStatusMetricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.repositoryStatusMetricsRefreshC:
+		}
+		s.refreshRepositoryStatusMetrics(ctx)
+	}
+}
+
+// refreshRepositoryStatusMetrics refreshes the status gauge of the sync metrics from the linked repositories.
+// The failure is logged since the metrics aren't critical.
+func (s *Server) refreshRepositoryStatusMetrics(ctx context.Context) {
+	if s.syncMetrics == nil {
+		return
+	}
+	repositoryList, err := s.RepositoryService.FindRepositoryList(ctx, &api.RepositoryFind{})
+	if err != nil {
+		s.l.Warn("Failed to list the repositories to refresh the status metrics", zap.Error(err))
+		return
+	}
+	s.syncMetrics.setStatus(repositoryList)
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestSyncMetricsObserveSync(t *testing.T) {
+	m := newSyncMetrics()
+	m.observeSync(1, api.RepositorySyncSuccess, time.Second)
+	m.observeSync(1, api.RepositorySyncFailed, 2*time.Second)
+	m.observeSync(1, api.RepositorySyncSuccess, time.Second)
+	m.observeSync(2, api.RepositorySyncFailed, time.Second)
+
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"attempts of repository 1", testutil.ToFloat64(m.attemptCounter.WithLabelValues("1")), 3},
+		{"successes of repository 1", testutil.ToFloat64(m.resultCounter.WithLabelValues("1", string(api.RepositorySyncSuccess))), 2},
+		{"failures of repository 1", testutil.ToFloat64(m.resultCounter.WithLabelValues("1", string(api.RepositorySyncFailed))), 1},
+		{"attempts of repository 2", testutil.ToFloat64(m.attemptCounter.WithLabelValues("2")), 1},
+		{"successes of repository 2", testutil.ToFloat64(m.resultCounter.WithLabelValues("2", string(api.RepositorySyncSuccess))), 0},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%q: got %v, want %v.", test.name, test.got, test.want)
+		}
+	}
+	if got := testutil.CollectAndCount(m.durationHistogram); got != 2 {
+		t.Errorf("got %d duration histograms, want one for each outcome.", got)
+	}
+}
+
+func TestSyncMetricsRepositoryLabelCap(t *testing.T) {
+	m := newSyncMetrics()
+	for id := 1; id <= maxSyncMetricsRepositories+10; id++ {
+		m.observeSync(id, api.RepositorySyncSuccess, time.Second)
+	}
+	// The repository labeled before the cap keeps its label.
+	m.observeSync(1, api.RepositorySyncSuccess, time.Second)
+
+	if got := testutil.CollectAndCount(m.attemptCounter); got != maxSyncMetricsRepositories+1 {
+		t.Errorf("got %d attempt counters, want %d.", got, maxSyncMetricsRepositories+1)
+	}
+	if got := testutil.ToFloat64(m.attemptCounter.WithLabelValues(otherRepositoryLabel)); got != 10 {
+		t.Errorf("got %v attempts of the other repositories, want 10.", got)
+	}
+	if got := testutil.ToFloat64(m.attemptCounter.WithLabelValues(strconv.Itoa(1))); got != 2 {
+		t.Errorf("got %v attempts of repository 1, want 2.", got)
+	}
+}
+
+func TestSyncMetricsSetStatus(t *testing.T) {
+	m := newSyncMetrics()
+	m.setStatus([]*api.Repository{
+		{ID: 1, SyncStatus: api.SyncActive, TokenStatus: api.TokenValid},
+		{ID: 2, SyncStatus: api.SyncActive, TokenStatus: api.TokenValid},
+		{ID: 3, SyncStatus: api.SyncQuarantined, TokenStatus: api.TokenInvalid},
+		{ID: 4, SyncStatus: api.SyncActive, TokenStatus: api.TokenInvalid},
+	})
+
+	wantMap := map[string]float64{
+		repositoryMetricsStatusActive:       2,
+		repositoryMetricsStatusQuarantined:  1,
+		repositoryMetricsStatusTokenInvalid: 1,
+	}
+	for status, want := range wantMap {
+		if got := testutil.ToFloat64(m.statusGauge.WithLabelValues(status)); got != want {
+			t.Errorf("got %v repositories in status %s, want %v.", got, status, want)
+		}
+	}
+
+	// The nil metrics records nothing.
+	var nilMetrics *syncMetrics
+	nilMetrics.observeSync(1, api.RepositorySyncSuccess, time.Second)
+	nilMetrics.setStatus(nil)
+}
+
+// fakeStatusMetricsRepositoryService lists a quarantined repository, counting the listings.
+type fakeStatusMetricsRepositoryService struct {
+	api.RepositoryService
+	mu        sync.Mutex
+	listCount int
+}
+
+func (f *fakeStatusMetricsRepositoryService) FindRepositoryList(ctx context.Context, find *api.RepositoryFind) ([]*api.Repository, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listCount++
+	return []*api.Repository{{ID: 1, SyncStatus: api.SyncQuarantined}}, nil
+}
+
+func (f *fakeStatusMetricsRepositoryService) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.listCount
+}
+
+func TestRequestRepositoryStatusMetricsRefresh(t *testing.T) {
+	repositoryService := &fakeStatusMetricsRepositoryService{}
+	s := &Server{
+		l:                               zap.NewNop(),
+		RepositoryService:               repositoryService,
+		syncMetrics:                     newSyncMetrics(),
+		repositoryStatusMetricsRefreshC: make(chan struct{}, 1),
+	}
+
+	// A burst of the transitions is coalesced into a single pending refresh, without listing the repositories inline.
+	for i := 0; i < 3; i++ {
+		s.requestRepositoryStatusMetricsRefresh()
+	}
+	if got := len(s.repositoryStatusMetricsRefreshC); got != 1 {
+		t.Errorf("got %d pending refreshes, want 1.", got)
+	}
+	if got := repositoryService.count(); got != 0 {
+		t.Errorf("got %d listings before running, want 0.", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go s.runRepositoryStatusMetrics(ctx, &wg)
+	deadline := time.Now().Add(5 * time.Second)
+	for repositoryService.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	wg.Wait()
+
+	if got := repositoryService.count(); got != 1 {
+		t.Errorf("got %d listings, want 1 for the coalesced refresh.", got)
+	}
+	if got := testutil.ToFloat64(s.syncMetrics.statusGauge.WithLabelValues(repositoryMetricsStatusQuarantined)); got != 1 {
+		t.Errorf("got %v quarantined repositories, want 1.", got)
+	}
+
+	// The request doesn't block without the runner, e.g. the server in tests.
+	(&Server{}).requestRepositoryStatusMetricsRefresh()
+}
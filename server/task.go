@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/bytebase/bytebase/api"
 	"github.com/bytebase/bytebase/common"
@@ -442,6 +443,12 @@ func (s *Server) composeTaskRelationship(ctx context.Context, task *api.Task) er
 		}
 	}
 
+	// Surface the hold as the reason the approved task isn't running.
+	task.HoldUntilTs, err = s.findTaskHoldUntil(ctx, task, time.Now())
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -479,6 +486,21 @@ func (s *Server) changeTaskStatusWithPatch(ctx context.Context, task *api.Task,
 			Err:  fmt.Errorf("invalid task status transition from %v to %v. Applicable transition(s) %v", task.Status, taskStatusPatch.Status, applicableTaskStatusTransition[task.Status])}
 	}
 
+	// The task stays pending approval until the approval chain of its environment is satisfied,
+	// and a DBA or an Owner approves the task containing destructive operations.
+	if task.Status == api.TaskPendingApproval && taskStatusPatch.Status == api.TaskPending {
+		pendingTask, err := s.approveTaskByChain(ctx, task, taskStatusPatch.UpdaterID)
+		if err != nil {
+			return nil, err
+		}
+		if pendingTask != nil {
+			return pendingTask, nil
+		}
+		if err := s.checkExtraApproval(ctx, task, taskStatusPatch.UpdaterID); err != nil {
+			return nil, err
+		}
+	}
+
 	updatedTask, err := s.TaskService.PatchTaskStatus(ctx, taskStatusPatch)
 	if err != nil {
 		return nil, fmt.Errorf("failed to change task %v(%v) status: %w", task.ID, task.Name, err)
@@ -547,11 +569,14 @@ func (s *Server) changeTaskStatusWithPatch(ctx context.Context, task *api.Task,
 			return nil, fmt.Errorf("failed to schedule task check \"%v\" after approval", updatedTask.Name)
 		}
 
-		scheduledTask, err := s.TaskScheduler.ScheduleIfNeeded(ctx, updatedTask)
-		if err != nil {
-			return nil, fmt.Errorf("failed to schedule task \"%v\" after approval", updatedTask.Name)
+		// The pipeline yet to start is left to the scheduler, which gates it on the concurrent pipeline limit.
+		if s.TaskScheduler.IsPipelineActive(updatedTask.PipelineID) {
+			scheduledTask, err := s.TaskScheduler.ScheduleIfNeeded(ctx, updatedTask)
+			if err != nil {
+				return nil, fmt.Errorf("failed to schedule task \"%v\" after approval", updatedTask.Name)
+			}
+			updatedTask = scheduledTask
 		}
-		updatedTask = scheduledTask
 	}
 
 	// If create database or schema update task completes, we sync the corresponding instance schema immediately.
@@ -587,6 +612,9 @@ func (s *Server) changeTaskStatusWithPatch(ctx context.Context, task *api.Task,
 				if _, err := s.PipelineService.PatchPipeline(ctx, pipelinePatch); err != nil {
 					return nil, fmt.Errorf("failed to mark pipeline %v as DONE after completing task %v: %w", pipeline.Name, updatedTask.Name, err)
 				}
+				if s.TaskScheduler != nil {
+					s.TaskScheduler.FinishPipeline(pipeline.ID)
+				}
 			} else {
 				issue.Pipeline = pipeline
 				_, err := s.changeIssueStatus(ctx, issue, api.IssueDone, taskStatusPatch.UpdaterID, "")
@@ -34,6 +34,12 @@ func defaultMigrationVersionFromTaskID(taskID int) string {
 	return strings.Join([]string{time.Now().Format("20060102150405"), strconv.Itoa(taskID)}, ".")
 }
 
+// getMigrationStatementTimeout returns the timeout of each statement of the migration pushed to the repository.
+// 0 means the instance default.
+func getMigrationStatementTimeout(repository *api.Repository) time.Duration {
+	return time.Duration(repository.MigrationStatementTimeout) * time.Second
+}
+
 func runMigration(ctx context.Context, l *zap.Logger, server *Server, task *api.Task, migrationType db.MigrationType, statement string, vcsPushEvent *vcs.PushEvent) (terminated bool, result *api.TaskRunResultPayload, err error) {
 	if task.Database == nil {
 		msg := "missing database when updating schema"
@@ -68,7 +74,8 @@ func runMigration(ctx context.Context, l *zap.Logger, server *Server, task *api.
 		mi.Description = task.Name
 	} else {
 		repositoryFind := &api.RepositoryFind{
-			ProjectID: &task.Database.ProjectID,
+			ProjectID:      &task.Database.ProjectID,
+			IncludeSecrets: true,
 		}
 		repository, err = server.RepositoryService.FindRepository(ctx, repositoryFind)
 		if err != nil {
@@ -87,6 +94,12 @@ func runMigration(ctx context.Context, l *zap.Logger, server *Server, task *api.
 			return true, nil, fmt.Errorf("failed to start migration, error: %w", err)
 		}
 		mi.Creator = vcsPushEvent.FileCommit.AuthorName
+		if vcsPushEvent.MigrationVersion != "" {
+			mi.Version = vcsPushEvent.MigrationVersion
+		}
+		mi.StatementTimeout = getMigrationStatementTimeout(repository)
+		// The failed attempt before the retry leaves the FAILED migration history of the same version.
+		mi.ReplaceFailedHistory = task.RetryCount > 0
 
 		miPayload := &db.MigrationInfoPayload{
 			VCSPushEvent: vcsPushEvent,
@@ -156,13 +169,50 @@ func runMigration(ctx context.Context, l *zap.Logger, server *Server, task *api.
 		return true, nil, common.Errorf(common.MigrationSchemaMissing, fmt.Errorf("missing migration schema for instance %q", task.Instance.Name))
 	}
 
+	bytebaseURL := ""
+	if issue != nil {
+		bytebaseURL = fmt.Sprintf("%s:%d/issue/%s?stage=%d", server.frontendHost, server.frontendPort, api.IssueSlug(issue), task.StageID)
+	}
+
 	migrationID, schema, err := driver.ExecuteMigration(ctx, mi, statement)
 	if err != nil {
+		if vcsPushEvent != nil {
+			setCommitStatus(ctx, l, server, repository, vcsPushEvent, newCommitStatus(repository, vcs.CommitStateFailed, fmt.Sprintf("Failed to apply migration version %s to database %q.", mi.Version, databaseName), bytebaseURL))
+			notifyRepositorySync(l, repository, vcsPushEvent, repositorySyncOutcome{
+				database:  databaseName,
+				version:   mi.Version,
+				detail:    err.Error(),
+				issueLink: bytebaseURL,
+			})
+		}
 		return true, nil, err
 	}
+	if vcsPushEvent != nil {
+		setCommitStatus(ctx, l, server, repository, vcsPushEvent, newCommitStatus(repository, vcs.CommitStateSuccess, fmt.Sprintf("Applied migration version %s to database %q.", mi.Version, databaseName), bytebaseURL))
+		notifyRepositorySync(l, repository, vcsPushEvent, repositorySyncOutcome{
+			success:   true,
+			database:  databaseName,
+			version:   mi.Version,
+			detail:    fmt.Sprintf("Applied migration version %s to database %q.", mi.Version, databaseName),
+			issueLink: bytebaseURL,
+		})
+	}
+
+	// Record the synced baseline schema, so the unchanged schema isn't applied again.
+	if vcsPushEvent != nil && mi.Type == db.Baseline {
+		schemaSyncPath := composeSchemaSyncPath(repository, mi, vcsPushEvent.FileCommit.Added)
+		if err := server.RepositoryService.UpsertLastSyncedSchemaHash(ctx, task.Database.ID, schemaSyncPath, computeSchemaHash(statement)); err != nil {
+			l.Error("Failed to record the last synced schema hash",
+				zap.Int("task_id", task.ID),
+				zap.String("path", schemaSyncPath),
+				zap.Error(err),
+			)
+		}
+	}
 
 	// If VCS based and schema path template is specified, then we will write back the latest schema file after migration.
-	writeBack := (vcsPushEvent != nil) && (repository.SchemaPathTemplate != "")
+	// The schema dump can't be split back into the schema files, so the directory schema source isn't written back.
+	writeBack := (vcsPushEvent != nil) && (repository.SchemaPathTemplate != "") && (repository.SchemaSourceType != api.SchemaSourceDirectory)
 	// For tenant mode project, we will only write back latest schema file on the last task.
 	if writeBack && issue != nil {
 		project, err := server.composeProjectByID(ctx, task.Database.ProjectID)
@@ -186,9 +236,7 @@ func runMigration(ctx context.Context, l *zap.Logger, server *Server, task *api.
 	}
 
 	if writeBack {
-		latestSchemaFile := filepath.Join(repository.BaseDirectory, repository.SchemaPathTemplate)
-		latestSchemaFile = strings.ReplaceAll(latestSchemaFile, "{{ENV_NAME}}", mi.Environment)
-		latestSchemaFile = strings.ReplaceAll(latestSchemaFile, "{{DB_NAME}}", mi.Database)
+		latestSchemaFile := composeSchemaPath(repository, mi.Environment, mi.Database)
 
 		repository.VCS, err = server.composeVCSByID(ctx, repository.VCSID)
 		if err != nil {
@@ -204,11 +252,6 @@ func runMigration(ctx context.Context, l *zap.Logger, server *Server, task *api.
 			return true, nil, err
 		}
 
-		bytebaseURL := ""
-		if issue != nil {
-			bytebaseURL = fmt.Sprintf("%s:%d/issue/%s?stage=%d", server.frontendHost, server.frontendPort, api.IssueSlug(issue), task.StageID)
-		}
-
 		commitID, err := writeBackLatestSchema(ctx, server, repository, vcsPushEvent, mi, branch, latestSchemaFile, schema, bytebaseURL)
 		if err != nil {
 			return true, nil, err
@@ -261,6 +304,11 @@ func runMigration(ctx context.Context, l *zap.Logger, server *Server, task *api.
 		}
 	}
 
+	// The data update doesn't change the schema.
+	if vcsPushEvent == nil && mi.Type != db.Data {
+		server.snapshotSchemaOnApply(ctx, task, issue, mi, schema, bytebaseURL)
+	}
+
 	detail := fmt.Sprintf("Applied migration version %s to database %q.", mi.Version, databaseName)
 	if mi.Type == db.Baseline {
 		detail = fmt.Sprintf("Established baseline version %s for database %q.", mi.Version, databaseName)
@@ -273,17 +321,73 @@ func runMigration(ctx context.Context, l *zap.Logger, server *Server, task *api.
 	}, nil
 }
 
+// newCommitStatus returns the commit status reported to the VCS provider under the context configured by the repository.
+func newCommitStatus(repository *api.Repository, state vcs.CommitState, description string, targetURL string) vcs.CommitStatus {
+	statusContext := repository.CommitStatusContext
+	if statusContext == "" {
+		statusContext = vcs.DefaultCommitStatusContext
+	}
+	return vcs.CommitStatus{
+		State:       state,
+		Context:     statusContext,
+		TargetURL:   targetURL,
+		Description: description,
+	}
+}
+
+// setCommitStatus sets the status of the commit triggering the migration.
+// We just emit the error on failure since it's not critical enough to fail the entire operation.
+func setCommitStatus(ctx context.Context, l *zap.Logger, server *Server, repository *api.Repository, pushEvent *vcs.PushEvent, status vcs.CommitStatus) {
+	if repository.VCS == nil {
+		composedVCS, err := server.composeVCSByID(ctx, repository.VCSID)
+		if err != nil {
+			l.Error("Failed to fetch VCS for setting the commit status",
+				zap.Int("vcs_id", repository.VCSID),
+				zap.Error(err),
+			)
+			return
+		}
+		if composedVCS == nil {
+			l.Error("VCS not found for setting the commit status", zap.Int("vcs_id", repository.VCSID))
+			return
+		}
+		repository.VCS = composedVCS
+	}
+
+	if err := vcs.Get(repository.VCS.Type, server.vcsProviderConfig()).SetCommitStatus(
+		ctx,
+		common.OauthContext{
+			ClientID:     repository.VCS.ApplicationID,
+			ClientSecret: repository.VCS.Secret,
+			AccessToken:  repository.AccessToken,
+			RefreshToken: repository.RefreshToken,
+			Refresher:    server.refreshToken(ctx, repository),
+		},
+		repository.VCS.InstanceURL,
+		repository.ExternalID,
+		pushEvent.FileCommit.ID,
+		status,
+	); err != nil {
+		l.Error("Failed to set the commit status",
+			zap.String("repository", repository.WebURL),
+			zap.String("commit", pushEvent.FileCommit.ID),
+			zap.String("context", status.Context),
+			zap.Error(err),
+		)
+	}
+}
+
 // Writes back the latest schema to the repository after migration
 // Returns the commit id on success.
 func writeBackLatestSchema(ctx context.Context, server *Server, repository *api.Repository, pushEvent *vcs.PushEvent, mi *db.MigrationInfo, branch string, latestSchemaFile string, schema string, bytebaseURL string) (string, error) {
-	schemaFileMeta, err := vcs.Get(vcs.GitLabSelfHost, vcs.ProviderConfig{Logger: server.l}).ReadFileMeta(
+	schemaFileMeta, err := vcs.Get(vcs.GitLabSelfHost, server.vcsProviderConfig()).ReadFileMeta(
 		ctx,
 		common.OauthContext{
 			ClientID:     repository.VCS.ApplicationID,
 			ClientSecret: repository.VCS.Secret,
 			AccessToken:  repository.AccessToken,
 			RefreshToken: repository.RefreshToken,
-			Refresher:    server.refreshToken(ctx, repository.ID),
+			Refresher:    server.refreshToken(ctx, repository),
 		},
 		repository.VCS.InstanceURL,
 		repository.ExternalID,
@@ -317,16 +421,20 @@ func writeBackLatestSchema(ctx context.Context, server *Server, repository *api.
 		Branch:        branch,
 		CommitMessage: fmt.Sprintf("%s\n\n%s", commitTitle, commitBody),
 		Content:       schema,
+		Author: vcs.Author{
+			Name:  repository.CommitAuthorName,
+			Email: repository.CommitAuthorEmail,
+		},
 	}
 	if createSchemaFile {
-		err := vcs.Get(vcs.GitLabSelfHost, vcs.ProviderConfig{Logger: server.l}).CreateFile(
+		err := vcs.Get(vcs.GitLabSelfHost, server.vcsProviderConfig()).CreateFile(
 			ctx,
 			common.OauthContext{
 				ClientID:     repository.VCS.ApplicationID,
 				ClientSecret: repository.VCS.Secret,
 				AccessToken:  repository.AccessToken,
 				RefreshToken: repository.RefreshToken,
-				Refresher:    server.refreshToken(ctx, repository.ID),
+				Refresher:    server.refreshToken(ctx, repository),
 			},
 			repository.VCS.InstanceURL,
 			repository.ExternalID,
@@ -339,14 +447,14 @@ func writeBackLatestSchema(ctx context.Context, server *Server, repository *api.
 		}
 	} else {
 		schemaFileCommit.LastCommitID = schemaFileMeta.LastCommitID
-		err := vcs.Get(vcs.GitLabSelfHost, vcs.ProviderConfig{Logger: server.l}).OverwriteFile(
+		err := vcs.Get(vcs.GitLabSelfHost, server.vcsProviderConfig()).OverwriteFile(
 			ctx,
 			common.OauthContext{
 				ClientID:     repository.VCS.ApplicationID,
 				ClientSecret: repository.VCS.Secret,
 				AccessToken:  repository.AccessToken,
 				RefreshToken: repository.RefreshToken,
-				Refresher:    server.refreshToken(ctx, repository.ID),
+				Refresher:    server.refreshToken(ctx, repository),
 			},
 			repository.VCS.InstanceURL,
 			repository.ExternalID,
@@ -359,14 +467,14 @@ func writeBackLatestSchema(ctx context.Context, server *Server, repository *api.
 	}
 
 	// VCS such as GitLab API doesn't return the commit on write, so we have to call ReadFileMeta again
-	schemaFileMeta, err = vcs.Get(vcs.GitLabSelfHost, vcs.ProviderConfig{Logger: server.l}).ReadFileMeta(
+	schemaFileMeta, err = vcs.Get(vcs.GitLabSelfHost, server.vcsProviderConfig()).ReadFileMeta(
 		ctx,
 		common.OauthContext{
 			ClientID:     repository.VCS.ApplicationID,
 			ClientSecret: repository.VCS.Secret,
 			AccessToken:  repository.AccessToken,
 			RefreshToken: repository.RefreshToken,
-			Refresher:    server.refreshToken(ctx, repository.ID),
+			Refresher:    server.refreshToken(ctx, repository),
 		},
 		repository.VCS.InstanceURL,
 		repository.ExternalID,
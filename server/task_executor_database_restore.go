@@ -177,13 +177,18 @@ func createBranchMigrationHistory(ctx context.Context, server *Server, sourceDat
 	if sourceDatabase.InstanceID != targetDatabase.InstanceID {
 		description = fmt.Sprintf("Restored from backup %q of database %q in instance %q.", backup.Name, sourceDatabase.Name, sourceDatabase.Instance.Name)
 	}
+	// The project pending cleanup works as the UI workflow.
+	source := db.UI
+	if targetDatabase.Project.WorkflowType == api.VCSWorkflow {
+		source = db.VCS
+	}
 	m := &db.MigrationInfo{
 		ReleaseVersion: server.version,
 		Version:        defaultMigrationVersionFromTaskID(task.ID),
 		Namespace:      targetDatabase.Name,
 		Database:       targetDatabase.Name,
 		Environment:    targetDatabase.Instance.Environment.Name,
-		Source:         db.MigrationSource(targetDatabase.Project.WorkflowType),
+		Source:         source,
 		Type:           db.Branch,
 		Description:    description,
 		Creator:        task.Creator.Name,
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+)
+
+func TestGetMigrationStatementTimeout(t *testing.T) {
+	tests := []struct {
+		timeout int
+		want    time.Duration
+	}{
+		{timeout: 0, want: 0},
+		{timeout: 90, want: 90 * time.Second},
+	}
+
+	for _, test := range tests {
+		repository := &api.Repository{MigrationStatementTimeout: test.timeout}
+		if got := getMigrationStatementTimeout(repository); got != test.want {
+			t.Errorf("getMigrationStatementTimeout(%d) got %v, want %v.", test.timeout, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+)
+
+// findTaskHoldUntil returns when the approved task is held until by the minimum hold duration of the approval policy of
+// its environment, or 0 if the task isn't held at now. The hold is gated behind the approval policy feature.
+func (s *Server) findTaskHoldUntil(ctx context.Context, task *api.Task, now time.Time) (int64, error) {
+	if task.Status != api.TaskPending || task.ApprovedTs == 0 || !s.feature(api.FeatureApprovalPolicy) {
+		return 0, nil
+	}
+	instance := task.Instance
+	if instance == nil {
+		var err error
+		instance, err = s.InstanceService.FindInstance(ctx, &api.InstanceFind{ID: &task.InstanceID})
+		if err != nil {
+			return 0, err
+		}
+		if instance == nil {
+			return 0, fmt.Errorf("instance ID not found %v", task.InstanceID)
+		}
+	}
+	policy, err := s.PolicyService.GetPipelineApprovalPolicy(ctx, instance.EnvironmentID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get approval policy for environment ID %d: %w", instance.EnvironmentID, err)
+	}
+	return getTaskHoldUntil(task.ApprovedTs, policy, now), nil
+}
+
+// getTaskHoldUntil returns when the task approved at approvedTs is held until by the minimum hold duration of the
+// approval policy, or 0 if the hold has elapsed at now.
+func getTaskHoldUntil(approvedTs int64, policy *api.PipelineApprovalPolicy, now time.Time) int64 {
+	if approvedTs == 0 || policy.Value != api.PipelineApprovalValueManualAlways || policy.MinHoldDuration <= 0 {
+		return 0
+	}
+	holdUntil := approvedTs + policy.MinHoldDuration
+	if holdUntil <= now.Unix() {
+		return 0
+	}
+	return holdUntil
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+)
+
+func TestGetTaskHoldUntil(t *testing.T) {
+	const approvedTs = 1650000000
+	holdPolicy := &api.PipelineApprovalPolicy{Value: api.PipelineApprovalValueManualAlways, MinHoldDuration: 3600}
+
+	tests := []struct {
+		name       string
+		approvedTs int64
+		policy     *api.PipelineApprovalPolicy
+		now        time.Time
+		want       int64
+	}{
+		{
+			name:       "wait within the hold window",
+			approvedTs: approvedTs,
+			policy:     holdPolicy,
+			now:        time.Unix(approvedTs+1800, 0),
+			want:       approvedTs + 3600,
+		},
+		{
+			name:       "run once the hold elapses",
+			approvedTs: approvedTs,
+			policy:     holdPolicy,
+			now:        time.Unix(approvedTs+3600, 0),
+			want:       0,
+		},
+		{
+			name:       "no hold configured",
+			approvedTs: approvedTs,
+			policy:     &api.PipelineApprovalPolicy{Value: api.PipelineApprovalValueManualAlways},
+			now:        time.Unix(approvedTs, 0),
+			want:       0,
+		},
+		{
+			name:   "not approved",
+			policy: holdPolicy,
+			now:    time.Unix(approvedTs, 0),
+			want:   0,
+		},
+		{
+			name:       "no approval required",
+			approvedTs: approvedTs,
+			policy:     &api.PipelineApprovalPolicy{Value: api.PipelineApprovalValueManualNever, MinHoldDuration: 3600},
+			now:        time.Unix(approvedTs, 0),
+			want:       0,
+		},
+	}
+
+	for _, test := range tests {
+		if got := getTaskHoldUntil(test.approvedTs, test.policy, test.now); got != test.want {
+			t.Errorf("%q: getTaskHoldUntil() got %d, want %d.", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"go.uber.org/zap"
+)
+
+// TaskErrorClassifier classifies the errors failing the tasks, so that the task failed by a transient error, e.g. a lock
+// timeout, is retried by its retry policy, while the task failed by a permanent error, e.g. a syntax error, fails at once.
+type TaskErrorClassifier interface {
+	// IsTransient returns true if the task failed by err may succeed on a retry.
+	IsTransient(task *api.Task, err error) bool
+}
+
+// transientErrorPatternList is the lower-cased messages of the transient database errors.
+var transientErrorPatternList = []string{
+	// MySQL and TiDB, error 1205 and 1213.
+	"lock wait timeout exceeded",
+	"deadlock found",
+	// PostgreSQL, SQLSTATE 55P03 and 40P01.
+	"canceling statement due to lock timeout",
+	"deadlock detected",
+}
+
+// lockErrorClassifier is the default TaskErrorClassifier, classifying the lock timeouts and the deadlocks as transient.
+type lockErrorClassifier struct{}
+
+func (lockErrorClassifier) IsTransient(task *api.Task, err error) bool {
+	message := strings.ToLower(err.Error())
+	for _, pattern := range transientErrorPatternList {
+		if strings.Contains(message, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTaskErrorClassifier sets the classifier deciding the errors retried by the task retry policy. NewServer sets the
+// classifier retrying the lock timeouts and the deadlocks.
+func (s *Server) SetTaskErrorClassifier(classifier TaskErrorClassifier) {
+	s.taskErrorClassifier = classifier
+}
+
+// SetTaskRetryPolicy sets the retry policy of the migration tasks created by the VCS pushes. Without the policy,
+// the failed tasks need to be re-run manually.
+func (s *Server) SetTaskRetryPolicy(policy *api.TaskRetryPolicy) {
+	s.taskRetryPolicy = policy
+}
+
+// getTaskRetryPolicy returns the retry policy in the payload of the schema or data update task, or nil if it's not retried.
+func getTaskRetryPolicy(task *api.Task) *api.TaskRetryPolicy {
+	switch task.Type {
+	case api.TaskDatabaseSchemaUpdate:
+		payload := &api.TaskDatabaseSchemaUpdatePayload{}
+		if err := json.Unmarshal([]byte(task.Payload), payload); err != nil {
+			return nil
+		}
+		return payload.RetryPolicy
+	case api.TaskDatabaseDataUpdate:
+		payload := &api.TaskDatabaseDataUpdatePayload{}
+		if err := json.Unmarshal([]byte(task.Payload), payload); err != nil {
+			return nil
+		}
+		return payload.RetryPolicy
+	}
+	return nil
+}
+
+// planTaskRetry returns the patch recording the failed attempt and scheduling the retry of the task failed by err at now,
+// or nil if the error is permanent or the task has run out of the attempts of its retry policy.
+func planTaskRetry(task *api.Task, err error, classifier TaskErrorClassifier, now time.Time) *api.TaskPatch {
+	policy := getTaskRetryPolicy(task)
+	if policy == nil || task.RetryCount+1 >= policy.MaxAttempts || !classifier.IsTransient(task, err) {
+		return nil
+	}
+	retryCount := task.RetryCount + 1
+	lastError := err.Error()
+	nextRetryTs := now.Unix() + policy.Backoff(task.RetryCount)
+	return &api.TaskPatch{
+		ID:          task.ID,
+		UpdaterID:   api.SystemBotID,
+		RetryCount:  &retryCount,
+		LastError:   &lastError,
+		NextRetryTs: &nextRetryTs,
+	}
+}
+
+// retryTaskIfTransient keeps the running task failed by a transient error running, to be retried after the backoff.
+// Returns false if the task should be marked as failed.
+func (s *Server) retryTaskIfTransient(ctx context.Context, task *api.Task, err error) bool {
+	taskPatch := planTaskRetry(task, err, s.taskErrorClassifier, time.Now())
+	if taskPatch == nil {
+		return false
+	}
+	if _, patchErr := s.TaskService.PatchTask(ctx, taskPatch); patchErr != nil {
+		s.l.Error("Failed to schedule the retry of the task",
+			zap.Int("id", task.ID),
+			zap.String("name", task.Name),
+			zap.Error(patchErr),
+		)
+		return false
+	}
+	s.l.Info("Scheduled the retry of the task failed by a transient error",
+		zap.Int("id", task.ID),
+		zap.String("name", task.Name),
+		zap.Int("retry_count", *taskPatch.RetryCount),
+		zap.Int64("next_retry_ts", *taskPatch.NextRetryTs),
+		zap.Error(err),
+	)
+	return true
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+)
+
+// fakeTaskErrorClassifier classifies the errors by their messages.
+type fakeTaskErrorClassifier struct {
+	transientMap map[string]bool
+}
+
+func (c *fakeTaskErrorClassifier) IsTransient(task *api.Task, err error) bool {
+	return c.transientMap[err.Error()]
+}
+
+func TestPlanTaskRetry(t *testing.T) {
+	now := time.Unix(1650000000, 0)
+	classifier := &fakeTaskErrorClassifier{transientMap: map[string]bool{"lock timeout": true}}
+	newTask := func(policy *api.TaskRetryPolicy, retryCount int) *api.Task {
+		payload, err := json.Marshal(api.TaskDatabaseSchemaUpdatePayload{Statement: "ALTER TABLE t ADD COLUMN c INT", RetryPolicy: policy})
+		if err != nil {
+			t.Fatalf("failed to marshal the payload, error %v", err)
+		}
+		return &api.Task{ID: 1, Type: api.TaskDatabaseSchemaUpdate, Payload: string(payload), RetryCount: retryCount}
+	}
+	policy := &api.TaskRetryPolicy{MaxAttempts: 3, InitialBackoff: 30, MaxBackoff: 45}
+
+	tests := []struct {
+		name            string
+		task            *api.Task
+		err             error
+		wantRetry       bool
+		wantNextRetryTs int64
+	}{
+		{
+			name:            "transient error",
+			task:            newTask(policy, 0),
+			err:             errors.New("lock timeout"),
+			wantRetry:       true,
+			wantNextRetryTs: now.Unix() + 30,
+		},
+		{
+			name:            "transient error backing off",
+			task:            newTask(policy, 1),
+			err:             errors.New("lock timeout"),
+			wantRetry:       true,
+			wantNextRetryTs: now.Unix() + 45,
+		},
+		{
+			name:      "transient error out of attempts",
+			task:      newTask(policy, 2),
+			err:       errors.New("lock timeout"),
+			wantRetry: false,
+		},
+		{
+			name:      "permanent error",
+			task:      newTask(policy, 0),
+			err:       errors.New("syntax error"),
+			wantRetry: false,
+		},
+		{
+			name:      "no retry policy",
+			task:      newTask(nil, 0),
+			err:       errors.New("lock timeout"),
+			wantRetry: false,
+		},
+	}
+
+	for _, test := range tests {
+		taskPatch := planTaskRetry(test.task, test.err, classifier, now)
+		if got := taskPatch != nil; got != test.wantRetry {
+			t.Errorf("%q: planTaskRetry() got retry %v, want %v.", test.name, got, test.wantRetry)
+			continue
+		}
+		if taskPatch == nil {
+			continue
+		}
+		if *taskPatch.RetryCount != test.task.RetryCount+1 || *taskPatch.LastError != test.err.Error() || *taskPatch.NextRetryTs != test.wantNextRetryTs {
+			t.Errorf("%q: planTaskRetry() got retry %d of error %q at %d, want retry %d of error %q at %d.", test.name,
+				*taskPatch.RetryCount, *taskPatch.LastError, *taskPatch.NextRetryTs, test.task.RetryCount+1, test.err.Error(), test.wantNextRetryTs)
+		}
+	}
+}
+
+func TestLockErrorClassifier(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("Error 1205: Lock wait timeout exceeded; try restarting transaction"), true},
+		{errors.New("Error 1213: Deadlock found when trying to get lock; try restarting transaction"), true},
+		{errors.New("pq: canceling statement due to lock timeout"), true},
+		{errors.New("Error 1064: You have an error in your SQL syntax"), false},
+	}
+
+	for _, test := range tests {
+		if got := (lockErrorClassifier{}).IsTransient(&api.Task{}, test.err); got != test.want {
+			t.Errorf("IsTransient(%q) got %v, want %v.", test.err, got, test.want)
+		}
+	}
+}
@@ -20,9 +20,11 @@ const (
 // NewTaskScheduler creates a new task scheduler.
 func NewTaskScheduler(logger *zap.Logger, server *Server) *TaskScheduler {
 	return &TaskScheduler{
-		l:         logger,
-		executors: make(map[string]TaskExecutor),
-		server:    server,
+		l:                 logger,
+		executors:         make(map[string]TaskExecutor),
+		server:            server,
+		queuedPipelineIDs: make(map[int]bool),
+		pipelineCounter:   NewPipelineCounter(),
 	}
 }
 
@@ -32,6 +34,14 @@ type TaskScheduler struct {
 	executors map[string]TaskExecutor
 
 	server *Server
+
+	// queuedPipelineIDs records the pipelines waiting for running because the plan's concurrent pipeline limit is reached.
+	queuedMu          sync.RWMutex
+	queuedPipelineIDs map[int]bool
+
+	// pipelineCounter counts the active pipelines per project. It's reconciled against the database
+	// on the first run.
+	pipelineCounter *PipelineCounter
 }
 
 // Run will run the task scheduler.
@@ -42,6 +52,7 @@ func (s *TaskScheduler) Run(ctx context.Context, wg *sync.WaitGroup) {
 	s.l.Debug(fmt.Sprintf("Task scheduler started and will run every %v", taskSchedulerInterval))
 	runningTasks := make(map[int]bool)
 	mu := sync.RWMutex{}
+	pipelineCounterReconciled := false
 	for {
 		select {
 		case <-ticker.C:
@@ -68,6 +79,7 @@ func (s *TaskScheduler) Run(ctx context.Context, wg *sync.WaitGroup) {
 					s.l.Error("Failed to retrieve open pipelines", zap.Error(err))
 					return
 				}
+				var composedPipelineList []*api.Pipeline
 				for _, pipeline := range pipelineList {
 					if pipeline.ID == api.OnboardingPipelineID {
 						continue
@@ -80,15 +92,26 @@ func (s *TaskScheduler) Run(ctx context.Context, wg *sync.WaitGroup) {
 						)
 						continue
 					}
+					composedPipelineList = append(composedPipelineList, pipeline)
+				}
 
-					if _, err := s.server.ScheduleNextTaskIfNeeded(ctx, pipeline); err != nil {
-						s.l.Error("Failed to schedule next running task",
-							zap.Int("pipeline_id", pipeline.ID),
-							zap.Error(err),
-						)
+				if !pipelineCounterReconciled {
+					if err := s.server.reconcilePipelineCounter(ctx, s.pipelineCounter, composedPipelineList); err != nil {
+						s.l.Error("Failed to reconcile the active pipeline counter", zap.Error(err))
+						return
 					}
+					pipelineCounterReconciled = true
 				}
 
+				queuedPipelineIDs := s.schedulePipelineList(composedPipelineList, s.server.getEffectivePlan().MaxConcurrentPipelines(), func(pipeline *api.Pipeline) (int, error) {
+					return s.server.findPipelineProjectID(ctx, pipeline.ID)
+				}, func(pipeline *api.Pipeline) (*api.Task, error) {
+					return s.server.ScheduleNextTaskIfNeeded(ctx, pipeline)
+				})
+				s.queuedMu.Lock()
+				s.queuedPipelineIDs = queuedPipelineIDs
+				s.queuedMu.Unlock()
+
 				// Inspect all running tasks
 				taskStatusList := []api.TaskStatus{api.TaskRunning}
 				taskFind := &api.TaskFind{
@@ -104,6 +127,10 @@ func (s *TaskScheduler) Run(ctx context.Context, wg *sync.WaitGroup) {
 					if task.ID == api.OnboardingTaskID1 || task.ID == api.OnboardingTaskID2 {
 						continue
 					}
+					// The task failed by a transient error waits for the backoff of its retry policy.
+					if task.NextRetryTs > time.Now().Unix() {
+						continue
+					}
 
 					executor, ok := s.executors[string(task.Type)]
 					if !ok {
@@ -169,6 +196,8 @@ func (s *TaskScheduler) Run(ctx context.Context, wg *sync.WaitGroup) {
 										zap.Error(err),
 									)
 								}
+							} else if s.server.retryTaskIfTransient(ctx, task, err) {
+								return
 							} else {
 								s.l.Debug("Failed to run task",
 									zap.Int("id", task.ID),
@@ -233,8 +262,94 @@ func (s *TaskScheduler) Register(taskType string, executor TaskExecutor) {
 	s.executors[taskType] = executor
 }
 
+// schedulePipelineList schedules the next task for each pipeline while keeping the number of active pipelines of each
+// project within maxConcurrentPipelines. A negative maxConcurrentPipelines means unlimited.
+// The pipeline about to start its first task is gated on the pipeline counter, which counts it as active until it's
+// completed or canceled. Pipelines exceeding the limit are queued rather than failed, and they will be scheduled once
+// an active pipeline of the project finishes.
+// Returns the IDs of the queued pipelines.
+func (s *TaskScheduler) schedulePipelineList(pipelineList []*api.Pipeline, maxConcurrentPipelines int, findProjectID func(pipeline *api.Pipeline) (int, error), scheduleNextTask func(pipeline *api.Pipeline) (*api.Task, error)) map[int]bool {
+	queuedPipelineIDs := make(map[int]bool)
+	for _, pipeline := range pipelineList {
+		_, queued, err := s.schedulePipeline(pipeline, maxConcurrentPipelines, findProjectID, scheduleNextTask)
+		if err != nil {
+			s.l.Error("Failed to schedule next running task",
+				zap.Int("pipeline_id", pipeline.ID),
+				zap.Error(err),
+			)
+			continue
+		}
+		if queued {
+			queuedPipelineIDs[pipeline.ID] = true
+		}
+	}
+	return queuedPipelineIDs
+}
+
+// SchedulePipeline schedules the next task of the pipeline gated on the concurrent pipeline limit of its project.
+// Returns nil if the pipeline is queued or no task applicable can be scheduled.
+func (s *TaskScheduler) SchedulePipeline(ctx context.Context, pipeline *api.Pipeline) (*api.Task, error) {
+	task, _, err := s.schedulePipeline(pipeline, s.server.getEffectivePlan().MaxConcurrentPipelines(), func(pipeline *api.Pipeline) (int, error) {
+		return s.server.findPipelineProjectID(ctx, pipeline.ID)
+	}, func(pipeline *api.Pipeline) (*api.Task, error) {
+		return s.server.ScheduleNextTaskIfNeeded(ctx, pipeline)
+	})
+	return task, err
+}
+
+// schedulePipeline schedules the next task of the pipeline. The pipeline about to start its first task is counted as
+// active only if its project has fewer than maxConcurrentPipelines active pipelines, otherwise it's queued.
+func (s *TaskScheduler) schedulePipeline(pipeline *api.Pipeline, maxConcurrentPipelines int, findProjectID func(pipeline *api.Pipeline) (int, error), scheduleNextTask func(pipeline *api.Pipeline) (*api.Task, error)) (*api.Task, bool, error) {
+	starting := !isPipelineStarted(pipeline) && isPipelinePendingToRun(pipeline)
+	if starting {
+		projectID, err := findProjectID(pipeline)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to find the project of pipeline %d: %w", pipeline.ID, err)
+		}
+		if !s.pipelineCounter.TryStart(projectID, pipeline.ID, maxConcurrentPipelines) {
+			return nil, true, nil
+		}
+	}
+
+	task, err := scheduleNextTask(pipeline)
+	// Release the slot if the first task doesn't start, e.g. it's blocked by the task check.
+	if starting && (err != nil || task == nil || task.Status != api.TaskRunning) {
+		s.pipelineCounter.Finish(pipeline.ID)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return task, false, nil
+}
+
+// FinishPipeline stops counting the completed or canceled pipeline as active.
+func (s *TaskScheduler) FinishPipeline(pipelineID int) {
+	s.pipelineCounter.Finish(pipelineID)
+}
+
+// IsPipelineActive returns true if the pipeline has started and is counted against the concurrent pipeline limit.
+func (s *TaskScheduler) IsPipelineActive(pipelineID int) bool {
+	return s.pipelineCounter.IsActive(pipelineID)
+}
+
+// IsPipelineQueued returns true if the pipeline is waiting for running because the plan's concurrent pipeline limit is reached.
+func (s *TaskScheduler) IsPipelineQueued(pipelineID int) bool {
+	s.queuedMu.RLock()
+	defer s.queuedMu.RUnlock()
+	return s.queuedPipelineIDs[pipelineID]
+}
+
 // ScheduleIfNeeded schedules the task if its required check does not contain error in the latest run
 func (s *TaskScheduler) ScheduleIfNeeded(ctx context.Context, task *api.Task) (*api.Task, error) {
+	// The approved task waits for the minimum hold duration of the approval policy to elapse.
+	holdUntil, err := s.server.findTaskHoldUntil(ctx, task, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if holdUntil != 0 {
+		return task, nil
+	}
+
 	// timing task check
 	if task.EarliestAllowedTs != 0 {
 		pass, err := s.server.passCheck(ctx, s.server, task, api.TaskCheckGeneralEarliestAllowedTime)
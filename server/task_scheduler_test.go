@@ -0,0 +1,137 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"go.uber.org/zap"
+)
+
+func TestSchedulePipelineList(t *testing.T) {
+	newPipeline := func(id int, status api.TaskStatus) *api.Pipeline {
+		return &api.Pipeline{
+			ID: id,
+			StageList: []*api.Stage{
+				{
+					TaskList: []*api.Task{
+						{ID: id, Status: status},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name                   string
+		maxConcurrentPipelines int
+		wantScheduled          []int
+		wantQueued             []int
+	}{
+		{
+			name:                   "FREE plan queues at limit",
+			maxConcurrentPipelines: api.FREE.MaxConcurrentPipelines(),
+			// Pipeline 1 is already running, so the pending pipelines 2 and 3 are queued.
+			// Pipeline 4 is pending approval and still gets its checks scheduled.
+			// Pipeline 5 belongs to another project without any active pipeline.
+			wantScheduled: []int{1, 4, 5},
+			wantQueued:    []int{2, 3},
+		},
+		{
+			name:                   "limit counts newly started pipelines",
+			maxConcurrentPipelines: 2,
+			wantScheduled:          []int{1, 2, 4, 5},
+			wantQueued:             []int{3},
+		},
+		{
+			name:                   "ENTERPRISE plan is unlimited",
+			maxConcurrentPipelines: api.ENTERPRISE.MaxConcurrentPipelines(),
+			wantScheduled:          []int{1, 2, 3, 4, 5},
+			wantQueued:             nil,
+		},
+	}
+
+	for _, test := range tests {
+		pipelineList := []*api.Pipeline{
+			newPipeline(1, api.TaskRunning),
+			newPipeline(2, api.TaskPending),
+			newPipeline(3, api.TaskPending),
+			newPipeline(4, api.TaskPendingApproval),
+			newPipeline(5, api.TaskPending),
+		}
+		var scheduled []int
+		scheduler := NewTaskScheduler(zap.NewNop(), nil)
+		// The running pipeline 1 is reconciled as active.
+		scheduler.pipelineCounter.Reconcile(map[int]int{1: 1})
+		queued := scheduler.schedulePipelineList(pipelineList, test.maxConcurrentPipelines, func(pipeline *api.Pipeline) (int, error) {
+			if pipeline.ID == 5 {
+				return 2, nil
+			}
+			return 1, nil
+		}, func(pipeline *api.Pipeline) (*api.Task, error) {
+			scheduled = append(scheduled, pipeline.ID)
+			task := pipeline.StageList[0].TaskList[0]
+			if task.Status == api.TaskPending {
+				task.Status = api.TaskRunning
+			}
+			return task, nil
+		})
+
+		if len(scheduled) != len(test.wantScheduled) {
+			t.Errorf("%q: got scheduled pipelines %v, want %v.", test.name, scheduled, test.wantScheduled)
+		} else {
+			for i := range scheduled {
+				if scheduled[i] != test.wantScheduled[i] {
+					t.Errorf("%q: got scheduled pipelines %v, want %v.", test.name, scheduled, test.wantScheduled)
+					break
+				}
+			}
+		}
+		if len(queued) != len(test.wantQueued) {
+			t.Errorf("%q: got queued pipelines %v, want %v.", test.name, queued, test.wantQueued)
+		}
+		for _, id := range test.wantQueued {
+			if !queued[id] {
+				t.Errorf("%q: pipeline %d got not queued, want queued.", test.name, id)
+			}
+		}
+	}
+}
+
+func TestSchedulePipelineReleasesUnstarted(t *testing.T) {
+	scheduler := NewTaskScheduler(zap.NewNop(), nil)
+	pipeline := &api.Pipeline{
+		ID: 1,
+		StageList: []*api.Stage{
+			{
+				TaskList: []*api.Task{
+					{ID: 1, Status: api.TaskPending},
+				},
+			},
+		},
+	}
+	findProjectID := func(pipeline *api.Pipeline) (int, error) {
+		return 1, nil
+	}
+
+	// The pipeline whose first task is blocked, e.g. by the task check, doesn't occupy the slot.
+	task, queued, err := scheduler.schedulePipeline(pipeline, 1, findProjectID, func(pipeline *api.Pipeline) (*api.Task, error) {
+		return pipeline.StageList[0].TaskList[0], nil
+	})
+	if err != nil || queued || task == nil {
+		t.Fatalf("schedulePipeline() got task %v, queued %v, error %v, want the pending task.", task, queued, err)
+	}
+	if scheduler.IsPipelineActive(pipeline.ID) {
+		t.Errorf("IsPipelineActive() got true for the blocked pipeline, want false.")
+	}
+
+	if _, _, err := scheduler.schedulePipeline(pipeline, 1, findProjectID, func(pipeline *api.Pipeline) (*api.Task, error) {
+		task := pipeline.StageList[0].TaskList[0]
+		task.Status = api.TaskRunning
+		return task, nil
+	}); err != nil {
+		t.Fatalf("schedulePipeline() got error %v, want OK.", err)
+	}
+	if !scheduler.IsPipelineActive(pipeline.ID) {
+		t.Errorf("IsPipelineActive() got false for the started pipeline, want true.")
+	}
+}
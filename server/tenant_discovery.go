@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+)
+
+// DiscoverTenantDatabases discovers the databases matching the label selector on the instances of the tenant project,
+// so that the tenant databases created on the instances are picked up for the rollouts staged by the deployment config.
+// Besides the databases of the project, the databases synced into the default project are discovered as well, since the
+// new databases land there before being transferred. The labels of a database are its stored labels, falling back to
+// the location and tenant parsed from its name by the database name template of the project. The empty selector matches
+// all the databases following the template. It's gated by the multi-tenancy feature.
+func (s *Server) DiscoverTenantDatabases(ctx context.Context, projectID int, labelSelector map[string]string) ([]*api.Database, error) {
+	if !s.feature(api.FeatureMultiTenancy) {
+		return nil, common.Errorf(common.NotAuthorized, fmt.Errorf(api.FeatureMultiTenancy.AccessErrorMessage()))
+	}
+	project, err := s.ProjectService.FindProject(ctx, &api.ProjectFind{ID: &projectID})
+	if err != nil {
+		return nil, err
+	}
+	if project == nil {
+		return nil, &common.Error{Code: common.NotFound, Err: fmt.Errorf("project ID not found: %d", projectID)}
+	}
+	if project.TenantMode != api.TenantModeTenant {
+		return nil, &common.Error{Code: common.Invalid, Err: fmt.Errorf("project %d isn't in tenant mode", projectID)}
+	}
+
+	projectDatabaseList, err := s.DatabaseService.FindDatabaseList(ctx, &api.DatabaseFind{ProjectID: &projectID})
+	if err != nil {
+		return nil, err
+	}
+	instanceIDMap := make(map[int]bool)
+	for _, database := range projectDatabaseList {
+		instanceIDMap[database.InstanceID] = true
+	}
+	var instanceIDList []int
+	for instanceID := range instanceIDMap {
+		instanceIDList = append(instanceIDList, instanceID)
+	}
+	sort.Ints(instanceIDList)
+
+	discoveredList := []*api.Database{}
+	for _, instanceID := range instanceIDList {
+		instanceID := instanceID
+		databaseList, err := s.DatabaseService.FindDatabaseList(ctx, &api.DatabaseFind{InstanceID: &instanceID})
+		if err != nil {
+			return nil, err
+		}
+		for _, database := range databaseList {
+			if database.ProjectID != projectID && database.ProjectID != api.DefaultProjectID {
+				continue
+			}
+			labels, ok := parseDatabaseNameLabels(database.Name, project.DBNameTemplate)
+			if !ok {
+				continue
+			}
+			// The labels aren't composed by FindDatabaseList, so load them from the label service.
+			rowStatus := api.Normal
+			labelList, err := s.LabelService.FindDatabaseLabelList(ctx, &api.DatabaseLabelFind{
+				DatabaseID: &database.ID,
+				RowStatus:  &rowStatus,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to find the labels of database %q: %w", database.Name, err)
+			}
+			for _, label := range labelList {
+				labels[label.Key] = label.Value
+			}
+			if !isLabelSelectorMatched(labels, labelSelector) {
+				continue
+			}
+			discoveredList = append(discoveredList, database)
+		}
+	}
+	return discoveredList, nil
+}
+
+// parseDatabaseNameLabels parses the location and the tenant labels from the database name by the database name template,
+// e.g. "blog_us" by "{{DB_NAME}}_{{TENANT}}" has the tenant "us". Returns false if the name doesn't follow the template.
+func parseDatabaseNameLabels(databaseName, dbNameTemplate string) (map[string]string, bool) {
+	labels := make(map[string]string)
+	if dbNameTemplate == "" {
+		return labels, true
+	}
+	tokenGroupMap := map[string]string{
+		api.DBNameToken:   `.+`,
+		api.LocationToken: `(?P<location>.+)`,
+		api.TenantToken:   `(?P<tenant>.+)`,
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	rest := dbNameTemplate
+	for _, token := range getTemplateTokenList(dbNameTemplate) {
+		i := strings.Index(rest, token)
+		expr.WriteString(regexp.QuoteMeta(rest[:i]))
+		group, ok := tokenGroupMap[token]
+		if !ok {
+			return nil, false
+		}
+		expr.WriteString(group)
+		rest = rest[i+len(token):]
+	}
+	expr.WriteString(regexp.QuoteMeta(rest))
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, false
+	}
+	match := re.FindStringSubmatch(databaseName)
+	if match == nil {
+		return nil, false
+	}
+	for i, name := range re.SubexpNames() {
+		switch name {
+		case "location":
+			labels[api.LocationLabelKey] = match[i]
+		case "tenant":
+			labels[api.TenantLabelKey] = match[i]
+		}
+	}
+	return labels, true
+}
+
+// getTemplateTokenList returns the tokens in the template in order, e.g. ["{{DB_NAME}}", "{{TENANT}}"].
+func getTemplateTokenList(template string) []string {
+	return regexp.MustCompile(`{{[^{}]+}}`).FindAllString(template, -1)
+}
+
+// isLabelSelectorMatched returns true if the labels contain all the labels of the selector.
+func isLabelSelectorMatched(labels map[string]string, labelSelector map[string]string) bool {
+	for key, value := range labelSelector {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
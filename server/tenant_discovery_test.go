@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	enterprise "github.com/bytebase/bytebase/enterprise/api"
+)
+
+// fakeProjectService serves the projects from memory.
+type fakeProjectService struct {
+	api.ProjectService
+	projectList []*api.Project
+}
+
+func (f *fakeProjectService) FindProject(ctx context.Context, find *api.ProjectFind) (*api.Project, error) {
+	for _, project := range f.projectList {
+		if project.ID == *find.ID {
+			return project, nil
+		}
+	}
+	return nil, nil
+}
+
+// fakeDatabaseService serves the databases from memory, filtered by the project or the instance.
+type fakeDatabaseService struct {
+	api.DatabaseService
+	databaseList []*api.Database
+}
+
+func (f *fakeDatabaseService) FindDatabaseList(ctx context.Context, find *api.DatabaseFind) ([]*api.Database, error) {
+	var list []*api.Database
+	for _, database := range f.databaseList {
+		if find.ProjectID != nil && database.ProjectID != *find.ProjectID {
+			continue
+		}
+		if find.InstanceID != nil && database.InstanceID != *find.InstanceID {
+			continue
+		}
+		list = append(list, database)
+	}
+	return list, nil
+}
+
+// fakeLabelService serves the database labels from memory.
+type fakeLabelService struct {
+	api.LabelService
+	labelMap map[int][]*api.DatabaseLabel
+}
+
+func (f *fakeLabelService) FindDatabaseLabelList(ctx context.Context, find *api.DatabaseLabelFind) ([]*api.DatabaseLabel, error) {
+	return f.labelMap[*find.DatabaseID], nil
+}
+
+func TestDiscoverTenantDatabases(t *testing.T) {
+	ctx := context.Background()
+	s := &Server{
+		subscription: &enterprise.Subscription{Plan: api.ENTERPRISE, ExpiresTs: time.Now().Add(time.Hour).Unix()},
+		ProjectService: &fakeProjectService{projectList: []*api.Project{
+			{ID: 101, TenantMode: api.TenantModeTenant, DBNameTemplate: "{{DB_NAME}}_{{TENANT}}"},
+			{ID: 102, TenantMode: api.TenantModeDisabled},
+		}},
+		DatabaseService: &fakeDatabaseService{databaseList: []*api.Database{
+			{ID: 1, InstanceID: 1, ProjectID: 101, Name: "blog_acme"},
+			{ID: 2, InstanceID: 2, ProjectID: 101, Name: "blog_globex"},
+			// The new tenant database synced into the default project, labeled by its name only.
+			{ID: 3, InstanceID: 2, ProjectID: api.DefaultProjectID, Name: "blog_initech"},
+			// The database of another project on the same instance isn't discovered.
+			{ID: 4, InstanceID: 1, ProjectID: 102, Name: "blog_umbrella"},
+			// The database not following the database name template isn't discovered.
+			{ID: 5, InstanceID: 2, ProjectID: api.DefaultProjectID, Name: "blog"},
+			// The instance without the database of the project isn't scanned.
+			{ID: 6, InstanceID: 3, ProjectID: api.DefaultProjectID, Name: "blog_hooli"},
+		}},
+		// The labels are stored apart from the databases, the same as FindDatabaseList leaving Labels empty.
+		LabelService: &fakeLabelService{labelMap: map[int][]*api.DatabaseLabel{
+			1: {{Key: api.LocationLabelKey, Value: "us"}},
+			2: {{Key: api.LocationLabelKey, Value: "eu"}},
+		}},
+	}
+
+	tests := []struct {
+		name          string
+		labelSelector map[string]string
+		wantIDList    []int
+	}{
+		{
+			name:          "match all",
+			labelSelector: nil,
+			wantIDList:    []int{1, 2, 3},
+		},
+		{
+			name:          "stored label",
+			labelSelector: map[string]string{api.LocationLabelKey: "eu"},
+			wantIDList:    []int{2},
+		},
+		{
+			name:          "label parsed from the name",
+			labelSelector: map[string]string{api.TenantLabelKey: "initech"},
+			wantIDList:    []int{3},
+		},
+		{
+			name:          "stored and parsed labels",
+			labelSelector: map[string]string{api.LocationLabelKey: "us", api.TenantLabelKey: "acme"},
+			wantIDList:    []int{1},
+		},
+	}
+
+	for _, test := range tests {
+		list, err := s.DiscoverTenantDatabases(ctx, 101, test.labelSelector)
+		if err != nil {
+			t.Fatalf("%q: DiscoverTenantDatabases() got error %v, want OK.", test.name, err)
+		}
+		var idList []int
+		for _, database := range list {
+			idList = append(idList, database.ID)
+		}
+		if !reflect.DeepEqual(idList, test.wantIDList) {
+			t.Errorf("%q: DiscoverTenantDatabases() got %v, want %v.", test.name, idList, test.wantIDList)
+		}
+	}
+
+	if _, err := s.DiscoverTenantDatabases(ctx, 102, nil); common.ErrorCode(err) != common.Invalid {
+		t.Errorf("DiscoverTenantDatabases() of the project not in tenant mode got error %v, want invalid.", err)
+	}
+	s.subscription = &enterprise.Subscription{Plan: api.FREE, ExpiresTs: time.Now().Add(time.Hour).Unix()}
+	if _, err := s.DiscoverTenantDatabases(ctx, 101, nil); common.ErrorCode(err) != common.NotAuthorized {
+		t.Errorf("DiscoverTenantDatabases() without the multi-tenancy feature got error %v, want not authorized.", err)
+	}
+}
+
+func TestParseDatabaseNameLabels(t *testing.T) {
+	tests := []struct {
+		databaseName   string
+		dbNameTemplate string
+		want           map[string]string
+		wantOK         bool
+	}{
+		{"blog", "", map[string]string{}, true},
+		{"blog_us_acme", "{{DB_NAME}}_{{LOCATION}}_{{TENANT}}", map[string]string{api.LocationLabelKey: "us", api.TenantLabelKey: "acme"}, true},
+		{"acme.blog", "{{TENANT}}.{{DB_NAME}}", map[string]string{api.TenantLabelKey: "acme"}, true},
+		{"acmeXblog", "{{TENANT}}.{{DB_NAME}}", nil, false},
+		{"blog", "{{DB_NAME}}_{{TENANT}}", nil, false},
+	}
+
+	for _, test := range tests {
+		got, ok := parseDatabaseNameLabels(test.databaseName, test.dbNameTemplate)
+		if ok != test.wantOK || (ok && !reflect.DeepEqual(got, test.want)) {
+			t.Errorf("parseDatabaseNameLabels(%q, %q) got %v %v, want %v %v.", test.databaseName, test.dbNameTemplate, got, ok, test.want, test.wantOK)
+		}
+	}
+}
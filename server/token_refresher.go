@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	vcsPlugin "github.com/bytebase/bytebase/plugin/vcs"
+	"go.uber.org/zap"
+)
+
+const (
+	tokenRefresherInterval = time.Duration(5) * time.Minute
+	// tokenRefreshWindow is how long before the expiry the access token is refreshed.
+	// It's longer than tokenRefresherInterval, so the access token is refreshed before it expires.
+	tokenRefreshWindow = time.Duration(15) * time.Minute
+)
+
+// errTokenRefreshConflict is returned when another refresh of the same repository, e.g. an on-demand refresh, stored its token first.
+var errTokenRefreshConflict = errors.New("the access token has been refreshed concurrently")
+
+// NewTokenRefresher creates a token refresher.
+func NewTokenRefresher(logger *zap.Logger, server *Server) *TokenRefresher {
+	return &TokenRefresher{
+		l:            logger,
+		server:       server,
+		refreshToken: server.refreshRepositoryToken,
+		now:          time.Now,
+	}
+}
+
+// TokenRefresher refreshes the access tokens of the repositories before they expire,
+// so the repositories rarely used don't end up with an expired refresh token.
+type TokenRefresher struct {
+	l      *zap.Logger
+	server *Server
+
+	// refreshToken refreshes the access token of the repository.
+	// Returns errTokenRefreshConflict if another refresh stored its token first.
+	refreshToken func(ctx context.Context, repository *api.Repository) error
+	now          func() time.Time
+}
+
+// RefreshReport is the result of a batch of token refreshes.
+type RefreshReport struct {
+	// RefreshedList is the IDs of the repositories whose access token is refreshed.
+	RefreshedList []int
+	// SkippedList is the IDs of the repositories whose access token is refreshed concurrently by others.
+	SkippedList []int
+	FailedList  []*RefreshFailure
+}
+
+// RefreshFailure is the failed token refresh of a repository.
+type RefreshFailure struct {
+	RepositoryID int
+	// Invalid is true if the failure is unrecoverable, in which case the token status is flipped to TokenInvalid.
+	// Otherwise, the refresh is retried in the next batch.
+	Invalid bool
+	Err     error
+}
+
+// Run will run the token refresher.
+func (r *TokenRefresher) Run(ctx context.Context, wg *sync.WaitGroup) {
+	ticker := time.NewTicker(tokenRefresherInterval)
+	defer ticker.Stop()
+	defer wg.Done()
+	r.l.Debug(fmt.Sprintf("Token refresher started and will run every %v", tokenRefresherInterval))
+	for {
+		select {
+		case <-ticker.C:
+			report, err := r.RefreshExpiringTokens(context.Background())
+			if err != nil {
+				r.l.Error("Failed to refresh the expiring access tokens", zap.Error(err))
+				continue
+			}
+			if len(report.RefreshedList) > 0 || len(report.FailedList) > 0 {
+				r.l.Info("Refreshed the expiring access tokens",
+					zap.Ints("refreshed", report.RefreshedList),
+					zap.Ints("skipped", report.SkippedList),
+					zap.Int("failed", len(report.FailedList)),
+				)
+			}
+		case <-ctx.Done(): // if cancel() execute
+			return
+		}
+	}
+}
+
+// RefreshExpiringTokens refreshes the access tokens expiring soon. The failure of a repository doesn't abort the batch,
+// it's recorded in the report instead. Returns error only if the expiring repositories can't be found.
+func (r *TokenRefresher) RefreshExpiringTokens(ctx context.Context) (*RefreshReport, error) {
+	expiresBefore := r.now().Add(tokenRefreshWindow).Unix()
+	repositoryList, err := r.server.RepositoryService.FindExpiringRepositories(ctx, expiresBefore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the repositories with the access token expiring before %d: %w", expiresBefore, err)
+	}
+
+	report := &RefreshReport{}
+	for _, repository := range repositoryList {
+		r.refreshRepository(ctx, repository, report)
+	}
+	return report, nil
+}
+
+// refreshRepository refreshes the access token of the repository and records the result to the report.
+func (r *TokenRefresher) refreshRepository(ctx context.Context, repository *api.Repository, report *RefreshReport) {
+	err := func() (err error) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				panicErr, ok := rec.(error)
+				if !ok {
+					panicErr = fmt.Errorf("%v", rec)
+				}
+				err = fmt.Errorf("token refresh PANIC RECOVER: %w", panicErr)
+			}
+		}()
+		return r.refreshToken(ctx, repository)
+	}()
+
+	switch {
+	case err == nil:
+		report.RefreshedList = append(report.RefreshedList, repository.ID)
+	case errors.Is(err, errTokenRefreshConflict) || (errors.Is(err, vcsPlugin.ErrTokenInvalid) && r.refreshedConcurrently(ctx, repository)):
+		// The VCS rejects the refresh token used by a concurrent refresh, which isn't a failure.
+		report.SkippedList = append(report.SkippedList, repository.ID)
+	case errors.Is(err, vcsPlugin.ErrTokenInvalid):
+		tokenStatus := api.TokenInvalid
+		if _, patchErr := r.server.RepositoryService.PatchRepository(ctx, &api.RepositoryPatch{
+			ID:          repository.ID,
+			UpdaterID:   api.SystemBotID,
+			TokenStatus: &tokenStatus,
+		}); patchErr != nil {
+			r.l.Error("Failed to mark the access token invalid",
+				zap.Int("repository_id", repository.ID),
+				zap.Error(patchErr),
+			)
+		}
+		r.server.requestRepositoryStatusMetricsRefresh()
+		report.FailedList = append(report.FailedList, &RefreshFailure{RepositoryID: repository.ID, Invalid: true, Err: err})
+		r.l.Warn("The access token is invalid, the repository needs to be linked again",
+			zap.Int("repository_id", repository.ID),
+			zap.String("repository", repository.FullPath),
+			zap.Error(err),
+		)
+	default:
+		report.FailedList = append(report.FailedList, &RefreshFailure{RepositoryID: repository.ID, Err: err})
+		r.l.Warn("Failed to refresh the access token, will retry",
+			zap.Int("repository_id", repository.ID),
+			zap.String("repository", repository.FullPath),
+			zap.Error(err),
+		)
+	}
+}
+
+// refreshedConcurrently returns true if the refresh token of the repository has been changed since it was found.
+func (r *TokenRefresher) refreshedConcurrently(ctx context.Context, repository *api.Repository) bool {
+	current, err := r.server.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ID: &repository.ID, IncludeSecrets: true})
+	if err != nil || current == nil {
+		return false
+	}
+	return current.RefreshToken != repository.RefreshToken
+}
+
+// refreshRepositoryToken refreshes the access token of the repository by its VCS provider.
+// Returns errTokenRefreshConflict if another refresh stored its token first.
+func (s *Server) refreshRepositoryToken(ctx context.Context, repository *api.Repository) error {
+	vcs, err := s.VCSService.FindVCS(ctx, &api.VCSFind{ID: &repository.VCSID})
+	if err != nil {
+		return fmt.Errorf("failed to find VCS for repository ID %d: %w", repository.ID, err)
+	}
+	if vcs == nil {
+		return fmt.Errorf("VCS not found for repository ID %d", repository.ID)
+	}
+
+	return vcsPlugin.Get(vcs.Type, vcsPlugin.ProviderConfig{Logger: s.l}).RefreshToken(
+		ctx,
+		common.OauthContext{
+			ClientID:     vcs.ApplicationID,
+			ClientSecret: vcs.Secret,
+			AccessToken:  repository.AccessToken,
+			RefreshToken: repository.RefreshToken,
+			Refresher: func(token, refreshToken string, expiresTs int64) error {
+				swapped, err := s.swapRepositoryToken(ctx, repository, token, refreshToken, expiresTs)
+				if err != nil {
+					return err
+				}
+				if !swapped {
+					return errTokenRefreshConflict
+				}
+				return nil
+			},
+		},
+		vcs.InstanceURL,
+	)
+}
+
+// swapRepositoryToken stores the refreshed access token of the repository, unless another refresh stored its token first.
+func (s *Server) swapRepositoryToken(ctx context.Context, repository *api.Repository, token, refreshToken string, expiresTs int64) (bool, error) {
+	return s.RepositoryService.SwapRepositoryToken(ctx, &api.RepositoryTokenSwap{
+		ID:              repository.ID,
+		UpdaterID:       api.SystemBotID,
+		OldRefreshToken: repository.RefreshToken,
+		AccessToken:     token,
+		ExpiresTs:       expiresTs,
+		RefreshToken:    refreshToken,
+	})
+}
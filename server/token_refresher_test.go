@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	vcsPlugin "github.com/bytebase/bytebase/plugin/vcs"
+	"go.uber.org/zap"
+)
+
+func (f *fakeRepositoryService) FindExpiringRepositories(ctx context.Context, expiresBefore int64) ([]*api.Repository, error) {
+	var list []*api.Repository
+	for _, repository := range f.repositoryList {
+		if repository.TokenStatus == api.TokenValid && repository.TokenExpired(expiresBefore) {
+			copied := *repository
+			list = append(list, &copied)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeRepositoryService) FindRepository(ctx context.Context, find *api.RepositoryFind) (*api.Repository, error) {
+	for _, repository := range f.repositoryList {
+		if (find.ID == nil || repository.ID == *find.ID) && (find.ProjectID == nil || repository.ProjectID == *find.ProjectID) {
+			copied := *repository
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func TestRefreshExpiringTokens(t *testing.T) {
+	now := time.Unix(1650000000, 0)
+	expiring := now.Add(time.Minute).Unix()
+	notExpiring := now.Add(time.Hour).Unix()
+	repositoryService := &fakeRepositoryService{
+		repositoryList: []*api.Repository{
+			{ID: 1, TokenStatus: api.TokenValid, ExpiresTs: &expiring, RefreshToken: "refresh-1"},
+			// The VCS is unavailable, which is retried in the next batch.
+			{ID: 2, TokenStatus: api.TokenValid, ExpiresTs: &expiring, RefreshToken: "refresh-2"},
+			// The refresh token is revoked.
+			{ID: 3, TokenStatus: api.TokenValid, ExpiresTs: &expiring, RefreshToken: "refresh-3"},
+			// An on-demand refresh stores its token first.
+			{ID: 4, TokenStatus: api.TokenValid, ExpiresTs: &expiring, RefreshToken: "refresh-4"},
+			// An on-demand refresh has used the refresh token, so the VCS rejects it.
+			{ID: 5, TokenStatus: api.TokenValid, ExpiresTs: &expiring, RefreshToken: "refresh-5"},
+			{ID: 6, TokenStatus: api.TokenValid, ExpiresTs: &expiring, RefreshToken: "refresh-6"},
+			// Not refreshed: expiring later, never expiring and already invalid.
+			{ID: 7, TokenStatus: api.TokenValid, ExpiresTs: &notExpiring, RefreshToken: "refresh-7"},
+			{ID: 8, TokenStatus: api.TokenValid, RefreshToken: "refresh-8"},
+			{ID: 9, TokenStatus: api.TokenInvalid, ExpiresTs: &expiring, RefreshToken: "refresh-9"},
+		},
+	}
+	refresher := NewTokenRefresher(zap.NewNop(), &Server{l: zap.NewNop(), RepositoryService: repositoryService})
+	refresher.now = func() time.Time { return now }
+	var attempts []int
+	refresher.refreshToken = func(ctx context.Context, repository *api.Repository) error {
+		attempts = append(attempts, repository.ID)
+		switch repository.ID {
+		case 2:
+			return fmt.Errorf("gitlab is unavailable")
+		case 3:
+			return fmt.Errorf("failed to fetch refresh token: %w", vcsPlugin.ErrTokenInvalid)
+		case 4:
+			return errTokenRefreshConflict
+		case 5:
+			repositoryService.repositoryList[4].RefreshToken = "refresh-5-on-demand"
+			return fmt.Errorf("failed to fetch refresh token: %w", vcsPlugin.ErrTokenInvalid)
+		case 6:
+			panic("unexpected response")
+		}
+		return nil
+	}
+
+	report, err := refresher.RefreshExpiringTokens(context.Background())
+	if err != nil {
+		t.Fatalf("RefreshExpiringTokens() got error %v, want OK.", err)
+	}
+
+	if want := []int{1, 2, 3, 4, 5, 6}; !reflect.DeepEqual(attempts, want) {
+		t.Errorf("RefreshExpiringTokens() attempted %v, want %v.", attempts, want)
+	}
+	if want := []int{1}; !reflect.DeepEqual(report.RefreshedList, want) {
+		t.Errorf("RefreshExpiringTokens() got refreshed %v, want %v.", report.RefreshedList, want)
+	}
+	if want := []int{4, 5}; !reflect.DeepEqual(report.SkippedList, want) {
+		t.Errorf("RefreshExpiringTokens() got skipped %v, want %v.", report.SkippedList, want)
+	}
+	var failed []string
+	for _, failure := range report.FailedList {
+		failed = append(failed, fmt.Sprintf("%d:%v", failure.RepositoryID, failure.Invalid))
+	}
+	if want := []string{"2:false", "3:true", "6:false"}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("RefreshExpiringTokens() got failed %v, want %v.", failed, want)
+	}
+
+	// Only the repository with the revoked refresh token is marked invalid.
+	for _, repository := range repositoryService.repositoryList {
+		want := api.TokenValid
+		if repository.ID == 3 || repository.ID == 9 {
+			want = api.TokenInvalid
+		}
+		if repository.TokenStatus != want {
+			t.Errorf("repository %d got token status %v, want %v.", repository.ID, repository.TokenStatus, want)
+		}
+	}
+}
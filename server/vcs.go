@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bytebase/bytebase/api"
 	"github.com/bytebase/bytebase/common"
@@ -14,6 +15,22 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// SetVCSMaxFileSize sets the maximum size in bytes of a file read from the VCS. Non-positive means vcs.DefaultMaxFileSize.
+func (s *Server) SetVCSMaxFileSize(maxFileSize int64) {
+	if maxFileSize <= 0 {
+		maxFileSize = vcs.DefaultMaxFileSize
+	}
+	s.vcsMaxFileSize = maxFileSize
+}
+
+// vcsProviderConfig returns the config of the VCS providers used by the server.
+func (s *Server) vcsProviderConfig() vcs.ProviderConfig {
+	return vcs.ProviderConfig{
+		Logger:      s.l,
+		MaxFileSize: s.vcsMaxFileSize,
+	}
+}
+
 func (s *Server) registerVCSRoutes(g *echo.Group) {
 	g.POST("/vcs", func(c echo.Context) error {
 		ctx := context.Background()
@@ -25,7 +42,7 @@ func (s *Server) registerVCSRoutes(g *echo.Group) {
 		}
 		// Trim ending "/"
 		vcsCreate.InstanceURL = strings.TrimRight(vcsCreate.InstanceURL, "/")
-		vcsCreate.APIURL = vcs.Get(vcs.GitLabSelfHost, vcs.ProviderConfig{Logger: s.l}).APIURL(vcsCreate.InstanceURL)
+		vcsCreate.APIURL = vcs.Get(vcs.GitLabSelfHost, s.vcsProviderConfig()).APIURL(vcsCreate.InstanceURL)
 
 		vcs, err := s.VCSService.CreateVCS(ctx, vcsCreate)
 		if err != nil {
@@ -140,6 +157,240 @@ func (s *Server) registerVCSRoutes(g *echo.Group) {
 		return nil
 	})
 
+	g.POST("/vcs/:vcsID/oauth/authorize", func(c echo.Context) error {
+		ctx := context.Background()
+		id, err := strconv.Atoi(c.Param("vcsID"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("ID is not a number: %s", c.Param("vcsID"))).SetInternal(err)
+		}
+
+		vcsFind := &api.VCSFind{
+			ID: &id,
+		}
+		vcs, err := s.VCSService.FindVCS(ctx, vcsFind)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch vcs ID: %v", id)).SetInternal(err)
+		}
+		if vcs == nil {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("VCS not found with ID: %d", id))
+		}
+
+		state, codeChallenge, err := s.createOAuthState(ctx, id, c.Get(getPrincipalIDContextKey()).(int), time.Now())
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to start OAuth authorization").SetInternal(err)
+		}
+		authorize := &api.VCSOAuthAuthorize{
+			State:               state,
+			CodeChallenge:       codeChallenge,
+			CodeChallengeMethod: oauthCodeChallengeMethod,
+		}
+
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+		if err := jsonapi.MarshalPayload(c.Response().Writer, authorize); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal OAuth authorize response for vcs ID: %v", id)).SetInternal(err)
+		}
+		return nil
+	})
+
+	g.POST("/vcs/:vcsID/oauth/token", func(c echo.Context) error {
+		ctx := context.Background()
+		id, err := strconv.Atoi(c.Param("vcsID"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("ID is not a number: %s", c.Param("vcsID"))).SetInternal(err)
+		}
+
+		exchange := &api.VCSOAuthExchange{}
+		if err := jsonapi.UnmarshalPayload(c.Request().Body, exchange); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Malformatted OAuth token exchange request").SetInternal(err)
+		}
+
+		// Verify the state before calling the provider, the code verifier can only be used once.
+		principalID := c.Get(getPrincipalIDContextKey()).(int)
+		codeVerifier, err := s.consumeOAuthState(ctx, exchange.State, id, principalID, time.Now())
+		if err != nil {
+			if common.ErrorCode(err) == common.Invalid {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to verify OAuth state for vcs ID: %v", id)).SetInternal(err)
+		}
+
+		vcsFind := &api.VCSFind{
+			ID: &id,
+		}
+		vcsConfig, err := s.VCSService.FindVCS(ctx, vcsFind)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch vcs ID: %v", id)).SetInternal(err)
+		}
+		if vcsConfig == nil {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("VCS not found with ID: %d", id))
+		}
+
+		token, err := vcs.Get(vcsConfig.Type, s.vcsProviderConfig()).ExchangeOAuthToken(
+			ctx,
+			vcsConfig.InstanceURL,
+			&vcs.OAuthExchange{
+				ClientID:     vcsConfig.ApplicationID,
+				ClientSecret: vcsConfig.Secret,
+				Code:         exchange.Code,
+				RedirectURL:  exchange.RedirectURL,
+				CodeVerifier: codeVerifier,
+			},
+		)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Failed to exchange OAuth token for vcs ID: %v", id)).SetInternal(err)
+		}
+		// The repository is linked by the ticket, so the client can't submit a token not exchanged here.
+		ticket, err := s.issueOAuthTicket(ctx, id, principalID, token, time.Now())
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to issue OAuth ticket for vcs ID: %v", id)).SetInternal(err)
+		}
+		vcsToken := &api.VCSOAuthToken{
+			AccessToken:  token.AccessToken,
+			RefreshToken: token.RefreshToken,
+			ExpiresTs:    token.ExpiresTs,
+			Ticket:       ticket,
+		}
+
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+		if err := jsonapi.MarshalPayload(c.Response().Writer, vcsToken); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal OAuth token response for vcs ID: %v", id)).SetInternal(err)
+		}
+		return nil
+	})
+
+	g.GET("/vcs/:vcsID/rate-limit", func(c echo.Context) error {
+		ctx := context.Background()
+		id, err := strconv.Atoi(c.Param("vcsID"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("ID is not a number: %s", c.Param("vcsID"))).SetInternal(err)
+		}
+
+		vcsFind := &api.VCSFind{
+			ID: &id,
+		}
+		vcsConfig, err := s.VCSService.FindVCS(ctx, vcsFind)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch vcs ID: %v", id)).SetInternal(err)
+		}
+		if vcsConfig == nil {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("VCS not found with ID: %d", id))
+		}
+
+		rateLimit := &api.VCSRateLimit{VCSID: id}
+		if state := vcs.Get(vcsConfig.Type, s.vcsProviderConfig()).RateLimit(vcsConfig.InstanceURL); state != nil {
+			rateLimit.Known = true
+			rateLimit.Limit = state.Limit
+			rateLimit.Remaining = state.Remaining
+			rateLimit.ResetTs = state.ResetTs
+			rateLimit.RetryAfterTs = state.RetryAfterTs
+			rateLimit.UpdatedTs = state.UpdatedTs
+		}
+
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+		if err := jsonapi.MarshalPayload(c.Response().Writer, rateLimit); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal rate limit response for vcs ID: %v", id)).SetInternal(err)
+		}
+		return nil
+	})
+
+	g.GET("/vcs/:vcsID/capability", func(c echo.Context) error {
+		ctx := context.Background()
+		id, err := strconv.Atoi(c.Param("vcsID"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("ID is not a number: %s", c.Param("vcsID"))).SetInternal(err)
+		}
+
+		vcsFind := &api.VCSFind{
+			ID: &id,
+		}
+		vcsConfig, err := s.VCSService.FindVCS(ctx, vcsFind)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch vcs ID: %v", id)).SetInternal(err)
+		}
+		if vcsConfig == nil {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("VCS not found with ID: %d", id))
+		}
+
+		capability := &api.VCSCapability{VCSID: id}
+		if capabilities := vcs.Get(vcsConfig.Type, s.vcsProviderConfig()).Capabilities(vcsConfig.InstanceURL); capabilities != nil {
+			capability.Known = true
+			capability.Version = capabilities.Version
+			capability.CommitStatus = capabilities.CommitStatus
+			capability.DetectedTs = capabilities.DetectedTs
+		}
+
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+		if err := jsonapi.MarshalPayload(c.Response().Writer, capability); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal capability response for vcs ID: %v", id)).SetInternal(err)
+		}
+		return nil
+	})
+
+	// Previews updating the templates of all repositories in the VCS, flagging the repositories the new templates would break.
+	g.POST("/vcs/:vcsID/repository/template-preview", func(c echo.Context) error {
+		ctx := context.Background()
+		id, err := strconv.Atoi(c.Param("vcsID"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("ID is not a number: %s", c.Param("vcsID"))).SetInternal(err)
+		}
+		templateUpdate := &api.BulkTemplateUpdate{}
+		if err := jsonapi.UnmarshalPayload(c.Request().Body, templateUpdate); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Malformatted bulk template update request").SetInternal(err)
+		}
+
+		preview, err := s.PreviewBulkTemplateUpdate(ctx, id, templateUpdate.FilePathTemplate, templateUpdate.SchemaPathTemplate)
+		if err != nil {
+			if common.ErrorCode(err) == common.NotFound {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to preview bulk template update for vcs ID: %v", id)).SetInternal(err)
+		}
+
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+		if err := jsonapi.MarshalPayload(c.Response().Writer, preview); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal bulk template update preview response for vcs ID: %v", id)).SetInternal(err)
+		}
+		return nil
+	})
+
+	// Updates the templates of the repositories in the VCS confirmed from the preview.
+	g.POST("/vcs/:vcsID/repository/template", func(c echo.Context) error {
+		ctx := context.Background()
+		id, err := strconv.Atoi(c.Param("vcsID"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("ID is not a number: %s", c.Param("vcsID"))).SetInternal(err)
+		}
+		templateUpdate, confirmedIDList, err := unmarshalBulkTemplateUpdate(c.Request().Body)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Malformatted bulk template update request").SetInternal(err)
+		}
+		if len(confirmedIDList) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Malformatted bulk template update request, missing the confirmed repositories")
+		}
+
+		list, err := s.ApplyBulkTemplateUpdate(ctx, id, templateUpdate.FilePathTemplate, templateUpdate.SchemaPathTemplate, confirmedIDList, c.Get(getPrincipalIDContextKey()).(int))
+		if err != nil {
+			switch common.ErrorCode(err) {
+			case common.NotFound:
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			case common.Invalid:
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to apply bulk template update for vcs ID: %v", id)).SetInternal(err)
+		}
+		for _, repository := range list {
+			if err := s.composeRepositoryRelationship(ctx, repository); err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch repository relationship: %v", repository.ID)).SetInternal(err)
+			}
+		}
+
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+		if err := jsonapi.MarshalPayload(c.Response().Writer, list); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal repository list response for vcs ID: %v", id)).SetInternal(err)
+		}
+		return nil
+	})
+
 	g.GET("/vcs/:vcsID/repository", func(c echo.Context) error {
 		ctx := context.Background()
 		id, err := strconv.Atoi(c.Param("vcsID"))
@@ -150,6 +401,16 @@ func (s *Server) registerVCSRoutes(g *echo.Group) {
 		repositoryFind := &api.RepositoryFind{
 			VCSID: &id,
 		}
+		if labelSelector := c.QueryParam("labelSelector"); labelSelector != "" {
+			labels, err := api.ParseRepositoryLabelSelector(labelSelector)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid label selector %q: %s", labelSelector, err.Error()))
+			}
+			repositoryFind.LabelSelector = labels
+		}
+		if searchTerm := c.QueryParam("search"); searchTerm != "" {
+			repositoryFind.SearchTerm = &searchTerm
+		}
 		list, err := s.RepositoryService.FindRepositoryList(ctx, repositoryFind)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to fetch repository list for vcs ID: %v", id)).SetInternal(err)
@@ -3,9 +3,11 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strconv"
@@ -21,17 +23,58 @@ import (
 	"go.uber.org/zap"
 )
 
-var (
-	gitLabWebhookPath = "hook/gitlab"
+const (
+	// webhookGroupPath is the path prefix of the webhook routes.
+	webhookGroupPath = "/hook"
+	// gitLabWebhookRoute is the route of the GitLab webhook relative to the webhookGroupPath.
+	gitLabWebhookRoute = "/gitlab/:id"
+	// DefaultWebhookMaxBodySize is the default maximum size in bytes of the webhook request body.
+	DefaultWebhookMaxBodySize = 2 << 20
 )
 
+// SetWebhookMaxBodySize sets the maximum size in bytes of the webhook request body. Non-positive means DefaultWebhookMaxBodySize.
+func (s *Server) SetWebhookMaxBodySize(maxBodySize int64) {
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultWebhookMaxBodySize
+	}
+	s.webhookMaxBodySize = maxBodySize
+}
+
+// readWebhookBody reads the webhook request body up to maxBodySize bytes. The endpoint is publicly exposed, so the oversized body
+// is rejected with 413 before being buffered in memory, and before any processing including the verification.
+// Non-positive maxBodySize means DefaultWebhookMaxBodySize.
+func readWebhookBody(w http.ResponseWriter, r *http.Request, maxBodySize int64) ([]byte, error) {
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultWebhookMaxBodySize
+	}
+	tooLarge := echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("Webhook request body exceeds the maximum of %d bytes", maxBodySize))
+	if r.ContentLength > maxBodySize {
+		return nil, tooLarge
+	}
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		// The reader fails after reading maxBodySize bytes if the body without the content length, e.g. chunked, is oversized.
+		if int64(len(b)) >= maxBodySize {
+			return nil, tooLarge.SetInternal(err)
+		}
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Failed to read webhook request").SetInternal(err)
+	}
+	return b, nil
+}
+
+// WebhookCallbackPath returns the path of the webhook callback URL for the webhook endpoint ID.
+// It's the single source of truth for the path served by the route registered in registerWebhookRoutes.
+func WebhookCallbackPath(endpointID string) string {
+	return webhookGroupPath + strings.Replace(gitLabWebhookRoute, ":id", endpointID, 1)
+}
+
 func (s *Server) registerWebhookRoutes(g *echo.Group) {
-	g.POST("/gitlab/:id", func(c echo.Context) error {
+	g.POST(gitLabWebhookRoute, func(c echo.Context) error {
 		ctx := context.Background()
-		var b []byte
-		b, err := io.ReadAll(c.Request().Body)
+		// The body is read once for both the verification and the parsing.
+		b, err := readWebhookBody(c.Response(), c.Request(), s.webhookMaxBodySize)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusBadRequest, "Failed to read webhook request").SetInternal(err)
+			return err
 		}
 
 		pushEvent := &gitlab.WebhookPushEvent{}
@@ -39,16 +82,30 @@ func (s *Server) registerWebhookRoutes(g *echo.Group) {
 			return echo.NewHTTPError(http.StatusBadRequest, "Malformatted push event").SetInternal(err)
 		}
 
-		// This shouldn't happen as we only setup webhook to receive push event, just in case.
-		if pushEvent.ObjectKind != gitlab.WebhookPush {
-			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid webhook event type, got %s, want push", pushEvent.ObjectKind))
+		// We only setup webhook to receive push and tag push events. The merge request events are received if enabled in the VCS.
+		if pushEvent.ObjectKind != gitlab.WebhookPush && pushEvent.ObjectKind != gitlab.WebhookTagPush && pushEvent.ObjectKind != gitlab.WebhookMergeRequest {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid webhook event type, got %s, want push, tag_push or merge_request", pushEvent.ObjectKind))
+		}
+
+		// There is nothing to read at the zero SHA after deleting the branch or tag.
+		if pushEvent.IsRefDeletion() {
+			s.l.Info("Ignored push event deleting the ref.", zap.String("ref", pushEvent.Ref))
+			return c.String(http.StatusOK, fmt.Sprintf("Ignored deletion of %s", pushEvent.Ref))
+		}
+		if pushEvent.IsBranchCreation() {
+			s.l.Info("Ignored push event creating the branch.", zap.String("ref", pushEvent.Ref))
+			return c.String(http.StatusOK, fmt.Sprintf("Ignored creation of %s", pushEvent.Ref))
 		}
 
 		webhookEndpointID := c.Param("id")
-		repositoryFind := &api.RepositoryFind{
-			WebhookEndpointID: &webhookEndpointID,
+		route, ok := s.routeWebhookEndpoint(ctx, webhookEndpointID)
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Endpoint not found: %v", webhookEndpointID))
 		}
-		repository, err := s.RepositoryService.FindRepository(ctx, repositoryFind)
+		if route != nil && route.VCSType != vcs.GitLabSelfHost {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Endpoint %v isn't a GitLab webhook, got %s", webhookEndpointID, route.VCSType))
+		}
+		repository, err := s.RepositoryService.GetRepositoryByWebhookEndpoint(ctx, webhookEndpointID)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to respond webhook event for endpoint: %v", webhookEndpointID)).SetInternal(err)
 		}
@@ -63,6 +120,9 @@ func (s *Server) registerWebhookRoutes(g *echo.Group) {
 			err := fmt.Errorf("VCS not found for ID: %v", repository.VCSID)
 			return echo.NewHTTPError(http.StatusInternalServerError, err).SetInternal(err)
 		}
+		if route == nil {
+			s.webhookRoutes.put(repository)
+		}
 
 		if c.Request().Header.Get("X-Gitlab-Token") != repository.WebhookSecretToken {
 			return echo.NewHTTPError(http.StatusBadRequest, "Secret token mismatch")
@@ -72,198 +132,392 @@ func (s *Server) registerWebhookRoutes(g *echo.Group) {
 			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Project mismatch, got %d, want %s", pushEvent.Project.ID, repository.ExternalID))
 		}
 
-		createdMessageList := []string{}
+		// The quarantined repository keeps failing until the operator fixes the config and un-quarantines it.
+		if repository.SyncStatus == api.SyncQuarantined {
+			s.l.Debug("Ignored webhook event of the quarantined repository.", zap.Int("repository_id", repository.ID), zap.String("ref", pushEvent.Ref))
+			return c.String(http.StatusOK, fmt.Sprintf("Ignored %s, the repository is quarantined after %d consecutive sync failures", pushEvent.Ref, repository.SyncFailureCount))
+		}
+
+		var mergeRequest *gitlab.WebhookMergeRequestAttributes
+		if pushEvent.ObjectKind == gitlab.WebhookMergeRequest {
+			mergeRequestEvent := &gitlab.WebhookMergeRequestEvent{}
+			if err := json.Unmarshal(b, mergeRequestEvent); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "Malformatted merge request event").SetInternal(err)
+			}
+			mergeRequest = &mergeRequestEvent.ObjectAttributes
+		}
+
+		// Acknowledge the verified event so the VCS provider won't treat it as a failure, and replay it after the maintenance.
+		if inMaintenance, deferred := s.deferWebhookEventIfInMaintenance(repository, pushEvent, mergeRequest); inMaintenance {
+			if !deferred {
+				return echo.NewHTTPError(http.StatusServiceUnavailable, fmt.Sprintf("Too many webhook events deferred during maintenance, the limit is %d", maxDeferredWebhookEventCount))
+			}
+			if mergeRequest != nil {
+				s.l.Info("Deferred merge request event during maintenance.", zap.Int("repository_id", repository.ID), zap.Int("merge_request", mergeRequest.IID))
+				return c.String(http.StatusAccepted, fmt.Sprintf("Deferred merge request !%d during maintenance", mergeRequest.IID))
+			}
+			s.l.Info("Deferred webhook event during maintenance.", zap.Int("repository_id", repository.ID), zap.String("ref", pushEvent.Ref))
+			return c.String(http.StatusAccepted, fmt.Sprintf("Deferred %s during maintenance", pushEvent.Ref))
+		}
+
+		if mergeRequest != nil {
+			if !isMergeRequestTargetMatched(repository, mergeRequest.TargetBranch, s.l) {
+				s.l.Debug("Ignored merge request event, the target branch not matching the target branch filter.",
+					zap.Int("merge_request", mergeRequest.IID),
+					zap.String("target_branch", mergeRequest.TargetBranch),
+					zap.String("target_branch_filter", repository.TargetBranchFilter),
+				)
+				return c.String(http.StatusOK, fmt.Sprintf("Ignored merge request !%d targeting %s not matching the target branch filter", mergeRequest.IID, mergeRequest.TargetBranch))
+			}
+			// The review reads every migration file of the merge request, so it runs in the background to respond the
+			// event before GitLab times out. Failing to post the schema review comment doesn't fail the event either way.
+			if isSchemaReviewAction(mergeRequest.Action) {
+				go func() {
+					if err := s.reviewMergeRequest(ctx, repository, *mergeRequest); err != nil {
+						s.l.Warn("Failed to post the schema review comment on the merge request.", zap.Int("merge_request", mergeRequest.IID), zap.Error(err))
+					}
+				}()
+			}
+			s.l.Info("Accepted merge request event.", zap.Int("merge_request", mergeRequest.IID), zap.String("target_branch", mergeRequest.TargetBranch))
+			return c.String(http.StatusOK, fmt.Sprintf("Accepted merge request !%d targeting %s", mergeRequest.IID, mergeRequest.TargetBranch))
+		}
+
+		// GitLab doesn't filter the tag push events, so we match the tag against the branch filter ourselves.
+		if pushEvent.ObjectKind == gitlab.WebhookTagPush && !isTagRefMatched(repository.BranchFilter, pushEvent.Ref, s.l) {
+			s.l.Debug("Ignored tag push event, not matching the branch filter.", zap.String("ref", pushEvent.Ref), zap.String("branch_filter", repository.BranchFilter))
+			return c.String(http.StatusOK, fmt.Sprintf("Ignored %s not matching the branch filter", pushEvent.Ref))
+		}
+
+		branchEnvironment, ok := resolveBranchEnvironment(repository, pushEvent.Ref)
+		if !ok {
+			s.l.Debug("Ignored push event, the branch isn't mapped to any environment.", zap.String("ref", pushEvent.Ref))
+			return c.String(http.StatusOK, fmt.Sprintf("Ignored %s not mapped to any environment", pushEvent.Ref))
+		}
+
+		done, stale := s.pushOrder.begin(repository.ID, pushEvent.Ref, latestCommitTs(pushEvent))
+		defer done()
+		if stale {
+			s.l.Info("Ignored stale push event, older than the last processed one.", zap.String("ref", pushEvent.Ref), zap.String("after", pushEvent.After))
+			return c.String(http.StatusOK, fmt.Sprintf("Ignored stale push to %s, older than the last processed one", pushEvent.Ref))
+		}
+
+		// Another replica may be processing a push to the same repository, e.g. the redelivered event.
+		release, claimed, err := s.claimRepositorySync(ctx, repository.ID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to claim the sync of repository %v", repository.Name)).SetInternal(err)
+		}
+		if !claimed {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, fmt.Sprintf("Repository %v is being synced by another replica", repository.Name))
+		}
+		defer release()
+
+		startedTime := time.Now()
+		if commit := findSkippingCommit(repository, pushEvent); commit != nil {
+			s.recordSkippedPushEvent(ctx, repository, pushEvent, commit)
+			skippedMessage := fmt.Sprintf("Skipped push to %s by the skip directive %q in commit %s", pushEvent.Ref, repository.SkipDirective, commit.ID)
+			s.recordSyncHistory(ctx, repository.ID, pushEvent.Ref, pushEvent.After, startedTime, api.RepositorySyncSuccess, skippedMessage)
+			return c.String(http.StatusOK, skippedMessage)
+		}
+
+		var fileList []*pushedFile
 		for _, commit := range pushEvent.CommitList {
+			if reason := s.verifyPushedCommit(ctx, repository, pushEvent, commit); reason != "" {
+				continue
+			}
 			for _, added := range commit.AddedList {
-				if !strings.HasPrefix(added, repository.BaseDirectory) {
-					s.l.Debug("Ignored committed file, not under base directory.", zap.String("file", added), zap.String("base_directory", repository.BaseDirectory))
-					continue
-				}
+				fileList = append(fileList, &pushedFile{commit: commit, added: added})
+			}
+		}
+		manifest, checksumMap := s.readMigrationManifest(ctx, repository, pushEvent.After)
+		fileList, missingList := orderPushedFileList(repository, fileList, manifest)
+		for _, file := range missingList {
+			s.warnMissingFromManifest(ctx, repository, pushEvent, file)
+		}
 
-				createdTime, err := time.Parse(time.RFC3339, commit.Timestamp)
+		failSync := func(err error) error {
+			s.recordSyncHistory(ctx, repository.ID, pushEvent.Ref, pushEvent.After, startedTime, api.RepositorySyncFailed, err.Error())
+			s.recordSyncResult(ctx, repository, pushEvent, api.RepositorySyncFailed, err.Error())
+			return err
+		}
+		// The migrations pushed together are applied by a single issue in order, except for the tenant mode project
+		// whose pipeline is generated from a single migration by the deployment config.
+		createdMessageList := []string{}
+		var migrationList []*pushedMigration
+		for _, file := range fileList {
+			migration, _, err := s.preparePushedFile(ctx, repository, pushEvent, file.commit, file.added, branchEnvironment, checksumMap)
+			if err != nil {
+				return failSync(err)
+			}
+			if migration == nil {
+				continue
+			}
+			if repository.Project.TenantMode == api.TenantModeTenant {
+				issue, err := s.createPushIssue(ctx, repository, []*pushedMigration{migration})
 				if err != nil {
-					s.l.Warn("Ignored committed file, failed to parse commit timestamp.", zap.String("file", added), zap.String("timestamp", commit.Timestamp), zap.Error(err))
+					return failSync(err)
 				}
+				createdMessageList = append(createdMessageList, fmt.Sprintf("Created issue %q on adding %s", issue.Name, file.added))
+				continue
+			}
+			migrationList = append(migrationList, migration)
+		}
+		if len(migrationList) > 0 {
+			issue, err := s.createPushIssue(ctx, repository, migrationList)
+			if err != nil {
+				return failSync(err)
+			}
+			for _, migration := range migrationList {
+				createdMessageList = append(createdMessageList, fmt.Sprintf("Created issue %q on adding %s", issue.Name, migration.vcsPushEvent.FileCommit.Added))
+			}
+		}
 
-				// Ignored the schema file we auto generated to the repository.
-				if isSkipGeneratedSchemaFile(repository, added, s.l) {
-					continue
-				}
+		createdMessage := strings.Join(createdMessageList, "\n")
+		s.recordSyncHistory(ctx, repository.ID, pushEvent.Ref, pushEvent.After, startedTime, api.RepositorySyncSuccess, createdMessage)
+		s.recordSyncResult(ctx, repository, pushEvent, api.RepositorySyncSuccess, createdMessage)
+		return c.String(http.StatusOK, createdMessage)
+	})
+}
 
-				vcsPushEvent := vcs.PushEvent{
-					VCSType:            repository.VCS.Type,
-					BaseDirectory:      repository.BaseDirectory,
-					Ref:                pushEvent.Ref,
-					RepositoryID:       strconv.Itoa(pushEvent.Project.ID),
-					RepositoryURL:      pushEvent.Project.WebURL,
-					RepositoryFullPath: pushEvent.Project.FullPath,
-					AuthorName:         pushEvent.AuthorName,
-					FileCommit: vcs.FileCommit{
-						ID:         commit.ID,
-						Title:      commit.Title,
-						Message:    commit.Message,
-						CreatedTs:  createdTime.Unix(),
-						URL:        commit.URL,
-						AuthorName: commit.Author.Name,
-						Added:      added,
-					},
-				}
+// processPushedFile creates the issue applying the file added by the commit in the push event to the matching databases.
+// Returns the reason if the file is skipped, in which case no issue is created. A warning project activity is created
+// for the skipped file looking like a migration file. The file is verified against checksumMap, see verifyMigrationChecksum.
+func (s *Server) processPushedFile(ctx context.Context, repository *api.Repository, pushEvent *gitlab.WebhookPushEvent, commit gitlab.WebhookCommit, added string, branchEnvironment string, checksumMap map[string]string) (*api.Issue, string, error) {
+	migration, reason, err := s.preparePushedFile(ctx, repository, pushEvent, commit, added, branchEnvironment, checksumMap)
+	if migration == nil {
+		return nil, reason, err
+	}
+	issue, err := s.createPushIssue(ctx, repository, []*pushedMigration{migration})
+	if err != nil {
+		return nil, "", err
+	}
+	return issue, "", nil
+}
 
-				// Create a WARNING project activity if committed file is ignored
-				var createIgnoredFileActivity = func(err error) {
-					s.l.Warn("Ignored committed file", zap.String("file", added), zap.Error(err))
-					bytes, marshalErr := json.Marshal(api.ActivityProjectRepositoryPushPayload{
-						VCSPushEvent: vcsPushEvent,
-					})
-					if marshalErr != nil {
-						s.l.Warn("Failed to construct project activity payload to record ignored repository committed file", zap.Error(marshalErr))
-						return
-					}
+// preparePushedFile prepares the migration of the file added by the commit in the push event to the matching databases,
+// which is applied by the issue created by createPushIssue. Returns the reason if the file is skipped the same as processPushedFile.
+func (s *Server) preparePushedFile(ctx context.Context, repository *api.Repository, pushEvent *gitlab.WebhookPushEvent, commit gitlab.WebhookCommit, added string, branchEnvironment string, checksumMap map[string]string) (*pushedMigration, string, error) {
+	if !strings.HasPrefix(added, repository.BaseDirectory) {
+		s.l.Debug("Ignored committed file, not under base directory.", zap.String("file", added), zap.String("base_directory", repository.BaseDirectory))
+		return nil, fmt.Sprintf("not under the base directory %q", repository.BaseDirectory), nil
+	}
 
-					activityCreate := &api.ActivityCreate{
-						CreatorID:   api.SystemBotID,
-						ContainerID: repository.ProjectID,
-						Type:        api.ActivityProjectRepositoryPush,
-						Level:       api.ActivityWarn,
-						Comment:     fmt.Sprintf("Ignored committed file %q, %s.", added, err.Error()),
-						Payload:     string(bytes),
-					}
-					_, err = s.ActivityManager.CreateActivity(ctx, activityCreate, &ActivityMeta{})
-					if err != nil {
-						s.l.Warn("Failed to create project activity to record ignored repository committed file", zap.Error(err))
-					}
-				}
+	createdTime, err := time.Parse(time.RFC3339, commit.Timestamp)
+	if err != nil {
+		s.l.Warn("Ignored committed file, failed to parse commit timestamp.", zap.String("file", added), zap.String("timestamp", commit.Timestamp), zap.Error(err))
+	}
 
-				mi, err := db.ParseMigrationInfo(added, filepath.Join(repository.BaseDirectory, repository.FilePathTemplate))
-				if err != nil {
-					createIgnoredFileActivity(err)
-					continue
-				}
+	// Ignored the schema file we auto generated to the repository.
+	if isSkipGeneratedSchemaFile(repository, added, s.l) {
+		return nil, fmt.Sprintf("matches the schema path template %q", repository.SchemaPathTemplate), nil
+	}
 
-				// Retrieve sql by reading the file content
-				content, err := vcs.Get(vcs.GitLabSelfHost, vcs.ProviderConfig{Logger: s.l}).ReadFile(
-					ctx,
-					common.OauthContext{
-						ClientID:     repository.VCS.ApplicationID,
-						ClientSecret: repository.VCS.Secret,
-						AccessToken:  repository.AccessToken,
-						RefreshToken: repository.RefreshToken,
-						Refresher:    s.refreshToken(ctx, repository.ID),
-					},
-					repository.VCS.InstanceURL,
-					repository.ExternalID,
-					added,
-					commit.ID,
-				)
-				if err != nil {
-					createIgnoredFileActivity(err)
-					continue
-				}
+	vcsPushEvent := composeVCSPushEvent(repository, pushEvent, commit, added, createdTime)
 
-				// Create schema update issue.
-				var createContext string
-				if repository.Project.TenantMode == api.TenantModeTenant {
-					if !s.feature(api.FeatureMultiTenancy) {
-						return echo.NewHTTPError(http.StatusForbidden, api.FeatureMultiTenancy.AccessErrorMessage())
-					}
-					createContext, err = s.createTenantSchemaUpdateIssue(ctx, repository, mi, vcsPushEvent, commit, added, content)
-				} else {
-					createContext, err = s.createSchemaUpdateIssue(ctx, repository, mi, vcsPushEvent, commit, added, content)
-				}
-				if err != nil {
-					createIgnoredFileActivity(err)
-					continue
-				}
+	// Create a project activity recording the committed file not applied
+	var createFileActivity = func(level api.ActivityLevel, comment string) {
+		bytes, marshalErr := json.Marshal(api.ActivityProjectRepositoryPushPayload{
+			VCSPushEvent: vcsPushEvent,
+		})
+		if marshalErr != nil {
+			s.l.Warn("Failed to construct project activity payload to record ignored repository committed file", zap.Error(marshalErr))
+			return
+		}
 
-				issueType := api.IssueDatabaseSchemaUpdate
-				if mi.Type == db.Data {
-					issueType = api.IssueDatabaseDataUpdate
-				}
-				issueCreate := &api.IssueCreate{
-					ProjectID:     repository.ProjectID,
-					Name:          commit.Title,
-					Type:          issueType,
-					Description:   commit.Message,
-					AssigneeID:    api.SystemBotID,
-					CreateContext: createContext,
-				}
-				issue, err := s.createIssue(ctx, issueCreate, api.SystemBotID)
-				if err != nil {
-					errMsg := "Failed to create schema update issue"
-					if issueType == api.IssueDatabaseDataUpdate {
-						errMsg = "Failed to create data update issue"
-					}
-					return echo.NewHTTPError(http.StatusInternalServerError, errMsg).SetInternal(err)
-				}
+		activityCreate := &api.ActivityCreate{
+			CreatorID:   api.SystemBotID,
+			ContainerID: repository.ProjectID,
+			Type:        api.ActivityProjectRepositoryPush,
+			Level:       level,
+			Comment:     comment,
+			Payload:     string(bytes),
+		}
+		if _, err := s.ActivityManager.CreateActivity(ctx, activityCreate, &ActivityMeta{}); err != nil {
+			s.l.Warn("Failed to create project activity to record ignored repository committed file", zap.Error(err))
+		}
+	}
+	// Create a WARNING project activity if committed file is ignored
+	var createIgnoredFileActivity = func(err error) {
+		s.l.Warn("Ignored committed file", zap.String("file", added), zap.Error(err))
+		createFileActivity(api.ActivityWarn, fmt.Sprintf("Ignored committed file %q, %s.", added, err.Error()))
+	}
 
-				createdMessageList = append(createdMessageList, fmt.Sprintf("Created issue %q on adding %s", issue.Name, added))
+	mi, err := db.ParseMigrationInfo(added, filepath.Join(repository.BaseDirectory, repository.FilePathTemplate))
+	if err != nil {
+		createIgnoredFileActivity(err)
+		return nil, err.Error(), nil
+	}
 
-				// Create a project activity after successfully creating the issue as the result of the push event
-				bytes, err := json.Marshal(api.ActivityProjectRepositoryPushPayload{
-					VCSPushEvent: vcsPushEvent,
-					IssueID:      issue.ID,
-					IssueName:    issue.Name,
-				})
-				if err != nil {
-					return echo.NewHTTPError(http.StatusInternalServerError, "Failed to construct activity payload").SetInternal(err)
-				}
+	// Ignored the file matching the ignore path patterns even if it matches the file path template.
+	if isIgnoredPath(repository, added, s.l) {
+		return nil, fmt.Sprintf("matches the ignore path patterns %q", strings.Join(repository.IgnorePathPatterns, ",")), nil
+	}
 
-				activityCreate := &api.ActivityCreate{
-					CreatorID:   api.SystemBotID,
-					ContainerID: repository.ProjectID,
-					Type:        api.ActivityProjectRepositoryPush,
-					Level:       api.ActivityInfo,
-					Comment:     fmt.Sprintf("Created issue %q.", issue.Name),
-					Payload:     string(bytes),
-				}
-				if _, err = s.ActivityManager.CreateActivity(ctx, activityCreate, &ActivityMeta{}); err != nil {
-					return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to create project activity after creating issue from repository push event: %d", issue.ID)).SetInternal(err)
-				}
-			}
+	// Retrieve sql by reading the file content
+	content, err := vcs.Get(vcs.GitLabSelfHost, s.vcsProviderConfig()).ReadFile(
+		ctx,
+		common.OauthContext{
+			ClientID:     repository.VCS.ApplicationID,
+			ClientSecret: repository.VCS.Secret,
+			AccessToken:  repository.AccessToken,
+			RefreshToken: repository.RefreshToken,
+			Refresher:    s.refreshToken(ctx, repository),
+		},
+		repository.VCS.InstanceURL,
+		repository.ExternalID,
+		added,
+		commit.ID,
+	)
+	if err != nil {
+		if errors.Is(err, vcs.ErrFileTooLarge) {
+			err = fmt.Errorf("file size exceeds the maximum of %d bytes", s.vcsMaxFileSize)
 		}
+		createIgnoredFileActivity(err)
+		return nil, err.Error(), nil
+	}
 
-		return c.String(http.StatusOK, strings.Join(createdMessageList, "\n"))
-	})
+	// Refuse to apply the committed file mismatching its checksum in the manifest with an ERROR project activity for the audit.
+	if err := verifyMigrationChecksum(checksumMap, added, content); err != nil {
+		s.l.Error("Rejected committed file failing the checksum verification", zap.String("file", added), zap.Error(err))
+		createFileActivity(api.ActivityError, fmt.Sprintf("Rejected committed file %q, %s.", added, err.Error()))
+		return nil, err.Error(), nil
+	}
+
+	// For the schema ref, the baseline is read at the schema ref, e.g. the release tag, instead of the pushed commit.
+	// For the directory schema source, the baseline is formed from the schema files instead of the committed file.
+	if mi.Type == db.Baseline && repository.SchemaRef != "" {
+		content, err = s.readSchemaAtRef(ctx, repository, composeSchemaSyncPath(repository, mi, added))
+		if err != nil {
+			err = fmt.Errorf("failed to read the schema at schema ref %q, %w", repository.SchemaRef, err)
+			createIgnoredFileActivity(err)
+			return nil, err.Error(), nil
+		}
+	} else if mi.Type == db.Baseline && repository.SchemaSourceType == api.SchemaSourceDirectory {
+		content, err = s.readSchemaDirectory(ctx, repository, composeSchemaPath(repository, mi.Environment, mi.Database), commit.ID)
+		if err != nil {
+			err = fmt.Errorf("failed to read the schema directory, %w", err)
+			createIgnoredFileActivity(err)
+			return nil, err.Error(), nil
+		}
+	}
+
+	// The baseline schema may be empty, e.g. of a new database, so only the migrations are checked.
+	if mi.Type != db.Baseline {
+		skipReason, err := resolveEmptyMigration(repository.EmptyMigrationPolicy, content)
+		if err != nil {
+			createIgnoredFileActivity(err)
+			return nil, err.Error(), nil
+		}
+		if skipReason != "" {
+			s.l.Info("Skipped empty migration file.", zap.String("file", added), zap.String("reason", skipReason))
+			return nil, skipReason, nil
+		}
+	}
+
+	// Create schema update issue.
+	var createContext string
+	if repository.Project.TenantMode == api.TenantModeTenant {
+		if !s.feature(api.FeatureMultiTenancy) {
+			return nil, "", echo.NewHTTPError(http.StatusForbidden, api.FeatureMultiTenancy.AccessErrorMessage())
+		}
+		createContext, err = s.createTenantSchemaUpdateIssue(ctx, repository, mi, vcsPushEvent, commit, added, content)
+	} else {
+		createContext, err = s.createSchemaUpdateIssue(ctx, repository, mi, vcsPushEvent, commit, added, content, branchEnvironment)
+	}
+	if err != nil {
+		createIgnoredFileActivity(err)
+		return nil, err.Error(), nil
+	}
+
+	return &pushedMigration{
+		mi:            mi,
+		vcsPushEvent:  vcsPushEvent,
+		createContext: createContext,
+	}, "", nil
 }
 
-func (s *Server) createSchemaUpdateIssue(ctx context.Context, repository *api.Repository, mi *db.MigrationInfo, vcsPushEvent vcs.PushEvent, commit gitlab.WebhookCommit, added string, statement string) (string, error) {
-	// Find matching database list
-	databaseFind := &api.DatabaseFind{
-		ProjectID: &repository.ProjectID,
-		Name:      &mi.Database,
+// createPushIssue creates a single issue applying the migrations pushed together in order, and a project activity
+// for each of the migration files.
+func (s *Server) createPushIssue(ctx context.Context, repository *api.Repository, migrationList []*pushedMigration) (*api.Issue, error) {
+	issueCreate, err := composePushIssueCreate(migrationList)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to compose issue from the push event").SetInternal(err)
 	}
-	databaseList, err := s.composeDatabaseListByFind(ctx, databaseFind)
+	issueCreate.ProjectID = repository.ProjectID
+	headPushEvent := migrationList[len(migrationList)-1].vcsPushEvent
+	issueCreate.AssigneeID = s.resolveIssueAssignee(ctx, repository, &headPushEvent)
+	issue, err := s.createIssue(ctx, issueCreate, api.SystemBotID)
 	if err != nil {
-		return "", fmt.Errorf("failed to find database matching database %q referenced by the committed file", mi.Database)
-	} else if len(databaseList) == 0 {
-		return "", fmt.Errorf("project ID %d does not own database %q referenced by the committed file", repository.ProjectID, mi.Database)
-	}
-
-	// We support 3 patterns on how to organize the schema files.
-	// Pattern 1: 	The database name is the same across all environments. Each environment will have its own directory, so the
-	//              schema file looks like "dev/v1__db1", "staging/v1__db1".
-	//
-	// Pattern 2: 	Like 1, the database name is the same across all environments. All environment shares the same schema file,
-	//              say v1__db1, when a new file is added like v2__db1__add_column, we will create a multi stage pipeline where
-	//              each stage corresponds to an environment.
-	//
-	// Pattern 3:  	The database name is different among different environments. In such case, the database name alone is enough
-	//             	to identify ambiguity.
-
-	// Further filter by environment name if applicable.
-	filteredDatabaseList := []*api.Database{}
-	if mi.Environment != "" {
-		for _, database := range databaseList {
-			// Environment name comparison is case insensitive
-			if strings.EqualFold(database.Instance.Environment.Name, mi.Environment) {
-				filteredDatabaseList = append(filteredDatabaseList, database)
-			}
+		errMsg := "Failed to create schema update issue"
+		if issueCreate.Type == api.IssueDatabaseDataUpdate {
+			errMsg = "Failed to create data update issue"
+		}
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, errMsg).SetInternal(err)
+	}
+
+	// Create a project activity after successfully creating the issue as the result of the push event
+	for _, migration := range migrationList {
+		bytes, err := json.Marshal(api.ActivityProjectRepositoryPushPayload{
+			VCSPushEvent: migration.vcsPushEvent,
+			IssueID:      issue.ID,
+			IssueName:    issue.Name,
+		})
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to construct activity payload").SetInternal(err)
+		}
+
+		activityCreate := &api.ActivityCreate{
+			CreatorID:   api.SystemBotID,
+			ContainerID: repository.ProjectID,
+			Type:        api.ActivityProjectRepositoryPush,
+			Level:       api.ActivityInfo,
+			Comment:     fmt.Sprintf("Created issue %q.", issue.Name),
+			Payload:     string(bytes),
+		}
+		if _, err = s.ActivityManager.CreateActivity(ctx, activityCreate, &ActivityMeta{}); err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("Failed to create project activity after creating issue from repository push event: %d", issue.ID)).SetInternal(err)
 		}
+	}
+
+	return issue, nil
+}
+
+// composeVCSPushEvent composes the push event of the file added by the commit, which is recorded in the project activity payload.
+func composeVCSPushEvent(repository *api.Repository, pushEvent *gitlab.WebhookPushEvent, commit gitlab.WebhookCommit, added string, createdTime time.Time) vcs.PushEvent {
+	return vcs.PushEvent{
+		VCSType:            repository.VCS.Type,
+		BaseDirectory:      repository.BaseDirectory,
+		Ref:                pushEvent.Ref,
+		RepositoryID:       strconv.Itoa(pushEvent.Project.ID),
+		RepositoryURL:      pushEvent.Project.WebURL,
+		RepositoryFullPath: pushEvent.Project.FullPath,
+		AuthorName:         pushEvent.AuthorName,
+		FileCommit: vcs.FileCommit{
+			ID:          commit.ID,
+			Title:       commit.Title,
+			Message:     commit.Message,
+			CreatedTs:   createdTime.Unix(),
+			URL:         commit.URL,
+			AuthorName:  commit.Author.Name,
+			AuthorEmail: commit.Author.Email,
+			Added:       added,
+		},
+	}
+}
+
+// branchEnvironment is the name of the environment mapped from the pushed branch. If not empty, only the databases in the environment are updated.
+func (s *Server) createSchemaUpdateIssue(ctx context.Context, repository *api.Repository, mi *db.MigrationInfo, vcsPushEvent vcs.PushEvent, commit gitlab.WebhookCommit, added string, statement string, branchEnvironment string) (string, error) {
+	filteredDatabaseList, err := s.resolveDatabaseList(ctx, repository, &vcsPushEvent)
+	if err != nil {
+		return "", err
+	}
+	if len(filteredDatabaseList) == 0 {
+		return "", fmt.Errorf("no database is resolved for the committed file %q", added)
+	}
+	if branchEnvironment != "" {
+		filteredDatabaseList = filterDatabaseListByEnvironment(filteredDatabaseList, branchEnvironment)
 		if len(filteredDatabaseList) == 0 {
-			return "", fmt.Errorf("project does not contain committed file database %q for environment %q", mi.Database, mi.Environment)
+			return "", fmt.Errorf("no database %q referenced by the committed file in environment %q mapped from the branch", mi.Database, branchEnvironment)
 		}
-	} else {
-		filteredDatabaseList = databaseList
 	}
 
 	// It could happen that for a particular environment a project contain 2 database with the same name.
@@ -282,6 +536,35 @@ func (s *Server) createSchemaUpdateIssue(ctx context.Context, repository *api.Re
 		return "", fmt.Errorf("Ignored committed files with multiple ambiguous databases %s", strings.Join(multipleDatabaseForSameEnv, ", "))
 	}
 
+	// Skip the databases the same baseline schema has been synced to, e.g. on a no-op push.
+	if mi.Type == db.Baseline {
+		filteredDatabaseList, err = s.filterChangedSchemaDatabaseList(ctx, filteredDatabaseList, composeSchemaSyncPath(repository, mi, added), statement)
+		if err != nil {
+			return "", fmt.Errorf("failed to find the schema last synced from %q, %w", added, err)
+		}
+		if len(filteredDatabaseList) == 0 {
+			return "", fmt.Errorf("the schema is unchanged since it was last synced to database %q", mi.Database)
+		}
+	}
+
+	// Resolve the version applied from another commit with different content, e.g. the same version on two branches.
+	claimList, err := findMigrationVersionClaimList(ctx, filteredDatabaseList, mi.Version, s.l)
+	if err != nil {
+		return "", fmt.Errorf("failed to check the duplicate of version %s, %w", mi.Version, err)
+	}
+	version, err := resolveDuplicateVersion(repository.DuplicateVersionPolicy, mi.Version, &migrationVersionClaim{
+		ref:       vcsPushEvent.Ref,
+		commitID:  vcsPushEvent.FileCommit.ID,
+		commitTs:  vcsPushEvent.FileCommit.CreatedTs,
+		statement: statement,
+	}, claimList)
+	if err != nil {
+		return "", err
+	}
+	if version != mi.Version {
+		vcsPushEvent.MigrationVersion = version
+	}
+
 	// Compose the new issue
 	m := &api.UpdateSchemaContext{
 		MigrationType: mi.Type,
@@ -306,6 +589,7 @@ func (s *Server) createTenantSchemaUpdateIssue(ctx context.Context, repository *
 	if mi.Environment != "" {
 		return "", fmt.Errorf("environment isn't accepted in schema update for tenant mode project")
 	}
+	// The pipeline is staged by the deployment config referenced by the repository, or the one of the project if not referenced.
 	m := &api.UpdateSchemaContext{
 		MigrationType: mi.Type,
 		VCSPushEvent:  &vcsPushEvent,
@@ -315,6 +599,7 @@ func (s *Server) createTenantSchemaUpdateIssue(ctx context.Context, repository *
 				Statement:    statement,
 			},
 		},
+		DeploymentConfigID: repository.DeploymentConfigID,
 	}
 	createContext, err := json.Marshal(m)
 	if err != nil {
@@ -346,3 +631,102 @@ func isSkipGeneratedSchemaFile(repository *api.Repository, added string, logger
 	}
 	return false
 }
+
+// isTagBranchFilter returns true if the branch filter is configured for tags, e.g. "refs/tags/v*".
+func isTagBranchFilter(branchFilter string) bool {
+	return strings.HasPrefix(branchFilter, gitlab.TagRefPrefix)
+}
+
+// isTagRefMatched returns true if the tag ref matches the branch filter configured for tags.
+func isTagRefMatched(branchFilter string, ref string, logger *zap.Logger) bool {
+	if !isTagBranchFilter(branchFilter) {
+		return false
+	}
+	matched, err := path.Match(branchFilter, ref)
+	if err != nil {
+		logger.Warn("Invalid branch filter.", zap.String("branch_filter", branchFilter), zap.Error(err))
+		return false
+	}
+	return matched
+}
+
+// isMergeRequestTargetMatched returns true if the target branch of the merge request matches the target branch filter of the repository,
+// which is independent of the branch filter for the push events. Empty target branch filter matches all branches.
+func isMergeRequestTargetMatched(repository *api.Repository, targetBranch string, logger *zap.Logger) bool {
+	return isBranchMatched(repository.TargetBranchFilter, targetBranch, logger)
+}
+
+// resolveBranchEnvironment returns the name of the environment mapped from the pushed ref by the branch environment mapping of the repository.
+// Returns false if the ref isn't mapped, in which case the push should be ignored. Tags are mapped by the full ref, e.g. "refs/tags/v1.0.0".
+func resolveBranchEnvironment(repository *api.Repository, ref string) (string, bool) {
+	return repository.BranchEnvironmentMapping.ResolveEnvironment(strings.TrimPrefix(ref, "refs/heads/"))
+}
+
+// filterDatabaseListByEnvironment returns the databases in the environment. Environment name comparison is case insensitive.
+func filterDatabaseListByEnvironment(databaseList []*api.Database, environmentName string) []*api.Database {
+	var filteredDatabaseList []*api.Database
+	for _, database := range databaseList {
+		if strings.EqualFold(database.Instance.Environment.Name, environmentName) {
+			filteredDatabaseList = append(filteredDatabaseList, database)
+		}
+	}
+	return filteredDatabaseList
+}
+
+func isIgnoredPath(repository *api.Repository, added string, logger *zap.Logger) bool {
+	for _, pattern := range repository.IgnorePathPatterns {
+		matched, err := path.Match(pattern, added)
+		if err != nil {
+			logger.Warn("Invalid ignore path pattern.",
+				zap.String("pattern", pattern),
+				zap.Error(err),
+			)
+			continue
+		}
+		if matched {
+			logger.Debug("Ignored committed file, matched ignore path pattern.", zap.String("file", added), zap.String("pattern", pattern))
+			return true
+		}
+	}
+	return false
+}
+
+// composeIssueFromCommit composes the issue name and description from the commit creating the migration file.
+// The first line of the commit message becomes the name and the rest becomes the description, followed by the commit author and link.
+func composeIssueFromCommit(commit vcs.FileCommit) (string, string) {
+	name, body := parseCommitMessage(commit.Message)
+	if name == "" {
+		name = strings.TrimSpace(commit.Title)
+	}
+	if name == "" {
+		name = fmt.Sprintf("Apply %s", path.Base(commit.Added))
+	}
+
+	var trailerList []string
+	if commit.AuthorName != "" {
+		author := commit.AuthorName
+		if commit.AuthorEmail != "" {
+			author = fmt.Sprintf("%s <%s>", commit.AuthorName, commit.AuthorEmail)
+		}
+		trailerList = append(trailerList, fmt.Sprintf("Author: %s", author))
+	}
+	if commit.URL != "" {
+		trailerList = append(trailerList, fmt.Sprintf("Commit: %s", commit.URL))
+	}
+	trailer := strings.Join(trailerList, "\n")
+	if body == "" || trailer == "" {
+		return name, body + trailer
+	}
+	return name, body + "\n\n" + trailer
+}
+
+// parseCommitMessage splits the commit message into the title, which is the first non-empty line, and the body.
+// Both are empty if the message is empty.
+func parseCommitMessage(message string) (string, string) {
+	message = strings.TrimSpace(strings.ReplaceAll(message, "\r\n", "\n"))
+	lines := strings.SplitN(message, "\n", 2)
+	if len(lines) == 1 {
+		return strings.TrimSpace(lines[0]), ""
+	}
+	return strings.TrimSpace(lines[0]), strings.TrimSpace(lines[1])
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bytebase/bytebase/common"
+)
+
+// WebhookHostResolver resolves the host of the webhook callback URL from the logical host key stored in the repository,
+// so that the webhooks of the repositories can be routed through different ingress hosts, e.g. one per region.
+type WebhookHostResolver interface {
+	// ResolveWebhookHost returns the host, e.g. "https://eu.bytebase.example.com", of the logical host key, e.g. "eu".
+	// Returns error if the host key is unknown.
+	ResolveWebhookHost(hostKey string) (string, error)
+}
+
+// webhookHostMap is the WebhookHostResolver resolving the logical host keys by the configured hosts.
+type webhookHostMap map[string]string
+
+// NewWebhookHostResolver creates a WebhookHostResolver resolving the logical host keys by hostMap.
+func NewWebhookHostResolver(hostMap map[string]string) WebhookHostResolver {
+	return webhookHostMap(hostMap)
+}
+
+func (m webhookHostMap) ResolveWebhookHost(hostKey string) (string, error) {
+	host, ok := m[hostKey]
+	if !ok {
+		return "", &common.Error{Code: common.Invalid, Err: fmt.Errorf("unknown webhook host key %q", hostKey)}
+	}
+	return host, nil
+}
+
+// ParseWebhookHostMap parses the webhook hosts in the form of "eu=https://eu.example.com,us=https://us.example.com".
+func ParseWebhookHostMap(value string) (map[string]string, error) {
+	hostMap := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid webhook host %q, want the form of key=host", pair)
+		}
+		if isLiteralWebhookHost(parts[0]) {
+			return nil, fmt.Errorf("invalid webhook host key %q, it can't be a literal host", parts[0])
+		}
+		if !strings.HasPrefix(parts[1], "http://") && !strings.HasPrefix(parts[1], "https://") {
+			return nil, fmt.Errorf("invalid webhook host %q of key %q, must start with http:// or https://", parts[1], parts[0])
+		}
+		hostMap[parts[0]] = strings.TrimRight(parts[1], "/")
+	}
+	return hostMap, nil
+}
+
+// isLiteralWebhookHost returns true if the webhook URL host stored in the repository is the literal host of the server,
+// rather than a logical host key. It's empty for the repositories linked before the host is recorded.
+func isLiteralWebhookHost(hostKey string) bool {
+	return hostKey == "" || strings.Contains(hostKey, "://")
+}
+
+// SetWebhookHostResolver sets the resolver of the logical webhook host keys. Without the resolver, only the literal host
+// of the server is used.
+func (s *Server) SetWebhookHostResolver(resolver WebhookHostResolver) {
+	s.webhookHostResolver = resolver
+}
+
+// resolveWebhookHost returns the host of the webhook callback URL for the webhook URL host stored in the repository.
+// The literal host always resolves to the host of the server, which is the default.
+func (s *Server) resolveWebhookHost(hostKey string) (string, error) {
+	if isLiteralWebhookHost(hostKey) {
+		return fmt.Sprintf("%s:%d", s.host, s.port), nil
+	}
+	if s.webhookHostResolver == nil {
+		return "", &common.Error{Code: common.Invalid, Err: fmt.Errorf("webhook host key %q can't be resolved without the configured webhook hosts", hostKey)}
+	}
+	return s.webhookHostResolver.ResolveWebhookHost(hostKey)
+}
+
+// webhookCallbackURL returns the webhook callback URL of the webhook endpoint through the host resolved from hostKey.
+func (s *Server) webhookCallbackURL(hostKey string, endpointID string) (string, error) {
+	host, err := s.resolveWebhookHost(hostKey)
+	if err != nil {
+		return "", err
+	}
+	return host + WebhookCallbackPath(endpointID), nil
+}
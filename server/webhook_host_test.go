@@ -0,0 +1,111 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bytebase/bytebase/common"
+)
+
+func TestWebhookCallbackURL(t *testing.T) {
+	s := &Server{host: "http://localhost", port: 8080}
+	s.SetWebhookHostResolver(NewWebhookHostResolver(map[string]string{
+		"eu": "https://eu.bytebase.example.com",
+		"us": "https://us.bytebase.example.com",
+	}))
+
+	tests := []struct {
+		name    string
+		hostKey string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "logical key",
+			hostKey: "eu",
+			want:    "https://eu.bytebase.example.com/hook/gitlab/endpoint",
+		},
+		{
+			name:    "literal host",
+			hostKey: "http://localhost:8080",
+			want:    "http://localhost:8080/hook/gitlab/endpoint",
+		},
+		{
+			name:    "empty host",
+			hostKey: "",
+			want:    "http://localhost:8080/hook/gitlab/endpoint",
+		},
+		{
+			name:    "unknown key",
+			hostKey: "apac",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := s.webhookCallbackURL(test.hostKey, "endpoint")
+		if test.wantErr {
+			if common.ErrorCode(err) != common.Invalid {
+				t.Errorf("%q: webhookCallbackURL() got error %v, want Invalid error.", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: webhookCallbackURL() got error %v, want OK.", test.name, err)
+		}
+		if got != test.want {
+			t.Errorf("%q: webhookCallbackURL() got %q, want %q.", test.name, got, test.want)
+		}
+	}
+
+	// The logical key can't be resolved without the configured hosts.
+	s.SetWebhookHostResolver(nil)
+	if _, err := s.webhookCallbackURL("eu", "endpoint"); common.ErrorCode(err) != common.Invalid {
+		t.Errorf("webhookCallbackURL() without resolver got error %v, want Invalid error.", err)
+	}
+}
+
+func TestParseWebhookHostMap(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			value: "eu=https://eu.example.com/, us=https://us.example.com",
+			want:  map[string]string{"eu": "https://eu.example.com", "us": "https://us.example.com"},
+		},
+		{
+			value: "",
+			want:  map[string]string{},
+		},
+		{
+			value:   "eu",
+			wantErr: true,
+		},
+		{
+			value:   "eu=eu.example.com",
+			wantErr: true,
+		},
+		{
+			value:   "https://eu=https://eu.example.com",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := ParseWebhookHostMap(test.value)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%q: ParseWebhookHostMap() got %v, want error.", test.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: ParseWebhookHostMap() got error %v, want OK.", test.value, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: ParseWebhookHostMap() got %v, want %v.", test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bytebase/bytebase/plugin/vcs/gitlab"
+)
+
+// pushOrderKey identifies the branch (or tag) of a repository.
+type pushOrderKey struct {
+	repositoryID int
+	ref          string
+}
+
+// pushOrderTracker processes the push events for the same branch one at a time, and skips the stale push event
+// whose latest commit is older than the last processed one. The VCS provider may deliver the push events out of order,
+// and processing an older push after a newer one could apply an older schema over a newer one.
+// The zero value is ready to use.
+type pushOrderTracker struct {
+	mu           sync.Mutex
+	lockMap      map[pushOrderKey]*sync.Mutex
+	lastCommitTs map[pushOrderKey]int64
+}
+
+// begin waits for the push events for the same branch being processed, and returns the function to call after processing the push event.
+// Returns true if the push event is stale, in which case it shouldn't be processed.
+// A zero commitTs means the push event doesn't carry commits, which is never stale.
+func (t *pushOrderTracker) begin(repositoryID int, ref string, commitTs int64) (func(), bool) {
+	key := pushOrderKey{repositoryID: repositoryID, ref: ref}
+	t.mu.Lock()
+	if t.lockMap == nil {
+		t.lockMap = make(map[pushOrderKey]*sync.Mutex)
+		t.lastCommitTs = make(map[pushOrderKey]int64)
+	}
+	lock, ok := t.lockMap[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		t.lockMap[key] = lock
+	}
+	t.mu.Unlock()
+
+	lock.Lock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if commitTs == 0 {
+		return lock.Unlock, false
+	}
+	if commitTs < t.lastCommitTs[key] {
+		return lock.Unlock, true
+	}
+	t.lastCommitTs[key] = commitTs
+	return lock.Unlock, false
+}
+
+// latestCommitTs returns the timestamp of the latest commit in the push event, or 0 if none of the commit timestamps is valid.
+func latestCommitTs(pushEvent *gitlab.WebhookPushEvent) int64 {
+	var latest int64
+	for _, commit := range pushEvent.CommitList {
+		createdTime, err := time.Parse(time.RFC3339, commit.Timestamp)
+		if err != nil {
+			continue
+		}
+		if ts := createdTime.Unix(); ts > latest {
+			latest = ts
+		}
+	}
+	return latest
+}
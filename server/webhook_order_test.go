@@ -0,0 +1,84 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/bytebase/bytebase/plugin/vcs/gitlab"
+)
+
+func TestPushOrderTracker(t *testing.T) {
+	newer := latestCommitTs(&gitlab.WebhookPushEvent{
+		CommitList: []gitlab.WebhookCommit{
+			{Timestamp: "2022-03-01T10:00:00+08:00"},
+			{Timestamp: "2022-03-01T11:00:00+08:00"},
+		},
+	})
+	older := latestCommitTs(&gitlab.WebhookPushEvent{
+		CommitList: []gitlab.WebhookCommit{
+			{Timestamp: "2022-03-01T10:30:00+08:00"},
+		},
+	})
+	if older >= newer {
+		t.Fatalf("latestCommitTs() got older %d, newer %d, want older < newer.", older, newer)
+	}
+
+	tests := []struct {
+		name         string
+		repositoryID int
+		ref          string
+		commitTs     int64
+		wantStale    bool
+	}{
+		{
+			name:         "newer push",
+			repositoryID: 1,
+			ref:          "refs/heads/main",
+			commitTs:     newer,
+			wantStale:    false,
+		},
+		{
+			name:         "late-arriving older push",
+			repositoryID: 1,
+			ref:          "refs/heads/main",
+			commitTs:     older,
+			wantStale:    true,
+		},
+		{
+			name:         "redelivered newer push",
+			repositoryID: 1,
+			ref:          "refs/heads/main",
+			commitTs:     newer,
+			wantStale:    false,
+		},
+		{
+			name:         "older push to another branch",
+			repositoryID: 1,
+			ref:          "refs/heads/develop",
+			commitTs:     older,
+			wantStale:    false,
+		},
+		{
+			name:         "older push to another repository",
+			repositoryID: 2,
+			ref:          "refs/heads/main",
+			commitTs:     older,
+			wantStale:    false,
+		},
+		{
+			name:         "push without commits",
+			repositoryID: 1,
+			ref:          "refs/heads/main",
+			commitTs:     0,
+			wantStale:    false,
+		},
+	}
+
+	var tracker pushOrderTracker
+	for _, test := range tests {
+		done, stale := tracker.begin(test.repositoryID, test.ref, test.commitTs)
+		done()
+		if stale != test.wantStale {
+			t.Errorf("%q: begin() got stale %v, want %v.", test.name, stale, test.wantStale)
+		}
+	}
+}
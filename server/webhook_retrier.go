@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"go.uber.org/zap"
+)
+
+const (
+	webhookRetrierInterval = time.Duration(30) * time.Second
+	// The backoff doubles after each failed retry of the same repository, up to webhookRetryMaxBackoff.
+	webhookRetryMinBackoff = time.Duration(30) * time.Second
+	webhookRetryMaxBackoff = time.Duration(1) * time.Hour
+)
+
+// NewWebhookRetrier creates a webhook retrier.
+func NewWebhookRetrier(logger *zap.Logger, server *Server) *WebhookRetrier {
+	return &WebhookRetrier{
+		l:             logger,
+		server:        server,
+		createWebhook: server.createRepositoryWebhook,
+		now:           time.Now,
+		retryMap:      make(map[int]*webhookRetry),
+	}
+}
+
+// WebhookRetrier retries the webhook creation of the repositories in the WebhookPending status,
+// and flips them to WebhookActive once the webhook is created.
+type WebhookRetrier struct {
+	l      *zap.Logger
+	server *Server
+
+	// createWebhook creates the webhook of the repository and returns the created webhook ID.
+	createWebhook func(ctx context.Context, repository *api.Repository) (string, error)
+	now           func() time.Time
+
+	// retryMap records the backoff of the pending repositories keyed by the repository ID.
+	// It's kept in memory, so the backoff restarts from webhookRetryMinBackoff after the server restarts.
+	retryMap map[int]*webhookRetry
+}
+
+type webhookRetry struct {
+	backoff   time.Duration
+	nextRetry time.Time
+}
+
+// Run will run the webhook retrier.
+func (r *WebhookRetrier) Run(ctx context.Context, wg *sync.WaitGroup) {
+	ticker := time.NewTicker(webhookRetrierInterval)
+	defer ticker.Stop()
+	defer wg.Done()
+	r.l.Debug(fmt.Sprintf("Webhook retrier started and will run every %v", webhookRetrierInterval))
+	for {
+		select {
+		case <-ticker.C:
+			func() {
+				defer func() {
+					if rec := recover(); rec != nil {
+						err, ok := rec.(error)
+						if !ok {
+							err = fmt.Errorf("%v", rec)
+						}
+						r.l.Error("Webhook retrier PANIC RECOVER", zap.Error(err))
+					}
+				}()
+
+				r.retryPendingWebhookList(context.Background())
+			}()
+		case <-ctx.Done(): // if cancel() execute
+			return
+		}
+	}
+}
+
+// retryPendingWebhookList retries the webhook creation of the pending repositories whose backoff has elapsed.
+func (r *WebhookRetrier) retryPendingWebhookList(ctx context.Context) {
+	repositoryList, err := r.server.RepositoryService.FindRepositoriesWithoutWebhook(ctx)
+	if err != nil {
+		r.l.Error("Failed to retrieve repositories without webhook", zap.Error(err))
+		return
+	}
+
+	now := r.now()
+	pendingIDs := make(map[int]bool)
+	for _, repository := range repositoryList {
+		if repository.WebhookStatus != api.WebhookPending {
+			continue
+		}
+		pendingIDs[repository.ID] = true
+
+		retry, ok := r.retryMap[repository.ID]
+		if ok && now.Before(retry.nextRetry) {
+			continue
+		}
+
+		webhookID, err := r.createWebhook(ctx, repository)
+		if err != nil {
+			if !ok {
+				retry = &webhookRetry{}
+				r.retryMap[repository.ID] = retry
+			}
+			retry.backoff = nextWebhookRetryBackoff(retry.backoff)
+			retry.nextRetry = now.Add(retry.backoff)
+			r.l.Warn("Failed to create the pending webhook, will retry",
+				zap.Int("repository_id", repository.ID),
+				zap.String("repository", repository.FullPath),
+				zap.Duration("backoff", retry.backoff),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		webhookStatus := api.WebhookActive
+		repositoryPatch := &api.RepositoryPatch{
+			ID:                repository.ID,
+			UpdaterID:         api.SystemBotID,
+			ExternalWebhookID: &webhookID,
+			WebhookStatus:     &webhookStatus,
+		}
+		if _, err := r.server.RepositoryService.PatchRepository(ctx, repositoryPatch); err != nil {
+			// The created webhook is left dangling in the VCS and the next retry creates another one.
+			r.l.Error("Failed to activate the created webhook",
+				zap.Int("repository_id", repository.ID),
+				zap.String("webhook_id", webhookID),
+				zap.Error(err),
+			)
+			continue
+		}
+		delete(r.retryMap, repository.ID)
+		r.l.Info("Created the pending webhook",
+			zap.Int("repository_id", repository.ID),
+			zap.String("repository", repository.FullPath),
+			zap.String("webhook_id", webhookID),
+		)
+	}
+
+	// Drop the backoff of the repositories no longer pending, e.g. unlinked.
+	for id := range r.retryMap {
+		if !pendingIDs[id] {
+			delete(r.retryMap, id)
+		}
+	}
+}
+
+func nextWebhookRetryBackoff(backoff time.Duration) time.Duration {
+	if backoff == 0 {
+		return webhookRetryMinBackoff
+	}
+	backoff *= 2
+	if backoff > webhookRetryMaxBackoff {
+		return webhookRetryMaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"go.uber.org/zap"
+)
+
+// fakeRepositoryService serves the repositories from memory.
+type fakeRepositoryService struct {
+	api.RepositoryService
+	repositoryList []*api.Repository
+}
+
+func (f *fakeRepositoryService) FindRepositoriesWithoutWebhook(ctx context.Context) ([]*api.Repository, error) {
+	var list []*api.Repository
+	for _, repository := range f.repositoryList {
+		if repository.ExternalWebhookID == "" {
+			copied := *repository
+			list = append(list, &copied)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeRepositoryService) PatchRepository(ctx context.Context, patch *api.RepositoryPatch) (*api.Repository, error) {
+	for _, repository := range f.repositoryList {
+		if repository.ID == patch.ID {
+			if v := patch.ExternalWebhookID; v != nil {
+				repository.ExternalWebhookID = *v
+			}
+			if v := patch.WebhookStatus; v != nil {
+				repository.WebhookStatus = *v
+			}
+			if v := patch.WebhookSecretToken; v != nil {
+				repository.WebhookSecretToken = *v
+			}
+			if v := patch.TokenStatus; v != nil {
+				repository.TokenStatus = *v
+			}
+			if v := patch.ProviderStatus; v != nil {
+				repository.ProviderStatus = *v
+			}
+			return repository, nil
+		}
+	}
+	return nil, fmt.Errorf("repository ID not found: %d", patch.ID)
+}
+
+func TestWebhookRetrier(t *testing.T) {
+	repositoryService := &fakeRepositoryService{
+		repositoryList: []*api.Repository{
+			{ID: 1, WebhookStatus: api.WebhookPending},
+			// The webhook of repository 2 is deleted by the user, which isn't retried.
+			{ID: 2, WebhookStatus: api.WebhookActive},
+		},
+	}
+	retrier := NewWebhookRetrier(zap.NewNop(), &Server{l: zap.NewNop(), RepositoryService: repositoryService})
+	now := time.Unix(1650000000, 0)
+	retrier.now = func() time.Time { return now }
+	failures := 2
+	var attempts []int
+	retrier.createWebhook = func(ctx context.Context, repository *api.Repository) (string, error) {
+		attempts = append(attempts, repository.ID)
+		if failures > 0 {
+			failures--
+			return "", fmt.Errorf("gitlab is unavailable")
+		}
+		return "hook-1", nil
+	}
+
+	tests := []struct {
+		name         string
+		elapsed      time.Duration
+		wantAttempts int
+		wantStatus   api.RepositoryWebhookStatus
+	}{
+		{
+			name:         "first retry fails",
+			elapsed:      0,
+			wantAttempts: 1,
+			wantStatus:   api.WebhookPending,
+		},
+		{
+			name:         "within the backoff",
+			elapsed:      webhookRetryMinBackoff - time.Second,
+			wantAttempts: 1,
+			wantStatus:   api.WebhookPending,
+		},
+		{
+			name:         "second retry fails",
+			elapsed:      time.Second,
+			wantAttempts: 2,
+			wantStatus:   api.WebhookPending,
+		},
+		{
+			name:         "within the doubled backoff",
+			elapsed:      webhookRetryMinBackoff,
+			wantAttempts: 2,
+			wantStatus:   api.WebhookPending,
+		},
+		{
+			name:         "third retry succeeds",
+			elapsed:      webhookRetryMinBackoff,
+			wantAttempts: 3,
+			wantStatus:   api.WebhookActive,
+		},
+		{
+			name:         "active webhook isn't retried",
+			elapsed:      webhookRetryMaxBackoff,
+			wantAttempts: 3,
+			wantStatus:   api.WebhookActive,
+		},
+	}
+
+	for _, test := range tests {
+		now = now.Add(test.elapsed)
+		retrier.retryPendingWebhookList(context.Background())
+		repository := repositoryService.repositoryList[0]
+		if len(attempts) != test.wantAttempts {
+			t.Errorf("%q: got attempts %v, want %d attempts.", test.name, attempts, test.wantAttempts)
+		}
+		if repository.WebhookStatus != test.wantStatus {
+			t.Errorf("%q: got webhook status %s, want %s.", test.name, repository.WebhookStatus, test.wantStatus)
+		}
+	}
+
+	if repository := repositoryService.repositoryList[0]; repository.ExternalWebhookID != "hook-1" {
+		t.Errorf("got external webhook ID %q, want %q.", repository.ExternalWebhookID, "hook-1")
+	}
+	for _, id := range attempts {
+		if id != 1 {
+			t.Errorf("got attempts %v, want only repository 1 retried.", attempts)
+			break
+		}
+	}
+	if len(retrier.retryMap) != 0 {
+		t.Errorf("got retry map %v, want empty after the webhook is created.", retrier.retryMap)
+	}
+}
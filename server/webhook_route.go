@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"go.uber.org/zap"
+)
+
+// webhookRouteReloadInterval is the minimum interval to reload the stale webhook routes on a missing endpoint.
+const webhookRouteReloadInterval = 30 * time.Second
+
+// webhookRouteMap is the in-memory routing map of the webhook endpoints, built from the minimal projection of the
+// repositories at boot and reloaded on the repository changes made by this server. Once loaded, a missing endpoint is
+// rejected without looking up the repository, unless the routes are stale, e.g. missing the repositories created by
+// other replicas, and reloading them finds the endpoint. Before the routes are loaded, a missing endpoint falls back to
+// looking up the repository.
+// The zero value is ready to use.
+type webhookRouteMap struct {
+	mu       sync.RWMutex
+	routeMap map[string]*api.WebhookEndpointRef
+	// loadedTs is the time the routes are loaded, zero if they haven't been loaded yet.
+	loadedTs time.Time
+}
+
+// load replaces the routes with the webhook endpoints of all the repositories not archived.
+func (m *webhookRouteMap) load(ctx context.Context, repositoryService api.RepositoryService) error {
+	refList, err := repositoryService.ListWebhookEndpoints(ctx)
+	if err != nil {
+		return err
+	}
+	routeMap := make(map[string]*api.WebhookEndpointRef)
+	for _, ref := range refList {
+		routeMap[ref.WebhookEndpointID] = ref
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.routeMap = routeMap
+	m.loadedTs = time.Now()
+	return nil
+}
+
+// loaded returns true if the routes are loaded, and whether they're stale at the time.
+func (m *webhookRouteMap) loaded(now time.Time) (bool, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.loadedTs.IsZero() {
+		return false, false
+	}
+	return true, now.Sub(m.loadedTs) >= webhookRouteReloadInterval
+}
+
+// get returns the route of the webhook endpoint, or false if it's not routed.
+func (m *webhookRouteMap) get(webhookEndpointID string) (*api.WebhookEndpointRef, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ref, ok := m.routeMap[webhookEndpointID]
+	return ref, ok
+}
+
+// put adds or replaces the route of the repository found by falling back, e.g. created by another replica.
+func (m *webhookRouteMap) put(repository *api.Repository) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.routeMap == nil {
+		m.routeMap = make(map[string]*api.WebhookEndpointRef)
+	}
+	m.routeMap[repository.WebhookEndpointID] = &api.WebhookEndpointRef{
+		RepositoryID:      repository.ID,
+		WebhookEndpointID: repository.WebhookEndpointID,
+		VCSType:           repository.VCS.Type,
+		SyncEnabled:       repository.SyncStatus != api.SyncQuarantined,
+	}
+}
+
+// refreshWebhookRoutes reloads the webhook routes after the repositories change. The failure is only logged, since
+// the loaded routes stay in effect until the next reload.
+func (s *Server) refreshWebhookRoutes(ctx context.Context) {
+	if err := s.webhookRoutes.load(ctx, s.RepositoryService); err != nil {
+		s.l.Warn("Failed to reload the webhook routes.", zap.Error(err))
+	}
+}
+
+// routeWebhookEndpoint returns the route of the webhook endpoint. Returns false if the endpoint is unknown to the loaded
+// routes, so the caller rejects it without looking up the repository. Returns a nil route but true if the routes aren't
+// loaded, so the caller falls back to looking up the repository.
+func (s *Server) routeWebhookEndpoint(ctx context.Context, webhookEndpointID string) (*api.WebhookEndpointRef, bool) {
+	if route, ok := s.webhookRoutes.get(webhookEndpointID); ok {
+		return route, true
+	}
+	loaded, stale := s.webhookRoutes.loaded(time.Now())
+	if !loaded {
+		return nil, true
+	}
+	if !stale {
+		return nil, false
+	}
+	s.refreshWebhookRoutes(ctx)
+	return s.webhookRoutes.get(webhookEndpointID)
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"github.com/bytebase/bytebase/plugin/vcs/gitlab"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+func (f *fakeRepositoryService) ListWebhookEndpoints(ctx context.Context) ([]*api.WebhookEndpointRef, error) {
+	var list []*api.WebhookEndpointRef
+	for _, repository := range f.repositoryList {
+		list = append(list, &api.WebhookEndpointRef{
+			RepositoryID:      repository.ID,
+			WebhookEndpointID: repository.WebhookEndpointID,
+			VCSType:           vcs.GitLabSelfHost,
+			SyncEnabled:       repository.SyncStatus != api.SyncQuarantined,
+		})
+	}
+	return list, nil
+}
+
+func TestWebhookRouteMap(t *testing.T) {
+	repositoryService := &fakeRepositoryService{
+		repositoryList: []*api.Repository{
+			{ID: 1, WebhookEndpointID: "endpoint-1", SyncStatus: api.SyncActive},
+			{ID: 2, WebhookEndpointID: "endpoint-2", SyncStatus: api.SyncQuarantined},
+		},
+	}
+	var m webhookRouteMap
+	if _, ok := m.get("endpoint-1"); ok {
+		t.Errorf("get() before loading got routed, want not routed.")
+	}
+	if err := m.load(context.Background(), repositoryService); err != nil {
+		t.Fatalf("load() got error %v, want OK.", err)
+	}
+	if ref, ok := m.get("endpoint-2"); !ok || ref.RepositoryID != 2 || ref.SyncEnabled {
+		t.Errorf("get() got %+v %v, want repository 2 with sync disabled.", ref, ok)
+	}
+
+	// The repository found by falling back is routed until the next reload, which drops the deleted repository 1.
+	m.put(&api.Repository{ID: 3, WebhookEndpointID: "endpoint-3", VCS: &api.VCS{Type: vcs.GitLabSelfHost}})
+	if ref, ok := m.get("endpoint-3"); !ok || ref.RepositoryID != 3 || !ref.SyncEnabled {
+		t.Errorf("get() got %+v %v, want repository 3 with sync enabled.", ref, ok)
+	}
+	repositoryService.repositoryList = repositoryService.repositoryList[1:]
+	if err := m.load(context.Background(), repositoryService); err != nil {
+		t.Fatalf("load() got error %v, want OK.", err)
+	}
+	for _, endpointID := range []string{"endpoint-1", "endpoint-3"} {
+		if _, ok := m.get(endpointID); ok {
+			t.Errorf("get(%q) after reloading got routed, want not routed.", endpointID)
+		}
+	}
+}
+
+// countingWebhookRepositoryService counts the lookups of the repositories, and finds none by the webhook endpoint.
+type countingWebhookRepositoryService struct {
+	fakeRepositoryService
+	lookupCount int
+	listCount   int
+}
+
+func (f *countingWebhookRepositoryService) GetRepositoryByWebhookEndpoint(ctx context.Context, webhookEndpointID string) (*api.Repository, error) {
+	f.lookupCount++
+	return nil, nil
+}
+
+func (f *countingWebhookRepositoryService) ListWebhookEndpoints(ctx context.Context) ([]*api.WebhookEndpointRef, error) {
+	f.listCount++
+	return f.fakeRepositoryService.ListWebhookEndpoints(ctx)
+}
+
+func TestWebhookRejectsUnknownEndpoint(t *testing.T) {
+	repositoryService := &countingWebhookRepositoryService{
+		fakeRepositoryService: fakeRepositoryService{
+			repositoryList: []*api.Repository{
+				{ID: 1, WebhookEndpointID: "endpoint-1", SyncStatus: api.SyncActive},
+			},
+		},
+	}
+	s := &Server{l: zap.NewNop(), e: echo.New(), RepositoryService: repositoryService}
+	s.registerWebhookRoutes(s.e.Group("/hook"))
+	post := func() int {
+		const sha = "3f5bcd0a6b2d4a7e0c8b5d3a2e1f0c9b8a7d6e5f"
+		body := fmt.Sprintf(`{"object_kind":%q,"ref":"refs/heads/main","before":%q,"after":%q,"commits":[{"id":"abc"}]}`, gitlab.WebhookPush, sha, sha)
+		req := httptest.NewRequest(http.MethodPost, "/hook/gitlab/unknown", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		s.e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Before the routes are loaded, the unknown endpoint falls back to looking up the repository.
+	if code := post(); code != http.StatusNotFound || repositoryService.lookupCount != 1 {
+		t.Errorf("before loading got status %d with %d lookups, want %d with 1 lookup.", code, repositoryService.lookupCount, http.StatusNotFound)
+	}
+
+	// Once loaded, the unknown endpoint is rejected without looking up the repository.
+	s.refreshWebhookRoutes(context.Background())
+	repositoryService.lookupCount, repositoryService.listCount = 0, 0
+	if code := post(); code != http.StatusNotFound || repositoryService.lookupCount != 0 || repositoryService.listCount != 0 {
+		t.Errorf("after loading got status %d with %d lookups and %d reloads, want %d without any.", code, repositoryService.lookupCount, repositoryService.listCount, http.StatusNotFound)
+	}
+
+	// The stale routes are reloaded once to find the endpoint created by another replica.
+	s.webhookRoutes.loadedTs = time.Now().Add(-webhookRouteReloadInterval)
+	for i := 0; i < 2; i++ {
+		if code := post(); code != http.StatusNotFound {
+			t.Errorf("with stale routes got status %d, want %d.", code, http.StatusNotFound)
+		}
+	}
+	if repositoryService.lookupCount != 0 || repositoryService.listCount != 1 {
+		t.Errorf("with stale routes got %d lookups and %d reloads, want 0 lookups and 1 reload.", repositoryService.lookupCount, repositoryService.listCount)
+	}
+}
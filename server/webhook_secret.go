@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"go.uber.org/zap"
+)
+
+// ReconcileWebhookSecret checks the webhook secret token of the repository is used by its webhook at the VCS, which is
+// broken by the stale external webhook ID, e.g. after importing the repository config. If remediate is set, the orphaned
+// secret token is rotated and the webhook is recreated with it, so the secret token and the webhook are coherent again.
+func (s *Server) ReconcileWebhookSecret(ctx context.Context, repositoryID int, updaterID int, remediate bool) (*api.WebhookSecretReport, error) {
+	repository, err := s.RepositoryService.FindRepository(ctx, &api.RepositoryFind{ID: &repositoryID, IncludeSecrets: true})
+	if err != nil {
+		return nil, err
+	}
+	if repository == nil {
+		return nil, &common.Error{Code: common.NotFound, Err: fmt.Errorf("repository ID not found: %d", repositoryID)}
+	}
+	if err := s.composeRepositoryRelationship(ctx, repository); err != nil {
+		return nil, err
+	}
+	callbackURL, err := s.webhookCallbackURL(repository.WebhookURLHost, repository.WebhookEndpointID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.reconcileWebhookSecret(
+		ctx,
+		vcs.Get(repository.VCS.Type, s.vcsProviderConfig()),
+		common.OauthContext{
+			ClientID:     repository.VCS.ApplicationID,
+			ClientSecret: repository.VCS.Secret,
+			AccessToken:  repository.AccessToken,
+			RefreshToken: repository.RefreshToken,
+			Refresher:    s.refreshToken(ctx, repository),
+		},
+		repository,
+		callbackURL,
+		updaterID,
+		remediate,
+		func(secretToken string) ([]byte, error) {
+			return s.composeWebhookCreatePayload(repository.VCS.Type, repository.WebhookURLHost, repository.WebhookEndpointID, secretToken, repository.BranchFilter)
+		},
+	)
+}
+
+// reconcileWebhookSecret checks the recorded webhook of the repository is among the live webhooks calling back callbackURL,
+// and remediates the orphaned secret token if remediate is set. The repository pending the webhook creation is left to
+// the webhook retrier. The VCS doesn't reveal the secret token of a webhook, so the live webhooks other than the recorded
+// one are deleted before recreating the webhook, since the push events they deliver can't be verified.
+func (s *Server) reconcileWebhookSecret(ctx context.Context, provider vcs.Provider, oauthCtx common.OauthContext, repository *api.Repository, callbackURL string, updaterID int, remediate bool, composePayload func(secretToken string) ([]byte, error)) (*api.WebhookSecretReport, error) {
+	report := &api.WebhookSecretReport{
+		RepositoryID:      repository.ID,
+		ExternalWebhookID: repository.ExternalWebhookID,
+		LiveWebhookIDList: []string{},
+	}
+	if repository.WebhookStatus == api.WebhookPending {
+		return report, nil
+	}
+
+	webhookList, err := provider.ListWebhooks(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the webhooks of repository %s: %w", repository.FullPath, err)
+	}
+	report.Orphaned = true
+	for _, webhook := range webhookList {
+		if webhook.URL != callbackURL {
+			continue
+		}
+		report.LiveWebhookIDList = append(report.LiveWebhookIDList, webhook.ID)
+		if webhook.ID == repository.ExternalWebhookID {
+			report.Orphaned = false
+		}
+	}
+	if !report.Orphaned || !remediate {
+		return report, nil
+	}
+
+	secretToken, err := common.RandomSecret(api.WebhookSecretTokenLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate webhook secret token: %w", err)
+	}
+	payload, err := composePayload(secretToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal post request for creating webhook: %w", err)
+	}
+	for _, webhookID := range report.LiveWebhookIDList {
+		if err := provider.DeleteWebhook(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID, webhookID); err != nil {
+			return nil, fmt.Errorf("failed to delete webhook %s with the unknown secret token: %w", webhookID, err)
+		}
+	}
+	webhookID, err := provider.CreateWebhook(ctx, oauthCtx, repository.VCS.InstanceURL, repository.ExternalID, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recreate webhook with the rotated secret token: %w", err)
+	}
+
+	webhookStatus := api.WebhookActive
+	if _, err := s.RepositoryService.PatchRepository(ctx, &api.RepositoryPatch{
+		ID:                 repository.ID,
+		UpdaterID:          updaterID,
+		ExternalWebhookID:  &webhookID,
+		WebhookSecretToken: &secretToken,
+		WebhookStatus:      &webhookStatus,
+	}); err != nil {
+		// The recreated webhook delivers the push events failing the verification until the reconciliation is retried.
+		return nil, fmt.Errorf("failed to record recreated webhook %s: %w", webhookID, err)
+	}
+	s.l.Info("Recreated the webhook of the orphaned webhook secret token",
+		zap.Int("repository_id", repository.ID),
+		zap.String("stale_webhook_id", repository.ExternalWebhookID),
+		zap.String("webhook_id", webhookID),
+	)
+	report.ExternalWebhookID = webhookID
+	report.Remediated = true
+	return report, nil
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"go.uber.org/zap"
+)
+
+const webhookSecretCallbackURL = "https://bytebase.example.com/hook/gitlab/endpoint"
+
+// fakeWebhookSecretProvider serves the webhooks of a repository from memory, recording the webhook created by the payload.
+type fakeWebhookSecretProvider struct {
+	vcs.Provider
+	webhookList []*vcs.Webhook
+	// payloadMap is keyed by the webhook ID.
+	payloadMap map[string]string
+}
+
+func (p *fakeWebhookSecretProvider) ListWebhooks(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string) ([]*vcs.Webhook, error) {
+	return p.webhookList, nil
+}
+
+func (p *fakeWebhookSecretProvider) DeleteWebhook(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, webhookID string) error {
+	for i, webhook := range p.webhookList {
+		if webhook.ID == webhookID {
+			p.webhookList = append(p.webhookList[:i], p.webhookList[i+1:]...)
+			return nil
+		}
+	}
+	return common.Errorf(common.NotFound, fmt.Errorf("webhook %s not found", webhookID))
+}
+
+func (p *fakeWebhookSecretProvider) CreateWebhook(ctx context.Context, oauthCtx common.OauthContext, instanceURL string, repositoryID string, payload []byte) (string, error) {
+	webhookID := fmt.Sprintf("hook-%d", len(p.payloadMap)+100)
+	p.webhookList = append(p.webhookList, &vcs.Webhook{ID: webhookID, URL: webhookSecretCallbackURL})
+	p.payloadMap[webhookID] = string(payload)
+	return webhookID, nil
+}
+
+func TestReconcileWebhookSecret(t *testing.T) {
+	composePayload := func(secretToken string) ([]byte, error) {
+		return []byte(secretToken), nil
+	}
+	otherWebhook := &vcs.Webhook{ID: "1", URL: "https://ci.example.com/hook/1"}
+
+	tests := []struct {
+		name        string
+		webhookList []*vcs.Webhook
+		remediate   bool
+		want        *api.WebhookSecretReport
+	}{
+		{
+			name:        "coherent",
+			webhookList: []*vcs.Webhook{otherWebhook, {ID: "2", URL: webhookSecretCallbackURL}},
+			want:        &api.WebhookSecretReport{RepositoryID: 1, ExternalWebhookID: "2", LiveWebhookIDList: []string{"2"}},
+		},
+		{
+			name:        "orphaned secret reported",
+			webhookList: []*vcs.Webhook{otherWebhook, {ID: "3", URL: webhookSecretCallbackURL}},
+			want:        &api.WebhookSecretReport{RepositoryID: 1, Orphaned: true, ExternalWebhookID: "2", LiveWebhookIDList: []string{"3"}},
+		},
+		{
+			name:        "orphaned secret remediated",
+			webhookList: []*vcs.Webhook{otherWebhook, {ID: "3", URL: webhookSecretCallbackURL}},
+			remediate:   true,
+			want:        &api.WebhookSecretReport{RepositoryID: 1, Orphaned: true, ExternalWebhookID: "hook-100", LiveWebhookIDList: []string{"3"}, Remediated: true},
+		},
+	}
+
+	for _, test := range tests {
+		repository := &api.Repository{
+			ID:                 1,
+			VCS:                &api.VCS{},
+			ExternalWebhookID:  "2",
+			WebhookSecretToken: "stale-secret",
+			WebhookStatus:      api.WebhookActive,
+		}
+		repositoryService := &fakeRepositoryService{repositoryList: []*api.Repository{repository}}
+		s := &Server{l: zap.NewNop(), RepositoryService: repositoryService}
+		provider := &fakeWebhookSecretProvider{webhookList: append([]*vcs.Webhook{}, test.webhookList...), payloadMap: map[string]string{}}
+		copied := *repository
+		report, err := s.reconcileWebhookSecret(context.Background(), provider, common.OauthContext{}, &copied, webhookSecretCallbackURL, api.SystemBotID, test.remediate, composePayload)
+		if err != nil {
+			t.Fatalf("%q: reconcileWebhookSecret() got error %v, want OK.", test.name, err)
+		}
+		if !reflect.DeepEqual(report, test.want) {
+			t.Errorf("%q: reconcileWebhookSecret() got %+v, want %+v.", test.name, report, test.want)
+		}
+		if !test.remediate {
+			if repository.WebhookSecretToken != "stale-secret" || len(provider.payloadMap) != 0 {
+				t.Errorf("%q: reconcileWebhookSecret() changed the webhook without remediation.", test.name)
+			}
+			continue
+		}
+
+		// The recreated webhook is the only one calling back the repository, and it uses the rotated secret token recorded.
+		var liveIDList []string
+		for _, webhook := range provider.webhookList {
+			if webhook.URL == webhookSecretCallbackURL {
+				liveIDList = append(liveIDList, webhook.ID)
+			}
+		}
+		if !reflect.DeepEqual(liveIDList, []string{"hook-100"}) {
+			t.Errorf("%q: reconcileWebhookSecret() left live webhooks %v, want only the recreated one.", test.name, liveIDList)
+		}
+		if repository.ExternalWebhookID != "hook-100" || repository.WebhookSecretToken == "stale-secret" || provider.payloadMap["hook-100"] != repository.WebhookSecretToken {
+			t.Errorf("%q: reconcileWebhookSecret() recorded webhook %s with secret %q, want %s created with the recorded secret.", test.name, repository.ExternalWebhookID, repository.WebhookSecretToken, "hook-100")
+		}
+	}
+}
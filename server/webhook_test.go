@@ -0,0 +1,452 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/plugin/db"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"github.com/bytebase/bytebase/plugin/vcs/gitlab"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+func TestIsIgnoredPath(t *testing.T) {
+	repository := &api.Repository{
+		BaseDirectory:      "bytebase",
+		FilePathTemplate:   "{{ENV_NAME}}/{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql",
+		IgnorePathPatterns: []string{"bytebase/*/seed__*", "bytebase/fixtures/*.sql"},
+	}
+
+	tests := []struct {
+		name  string
+		added string
+		want  bool
+	}{
+		{
+			name:  "ignored path matching the file path template",
+			added: "bytebase/dev/seed__202101131000__data__add_users.sql",
+			want:  true,
+		},
+		{
+			name:  "ignored path not matching the file path template",
+			added: "bytebase/fixtures/users.sql",
+			want:  true,
+		},
+		{
+			name:  "not ignored",
+			added: "bytebase/dev/blog__202101131000__migrate__create_table.sql",
+			want:  false,
+		},
+	}
+
+	for _, test := range tests {
+		got := isIgnoredPath(repository, test.added, zap.NewNop())
+		if got != test.want {
+			t.Errorf("%q: isIgnoredPath(%q) got %v, want %v.", test.name, test.added, got, test.want)
+		}
+	}
+
+	// The ignore patterns take effect after the template matching, so the ignored file should still be a valid migration file.
+	if _, err := db.ParseMigrationInfo(tests[0].added, filepath.Join(repository.BaseDirectory, repository.FilePathTemplate)); err != nil {
+		t.Errorf("ParseMigrationInfo(%q) got error %v, want OK.", tests[0].added, err)
+	}
+}
+
+func TestComposeIssueFromCommit(t *testing.T) {
+	tests := []struct {
+		name            string
+		commit          vcs.FileCommit
+		wantName        string
+		wantDescription string
+	}{
+		{
+			name: "multi-line message",
+			commit: vcs.FileCommit{
+				Message:     "Add users table\r\n\r\nThe users table stores the account info.\r\nIt replaces the legacy account table.\r\n",
+				URL:         "https://gitlab.example.com/bytebase/test/-/commit/abc123",
+				AuthorName:  "Alice",
+				AuthorEmail: "alice@example.com",
+				Added:       "bytebase/dev/blog__202101131000__migrate__add_users.sql",
+			},
+			wantName:        "Add users table",
+			wantDescription: "The users table stores the account info.\nIt replaces the legacy account table.\n\nAuthor: Alice <alice@example.com>\nCommit: https://gitlab.example.com/bytebase/test/-/commit/abc123",
+		},
+		{
+			name: "single-line message",
+			commit: vcs.FileCommit{
+				Message:    "Add users table\n",
+				URL:        "https://gitlab.example.com/bytebase/test/-/commit/abc123",
+				AuthorName: "Alice",
+				Added:      "bytebase/dev/blog__202101131000__migrate__add_users.sql",
+			},
+			wantName:        "Add users table",
+			wantDescription: "Author: Alice\nCommit: https://gitlab.example.com/bytebase/test/-/commit/abc123",
+		},
+		{
+			name: "leading blank lines",
+			commit: vcs.FileCommit{
+				Message: "\n\n  Add users table  \n\n\nDetails.",
+				Added:   "bytebase/dev/blog__202101131000__migrate__add_users.sql",
+			},
+			wantName:        "Add users table",
+			wantDescription: "Details.",
+		},
+		{
+			name: "empty message",
+			commit: vcs.FileCommit{
+				Message:    "  \n",
+				AuthorName: "Alice",
+				Added:      "bytebase/dev/blog__202101131000__migrate__add_users.sql",
+			},
+			wantName:        "Apply blog__202101131000__migrate__add_users.sql",
+			wantDescription: "Author: Alice",
+		},
+	}
+
+	for _, test := range tests {
+		name, description := composeIssueFromCommit(test.commit)
+		if name != test.wantName {
+			t.Errorf("%q: composeIssueFromCommit() got name %q, want %q.", test.name, name, test.wantName)
+		}
+		if description != test.wantDescription {
+			t.Errorf("%q: composeIssueFromCommit() got description %q, want %q.", test.name, description, test.wantDescription)
+		}
+	}
+}
+
+func TestWebhookRefChangeNoop(t *testing.T) {
+	// The server has no store, so the handler must return before looking up the repository.
+	s := &Server{l: zap.NewNop()}
+	e := echo.New()
+	s.registerWebhookRoutes(e.Group("/hook"))
+
+	tests := []struct {
+		name   string
+		kind   gitlab.WebhookType
+		before string
+		after  string
+	}{
+		{
+			name:   "branch deletion",
+			kind:   gitlab.WebhookPush,
+			before: "3f5bcd0a6b2d4a7e0c8b5d3a2e1f0c9b8a7d6e5f",
+			after:  gitlab.ZeroSHA,
+		},
+		{
+			name:   "branch creation",
+			kind:   gitlab.WebhookPush,
+			before: gitlab.ZeroSHA,
+			after:  "3f5bcd0a6b2d4a7e0c8b5d3a2e1f0c9b8a7d6e5f",
+		},
+		{
+			name:   "tag deletion",
+			kind:   gitlab.WebhookTagPush,
+			before: "3f5bcd0a6b2d4a7e0c8b5d3a2e1f0c9b8a7d6e5f",
+			after:  gitlab.ZeroSHA,
+		},
+	}
+
+	for _, test := range tests {
+		body := fmt.Sprintf(`{"object_kind":%q,"ref":"refs/heads/feature","before":%q,"after":%q,"commits":[{"id":"abc","added":["bytebase/dev/blog__202101131000__migrate__add_users.sql"]}]}`, test.kind, test.before, test.after)
+		req := httptest.NewRequest(http.MethodPost, "/hook/gitlab/endpoint", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%q: got status %d body %q, want %d.", test.name, rec.Code, rec.Body.String(), http.StatusOK)
+		}
+		if !strings.HasPrefix(rec.Body.String(), "Ignored") {
+			t.Errorf("%q: got body %q, want ignored.", test.name, rec.Body.String())
+		}
+	}
+}
+
+func TestIsTagRefMatched(t *testing.T) {
+	tests := []struct {
+		branchFilter string
+		ref          string
+		want         bool
+	}{
+		{
+			branchFilter: "refs/tags/v*",
+			ref:          "refs/tags/v1.0.0",
+			want:         true,
+		},
+		{
+			branchFilter: "refs/tags/v*",
+			ref:          "refs/tags/release-1.0.0",
+			want:         false,
+		},
+		{
+			// A branch filter isn't configured for tags.
+			branchFilter: "main",
+			ref:          "refs/tags/main",
+			want:         false,
+		},
+	}
+
+	for _, test := range tests {
+		if got := isTagRefMatched(test.branchFilter, test.ref, zap.NewNop()); got != test.want {
+			t.Errorf("isTagRefMatched(%q, %q) got %v, want %v.", test.branchFilter, test.ref, got, test.want)
+		}
+	}
+}
+
+func TestIsMergeRequestTargetMatched(t *testing.T) {
+	tests := []struct {
+		name               string
+		branchFilter       string
+		targetBranchFilter string
+		targetBranch       string
+		want               bool
+	}{
+		{
+			name:               "targeting the allowed branch",
+			branchFilter:       "feature/*",
+			targetBranchFilter: "main",
+			targetBranch:       "main",
+			want:               true,
+		},
+		{
+			name:               "targeting the allowed glob",
+			targetBranchFilter: "release/*",
+			targetBranch:       "release/1.0",
+			want:               true,
+		},
+		{
+			// The target branch filter is independent of the branch filter for the push events.
+			name:               "targeting the disallowed branch",
+			branchFilter:       "feature/*",
+			targetBranchFilter: "main",
+			targetBranch:       "feature/login",
+			want:               false,
+		},
+		{
+			name:         "empty target branch filter",
+			branchFilter: "main",
+			targetBranch: "feature/login",
+			want:         true,
+		},
+	}
+
+	for _, test := range tests {
+		repository := &api.Repository{
+			BranchFilter:       test.branchFilter,
+			TargetBranchFilter: test.targetBranchFilter,
+		}
+		if got := isMergeRequestTargetMatched(repository, test.targetBranch, zap.NewNop()); got != test.want {
+			t.Errorf("%q: isMergeRequestTargetMatched() got %v, want %v.", test.name, got, test.want)
+		}
+	}
+}
+
+func TestResolveBranchEnvironment(t *testing.T) {
+	repository := &api.Repository{
+		BranchEnvironmentMapping: api.BranchEnvironmentMapping{
+			"develop":          "Staging",
+			"main":             "Prod",
+			"refs/tags/v1.0.0": "Prod",
+		},
+	}
+
+	tests := []struct {
+		ref             string
+		wantEnvironment string
+		wantOK          bool
+	}{
+		{
+			ref:             "refs/heads/develop",
+			wantEnvironment: "Staging",
+			wantOK:          true,
+		},
+		{
+			ref:             "refs/heads/main",
+			wantEnvironment: "Prod",
+			wantOK:          true,
+		},
+		{
+			ref:             "refs/tags/v1.0.0",
+			wantEnvironment: "Prod",
+			wantOK:          true,
+		},
+		{
+			ref:    "refs/heads/feature",
+			wantOK: false,
+		},
+	}
+
+	for _, test := range tests {
+		environment, ok := resolveBranchEnvironment(repository, test.ref)
+		if environment != test.wantEnvironment || ok != test.wantOK {
+			t.Errorf("resolveBranchEnvironment(%q) got (%q, %v), want (%q, %v).", test.ref, environment, ok, test.wantEnvironment, test.wantOK)
+		}
+	}
+
+	// Without the mapping, the environment isn't resolved from the branch and no push is ignored.
+	if environment, ok := resolveBranchEnvironment(&api.Repository{}, "refs/heads/feature"); environment != "" || !ok {
+		t.Errorf("resolveBranchEnvironment() without mapping got (%q, %v), want (%q, %v).", environment, ok, "", true)
+	}
+
+	databaseList := []*api.Database{
+		{ID: 1, Name: "blog", Instance: &api.Instance{Environment: &api.Environment{Name: "Staging"}}},
+		{ID: 2, Name: "blog", Instance: &api.Instance{Environment: &api.Environment{Name: "Prod"}}},
+	}
+	filteredDatabaseList := filterDatabaseListByEnvironment(databaseList, "staging")
+	if len(filteredDatabaseList) != 1 || filteredDatabaseList[0].ID != 1 {
+		t.Errorf("filterDatabaseListByEnvironment(%q) got %v, want the database in the staging environment.", "staging", filteredDatabaseList)
+	}
+}
+
+func TestWebhookCallbackPath(t *testing.T) {
+	s := &Server{l: zap.NewNop()}
+	e := echo.New()
+	s.registerWebhookRoutes(e.Group(webhookGroupPath))
+
+	for _, endpointID := range []string{"8e0bd1b5-5a6e-4b1c-9d3a-7f2e4c6b8a90", "endpoint"} {
+		// The callback URL is composed the same way as when creating the webhook.
+		callbackURL, err := url.Parse(fmt.Sprintf("%s:%d%s", "http://localhost", 8080, WebhookCallbackPath(endpointID)))
+		if err != nil {
+			t.Fatalf("url.Parse() got error %v, want OK.", err)
+		}
+		c := e.NewContext(nil, nil)
+		e.Router().Find(http.MethodPost, callbackURL.Path, c)
+		if want := webhookGroupPath + gitLabWebhookRoute; c.Path() != want {
+			t.Errorf("WebhookCallbackPath(%q) got route %q, want %q.", endpointID, c.Path(), want)
+		}
+		if c.Param("id") != endpointID {
+			t.Errorf("WebhookCallbackPath(%q) got endpoint ID %q, want %q.", endpointID, c.Param("id"), endpointID)
+		}
+	}
+}
+
+func TestCreateTenantSchemaUpdateIssue(t *testing.T) {
+	const payload = `{"deployments":[` +
+		`{"name":"Staging","spec":{"selector":{"matchExpressions":[{"key":"bb.environment","operator":"In","values":["Staging"]}]}}},` +
+		`{"name":"Prod","spec":{"selector":{"matchExpressions":[{"key":"bb.environment","operator":"In","values":["Prod"]}]}}}` +
+		`]}`
+	schedule, err := api.ValidateAndGetDeploymentSchedule(payload)
+	if err != nil {
+		t.Fatalf("ValidateAndGetDeploymentSchedule() got error %v, want OK.", err)
+	}
+	databaseList := []*api.Database{
+		{ID: 1, Name: "blog", Labels: `[{"key":"bb.environment","value":"Prod"},{"key":"bb.tenant","value":"eu"}]`},
+		{ID: 2, Name: "blog", Labels: `[{"key":"bb.environment","value":"Staging"},{"key":"bb.tenant","value":"eu"}]`},
+		{ID: 3, Name: "blog", Labels: `[{"key":"bb.environment","value":"Prod"},{"key":"bb.tenant","value":"us"}]`},
+	}
+	deploymentConfigID := 201
+
+	tests := []struct {
+		name                   string
+		deploymentConfigID     *int
+		wantDeploymentConfigID *int
+	}{
+		{
+			name:                   "deployment config referenced by the repository",
+			deploymentConfigID:     &deploymentConfigID,
+			wantDeploymentConfigID: &deploymentConfigID,
+		},
+		{
+			name: "deployment config of the project",
+		},
+	}
+
+	for _, test := range tests {
+		repository := &api.Repository{
+			DeploymentConfigID: test.deploymentConfigID,
+			Project:            &api.Project{TenantMode: api.TenantModeTenant},
+		}
+		mi := &db.MigrationInfo{
+			Database: "blog",
+			Type:     db.Migrate,
+		}
+		createContext, err := (&Server{}).createTenantSchemaUpdateIssue(context.Background(), repository, mi, vcs.PushEvent{}, gitlab.WebhookCommit{}, "bytebase/blog__202204150900__migrate__add_posts.sql", "CREATE TABLE post (id INT);")
+		if err != nil {
+			t.Errorf("%q: createTenantSchemaUpdateIssue() got error %v, want OK.", test.name, err)
+			continue
+		}
+		var m api.UpdateSchemaContext
+		if err := json.Unmarshal([]byte(createContext), &m); err != nil {
+			t.Errorf("%q: createTenantSchemaUpdateIssue() got malformed context %q, error %v.", test.name, createContext, err)
+			continue
+		}
+		if !reflect.DeepEqual(m.DeploymentConfigID, test.wantDeploymentConfigID) {
+			t.Errorf("%q: createTenantSchemaUpdateIssue() got deployment config ID %v, want %v.", test.name, m.DeploymentConfigID, test.wantDeploymentConfigID)
+		}
+		// The tenant mode push is a single schema update detail staged into a rollout by the deployment schedule.
+		if len(m.UpdateSchemaDetailList) != 1 || m.UpdateSchemaDetailList[0].DatabaseName != "blog" {
+			t.Errorf("%q: createTenantSchemaUpdateIssue() got update schema detail list %+v, want the single database %q.", test.name, m.UpdateSchemaDetailList, "blog")
+			continue
+		}
+		deployments, matrix, err := getDatabaseMatrixFromDeploymentSchedule(schedule, m.UpdateSchemaDetailList[0].DatabaseName, "" /* dbNameTemplate */, databaseList)
+		if err != nil {
+			t.Errorf("%q: getDatabaseMatrixFromDeploymentSchedule() got error %v, want OK.", test.name, err)
+			continue
+		}
+		var gotStageList [][]int
+		for _, stage := range matrix {
+			var idList []int
+			for _, database := range stage {
+				idList = append(idList, database.ID)
+			}
+			gotStageList = append(gotStageList, idList)
+		}
+		wantStageList := [][]int{{2}, {1, 3}}
+		if len(deployments) != 2 || deployments[0].Name != "Staging" || deployments[1].Name != "Prod" || !reflect.DeepEqual(gotStageList, wantStageList) {
+			t.Errorf("%q: got stages %v, want %v staged by Staging and Prod.", test.name, gotStageList, wantStageList)
+		}
+	}
+}
+
+func TestWebhookOversizedBody(t *testing.T) {
+	const maxBodySize = 1024
+	// The server has no store, so the handler must reject the oversized body before looking up the repository.
+	s := &Server{l: zap.NewNop()}
+	s.SetWebhookMaxBodySize(maxBodySize)
+	e := echo.New()
+	s.registerWebhookRoutes(e.Group("/hook"))
+
+	body := fmt.Sprintf(`{"object_kind":"push","ref":"refs/heads/main","before":"%s","after":"%s","commits":[{"id":"abc","message":%q}]}`,
+		"3f5bcd0a6b2d4a7e0c8b5d3a2e1f0c9b8a7d6e5f", gitlab.ZeroSHA, strings.Repeat("a", maxBodySize))
+	tests := []struct {
+		name string
+		body io.Reader
+	}{
+		{
+			name: "with content length",
+			body: strings.NewReader(body),
+		},
+		{
+			// The content length is unknown, e.g. chunked, so the body is rejected while being read.
+			name: "without content length",
+			body: io.MultiReader(strings.NewReader(body)),
+		},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/hook/gitlab/endpoint", test.body)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%q: got status %d body %q, want %d.", test.name, rec.Code, rec.Body.String(), http.StatusRequestEntityTooLarge)
+		}
+	}
+
+	// The body within the limit is processed, i.e. the ref deletion is ignored.
+	body = fmt.Sprintf(`{"object_kind":"push","ref":"refs/heads/main","before":"%s","after":"%s"}`, "3f5bcd0a6b2d4a7e0c8b5d3a2e1f0c9b8a7d6e5f", gitlab.ZeroSHA)
+	req := httptest.NewRequest(http.MethodPost, "/hook/gitlab/endpoint", io.MultiReader(strings.NewReader(body)))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Body.String(), "Ignored") {
+		t.Errorf("got status %d body %q, want %d ignored.", rec.Code, rec.Body.String(), http.StatusOK)
+	}
+}
@@ -139,6 +139,15 @@ func (s *EnvironmentService) PatchEnvironment(ctx context.Context, patch *api.En
 
 // createEnvironment creates a new environment.
 func (s *EnvironmentService) createEnvironment(ctx context.Context, tx *sql.Tx, create *api.EnvironmentCreate) (*api.Environment, error) {
+	// Counting within the transaction alone doesn't see the environments inserted by the concurrent uncommitted creations
+	// under READ COMMITTED, so the creations are serialized by the lock before counting not to exceed the quota together.
+	if err := lockEnvironmentCreation(ctx, tx); err != nil {
+		return nil, err
+	}
+	if err := checkEnvironmentQuota(ctx, tx, create.Plan); err != nil {
+		return nil, err
+	}
+
 	// The order is the MAX(order) + 1
 	row1, err1 := tx.QueryContext(ctx, `
 		SELECT "order"
@@ -163,21 +172,28 @@ func (s *EnvironmentService) createEnvironment(ctx context.Context, tx *sql.Tx,
 		return nil, FormatError(err)
 	}
 
+	tier := create.Tier
+	if tier == "" {
+		tier = api.EnvironmentTierUnspecified
+	}
+
 	// Insert row into database.
 	row2, err2 := tx.QueryContext(ctx, `
 		INSERT INTO environment (
 			creator_id,
 			updater_id,
 			name,
-			"order"
+			"order",
+			tier
 		)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, row_status, creator_id, created_ts, updater_id, updated_ts, name, "order"
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, row_status, creator_id, created_ts, updater_id, updated_ts, name, "order", tier
 	`,
 		create.CreatorID,
 		create.CreatorID,
 		create.Name,
 		order+1,
+		tier,
 	)
 
 	fmt.Printf("Yang3: %v\n", err2)
@@ -197,6 +213,7 @@ func (s *EnvironmentService) createEnvironment(ctx context.Context, tx *sql.Tx,
 		&environment.UpdatedTs,
 		&environment.Name,
 		&environment.Order,
+		&environment.Tier,
 	); err != nil {
 		fmt.Printf("Yang4: %v\n", err)
 		return nil, FormatError(err)
@@ -205,6 +222,33 @@ func (s *EnvironmentService) createEnvironment(ctx context.Context, tx *sql.Tx,
 	return &environment, nil
 }
 
+// lockEnvironmentCreation locks the environment table against the concurrent creations until the transaction ends.
+// SHARE ROW EXCLUSIVE conflicts with itself and the row changes, but not with the reads.
+func lockEnvironmentCreation(ctx context.Context, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE environment IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return FormatError(err)
+	}
+	return nil
+}
+
+// checkEnvironmentQuota returns a payment required error if the number of the environments has reached the quota of the plan.
+// We only count environments with NORMAL status since users cannot make any operations for ARCHIVED one.
+func checkEnvironmentQuota(ctx context.Context, tx *sql.Tx, plan api.PlanType) error {
+	var count int
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM environment
+		WHERE row_status = $1
+	`, api.Normal).Scan(&count); err != nil {
+		return FormatError(err)
+	}
+	usage := plan.QuotaUsage(count, api.PlanType.EnvironmentQuota)
+	if usage.Status == api.QuotaExceeded {
+		return &common.Error{Code: common.PaymentRequired, Err: fmt.Errorf("you have reached the maximum environment count %d of the %s plan, current %d", usage.Quota, plan.String(), usage.Current)}
+	}
+	return nil
+}
+
 func (s *EnvironmentService) findEnvironmentList(ctx context.Context, tx *sql.Tx, find *api.EnvironmentFind) (_ []*api.Environment, err error) {
 	// Build WHERE clause.
 	where, args := []string{"1 = 1"}, []interface{}{}
@@ -224,7 +268,8 @@ func (s *EnvironmentService) findEnvironmentList(ctx context.Context, tx *sql.Tx
 			updater_id,
 			updated_ts,
 			name,
-			"order"
+			"order",
+			tier
 		FROM environment
 		WHERE `+strings.Join(where, " AND "),
 		args...,
@@ -247,6 +292,7 @@ func (s *EnvironmentService) findEnvironmentList(ctx context.Context, tx *sql.Tx
 			&environment.UpdatedTs,
 			&environment.Name,
 			&environment.Order,
+			&environment.Tier,
 		); err != nil {
 			return nil, FormatError(err)
 		}
@@ -273,6 +319,9 @@ func (s *EnvironmentService) patchEnvironment(ctx context.Context, tx *sql.Tx, p
 	if v := patch.Order; v != nil {
 		set, args = append(set, fmt.Sprintf(`"order" = $%d`, len(args)+1)), append(args, *v)
 	}
+	if v := patch.Tier; v != nil {
+		set, args = append(set, fmt.Sprintf("tier = $%d", len(args)+1)), append(args, *v)
+	}
 
 	args = append(args, patch.ID)
 
@@ -281,7 +330,7 @@ func (s *EnvironmentService) patchEnvironment(ctx context.Context, tx *sql.Tx, p
 		UPDATE environment
 		SET `+strings.Join(set, ", ")+`
 		WHERE id = $%d
-		RETURNING id, row_status, creator_id, created_ts, updater_id, updated_ts, name, "order"
+		RETURNING id, row_status, creator_id, created_ts, updater_id, updated_ts, name, "order", tier
 	`, len(args)),
 		args...,
 	)
@@ -301,6 +350,7 @@ func (s *EnvironmentService) patchEnvironment(ctx context.Context, tx *sql.Tx, p
 			&environment.UpdatedTs,
 			&environment.Name,
 			&environment.Order,
+			&environment.Tier,
 		); err != nil {
 			return nil, FormatError(err)
 		}
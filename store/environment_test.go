@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+)
+
+func TestCheckEnvironmentQuota(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s", filepath.Join(t.TempDir(), "environment.db")))
+	if err != nil {
+		t.Fatalf("sql.Open() got error %v, want OK.", err)
+	}
+	defer db.Close()
+	// The archived environment isn't counted.
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE environment (
+			id INTEGER PRIMARY KEY,
+			row_status TEXT DEFAULT 'NORMAL',
+			name TEXT
+		);
+		INSERT INTO environment (name) VALUES ('dev'), ('prod');
+		INSERT INTO environment (row_status, name) VALUES ('ARCHIVED', 'test');
+	`); err != nil {
+		t.Fatalf("failed to create the environment table, error %v", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx() got error %v, want OK.", err)
+	}
+	defer tx.Rollback()
+
+	tests := []struct {
+		plan api.PlanType
+		want common.Code
+	}{
+		{
+			plan: api.FREE,
+			want: common.PaymentRequired,
+		},
+		{
+			plan: api.TEAM,
+			want: common.Ok,
+		},
+		{
+			plan: api.ENTERPRISE,
+			want: common.Ok,
+		},
+	}
+
+	for _, test := range tests {
+		err := checkEnvironmentQuota(ctx, tx, test.plan)
+		if code := common.ErrorCode(err); code != test.want {
+			t.Errorf("checkEnvironmentQuota(%s) got code %d, want %d, error %v.", test.plan, code, test.want, err)
+		}
+	}
+
+	// ENTERPRISE is unbounded regardless of the number of the environments.
+	for i := 0; i < 100; i++ {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO environment (name) VALUES ($1)`, fmt.Sprintf("env%d", i)); err != nil {
+			t.Fatalf("failed to insert the environment, error %v", err)
+		}
+	}
+	if err := checkEnvironmentQuota(ctx, tx, api.ENTERPRISE); err != nil {
+		t.Errorf("checkEnvironmentQuota(ENTERPRISE) got error %v, want OK.", err)
+	}
+	if err := checkEnvironmentQuota(ctx, tx, api.TEAM); common.ErrorCode(err) != common.PaymentRequired {
+		t.Errorf("checkEnvironmentQuota(TEAM) got error %v, want payment required.", err)
+	}
+}
@@ -0,0 +1,2 @@
+-- Comma separated glob patterns. Committed files matching any of the patterns are ignored even if they match the file path template.
+ALTER TABLE repository ADD COLUMN ignore_path_patterns TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+-- The author of the commits Bytebase writes back to the repository, e.g. the latest schema file.
+-- If empty, the VCS provider uses the user linking the project to the repository.
+ALTER TABLE repository ADD COLUMN commit_author_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE repository ADD COLUMN commit_author_email TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- NULL expires_ts means the access token never expires.
+-- Previously 0 was stored for the never-expiring tokens (e.g. GitLab doesn't expire the access token by default),
+-- which is ambiguous with the Unix epoch. No token expires at the Unix epoch, so all existing 0 values are migrated to NULL.
+ALTER TABLE repository ALTER COLUMN expires_ts DROP NOT NULL;
+UPDATE repository SET expires_ts = NULL WHERE expires_ts = 0;
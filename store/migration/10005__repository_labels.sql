@@ -0,0 +1,2 @@
+-- labels is the key-value labels for organizing the repositories, e.g. {"team": "payments"}.
+ALTER TABLE repository ADD COLUMN labels JSONB NOT NULL DEFAULT '{}';
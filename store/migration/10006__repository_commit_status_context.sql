@@ -0,0 +1,2 @@
+-- The context of the commit status Bytebase reports to the VCS provider after applying the migration.
+ALTER TABLE repository ADD COLUMN commit_status_context TEXT NOT NULL DEFAULT 'bytebase/schema';
@@ -0,0 +1,3 @@
+-- branch_environment_mapping maps the pushed branch to the environment of the databases the migration applies to, e.g. {"develop": "Staging", "main": "Prod"}.
+-- Pushes to the unmapped branches are ignored. Empty mapping means the environment isn't resolved from the branch.
+ALTER TABLE repository ADD COLUMN branch_environment_mapping JSONB NOT NULL DEFAULT '{}';
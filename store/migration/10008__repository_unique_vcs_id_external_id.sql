@@ -0,0 +1,20 @@
+-- A VCS repository can only be linked once, which UpsertRepository relies on to find the existing repository.
+-- The VCS repository linked to more than one project before this version keeps the earliest link, and the later links
+-- are archived rather than deleted so they can be inspected, with their projects falling back to the UI workflow.
+UPDATE project
+SET workflow_type = 'UI'
+WHERE id IN (
+    SELECT project_id FROM repository AS r
+    WHERE row_status = 'NORMAL' AND EXISTS (
+        SELECT 1 FROM repository
+        WHERE vcs_id = r.vcs_id AND external_id = r.external_id AND row_status = 'NORMAL' AND id < r.id
+    )
+);
+UPDATE repository AS r
+SET row_status = 'ARCHIVED'
+WHERE row_status = 'NORMAL' AND EXISTS (
+    SELECT 1 FROM repository
+    WHERE vcs_id = r.vcs_id AND external_id = r.external_id AND row_status = 'NORMAL' AND id < r.id
+);
+-- The archived links don't block the unique index, same as the index recreated for the project deletion later.
+CREATE UNIQUE INDEX idx_repository_unique_vcs_id_external_id ON repository(vcs_id, external_id) WHERE row_status = 'NORMAL';
@@ -0,0 +1,2 @@
+-- webhook_status is WEBHOOK_PENDING if the webhook creation failed when linking the repository, and it's being retried in the background.
+ALTER TABLE repository ADD COLUMN webhook_status TEXT NOT NULL CHECK (webhook_status IN ('WEBHOOK_PENDING', 'WEBHOOK_ACTIVE')) DEFAULT 'WEBHOOK_ACTIVE';
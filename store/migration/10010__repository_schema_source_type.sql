@@ -0,0 +1,2 @@
+-- schema_source_type is DIRECTORY if the schema_path_template resolves to a directory of schema files, which are concatenated to form the baseline.
+ALTER TABLE repository ADD COLUMN schema_source_type TEXT NOT NULL CHECK (schema_source_type IN ('SINGLE_FILE', 'DIRECTORY')) DEFAULT 'SINGLE_FILE';
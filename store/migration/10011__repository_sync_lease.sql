@@ -0,0 +1,3 @@
+-- lease_owner and lease_expires_ts record the replica holding the exclusive sync of the repository until the lease expires.
+ALTER TABLE repository ADD COLUMN lease_owner TEXT NULL;
+ALTER TABLE repository ADD COLUMN lease_expires_ts BIGINT NULL;
@@ -0,0 +1,2 @@
+-- target_branch_filter is the glob pattern of the target branches of the merge requests to act on. Empty matches all branches.
+ALTER TABLE repository ADD COLUMN target_branch_filter TEXT NOT NULL DEFAULT '';
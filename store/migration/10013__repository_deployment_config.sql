@@ -0,0 +1,3 @@
+-- deployment_config_id is the deployment config governing the rollout of the migrations pushed to the repository of a tenant mode project.
+-- NULL means the deployment config of the project is used.
+ALTER TABLE repository ADD COLUMN deployment_config_id INTEGER NULL REFERENCES deployment_config (id);
@@ -0,0 +1,3 @@
+-- token_status is TOKEN_INVALID if refreshing the access token failed unrecoverably, e.g. the refresh token is revoked,
+-- and the repository needs to be linked again.
+ALTER TABLE repository ADD COLUMN token_status TEXT NOT NULL CHECK (token_status IN ('TOKEN_VALID', 'TOKEN_INVALID')) DEFAULT 'TOKEN_VALID';
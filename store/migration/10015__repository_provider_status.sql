@@ -0,0 +1,3 @@
+-- provider_status is PROVIDER_MISSING if the VCS provider definitively reports the repository not found,
+-- e.g. it's deleted or made private, while the project is still linked to it.
+ALTER TABLE repository ADD COLUMN provider_status TEXT NOT NULL CHECK (provider_status IN ('PROVIDER_FOUND', 'PROVIDER_MISSING')) DEFAULT 'PROVIDER_FOUND';
@@ -0,0 +1,6 @@
+-- The repositories of a deleted project are archived rather than deleted. The archived repositories don't block linking
+-- the project or the VCS repository again, so the unique indexes only cover the normal repositories.
+DROP INDEX idx_repository_unique_project_id;
+CREATE UNIQUE INDEX idx_repository_unique_project_id ON repository(project_id) WHERE row_status = 'NORMAL';
+DROP INDEX idx_repository_unique_vcs_id_external_id;
+CREATE UNIQUE INDEX idx_repository_unique_vcs_id_external_id ON repository(vcs_id, external_id) WHERE row_status = 'NORMAL';
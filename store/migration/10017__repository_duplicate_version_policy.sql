@@ -0,0 +1,3 @@
+-- duplicate_version_policy resolves the migration version pushed again with different content, e.g. on two branches:
+-- ERROR rejects it, LATEST_WINS applies the most recent commit, and BRANCH_SCOPED namespaces the versions per branch.
+ALTER TABLE repository ADD COLUMN duplicate_version_policy TEXT NOT NULL CHECK (duplicate_version_policy IN ('ERROR', 'LATEST_WINS', 'BRANCH_SCOPED')) DEFAULT 'ERROR';
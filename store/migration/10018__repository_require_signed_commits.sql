@@ -0,0 +1,2 @@
+-- require_signed_commits only processes the migration files from the commits whose signature is verified by the VCS provider.
+ALTER TABLE repository ADD COLUMN require_signed_commits BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+-- notification_webhook_url_list is the comma separated URLs notified of the outcome of the migrations synced from the repository.
+ALTER TABLE repository ADD COLUMN notification_webhook_url_list TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,15 @@
+-- repository_schema_hash records the hash of the schema file content last synced to the database from the path in the repository,
+-- so that the unchanged schema file isn't applied again.
+CREATE TABLE repository_schema_hash (
+    database_id INTEGER NOT NULL REFERENCES db (id),
+    path TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    updated_ts BIGINT NOT NULL DEFAULT extract(epoch from now()),
+    PRIMARY KEY (database_id, path)
+);
+
+CREATE TRIGGER update_repository_schema_hash_updated_ts
+BEFORE
+UPDATE
+    ON repository_schema_hash FOR EACH ROW
+EXECUTE FUNCTION trigger_after_update_updated_ts();
@@ -0,0 +1,16 @@
+-- repository_sync_history records the most recent syncs of the pushes to the repository, the older ones are pruned.
+CREATE TABLE repository_sync_history (
+    id SERIAL PRIMARY KEY,
+    repository_id INTEGER NOT NULL REFERENCES repository (id),
+    ref TEXT NOT NULL,
+    commit_id TEXT NOT NULL,
+    -- result is SUCCESS or FAILED.
+    result TEXT NOT NULL CHECK (result IN ('SUCCESS', 'FAILED')),
+    detail TEXT NOT NULL,
+    started_ts BIGINT NOT NULL,
+    duration_ms BIGINT NOT NULL
+);
+
+CREATE INDEX idx_repository_sync_history_repository_id ON repository_sync_history(repository_id);
+
+ALTER SEQUENCE repository_sync_history_id_seq RESTART WITH 100;
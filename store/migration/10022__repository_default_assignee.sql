@@ -0,0 +1,3 @@
+-- default_assignee_id is the principal assigned the issues created by the pushes whose commit author isn't a member of the project.
+-- NULL means the project owners are assigned in turn.
+ALTER TABLE repository ADD COLUMN default_assignee_id INTEGER NULL REFERENCES principal (id);
@@ -0,0 +1,3 @@
+-- skip_directive is the keyword in the head commit message skipping the push event, e.g. "[skip bytebase]".
+-- Empty means the push events are never skipped.
+ALTER TABLE repository ADD COLUMN skip_directive TEXT NOT NULL DEFAULT '[skip bytebase]';
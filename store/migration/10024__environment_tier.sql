@@ -0,0 +1,3 @@
+-- tier is the tier of the environment, e.g. PROD, deciding the default policies of the environment such as the backup plan.
+-- UNSPECIFIED means the environment has no tier defaults.
+ALTER TABLE environment ADD COLUMN tier TEXT NOT NULL CHECK (tier IN ('UNSPECIFIED', 'PROD', 'STAGING', 'DEV')) DEFAULT 'UNSPECIFIED';
@@ -0,0 +1,5 @@
+-- sync_status is QUARANTINED after the consecutive sync failures reach the threshold, in which case the pushes are ignored
+-- until the repository is un-quarantined manually.
+ALTER TABLE repository ADD COLUMN sync_status TEXT NOT NULL CHECK (sync_status IN ('ACTIVE', 'QUARANTINED')) DEFAULT 'ACTIVE';
+-- sync_failure_count is the number of the consecutive sync failures, reset by a successful sync.
+ALTER TABLE repository ADD COLUMN sync_failure_count INTEGER NOT NULL DEFAULT 0;
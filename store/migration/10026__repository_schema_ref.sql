@@ -0,0 +1,3 @@
+-- schema_ref is the branch, tag or commit SHA the schema baseline is read from, e.g. the release tag.
+-- Empty means the schema is read at the pushed commit.
+ALTER TABLE repository ADD COLUMN schema_ref TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- schema_snapshot_on_apply commits the schema dump back to the schema path in the repository after a migration
+-- issued from the UI applies, so the repository stays the source of truth of the schema.
+ALTER TABLE repository ADD COLUMN schema_snapshot_on_apply BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+-- approved_ts is when the task is approved, which starts the minimum hold duration of the approval policy
+-- before the task runs. 0 means the task isn't approved, e.g. it doesn't need the approval.
+ALTER TABLE task ADD COLUMN approved_ts BIGINT NOT NULL DEFAULT 0;
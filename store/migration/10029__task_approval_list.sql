@@ -0,0 +1,3 @@
+-- approval_list is the approvals of the task in order, e.g. [{"principalId": 101, "role": "DBA", "approvedTs": 1650000000}],
+-- recording the progress of the approval chain of the environment.
+ALTER TABLE task ADD COLUMN approval_list JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,3 @@
+-- drift_action is the response to the schema drift detected on the databases of the project: reporting the anomaly only,
+-- or also creating an issue tracking the remediation.
+ALTER TABLE repository ADD COLUMN drift_action TEXT NOT NULL CHECK (drift_action IN ('ANOMALY_ONLY', 'CREATE_ISSUE')) DEFAULT 'ANOMALY_ONLY';
@@ -0,0 +1,5 @@
+-- retry_count is the number of the automatic retries of the current task run after the transient errors, and next_retry_ts
+-- is when the running task is retried, 0 if it's not waiting for a retry. last_error is the error of the last failed attempt.
+ALTER TABLE task ADD COLUMN retry_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE task ADD COLUMN last_error TEXT NOT NULL DEFAULT '';
+ALTER TABLE task ADD COLUMN next_retry_ts BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- provider_user_id and provider_username are the VCS provider user the access token linking the repository belongs to,
+-- for attributing the automated actions on the repository.
+ALTER TABLE repository ADD COLUMN provider_user_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE repository ADD COLUMN provider_username TEXT NOT NULL DEFAULT '';
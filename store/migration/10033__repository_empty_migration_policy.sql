@@ -0,0 +1,3 @@
+-- empty_migration_policy handles the pushed migration file which is empty or only has comments:
+-- ERROR rejects it with a warning, SKIP skips it with a logged note, and ALLOW applies it as a no-op.
+ALTER TABLE repository ADD COLUMN empty_migration_policy TEXT NOT NULL CHECK (empty_migration_policy IN ('ERROR', 'SKIP', 'ALLOW')) DEFAULT 'SKIP';
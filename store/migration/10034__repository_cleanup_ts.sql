@@ -0,0 +1,4 @@
+-- cleanup_ts is the time the deferred cleanup of the unlinked repository finalizes. The repository is kept archived until then,
+-- and its project is in the 'VCS_PENDING_CLEANUP' workflow, so re-linking the same repository restores the settings.
+-- 0 means the repository isn't pending cleanup.
+ALTER TABLE repository ADD COLUMN cleanup_ts BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- migration_statement_timeout is the timeout in seconds of each statement of the migrations pushed to the repository.
+-- 0 means the instance default.
+ALTER TABLE repository ADD COLUMN migration_statement_timeout INTEGER NOT NULL CHECK (migration_statement_timeout >= 0) DEFAULT 0;
@@ -0,0 +1,5 @@
+-- The sync history is deleted along with the repository, otherwise deleting the repository with any sync history fails,
+-- e.g. unlinking the repository or finalizing its deferred cleanup.
+ALTER TABLE repository_sync_history
+    DROP CONSTRAINT repository_sync_history_repository_id_fkey,
+    ADD CONSTRAINT repository_sync_history_repository_id_fkey FOREIGN KEY (repository_id) REFERENCES repository (id) ON DELETE CASCADE;
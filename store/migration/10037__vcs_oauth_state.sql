@@ -0,0 +1,22 @@
+-- vcs_oauth_state persists the pending VCS OAuth authorizations with their PKCE code verifiers, so that the token
+-- exchange is verified by any replica and across restarts. Each state is consumed once before it expires.
+CREATE TABLE vcs_oauth_state (
+    state TEXT PRIMARY KEY,
+    vcs_id INTEGER NOT NULL REFERENCES vcs (id) ON DELETE CASCADE,
+    principal_id INTEGER NOT NULL REFERENCES principal (id),
+    code_verifier TEXT NOT NULL,
+    expires_ts BIGINT NOT NULL
+);
+
+-- vcs_oauth_ticket keeps the tokens of the verified token exchanges, redeemed by the ticket issued to the principal
+-- when linking a repository, so that the repository is never created from the tokens submitted by the client.
+CREATE TABLE vcs_oauth_ticket (
+    ticket TEXT PRIMARY KEY,
+    vcs_id INTEGER NOT NULL REFERENCES vcs (id) ON DELETE CASCADE,
+    principal_id INTEGER NOT NULL REFERENCES principal (id),
+    access_token TEXT NOT NULL,
+    refresh_token TEXT NOT NULL,
+    -- token_expires_ts is 0 if the access token never expires.
+    token_expires_ts BIGINT NOT NULL,
+    expires_ts BIGINT NOT NULL
+);
@@ -3,9 +3,13 @@ package store
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"embed"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"net"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -15,6 +19,7 @@ import (
 	dbdriver "github.com/bytebase/bytebase/plugin/db"
 
 	"github.com/bytebase/bytebase/common"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
@@ -342,12 +347,17 @@ type Tx struct {
 }
 
 // FormatError returns err as a bytebase error, if possible.
+// The error failing to reach the database is returned as Unavailable, distinct from the error failing the query.
 // Otherwise returns the original error.
 func FormatError(err error) error {
 	if err == nil {
 		return nil
 	}
 
+	if isConnectionError(err) {
+		return common.Errorf(common.Unavailable, fmt.Errorf("database is unavailable: %w", err))
+	}
+
 	if strings.Contains(err.Error(), "unique constraint") {
 		switch {
 		case strings.Contains(err.Error(), "idx_principal_unique_email"):
@@ -404,3 +414,26 @@ func FormatError(err error) error {
 	}
 	return err
 }
+
+// isConnectionError returns true if the error is caused by failing to reach the database, e.g. the connection is refused
+// or lost, instead of the database failing the query.
+func isConnectionError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// Class 08 is the connection exception, and 57P01 ~ 57P03 are the server shutting down or starting up.
+		// https://www.postgresql.org/docs/current/errcodes-appendix.html
+		switch pqErr.Code {
+		case "57P01", "57P02", "57P03":
+			return true
+		}
+		return pqErr.Code.Class() == "08"
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/bytebase/bytebase/common"
+	"github.com/lib/pq"
+)
+
+func TestFormatError(t *testing.T) {
+	ctx := context.Background()
+
+	// Simulate the database being down by connecting to a port nothing listens on.
+	down, err := sql.Open("postgres", "host=127.0.0.1 port=1 user=bb dbname=bb sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatalf("sql.Open() got error %v, want OK.", err)
+	}
+	defer down.Close()
+	_, connErr := down.BeginTx(ctx, nil)
+	if connErr == nil {
+		t.Fatalf("BeginTx() got OK connecting to the closed port, want error.")
+	}
+
+	// A query error from a reachable database.
+	up, err := sql.Open("sqlite3", fmt.Sprintf("file:%s", filepath.Join(t.TempDir(), "format_error.db")))
+	if err != nil {
+		t.Fatalf("sql.Open() got error %v, want OK.", err)
+	}
+	defer up.Close()
+	var count int
+	queryErr := up.QueryRowContext(ctx, `SELECT COUNT(*) FROM no_such_table`).Scan(&count)
+	if queryErr == nil {
+		t.Fatalf("QueryRowContext() got OK querying a missing table, want error.")
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want common.Code
+	}{
+		{name: "connection refused", err: connErr, want: common.Unavailable},
+		{name: "wrapped connection refused", err: fmt.Errorf("failed to find repository: %w", connErr), want: common.Unavailable},
+		{name: "connection failure", err: &pq.Error{Code: "08006", Message: "connection failure"}, want: common.Unavailable},
+		{name: "server shutting down", err: &pq.Error{Code: "57P01", Message: "terminating connection due to administrator command"}, want: common.Unavailable},
+		{name: "query error", err: queryErr, want: common.Internal},
+		{name: "syntax error", err: &pq.Error{Code: "42601", Message: "syntax error at or near \"SELEC\""}, want: common.Internal},
+		{name: "unique constraint", err: fmt.Errorf(`duplicate key value violates unique constraint "idx_project_unique_key"`), want: common.Conflict},
+	}
+	for _, test := range tests {
+		if got := common.ErrorCode(FormatError(test.err)); got != test.want {
+			t.Errorf("%q: FormatError(%v) got code %d, want %d.", test.name, test.err, got, test.want)
+		}
+	}
+}
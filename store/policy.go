@@ -21,6 +21,9 @@ type PolicyService struct {
 	db *DB
 
 	cache api.CacheService
+	// tierDefaultEnabled reports whether the environment tier defaults apply, e.g. whether the plan allows backup policy.
+	// The tier defaults never apply if it's nil.
+	tierDefaultEnabled func() bool
 }
 
 // NewPolicyService returns a new instance of PolicyService.
@@ -28,6 +31,12 @@ func NewPolicyService(logger *zap.Logger, db *DB, cache api.CacheService) *Polic
 	return &PolicyService{l: logger, db: db, cache: cache}
 }
 
+// SetTierDefaultEnabled sets the func reporting whether the environment tier defaults apply to the environments without
+// an explicit policy. It's evaluated on every lookup since the subscription may change at runtime.
+func (s *PolicyService) SetTierDefaultEnabled(enabled func() bool) {
+	s.tierDefaultEnabled = enabled
+}
+
 // FindPolicy finds the policy for an environment.
 // Returns ECONFLICT if finding more than 1 matching records.
 func (s *PolicyService) FindPolicy(ctx context.Context, find *api.PolicyFind) (*api.Policy, error) {
@@ -207,6 +216,7 @@ func (s *PolicyService) upsertPolicy(ctx context.Context, tx *sql.Tx, upsert *ap
 }
 
 // GetBackupPlanPolicy will get the backup plan policy for an environment.
+// The environment without an explicit policy gets the default of its tier if the tier defaults are enabled.
 func (s *PolicyService) GetBackupPlanPolicy(ctx context.Context, environmentID int) (*api.BackupPlanPolicy, error) {
 	pType := api.PolicyTypeBackupPlan
 	policy, err := s.FindPolicy(ctx, &api.PolicyFind{
@@ -216,9 +226,37 @@ func (s *PolicyService) GetBackupPlanPolicy(ctx context.Context, environmentID i
 	if err != nil {
 		return nil, err
 	}
+	// The zero ID means no policy is stored for the environment.
+	if policy.ID == 0 && s.tierDefaultEnabled != nil && s.tierDefaultEnabled() {
+		tier, err := s.findEnvironmentTier(ctx, environmentID)
+		if err != nil {
+			return nil, err
+		}
+		defaultPolicy := api.DefaultBackupPolicy(tier)
+		return &defaultPolicy, nil
+	}
 	return api.UnmarshalBackupPlanPolicy(policy.Payload)
 }
 
+// findEnvironmentTier returns the tier of the environment, UNSPECIFIED if the environment doesn't exist.
+func (s *PolicyService) findEnvironmentTier(ctx context.Context, environmentID int) (api.EnvironmentTier, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	tier := api.EnvironmentTierUnspecified
+	if err := tx.PTx.QueryRowContext(ctx, `
+		SELECT tier
+		FROM environment
+		WHERE id = $1
+	`, environmentID).Scan(&tier); err != nil && err != sql.ErrNoRows {
+		return "", FormatError(err)
+	}
+	return tier, nil
+}
+
 // GetPipelineApprovalPolicy will get the pipeline approval policy for an environment.
 func (s *PolicyService) GetPipelineApprovalPolicy(ctx context.Context, environmentID int) (*api.PipelineApprovalPolicy, error) {
 	pType := api.PolicyTypePipelineApproval
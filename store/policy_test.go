@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+)
+
+func TestGetBackupPlanPolicyTierDefault(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s", filepath.Join(t.TempDir(), "policy.db")))
+	if err != nil {
+		t.Fatalf("sql.Open() got error %v, want OK.", err)
+	}
+	defer db.Close()
+	// The PROD environment 5 and the DEV environment 6 have explicit policies overriding their tier defaults.
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE environment (
+			id INTEGER PRIMARY KEY,
+			tier TEXT DEFAULT 'UNSPECIFIED'
+		);
+		CREATE TABLE policy (
+			id INTEGER PRIMARY KEY,
+			creator_id INTEGER DEFAULT 1,
+			created_ts BIGINT DEFAULT 0,
+			updater_id INTEGER DEFAULT 1,
+			updated_ts BIGINT DEFAULT 0,
+			environment_id INTEGER,
+			type TEXT,
+			payload TEXT
+		);
+		INSERT INTO environment (id, tier) VALUES
+			(1, 'PROD'),
+			(2, 'STAGING'),
+			(3, 'DEV'),
+			(4, 'UNSPECIFIED'),
+			(5, 'PROD'),
+			(6, 'DEV');
+		INSERT INTO policy (environment_id, type, payload) VALUES
+			(5, 'bb.policy.backup-plan', '{"schedule":"UNSET"}'),
+			(6, 'bb.policy.backup-plan', '{"schedule":"WEEKLY"}');
+	`); err != nil {
+		t.Fatalf("failed to create the tables, error %v", err)
+	}
+
+	tests := []struct {
+		environmentID int
+		enabled       bool
+		want          api.BackupPlanPolicySchedule
+	}{
+		{
+			environmentID: 1,
+			enabled:       true,
+			want:          api.BackupPlanPolicyScheduleDaily,
+		},
+		{
+			environmentID: 2,
+			enabled:       true,
+			want:          api.BackupPlanPolicyScheduleWeekly,
+		},
+		{
+			environmentID: 3,
+			enabled:       true,
+			want:          api.BackupPlanPolicyScheduleUnset,
+		},
+		{
+			environmentID: 4,
+			enabled:       true,
+			want:          api.BackupPlanPolicyScheduleUnset,
+		},
+		{
+			environmentID: 5,
+			enabled:       true,
+			want:          api.BackupPlanPolicyScheduleUnset,
+		},
+		{
+			environmentID: 6,
+			enabled:       true,
+			want:          api.BackupPlanPolicyScheduleWeekly,
+		},
+		// The tier defaults don't apply if the plan doesn't allow.
+		{
+			environmentID: 1,
+			enabled:       false,
+			want:          api.BackupPlanPolicyScheduleUnset,
+		},
+		{
+			environmentID: 6,
+			enabled:       false,
+			want:          api.BackupPlanPolicyScheduleWeekly,
+		},
+	}
+
+	for _, test := range tests {
+		enabled := test.enabled
+		s := &PolicyService{db: &DB{db: db, Now: time.Now}}
+		s.SetTierDefaultEnabled(func() bool { return enabled })
+		policy, err := s.GetBackupPlanPolicy(ctx, test.environmentID)
+		if err != nil {
+			t.Fatalf("GetBackupPlanPolicy(%d) got error %v, want OK.", test.environmentID, err)
+		}
+		if policy.Schedule != test.want {
+			t.Errorf("GetBackupPlanPolicy(%d) with tier default enabled %t got schedule %s, want %s.", test.environmentID, test.enabled, policy.Schedule, test.want)
+		}
+	}
+}
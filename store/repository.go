@@ -3,11 +3,18 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"path"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/bytebase/bytebase/api"
 	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/db"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
@@ -21,6 +28,10 @@ type RepositoryService struct {
 	db *DB
 
 	projectService api.ProjectService
+	// cache fronts GetRepositoryByWebhookEndpoint, nil if disabled.
+	cache RepositoryCache
+	// secretStore stores the VCS tokens, whose columns hold the references returned by the store. nil means the DB-backed one.
+	secretStore SecretStore
 }
 
 // NewRepositoryService returns a new instance of RepositoryService.
@@ -28,6 +39,18 @@ func NewRepositoryService(logger *zap.Logger, db *DB, projectService api.Project
 	return &RepositoryService{l: logger, db: db, projectService: projectService}
 }
 
+// SetRepositoryCache sets the cache fronting GetRepositoryByWebhookEndpoint. The cached repositories are invalidated
+// by the mutations made through this service.
+func (s *RepositoryService) SetRepositoryCache(cache RepositoryCache) {
+	s.cache = cache
+}
+
+// SetSecretStore sets the secret store the VCS tokens are read from and written to, instead of the token columns.
+// The token columns written through the previous store aren't migrated, so it should be set before serving.
+func (s *RepositoryService) SetSecretStore(secretStore SecretStore) {
+	s.secretStore = secretStore
+}
+
 // CreateRepository creates a new repository.
 func (s *RepositoryService) CreateRepository(ctx context.Context, create *api.RepositoryCreate) (*api.Repository, error) {
 	tx, err := s.db.BeginTx(ctx, nil)
@@ -48,6 +71,29 @@ func (s *RepositoryService) CreateRepository(ctx context.Context, create *api.Re
 	return repository, nil
 }
 
+// UpsertRepository creates a new repository, or updates the mutable fields of the repository linked to the same VCS and external ID.
+// The tokens are only updated if the access token is provided, and the webhook fields are only updated if the webhook ID is provided.
+// Returns true if the repository is created. Returns ECONFLICT if the existing repository is linked to another project.
+func (s *RepositoryService) UpsertRepository(ctx context.Context, create *api.RepositoryCreate) (*api.Repository, bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	repository, created, err := s.upsertRepository(ctx, tx.PTx, create)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := tx.PTx.Commit(); err != nil {
+		return nil, false, FormatError(err)
+	}
+	s.invalidateRepository(repository.ID)
+
+	return repository, created, nil
+}
+
 // FindRepositoryList retrieves a list of repositorys based on find.
 func (s *RepositoryService) FindRepositoryList(ctx context.Context, find *api.RepositoryFind) ([]*api.Repository, error) {
 	tx, err := s.db.BeginTx(ctx, nil)
@@ -60,30 +106,100 @@ func (s *RepositoryService) FindRepositoryList(ctx context.Context, find *api.Re
 	if err != nil {
 		return []*api.Repository{}, err
 	}
+	if find.IncludeSecrets {
+		for _, repository := range list {
+			if err := s.resolveRepositoryTokens(repository); err != nil {
+				return []*api.Repository{}, err
+			}
+		}
+	}
 
 	return list, nil
 }
 
+// FindRepositoryIDs retrieves the IDs of the repositories based on find.
+// It only selects the ID, so it's much cheaper than FindRepositoryList when scanning all the repositories.
+func (s *RepositoryService) FindRepositoryIDs(ctx context.Context, find *api.RepositoryFind) ([]int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	idList, err := findRepositoryIDs(ctx, tx.PTx, find)
+	if err != nil {
+		return nil, err
+	}
+
+	return idList, nil
+}
+
 // FindRepository retrieves a single repository based on find.
 // Returns ECONFLICT if finding more than 1 matching records.
 func (s *RepositoryService) FindRepository(ctx context.Context, find *api.RepositoryFind) (*api.Repository, error) {
+	repository, matched, err := s.FindRepositoryDetailed(ctx, find)
+	if err != nil {
+		return nil, err
+	}
+	if matched > 1 {
+		return nil, &common.Error{Code: common.Conflict, Err: fmt.Errorf("found %d repositories with filter %+v, expect 1", matched, find)}
+	}
+	return repository, nil
+}
+
+// FindRepositoryByWebURL finds the repository by the web URL or the git remote URL, e.g. for the CLI to map a checkout to its project.
+// The URLs are compared after normalized by api.NormalizeRepositoryWebURL. Returns nil if not found.
+func (s *RepositoryService) FindRepositoryByWebURL(ctx context.Context, webURL string) (*api.Repository, error) {
+	return s.FindRepository(ctx, &api.RepositoryFind{WebURL: &webURL})
+}
+
+// GetRepositoryByWebhookEndpoint retrieves the repository, including the secrets, by the webhook endpoint ID.
+// Returns nil if not found. The repository is read through the cache if set, since it's looked up on every webhook event.
+func (s *RepositoryService) GetRepositoryByWebhookEndpoint(ctx context.Context, webhookEndpointID string) (*api.Repository, error) {
+	find := &api.RepositoryFind{
+		WebhookEndpointID: &webhookEndpointID,
+		IncludeSecrets:    true,
+	}
+	if s.cache == nil {
+		return s.FindRepository(ctx, find)
+	}
+
+	if repository, ok := s.cache.Get(webhookEndpointID); ok {
+		return repository, nil
+	}
+	// Take the generation before loading, so that the repository isn't cached if it's invalidated meanwhile.
+	generation := s.cache.Generation()
+	repository, err := s.FindRepository(ctx, find)
+	if err != nil {
+		return nil, err
+	}
+	if repository != nil {
+		s.cache.Set(repository, generation)
+	}
+	return repository, nil
+}
+
+// FindRepositoryDetailed retrieves a single repository based on find, together with the number of the matching records.
+// The repository is only returned if exactly 1 record matches, so callers can tell zero from many matches without checking the error code.
+func (s *RepositoryService) FindRepositoryDetailed(ctx context.Context, find *api.RepositoryFind) (*api.Repository, int, error) {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, FormatError(err)
+		return nil, 0, FormatError(err)
 	}
 	defer tx.PTx.Rollback()
 
 	list, err := findRepositoryList(ctx, tx.PTx, find)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	if len(list) == 0 {
-		return nil, nil
-	} else if len(list) > 1 {
-		return nil, &common.Error{Code: common.Conflict, Err: fmt.Errorf("found %d repositories with filter %+v, expect 1", len(list), find)}
+	repository, matched := singleRepository(list)
+	if repository != nil && find.IncludeSecrets {
+		if err := s.resolveRepositoryTokens(repository); err != nil {
+			return nil, 0, err
+		}
 	}
-	return list[0], nil
+	return repository, matched, nil
 }
 
 // PatchRepository updates an existing repository by ID.
@@ -95,14 +211,40 @@ func (s *RepositoryService) PatchRepository(ctx context.Context, patch *api.Repo
 	}
 	defer tx.PTx.Rollback()
 
+	if patch.AccessToken != nil || patch.RefreshToken != nil {
+		tokenPatch := *patch
+		oldAccessRef, oldRefreshRef, err := findRepositoryTokenRefs(ctx, tx.PTx, "id = $1", patch.ID)
+		if err != nil {
+			return nil, err
+		}
+		if v := patch.AccessToken; v != nil {
+			accessRef, err := s.putSecret(oldAccessRef, *v)
+			if err != nil {
+				return nil, err
+			}
+			tokenPatch.AccessToken = &accessRef
+		}
+		if v := patch.RefreshToken; v != nil {
+			refreshRef, err := s.putSecret(oldRefreshRef, *v)
+			if err != nil {
+				return nil, err
+			}
+			tokenPatch.RefreshToken = &refreshRef
+		}
+		patch = &tokenPatch
+	}
 	repository, err := patchRepository(ctx, tx.PTx, patch)
 	if err != nil {
 		return nil, FormatError(err)
 	}
+	if err := s.resolveRepositoryTokens(repository); err != nil {
+		return nil, err
+	}
 
 	if err := tx.PTx.Commit(); err != nil {
 		return nil, FormatError(err)
 	}
+	s.invalidateRepository(patch.ID)
 
 	return repository, nil
 }
@@ -122,230 +264,1468 @@ func (s *RepositoryService) DeleteRepository(ctx context.Context, delete *api.Re
 	if err := tx.PTx.Commit(); err != nil {
 		return FormatError(err)
 	}
+	s.invalidateProject(delete.ProjectID)
 
 	return nil
 }
 
-// createRepository creates a new repository.
-func (s *RepositoryService) createRepository(ctx context.Context, tx *sql.Tx, create *api.RepositoryCreate) (*api.Repository, error) {
-	// Updates the project workflow_type to "VCS"
-	workflowType := api.VCSWorkflow
-	projectPatch := api.ProjectPatch{
-		ID:           create.ProjectID,
-		UpdaterID:    create.CreatorID,
-		WorkflowType: &workflowType,
+// ArchiveRepositoriesForProject archives all repositories of the project being deleted, and returns the number of
+// the archived repositories. Unlike DeleteRepository, the project workflow type is left as is since the project is going away.
+func (s *RepositoryService) ArchiveRepositoriesForProject(ctx context.Context, projectID int, deleterID int) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, FormatError(err)
 	}
-	if _, err := s.projectService.PatchProjectTx(ctx, tx, &projectPatch); err != nil {
-		return nil, err
+	defer tx.PTx.Rollback()
+
+	if err := lockProject(ctx, tx.PTx, projectID); err != nil {
+		return 0, err
+	}
+	count, err := archiveRepositoriesForProject(ctx, tx.PTx, projectID, deleterID)
+	if err != nil {
+		return 0, err
 	}
 
-	// Insert row into database.
-	row, err := tx.QueryContext(ctx, `
-		INSERT INTO repository (
-			creator_id,
-			updater_id,
-			vcs_id,
-			project_id,
-			name,
-			full_path,
-			web_url,
-			branch_filter,
-			base_directory,
-			file_path_template,
-			schema_path_template,
-			external_id,
-			external_webhook_id,
-			webhook_url_host,
-			webhook_endpoint_id,
-			webhook_secret_token,
-			access_token,
-			expires_ts,
-			refresh_token
-		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
-		RETURNING id, creator_id, created_ts, updater_id, updated_ts, vcs_id, project_id, name, full_path, web_url, branch_filter, base_directory, file_path_template, schema_path_template, external_id, external_webhook_id, webhook_url_host, webhook_endpoint_id, webhook_secret_token, access_token, expires_ts, refresh_token
-	`,
-		create.CreatorID,
-		create.CreatorID,
-		create.VCSID,
-		create.ProjectID,
-		create.Name,
-		create.FullPath,
-		create.WebURL,
-		create.BranchFilter,
-		create.BaseDirectory,
-		create.FilePathTemplate,
-		create.SchemaPathTemplate,
-		create.ExternalID,
-		create.ExternalWebhookID,
-		create.WebhookURLHost,
-		create.WebhookEndpointID,
-		create.WebhookSecretToken,
-		create.AccessToken,
-		create.ExpiresTs,
-		create.RefreshToken,
-	)
+	if err := tx.PTx.Commit(); err != nil {
+		return 0, FormatError(err)
+	}
+	s.invalidateProject(projectID)
+
+	return count, nil
+}
 
+// CountByVCSType returns the number of repositories keyed by the VCS type.
+func (s *RepositoryService) CountByVCSType(ctx context.Context) (map[string]int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, FormatError(err)
 	}
-	defer row.Close()
+	defer tx.PTx.Rollback()
 
-	row.Next()
-	var repository api.Repository
-	if err := row.Scan(
-		&repository.ID,
-		&repository.CreatorID,
-		&repository.CreatedTs,
-		&repository.UpdaterID,
-		&repository.UpdatedTs,
-		&repository.VCSID,
-		&repository.ProjectID,
-		&repository.Name,
-		&repository.FullPath,
-		&repository.WebURL,
-		&repository.BranchFilter,
-		&repository.BaseDirectory,
-		&repository.FilePathTemplate,
-		&repository.SchemaPathTemplate,
-		&repository.ExternalID,
-		&repository.ExternalWebhookID,
-		&repository.WebhookURLHost,
-		&repository.WebhookEndpointID,
-		&repository.WebhookSecretToken,
-		&repository.AccessToken,
-		&repository.ExpiresTs,
-		&repository.RefreshToken,
-	); err != nil {
+	rows, err := tx.PTx.QueryContext(ctx, `
+		SELECT vcs.type, COUNT(*)
+		FROM repository
+		JOIN vcs ON repository.vcs_id = vcs.id
+		WHERE repository.row_status = 'NORMAL'
+		GROUP BY vcs.type
+	`)
+	if err != nil {
 		return nil, FormatError(err)
 	}
+	defer rows.Close()
 
-	return &repository, nil
-}
-
-func findRepositoryList(ctx context.Context, tx *sql.Tx, find *api.RepositoryFind) (_ []*api.Repository, err error) {
-	// Build WHERE clause.
-	where, args := []string{"1 = 1"}, []interface{}{}
-	if v := find.ID; v != nil {
-		where, args = append(where, fmt.Sprintf("id = $%d", len(args)+1)), append(args, *v)
-	}
-	if v := find.VCSID; v != nil {
-		where, args = append(where, fmt.Sprintf("vcs_id = $%d", len(args)+1)), append(args, *v)
+	countMap := make(map[string]int)
+	for rows.Next() {
+		var vcsType string
+		var count int
+		if err := rows.Scan(&vcsType, &count); err != nil {
+			return nil, FormatError(err)
+		}
+		countMap[vcsType] = count
 	}
-	if v := find.ProjectID; v != nil {
-		where, args = append(where, fmt.Sprintf("project_id = $%d", len(args)+1)), append(args, *v)
+	if err := rows.Err(); err != nil {
+		return nil, FormatError(err)
 	}
-	if v := find.WebhookEndpointID; v != nil {
-		where, args = append(where, fmt.Sprintf("webhook_endpoint_id = $%d", len(args)+1)), append(args, *v)
+
+	return countMap, nil
+}
+
+// ListWebhookEndpoints returns the webhook endpoints of all the repositories not archived, for building the in-memory
+// routing map of the webhook events. It only selects the columns for routing, so it's cheap to reload on every change.
+// The quarantined repositories are included with sync disabled, since their webhooks still deliver the events.
+func (s *RepositoryService) ListWebhookEndpoints(ctx context.Context) ([]*api.WebhookEndpointRef, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, FormatError(err)
 	}
+	defer tx.PTx.Rollback()
 
-	rows, err := tx.QueryContext(ctx, `
-		SELECT
-			id,
-			creator_id,
-			created_ts,
-			updater_id,
-			updated_ts,
-			vcs_id,
-			project_id,
-			name,
-			full_path,
-			web_url,
-			branch_filter,
-			base_directory,
-			file_path_template,
-			schema_path_template,
-			external_id,
-			external_webhook_id,
-			webhook_url_host,
-			webhook_endpoint_id,
-			webhook_secret_token,
-			access_token,
-			expires_ts,
-			refresh_token
+	rows, err := tx.PTx.QueryContext(ctx, `
+		SELECT repository.id, repository.webhook_endpoint_id, vcs.type, repository.sync_status
 		FROM repository
-		WHERE `+strings.Join(where, " AND "),
-		args...,
-	)
+		JOIN vcs ON repository.vcs_id = vcs.id
+		WHERE repository.row_status = 'NORMAL'
+		ORDER BY repository.id
+	`)
 	if err != nil {
 		return nil, FormatError(err)
 	}
 	defer rows.Close()
 
-	// Iterate over result set and deserialize rows into list.
-	list := make([]*api.Repository, 0)
+	refList := make([]*api.WebhookEndpointRef, 0)
 	for rows.Next() {
-		var repository api.Repository
+		var ref api.WebhookEndpointRef
+		var syncStatus api.RepositorySyncStatus
 		if err := rows.Scan(
-			&repository.ID,
-			&repository.CreatorID,
-			&repository.CreatedTs,
-			&repository.UpdaterID,
-			&repository.UpdatedTs,
-			&repository.VCSID,
-			&repository.ProjectID,
-			&repository.Name,
-			&repository.FullPath,
-			&repository.WebURL,
-			&repository.BranchFilter,
-			&repository.BaseDirectory,
-			&repository.FilePathTemplate,
-			&repository.SchemaPathTemplate,
-			&repository.ExternalID,
-			&repository.ExternalWebhookID,
-			&repository.WebhookURLHost,
-			&repository.WebhookEndpointID,
-			&repository.WebhookSecretToken,
-			&repository.AccessToken,
-			&repository.ExpiresTs,
-			&repository.RefreshToken,
+			&ref.RepositoryID,
+			&ref.WebhookEndpointID,
+			&ref.VCSType,
+			&syncStatus,
 		); err != nil {
 			return nil, FormatError(err)
 		}
-
-		list = append(list, &repository)
+		ref.SyncEnabled = syncStatus != api.SyncQuarantined
+		refList = append(refList, &ref)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, FormatError(err)
 	}
 
-	return list, nil
+	return refList, nil
 }
 
-// patchRepository updates a repository by ID. Returns the new state of the repository after update.
-func patchRepository(ctx context.Context, tx *sql.Tx, patch *api.RepositoryPatch) (*api.Repository, error) {
-	// Build UPDATE clause.
-	set, args := []string{"updater_id = $1"}, []interface{}{patch.UpdaterID}
-	if v := patch.BranchFilter; v != nil {
-		set, args = append(set, fmt.Sprintf("branch_filter = $%d", len(args)+1)), append(args, *v)
-	}
-	if v := patch.BaseDirectory; v != nil {
-		set, args = append(set, fmt.Sprintf("base_directory = $%d", len(args)+1)), append(args, *v)
-	}
-	if v := patch.FilePathTemplate; v != nil {
-		set, args = append(set, fmt.Sprintf("file_path_template = $%d", len(args)+1)), append(args, *v)
+// FindRepositoriesWithoutWebhook returns the repositories lacking the external webhook.
+// These repositories will never receive the push events, and the webhook needs to be recreated.
+func (s *RepositoryService) FindRepositoriesWithoutWebhook(ctx context.Context) ([]*api.Repository, error) {
+	return s.FindRepositoryList(ctx, &api.RepositoryFind{WithoutWebhook: true, IncludeSecrets: true})
+}
+
+// PatchRepositoryList patches the repositories in a single transaction, so either all or none of them are patched.
+// The tokens can't be patched by it, since the secrets put to the secret store aren't rolled back with the transaction.
+func (s *RepositoryService) PatchRepositoryList(ctx context.Context, patchList []*api.RepositoryPatch) ([]*api.Repository, error) {
+	for _, patch := range patchList {
+		if patch.AccessToken != nil || patch.RefreshToken != nil {
+			return nil, &common.Error{Code: common.Invalid, Err: fmt.Errorf("tokens of repository %d can't be patched in batch", patch.ID)}
+		}
 	}
-	if v := patch.SchemaPathTemplate; v != nil {
-		set, args = append(set, fmt.Sprintf("schema_path_template = $%d", len(args)+1)), append(args, *v)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, FormatError(err)
 	}
-	if v := patch.AccessToken; v != nil {
-		set, args = append(set, fmt.Sprintf("access_token = $%d", len(args)+1)), append(args, *v)
+	defer tx.PTx.Rollback()
+
+	var list []*api.Repository
+	for _, patch := range patchList {
+		repository, err := patchRepository(ctx, tx.PTx, patch)
+		if err != nil {
+			return nil, FormatError(err)
+		}
+		if err := s.resolveRepositoryTokens(repository); err != nil {
+			return nil, err
+		}
+		list = append(list, repository)
 	}
-	if v := patch.ExpiresTs; v != nil {
-		set, args = append(set, fmt.Sprintf("expires_ts = $%d", len(args)+1)), append(args, *v)
+
+	if err := tx.PTx.Commit(); err != nil {
+		return nil, FormatError(err)
 	}
-	if v := patch.RefreshToken; v != nil {
-		set, args = append(set, fmt.Sprintf("refresh_token = $%d", len(args)+1)), append(args, *v)
+	for _, patch := range patchList {
+		s.invalidateRepository(patch.ID)
 	}
-
+	return list, nil
+}
+
+// FindOrphanedRepositories returns the repositories referencing a deleted VCS. They can neither receive the push events
+// nor talk to the VCS, and need to be reconnected to another VCS or cleaned up.
+func (s *RepositoryService) FindOrphanedRepositories(ctx context.Context) ([]*api.Repository, error) {
+	return s.FindRepositoryList(ctx, &api.RepositoryFind{WithoutVCS: true})
+}
+
+// FindExpiringRepositories returns the repositories with a valid access token expiring before expiresBefore, the Unix timestamp in seconds.
+func (s *RepositoryService) FindExpiringRepositories(ctx context.Context, expiresBefore int64) ([]*api.Repository, error) {
+	tokenStatus := api.TokenValid
+	return s.FindRepositoryList(ctx, &api.RepositoryFind{ExpiresBefore: &expiresBefore, TokenStatus: &tokenStatus, IncludeSecrets: true})
+}
+
+// SwapRepositoryToken stores the refreshed access token if the refresh token of the repository is still swap.OldRefreshToken.
+// The refresh token is compared and swapped by a single conditional UPDATE, so only one of the concurrent refreshes stores its token.
+func (s *RepositoryService) SwapRepositoryToken(ctx context.Context, swap *api.RepositoryTokenSwap) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	// The column holds the reference of the refresh token, so the token is compared after resolving the reference,
+	// and the reference is what the conditional UPDATE compares and swaps.
+	_, oldRefreshRef, err := findRepositoryTokenRefs(ctx, tx.PTx, "id = $1", swap.ID)
+	if err != nil {
+		return false, err
+	}
+	oldRefreshToken, err := s.getSecret(oldRefreshRef)
+	if err != nil {
+		return false, err
+	}
+	if oldRefreshToken != swap.OldRefreshToken {
+		return false, nil
+	}
+	// The refreshed tokens are put as the new secrets instead of replacing the current ones, so the loser of the
+	// concurrent refreshes can't overwrite the tokens of the winner.
+	refSwap := *swap
+	refSwap.OldRefreshToken = oldRefreshRef
+	if refSwap.AccessToken, err = s.putSecret("", swap.AccessToken); err != nil {
+		return false, err
+	}
+	if refSwap.RefreshToken, err = s.putSecret("", swap.RefreshToken); err != nil {
+		return false, err
+	}
+
+	swapped, err := swapRepositoryToken(ctx, tx.PTx, &refSwap)
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.PTx.Commit(); err != nil {
+		return false, FormatError(err)
+	}
+	if swapped {
+		s.invalidateRepository(swap.ID)
+	}
+
+	return swapped, nil
+}
+
+// invalidateRepository evicts the repository from the cache after the mutation is committed.
+func (s *RepositoryService) invalidateRepository(repositoryID int) {
+	if s.cache != nil {
+		s.cache.InvalidateRepository(repositoryID)
+	}
+}
+
+// invalidateProject evicts the repositories of the project from the cache after the mutation is committed.
+func (s *RepositoryService) invalidateProject(projectID int) {
+	if s.cache != nil {
+		s.cache.InvalidateProject(projectID)
+	}
+}
+
+// ClaimRepositorySync claims the lease of the exclusive sync of the repository for the owner.
+// The lease is claimed by a single conditional UPDATE, so only one of the concurrent claimants acquires it.
+// The lease expiry is based on the database clock, which is shared by all the replicas.
+func (s *RepositoryService) ClaimRepositorySync(ctx context.Context, repositoryID int, leaseTTL time.Duration, owner string) (bool, error) {
+	if owner == "" {
+		return false, &common.Error{Code: common.Invalid, Err: fmt.Errorf("lease owner is required")}
+	}
+	if leaseTTL < time.Second {
+		return false, &common.Error{Code: common.Invalid, Err: fmt.Errorf("lease TTL must be at least 1 second, got %v", leaseTTL)}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	acquired, err := claimRepositorySync(ctx, tx.PTx, postgresNowTs, repositoryID, leaseTTL, owner)
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.PTx.Commit(); err != nil {
+		return false, FormatError(err)
+	}
+
+	return acquired, nil
+}
+
+// ReleaseRepositorySync releases the lease of the repository sync if it's held by the owner.
+// Releasing a lease that has been taken over by another owner after expiry is a no-op.
+func (s *RepositoryService) ReleaseRepositorySync(ctx context.Context, repositoryID int, owner string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	if err := releaseRepositorySync(ctx, tx.PTx, repositoryID, owner); err != nil {
+		return err
+	}
+
+	if err := tx.PTx.Commit(); err != nil {
+		return FormatError(err)
+	}
+
+	return nil
+}
+
+// FindLastSyncedSchemaHash returns the hash of the schema file content last synced to the database from the path in the repository.
+// Returns empty if the schema file has never been synced to the database.
+func (s *RepositoryService) FindLastSyncedSchemaHash(ctx context.Context, databaseID int, path string) (string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	return findLastSyncedSchemaHash(ctx, tx.PTx, databaseID, path)
+}
+
+// UpsertLastSyncedSchemaHash records the hash of the schema file content synced to the database from the path in the repository.
+func (s *RepositoryService) UpsertLastSyncedSchemaHash(ctx context.Context, databaseID int, path string, hash string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	if err := upsertLastSyncedSchemaHash(ctx, tx.PTx, databaseID, path, hash); err != nil {
+		return err
+	}
+
+	if err := tx.PTx.Commit(); err != nil {
+		return FormatError(err)
+	}
+
+	return nil
+}
+
+func findLastSyncedSchemaHash(ctx context.Context, tx *sql.Tx, databaseID int, path string) (string, error) {
+	var hash string
+	if err := tx.QueryRowContext(ctx, `
+		SELECT hash
+		FROM repository_schema_hash
+		WHERE database_id = $1 AND path = $2
+	`, databaseID, path).Scan(&hash); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", FormatError(err)
+	}
+	return hash, nil
+}
+
+func upsertLastSyncedSchemaHash(ctx context.Context, tx *sql.Tx, databaseID int, path string, hash string) error {
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO repository_schema_hash (
+			database_id,
+			path,
+			hash
+		)
+		VALUES ($1, $2, $3)
+		ON CONFLICT(database_id, path) DO UPDATE SET
+			hash = EXCLUDED.hash
+	`, databaseID, path, hash); err != nil {
+		return FormatError(err)
+	}
+	return nil
+}
+
+// AppendSyncHistory appends the entry to the sync history of the repository, and prunes the entries beyond the
+// most recent api.RepositorySyncHistoryRetention ones.
+func (s *RepositoryService) AppendSyncHistory(ctx context.Context, create *api.SyncHistoryEntryCreate) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	if err := appendSyncHistory(ctx, tx.PTx, create, api.RepositorySyncHistoryRetention); err != nil {
+		return err
+	}
+
+	if err := tx.PTx.Commit(); err != nil {
+		return FormatError(err)
+	}
+
+	return nil
+}
+
+// RecordSyncResult counts the consecutive sync failures of the repository, which a successful sync resets, and quarantines
+// the repository once the count reaches threshold. Returns true only if the failure quarantines the repository, so the
+// quarantine is alerted once however many in-flight syncs fail afterwards.
+func (s *RepositoryService) RecordSyncResult(ctx context.Context, repositoryID int, result api.RepositorySyncResult, threshold int) (bool, error) {
+	if threshold < 1 {
+		return false, &common.Error{Code: common.Invalid, Err: fmt.Errorf("quarantine threshold must be positive, got %d", threshold)}
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	quarantined, err := recordSyncResult(ctx, tx.PTx, repositoryID, result, threshold)
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.PTx.Commit(); err != nil {
+		return false, FormatError(err)
+	}
+	if quarantined {
+		s.invalidateRepository(repositoryID)
+	}
+
+	return quarantined, nil
+}
+
+// ListSyncHistory returns the most recent limit entries of the sync history of the repository, the latest first.
+func (s *RepositoryService) ListSyncHistory(ctx context.Context, repositoryID int, limit int) ([]*api.SyncHistoryEntry, error) {
+	if limit <= 0 {
+		return nil, &common.Error{Code: common.Invalid, Err: fmt.Errorf("limit must be positive, got %d", limit)}
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	return listSyncHistory(ctx, tx.PTx, repositoryID, limit)
+}
+
+func appendSyncHistory(ctx context.Context, tx *sql.Tx, create *api.SyncHistoryEntryCreate, retention int) error {
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO repository_sync_history (
+			repository_id,
+			ref,
+			commit_id,
+			result,
+			detail,
+			started_ts,
+			duration_ms
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`,
+		create.RepositoryID,
+		create.Ref,
+		create.CommitID,
+		create.Result,
+		create.Detail,
+		create.StartedTs,
+		create.DurationMs,
+	); err != nil {
+		return FormatError(err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM repository_sync_history
+		WHERE repository_id = $1 AND id NOT IN (
+			SELECT id FROM repository_sync_history
+			WHERE repository_id = $1
+			ORDER BY id DESC
+			LIMIT $2
+		)
+	`, create.RepositoryID, retention); err != nil {
+		return FormatError(err)
+	}
+	return nil
+}
+
+func listSyncHistory(ctx context.Context, tx *sql.Tx, repositoryID int, limit int) ([]*api.SyncHistoryEntry, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, repository_id, ref, commit_id, result, detail, started_ts, duration_ms
+		FROM repository_sync_history
+		WHERE repository_id = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`, repositoryID, limit)
+	if err != nil {
+		return nil, FormatError(err)
+	}
+	defer rows.Close()
+
+	var list []*api.SyncHistoryEntry
+	for rows.Next() {
+		var entry api.SyncHistoryEntry
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.RepositoryID,
+			&entry.Ref,
+			&entry.CommitID,
+			&entry.Result,
+			&entry.Detail,
+			&entry.StartedTs,
+			&entry.DurationMs,
+		); err != nil {
+			return nil, FormatError(err)
+		}
+		list = append(list, &entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, FormatError(err)
+	}
+	return list, nil
+}
+
+func recordSyncResult(ctx context.Context, tx *sql.Tx, repositoryID int, result api.RepositorySyncResult, threshold int) (bool, error) {
+	if result == api.RepositorySyncSuccess {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE repository
+			SET sync_failure_count = 0
+			WHERE id = $1 AND sync_failure_count <> 0
+		`, repositoryID); err != nil {
+			return false, FormatError(err)
+		}
+		return false, nil
+	}
+
+	// The count and the status are updated by a single statement, so the concurrent failures can't skip the threshold.
+	var count int
+	var status api.RepositorySyncStatus
+	if err := tx.QueryRowContext(ctx, `
+		UPDATE repository
+		SET sync_failure_count = sync_failure_count + 1,
+			sync_status = CASE WHEN sync_failure_count + 1 >= $1 THEN $2 ELSE sync_status END
+		WHERE id = $3
+		RETURNING sync_failure_count, sync_status
+	`, threshold, api.SyncQuarantined, repositoryID).Scan(&count, &status); err != nil {
+		if err == sql.ErrNoRows {
+			return false, &common.Error{Code: common.NotFound, Err: fmt.Errorf("repository ID not found: %d", repositoryID)}
+		}
+		return false, FormatError(err)
+	}
+	// Un-quarantining resets the count, so the count only reaches the threshold once per quarantine.
+	return status == api.SyncQuarantined && count == threshold, nil
+}
+
+// postgresNowTs is the current unix timestamp of the database clock.
+const postgresNowTs = "extract(epoch from now())::BIGINT"
+
+// claimRepositorySyncQuery returns the query claiming the lease of the repository sync, using nowTs as the current unix timestamp.
+// The lease is acquired if it's free, expired or already held by the same owner, in which case it's renewed.
+func claimRepositorySyncQuery(nowTs string) string {
+	return fmt.Sprintf(`
+		UPDATE repository
+		SET lease_owner = $1, lease_expires_ts = %s + $2
+		WHERE id = $3 AND (lease_owner IS NULL OR lease_owner = $1 OR lease_expires_ts < %s)
+	`, nowTs, nowTs)
+}
+
+func claimRepositorySync(ctx context.Context, tx *sql.Tx, nowTs string, repositoryID int, leaseTTL time.Duration, owner string) (bool, error) {
+	result, err := tx.ExecContext(ctx, claimRepositorySyncQuery(nowTs), owner, int64(leaseTTL/time.Second), repositoryID)
+	if err != nil {
+		return false, FormatError(err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, FormatError(err)
+	}
+	return rowsAffected == 1, nil
+}
+
+func releaseRepositorySync(ctx context.Context, tx *sql.Tx, repositoryID int, owner string) error {
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE repository
+		SET lease_owner = NULL, lease_expires_ts = NULL
+		WHERE id = $1 AND lease_owner = $2
+	`, repositoryID, owner); err != nil {
+		return FormatError(err)
+	}
+	return nil
+}
+
+func swapRepositoryToken(ctx context.Context, tx *sql.Tx, swap *api.RepositoryTokenSwap) (bool, error) {
+	// 0 means the access token never expires, which is stored as NULL.
+	expiresTs := sql.NullInt64{Int64: swap.ExpiresTs, Valid: swap.ExpiresTs != 0}
+	result, err := tx.ExecContext(ctx, `
+		UPDATE repository
+		SET updater_id = $1, access_token = $2, expires_ts = $3, refresh_token = $4, token_status = $5
+		WHERE id = $6 AND refresh_token = $7
+	`,
+		swap.UpdaterID,
+		swap.AccessToken,
+		expiresTs,
+		swap.RefreshToken,
+		api.TokenValid,
+		swap.ID,
+		swap.OldRefreshToken,
+	)
+	if err != nil {
+		return false, FormatError(err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, FormatError(err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// createRepository creates a new repository.
+func (s *RepositoryService) createRepository(ctx context.Context, tx *sql.Tx, create *api.RepositoryCreate) (*api.Repository, error) {
+	if err := prepareWebhookSecretToken(create); err != nil {
+		return nil, err
+	}
+	if create.WebhookStatus == "" {
+		create.WebhookStatus = api.WebhookActive
+	}
+	if create.SchemaSourceType == "" {
+		create.SchemaSourceType = api.SchemaSourceSingleFile
+	}
+	if create.DuplicateVersionPolicy == "" {
+		create.DuplicateVersionPolicy = api.DuplicateVersionError
+	}
+	if create.EmptyMigrationPolicy == "" {
+		create.EmptyMigrationPolicy = api.EmptyMigrationSkip
+	}
+	if create.DriftAction == "" {
+		create.DriftAction = api.DriftActionAnomalyOnly
+	}
+	if err := lockProject(ctx, tx, create.ProjectID); err != nil {
+		return nil, err
+	}
+	restored, err := s.restorePendingRepository(ctx, tx, create)
+	if err != nil {
+		return nil, err
+	}
+	if restored != nil {
+		return restored, nil
+	}
+	accessRef, err := s.putSecret("", create.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	refreshRef, err := s.putSecret("", create.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Insert row into database.
+	row, err := tx.QueryContext(ctx, `
+		INSERT INTO repository (
+			creator_id,
+			updater_id,
+			vcs_id,
+			project_id,
+			deployment_config_id,
+			default_assignee_id,
+			name,
+			full_path,
+			web_url,
+			branch_filter,
+			target_branch_filter,
+			base_directory,
+			file_path_template,
+			schema_path_template,
+			schema_source_type,
+			duplicate_version_policy,
+			empty_migration_policy,
+			migration_statement_timeout,
+			drift_action,
+			provider_user_id,
+			provider_username,
+			require_signed_commits,
+			skip_directive,
+			schema_ref,
+			schema_snapshot_on_apply,
+			ignore_path_patterns,
+			notification_webhook_url_list,
+			commit_author_name,
+			commit_author_email,
+			commit_status_context,
+			external_id,
+			external_webhook_id,
+			webhook_url_host,
+			webhook_endpoint_id,
+			webhook_secret_token,
+			webhook_status,
+			access_token,
+			expires_ts,
+			refresh_token
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33, $34, $35, $36, $37, $38, $39)
+		RETURNING id, creator_id, created_ts, updater_id, updated_ts, vcs_id, project_id, deployment_config_id, default_assignee_id, name, full_path, web_url, branch_filter, target_branch_filter, base_directory, file_path_template, schema_path_template, schema_source_type, duplicate_version_policy, empty_migration_policy, migration_statement_timeout, drift_action, provider_user_id, provider_username, require_signed_commits, skip_directive, schema_ref, schema_snapshot_on_apply, ignore_path_patterns, notification_webhook_url_list, commit_author_name, commit_author_email, commit_status_context, labels, branch_environment_mapping, external_id, external_webhook_id, webhook_url_host, webhook_endpoint_id, webhook_secret_token, webhook_status, token_status, provider_status, sync_status, sync_failure_count, access_token, expires_ts, refresh_token
+	`,
+		create.CreatorID,
+		create.CreatorID,
+		create.VCSID,
+		create.ProjectID,
+		create.DeploymentConfigID,
+		create.DefaultAssigneeID,
+		create.Name,
+		create.FullPath,
+		create.WebURL,
+		create.BranchFilter,
+		create.TargetBranchFilter,
+		create.BaseDirectory,
+		create.FilePathTemplate,
+		create.SchemaPathTemplate,
+		create.SchemaSourceType,
+		create.DuplicateVersionPolicy,
+		create.EmptyMigrationPolicy,
+		create.MigrationStatementTimeout,
+		create.DriftAction,
+		create.ProviderUserID,
+		create.ProviderUsername,
+		create.RequireSignedCommits,
+		create.SkipDirective,
+		create.SchemaRef,
+		create.SchemaSnapshotOnApply,
+		strings.Join(create.IgnorePathPatterns, ","),
+		strings.Join(create.NotificationWebhookURLList, ","),
+		create.CommitAuthorName,
+		create.CommitAuthorEmail,
+		create.CommitStatusContext,
+		create.ExternalID,
+		create.ExternalWebhookID,
+		create.WebhookURLHost,
+		create.WebhookEndpointID,
+		create.WebhookSecretToken,
+		create.WebhookStatus,
+		accessRef,
+		// 0 means the access token never expires, which is stored as NULL.
+		sql.NullInt64{Int64: create.ExpiresTs, Valid: create.ExpiresTs != 0},
+		refreshRef,
+	)
+
+	if err != nil {
+		return nil, FormatError(err)
+	}
+	defer row.Close()
+
+	row.Next()
+	var repository api.Repository
+	var ignorePathPatterns string
+	var notificationWebhookURLList string
+	var labels string
+	var branchEnvironmentMapping string
+	if err := row.Scan(
+		&repository.ID,
+		&repository.CreatorID,
+		&repository.CreatedTs,
+		&repository.UpdaterID,
+		&repository.UpdatedTs,
+		&repository.VCSID,
+		&repository.ProjectID,
+		&repository.DeploymentConfigID,
+		&repository.DefaultAssigneeID,
+		&repository.Name,
+		&repository.FullPath,
+		&repository.WebURL,
+		&repository.BranchFilter,
+		&repository.TargetBranchFilter,
+		&repository.BaseDirectory,
+		&repository.FilePathTemplate,
+		&repository.SchemaPathTemplate,
+		&repository.SchemaSourceType,
+		&repository.DuplicateVersionPolicy,
+		&repository.EmptyMigrationPolicy,
+		&repository.MigrationStatementTimeout,
+		&repository.DriftAction,
+		&repository.ProviderUserID,
+		&repository.ProviderUsername,
+		&repository.RequireSignedCommits,
+		&repository.SkipDirective,
+		&repository.SchemaRef,
+		&repository.SchemaSnapshotOnApply,
+		&ignorePathPatterns,
+		&notificationWebhookURLList,
+		&repository.CommitAuthorName,
+		&repository.CommitAuthorEmail,
+		&repository.CommitStatusContext,
+		&labels,
+		&branchEnvironmentMapping,
+		&repository.ExternalID,
+		&repository.ExternalWebhookID,
+		&repository.WebhookURLHost,
+		&repository.WebhookEndpointID,
+		&repository.WebhookSecretToken,
+		&repository.WebhookStatus,
+		&repository.TokenStatus,
+		&repository.ProviderStatus,
+		&repository.SyncStatus,
+		&repository.SyncFailureCount,
+		&repository.AccessToken,
+		&repository.ExpiresTs,
+		&repository.RefreshToken,
+	); err != nil {
+		return nil, FormatError(err)
+	}
+	if ignorePathPatterns != "" {
+		repository.IgnorePathPatterns = strings.Split(ignorePathPatterns, ",")
+	}
+	if notificationWebhookURLList != "" {
+		repository.NotificationWebhookURLList = strings.Split(notificationWebhookURLList, ",")
+	}
+	if err := json.Unmarshal([]byte(labels), &repository.Labels); err != nil {
+		return nil, FormatError(err)
+	}
+	if err := json.Unmarshal([]byte(branchEnvironmentMapping), &repository.BranchEnvironmentMapping); err != nil {
+		return nil, FormatError(err)
+	}
+
+	// Close the rows before issuing another query in the same transaction.
+	if err := row.Close(); err != nil {
+		return nil, FormatError(err)
+	}
+
+	if err := s.resolveRepositoryTokens(&repository); err != nil {
+		return nil, err
+	}
+
+	// Updates the project workflow_type to "VCS"
+	if err := s.syncProjectWorkflowType(ctx, tx, create.ProjectID, create.CreatorID); err != nil {
+		return nil, err
+	}
+
+	return &repository, nil
+}
+
+// upsertRepository creates a new repository or updates the repository linked to the same VCS and external ID.
+func (s *RepositoryService) upsertRepository(ctx context.Context, tx *sql.Tx, create *api.RepositoryCreate) (*api.Repository, bool, error) {
+	if err := prepareWebhookSecretToken(create); err != nil {
+		return nil, false, err
+	}
+	if create.WebhookStatus == "" {
+		create.WebhookStatus = api.WebhookActive
+	}
+	if create.SchemaSourceType == "" {
+		create.SchemaSourceType = api.SchemaSourceSingleFile
+	}
+	if create.DuplicateVersionPolicy == "" {
+		create.DuplicateVersionPolicy = api.DuplicateVersionError
+	}
+	if create.EmptyMigrationPolicy == "" {
+		create.EmptyMigrationPolicy = api.EmptyMigrationSkip
+	}
+	if create.DriftAction == "" {
+		create.DriftAction = api.DriftActionAnomalyOnly
+	}
+	if err := lockProject(ctx, tx, create.ProjectID); err != nil {
+		return nil, false, err
+	}
+
+	// The tokens of the existing repository are replaced in the secret store, instead of leaving them behind.
+	tokenCreate := *create
+	if create.AccessToken != "" {
+		oldAccessRef, oldRefreshRef, err := findRepositoryTokenRefs(ctx, tx, "vcs_id = $1 AND external_id = $2 AND row_status = 'NORMAL'", create.VCSID, create.ExternalID)
+		if err != nil {
+			return nil, false, err
+		}
+		if tokenCreate.AccessToken, err = s.putSecret(oldAccessRef, create.AccessToken); err != nil {
+			return nil, false, err
+		}
+		if tokenCreate.RefreshToken, err = s.putSecret(oldRefreshRef, create.RefreshToken); err != nil {
+			return nil, false, err
+		}
+	}
+
+	query, args := upsertRepositoryQuery(&tokenCreate)
+	row, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, false, FormatError(err)
+	}
+	defer row.Close()
+
+	// The conflicting row isn't updated, and thus not returned, if it's linked to another project.
+	if !row.Next() {
+		if err := row.Err(); err != nil {
+			return nil, false, FormatError(err)
+		}
+		return nil, false, &common.Error{Code: common.Conflict, Err: fmt.Errorf("repository %s of VCS %d is linked to another project", create.ExternalID, create.VCSID)}
+	}
+	var repository api.Repository
+	var ignorePathPatterns string
+	var notificationWebhookURLList string
+	var labels string
+	var branchEnvironmentMapping string
+	var created bool
+	if err := row.Scan(
+		&repository.ID,
+		&repository.CreatorID,
+		&repository.CreatedTs,
+		&repository.UpdaterID,
+		&repository.UpdatedTs,
+		&repository.VCSID,
+		&repository.ProjectID,
+		&repository.DeploymentConfigID,
+		&repository.DefaultAssigneeID,
+		&repository.Name,
+		&repository.FullPath,
+		&repository.WebURL,
+		&repository.BranchFilter,
+		&repository.TargetBranchFilter,
+		&repository.BaseDirectory,
+		&repository.FilePathTemplate,
+		&repository.SchemaPathTemplate,
+		&repository.SchemaSourceType,
+		&repository.DuplicateVersionPolicy,
+		&repository.EmptyMigrationPolicy,
+		&repository.MigrationStatementTimeout,
+		&repository.DriftAction,
+		&repository.ProviderUserID,
+		&repository.ProviderUsername,
+		&repository.RequireSignedCommits,
+		&repository.SkipDirective,
+		&repository.SchemaRef,
+		&repository.SchemaSnapshotOnApply,
+		&ignorePathPatterns,
+		&notificationWebhookURLList,
+		&repository.CommitAuthorName,
+		&repository.CommitAuthorEmail,
+		&repository.CommitStatusContext,
+		&labels,
+		&branchEnvironmentMapping,
+		&repository.ExternalID,
+		&repository.ExternalWebhookID,
+		&repository.WebhookURLHost,
+		&repository.WebhookEndpointID,
+		&repository.WebhookSecretToken,
+		&repository.WebhookStatus,
+		&repository.TokenStatus,
+		&repository.ProviderStatus,
+		&repository.SyncStatus,
+		&repository.SyncFailureCount,
+		&repository.AccessToken,
+		&repository.ExpiresTs,
+		&repository.RefreshToken,
+		&created,
+	); err != nil {
+		return nil, false, FormatError(err)
+	}
+	if ignorePathPatterns != "" {
+		repository.IgnorePathPatterns = strings.Split(ignorePathPatterns, ",")
+	}
+	if notificationWebhookURLList != "" {
+		repository.NotificationWebhookURLList = strings.Split(notificationWebhookURLList, ",")
+	}
+	if err := json.Unmarshal([]byte(labels), &repository.Labels); err != nil {
+		return nil, false, FormatError(err)
+	}
+	if err := json.Unmarshal([]byte(branchEnvironmentMapping), &repository.BranchEnvironmentMapping); err != nil {
+		return nil, false, FormatError(err)
+	}
+
+	// Close the rows before issuing another query in the same transaction.
+	if err := row.Close(); err != nil {
+		return nil, false, FormatError(err)
+	}
+
+	if err := s.resolveRepositoryTokens(&repository); err != nil {
+		return nil, false, err
+	}
+
+	// Updates the project workflow_type to "VCS"
+	if err := s.syncProjectWorkflowType(ctx, tx, create.ProjectID, create.CreatorID); err != nil {
+		return nil, false, err
+	}
+
+	return &repository, created, nil
+}
+
+// singleRepository returns the only repository in the list and the length of the list.
+// The repository is nil unless the list has exactly 1 repository.
+func singleRepository(list []*api.Repository) (*api.Repository, int) {
+	if len(list) != 1 {
+		return nil, len(list)
+	}
+	return list[0], 1
+}
+
+// prepareWebhookSecretToken generates a strong webhook secret token if the create doesn't provide one,
+// otherwise it validates the provided one is strong enough.
+func prepareWebhookSecretToken(create *api.RepositoryCreate) error {
+	if create.WebhookSecretToken == "" {
+		token, err := common.RandomSecret(api.WebhookSecretTokenLength)
+		if err != nil {
+			return fmt.Errorf("failed to generate webhook secret token: %w", err)
+		}
+		create.WebhookSecretToken = token
+		return nil
+	}
+	return api.ValidateRepositoryWebhookSecretToken(create.WebhookSecretToken)
+}
+
+// upsertRepositoryQuery returns the query upserting the repository on the unique (vcs_id, external_id).
+// The last returned column is true if the row is inserted, since xmax is 0 for the newly inserted row in Postgres.
+func upsertRepositoryQuery(create *api.RepositoryCreate) (string, []interface{}) {
+	args := []interface{}{
+		create.CreatorID,
+		create.CreatorID,
+		create.VCSID,
+		create.ProjectID,
+		create.DeploymentConfigID,
+		create.DefaultAssigneeID,
+		create.Name,
+		create.FullPath,
+		create.WebURL,
+		create.BranchFilter,
+		create.TargetBranchFilter,
+		create.BaseDirectory,
+		create.FilePathTemplate,
+		create.SchemaPathTemplate,
+		create.SchemaSourceType,
+		create.DuplicateVersionPolicy,
+		create.EmptyMigrationPolicy,
+		create.MigrationStatementTimeout,
+		create.DriftAction,
+		create.ProviderUserID,
+		create.ProviderUsername,
+		create.RequireSignedCommits,
+		create.SkipDirective,
+		create.SchemaRef,
+		create.SchemaSnapshotOnApply,
+		strings.Join(create.IgnorePathPatterns, ","),
+		strings.Join(create.NotificationWebhookURLList, ","),
+		create.CommitAuthorName,
+		create.CommitAuthorEmail,
+		create.CommitStatusContext,
+		create.ExternalID,
+		create.ExternalWebhookID,
+		create.WebhookURLHost,
+		create.WebhookEndpointID,
+		create.WebhookSecretToken,
+		create.WebhookStatus,
+		create.AccessToken,
+		// 0 means the access token never expires, which is stored as NULL.
+		sql.NullInt64{Int64: create.ExpiresTs, Valid: create.ExpiresTs != 0},
+		create.RefreshToken,
+	}
+
+	set := []string{
+		"updater_id = EXCLUDED.updater_id",
+		"name = EXCLUDED.name",
+		"full_path = EXCLUDED.full_path",
+		"web_url = EXCLUDED.web_url",
+		"deployment_config_id = EXCLUDED.deployment_config_id",
+		"default_assignee_id = EXCLUDED.default_assignee_id",
+		"branch_filter = EXCLUDED.branch_filter",
+		"target_branch_filter = EXCLUDED.target_branch_filter",
+		"base_directory = EXCLUDED.base_directory",
+		"file_path_template = EXCLUDED.file_path_template",
+		"schema_path_template = EXCLUDED.schema_path_template",
+		"schema_source_type = EXCLUDED.schema_source_type",
+		"duplicate_version_policy = EXCLUDED.duplicate_version_policy",
+		"empty_migration_policy = EXCLUDED.empty_migration_policy",
+		"migration_statement_timeout = EXCLUDED.migration_statement_timeout",
+		"drift_action = EXCLUDED.drift_action",
+		"provider_user_id = EXCLUDED.provider_user_id",
+		"provider_username = EXCLUDED.provider_username",
+		"require_signed_commits = EXCLUDED.require_signed_commits",
+		"skip_directive = EXCLUDED.skip_directive",
+		"schema_ref = EXCLUDED.schema_ref",
+		"schema_snapshot_on_apply = EXCLUDED.schema_snapshot_on_apply",
+		"notification_webhook_url_list = EXCLUDED.notification_webhook_url_list",
+		"ignore_path_patterns = EXCLUDED.ignore_path_patterns",
+		"commit_author_name = EXCLUDED.commit_author_name",
+		"commit_author_email = EXCLUDED.commit_author_email",
+		"commit_status_context = EXCLUDED.commit_status_context",
+		// provider_status isn't inserted, so linking the repository again resets it to the default PROVIDER_FOUND.
+		"provider_status = EXCLUDED.provider_status",
+		// Same for the quarantine, since linking the repository again is the operator fixing the config.
+		"sync_status = EXCLUDED.sync_status",
+		"sync_failure_count = EXCLUDED.sync_failure_count",
+	}
+	if create.ExternalWebhookID != "" {
+		set = append(set,
+			"external_webhook_id = EXCLUDED.external_webhook_id",
+			"webhook_url_host = EXCLUDED.webhook_url_host",
+			"webhook_endpoint_id = EXCLUDED.webhook_endpoint_id",
+			"webhook_secret_token = EXCLUDED.webhook_secret_token",
+			"webhook_status = EXCLUDED.webhook_status",
+		)
+	}
+	if create.AccessToken != "" {
+		set = append(set,
+			"access_token = EXCLUDED.access_token",
+			"expires_ts = EXCLUDED.expires_ts",
+			"refresh_token = EXCLUDED.refresh_token",
+			// token_status isn't inserted, so the new access token resets it to the default TOKEN_VALID.
+			"token_status = EXCLUDED.token_status",
+		)
+	}
+
+	query := `
+		INSERT INTO repository (
+			creator_id,
+			updater_id,
+			vcs_id,
+			project_id,
+			deployment_config_id,
+			default_assignee_id,
+			name,
+			full_path,
+			web_url,
+			branch_filter,
+			target_branch_filter,
+			base_directory,
+			file_path_template,
+			schema_path_template,
+			schema_source_type,
+			duplicate_version_policy,
+			empty_migration_policy,
+			migration_statement_timeout,
+			drift_action,
+			provider_user_id,
+			provider_username,
+			require_signed_commits,
+			skip_directive,
+			schema_ref,
+			schema_snapshot_on_apply,
+			ignore_path_patterns,
+			notification_webhook_url_list,
+			commit_author_name,
+			commit_author_email,
+			commit_status_context,
+			external_id,
+			external_webhook_id,
+			webhook_url_host,
+			webhook_endpoint_id,
+			webhook_secret_token,
+			webhook_status,
+			access_token,
+			expires_ts,
+			refresh_token
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33, $34, $35, $36, $37, $38, $39)
+		ON CONFLICT (vcs_id, external_id) WHERE row_status = 'NORMAL' DO UPDATE
+		SET ` + strings.Join(set, ", ") + `
+		WHERE repository.project_id = EXCLUDED.project_id
+		RETURNING id, creator_id, created_ts, updater_id, updated_ts, vcs_id, project_id, deployment_config_id, default_assignee_id, name, full_path, web_url, branch_filter, target_branch_filter, base_directory, file_path_template, schema_path_template, schema_source_type, duplicate_version_policy, empty_migration_policy, migration_statement_timeout, drift_action, provider_user_id, provider_username, require_signed_commits, skip_directive, schema_ref, schema_snapshot_on_apply, ignore_path_patterns, notification_webhook_url_list, commit_author_name, commit_author_email, commit_status_context, labels, branch_environment_mapping, external_id, external_webhook_id, webhook_url_host, webhook_endpoint_id, webhook_secret_token, webhook_status, token_status, provider_status, sync_status, sync_failure_count, access_token, expires_ts, refresh_token, (xmax = 0)
+	`
+	return query, args
+}
+
+func findRepositoryList(ctx context.Context, tx *sql.Tx, find *api.RepositoryFind) (_ []*api.Repository, err error) {
+	where, args, err := findRepositoryWhere(find)
+	if err != nil {
+		return nil, err
+	}
+
+	// The secrets are only selected if requested, so they aren't handled unnecessarily.
+	secretColumns := ""
+	if find.IncludeSecrets {
+		secretColumns = `,
+			webhook_secret_token,
+			access_token,
+			refresh_token`
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT
+			id,
+			creator_id,
+			created_ts,
+			updater_id,
+			updated_ts,
+			vcs_id,
+			project_id,
+			deployment_config_id,
+			default_assignee_id,
+			name,
+			full_path,
+			web_url,
+			branch_filter,
+			target_branch_filter,
+			base_directory,
+			file_path_template,
+			schema_path_template,
+			schema_source_type,
+			duplicate_version_policy,
+			empty_migration_policy,
+			migration_statement_timeout,
+			drift_action,
+			provider_user_id,
+			provider_username,
+			require_signed_commits,
+			skip_directive,
+			schema_ref,
+			schema_snapshot_on_apply,
+			ignore_path_patterns,
+			notification_webhook_url_list,
+			commit_author_name,
+			commit_author_email,
+			commit_status_context,
+			labels,
+			branch_environment_mapping,
+			external_id,
+			external_webhook_id,
+			webhook_url_host,
+			webhook_endpoint_id,
+			webhook_status,
+			token_status,
+			provider_status,
+			sync_status,
+			sync_failure_count,
+			expires_ts`+secretColumns+`
+		FROM repository
+		WHERE `+strings.Join(where, " AND "),
+		args...,
+	)
+	if err != nil {
+		return nil, FormatError(err)
+	}
+	defer rows.Close()
+
+	// Iterate over result set and deserialize rows into list.
+	list := make([]*api.Repository, 0)
+	for rows.Next() {
+		var repository api.Repository
+		var ignorePathPatterns string
+		var notificationWebhookURLList string
+		var labels string
+		var branchEnvironmentMapping string
+		dest := []interface{}{
+			&repository.ID,
+			&repository.CreatorID,
+			&repository.CreatedTs,
+			&repository.UpdaterID,
+			&repository.UpdatedTs,
+			&repository.VCSID,
+			&repository.ProjectID,
+			&repository.DeploymentConfigID,
+			&repository.DefaultAssigneeID,
+			&repository.Name,
+			&repository.FullPath,
+			&repository.WebURL,
+			&repository.BranchFilter,
+			&repository.TargetBranchFilter,
+			&repository.BaseDirectory,
+			&repository.FilePathTemplate,
+			&repository.SchemaPathTemplate,
+			&repository.SchemaSourceType,
+			&repository.DuplicateVersionPolicy,
+			&repository.EmptyMigrationPolicy,
+			&repository.MigrationStatementTimeout,
+			&repository.DriftAction,
+			&repository.ProviderUserID,
+			&repository.ProviderUsername,
+			&repository.RequireSignedCommits,
+			&repository.SkipDirective,
+			&repository.SchemaRef,
+			&repository.SchemaSnapshotOnApply,
+			&ignorePathPatterns,
+			&notificationWebhookURLList,
+			&repository.CommitAuthorName,
+			&repository.CommitAuthorEmail,
+			&repository.CommitStatusContext,
+			&labels,
+			&branchEnvironmentMapping,
+			&repository.ExternalID,
+			&repository.ExternalWebhookID,
+			&repository.WebhookURLHost,
+			&repository.WebhookEndpointID,
+			&repository.WebhookStatus,
+			&repository.TokenStatus,
+			&repository.ProviderStatus,
+			&repository.SyncStatus,
+			&repository.SyncFailureCount,
+			&repository.ExpiresTs,
+		}
+		if find.IncludeSecrets {
+			dest = append(dest,
+				&repository.WebhookSecretToken,
+				&repository.AccessToken,
+				&repository.RefreshToken,
+			)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, FormatError(err)
+		}
+		if ignorePathPatterns != "" {
+			repository.IgnorePathPatterns = strings.Split(ignorePathPatterns, ",")
+		}
+		if notificationWebhookURLList != "" {
+			repository.NotificationWebhookURLList = strings.Split(notificationWebhookURLList, ",")
+		}
+		if err := json.Unmarshal([]byte(labels), &repository.Labels); err != nil {
+			return nil, FormatError(err)
+		}
+		if err := json.Unmarshal([]byte(branchEnvironmentMapping), &repository.BranchEnvironmentMapping); err != nil {
+			return nil, FormatError(err)
+		}
+
+		list = append(list, &repository)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, FormatError(err)
+	}
+
+	return list, nil
+}
+
+func findRepositoryIDs(ctx context.Context, tx *sql.Tx, find *api.RepositoryFind) ([]int, error) {
+	where, args, err := findRepositoryWhere(find)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id
+		FROM repository
+		WHERE `+strings.Join(where, " AND "),
+		args...,
+	)
+	if err != nil {
+		return nil, FormatError(err)
+	}
+	defer rows.Close()
+
+	idList := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, FormatError(err)
+		}
+		idList = append(idList, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, FormatError(err)
+	}
+
+	return idList, nil
+}
+
+// findRepositoryWhere builds the WHERE clause and its arguments for find.
+func findRepositoryWhere(find *api.RepositoryFind) ([]string, []interface{}, error) {
+	if find.ID != nil && find.IDList != nil {
+		return nil, nil, &common.Error{Code: common.Invalid, Err: fmt.Errorf("ID and IDList can't be used together in repository find")}
+	}
+
+	// The archived repositories are left by the deleted projects, which are never found.
+	where, args := []string{"row_status = 'NORMAL'"}, []interface{}{}
+	if v := find.ID; v != nil {
+		where, args = append(where, fmt.Sprintf("id = $%d", len(args)+1)), append(args, *v)
+	}
+	if v := find.IDList; v != nil {
+		where, args = append(where, fmt.Sprintf("id = ANY($%d)", len(args)+1)), append(args, pq.Array(v))
+	}
+	if v := find.VCSID; v != nil {
+		where, args = append(where, fmt.Sprintf("vcs_id = $%d", len(args)+1)), append(args, *v)
+	}
+	if v := find.ProjectID; v != nil {
+		where, args = append(where, fmt.Sprintf("project_id = $%d", len(args)+1)), append(args, *v)
+	}
+	if v := find.WebhookEndpointID; v != nil {
+		where, args = append(where, fmt.Sprintf("webhook_endpoint_id = $%d", len(args)+1)), append(args, *v)
+	}
+	if v := find.VCSType; v != nil {
+		where, args = append(where, fmt.Sprintf("vcs_id IN (SELECT id FROM vcs WHERE type = $%d)", len(args)+1)), append(args, *v)
+	}
+	if v := find.LabelSelector; len(v) > 0 {
+		labels, err := json.Marshal(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		// jsonb_contains is the function of the JSONB containment operator @>, matching the repositories labeled with a superset.
+		where, args = append(where, fmt.Sprintf("jsonb_contains(labels, $%d)", len(args)+1)), append(args, string(labels))
+	}
+	if find.WithoutWebhook {
+		where = append(where, "COALESCE(external_webhook_id, '') = ''")
+	}
+	if find.WithoutVCS {
+		where = append(where, "NOT EXISTS (SELECT 1 FROM vcs WHERE vcs.id = repository.vcs_id)")
+	}
+	if v := find.ExpiresBefore; v != nil {
+		where, args = append(where, fmt.Sprintf("expires_ts < $%d", len(args)+1)), append(args, *v)
+	}
+	if v := find.TokenStatus; v != nil {
+		where, args = append(where, fmt.Sprintf("token_status = $%d", len(args)+1)), append(args, *v)
+	}
+	if v := find.SearchTerm; v != nil && *v != "" {
+		n := len(args) + 1
+		where, args = append(where, fmt.Sprintf(`(name ILIKE $%d ESCAPE '\' OR full_path ILIKE $%d ESCAPE '\' OR web_url ILIKE $%d ESCAPE '\')`, n, n, n)), append(args, "%"+escapeLikePattern(*v)+"%")
+	}
+	if v := find.WebURL; v != nil {
+		normalized := api.NormalizeRepositoryWebURL(*v)
+		if normalized == "" {
+			return nil, nil, &common.Error{Code: common.Invalid, Err: fmt.Errorf("invalid repository URL %q", *v)}
+		}
+		// The web URL of the repository is the http(s) URL, which is normalized by dropping the trailing slash and the case.
+		n := len(args) + 1
+		where, args = append(where, fmt.Sprintf("LOWER(RTRIM(web_url, '/')) IN ($%d, $%d)", n, n+1)), append(args, "https://"+normalized, "http://"+normalized)
+	}
+	return where, args, nil
+}
+
+// escapeLikePattern escapes the wildcards of the LIKE pattern, so that the term is matched literally with ESCAPE '\'.
+func escapeLikePattern(term string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(term)
+}
+
+// patchRepository updates a repository by ID. Returns the new state of the repository after update.
+// fieldSpec is a column to set in an UPDATE clause. value is a pointer to the new value of the column,
+// and the column is left unchanged if it's nil, which is how the optional fields of a patch are represented.
+type fieldSpec struct {
+	column string
+	value  interface{}
+}
+
+// buildSetClause returns the SET clause of an UPDATE statement for the fields with a non-nil value, in the form of
+// "column1 = $1, column2 = $2", along with the dereferenced values as the args numbered accordingly.
+func buildSetClause(fields []fieldSpec) (string, []interface{}) {
+	var set []string
+	var args []interface{}
+	for _, field := range fields {
+		v := reflect.ValueOf(field.value)
+		if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+			continue
+		}
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		set, args = append(set, fmt.Sprintf("%s = $%d", field.column, len(args)+1)), append(args, v.Interface())
+	}
+	return strings.Join(set, ", "), args
+}
+
+func patchRepository(ctx context.Context, tx *sql.Tx, patch *api.RepositoryPatch) (*api.Repository, error) {
+	if v := patch.WebhookSecretToken; v != nil {
+		if err := api.ValidateRepositoryWebhookSecretToken(*v); err != nil {
+			return nil, err
+		}
+	}
+	var deploymentConfigID *sql.NullInt64
+	if v := patch.DeploymentConfigID; v != nil {
+		// 0 means the deployment config of the project is used, which is stored as NULL.
+		deploymentConfigID = &sql.NullInt64{Int64: int64(*v), Valid: *v != 0}
+	}
+	var defaultAssigneeID *sql.NullInt64
+	if v := patch.DefaultAssigneeID; v != nil {
+		// 0 means no default assignee, which is stored as NULL.
+		defaultAssigneeID = &sql.NullInt64{Int64: int64(*v), Valid: *v != 0}
+	}
+	var syncFailureCount *int
+	if patch.SyncStatus != nil {
+		// Un-quarantining the repository starts counting the consecutive sync failures over.
+		zero := 0
+		syncFailureCount = &zero
+	}
+	var ignorePathPatterns *string
+	if v := patch.IgnorePathPatterns; v != nil {
+		patterns := strings.Join(*v, ",")
+		ignorePathPatterns = &patterns
+	}
+	var expiresTs *sql.NullInt64
+	if v := patch.ExpiresTs; v != nil {
+		// 0 means the access token never expires, which is stored as NULL.
+		expiresTs = &sql.NullInt64{Int64: *v, Valid: *v != 0}
+	}
+
+	// Build UPDATE clause.
+	set, args := buildSetClause([]fieldSpec{
+		{"updater_id", &patch.UpdaterID},
+		{"deployment_config_id", deploymentConfigID},
+		{"default_assignee_id", defaultAssigneeID},
+		{"branch_filter", patch.BranchFilter},
+		{"target_branch_filter", patch.TargetBranchFilter},
+		{"base_directory", patch.BaseDirectory},
+		{"file_path_template", patch.FilePathTemplate},
+		{"schema_path_template", patch.SchemaPathTemplate},
+		{"schema_source_type", patch.SchemaSourceType},
+		{"duplicate_version_policy", patch.DuplicateVersionPolicy},
+		{"empty_migration_policy", patch.EmptyMigrationPolicy},
+		{"migration_statement_timeout", patch.MigrationStatementTimeout},
+		{"drift_action", patch.DriftAction},
+		{"require_signed_commits", patch.RequireSignedCommits},
+		{"skip_directive", patch.SkipDirective},
+		{"schema_ref", patch.SchemaRef},
+		{"schema_snapshot_on_apply", patch.SchemaSnapshotOnApply},
+		{"ignore_path_patterns", ignorePathPatterns},
+		{"notification_webhook_url_list", patch.NotificationWebhookURLList},
+		{"commit_author_name", patch.CommitAuthorName},
+		{"commit_author_email", patch.CommitAuthorEmail},
+		{"labels", patch.Labels},
+		{"commit_status_context", patch.CommitStatusContext},
+		{"branch_environment_mapping", patch.BranchEnvironmentMapping},
+		{"webhook_secret_token", patch.WebhookSecretToken},
+		{"external_webhook_id", patch.ExternalWebhookID},
+		{"webhook_status", patch.WebhookStatus},
+		{"token_status", patch.TokenStatus},
+		{"provider_status", patch.ProviderStatus},
+		{"sync_status", patch.SyncStatus},
+		{"sync_failure_count", syncFailureCount},
+		{"access_token", patch.AccessToken},
+		{"expires_ts", expiresTs},
+		{"refresh_token", patch.RefreshToken},
+	})
+
 	args = append(args, patch.ID)
 
 	// Execute update query with RETURNING.
 	row, err := tx.QueryContext(ctx, fmt.Sprintf(`
 		UPDATE repository
-		SET `+strings.Join(set, ", ")+`
+		SET `+set+`
 		WHERE id = $%d
-		RETURNING id, creator_id, created_ts, updater_id, updated_ts, vcs_id, project_id, name, full_path, web_url, branch_filter, base_directory, file_path_template, schema_path_template, external_id, external_webhook_id, webhook_url_host, webhook_endpoint_id, webhook_secret_token, access_token, expires_ts, refresh_token
+		RETURNING id, creator_id, created_ts, updater_id, updated_ts, vcs_id, project_id, deployment_config_id, default_assignee_id, name, full_path, web_url, branch_filter, target_branch_filter, base_directory, file_path_template, schema_path_template, schema_source_type, duplicate_version_policy, empty_migration_policy, migration_statement_timeout, drift_action, provider_user_id, provider_username, require_signed_commits, skip_directive, schema_ref, schema_snapshot_on_apply, ignore_path_patterns, notification_webhook_url_list, commit_author_name, commit_author_email, commit_status_context, labels, branch_environment_mapping, external_id, external_webhook_id, webhook_url_host, webhook_endpoint_id, webhook_secret_token, webhook_status, token_status, provider_status, sync_status, sync_failure_count, access_token, expires_ts, refresh_token
 	`, len(args)),
 		args...,
 	)
@@ -356,6 +1736,10 @@ func patchRepository(ctx context.Context, tx *sql.Tx, patch *api.RepositoryPatch
 
 	if row.Next() {
 		var repository api.Repository
+		var ignorePathPatterns string
+		var notificationWebhookURLList string
+		var labels string
+		var branchEnvironmentMapping string
 		if err := row.Scan(
 			&repository.ID,
 			&repository.CreatorID,
@@ -364,24 +1748,62 @@ func patchRepository(ctx context.Context, tx *sql.Tx, patch *api.RepositoryPatch
 			&repository.UpdatedTs,
 			&repository.VCSID,
 			&repository.ProjectID,
+			&repository.DeploymentConfigID,
+			&repository.DefaultAssigneeID,
 			&repository.Name,
 			&repository.FullPath,
 			&repository.WebURL,
 			&repository.BranchFilter,
+			&repository.TargetBranchFilter,
 			&repository.BaseDirectory,
 			&repository.FilePathTemplate,
 			&repository.SchemaPathTemplate,
+			&repository.SchemaSourceType,
+			&repository.DuplicateVersionPolicy,
+			&repository.EmptyMigrationPolicy,
+			&repository.MigrationStatementTimeout,
+			&repository.DriftAction,
+			&repository.ProviderUserID,
+			&repository.ProviderUsername,
+			&repository.RequireSignedCommits,
+			&repository.SkipDirective,
+			&repository.SchemaRef,
+			&repository.SchemaSnapshotOnApply,
+			&ignorePathPatterns,
+			&notificationWebhookURLList,
+			&repository.CommitAuthorName,
+			&repository.CommitAuthorEmail,
+			&repository.CommitStatusContext,
+			&labels,
+			&branchEnvironmentMapping,
 			&repository.ExternalID,
 			&repository.ExternalWebhookID,
 			&repository.WebhookURLHost,
 			&repository.WebhookEndpointID,
 			&repository.WebhookSecretToken,
+			&repository.WebhookStatus,
+			&repository.TokenStatus,
+			&repository.ProviderStatus,
+			&repository.SyncStatus,
+			&repository.SyncFailureCount,
 			&repository.AccessToken,
 			&repository.ExpiresTs,
 			&repository.RefreshToken,
 		); err != nil {
 			return nil, FormatError(err)
 		}
+		if ignorePathPatterns != "" {
+			repository.IgnorePathPatterns = strings.Split(ignorePathPatterns, ",")
+		}
+		if notificationWebhookURLList != "" {
+			repository.NotificationWebhookURLList = strings.Split(notificationWebhookURLList, ",")
+		}
+		if err := json.Unmarshal([]byte(labels), &repository.Labels); err != nil {
+			return nil, FormatError(err)
+		}
+		if err := json.Unmarshal([]byte(branchEnvironmentMapping), &repository.BranchEnvironmentMapping); err != nil {
+			return nil, FormatError(err)
+		}
 
 		return &repository, nil
 	}
@@ -389,10 +1811,36 @@ func patchRepository(ctx context.Context, tx *sql.Tx, patch *api.RepositoryPatch
 	return nil, &common.Error{Code: common.NotFound, Err: fmt.Errorf("repository ID not found: %d", patch.ID)}
 }
 
-// deleteRepository permanently deletes a repository by ID.
+// deleteRepository permanently deletes a repository by ID, or defers the cleanup if delete.CleanupTs is set.
 func (s *RepositoryService) deleteRepository(ctx context.Context, tx *sql.Tx, delete *api.RepositoryDelete) error {
-	// Updates the project workflow_type to "UI"
-	workflowType := api.UIWorkflow
+	if err := lockProject(ctx, tx, delete.ProjectID); err != nil {
+		return err
+	}
+	if delete.CleanupTs > 0 {
+		return s.deferRepositoryCleanup(ctx, tx, delete)
+	}
+
+	// Remove row from database.
+	if _, err := tx.ExecContext(ctx, `DELETE FROM repository WHERE project_id = $1`, delete.ProjectID); err != nil {
+		return FormatError(err)
+	}
+
+	// Updates the project workflow_type to "UI" if no repository is left.
+	return s.syncProjectWorkflowType(ctx, tx, delete.ProjectID, delete.DeleterID)
+}
+
+// deferRepositoryCleanup archives the repository of the project until delete.CleanupTs, and puts the project in the VCSPendingCleanupWorkflow.
+// The caller should lock the project with lockProject beforehand.
+func (s *RepositoryService) deferRepositoryCleanup(ctx context.Context, tx *sql.Tx, delete *api.RepositoryDelete) error {
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE repository
+		SET row_status = 'ARCHIVED', cleanup_ts = $1, updater_id = $2
+		WHERE project_id = $3 AND row_status = 'NORMAL'
+	`, delete.CleanupTs, delete.DeleterID, delete.ProjectID); err != nil {
+		return FormatError(err)
+	}
+
+	workflowType := api.VCSPendingCleanupWorkflow
 	projectPatch := api.ProjectPatch{
 		ID:           delete.ProjectID,
 		UpdaterID:    delete.DeleterID,
@@ -401,10 +1849,503 @@ func (s *RepositoryService) deleteRepository(ctx context.Context, tx *sql.Tx, de
 	if _, err := s.projectService.PatchProjectTx(ctx, tx, &projectPatch); err != nil {
 		return err
 	}
+	return nil
+}
 
-	// Remove row from database.
-	if _, err := tx.ExecContext(ctx, `DELETE FROM repository WHERE project_id = $1`, delete.ProjectID); err != nil {
+// restorePendingRepository restores the repository pending cleanup of the project if create links the same VCS repository,
+// keeping the settings of the repository and replacing the tokens, the webhook and the provider user with the ones of create.
+// Otherwise, the pending cleanup is finalized right away, since the project links another repository.
+// Returns nil if there's no repository to restore. The caller should lock the project with lockProject beforehand.
+func (s *RepositoryService) restorePendingRepository(ctx context.Context, tx *sql.Tx, create *api.RepositoryCreate) (*api.Repository, error) {
+	var repositoryID, vcsID int
+	var externalID string
+	var cleanupTs int64
+	if err := tx.QueryRowContext(ctx, `
+		SELECT id, vcs_id, external_id, cleanup_ts
+		FROM repository
+		WHERE project_id = $1 AND row_status = 'ARCHIVED' AND cleanup_ts > 0
+		ORDER BY id DESC
+		LIMIT 1
+	`, create.ProjectID).Scan(&repositoryID, &vcsID, &externalID, &cleanupTs); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, FormatError(err)
+	}
+	if vcsID != create.VCSID || externalID != create.ExternalID || cleanupTs <= time.Now().Unix() {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM repository WHERE project_id = $1 AND row_status = 'ARCHIVED' AND cleanup_ts > 0`, create.ProjectID); err != nil {
+			return nil, FormatError(err)
+		}
+		return nil, nil
+	}
+
+	accessRef, refreshRef, err := findRepositoryTokenRefs(ctx, tx, "id = $1", repositoryID)
+	if err != nil {
+		return nil, err
+	}
+	if accessRef, err = s.putSecret(accessRef, create.AccessToken); err != nil {
+		return nil, err
+	}
+	if refreshRef, err = s.putSecret(refreshRef, create.RefreshToken); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE repository
+		SET row_status = 'NORMAL',
+			cleanup_ts = 0,
+			updater_id = $1,
+			external_webhook_id = $2,
+			webhook_url_host = $3,
+			webhook_endpoint_id = $4,
+			webhook_secret_token = $5,
+			webhook_status = $6,
+			provider_user_id = $7,
+			provider_username = $8,
+			access_token = $9,
+			expires_ts = $10,
+			refresh_token = $11,
+			token_status = $12
+		WHERE id = $13
+	`,
+		create.CreatorID,
+		create.ExternalWebhookID,
+		create.WebhookURLHost,
+		create.WebhookEndpointID,
+		create.WebhookSecretToken,
+		create.WebhookStatus,
+		create.ProviderUserID,
+		create.ProviderUsername,
+		accessRef,
+		create.ExpiresTs,
+		refreshRef,
+		api.TokenValid,
+		repositoryID,
+	); err != nil {
+		return nil, FormatError(err)
+	}
+
+	list, err := findRepositoryList(ctx, tx, &api.RepositoryFind{ID: &repositoryID, IncludeSecrets: true})
+	if err != nil {
+		return nil, err
+	}
+	repository, _ := singleRepository(list)
+	if repository == nil {
+		return nil, &common.Error{Code: common.NotFound, Err: fmt.Errorf("restored repository ID not found: %d", repositoryID)}
+	}
+	if err := s.resolveRepositoryTokens(repository); err != nil {
+		return nil, err
+	}
+
+	// Updates the project workflow_type back to "VCS".
+	if err := s.syncProjectWorkflowType(ctx, tx, create.ProjectID, create.CreatorID); err != nil {
+		return nil, err
+	}
+	s.l.Info("Restored the repository pending cleanup.",
+		zap.Int("project_id", create.ProjectID),
+		zap.Int("repository_id", repositoryID),
+	)
+	return repository, nil
+}
+
+// FinalizeRepositoryCleanup deletes the repositories whose deferred cleanup is due at now, flips their projects to the UI workflow,
+// and returns the IDs of the projects.
+func (s *RepositoryService) FinalizeRepositoryCleanup(ctx context.Context, now int64) ([]int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	candidateList, err := findDueCleanupProjectIDs(ctx, tx.PTx, now)
+	if err != nil {
+		return nil, err
+	}
+	var projectIDList []int
+	for _, projectID := range candidateList {
+		// Re-check under the project lock, since the repository may be re-linked concurrently.
+		if err := lockProject(ctx, tx.PTx, projectID); err != nil {
+			return nil, err
+		}
+		finalized, err := s.finalizeRepositoryCleanup(ctx, tx.PTx, projectID, now)
+		if err != nil {
+			return nil, err
+		}
+		if finalized {
+			projectIDList = append(projectIDList, projectID)
+		}
+	}
+
+	if err := tx.PTx.Commit(); err != nil {
+		return nil, FormatError(err)
+	}
+	for _, projectID := range projectIDList {
+		s.invalidateProject(projectID)
+	}
+
+	return projectIDList, nil
+}
+
+// findDueCleanupProjectIDs returns the IDs of the projects having the repositories whose deferred cleanup is due at now.
+func findDueCleanupProjectIDs(ctx context.Context, tx *sql.Tx, now int64) ([]int, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT DISTINCT project_id
+		FROM repository
+		WHERE row_status = 'ARCHIVED' AND cleanup_ts > 0 AND cleanup_ts <= $1
+		ORDER BY project_id
+	`, now)
+	if err != nil {
+		return nil, FormatError(err)
+	}
+	defer rows.Close()
+
+	var projectIDList []int
+	for rows.Next() {
+		var projectID int
+		if err := rows.Scan(&projectID); err != nil {
+			return nil, FormatError(err)
+		}
+		projectIDList = append(projectIDList, projectID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, FormatError(err)
+	}
+	return projectIDList, nil
+}
+
+// finalizeRepositoryCleanup deletes the repositories of the project whose deferred cleanup is due at now, and flips the project
+// to the UI workflow unless another repository is linked. Returns false if there's nothing due, e.g. the repository is re-linked.
+// The caller should lock the project with lockProject beforehand.
+func (s *RepositoryService) finalizeRepositoryCleanup(ctx context.Context, tx *sql.Tx, projectID int, now int64) (bool, error) {
+	result, err := tx.ExecContext(ctx, `
+		DELETE FROM repository
+		WHERE project_id = $1 AND row_status = 'ARCHIVED' AND cleanup_ts > 0 AND cleanup_ts <= $2
+	`, projectID, now)
+	if err != nil {
+		return false, FormatError(err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, FormatError(err)
+	}
+	if count == 0 {
+		return false, nil
+	}
+
+	if err := s.syncProjectWorkflowType(ctx, tx, projectID, api.SystemBotID); err != nil {
+		return false, err
+	}
+	s.l.Info("Finalized the deferred repository cleanup.", zap.Int("project_id", projectID))
+	return true, nil
+}
+
+func archiveRepositoriesForProject(ctx context.Context, tx *sql.Tx, projectID int, deleterID int) (int, error) {
+	result, err := tx.ExecContext(ctx, `
+		UPDATE repository
+		SET row_status = 'ARCHIVED', updater_id = $1
+		WHERE project_id = $2 AND row_status = 'NORMAL'
+	`, deleterID, projectID)
+	if err != nil {
+		return 0, FormatError(err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, FormatError(err)
+	}
+	return int(count), nil
+}
+
+// ReconcileProjectWorkflow corrects the workflow type of the projects disagreeing with whether they have linked repositories,
+// which may be left by past partial failures, and reports each change. Running it again makes no change.
+func (s *RepositoryService) ReconcileProjectWorkflow(ctx context.Context) (*api.WorkflowReconcileReport, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	report, err := s.reconcileProjectWorkflow(ctx, tx.PTx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.PTx.Commit(); err != nil {
+		return nil, FormatError(err)
+	}
+
+	return report, nil
+}
+
+func (s *RepositoryService) reconcileProjectWorkflow(ctx context.Context, tx *sql.Tx) (*api.WorkflowReconcileReport, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT project.id, project.workflow_type, COUNT(repository.id)
+		FROM project
+		LEFT JOIN repository ON repository.project_id = project.id
+		GROUP BY project.id, project.workflow_type
+		ORDER BY project.id
+	`)
+	if err != nil {
+		return nil, FormatError(err)
+	}
+	defer rows.Close()
+
+	var candidateList []*api.WorkflowReconcileChange
+	for rows.Next() {
+		var projectID, count int
+		var workflowType api.ProjectWorkflowType
+		if err := rows.Scan(&projectID, &workflowType, &count); err != nil {
+			return nil, FormatError(err)
+		}
+		if change := reconcileWorkflowChange(projectID, workflowType, count); change != nil {
+			candidateList = append(candidateList, change)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, FormatError(err)
+	}
+	rows.Close()
+
+	report := &api.WorkflowReconcileReport{}
+	for _, candidate := range candidateList {
+		// Re-check under the project lock, since the repository may be linked or unlinked concurrently.
+		if err := lockProject(ctx, tx, candidate.ProjectID); err != nil {
+			return nil, err
+		}
+		count, err := countProjectRepository(ctx, tx, candidate.ProjectID)
+		if err != nil {
+			return nil, err
+		}
+		change := reconcileWorkflowChange(candidate.ProjectID, candidate.From, count)
+		if change == nil {
+			continue
+		}
+		projectPatch := api.ProjectPatch{
+			ID:           change.ProjectID,
+			UpdaterID:    api.SystemBotID,
+			WorkflowType: &change.To,
+		}
+		if _, err := s.projectService.PatchProjectTx(ctx, tx, &projectPatch); err != nil {
+			return nil, err
+		}
+		s.l.Info("Reconciled project workflow type.",
+			zap.Int("project_id", change.ProjectID),
+			zap.Int("repository_count", change.RepositoryCount),
+			zap.String("from", string(change.From)),
+			zap.String("to", string(change.To)),
+		)
+		report.ChangeList = append(report.ChangeList, change)
+	}
+	return report, nil
+}
+
+// reconcileWorkflowChange returns the change correcting the workflow type of the project with repositoryCount linked repositories.
+// Returns nil if the workflow type is consistent.
+func reconcileWorkflowChange(projectID int, workflowType api.ProjectWorkflowType, repositoryCount int) *api.WorkflowReconcileChange {
+	// The project pending cleanup is flipped to the UI workflow by FinalizeRepositoryCleanup when the grace window ends.
+	if workflowType == api.VCSPendingCleanupWorkflow && repositoryCount == 0 {
+		return nil
+	}
+	want := getProjectWorkflowType(repositoryCount)
+	if workflowType == want {
+		return nil
+	}
+	return &api.WorkflowReconcileChange{
+		ProjectID:       projectID,
+		RepositoryCount: repositoryCount,
+		From:            workflowType,
+		To:              want,
+	}
+}
+
+// lockProject locks the project row until the transaction ends, so that concurrent repository linkage changes
+// of the same project are serialized.
+func lockProject(ctx context.Context, tx *sql.Tx, projectID int) error {
+	if _, err := tx.ExecContext(ctx, `SELECT id FROM project WHERE id = $1 FOR UPDATE`, projectID); err != nil {
 		return FormatError(err)
 	}
 	return nil
 }
+
+// syncProjectWorkflowType updates the project workflow_type according to the repositories linked to the project
+// within the transaction. The caller should lock the project with lockProject beforehand.
+func (s *RepositoryService) syncProjectWorkflowType(ctx context.Context, tx *sql.Tx, projectID int, updaterID int) error {
+	count, err := countProjectRepository(ctx, tx, projectID)
+	if err != nil {
+		return err
+	}
+
+	workflowType := getProjectWorkflowType(count)
+	projectPatch := api.ProjectPatch{
+		ID:           projectID,
+		UpdaterID:    updaterID,
+		WorkflowType: &workflowType,
+	}
+	if _, err := s.projectService.PatchProjectTx(ctx, tx, &projectPatch); err != nil {
+		return err
+	}
+	return nil
+}
+
+func countProjectRepository(ctx context.Context, tx *sql.Tx, projectID int) (int, error) {
+	row, err := tx.QueryContext(ctx, `SELECT COUNT(*) FROM repository WHERE project_id = $1 AND row_status = 'NORMAL'`, projectID)
+	if err != nil {
+		return 0, FormatError(err)
+	}
+	defer row.Close()
+
+	count := 0
+	if row.Next() {
+		if err := row.Scan(&count); err != nil {
+			return 0, FormatError(err)
+		}
+	}
+	if err := row.Err(); err != nil {
+		return 0, FormatError(err)
+	}
+	return count, nil
+}
+
+// getProjectWorkflowType returns the project workflow type given the number of repositories linked to the project.
+func getProjectWorkflowType(repositoryCount int) api.ProjectWorkflowType {
+	if repositoryCount > 0 {
+		return api.VCSWorkflow
+	}
+	return api.UIWorkflow
+}
+
+const (
+	// describeSampleDatabaseLimit is the maximum number of the sample databases DescribeRepository shows the example paths for.
+	describeSampleDatabaseLimit = 5
+	// The example values of the file path template tokens other than the environment and database name.
+	describeExampleVersion     = "202204150900"
+	describeExampleDescription = "add_column"
+)
+
+// sampleDatabase is a database of the project DescribeRepository shows the example paths for.
+type sampleDatabase struct {
+	environmentName string
+	databaseName    string
+}
+
+// DescribeRepository returns the effective configuration of the repository with the defaults resolved, along with the example
+// paths for the sample databases of the project. It's read-only.
+func (s *RepositoryService) DescribeRepository(ctx context.Context, repositoryID int) (*api.RepositoryDescription, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	list, err := findRepositoryList(ctx, tx.PTx, &api.RepositoryFind{ID: &repositoryID})
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, &common.Error{Code: common.NotFound, Err: fmt.Errorf("repository ID not found: %d", repositoryID)}
+	}
+	repository := list[0]
+
+	var tenantMode api.ProjectTenantMode
+	if err := tx.PTx.QueryRowContext(ctx, `SELECT tenant_mode FROM project WHERE id = $1`, repository.ProjectID).Scan(&tenantMode); err != nil {
+		return nil, FormatError(err)
+	}
+
+	rows, err := tx.PTx.QueryContext(ctx, `
+		SELECT DISTINCT environment.name, environment."order", db.name
+		FROM db
+		JOIN instance ON db.instance_id = instance.id
+		JOIN environment ON instance.environment_id = environment.id
+		WHERE db.project_id = $1
+		ORDER BY environment."order", db.name
+		LIMIT $2
+	`, repository.ProjectID, describeSampleDatabaseLimit)
+	if err != nil {
+		return nil, FormatError(err)
+	}
+	defer rows.Close()
+
+	var sampleList []*sampleDatabase
+	for rows.Next() {
+		var sample sampleDatabase
+		var order int
+		if err := rows.Scan(&sample.environmentName, &order, &sample.databaseName); err != nil {
+			return nil, FormatError(err)
+		}
+		sampleList = append(sampleList, &sample)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, FormatError(err)
+	}
+
+	return describeRepository(repository, tenantMode, sampleList)
+}
+
+// describeRepository resolves the effective configuration of the repository and expands the file path and schema path templates
+// for the sample databases.
+func describeRepository(repository *api.Repository, tenantMode api.ProjectTenantMode, sampleList []*sampleDatabase) (*api.RepositoryDescription, error) {
+	description := &api.RepositoryDescription{
+		RepositoryID:             repository.ID,
+		FullPath:                 repository.FullPath,
+		TenantMode:               tenantMode,
+		BranchFilter:             repository.BranchFilter,
+		TargetBranchFilter:       repository.TargetBranchFilter,
+		BaseDirectory:            repository.BaseDirectory,
+		FilePathTemplate:         repository.FilePathTemplate,
+		SchemaPathTemplate:       repository.SchemaPathTemplate,
+		SchemaSourceType:         repository.SchemaSourceType,
+		IgnorePathPatterns:       repository.IgnorePathPatterns,
+		CommitStatusContext:      repository.CommitStatusContext,
+		BranchEnvironmentMapping: repository.BranchEnvironmentMapping,
+		ExampleList:              []*api.RepositoryPathExample{},
+	}
+	if description.TargetBranchFilter == "" {
+		description.TargetBranchFilter = "*"
+	}
+	if description.SchemaSourceType == "" {
+		description.SchemaSourceType = api.SchemaSourceSingleFile
+	}
+	if description.CommitStatusContext == "" {
+		description.CommitStatusContext = vcs.DefaultCommitStatusContext
+	}
+	switch {
+	case repository.CommitAuthorName == "":
+		description.CommitAuthor = "the user linking the project to the repository"
+	case repository.CommitAuthorEmail == "":
+		description.CommitAuthor = repository.CommitAuthorName
+	default:
+		description.CommitAuthor = fmt.Sprintf("%s <%s>", repository.CommitAuthorName, repository.CommitAuthorEmail)
+	}
+
+	for _, sample := range sampleList {
+		tokens := map[string]string{
+			api.EnvironemntToken: sample.environmentName,
+			api.DBNameToken:      sample.databaseName,
+			"{{VERSION}}":        describeExampleVersion,
+			"{{TYPE}}":           db.Migrate.TemplateToken(),
+			"{{DESCRIPTION}}":    describeExampleDescription,
+		}
+		migrationPath, err := api.FormatTemplate(repository.FilePathTemplate, tokens)
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand file path template %q: %w", repository.FilePathTemplate, err)
+		}
+		example := &api.RepositoryPathExample{
+			EnvironmentName: sample.environmentName,
+			DatabaseName:    sample.databaseName,
+			MigrationPath:   path.Join(repository.BaseDirectory, migrationPath),
+		}
+		if repository.SchemaPathTemplate != "" {
+			schemaPath, err := api.FormatTemplate(repository.SchemaPathTemplate, tokens)
+			if err != nil {
+				return nil, fmt.Errorf("failed to expand schema path template %q: %w", repository.SchemaPathTemplate, err)
+			}
+			example.SchemaPath = path.Join(repository.BaseDirectory, schemaPath)
+		}
+		for _, pattern := range repository.IgnorePathPatterns {
+			if matched, err := path.Match(pattern, example.MigrationPath); err == nil && matched {
+				example.Ignored = true
+				break
+			}
+		}
+		description.ExampleList = append(description.ExampleList, example)
+	}
+	return description, nil
+}
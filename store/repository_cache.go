@@ -0,0 +1,120 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+)
+
+// RepositoryCache caches the repositories looked up by the webhook endpoint ID, so that the webhook events of the
+// high-volume repositories don't hit the database every time.
+//
+// A repository loaded from the database is only cached if no invalidation has happened since the load started,
+// so that the repository loaded before a concurrent patch can't be cached after the patch invalidated it.
+type RepositoryCache interface {
+	// Get returns the repository cached for the webhook endpoint ID.
+	Get(webhookEndpointID string) (*api.Repository, bool)
+	// Generation returns the current generation, which is advanced by every invalidation.
+	Generation() uint64
+	// Set caches the repository loaded from the database since the generation.
+	// It's a no-op if any invalidation has happened since the generation.
+	Set(repository *api.Repository, generation uint64)
+	// InvalidateRepository evicts the repository by its ID.
+	InvalidateRepository(repositoryID int)
+	// InvalidateProject evicts the repositories of the project.
+	InvalidateProject(projectID int)
+}
+
+var (
+	_ RepositoryCache = (*RepositoryTTLCache)(nil)
+)
+
+type repositoryCacheEntry struct {
+	repository *api.Repository
+	expiresAt  time.Time
+}
+
+// RepositoryTTLCache is the in-memory RepositoryCache whose entries expire after the TTL. The invalidations only evict
+// the entries of this process, so the TTL bounds how long the other replicas may serve a stale repository.
+type RepositoryTTLCache struct {
+	ttl time.Duration
+	// now is overridden by tests.
+	now func() time.Time
+
+	mu         sync.Mutex
+	generation uint64
+	// entryMap is keyed by the webhook endpoint ID.
+	entryMap map[string]*repositoryCacheEntry
+}
+
+// NewRepositoryTTLCache returns a new RepositoryTTLCache whose entries expire after ttl.
+func NewRepositoryTTLCache(ttl time.Duration) *RepositoryTTLCache {
+	return &RepositoryTTLCache{
+		ttl:      ttl,
+		now:      time.Now,
+		entryMap: make(map[string]*repositoryCacheEntry),
+	}
+}
+
+// Get returns a copy of the cached repository, since the callers populate the relationships of the returned repository.
+func (c *RepositoryTTLCache) Get(webhookEndpointID string) (*api.Repository, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entryMap[webhookEndpointID]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(entry.expiresAt) {
+		delete(c.entryMap, webhookEndpointID)
+		return nil, false
+	}
+	repository := *entry.repository
+	return &repository, true
+}
+
+// Generation returns the current generation.
+func (c *RepositoryTTLCache) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// Set caches a copy of the repository unless any invalidation has happened since the generation.
+func (c *RepositoryTTLCache) Set(repository *api.Repository, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	copied := *repository
+	c.entryMap[repository.WebhookEndpointID] = &repositoryCacheEntry{
+		repository: &copied,
+		expiresAt:  c.now().Add(c.ttl),
+	}
+}
+
+// InvalidateRepository evicts the repository by its ID.
+func (c *RepositoryTTLCache) InvalidateRepository(repositoryID int) {
+	c.invalidate(func(repository *api.Repository) bool {
+		return repository.ID == repositoryID
+	})
+}
+
+// InvalidateProject evicts the repositories of the project.
+func (c *RepositoryTTLCache) InvalidateProject(projectID int) {
+	c.invalidate(func(repository *api.Repository) bool {
+		return repository.ProjectID == projectID
+	})
+}
+
+func (c *RepositoryTTLCache) invalidate(match func(repository *api.Repository) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for webhookEndpointID, entry := range c.entryMap {
+		if match(entry.repository) {
+			delete(c.entryMap, webhookEndpointID)
+		}
+	}
+}
@@ -0,0 +1,1989 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+	"github.com/bytebase/bytebase/plugin/vcs"
+	"github.com/mattn/go-sqlite3"
+	"go.uber.org/zap"
+)
+
+// sqlWorkflowProjectService stores the workflow type of the projects patched in the project table within the transaction,
+// so the workflow type is rolled back along with the transaction.
+type sqlWorkflowProjectService struct {
+	api.ProjectService
+}
+
+func (*sqlWorkflowProjectService) PatchProjectTx(ctx context.Context, tx *sql.Tx, patch *api.ProjectPatch) (*api.Project, error) {
+	if patch.WorkflowType != nil {
+		if _, err := tx.ExecContext(ctx, `UPDATE project SET workflow_type = $1 WHERE id = $2`, *patch.WorkflowType, patch.ID); err != nil {
+			return nil, err
+		}
+	}
+	return &api.Project{ID: patch.ID}, nil
+}
+
+func TestSyncProjectWorkflowType(t *testing.T) {
+	ctx := context.Background()
+	db := openRepositoryTestDB(ctx, t)
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE project (
+			id INTEGER PRIMARY KEY,
+			workflow_type TEXT
+		);
+		INSERT INTO project (id, workflow_type) VALUES (101, 'UI');
+	`); err != nil {
+		t.Fatalf("failed to create the project table, error %v", err)
+	}
+	s := &RepositoryService{l: zap.NewNop(), db: &DB{db: db, Now: time.Now}, projectService: &sqlWorkflowProjectService{}}
+	getWorkflowType := func(q interface {
+		QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	}) api.ProjectWorkflowType {
+		var workflowType api.ProjectWorkflowType
+		if err := q.QueryRowContext(ctx, `SELECT workflow_type FROM project WHERE id = 101`).Scan(&workflowType); err != nil {
+			t.Fatalf("failed to get the workflow type, error %v", err)
+		}
+		return workflowType
+	}
+	// apply runs the statement of linking or unlinking the repository followed by syncing the workflow type, as
+	// createRepository and deleteRepository do, and commits or rolls back the transaction.
+	apply := func(statement string, commit bool) api.ProjectWorkflowType {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("BeginTx() got error %v, want OK.", err)
+		}
+		defer tx.Rollback()
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			t.Fatalf("failed to execute %q, error %v", statement, err)
+		}
+		if err := s.syncProjectWorkflowType(ctx, tx, 101, 1); err != nil {
+			t.Fatalf("syncProjectWorkflowType() got error %v, want OK.", err)
+		}
+		inTx := getWorkflowType(tx)
+		if commit {
+			if err := tx.Commit(); err != nil {
+				t.Fatalf("Commit() got error %v, want OK.", err)
+			}
+		} else if err := tx.Rollback(); err != nil {
+			t.Fatalf("Rollback() got error %v, want OK.", err)
+		}
+		return inTx
+	}
+	const (
+		linkFirst   = `INSERT INTO repository (id, vcs_id, project_id) VALUES (1, 1, 101)`
+		linkSecond  = `INSERT INTO repository (id, vcs_id, project_id) VALUES (2, 1, 101)`
+		unlinkFirst = `DELETE FROM repository WHERE id = 1`
+		unlinkAll   = `DELETE FROM repository WHERE project_id = 101`
+	)
+
+	// Linking the repository within the rolled back transaction leaves the workflow type unchanged.
+	if got := apply(linkFirst, false); got != api.VCSWorkflow {
+		t.Errorf("link in rolled back transaction: got workflow type %s in the transaction, want %s.", got, api.VCSWorkflow)
+	}
+	if got := getWorkflowType(db); got != api.UIWorkflow {
+		t.Errorf("link in rolled back transaction: got workflow type %s, want %s unchanged.", got, api.UIWorkflow)
+	}
+
+	tests := []struct {
+		name      string
+		statement string
+		want      api.ProjectWorkflowType
+	}{
+		{
+			name:      "link the first repository",
+			statement: linkFirst,
+			want:      api.VCSWorkflow,
+		},
+		{
+			name:      "link a second repository",
+			statement: linkSecond,
+			want:      api.VCSWorkflow,
+		},
+		{
+			name:      "unlink one of two repositories",
+			statement: unlinkFirst,
+			want:      api.VCSWorkflow,
+		},
+		{
+			name:      "unlink the last repository",
+			statement: unlinkAll,
+			want:      api.UIWorkflow,
+		},
+	}
+	for _, test := range tests {
+		apply(test.statement, true)
+		if got := getWorkflowType(db); got != test.want {
+			t.Errorf("%q: got workflow type %s, want %s.", test.name, got, test.want)
+		}
+	}
+
+	// Unlinking the repository within the rolled back transaction leaves the workflow type unchanged.
+	apply(linkFirst, true)
+	if got := apply(unlinkAll, false); got != api.UIWorkflow {
+		t.Errorf("unlink in rolled back transaction: got workflow type %s in the transaction, want %s.", got, api.UIWorkflow)
+	}
+	if got := getWorkflowType(db); got != api.VCSWorkflow {
+		t.Errorf("unlink in rolled back transaction: got workflow type %s, want %s unchanged.", got, api.VCSWorkflow)
+	}
+}
+
+func TestReconcileWorkflowChange(t *testing.T) {
+	tests := []struct {
+		name            string
+		workflowType    api.ProjectWorkflowType
+		repositoryCount int
+		want            *api.WorkflowReconcileChange
+	}{
+		{
+			name:            "UI workflow with a linked repository",
+			workflowType:    api.UIWorkflow,
+			repositoryCount: 1,
+			want:            &api.WorkflowReconcileChange{ProjectID: 101, RepositoryCount: 1, From: api.UIWorkflow, To: api.VCSWorkflow},
+		},
+		{
+			name:            "VCS workflow without linked repository",
+			workflowType:    api.VCSWorkflow,
+			repositoryCount: 0,
+			want:            &api.WorkflowReconcileChange{ProjectID: 101, RepositoryCount: 0, From: api.VCSWorkflow, To: api.UIWorkflow},
+		},
+		{
+			name:            "consistent VCS workflow",
+			workflowType:    api.VCSWorkflow,
+			repositoryCount: 1,
+		},
+		{
+			name:            "consistent UI workflow",
+			workflowType:    api.UIWorkflow,
+			repositoryCount: 0,
+		},
+		{
+			name:            "VCS pending cleanup workflow without linked repository",
+			workflowType:    api.VCSPendingCleanupWorkflow,
+			repositoryCount: 0,
+		},
+		{
+			name:            "VCS pending cleanup workflow with a linked repository",
+			workflowType:    api.VCSPendingCleanupWorkflow,
+			repositoryCount: 1,
+			want:            &api.WorkflowReconcileChange{ProjectID: 101, RepositoryCount: 1, From: api.VCSPendingCleanupWorkflow, To: api.VCSWorkflow},
+		},
+	}
+
+	for _, test := range tests {
+		got := reconcileWorkflowChange(101, test.workflowType, test.repositoryCount)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: reconcileWorkflowChange() got %+v, want %+v.", test.name, got, test.want)
+			continue
+		}
+		// Reconciling again after applying the change makes no change.
+		if got != nil {
+			if again := reconcileWorkflowChange(101, got.To, test.repositoryCount); again != nil {
+				t.Errorf("%q: reconcileWorkflowChange() got %+v after applying the change, want no change.", test.name, again)
+			}
+		}
+	}
+}
+
+func TestFindRepositoryListWithoutWebhook(t *testing.T) {
+	ctx := context.Background()
+	db := openRepositoryTestDB(ctx, t)
+	defer db.Close()
+	// The empty webhook ID means the webhook isn't created, e.g. the repository linked without the webhook permission.
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO repository (id, vcs_id, project_id, external_webhook_id) VALUES
+			(1, 1, 101, '11'),
+			(2, 1, 101, ''),
+			(3, 1, 101, ''),
+			(4, 1, 102, ''),
+			(5, 1, 102, '15');
+	`); err != nil {
+		t.Fatalf("failed to insert the repositories, error %v", err)
+	}
+
+	projectID := 101
+	tests := []struct {
+		name string
+		find *api.RepositoryFind
+		want []int
+	}{
+		{
+			name: "without webhook excludes the repositories with a populated webhook ID",
+			find: &api.RepositoryFind{WithoutWebhook: true},
+			want: []int{2, 3, 4},
+		},
+		{
+			name: "combined with other filters",
+			find: &api.RepositoryFind{ProjectID: &projectID, WithoutWebhook: true},
+			want: []int{2, 3},
+		},
+		{
+			name: "default find includes all repositories",
+			find: &api.RepositoryFind{ProjectID: &projectID},
+			want: []int{1, 2, 3},
+		},
+	}
+
+	for _, test := range tests {
+		if got := findRepositoryTestIDList(ctx, t, db, test.find); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: findRepositoryList() got %v, want %v.", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFindRepositoryListLabelSelector(t *testing.T) {
+	ctx := context.Background()
+	db := openRepositoryTestDB(ctx, t)
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO repository (id, vcs_id, project_id, labels) VALUES
+			(1, 1, 101, '{"team": "payments", "tier": "critical", "region": "us"}'),
+			(2, 1, 101, '{"team": "payments"}'),
+			(3, 1, 101, '{"team": "search", "tier": "critical"}'),
+			(4, 1, 101, '{}'),
+			(5, 1, 102, '{"team": "payments", "tier": "critical"}');
+	`); err != nil {
+		t.Fatalf("failed to insert the repositories, error %v", err)
+	}
+
+	projectID := 101
+	tests := []struct {
+		name string
+		find *api.RepositoryFind
+		want []int
+	}{
+		{
+			name: "labeled with a superset",
+			find: &api.RepositoryFind{ProjectID: &projectID, LabelSelector: map[string]string{"team": "payments", "tier": "critical"}},
+			want: []int{1},
+		},
+		{
+			name: "single label",
+			find: &api.RepositoryFind{ProjectID: &projectID, LabelSelector: map[string]string{"team": "payments"}},
+			want: []int{1, 2},
+		},
+		{
+			name: "across projects",
+			find: &api.RepositoryFind{LabelSelector: map[string]string{"tier": "critical"}},
+			want: []int{1, 3, 5},
+		},
+		{
+			name: "no repository labeled",
+			find: &api.RepositoryFind{LabelSelector: map[string]string{"team": "growth"}},
+			want: nil,
+		},
+		{
+			name: "empty selector doesn't filter by the labels",
+			find: &api.RepositoryFind{ProjectID: &projectID, LabelSelector: map[string]string{}},
+			want: []int{1, 2, 3, 4},
+		},
+	}
+
+	for _, test := range tests {
+		if got := findRepositoryTestIDList(ctx, t, db, test.find); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: findRepositoryList() got %v, want %v.", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFindRepositoryWhereIDList(t *testing.T) {
+	idList := []int{101, 102, 103}
+	where, args, err := findRepositoryWhere(&api.RepositoryFind{IDList: idList})
+	if err != nil {
+		t.Fatalf("findRepositoryWhere() got error %v, want OK.", err)
+	}
+	if want := "id = ANY($1)"; len(where) != 2 || where[1] != want {
+		t.Errorf("findRepositoryWhere() got where %v, want %q.", where, want)
+	}
+	if len(args) != 1 {
+		t.Fatalf("findRepositoryWhere() got %d args, want 1.", len(args))
+	}
+	// The IDs are passed as a single Postgres array, so the batch takes a single round trip.
+	value, err := args[0].(driver.Valuer).Value()
+	if err != nil {
+		t.Fatalf("failed to get the array value, error %v", err)
+	}
+	if want := "{101,102,103}"; value != want {
+		t.Errorf("findRepositoryWhere() got array %v, want %s.", value, want)
+	}
+
+	id := 101
+	if _, _, err := findRepositoryWhere(&api.RepositoryFind{ID: &id, IDList: idList}); common.ErrorCode(err) != common.Invalid {
+		t.Errorf("findRepositoryWhere() with both ID and IDList got error %v, want code %v.", err, common.Invalid)
+	}
+}
+
+func TestBuildSetClause(t *testing.T) {
+	updaterID := 101
+	name := "blog"
+	emptyName := ""
+	var nilName *string
+
+	tests := []struct {
+		name       string
+		fields     []fieldSpec
+		wantClause string
+		wantArgs   []interface{}
+	}{
+		{
+			name:       "no field",
+			fields:     nil,
+			wantClause: "",
+			wantArgs:   nil,
+		},
+		{
+			name: "skip nil fields",
+			fields: []fieldSpec{
+				{"updater_id", &updaterID},
+				{"name", nilName},
+				{"web_url", nil},
+				{"base_directory", &name},
+			},
+			wantClause: "updater_id = $1, base_directory = $2",
+			wantArgs:   []interface{}{updaterID, name},
+		},
+		{
+			name: "set empty value",
+			fields: []fieldSpec{
+				{"name", &emptyName},
+				{"expires_ts", &sql.NullInt64{}},
+			},
+			wantClause: "name = $1, expires_ts = $2",
+			wantArgs:   []interface{}{"", sql.NullInt64{}},
+		},
+	}
+
+	for _, test := range tests {
+		clause, args := buildSetClause(test.fields)
+		if clause != test.wantClause {
+			t.Errorf("%q: buildSetClause() got clause %q, want %q.", test.name, clause, test.wantClause)
+		}
+		if !reflect.DeepEqual(args, test.wantArgs) {
+			t.Errorf("%q: buildSetClause() got args %v, want %v.", test.name, args, test.wantArgs)
+		}
+	}
+}
+
+func TestUpsertRepositoryQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		create     *api.RepositoryCreate
+		wantSet    []string
+		wantNotSet []string
+	}{
+		{
+			name: "update the mutable fields and the provided tokens",
+			create: &api.RepositoryCreate{
+				VCSID:              1,
+				ProjectID:          101,
+				ExternalID:         "42",
+				BranchFilter:       "main",
+				AccessToken:        "access",
+				RefreshToken:       "refresh",
+				ExternalWebhookID:  "7",
+				WebhookEndpointID:  "endpoint",
+				WebhookSecretToken: "secret",
+			},
+			wantSet: []string{
+				"branch_filter = EXCLUDED.branch_filter",
+				"access_token = EXCLUDED.access_token",
+				"refresh_token = EXCLUDED.refresh_token",
+				"token_status = EXCLUDED.token_status",
+				"external_webhook_id = EXCLUDED.external_webhook_id",
+			},
+		},
+		{
+			name: "keep the existing tokens if not provided",
+			create: &api.RepositoryCreate{
+				VCSID:        1,
+				ProjectID:    101,
+				ExternalID:   "42",
+				BranchFilter: "main",
+			},
+			wantSet: []string{
+				"branch_filter = EXCLUDED.branch_filter",
+				"schema_ref = EXCLUDED.schema_ref",
+				"schema_snapshot_on_apply = EXCLUDED.schema_snapshot_on_apply",
+				"provider_status = EXCLUDED.provider_status",
+				"sync_status = EXCLUDED.sync_status",
+				"sync_failure_count = EXCLUDED.sync_failure_count",
+			},
+			wantNotSet: []string{
+				"access_token = EXCLUDED.access_token",
+				"expires_ts = EXCLUDED.expires_ts",
+				"refresh_token = EXCLUDED.refresh_token",
+				"token_status = EXCLUDED.token_status",
+				"external_webhook_id = EXCLUDED.external_webhook_id",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		query, args := upsertRepositoryQuery(test.create)
+		// The insert path inserts every field of the create.
+		if len(args) != 39 {
+			t.Errorf("%q: upsertRepositoryQuery() got %d args, want 39.", test.name, len(args))
+		}
+		if !strings.Contains(query, "VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33, $34, $35, $36, $37, $38, $39)") {
+			t.Errorf("%q: upsertRepositoryQuery() got query %q, want inserting 39 values.", test.name, query)
+		}
+		// The update path only updates the repository of the same project.
+		if !strings.Contains(query, "ON CONFLICT (vcs_id, external_id) WHERE row_status = 'NORMAL' DO UPDATE") || !strings.Contains(query, "WHERE repository.project_id = EXCLUDED.project_id") {
+			t.Errorf("%q: upsertRepositoryQuery() got query %q, want updating the existing repository of the same project.", test.name, query)
+		}
+		if !strings.Contains(query, "(xmax = 0)") {
+			t.Errorf("%q: upsertRepositoryQuery() got query %q, want returning whether the row is inserted.", test.name, query)
+		}
+		for _, set := range test.wantSet {
+			if !strings.Contains(query, set) {
+				t.Errorf("%q: upsertRepositoryQuery() got query %q, want containing %q.", test.name, query, set)
+			}
+		}
+		for _, set := range test.wantNotSet {
+			if strings.Contains(query, set) {
+				t.Errorf("%q: upsertRepositoryQuery() got query %q, want not containing %q.", test.name, query, set)
+			}
+		}
+		// Immutable fields are never updated.
+		for _, set := range []string{"vcs_id = EXCLUDED", "external_id = EXCLUDED", "project_id = EXCLUDED.project_id,", "creator_id = EXCLUDED"} {
+			if strings.Contains(query, set) {
+				t.Errorf("%q: upsertRepositoryQuery() got query %q, want not updating %q.", test.name, query, set)
+			}
+		}
+	}
+}
+
+func TestPrepareWebhookSecretToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		wantCode common.Code
+	}{
+		{
+			name:     "short token",
+			token:    "secret",
+			wantCode: common.Invalid,
+		},
+		{
+			name:     "repetitive token",
+			token:    strings.Repeat("ab", 20),
+			wantCode: common.Invalid,
+		},
+		{
+			name:     "strong token",
+			token:    "q3Zt8LmW2xRv9KpN4hYc",
+			wantCode: common.Ok,
+		},
+	}
+
+	for _, test := range tests {
+		create := &api.RepositoryCreate{WebhookSecretToken: test.token}
+		err := prepareWebhookSecretToken(create)
+		if code := common.ErrorCode(err); code != test.wantCode {
+			t.Errorf("%q: prepareWebhookSecretToken() got error %v, want code %v.", test.name, err, test.wantCode)
+		}
+		if create.WebhookSecretToken != test.token {
+			t.Errorf("%q: prepareWebhookSecretToken() changed the provided token to %q, want %q.", test.name, create.WebhookSecretToken, test.token)
+		}
+	}
+
+	// The generated token is long and random enough to pass the validation.
+	seen := make(map[string]bool)
+	for i := 0; i < 10; i++ {
+		create := &api.RepositoryCreate{}
+		if err := prepareWebhookSecretToken(create); err != nil {
+			t.Fatalf("prepareWebhookSecretToken() got error %v, want OK.", err)
+		}
+		if len(create.WebhookSecretToken) != api.WebhookSecretTokenLength {
+			t.Errorf("prepareWebhookSecretToken() generated token with length %d, want %d.", len(create.WebhookSecretToken), api.WebhookSecretTokenLength)
+		}
+		if err := api.ValidateRepositoryWebhookSecretToken(create.WebhookSecretToken); err != nil {
+			t.Errorf("prepareWebhookSecretToken() generated weak token %q, error %v.", create.WebhookSecretToken, err)
+		}
+		if seen[create.WebhookSecretToken] {
+			t.Errorf("prepareWebhookSecretToken() generated duplicate token %q.", create.WebhookSecretToken)
+		}
+		seen[create.WebhookSecretToken] = true
+	}
+}
+
+func TestSingleRepository(t *testing.T) {
+	tests := []struct {
+		name        string
+		list        []*api.Repository
+		wantID      int
+		wantMatched int
+	}{
+		{
+			name:        "zero",
+			list:        nil,
+			wantMatched: 0,
+		},
+		{
+			name:        "one",
+			list:        []*api.Repository{{ID: 101}},
+			wantID:      101,
+			wantMatched: 1,
+		},
+		{
+			name:        "many",
+			list:        []*api.Repository{{ID: 101}, {ID: 102}, {ID: 103}},
+			wantMatched: 3,
+		},
+	}
+
+	for _, test := range tests {
+		repository, matched := singleRepository(test.list)
+		if matched != test.wantMatched {
+			t.Errorf("%q: singleRepository() got matched %d, want %d.", test.name, matched, test.wantMatched)
+		}
+		gotID := 0
+		if repository != nil {
+			gotID = repository.ID
+		}
+		if gotID != test.wantID {
+			t.Errorf("%q: singleRepository() got repository ID %d, want %d.", test.name, gotID, test.wantID)
+		}
+	}
+}
+
+func TestClaimRepositorySync(t *testing.T) {
+	ctx := context.Background()
+	// The claim runs the same UPDATE against a SQLite repository table, with a fixed clock to control the lease expiry.
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_txlock=immediate&_busy_timeout=5000", filepath.Join(t.TempDir(), "lease.db")))
+	if err != nil {
+		t.Fatalf("sql.Open() got error %v, want OK.", err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE repository (id INTEGER PRIMARY KEY, lease_owner TEXT NULL, lease_expires_ts BIGINT NULL);
+		INSERT INTO repository (id) VALUES (101);
+	`); err != nil {
+		t.Fatalf("failed to create the repository table, error %v", err)
+	}
+
+	const leaseTTL = time.Minute
+	now := int64(1650000000)
+	claim := func(owner string) bool {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Errorf("BeginTx() got error %v, want OK.", err)
+			return false
+		}
+		defer tx.Rollback()
+		acquired, err := claimRepositorySync(ctx, tx, fmt.Sprintf("%d", now), 101, leaseTTL, owner)
+		if err != nil {
+			t.Errorf("claimRepositorySync() got error %v, want OK.", err)
+			return false
+		}
+		if err := tx.Commit(); err != nil {
+			t.Errorf("Commit() got error %v, want OK.", err)
+			return false
+		}
+		return acquired
+	}
+	release := func(owner string) {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("BeginTx() got error %v, want OK.", err)
+		}
+		defer tx.Rollback()
+		if err := releaseRepositorySync(ctx, tx, 101, owner); err != nil {
+			t.Fatalf("releaseRepositorySync() got error %v, want OK.", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit() got error %v, want OK.", err)
+		}
+	}
+
+	// Two replicas contend for the same repository at the same time.
+	ownerList := []string{"replica-a", "replica-b"}
+	acquiredList := make([]bool, len(ownerList))
+	var wg sync.WaitGroup
+	for i, owner := range ownerList {
+		wg.Add(1)
+		go func(i int, owner string) {
+			defer wg.Done()
+			acquiredList[i] = claim(owner)
+		}(i, owner)
+	}
+	wg.Wait()
+	if acquiredList[0] == acquiredList[1] {
+		t.Fatalf("got acquired %v, want exactly one of %v to acquire the lease.", acquiredList, ownerList)
+	}
+	winner, loser := ownerList[0], ownerList[1]
+	if acquiredList[1] {
+		winner, loser = loser, winner
+	}
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		release string
+		owner   string
+		want    bool
+	}{
+		{
+			name:  "held by another owner",
+			owner: loser,
+			want:  false,
+		},
+		{
+			name:    "renewed by the owner",
+			elapsed: leaseTTL - time.Second,
+			owner:   winner,
+			want:    true,
+		},
+		{
+			name:    "not expired after the renewal",
+			elapsed: time.Second,
+			owner:   loser,
+			want:    false,
+		},
+		{
+			name:    "taken over after expiry",
+			elapsed: leaseTTL + time.Second,
+			owner:   loser,
+			want:    true,
+		},
+		{
+			name:    "released by the previous owner is a no-op",
+			release: winner,
+			owner:   winner,
+			want:    false,
+		},
+		{
+			name:    "released by the owner",
+			release: loser,
+			owner:   winner,
+			want:    true,
+		},
+	}
+
+	for _, test := range tests {
+		now += int64(test.elapsed / time.Second)
+		if test.release != "" {
+			release(test.release)
+		}
+		if got := claim(test.owner); got != test.want {
+			t.Errorf("%q: claimRepositorySync() for %s got acquired %v, want %v.", test.name, test.owner, got, test.want)
+		}
+	}
+}
+
+// findRepositoryTestIDList returns the sorted IDs of the repositories found by findRepositoryList.
+func findRepositoryTestIDList(ctx context.Context, t *testing.T, db *sql.DB, find *api.RepositoryFind) []int {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx() got error %v, want OK.", err)
+	}
+	defer tx.Rollback()
+	list, err := findRepositoryList(ctx, tx, find)
+	if err != nil {
+		t.Fatalf("findRepositoryList() got error %v, want OK.", err)
+	}
+	var idList []int
+	for _, repository := range list {
+		idList = append(idList, repository.ID)
+	}
+	sort.Ints(idList)
+	return idList
+}
+
+func init() {
+	// SQLite has no JSONB, so jsonb_contains matches the labels the same as Postgres does for the JSON objects of strings.
+	sql.Register("sqlite3_repository", &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("jsonb_contains", func(labels string, selector string) (bool, error) {
+				labelMap, selectorMap := map[string]string{}, map[string]string{}
+				if err := json.Unmarshal([]byte(labels), &labelMap); err != nil {
+					return false, err
+				}
+				if err := json.Unmarshal([]byte(selector), &selectorMap); err != nil {
+					return false, err
+				}
+				for key, value := range selectorMap {
+					if v, ok := labelMap[key]; !ok || v != value {
+						return false, nil
+					}
+				}
+				return true, nil
+			}, true /* pure */)
+		},
+	})
+}
+
+// openRepositoryTestDB opens a SQLite database with the repository table having the columns scanned by findRepositoryList.
+func openRepositoryTestDB(ctx context.Context, t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3_repository", fmt.Sprintf("file:%s", filepath.Join(t.TempDir(), "repository.db")))
+	if err != nil {
+		t.Fatalf("sql.Open() got error %v, want OK.", err)
+	}
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE repository (
+			id INTEGER PRIMARY KEY,
+			row_status TEXT DEFAULT 'NORMAL',
+			creator_id INTEGER DEFAULT 1,
+			created_ts BIGINT DEFAULT 0,
+			updater_id INTEGER DEFAULT 1,
+			updated_ts BIGINT DEFAULT 0,
+			vcs_id INTEGER,
+			project_id INTEGER,
+			deployment_config_id INTEGER NULL,
+			default_assignee_id INTEGER NULL,
+			name TEXT DEFAULT '',
+			full_path TEXT DEFAULT '',
+			web_url TEXT DEFAULT '',
+			branch_filter TEXT DEFAULT '',
+			target_branch_filter TEXT DEFAULT '',
+			base_directory TEXT DEFAULT '',
+			file_path_template TEXT DEFAULT '',
+			schema_path_template TEXT DEFAULT '',
+			schema_source_type TEXT DEFAULT 'SINGLE_FILE',
+			duplicate_version_policy TEXT DEFAULT 'ERROR',
+			empty_migration_policy TEXT DEFAULT 'SKIP',
+			migration_statement_timeout INTEGER DEFAULT 0,
+			drift_action TEXT DEFAULT 'ANOMALY_ONLY',
+			provider_user_id TEXT DEFAULT '',
+			provider_username TEXT DEFAULT '',
+			cleanup_ts BIGINT DEFAULT 0,
+			require_signed_commits BOOLEAN DEFAULT FALSE,
+			skip_directive TEXT DEFAULT '[skip bytebase]',
+			schema_ref TEXT DEFAULT '',
+			schema_snapshot_on_apply BOOLEAN DEFAULT FALSE,
+			ignore_path_patterns TEXT DEFAULT '',
+			notification_webhook_url_list TEXT DEFAULT '',
+			commit_author_name TEXT DEFAULT '',
+			commit_author_email TEXT DEFAULT '',
+			commit_status_context TEXT DEFAULT '',
+			labels TEXT DEFAULT '{}',
+			branch_environment_mapping TEXT DEFAULT '{}',
+			external_id TEXT DEFAULT '',
+			external_webhook_id TEXT DEFAULT '',
+			webhook_url_host TEXT DEFAULT '',
+			webhook_endpoint_id TEXT DEFAULT '',
+			webhook_secret_token TEXT DEFAULT '',
+			webhook_status TEXT DEFAULT 'WEBHOOK_ACTIVE',
+			token_status TEXT DEFAULT 'TOKEN_VALID',
+			provider_status TEXT DEFAULT 'PROVIDER_FOUND',
+			sync_status TEXT DEFAULT 'ACTIVE',
+			sync_failure_count INTEGER DEFAULT 0,
+			access_token TEXT DEFAULT '',
+			expires_ts BIGINT NULL,
+			refresh_token TEXT DEFAULT ''
+		);
+	`); err != nil {
+		db.Close()
+		t.Fatalf("failed to create the repository table, error %v", err)
+	}
+	return db
+}
+
+func TestFindRepositoryIDs(t *testing.T) {
+	ctx := context.Background()
+	db := openRepositoryTestDB(ctx, t)
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO repository (id, vcs_id, project_id, external_webhook_id) VALUES
+			(1, 1, 101, '11'),
+			(2, 1, 102, ''),
+			(3, 2, 101, ''),
+			(4, 2, 102, '14'),
+			(5, 1, 101, '15');
+	`); err != nil {
+		t.Fatalf("failed to insert the repositories, error %v", err)
+	}
+
+	vcsID := 1
+	projectID := 101
+	tests := []struct {
+		name string
+		find *api.RepositoryFind
+		want []int
+	}{
+		{
+			name: "all repositories",
+			find: &api.RepositoryFind{},
+			want: []int{1, 2, 3, 4, 5},
+		},
+		{
+			name: "by VCS and project",
+			find: &api.RepositoryFind{VCSID: &vcsID, ProjectID: &projectID},
+			want: []int{1, 5},
+		},
+		{
+			name: "without webhook",
+			find: &api.RepositoryFind{WithoutWebhook: true},
+			want: []int{2, 3},
+		},
+	}
+
+	for _, test := range tests {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("BeginTx() got error %v, want OK.", err)
+		}
+		idList, err := findRepositoryIDs(ctx, tx, test.find)
+		if err != nil {
+			t.Fatalf("%q: findRepositoryIDs() got error %v, want OK.", test.name, err)
+		}
+		list, err := findRepositoryList(ctx, tx, test.find)
+		if err != nil {
+			t.Fatalf("%q: findRepositoryList() got error %v, want OK.", test.name, err)
+		}
+		if err := tx.Rollback(); err != nil {
+			t.Fatalf("Rollback() got error %v, want OK.", err)
+		}
+
+		var listIDs []int
+		for _, repository := range list {
+			listIDs = append(listIDs, repository.ID)
+		}
+		sort.Ints(idList)
+		sort.Ints(listIDs)
+		if !reflect.DeepEqual(idList, test.want) {
+			t.Errorf("%q: findRepositoryIDs() got %v, want %v.", test.name, idList, test.want)
+		}
+		if !reflect.DeepEqual(idList, listIDs) {
+			t.Errorf("%q: findRepositoryIDs() got %v, want the same IDs as findRepositoryList() %v.", test.name, idList, listIDs)
+		}
+	}
+}
+
+func TestFindRepositoryListSecrets(t *testing.T) {
+	ctx := context.Background()
+	db := openRepositoryTestDB(ctx, t)
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO repository (id, vcs_id, project_id, webhook_secret_token, access_token, expires_ts, refresh_token) VALUES
+			(1, 1, 101, 'secret-1', 'access-1', 1650000000, 'refresh-1');
+	`); err != nil {
+		t.Fatalf("failed to insert the repositories, error %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		includeSecrets bool
+		want           []string
+	}{
+		{
+			name: "secrets not requested",
+			want: []string{"", "", ""},
+		},
+		{
+			name:           "secrets requested",
+			includeSecrets: true,
+			want:           []string{"secret-1", "access-1", "refresh-1"},
+		},
+	}
+
+	for _, test := range tests {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("BeginTx() got error %v, want OK.", err)
+		}
+		list, err := findRepositoryList(ctx, tx, &api.RepositoryFind{IncludeSecrets: test.includeSecrets})
+		if err != nil {
+			t.Fatalf("%q: findRepositoryList() got error %v, want OK.", test.name, err)
+		}
+		if err := tx.Rollback(); err != nil {
+			t.Fatalf("Rollback() got error %v, want OK.", err)
+		}
+		if len(list) != 1 {
+			t.Fatalf("%q: findRepositoryList() got %d repositories, want 1.", test.name, len(list))
+		}
+		repository := list[0]
+		got := []string{repository.WebhookSecretToken, repository.AccessToken, repository.RefreshToken}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: findRepositoryList() got secrets %v, want %v.", test.name, got, test.want)
+		}
+		// The non-secret fields are selected regardless.
+		if repository.ExpiresTs == nil || *repository.ExpiresTs != 1650000000 {
+			t.Errorf("%q: findRepositoryList() got expires ts %v, want %d.", test.name, repository.ExpiresTs, 1650000000)
+		}
+	}
+}
+
+func TestFindRepositoryListProviderUser(t *testing.T) {
+	ctx := context.Background()
+	db := openRepositoryTestDB(ctx, t)
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO repository (id, vcs_id, project_id, provider_user_id, provider_username) VALUES
+			(1, 1, 101, '42', 'jdoe');
+	`); err != nil {
+		t.Fatalf("failed to insert the repositories, error %v", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx() got error %v, want OK.", err)
+	}
+	defer tx.Rollback()
+	list, err := findRepositoryList(ctx, tx, &api.RepositoryFind{})
+	if err != nil {
+		t.Fatalf("findRepositoryList() got error %v, want OK.", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("findRepositoryList() got %d repositories, want 1.", len(list))
+	}
+	if list[0].ProviderUserID != "42" || list[0].ProviderUsername != "jdoe" {
+		t.Errorf("findRepositoryList() got provider user %q %q, want %q %q.", list[0].ProviderUserID, list[0].ProviderUsername, "42", "jdoe")
+	}
+}
+
+func TestFindRepositoryListWebURL(t *testing.T) {
+	ctx := context.Background()
+	db := openRepositoryTestDB(ctx, t)
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO repository (id, vcs_id, project_id, web_url) VALUES
+			(1, 1, 101, 'https://gitlab.com/group/project'),
+			(2, 1, 102, 'https://gitlab.com/group/project-2/'),
+			(3, 2, 103, 'http://gitlab.example.com/group/project');
+	`); err != nil {
+		t.Fatalf("failed to insert the repositories, error %v", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx() got error %v, want OK.", err)
+	}
+	defer tx.Rollback()
+	tests := []struct {
+		webURL string
+		want   []int
+	}{
+		{webURL: "https://gitlab.com/group/project", want: []int{1}},
+		{webURL: "https://gitlab.com/group/project/", want: []int{1}},
+		{webURL: "https://gitlab.com/group/project.git", want: []int{1}},
+		{webURL: "git@gitlab.com:group/project.git", want: []int{1}},
+		{webURL: "ssh://git@GitLab.com/Group/Project", want: []int{1}},
+		{webURL: "git@gitlab.com:group/project-2.git", want: []int{2}},
+		{webURL: "git@gitlab.example.com:group/project.git", want: []int{3}},
+		{webURL: "git@gitlab.com:group/other.git"},
+	}
+	for _, test := range tests {
+		webURL := test.webURL
+		list, err := findRepositoryList(ctx, tx, &api.RepositoryFind{WebURL: &webURL})
+		if err != nil {
+			t.Fatalf("findRepositoryList(%q) got error %v, want OK.", test.webURL, err)
+		}
+		var idList []int
+		for _, repository := range list {
+			idList = append(idList, repository.ID)
+		}
+		if !reflect.DeepEqual(idList, test.want) {
+			t.Errorf("findRepositoryList(%q) got %v, want %v.", test.webURL, idList, test.want)
+		}
+	}
+
+	// The URL without a host is rejected rather than matching nothing silently.
+	invalid := "https:///group/project"
+	if _, err := findRepositoryList(ctx, tx, &api.RepositoryFind{WebURL: &invalid}); common.ErrorCode(err) != common.Invalid {
+		t.Errorf("findRepositoryList(%q) got error %v, want EINVALID.", invalid, err)
+	}
+}
+
+func TestEscapeLikePattern(t *testing.T) {
+	tests := []struct {
+		term string
+		want string
+	}{
+		{term: "blog", want: "blog"},
+		{term: "100%", want: `100\%`},
+		{term: "my_repo", want: `my\_repo`},
+		{term: `C:\repo`, want: `C:\\repo`},
+	}
+	for _, test := range tests {
+		if got := escapeLikePattern(test.term); got != test.want {
+			t.Errorf("escapeLikePattern(%q) got %q, want %q.", test.term, got, test.want)
+		}
+	}
+}
+
+func TestFindRepositoryListSearchTerm(t *testing.T) {
+	ctx := context.Background()
+	db := openRepositoryTestDB(ctx, t)
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO repository (id, vcs_id, project_id, name, full_path, web_url) VALUES
+			(1, 1, 101, 'Blog', 'acme/blog', 'https://gitlab.example.com/acme/blog'),
+			(2, 1, 102, 'shop', 'acme/shop', 'https://gitlab.example.com/acme/shop'),
+			(3, 1, 103, 'billing', 'payments/billing', 'https://gitlab.example.com/payments/billing'),
+			(4, 2, 104, 'my_repo', 'acme/my_repo', 'https://git.example.com/acme/my_repo'),
+			(5, 2, 105, 'myXrepo', 'acme/myXrepo', 'https://git.example.com/acme/myXrepo'),
+			(6, 2, 106, 'discount', 'acme/100%-off', 'https://git.example.com/acme/discount');
+	`); err != nil {
+		t.Fatalf("failed to insert the repositories, error %v", err)
+	}
+
+	vcsID := 1
+	tests := []struct {
+		name string
+		find *api.RepositoryFind
+		term string
+		want []int
+	}{
+		{
+			name: "matches the name case-insensitively",
+			term: "BLOG",
+			want: []int{1},
+		},
+		{
+			name: "matches the full path",
+			term: "payments/",
+			want: []int{3},
+		},
+		{
+			name: "matches the web URL",
+			term: "git.example.com",
+			want: []int{4, 5, 6},
+		},
+		{
+			name: "underscore matched literally",
+			term: "my_repo",
+			want: []int{4},
+		},
+		{
+			name: "percent matched literally",
+			term: "100%",
+			want: []int{6},
+		},
+		{
+			name: "combined with other filters",
+			find: &api.RepositoryFind{VCSID: &vcsID},
+			term: "acme",
+			want: []int{1, 2},
+		},
+	}
+
+	for _, test := range tests {
+		find := test.find
+		if find == nil {
+			find = &api.RepositoryFind{}
+		}
+		find.SearchTerm = &test.term
+		where, args, err := findRepositoryWhere(find)
+		if err != nil {
+			t.Fatalf("%q: findRepositoryWhere() got error %v, want OK.", test.name, err)
+		}
+		// SQLite has no ILIKE, while its LIKE is case-insensitive for ASCII already.
+		rows, err := db.QueryContext(ctx, `SELECT id FROM repository WHERE `+strings.ReplaceAll(strings.Join(where, " AND "), "ILIKE", "LIKE")+` ORDER BY id`, args...)
+		if err != nil {
+			t.Fatalf("%q: failed to query the repositories, error %v", test.name, err)
+		}
+		var idList []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				t.Fatalf("%q: failed to scan the repository, error %v", test.name, err)
+			}
+			idList = append(idList, id)
+		}
+		rows.Close()
+		if !reflect.DeepEqual(idList, test.want) {
+			t.Errorf("%q: findRepositoryWhere() matched %v, want %v.", test.name, idList, test.want)
+		}
+	}
+}
+
+func TestArchiveRepositoriesForProject(t *testing.T) {
+	ctx := context.Background()
+	db := openRepositoryTestDB(ctx, t)
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO repository (id, vcs_id, project_id, external_id) VALUES
+			(1, 1, 101, '11'),
+			(2, 2, 101, '12'),
+			(3, 1, 102, '13');
+	`); err != nil {
+		t.Fatalf("failed to insert the repositories, error %v", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx() got error %v, want OK.", err)
+	}
+	defer tx.Rollback()
+	count, err := archiveRepositoriesForProject(ctx, tx, 101, 2)
+	if err != nil {
+		t.Fatalf("archiveRepositoriesForProject() got error %v, want OK.", err)
+	}
+	if count != 2 {
+		t.Errorf("archiveRepositoriesForProject() got count %d, want 2.", count)
+	}
+
+	// The archived repositories are no longer found, while the repositories of the other projects are left as is.
+	idList, err := findRepositoryIDs(ctx, tx, &api.RepositoryFind{})
+	if err != nil {
+		t.Fatalf("findRepositoryIDs() got error %v, want OK.", err)
+	}
+	if want := []int{3}; !reflect.DeepEqual(idList, want) {
+		t.Errorf("findRepositoryIDs() got %v, want %v.", idList, want)
+	}
+	projectID := 101
+	list, err := findRepositoryList(ctx, tx, &api.RepositoryFind{ProjectID: &projectID})
+	if err != nil {
+		t.Fatalf("findRepositoryList() got error %v, want OK.", err)
+	}
+	if len(list) != 0 {
+		t.Errorf("findRepositoryList() got %d repositories of the archived project, want 0.", len(list))
+	}
+	var archivedCount int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM repository WHERE project_id = 101 AND row_status = 'ARCHIVED' AND updater_id = 2`).Scan(&archivedCount); err != nil {
+		t.Fatalf("failed to count the archived repositories, error %v", err)
+	}
+	if archivedCount != 2 {
+		t.Errorf("archiveRepositoriesForProject() archived %d repositories, want 2.", archivedCount)
+	}
+
+	// Archiving again finds nothing left to archive.
+	count, err = archiveRepositoriesForProject(ctx, tx, 101, 2)
+	if err != nil {
+		t.Fatalf("archiveRepositoriesForProject() got error %v, want OK.", err)
+	}
+	if count != 0 {
+		t.Errorf("archiveRepositoriesForProject() again got count %d, want 0.", count)
+	}
+}
+
+func TestFindOrphanedRepositories(t *testing.T) {
+	ctx := context.Background()
+	db := openRepositoryTestDB(ctx, t)
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE vcs (id INTEGER PRIMARY KEY);
+		INSERT INTO vcs (id) VALUES (1);
+		INSERT INTO repository (id, vcs_id, project_id, external_id) VALUES
+			(1, 1, 101, '11'),
+			(2, 2, 102, '12');
+	`); err != nil {
+		t.Fatalf("failed to insert the repositories, error %v", err)
+	}
+
+	s := &RepositoryService{db: &DB{db: db, Now: time.Now}}
+	list, err := s.FindOrphanedRepositories(ctx)
+	if err != nil {
+		t.Fatalf("FindOrphanedRepositories() got error %v, want OK.", err)
+	}
+	// The repository of the deleted VCS 2 is reported, while the one of the existing VCS 1 isn't.
+	var idList []int
+	for _, repository := range list {
+		idList = append(idList, repository.ID)
+	}
+	if want := []int{2}; !reflect.DeepEqual(idList, want) {
+		t.Errorf("FindOrphanedRepositories() got %v, want %v.", idList, want)
+	}
+}
+
+func TestListWebhookEndpoints(t *testing.T) {
+	ctx := context.Background()
+	db := openRepositoryTestDB(ctx, t)
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE vcs (id INTEGER PRIMARY KEY, type TEXT);
+		INSERT INTO vcs (id, type) VALUES (1, 'GITLAB_SELF_HOST');
+		INSERT INTO repository (id, vcs_id, project_id, external_id, webhook_endpoint_id, row_status, sync_status) VALUES
+			(1, 1, 101, '11', 'endpoint-1', 'NORMAL', 'ACTIVE'),
+			(2, 1, 102, '12', 'endpoint-2', 'NORMAL', 'QUARANTINED'),
+			(3, 1, 103, '13', 'endpoint-3', 'ARCHIVED', 'ACTIVE');
+	`); err != nil {
+		t.Fatalf("failed to insert the repositories, error %v", err)
+	}
+
+	s := &RepositoryService{db: &DB{db: db, Now: time.Now}}
+	refList, err := s.ListWebhookEndpoints(ctx)
+	if err != nil {
+		t.Fatalf("ListWebhookEndpoints() got error %v, want OK.", err)
+	}
+	// The archived repository 3 is excluded, while the quarantined repository 2 is listed with sync disabled.
+	want := []*api.WebhookEndpointRef{
+		{RepositoryID: 1, WebhookEndpointID: "endpoint-1", VCSType: vcs.GitLabSelfHost, SyncEnabled: true},
+		{RepositoryID: 2, WebhookEndpointID: "endpoint-2", VCSType: vcs.GitLabSelfHost, SyncEnabled: false},
+	}
+	if !reflect.DeepEqual(refList, want) {
+		t.Errorf("ListWebhookEndpoints() got %+v, want %+v.", refList, want)
+	}
+}
+
+func TestPatchRepositoryList(t *testing.T) {
+	ctx := context.Background()
+	db := openRepositoryTestDB(ctx, t)
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO repository (id, vcs_id, project_id, external_id, file_path_template) VALUES
+			(1, 1, 101, '11', '{{DB_NAME}}__{{VERSION}}.sql'),
+			(2, 1, 102, '12', '{{DB_NAME}}__{{VERSION}}.sql');
+	`); err != nil {
+		t.Fatalf("failed to insert the repositories, error %v", err)
+	}
+	s := &RepositoryService{db: &DB{db: db, Now: time.Now}}
+	template := "{{ENV_NAME}}/{{DB_NAME}}__{{VERSION}}.sql"
+	checkTemplates := func(step string, want ...string) {
+		for i, id := range []int{1, 2} {
+			var got string
+			if err := db.QueryRowContext(ctx, "SELECT file_path_template FROM repository WHERE id = $1", id).Scan(&got); err != nil {
+				t.Fatalf("failed to query the repository, error %v", err)
+			}
+			if got != want[i] {
+				t.Errorf("%s: repository %d got file path template %q, want %q.", step, id, got, want[i])
+			}
+		}
+	}
+
+	// Patching the nonexistent repository 3 rolls back the patch of repository 1.
+	if _, err := s.PatchRepositoryList(ctx, []*api.RepositoryPatch{{ID: 1, FilePathTemplate: &template}, {ID: 3, FilePathTemplate: &template}}); err == nil {
+		t.Errorf("PatchRepositoryList() with the nonexistent repository got OK, want error.")
+	}
+	checkTemplates("rollback", "{{DB_NAME}}__{{VERSION}}.sql", "{{DB_NAME}}__{{VERSION}}.sql")
+
+	list, err := s.PatchRepositoryList(ctx, []*api.RepositoryPatch{{ID: 1, FilePathTemplate: &template}, {ID: 2, FilePathTemplate: &template}})
+	if err != nil {
+		t.Fatalf("PatchRepositoryList() got error %v, want OK.", err)
+	}
+	if len(list) != 2 || list[0].FilePathTemplate != template || list[1].FilePathTemplate != template {
+		t.Errorf("PatchRepositoryList() got %v, want both repositories patched.", list)
+	}
+	checkTemplates("commit", template, template)
+
+	accessToken := "access"
+	if _, err := s.PatchRepositoryList(ctx, []*api.RepositoryPatch{{ID: 1, AccessToken: &accessToken}}); common.ErrorCode(err) != common.Invalid {
+		t.Errorf("PatchRepositoryList() with the token got error %v, want invalid.", err)
+	}
+}
+
+func TestLastSyncedSchemaHash(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s", filepath.Join(t.TempDir(), "schema_hash.db")))
+	if err != nil {
+		t.Fatalf("sql.Open() got error %v, want OK.", err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE repository_schema_hash (database_id INTEGER, path TEXT, hash TEXT, PRIMARY KEY (database_id, path));
+	`); err != nil {
+		t.Fatalf("failed to create the repository_schema_hash table, error %v", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx() got error %v, want OK.", err)
+	}
+	defer tx.Rollback()
+
+	// The schema file never synced has no hash.
+	hash, err := findLastSyncedSchemaHash(ctx, tx, 1, "bytebase/blog__LATEST.sql")
+	if err != nil {
+		t.Fatalf("findLastSyncedSchemaHash() got error %v, want OK.", err)
+	}
+	if hash != "" {
+		t.Errorf("findLastSyncedSchemaHash() got %q before syncing, want empty.", hash)
+	}
+
+	for _, upsert := range []struct {
+		databaseID int
+		hash       string
+	}{
+		{databaseID: 1, hash: "h1"},
+		{databaseID: 2, hash: "h2"},
+		// The hash of the same database and path is replaced.
+		{databaseID: 1, hash: "h3"},
+	} {
+		if err := upsertLastSyncedSchemaHash(ctx, tx, upsert.databaseID, "bytebase/blog__LATEST.sql", upsert.hash); err != nil {
+			t.Fatalf("upsertLastSyncedSchemaHash() got error %v, want OK.", err)
+		}
+	}
+	for databaseID, want := range map[int]string{1: "h3", 2: "h2"} {
+		hash, err := findLastSyncedSchemaHash(ctx, tx, databaseID, "bytebase/blog__LATEST.sql")
+		if err != nil {
+			t.Fatalf("findLastSyncedSchemaHash() got error %v, want OK.", err)
+		}
+		if hash != want {
+			t.Errorf("findLastSyncedSchemaHash(%d) got %q, want %q.", databaseID, hash, want)
+		}
+	}
+}
+
+func TestSyncHistory(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s", filepath.Join(t.TempDir(), "sync_history.db")))
+	if err != nil {
+		t.Fatalf("sql.Open() got error %v, want OK.", err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE repository_sync_history (
+			id INTEGER PRIMARY KEY,
+			repository_id INTEGER,
+			ref TEXT,
+			commit_id TEXT,
+			result TEXT,
+			detail TEXT,
+			started_ts BIGINT,
+			duration_ms BIGINT
+		);
+	`); err != nil {
+		t.Fatalf("failed to create the repository_sync_history table, error %v", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx() got error %v, want OK.", err)
+	}
+	defer tx.Rollback()
+
+	const retention = 3
+	// Append 5 syncs to repository 101, interleaved with a sync to repository 102.
+	for i := 1; i <= 5; i++ {
+		result := api.RepositorySyncSuccess
+		if i == 4 {
+			result = api.RepositorySyncFailed
+		}
+		if err := appendSyncHistory(ctx, tx, &api.SyncHistoryEntryCreate{
+			RepositoryID: 101,
+			Ref:          "refs/heads/main",
+			CommitID:     fmt.Sprintf("commit%d", i),
+			Result:       result,
+			StartedTs:    int64(1650000000 + i),
+			DurationMs:   int64(i * 100),
+		}, retention); err != nil {
+			t.Fatalf("appendSyncHistory() got error %v, want OK.", err)
+		}
+		if i == 1 {
+			if err := appendSyncHistory(ctx, tx, &api.SyncHistoryEntryCreate{RepositoryID: 102, CommitID: "other", Result: api.RepositorySyncSuccess}, retention); err != nil {
+				t.Fatalf("appendSyncHistory() got error %v, want OK.", err)
+			}
+		}
+	}
+
+	// Only the most recent entries within the retention are kept, the latest first.
+	list, err := listSyncHistory(ctx, tx, 101, 20)
+	if err != nil {
+		t.Fatalf("listSyncHistory() got error %v, want OK.", err)
+	}
+	var commitList []string
+	for _, entry := range list {
+		commitList = append(commitList, entry.CommitID)
+	}
+	if want := []string{"commit5", "commit4", "commit3"}; !reflect.DeepEqual(commitList, want) {
+		t.Errorf("listSyncHistory() got commits %v, want %v.", commitList, want)
+	}
+	if len(list) > 1 && (list[1].Result != api.RepositorySyncFailed || list[1].DurationMs != 400 || list[1].StartedTs != 1650000004) {
+		t.Errorf("listSyncHistory() got entry %+v, want the failed sync of commit4.", list[1])
+	}
+
+	// The limit applies.
+	list, err = listSyncHistory(ctx, tx, 101, 1)
+	if err != nil {
+		t.Fatalf("listSyncHistory() got error %v, want OK.", err)
+	}
+	if len(list) != 1 || list[0].CommitID != "commit5" {
+		t.Errorf("listSyncHistory() with limit 1 got %+v, want commit5 only.", list)
+	}
+
+	// The history of the other repository isn't pruned.
+	list, err = listSyncHistory(ctx, tx, 102, 20)
+	if err != nil {
+		t.Fatalf("listSyncHistory() got error %v, want OK.", err)
+	}
+	if len(list) != 1 {
+		t.Errorf("listSyncHistory() of the other repository got %d entries, want 1.", len(list))
+	}
+}
+
+func TestSwapRepositoryToken(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s", filepath.Join(t.TempDir(), "token.db")))
+	if err != nil {
+		t.Fatalf("sql.Open() got error %v, want OK.", err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `
+		CREATE TABLE repository (id INTEGER PRIMARY KEY, updater_id INTEGER, access_token TEXT, expires_ts BIGINT NULL, refresh_token TEXT, token_status TEXT);
+		INSERT INTO repository (id, updater_id, access_token, expires_ts, refresh_token, token_status) VALUES (101, 1, 'access-0', 1650000000, 'refresh-0', 'TOKEN_INVALID');
+	`); err != nil {
+		t.Fatalf("failed to create the repository table, error %v", err)
+	}
+
+	tests := []struct {
+		name string
+		swap *api.RepositoryTokenSwap
+		want bool
+	}{
+		{
+			name: "swap the current refresh token",
+			swap: &api.RepositoryTokenSwap{ID: 101, OldRefreshToken: "refresh-0", AccessToken: "access-1", ExpiresTs: 1650007200, RefreshToken: "refresh-1"},
+			want: true,
+		},
+		{
+			name: "lose the race to the concurrent refresh",
+			swap: &api.RepositoryTokenSwap{ID: 101, OldRefreshToken: "refresh-0", AccessToken: "access-2", ExpiresTs: 1650007200, RefreshToken: "refresh-2"},
+			want: false,
+		},
+	}
+
+	for _, test := range tests {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("BeginTx() got error %v, want OK.", err)
+		}
+		got, err := swapRepositoryToken(ctx, tx, test.swap)
+		if err != nil {
+			t.Fatalf("%q: swapRepositoryToken() got error %v, want OK.", test.name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit() got error %v, want OK.", err)
+		}
+		if got != test.want {
+			t.Errorf("%q: swapRepositoryToken() got swapped %v, want %v.", test.name, got, test.want)
+		}
+	}
+
+	// Only the winning refresh is stored, and it marks the token valid.
+	var accessToken, refreshToken, tokenStatus string
+	if err := db.QueryRowContext(ctx, "SELECT access_token, refresh_token, token_status FROM repository WHERE id = 101").Scan(&accessToken, &refreshToken, &tokenStatus); err != nil {
+		t.Fatalf("failed to query the repository, error %v", err)
+	}
+	if accessToken != "access-1" || refreshToken != "refresh-1" || tokenStatus != string(api.TokenValid) {
+		t.Errorf("got access token %q refresh token %q status %q, want %q %q %q.", accessToken, refreshToken, tokenStatus, "access-1", "refresh-1", api.TokenValid)
+	}
+}
+
+func TestDescribeRepository(t *testing.T) {
+	sampleList := []*sampleDatabase{
+		{environmentName: "dev", databaseName: "blog"},
+		{environmentName: "prod", databaseName: "shop"},
+	}
+
+	tests := []struct {
+		name       string
+		repository *api.Repository
+		want       *api.RepositoryDescription
+	}{
+		{
+			name: "resolve defaults",
+			repository: &api.Repository{
+				ID:               101,
+				FullPath:         "bytebase/blog",
+				BranchFilter:     "main",
+				FilePathTemplate: "{{ENV_NAME}}/{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql",
+			},
+			want: &api.RepositoryDescription{
+				RepositoryID:        101,
+				FullPath:            "bytebase/blog",
+				TenantMode:          api.TenantModeDisabled,
+				BranchFilter:        "main",
+				TargetBranchFilter:  "*",
+				FilePathTemplate:    "{{ENV_NAME}}/{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql",
+				SchemaSourceType:    api.SchemaSourceSingleFile,
+				CommitAuthor:        "the user linking the project to the repository",
+				CommitStatusContext: "bytebase/schema",
+				ExampleList: []*api.RepositoryPathExample{
+					{
+						EnvironmentName: "dev",
+						DatabaseName:    "blog",
+						MigrationPath:   "dev/blog__202204150900__migrate__add_column.sql",
+					},
+					{
+						EnvironmentName: "prod",
+						DatabaseName:    "shop",
+						MigrationPath:   "prod/shop__202204150900__migrate__add_column.sql",
+					},
+				},
+			},
+		},
+		{
+			name: "configured",
+			repository: &api.Repository{
+				ID:                  102,
+				FullPath:            "bytebase/shop",
+				BranchFilter:        "release/*",
+				TargetBranchFilter:  "main",
+				BaseDirectory:       "bytebase",
+				FilePathTemplate:    "{{ENV_NAME}}/{{DB_NAME}}__{{VERSION}}__{{TYPE}}.sql",
+				SchemaPathTemplate:  "{{ENV_NAME}}/.{{DB_NAME}}__LATEST.sql",
+				SchemaSourceType:    api.SchemaSourceSingleFile,
+				IgnorePathPatterns:  []string{"bytebase/prod/*"},
+				CommitAuthorName:    "Bytebase Bot",
+				CommitAuthorEmail:   "bot@bytebase.com",
+				CommitStatusContext: "ci/schema",
+			},
+			want: &api.RepositoryDescription{
+				RepositoryID:        102,
+				FullPath:            "bytebase/shop",
+				TenantMode:          api.TenantModeDisabled,
+				BranchFilter:        "release/*",
+				TargetBranchFilter:  "main",
+				BaseDirectory:       "bytebase",
+				FilePathTemplate:    "{{ENV_NAME}}/{{DB_NAME}}__{{VERSION}}__{{TYPE}}.sql",
+				SchemaPathTemplate:  "{{ENV_NAME}}/.{{DB_NAME}}__LATEST.sql",
+				SchemaSourceType:    api.SchemaSourceSingleFile,
+				IgnorePathPatterns:  []string{"bytebase/prod/*"},
+				CommitAuthor:        "Bytebase Bot <bot@bytebase.com>",
+				CommitStatusContext: "ci/schema",
+				ExampleList: []*api.RepositoryPathExample{
+					{
+						EnvironmentName: "dev",
+						DatabaseName:    "blog",
+						MigrationPath:   "bytebase/dev/blog__202204150900__migrate.sql",
+						SchemaPath:      "bytebase/dev/.blog__LATEST.sql",
+					},
+					{
+						EnvironmentName: "prod",
+						DatabaseName:    "shop",
+						MigrationPath:   "bytebase/prod/shop__202204150900__migrate.sql",
+						SchemaPath:      "bytebase/prod/.shop__LATEST.sql",
+						Ignored:         true,
+					},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := describeRepository(test.repository, api.TenantModeDisabled, sampleList)
+		if err != nil {
+			t.Errorf("%q: describeRepository() got error %v, want OK.", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: describeRepository() got %+v, want %+v.", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGetRepositoryByWebhookEndpointCache(t *testing.T) {
+	ctx := context.Background()
+	db := openRepositoryTestDB(ctx, t)
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO repository (id, vcs_id, project_id, branch_filter, webhook_endpoint_id) VALUES
+			(1, 1, 101, 'main', 'endpoint1'),
+			(2, 1, 102, 'main', 'endpoint2');
+	`); err != nil {
+		t.Fatalf("failed to insert the repositories, error %v", err)
+	}
+	s := &RepositoryService{db: &DB{db: db, Now: time.Now}}
+	cache := NewRepositoryTTLCache(time.Hour)
+	s.SetRepositoryCache(cache)
+
+	getBranchFilter := func(webhookEndpointID string) string {
+		repository, err := s.GetRepositoryByWebhookEndpoint(ctx, webhookEndpointID)
+		if err != nil {
+			t.Fatalf("GetRepositoryByWebhookEndpoint(%q) got error %v, want OK.", webhookEndpointID, err)
+		}
+		return repository.BranchFilter
+	}
+	for _, webhookEndpointID := range []string{"endpoint1", "endpoint2"} {
+		if got := getBranchFilter(webhookEndpointID); got != "main" {
+			t.Fatalf("GetRepositoryByWebhookEndpoint(%q) got branch filter %q, want %q.", webhookEndpointID, got, "main")
+		}
+	}
+
+	// The entries are served from the cache, regardless of the changes made bypassing the service.
+	if _, err := db.ExecContext(ctx, `UPDATE repository SET branch_filter = 'stale'`); err != nil {
+		t.Fatalf("failed to update the repositories, error %v", err)
+	}
+	if got := getBranchFilter("endpoint1"); got != "main" {
+		t.Errorf("GetRepositoryByWebhookEndpoint() got branch filter %q, want the cached %q.", got, "main")
+	}
+
+	// The patch invalidates the patched repository only.
+	branchFilter := "release/*"
+	if _, err := s.PatchRepository(ctx, &api.RepositoryPatch{ID: 1, BranchFilter: &branchFilter}); err != nil {
+		t.Fatalf("PatchRepository() got error %v, want OK.", err)
+	}
+	if got := getBranchFilter("endpoint1"); got != branchFilter {
+		t.Errorf("GetRepositoryByWebhookEndpoint() after patch got branch filter %q, want %q.", got, branchFilter)
+	}
+	if got := getBranchFilter("endpoint2"); got != "main" {
+		t.Errorf("GetRepositoryByWebhookEndpoint() of the other repository got branch filter %q, want the cached %q.", got, "main")
+	}
+
+	// The repository loaded before the invalidation isn't cached.
+	generation := cache.Generation()
+	cache.InvalidateProject(102)
+	cache.Set(&api.Repository{ID: 2, ProjectID: 102, WebhookEndpointID: "endpoint2", BranchFilter: "main"}, generation)
+	if got := getBranchFilter("endpoint2"); got != "stale" {
+		t.Errorf("GetRepositoryByWebhookEndpoint() after invalidation got branch filter %q, want %q.", got, "stale")
+	}
+
+	// The entry expires after the TTL.
+	cache.now = func() time.Time {
+		return time.Now().Add(2 * time.Hour)
+	}
+	if _, err := db.ExecContext(ctx, `UPDATE repository SET branch_filter = 'expired' WHERE id = 2`); err != nil {
+		t.Fatalf("failed to update the repository, error %v", err)
+	}
+	if got := getBranchFilter("endpoint2"); got != "expired" {
+		t.Errorf("GetRepositoryByWebhookEndpoint() after TTL got branch filter %q, want %q.", got, "expired")
+	}
+}
+
+func TestRecordSyncResult(t *testing.T) {
+	ctx := context.Background()
+	db := openRepositoryTestDB(ctx, t)
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `INSERT INTO repository (id, vcs_id, project_id, webhook_endpoint_id) VALUES (1, 1, 101, 'endpoint1')`); err != nil {
+		t.Fatalf("failed to insert the repository, error %v", err)
+	}
+	s := &RepositoryService{db: &DB{db: db, Now: time.Now}}
+	const threshold = 3
+	repositoryID := 1
+
+	record := func(result api.RepositorySyncResult) bool {
+		quarantined, err := s.RecordSyncResult(ctx, repositoryID, result, threshold)
+		if err != nil {
+			t.Fatalf("RecordSyncResult(%s) got error %v, want OK.", result, err)
+		}
+		return quarantined
+	}
+	assertState := func(name string, wantStatus api.RepositorySyncStatus, wantCount int) {
+		repository, err := s.FindRepository(ctx, &api.RepositoryFind{ID: &repositoryID})
+		if err != nil {
+			t.Fatalf("FindRepository() got error %v, want OK.", err)
+		}
+		if repository.SyncStatus != wantStatus || repository.SyncFailureCount != wantCount {
+			t.Errorf("%s: got sync status %s with %d failures, want %s with %d failures.", name, repository.SyncStatus, repository.SyncFailureCount, wantStatus, wantCount)
+		}
+	}
+
+	// A success in between resets the count, so the failures aren't consecutive.
+	record(api.RepositorySyncFailed)
+	record(api.RepositorySyncFailed)
+	record(api.RepositorySyncSuccess)
+	assertState("success resets", api.SyncActive, 0)
+
+	// Only the failure reaching the threshold quarantines the repository.
+	for i := 1; i <= threshold+1; i++ {
+		if got, want := record(api.RepositorySyncFailed), i == threshold; got != want {
+			t.Errorf("RecordSyncResult() failure %d got quarantined %t, want %t.", i, got, want)
+		}
+	}
+	assertState("consecutive failures", api.SyncQuarantined, threshold+1)
+
+	// Un-quarantining resets the count, and a success keeps the repository active.
+	syncStatus := api.SyncActive
+	if _, err := s.PatchRepository(ctx, &api.RepositoryPatch{ID: repositoryID, SyncStatus: &syncStatus}); err != nil {
+		t.Fatalf("PatchRepository() got error %v, want OK.", err)
+	}
+	assertState("un-quarantine", api.SyncActive, 0)
+	record(api.RepositorySyncFailed)
+	record(api.RepositorySyncSuccess)
+	assertState("un-quarantine and success", api.SyncActive, 0)
+
+	// The repository is quarantined again only after another threshold consecutive failures.
+	for i := 1; i <= threshold; i++ {
+		if got, want := record(api.RepositorySyncFailed), i == threshold; got != want {
+			t.Errorf("RecordSyncResult() failure %d after un-quarantine got quarantined %t, want %t.", i, got, want)
+		}
+	}
+	assertState("quarantined again", api.SyncQuarantined, threshold)
+
+	if _, err := s.RecordSyncResult(ctx, 2, api.RepositorySyncFailed, threshold); common.ErrorCode(err) != common.NotFound {
+		t.Errorf("RecordSyncResult() of missing repository got error %v, want not found.", err)
+	}
+}
+
+// fakeWorkflowProjectService records the workflow type of the projects patched.
+type fakeWorkflowProjectService struct {
+	api.ProjectService
+	workflowTypeMap map[int]api.ProjectWorkflowType
+}
+
+func (f *fakeWorkflowProjectService) PatchProjectTx(_ context.Context, _ *sql.Tx, patch *api.ProjectPatch) (*api.Project, error) {
+	if patch.WorkflowType != nil {
+		f.workflowTypeMap[patch.ID] = *patch.WorkflowType
+	}
+	return &api.Project{ID: patch.ID}, nil
+}
+
+func TestDeferredRepositoryCleanup(t *testing.T) {
+	ctx := context.Background()
+	db := openRepositoryTestDB(ctx, t)
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO repository (id, vcs_id, project_id, external_id, base_directory, file_path_template, webhook_endpoint_id, access_token) VALUES
+			(1, 1, 101, '11', 'bytebase', '{{ENV_NAME}}/{{VERSION}}.sql', 'endpoint-1', 'token-1'),
+			(2, 1, 102, '12', 'bytebase', '', 'endpoint-2', 'token-2');
+	`); err != nil {
+		t.Fatalf("failed to insert the repositories, error %v", err)
+	}
+	projectService := &fakeWorkflowProjectService{workflowTypeMap: make(map[int]api.ProjectWorkflowType)}
+	s := &RepositoryService{l: zap.NewNop(), db: &DB{db: db, Now: time.Now}, projectService: projectService}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx() got error %v, want OK.", err)
+	}
+	defer tx.Rollback()
+
+	// Unlinking with the deferred cleanup keeps the project out of the VCS workflow without flipping it to the UI workflow.
+	cleanupTs := time.Now().Add(time.Hour).Unix()
+	for _, projectID := range []int{101, 102} {
+		if err := s.deferRepositoryCleanup(ctx, tx, &api.RepositoryDelete{ProjectID: projectID, DeleterID: 2, CleanupTs: cleanupTs}); err != nil {
+			t.Fatalf("deferRepositoryCleanup(%d) got error %v, want OK.", projectID, err)
+		}
+		if got := projectService.workflowTypeMap[projectID]; got != api.VCSPendingCleanupWorkflow {
+			t.Errorf("deferRepositoryCleanup(%d) got workflow type %s, want %s.", projectID, got, api.VCSPendingCleanupWorkflow)
+		}
+	}
+	idList, err := findRepositoryIDs(ctx, tx, &api.RepositoryFind{})
+	if err != nil {
+		t.Fatalf("findRepositoryIDs() got error %v, want OK.", err)
+	}
+	if len(idList) != 0 {
+		t.Errorf("findRepositoryIDs() got %v pending cleanup, want none.", idList)
+	}
+
+	// Re-linking the same repository within the grace window restores its settings with the new token and webhook.
+	restored, err := s.restorePendingRepository(ctx, tx, &api.RepositoryCreate{
+		CreatorID:         3,
+		VCSID:             1,
+		ProjectID:         101,
+		ExternalID:        "11",
+		BaseDirectory:     "other",
+		WebhookEndpointID: "endpoint-3",
+		WebhookStatus:     api.WebhookActive,
+		AccessToken:       "token-3",
+	})
+	if err != nil {
+		t.Fatalf("restorePendingRepository() got error %v, want OK.", err)
+	}
+	if restored == nil {
+		t.Fatalf("restorePendingRepository() got nil, want the restored repository.")
+	}
+	if restored.ID != 1 || restored.BaseDirectory != "bytebase" || restored.FilePathTemplate != "{{ENV_NAME}}/{{VERSION}}.sql" {
+		t.Errorf("restorePendingRepository() got repository %d with base directory %q and template %q, want the settings of repository 1.", restored.ID, restored.BaseDirectory, restored.FilePathTemplate)
+	}
+	if restored.WebhookEndpointID != "endpoint-3" || restored.AccessToken != "token-3" {
+		t.Errorf("restorePendingRepository() got webhook endpoint %q and token %q, want the re-linked ones.", restored.WebhookEndpointID, restored.AccessToken)
+	}
+	if got := projectService.workflowTypeMap[101]; got != api.VCSWorkflow {
+		t.Errorf("restorePendingRepository() got workflow type %s, want %s.", got, api.VCSWorkflow)
+	}
+
+	// Linking another repository finalizes the pending cleanup instead of restoring it.
+	restored, err = s.restorePendingRepository(ctx, tx, &api.RepositoryCreate{VCSID: 1, ProjectID: 102, ExternalID: "99"})
+	if err != nil {
+		t.Fatalf("restorePendingRepository() got error %v, want OK.", err)
+	}
+	if restored != nil {
+		t.Errorf("restorePendingRepository() got repository %d for another repository, want nil.", restored.ID)
+	}
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM repository WHERE project_id = 102`).Scan(&count); err != nil {
+		t.Fatalf("failed to count the repositories, error %v", err)
+	}
+	if count != 0 {
+		t.Errorf("restorePendingRepository() left %d repositories pending cleanup, want 0.", count)
+	}
+}
+
+func TestFinalizeRepositoryCleanup(t *testing.T) {
+	ctx := context.Background()
+	db := openRepositoryTestDB(ctx, t)
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `
+		INSERT INTO repository (id, row_status, vcs_id, project_id, external_id, cleanup_ts) VALUES
+			(1, 'ARCHIVED', 1, 101, '11', 100),
+			(2, 'ARCHIVED', 1, 102, '12', 200),
+			(3, 'ARCHIVED', 1, 103, '13', 0),
+			(4, 'NORMAL', 1, 104, '14', 0);
+	`); err != nil {
+		t.Fatalf("failed to insert the repositories, error %v", err)
+	}
+	projectService := &fakeWorkflowProjectService{workflowTypeMap: make(map[int]api.ProjectWorkflowType)}
+	s := &RepositoryService{l: zap.NewNop(), db: &DB{db: db, Now: time.Now}, projectService: projectService}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx() got error %v, want OK.", err)
+	}
+	defer tx.Rollback()
+
+	// Nothing is due within the grace window.
+	projectIDList, err := findDueCleanupProjectIDs(ctx, tx, 99)
+	if err != nil {
+		t.Fatalf("findDueCleanupProjectIDs() got error %v, want OK.", err)
+	}
+	if len(projectIDList) != 0 {
+		t.Errorf("findDueCleanupProjectIDs(99) got %v, want none.", projectIDList)
+	}
+
+	// Only the project whose grace window ends is due, while the repositories archived with the deleted project are left as is.
+	projectIDList, err = findDueCleanupProjectIDs(ctx, tx, 100)
+	if err != nil {
+		t.Fatalf("findDueCleanupProjectIDs() got error %v, want OK.", err)
+	}
+	if want := []int{101}; !reflect.DeepEqual(projectIDList, want) {
+		t.Errorf("findDueCleanupProjectIDs(100) got %v, want %v.", projectIDList, want)
+	}
+	finalized, err := s.finalizeRepositoryCleanup(ctx, tx, 101, 100)
+	if err != nil {
+		t.Fatalf("finalizeRepositoryCleanup() got error %v, want OK.", err)
+	}
+	if !finalized {
+		t.Errorf("finalizeRepositoryCleanup() got false, want true.")
+	}
+	if got := projectService.workflowTypeMap[101]; got != api.UIWorkflow {
+		t.Errorf("finalizeRepositoryCleanup() got workflow type %s, want %s.", got, api.UIWorkflow)
+	}
+	var idList []int
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM repository ORDER BY id`)
+	if err != nil {
+		t.Fatalf("failed to list the repositories, error %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("failed to scan the repository, error %v", err)
+		}
+		idList = append(idList, id)
+	}
+	if want := []int{2, 3, 4}; !reflect.DeepEqual(idList, want) {
+		t.Errorf("finalizeRepositoryCleanup() left repositories %v, want %v.", idList, want)
+	}
+
+	// Finalizing again finds nothing due.
+	finalized, err = s.finalizeRepositoryCleanup(ctx, tx, 101, 100)
+	if err != nil {
+		t.Fatalf("finalizeRepositoryCleanup() got error %v, want OK.", err)
+	}
+	if finalized {
+		t.Errorf("finalizeRepositoryCleanup() again got true, want false.")
+	}
+}
+
+func TestDeleteRepositoryWithSyncHistory(t *testing.T) {
+	ctx := context.Background()
+	db := openRepositoryTestDB(ctx, t)
+	defer db.Close()
+	// The foreign keys are enforced per connection in sqlite.
+	db.SetMaxOpenConns(1)
+	if _, err := db.ExecContext(ctx, `
+		PRAGMA foreign_keys = ON;
+		CREATE TABLE repository_sync_history (
+			id INTEGER PRIMARY KEY,
+			repository_id INTEGER NOT NULL REFERENCES repository (id) ON DELETE CASCADE,
+			commit_id TEXT
+		);
+		INSERT INTO repository (id, row_status, vcs_id, project_id, external_id, cleanup_ts) VALUES
+			(1, 'ARCHIVED', 1, 101, '11', 100),
+			(2, 'ARCHIVED', 1, 102, '12', 4102444800),
+			(3, 'NORMAL', 1, 103, '13', 0);
+		INSERT INTO repository_sync_history (repository_id, commit_id) VALUES
+			(1, 'commit1'),
+			(2, 'commit2'),
+			(3, 'commit3');
+	`); err != nil {
+		t.Fatalf("failed to create the repository_sync_history table, error %v", err)
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO repository_sync_history (repository_id, commit_id) VALUES (99, 'orphan')`); err == nil {
+		t.Fatalf("inserting the sync history of an unknown repository got OK, want the foreign key error.")
+	}
+	projectService := &fakeWorkflowProjectService{workflowTypeMap: make(map[int]api.ProjectWorkflowType)}
+	s := &RepositoryService{l: zap.NewNop(), db: &DB{db: db, Now: time.Now}, projectService: projectService}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx() got error %v, want OK.", err)
+	}
+	defer tx.Rollback()
+
+	// Finalizing the deferred cleanup deletes repository 1.
+	if _, err := s.finalizeRepositoryCleanup(ctx, tx, 101, 100); err != nil {
+		t.Fatalf("finalizeRepositoryCleanup() got error %v, want OK.", err)
+	}
+	// Linking another repository to project 102 deletes repository 2 pending cleanup.
+	if _, err := s.restorePendingRepository(ctx, tx, &api.RepositoryCreate{VCSID: 1, ProjectID: 102, ExternalID: "99"}); err != nil {
+		t.Fatalf("restorePendingRepository() got error %v, want OK.", err)
+	}
+	// Unlinking deletes repository 3.
+	if _, err := tx.ExecContext(ctx, `DELETE FROM repository WHERE project_id = $1`, 103); err != nil {
+		t.Fatalf("failed to unlink the repository, error %v", err)
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM repository_sync_history`).Scan(&count); err != nil {
+		t.Fatalf("failed to count the sync history, error %v", err)
+	}
+	if count != 0 {
+		t.Errorf("got %d sync history entries of the deleted repositories, want 0.", count)
+	}
+}
+
+func TestCountByVCSType(t *testing.T) {
+	tests := []struct {
+		name          string
+		repositoryRow string
+		want          map[string]int
+	}{
+		{
+			name: "no repository",
+			want: map[string]int{},
+		},
+		{
+			name: "repositories of two VCS types",
+			repositoryRow: `
+				(1, 'NORMAL', 1, 101),
+				(2, 'NORMAL', 1, 102),
+				(3, 'NORMAL', 2, 103)`,
+			want: map[string]int{"GITLAB_SELF_HOST": 2, "GITHUB_COM": 1},
+		},
+		{
+			name: "archived repositories not counted",
+			repositoryRow: `
+				(1, 'NORMAL', 1, 101),
+				(2, 'ARCHIVED', 1, 102),
+				(3, 'ARCHIVED', 2, 103)`,
+			want: map[string]int{"GITLAB_SELF_HOST": 1},
+		},
+	}
+
+	for _, test := range tests {
+		ctx := context.Background()
+		db := openRepositoryTestDB(ctx, t)
+		if _, err := db.ExecContext(ctx, `
+			CREATE TABLE vcs (
+				id INTEGER PRIMARY KEY,
+				type TEXT
+			);
+			INSERT INTO vcs (id, type) VALUES (1, 'GITLAB_SELF_HOST'), (2, 'GITHUB_COM');
+		`); err != nil {
+			db.Close()
+			t.Fatalf("%q: failed to create the VCS table, error %v", test.name, err)
+		}
+		if test.repositoryRow != "" {
+			if _, err := db.ExecContext(ctx, `INSERT INTO repository (id, row_status, vcs_id, project_id) VALUES `+test.repositoryRow); err != nil {
+				db.Close()
+				t.Fatalf("%q: failed to insert the repositories, error %v", test.name, err)
+			}
+		}
+		s := &RepositoryService{l: zap.NewNop(), db: &DB{db: db, Now: time.Now}}
+
+		got, err := s.CountByVCSType(ctx)
+		db.Close()
+		if err != nil {
+			t.Fatalf("%q: CountByVCSType() got error %v, want OK.", test.name, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: CountByVCSType() got %v, want %v.", test.name, got, test.want)
+		}
+	}
+}
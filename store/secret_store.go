@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/bytebase/bytebase/api"
+	"github.com/bytebase/bytebase/common"
+)
+
+// SecretStore stores the VCS tokens of the repositories. The token columns hold the opaque references returned by
+// the store, so the tokens may live in an external secret manager instead of the database.
+type SecretStore interface {
+	// Get returns the secret referenced by ref.
+	Get(ref string) (string, error)
+	// Put stores the secret replacing the one referenced by ref, or a new secret if ref is empty,
+	// and returns the reference to store in the column.
+	Put(ref string, value string) (newRef string, err error)
+}
+
+var (
+	_ SecretStore = (*DBSecretStore)(nil)
+)
+
+// DBSecretStore is the default SecretStore keeping the secrets in the token columns, i.e. the reference is the secret itself.
+type DBSecretStore struct{}
+
+// Get returns ref, which is the secret itself.
+func (*DBSecretStore) Get(ref string) (string, error) {
+	return ref, nil
+}
+
+// Put returns value to be stored in the column as is.
+func (*DBSecretStore) Put(ref string, value string) (string, error) {
+	return value, nil
+}
+
+// getSecretStore returns the configured secret store, defaulting to the DB-backed one.
+func (s *RepositoryService) getSecretStore() SecretStore {
+	if s.secretStore == nil {
+		return &DBSecretStore{}
+	}
+	return s.secretStore
+}
+
+// putSecret stores the secret replacing the one referenced by ref, and returns the reference to store in the column.
+// The empty secret is stored as the empty reference without calling the store.
+func (s *RepositoryService) putSecret(ref string, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	newRef, err := s.getSecretStore().Put(ref, value)
+	if err != nil {
+		return "", &common.Error{Code: common.Internal, Err: fmt.Errorf("failed to put the secret to the secret store, error %w", err)}
+	}
+	return newRef, nil
+}
+
+// getSecret returns the secret referenced by ref. The empty reference is the empty secret.
+func (s *RepositoryService) getSecret(ref string) (string, error) {
+	if ref == "" {
+		return "", nil
+	}
+	value, err := s.getSecretStore().Get(ref)
+	if err != nil {
+		return "", &common.Error{Code: common.Internal, Err: fmt.Errorf("failed to get the secret from the secret store, error %w", err)}
+	}
+	return value, nil
+}
+
+// resolveRepositoryTokens replaces the token references scanned from the columns by the tokens.
+func (s *RepositoryService) resolveRepositoryTokens(repository *api.Repository) error {
+	accessToken, err := s.getSecret(repository.AccessToken)
+	if err != nil {
+		return err
+	}
+	refreshToken, err := s.getSecret(repository.RefreshToken)
+	if err != nil {
+		return err
+	}
+	repository.AccessToken = accessToken
+	repository.RefreshToken = refreshToken
+	return nil
+}
+
+// findRepositoryTokenRefs returns the token references of the repository matching the where clause, empty if not found.
+func findRepositoryTokenRefs(ctx context.Context, tx *sql.Tx, where string, args ...interface{}) (string, string, error) {
+	var accessRef, refreshRef string
+	if err := tx.QueryRowContext(ctx, `
+		SELECT access_token, refresh_token
+		FROM repository
+		WHERE `+where,
+		args...,
+	).Scan(&accessRef, &refreshRef); err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", nil
+		}
+		return "", "", FormatError(err)
+	}
+	return accessRef, refreshRef, nil
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+)
+
+// fakeSecretStore is a fake external secret manager keeping the secrets in memory.
+type fakeSecretStore struct {
+	secretMap map[string]string
+	putCount  int
+}
+
+func (s *fakeSecretStore) Get(ref string) (string, error) {
+	value, ok := s.secretMap[ref]
+	if !ok {
+		return "", fmt.Errorf("secret %q not found", ref)
+	}
+	return value, nil
+}
+
+func (s *fakeSecretStore) Put(ref string, value string) (string, error) {
+	s.putCount++
+	if _, ok := s.secretMap[ref]; !ok {
+		ref = fmt.Sprintf("secret/%d", s.putCount)
+	}
+	s.secretMap[ref] = value
+	return ref, nil
+}
+
+func TestSecretStore(t *testing.T) {
+	tests := []struct {
+		name        string
+		secretStore *fakeSecretStore
+	}{
+		{
+			name: "DB-backed by default",
+		},
+		{
+			name:        "external secret store",
+			secretStore: &fakeSecretStore{secretMap: map[string]string{}},
+		},
+	}
+
+	for _, test := range tests {
+		ctx := context.Background()
+		db := openRepositoryTestDB(ctx, t)
+		if _, err := db.ExecContext(ctx, `INSERT INTO repository (id, vcs_id, project_id) VALUES (1, 1, 101);`); err != nil {
+			db.Close()
+			t.Fatalf("failed to insert the repository, error %v", err)
+		}
+		s := &RepositoryService{db: &DB{db: db, Now: time.Now}}
+		if test.secretStore != nil {
+			s.SetSecretStore(test.secretStore)
+		}
+		// wantRef returns the reference the token column is expected to hold.
+		wantRef := func(token string) string {
+			if test.secretStore == nil {
+				return token
+			}
+			for ref, value := range test.secretStore.secretMap {
+				if value == token {
+					return ref
+				}
+			}
+			return ""
+		}
+		checkTokens := func(step string, wantAccessToken, wantRefreshToken string) {
+			repository, err := s.FindRepository(ctx, &api.RepositoryFind{ID: &[]int{1}[0], IncludeSecrets: true})
+			if err != nil {
+				t.Fatalf("%q: %s: FindRepository() got error %v, want OK.", test.name, step, err)
+			}
+			if repository.AccessToken != wantAccessToken || repository.RefreshToken != wantRefreshToken {
+				t.Errorf("%q: %s: FindRepository() got tokens %q %q, want %q %q.", test.name, step, repository.AccessToken, repository.RefreshToken, wantAccessToken, wantRefreshToken)
+			}
+			var accessRef, refreshRef string
+			if err := db.QueryRowContext(ctx, "SELECT access_token, refresh_token FROM repository WHERE id = 1").Scan(&accessRef, &refreshRef); err != nil {
+				t.Fatalf("failed to query the repository, error %v", err)
+			}
+			if accessRef != wantRef(wantAccessToken) || refreshRef != wantRef(wantRefreshToken) {
+				t.Errorf("%q: %s: got token columns %q %q, want %q %q.", test.name, step, accessRef, refreshRef, wantRef(wantAccessToken), wantRef(wantRefreshToken))
+			}
+		}
+
+		accessToken, refreshToken := "access-1", "refresh-1"
+		repository, err := s.PatchRepository(ctx, &api.RepositoryPatch{ID: 1, AccessToken: &accessToken, RefreshToken: &refreshToken})
+		if err != nil {
+			t.Fatalf("%q: PatchRepository() got error %v, want OK.", test.name, err)
+		}
+		// The patched repository is returned with the tokens rather than the references.
+		if repository.AccessToken != accessToken || repository.RefreshToken != refreshToken {
+			t.Errorf("%q: PatchRepository() got tokens %q %q, want %q %q.", test.name, repository.AccessToken, repository.RefreshToken, accessToken, refreshToken)
+		}
+		checkTokens("patch", accessToken, refreshToken)
+
+		swapped, err := s.SwapRepositoryToken(ctx, &api.RepositoryTokenSwap{ID: 1, OldRefreshToken: refreshToken, AccessToken: "access-2", RefreshToken: "refresh-2"})
+		if err != nil {
+			t.Fatalf("%q: SwapRepositoryToken() got error %v, want OK.", test.name, err)
+		}
+		if !swapped {
+			t.Errorf("%q: SwapRepositoryToken() got swapped false, want true.", test.name)
+		}
+		checkTokens("swap", "access-2", "refresh-2")
+
+		// The concurrent refresh losing the race doesn't touch the stored tokens.
+		swapped, err = s.SwapRepositoryToken(ctx, &api.RepositoryTokenSwap{ID: 1, OldRefreshToken: refreshToken, AccessToken: "access-3", RefreshToken: "refresh-3"})
+		if err != nil {
+			t.Fatalf("%q: SwapRepositoryToken() got error %v, want OK.", test.name, err)
+		}
+		if swapped {
+			t.Errorf("%q: SwapRepositoryToken() with the stale refresh token got swapped true, want false.", test.name)
+		}
+		checkTokens("stale swap", "access-2", "refresh-2")
+
+		// The secrets aren't resolved unless requested.
+		repository, err = s.FindRepository(ctx, &api.RepositoryFind{ID: &[]int{1}[0]})
+		if err != nil {
+			t.Fatalf("%q: FindRepository() got error %v, want OK.", test.name, err)
+		}
+		if repository.AccessToken != "" || repository.RefreshToken != "" {
+			t.Errorf("%q: FindRepository() without secrets got tokens %q %q, want empty.", test.name, repository.AccessToken, repository.RefreshToken)
+		}
+		db.Close()
+	}
+}
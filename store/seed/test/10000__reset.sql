@@ -1,9 +1,10 @@
 -- For testing, we reset data on each run
 -- Do not reset bb.auth.secret so that we don't need to re-login after restart
+-- Do not reset bb.workspace.id so that the license bound to the workspace stays valid after restart
 DELETE FROM
     setting
 WHERE
-    name != 'bb.auth.secret';
+    name NOT IN ('bb.auth.secret', 'bb.workspace.id');
 
 DELETE FROM
     anomaly;
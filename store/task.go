@@ -143,7 +143,7 @@ func (s *TaskService) createTask(ctx context.Context, tx *sql.Tx, create *api.Ta
 			earliest_allowed_ts
 		)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		RETURNING id, creator_id, created_ts, updater_id, updated_ts, pipeline_id, stage_id, instance_id, database_id, name, status, type, payload, earliest_allowed_ts
+		RETURNING id, creator_id, created_ts, updater_id, updated_ts, pipeline_id, stage_id, instance_id, database_id, name, status, type, payload, earliest_allowed_ts, approved_ts, approval_list, retry_count, last_error, next_retry_ts
 	`,
 			create.CreatorID,
 			create.CreatorID,
@@ -172,7 +172,7 @@ func (s *TaskService) createTask(ctx context.Context, tx *sql.Tx, create *api.Ta
 			earliest_allowed_ts
 		)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		RETURNING id, creator_id, created_ts, updater_id, updated_ts, pipeline_id, stage_id, instance_id, database_id, name, status, type, payload, earliest_allowed_ts
+		RETURNING id, creator_id, created_ts, updater_id, updated_ts, pipeline_id, stage_id, instance_id, database_id, name, status, type, payload, earliest_allowed_ts, approved_ts, approval_list, retry_count, last_error, next_retry_ts
 	`,
 			create.CreatorID,
 			create.CreatorID,
@@ -213,6 +213,11 @@ func (s *TaskService) createTask(ctx context.Context, tx *sql.Tx, create *api.Ta
 		&task.Type,
 		&task.Payload,
 		&task.EarliestAllowedTs,
+		&task.ApprovedTs,
+		&task.ApprovalList,
+		&task.RetryCount,
+		&task.LastError,
+		&task.NextRetryTs,
 	); err != nil {
 		return nil, FormatError(err)
 	}
@@ -275,7 +280,12 @@ func (s *TaskService) findTaskList(ctx context.Context, tx *sql.Tx, find *api.Ta
 			status,
 			type,
 			payload,
-			earliest_allowed_ts
+			earliest_allowed_ts,
+			approved_ts,
+			approval_list,
+			retry_count,
+			last_error,
+			next_retry_ts
 		FROM task
 		WHERE `+strings.Join(where, " AND "),
 		args...,
@@ -304,6 +314,11 @@ func (s *TaskService) findTaskList(ctx context.Context, tx *sql.Tx, find *api.Ta
 			&task.Type,
 			&task.Payload,
 			&task.EarliestAllowedTs,
+			&task.ApprovedTs,
+			&task.ApprovalList,
+			&task.RetryCount,
+			&task.LastError,
+			&task.NextRetryTs,
 		); err != nil {
 			return nil, FormatError(err)
 		}
@@ -350,6 +365,18 @@ func (s *TaskService) patchTask(ctx context.Context, tx *sql.Tx, patch *api.Task
 	if v := patch.EarliestAllowedTs; v != nil {
 		set, args = append(set, fmt.Sprintf("earliest_allowed_ts = $%d", len(args)+1)), append(args, *v)
 	}
+	if v := patch.ApprovalList; v != nil {
+		set, args = append(set, fmt.Sprintf("approval_list = $%d", len(args)+1)), append(args, *v)
+	}
+	if v := patch.RetryCount; v != nil {
+		set, args = append(set, fmt.Sprintf("retry_count = $%d", len(args)+1)), append(args, *v)
+	}
+	if v := patch.LastError; v != nil {
+		set, args = append(set, fmt.Sprintf("last_error = $%d", len(args)+1)), append(args, *v)
+	}
+	if v := patch.NextRetryTs; v != nil {
+		set, args = append(set, fmt.Sprintf("next_retry_ts = $%d", len(args)+1)), append(args, *v)
+	}
 	args = append(args, patch.ID)
 
 	// Execute update query with RETURNING.
@@ -357,7 +384,7 @@ func (s *TaskService) patchTask(ctx context.Context, tx *sql.Tx, patch *api.Task
 		UPDATE task
 		SET `+strings.Join(set, ", ")+`
 		WHERE id = $%d
-		RETURNING id, creator_id, created_ts, updater_id, updated_ts, pipeline_id, stage_id, instance_id, database_id, name, status, type, payload, earliest_allowed_ts
+		RETURNING id, creator_id, created_ts, updater_id, updated_ts, pipeline_id, stage_id, instance_id, database_id, name, status, type, payload, earliest_allowed_ts, approved_ts, approval_list, retry_count, last_error, next_retry_ts
 	`, len(args)),
 		args...,
 	)
@@ -383,6 +410,11 @@ func (s *TaskService) patchTask(ctx context.Context, tx *sql.Tx, patch *api.Task
 			&task.Type,
 			&task.Payload,
 			&task.EarliestAllowedTs,
+			&task.ApprovedTs,
+			&task.ApprovalList,
+			&task.RetryCount,
+			&task.LastError,
+			&task.NextRetryTs,
 		); err != nil {
 			return nil, FormatError(err)
 		}
@@ -466,6 +498,14 @@ func (s *TaskService) patchTaskStatus(ctx context.Context, tx *sql.Tx, patch *ap
 	// Build UPDATE clause.
 	set, args := []string{"updater_id = $1"}, []interface{}{patch.UpdaterID}
 	set, args = append(set, "status = $2"), append(args, patch.Status)
+	// The approval starts the minimum hold duration of the approval policy.
+	if task.Status == api.TaskPendingApproval && patch.Status == api.TaskPending {
+		set = append(set, "approved_ts = extract(epoch from now())::BIGINT")
+	}
+	// The new run starts over the automatic retries.
+	if patch.Status == api.TaskRunning {
+		set = append(set, "retry_count = 0", "next_retry_ts = 0")
+	}
 	args = append(args, patch.ID)
 
 	// Execute update query with RETURNING.
@@ -473,7 +513,7 @@ func (s *TaskService) patchTaskStatus(ctx context.Context, tx *sql.Tx, patch *ap
 		UPDATE task
 		SET `+strings.Join(set, ", ")+`
 		WHERE id = $3
-		RETURNING id, creator_id, created_ts, updater_id, updated_ts, pipeline_id, stage_id, instance_id, database_id, name, status, type, payload, earliest_allowed_ts
+		RETURNING id, creator_id, created_ts, updater_id, updated_ts, pipeline_id, stage_id, instance_id, database_id, name, status, type, payload, earliest_allowed_ts, approved_ts, approval_list, retry_count, last_error, next_retry_ts
 	`,
 		args...,
 	)
@@ -499,6 +539,11 @@ func (s *TaskService) patchTaskStatus(ctx context.Context, tx *sql.Tx, patch *ap
 			&task.Type,
 			&task.Payload,
 			&task.EarliestAllowedTs,
+			&task.ApprovedTs,
+			&task.ApprovalList,
+			&task.RetryCount,
+			&task.LastError,
+			&task.NextRetryTs,
 		); err != nil {
 			return nil, FormatError(err)
 		}
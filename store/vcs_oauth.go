@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/bytebase/bytebase/api"
+	"go.uber.org/zap"
+)
+
+var (
+	_ api.VCSOAuthService = (*VCSOAuthService)(nil)
+)
+
+// VCSOAuthService represents a service for managing the VCS OAuth states and tickets.
+type VCSOAuthService struct {
+	l  *zap.Logger
+	db *DB
+}
+
+// NewVCSOAuthService returns a new instance of VCSOAuthService.
+func NewVCSOAuthService(logger *zap.Logger, db *DB) *VCSOAuthService {
+	return &VCSOAuthService{l: logger, db: db}
+}
+
+// CreateOAuthState creates the OAuth state, purging the expired states and tickets
+// so that the abandoned authorizations don't pile up.
+func (s *VCSOAuthService) CreateOAuthState(ctx context.Context, create *api.VCSOAuthState) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	now := time.Now().Unix()
+	if _, err := tx.PTx.ExecContext(ctx, `DELETE FROM vcs_oauth_state WHERE expires_ts <= $1`, now); err != nil {
+		return FormatError(err)
+	}
+	if _, err := tx.PTx.ExecContext(ctx, `DELETE FROM vcs_oauth_ticket WHERE expires_ts <= $1`, now); err != nil {
+		return FormatError(err)
+	}
+	if _, err := tx.PTx.ExecContext(ctx, `
+		INSERT INTO vcs_oauth_state (
+			state,
+			vcs_id,
+			principal_id,
+			code_verifier,
+			expires_ts
+		)
+		VALUES ($1, $2, $3, $4, $5)
+	`,
+		create.State,
+		create.VCSID,
+		create.PrincipalID,
+		create.CodeVerifier,
+		create.ExpiresTs,
+	); err != nil {
+		return FormatError(err)
+	}
+
+	if err := tx.PTx.Commit(); err != nil {
+		return FormatError(err)
+	}
+	return nil
+}
+
+// ConsumeOAuthState deletes the OAuth state and returns it, nil if it's not found.
+// Deleting and returning at once ensures the state is consumed only once by the concurrent exchanges.
+func (s *VCSOAuthService) ConsumeOAuthState(ctx context.Context, state string) (*api.VCSOAuthState, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	rows, err := tx.PTx.QueryContext(ctx, `
+		DELETE FROM vcs_oauth_state
+		WHERE state = $1
+		RETURNING state, vcs_id, principal_id, code_verifier, expires_ts
+	`,
+		state,
+	)
+	if err != nil {
+		return nil, FormatError(err)
+	}
+	defer rows.Close()
+
+	var oauthState *api.VCSOAuthState
+	if rows.Next() {
+		oauthState = &api.VCSOAuthState{}
+		if err := rows.Scan(
+			&oauthState.State,
+			&oauthState.VCSID,
+			&oauthState.PrincipalID,
+			&oauthState.CodeVerifier,
+			&oauthState.ExpiresTs,
+		); err != nil {
+			return nil, FormatError(err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, FormatError(err)
+	}
+	rows.Close()
+
+	if err := tx.PTx.Commit(); err != nil {
+		return nil, FormatError(err)
+	}
+	return oauthState, nil
+}
+
+// CreateOAuthTicket creates the OAuth ticket.
+func (s *VCSOAuthService) CreateOAuthTicket(ctx context.Context, create *api.VCSOAuthTicket) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	if _, err := tx.PTx.ExecContext(ctx, `
+		INSERT INTO vcs_oauth_ticket (
+			ticket,
+			vcs_id,
+			principal_id,
+			access_token,
+			refresh_token,
+			token_expires_ts,
+			expires_ts
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`,
+		create.Ticket,
+		create.VCSID,
+		create.PrincipalID,
+		create.AccessToken,
+		create.RefreshToken,
+		create.TokenExpiresTs,
+		create.ExpiresTs,
+	); err != nil {
+		return FormatError(err)
+	}
+
+	if err := tx.PTx.Commit(); err != nil {
+		return FormatError(err)
+	}
+	return nil
+}
+
+// FindOAuthTicket returns the OAuth ticket, nil if it's not found.
+func (s *VCSOAuthService) FindOAuthTicket(ctx context.Context, ticket string) (*api.VCSOAuthTicket, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	rows, err := tx.PTx.QueryContext(ctx, `
+		SELECT ticket, vcs_id, principal_id, access_token, refresh_token, token_expires_ts, expires_ts
+		FROM vcs_oauth_ticket
+		WHERE ticket = $1
+	`,
+		ticket,
+	)
+	if err != nil {
+		return nil, FormatError(err)
+	}
+	defer rows.Close()
+
+	var oauthTicket *api.VCSOAuthTicket
+	if rows.Next() {
+		oauthTicket = &api.VCSOAuthTicket{}
+		if err := rows.Scan(
+			&oauthTicket.Ticket,
+			&oauthTicket.VCSID,
+			&oauthTicket.PrincipalID,
+			&oauthTicket.AccessToken,
+			&oauthTicket.RefreshToken,
+			&oauthTicket.TokenExpiresTs,
+			&oauthTicket.ExpiresTs,
+		); err != nil {
+			return nil, FormatError(err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, FormatError(err)
+	}
+	return oauthTicket, nil
+}
+
+// DeleteOAuthTicket deletes the OAuth ticket, it's a no-op if the ticket is not found.
+func (s *VCSOAuthService) DeleteOAuthTicket(ctx context.Context, ticket string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return FormatError(err)
+	}
+	defer tx.PTx.Rollback()
+
+	if _, err := tx.PTx.ExecContext(ctx, `DELETE FROM vcs_oauth_ticket WHERE ticket = $1`, ticket); err != nil {
+		return FormatError(err)
+	}
+
+	if err := tx.PTx.Commit(); err != nil {
+		return FormatError(err)
+	}
+	return nil
+}
@@ -13,6 +13,13 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 )
 
+const (
+	// AccessToken is the access token exchanged by the fake GitLab.
+	AccessToken = "accessToken1"
+	// RefreshToken is the refresh token exchanged by the fake GitLab.
+	RefreshToken = "refreshToken1"
+)
+
 // GitLab is a fake implementation of GitLab.
 type GitLab struct {
 	port int
@@ -45,7 +52,9 @@ func NewGitLab(port int) *GitLab {
 	}
 
 	// Routes
+	e.POST("/oauth/token", gl.exchangeOAuthToken)
 	projectGroup := e.Group("/api/v4")
+	projectGroup.GET("/user", gl.getCurrentUser)
 	projectGroup.POST("/projects/:id/hooks", gl.createProjectHook)
 	projectGroup.GET("/projects/:id/repository/files/:file/raw", gl.readProjectFile)
 	projectGroup.GET("/projects/:id/repository/files/:file", gl.readProjectFileMetadata)
@@ -72,6 +81,25 @@ func (gl *GitLab) CreateProject(id string) {
 	}
 }
 
+// exchangeOAuthToken exchanges any authorization code for the fixed token that never expires.
+func (gl *GitLab) exchangeOAuthToken(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"access_token":  AccessToken,
+		"refresh_token": RefreshToken,
+		"expires_in":    0,
+		"created_at":    0,
+	})
+}
+
+// getCurrentUser returns the user of the token.
+func (gl *GitLab) getCurrentUser(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"id":       1,
+		"username": "bytebase",
+		"name":     "Bytebase",
+	})
+}
+
 // createProjectHook creates a project webhook.
 func (gl *GitLab) createProjectHook(c echo.Context) error {
 	gitlabProjectID := c.Param("id")
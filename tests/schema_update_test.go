@@ -380,8 +380,10 @@ func TestVCS(t *testing.T) {
 
 	// Create a repository.
 	repositoryPath := "test/schemaUpdate"
-	accessToken := "accessToken1"
-	refreshToken := "refreshToken1"
+	oauthTicket, err := ctl.exchangeOAuthTicket(vcs.ID)
+	if err != nil {
+		t.Fatalf("failed to exchange OAuth ticket, error: %v", err)
+	}
 	gitlabProjectID := 121
 	gitlabProjectIDStr := fmt.Sprintf("%d", gitlabProjectID)
 	// create a gitlab project.
@@ -397,9 +399,7 @@ func TestVCS(t *testing.T) {
 		FilePathTemplate:   "{{ENV_NAME}}/{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql",
 		SchemaPathTemplate: "{{ENV_NAME}}/.{{DB_NAME}}__LATEST.sql",
 		ExternalID:         gitlabProjectIDStr,
-		AccessToken:        accessToken,
-		ExpiresTs:          0,
-		RefreshToken:       refreshToken,
+		OAuthTicket:        oauthTicket,
 	})
 	if err != nil {
 		t.Fatalf("failed to create repository, error: %v", err)
@@ -269,8 +269,10 @@ func TestTenantVCS(t *testing.T) {
 
 	// Create a repository.
 	repositoryPath := "test/schemaUpdate"
-	accessToken := "accessToken1"
-	refreshToken := "refreshToken1"
+	oauthTicket, err := ctl.exchangeOAuthTicket(vcs.ID)
+	if err != nil {
+		t.Fatalf("failed to exchange OAuth ticket, error: %v", err)
+	}
 	gitlabProjectID := 121
 	gitlabProjectIDStr := fmt.Sprintf("%d", gitlabProjectID)
 	// create a gitlab project.
@@ -286,9 +288,7 @@ func TestTenantVCS(t *testing.T) {
 		FilePathTemplate:   "{{DB_NAME}}__{{VERSION}}__{{TYPE}}__{{DESCRIPTION}}.sql",
 		SchemaPathTemplate: ".{{DB_NAME}}__LATEST.sql",
 		ExternalID:         gitlabProjectIDStr,
-		AccessToken:        accessToken,
-		ExpiresTs:          0,
-		RefreshToken:       refreshToken,
+		OAuthTicket:        oauthTicket,
 	})
 	if err != nil {
 		t.Fatalf("failed to create repository, error: %v", err)
@@ -762,6 +762,36 @@ func (ctl *controller) createVCS(vcsCreate api.VCSCreate) (*api.VCS, error) {
 	return vcs, nil
 }
 
+// exchangeOAuthTicket authorizes the VCS by OAuth, and returns the ticket for linking a repository.
+func (ctl *controller) exchangeOAuthTicket(vcsID int) (string, error) {
+	body, err := ctl.post(fmt.Sprintf("/vcs/%d/oauth/authorize", vcsID), new(bytes.Buffer))
+	if err != nil {
+		return "", err
+	}
+	authorize := new(api.VCSOAuthAuthorize)
+	if err = jsonapi.UnmarshalPayload(body, authorize); err != nil {
+		return "", fmt.Errorf("fail to unmarshal oauth authorize response, error: %w", err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := jsonapi.MarshalPayload(buf, &api.VCSOAuthExchange{
+		State:       authorize.State,
+		Code:        "code",
+		RedirectURL: "http://localhost/oauth/callback",
+	}); err != nil {
+		return "", fmt.Errorf("failed to marshal oauth exchange, error: %w", err)
+	}
+	body, err = ctl.post(fmt.Sprintf("/vcs/%d/oauth/token", vcsID), buf)
+	if err != nil {
+		return "", err
+	}
+	token := new(api.VCSOAuthToken)
+	if err = jsonapi.UnmarshalPayload(body, token); err != nil {
+		return "", fmt.Errorf("fail to unmarshal oauth token response, error: %w", err)
+	}
+	return token.Ticket, nil
+}
+
 // createRepository creates a repository.
 func (ctl *controller) createRepository(repositoryCreate api.RepositoryCreate) (*api.Repository, error) {
 	buf := new(bytes.Buffer)